@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1beta1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	// allNamespaces lists the nginx instances of all namespaces
+	allNamespaces bool
+
+	// followLogs keeps streaming the logs of the pods
+	followLogs bool
+
+	// tailLines is the number of recent log lines printed for each pod, all
+	// of them if negative
+	tailLines int64
+
+	// forwardTimeout is how long ports are forwarded, without limit if zero
+	forwardTimeout time.Duration
+
+	// forwardLogs follows the logs of the pod ports are forwarded to
+	forwardLogs bool
+
+	// renderFile is the Nginx manifest rendered, the standard input if -
+	renderFile string
+)
+
+func runList(c *cli, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	namespace := c.namespace
+	if allNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+	list, err := c.nginx.NginxV1alpha1().Nginxes(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nginx instances: %v", err)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 3, ' ', 0)
+	if allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tREADY\tENDPOINTS\tAGE")
+	for i := range list.Items {
+		n := &list.Items[i]
+		pods, err := c.pods(n)
+		if err != nil {
+			return err
+		}
+		services, err := c.kube.CoreV1().Services(n.Namespace).List(metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(k8s.LabelsForNginx(n.Name)).String(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list services of nginx %s: %v", n.Name, err)
+		}
+		endpoints := strings.Join(k8s.Endpoints(n, services.Items), ",")
+		if endpoints == "" {
+			endpoints = "<none>"
+		}
+		if allNamespaces {
+			fmt.Fprintf(w, "%s\t", n.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%s\t%s\n", n.Name, k8s.ReadyPods(pods), len(pods), endpoints, age(n.CreationTimestamp))
+	}
+	return w.Flush()
+}
+
+func runConfig(c *cli, args []string) error {
+	n, err := c.instance(args)
+	if err != nil {
+		return err
+	}
+	pods, err := c.pods(n)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("nginx %s has no pods", n.Name)
+	}
+	// The newest pod runs the latest config rolled out
+	pod := &pods[0]
+	for i := range pods {
+		if pods[i].CreationTimestamp.After(pod.CreationTimestamp.Time) {
+			pod = &pods[i]
+		}
+	}
+	configMap, inline := k8s.PodConfig(pod)
+	switch {
+	case configMap != "":
+		cm, err := c.kube.CoreV1().ConfigMaps(n.Namespace).Get(configMap, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to retrieve config map %s: %v", configMap, err)
+		}
+		config, ok := cm.Data["nginx.conf"]
+		if !ok {
+			return fmt.Errorf("config map %s has no nginx.conf", configMap)
+		}
+		fmt.Fprint(c.out, config)
+	case inline != "":
+		fmt.Fprint(c.out, inline)
+	default:
+		return fmt.Errorf("pod %s uses the nginx.conf of the image %s", pod.Name, pod.Spec.Containers[0].Image)
+	}
+	return nil
+}
+
+func runReload(c *cli, args []string) error {
+	n, err := c.instance(args)
+	if err != nil {
+		return err
+	}
+	pods, err := c.pods(n)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("nginx %s has no pods", n.Name)
+	}
+	patch, err := annotationPatch(k8s.ReloadPodAnnotation, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return err
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if !k8s.PodReloadsInPlace(pod) {
+			return fmt.Errorf("pod %s does not reload nginx in place, set spec.configReload: Reload or use restart instead", pod.Name)
+		}
+		if _, err := c.kube.CoreV1().Pods(pod.Namespace).Patch(pod.Name, types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("failed to request reload of pod %s: %v", pod.Name, err)
+		}
+		fmt.Fprintf(c.out, "pod/%s reload requested\n", pod.Name)
+	}
+	return nil
+}
+
+func runRestart(c *cli, args []string) error {
+	name, err := instanceName(args)
+	if err != nil {
+		return err
+	}
+	patch, err := annotationPatch(k8s.RestartAnnotation, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	if _, err := c.nginx.NginxV1alpha1().Nginxes(c.namespace).Patch(name, types.MergePatchType, patch); err != nil {
+		return fmt.Errorf("failed to request restart of nginx %s: %v", name, err)
+	}
+	fmt.Fprintf(c.out, "nginx/%s restart requested\n", name)
+	return nil
+}
+
+// runPause returns the command setting spec.paused of the nginx
+func runPause(paused bool) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		name, err := instanceName(args)
+		if err != nil {
+			return err
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]bool{"paused": paused},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := c.nginx.NginxV1alpha1().Nginxes(c.namespace).Patch(name, types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("failed to set spec.paused of nginx %s: %v", name, err)
+		}
+		if paused {
+			fmt.Fprintf(c.out, "nginx/%s paused\n", name)
+		} else {
+			fmt.Fprintf(c.out, "nginx/%s resumed\n", name)
+		}
+		return nil
+	}
+}
+
+func runApprove(c *cli, args []string) error {
+	n, err := c.instance(args)
+	if err != nil {
+		return err
+	}
+	pending := n.Status.PendingApply
+	if pending == nil {
+		return fmt.Errorf("nginx %s has no changes waiting for approval", n.Name)
+	}
+	patch, err := annotationPatch(k8s.ApproveApplyAnnotation, pending.Revision)
+	if err != nil {
+		return err
+	}
+	if _, err := c.nginx.NginxV1alpha1().Nginxes(n.Namespace).Patch(n.Name, types.MergePatchType, patch); err != nil {
+		return fmt.Errorf("failed to approve revision %s of nginx %s: %v", pending.Revision, n.Name, err)
+	}
+	for _, change := range pending.Changes {
+		fmt.Fprintf(c.out, "  %s\n", change)
+	}
+	fmt.Fprintf(c.out, "nginx/%s revision %s approved\n", n.Name, pending.Revision)
+	return nil
+}
+
+func runLogs(c *cli, args []string) error {
+	n, err := c.instance(args)
+	if err != nil {
+		return err
+	}
+	pods, err := c.pods(n)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("nginx %s has no pods", n.Name)
+	}
+	opts := &corev1.PodLogOptions{Container: "nginx", Follow: followLogs}
+	if tailLines >= 0 {
+		opts.TailLines = &tailLines
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []string
+	)
+	out := &lockedWriter{w: c.out}
+	for i := range pods {
+		wg.Add(1)
+		go func(pod *corev1.Pod) {
+			defer wg.Done()
+			if err := streamLogs(c, pod, opts, out, len(pods) > 1); err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(&pods[i])
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func runPortForward(c *cli, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("expected the name of one nginx and optionally a local port, got %d arguments", len(args))
+	}
+	n, err := c.instance(args[:1])
+	if err != nil {
+		return err
+	}
+	pods, err := c.pods(n)
+	if err != nil {
+		return err
+	}
+	var pod *corev1.Pod
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil && k8s.CanaryPodReady(&pods[i]) {
+			pod = &pods[i]
+			break
+		}
+	}
+	if pod == nil {
+		return fmt.Errorf("nginx %s has no ready pods", n.Name)
+	}
+	port, scheme, err := k8s.ForwardPort(pod)
+	if err != nil {
+		return err
+	}
+	local := "8080"
+	if scheme == "https" {
+		local = "8443"
+	}
+	if len(args) == 2 {
+		local = args[1]
+	}
+
+	// Port forwarding is delegated to kubectl, whose SPDY client is not part
+	// of the client-go version the plugin is built with
+	ctx := context.Background()
+	if forwardTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, forwardTimeout)
+		defer cancel()
+	}
+	kubectlArgs := []string{"-n", pod.Namespace}
+	if c.kubeconfig != "" {
+		kubectlArgs = append(kubectlArgs, "--kubeconfig", c.kubeconfig)
+	}
+	if c.context != "" {
+		kubectlArgs = append(kubectlArgs, "--context", c.context)
+	}
+	kubectlArgs = append(kubectlArgs, "port-forward", "pod/"+pod.Name, fmt.Sprintf("%s:%d", local, port))
+	cmd := exec.CommandContext(ctx, "kubectl", kubectlArgs...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	fmt.Fprintf(c.out, "Forwarding %s://localhost:%s to pod %s port %d", scheme, local, pod.Name, port)
+	if forwardTimeout > 0 {
+		fmt.Fprintf(c.out, " for %s", forwardTimeout)
+	}
+	fmt.Fprintln(c.out)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run kubectl port-forward: %v", err)
+	}
+	if forwardLogs {
+		var tail int64
+		out := &lockedWriter{w: c.out}
+		go streamLogs(c, pod, &corev1.PodLogOptions{Container: "nginx", Follow: true, TailLines: &tail}, out, false)
+	}
+	err = cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		fmt.Fprintf(c.out, "Stopped forwarding to pod %s after %s\n", pod.Name, forwardTimeout)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("kubectl port-forward failed: %v", err)
+	}
+	return nil
+}
+
+func runImport(c *cli, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected the kind and the name of the object to import, got %d arguments", len(args))
+	}
+	kind, name := strings.ToLower(args[0]), args[1]
+	resolve := func(service, port string) (int32, error) {
+		svc, err := c.kube.CoreV1().Services(c.namespace).Get(service, metav1.GetOptions{})
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range svc.Spec.Ports {
+			if p.Name == port {
+				return p.Port, nil
+			}
+		}
+		return 0, fmt.Errorf("service %s has no port named %s", service, port)
+	}
+
+	var (
+		n           *v1alpha1.Nginx
+		unsupported []string
+	)
+	switch kind {
+	case "ingress", "ingresses", "ing":
+		ing, err := c.kube.ExtensionsV1beta1().Ingresses(c.namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to retrieve ingress %s: %v", name, err)
+		}
+		n, unsupported = k8s.ImportIngress(ing, resolve)
+	case "httpproxy", "httpproxies", "proxy":
+		gv, err := schema.ParseGroupVersion(k8s.HTTPProxyAPIVersion)
+		if err != nil {
+			return err
+		}
+		config := *c.config
+		config.GroupVersion = &gv
+		config.APIPath = "/apis"
+		client, err := dynamic.NewClient(&config)
+		if err != nil {
+			return err
+		}
+		resource := &metav1.APIResource{Name: "httpproxies", Kind: k8s.HTTPProxyKind, Namespaced: true}
+		proxy, err := client.Resource(resource, c.namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to retrieve httpproxy %s: %v", name, err)
+		}
+		n, unsupported = k8s.ImportHTTPProxy(proxy, resolve)
+	default:
+		return fmt.Errorf("cannot import %q, expected ingress or httpproxy", args[0])
+	}
+
+	out, err := yaml.Marshal(n)
+	if err != nil {
+		return err
+	}
+	// The notes go to stderr, so the output can be piped to kubectl apply
+	for _, u := range unsupported {
+		fmt.Fprintf(os.Stderr, "warning: not imported: %s\n", u)
+	}
+	if errs := k8s.Validate(n); len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: the imported nginx is invalid: %s\n", strings.Join(errs, ", "))
+	}
+	_, err = c.out.Write(out)
+	return err
+}
+
+func runRender(c *cli, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %s, the manifest is given with -f", strings.Join(args, " "))
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if renderFile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(renderFile)
+	}
+	if err != nil {
+		return err
+	}
+	n, err := decodeNginx(data)
+	if err != nil {
+		return err
+	}
+	if n.Namespace == "" {
+		n.Namespace = c.namespace
+	}
+	if n.Namespace == "" {
+		n.Namespace = metav1.NamespaceDefault
+	}
+
+	objects, notes, err := k8s.Render(n)
+	if err != nil {
+		return err
+	}
+	// The notes go to stderr, so the output can be diffed or applied
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "warning: not rendered: %s\n", note)
+	}
+	for i, o := range objects {
+		out, err := yaml.Marshal(o)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(c.out, "---")
+		}
+		if _, err := c.out.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeNginx decodes an Nginx manifest of any served version
+func decodeNginx(data []byte) (*v1alpha1.Nginx, error) {
+	var meta metav1.TypeMeta
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	switch {
+	case meta.Kind != "Nginx":
+		return nil, fmt.Errorf("expected an Nginx manifest, got kind %q", meta.Kind)
+	case meta.APIVersion == v1beta1.SchemeGroupVersion.String():
+		n := &v1beta1.Nginx{}
+		if err := yaml.Unmarshal(data, n); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %v", err)
+		}
+		return n.ToV1alpha1()
+	case meta.APIVersion == v1alpha1.SchemeGroupVersion.String():
+		n := &v1alpha1.Nginx{}
+		if err := yaml.Unmarshal(data, n); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %v", err)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("unsupported apiVersion %q", meta.APIVersion)
+}
+
+// streamLogs copies the logs of the pod to out, each line prefixed with the
+// pod name when prefix is set
+func streamLogs(c *cli, pod *corev1.Pod, opts *corev1.PodLogOptions, out *lockedWriter, prefix bool) error {
+	stream, err := c.kube.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream()
+	if err != nil {
+		return fmt.Errorf("failed to read logs of pod %s: %v", pod.Name, err)
+	}
+	defer stream.Close()
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if prefix {
+				line = "[" + pod.Name + "] " + line
+			}
+			out.Write([]byte(line))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read logs of pod %s: %v", pod.Name, err)
+		}
+	}
+}
+
+// lockedWriter serializes the writes of the pod log streams, so lines are
+// not interleaved
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// instance returns the nginx given as the only argument
+func (c *cli) instance(args []string) (*v1alpha1.Nginx, error) {
+	name, err := instanceName(args)
+	if err != nil {
+		return nil, err
+	}
+	n, err := c.nginx.NginxV1alpha1().Nginxes(c.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve nginx %s: %v", name, err)
+	}
+	return n, nil
+}
+
+// pods returns the pods of the nginx
+func (c *cli) pods(n *v1alpha1.Nginx) ([]corev1.Pod, error) {
+	list, err := c.kube.CoreV1().Pods(n.Namespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(k8s.LabelsForNginx(n.Name)).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of nginx %s: %v", n.Name, err)
+	}
+	return list.Items, nil
+}
+
+// annotationPatch returns a JSON merge patch setting the annotation
+func annotationPatch(key, value string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{key: value},
+		},
+	})
+}
+
+// age returns how long ago the timestamp was, in the largest unit
+func age(t metav1.Time) string {
+	d := time.Since(t.Time)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
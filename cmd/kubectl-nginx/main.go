@@ -0,0 +1,235 @@
+// Command kubectl-nginx operates the nginx instances managed by the
+// operator. Installed in the PATH, it is also available as the kubectl nginx
+// plugin.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/generated/clientset/versioned"
+	"github.com/tsuru/nginx-operator/version"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// command is a subcommand of kubectl-nginx
+type command struct {
+	usage string
+	help  string
+	flags func(fs *flag.FlagSet)
+	run   func(c *cli, args []string) error
+	// offline commands do not connect to the cluster, only the namespace
+	// flag is set in their cli
+	offline bool
+}
+
+var commands = map[string]*command{
+	"list": {
+		usage: "list [-A]",
+		help:  "List the nginx instances with their readiness and endpoints",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&allNamespaces, "A", false, "List the nginx instances of all namespaces")
+		},
+		run: runList,
+	},
+	"config": {
+		usage: "config NAME",
+		help:  "Show the nginx.conf used by the pods of the nginx",
+		run:   runConfig,
+	},
+	"reload": {
+		usage: "reload NAME",
+		help:  "Reload nginx in place in the pods of the nginx",
+		run:   runReload,
+	},
+	"restart": {
+		usage: "restart NAME",
+		help:  "Replace the pods of the nginx, following its update strategy",
+		run:   runRestart,
+	},
+	"pause": {
+		usage: "pause NAME",
+		help:  "Stop reconciling the objects of the nginx, so they can be changed by hand",
+		run:   runPause(true),
+	},
+	"resume": {
+		usage: "resume NAME",
+		help:  "Reconcile the objects of a paused nginx again, reverting the changes made by hand",
+		run:   runPause(false),
+	},
+	"approve": {
+		usage: "approve NAME",
+		help:  "Apply the changes of the nginx waiting for approval with the Manual apply mode",
+		run:   runApprove,
+	},
+	"logs": {
+		usage: "logs NAME [-f] [--tail N]",
+		help:  "Print the logs, including the access logs, of the pods of the nginx",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&followLogs, "f", false, "Follow the logs")
+			fs.Int64Var(&tailLines, "tail", -1, "Number of recent lines of each pod to print, all if negative")
+		},
+		run: runLogs,
+	},
+	"port-forward": {
+		usage: "port-forward NAME [PORT]",
+		help:  "Forward a local port to the http, or https, port of a ready pod of the nginx for a limited time",
+		flags: func(fs *flag.FlagSet) {
+			fs.DurationVar(&forwardTimeout, "timeout", time.Hour, "Stop forwarding after this long, never if zero")
+			fs.BoolVar(&forwardLogs, "logs", false, "Follow the logs of the pod while forwarding")
+		},
+		run: runPortForward,
+	},
+	"import": {
+		usage: "import ingress|httpproxy NAME",
+		help:  "Print an Nginx routing the paths of an Ingress or Contour HTTPProxy, reporting the features it cannot convert",
+		run:   runImport,
+	},
+	"render": {
+		usage: "render [-f FILE]",
+		help:  "Print the objects the operator would create for an Nginx manifest, without connecting to the cluster",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&renderFile, "f", "-", "Nginx manifest to render, - for the standard input")
+		},
+		run:     runRender,
+		offline: true,
+	},
+}
+
+// cli holds the clients and options shared by the commands
+type cli struct {
+	kubeconfig string
+	context    string
+	namespace  string
+	kube       kubernetes.Interface
+	nginx      versioned.Interface
+	config     *rest.Config
+	out        io.Writer
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	switch name {
+	case "-h", "--help", "help":
+		usage(os.Stdout)
+		return
+	case "version":
+		fmt.Println(version.Version)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig file")
+	context := fs.String("context", "", "Name of the kubeconfig context to use")
+	namespace := fs.String("n", "", "Namespace of the nginx instances, the one of the current context if empty")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: kubectl-nginx %s\n\n%s.\n\nFlags:\n", cmd.usage, cmd.help)
+		fs.PrintDefaults()
+	}
+	args := parseInterspersed(fs, os.Args[2:])
+
+	c := &cli{namespace: *namespace, out: os.Stdout}
+	if !cmd.offline {
+		var err error
+		c, err = newCLI(*kubeconfig, *context, *namespace)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := cmd.run(c, args); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newCLI returns the clients for the cluster of the kubeconfig, loaded like
+// kubectl does
+func newCLI(kubeconfig, context, namespace string) (*cli, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	overrides.Context.Namespace = namespace
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	ns, _, err := config.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespace: %v", err)
+	}
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+	kube, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	nginx, err := versioned.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &cli{kubeconfig: kubeconfig, context: context, namespace: ns, kube: kube, nginx: nginx, config: restConfig, out: os.Stdout}, nil
+}
+
+// parseInterspersed parses the flags wherever they are among the arguments,
+// like kubectl does, and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// instanceName returns the name of the nginx given as the only argument
+func instanceName(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected the name of one nginx, got %d arguments", len(args))
+	}
+	return args[0], nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: kubectl-nginx COMMAND [flags]\n\nCommands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %-28s %s\n", cmd.usage, cmd.help)
+	}
+	fmt.Fprintf(w, "  %-28s %s\n", "version", "Print the version")
+	fmt.Fprintf(w, "\nCommon flags:\n  %s\n", strings.Join([]string{
+		"--kubeconfig PATH   Path to the kubeconfig file",
+		"--context NAME      Name of the kubeconfig context to use",
+		"-n NAMESPACE        Namespace of the nginx instances",
+	}, "\n  "))
+}
@@ -0,0 +1,35 @@
+// Command manifests writes the manifests of deploy/ generated from the Go
+// types, run by make manifests from the root of the repository.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+
+	"github.com/tsuru/nginx-operator/pkg/manifests"
+)
+
+func main() {
+	root := flag.String("root", ".", "Root of the repository")
+	image := flag.String("image", manifests.DefaultImage, "Image of the operator Deployment")
+	flag.Parse()
+
+	files, err := manifests.Generate(*root, *image)
+	if err != nil {
+		log.Fatalf("Failed to generate the manifests: %v", err)
+	}
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := ioutil.WriteFile(filepath.Join(*root, path), files[path], 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		log.Printf("Wrote %s", path)
+	}
+}
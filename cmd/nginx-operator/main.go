@@ -2,14 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
 	"runtime"
+	"strings"
+	"time"
 
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
 	sdk "github.com/operator-framework/operator-sdk/pkg/sdk"
 	k8sutil "github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
+	"github.com/tsuru/nginx-operator/pkg/controller"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+	"github.com/tsuru/nginx-operator/pkg/metrics"
 	stub "github.com/tsuru/nginx-operator/pkg/stub"
+	"github.com/tsuru/nginx-operator/pkg/tracing"
+	"github.com/tsuru/nginx-operator/pkg/webhook"
+	"github.com/tsuru/nginx-operator/version"
 
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 func printVersion() {
@@ -19,20 +38,422 @@ func printVersion() {
 }
 
 func main() {
+	stalenessThreshold := flag.Duration("staleness-threshold", metrics.DefaultStalenessThreshold,
+		"Time without a successful reconcile after which an instance is reported as stale")
+	webhookAddr := flag.String("webhook-addr", ":8443", "Address where the webhooks are served")
+	webhookCert := flag.String("webhook-tls-cert", "", "Path to the TLS certificate of the webhooks, webhooks are disabled if empty")
+	webhookKey := flag.String("webhook-tls-key", "", "Path to the TLS key of the webhooks")
+	webhookCertSecret := flag.String("webhook-cert-secret", "",
+		"Secret, as namespace/name, where the operator stores the certificate it generates and rotates for the webhooks when --webhook-tls-cert is empty")
+	webhookService := flag.String("webhook-service", "nginx-operator-webhook",
+		"Service of the webhooks, in the namespace of --webhook-cert-secret, the generated certificate is valid for")
+	webhookConfiguration := flag.String("webhook-configuration", "nginx-operator",
+		"Name of the webhook configurations whose caBundle is set to the CA of the generated certificate")
+	deletePropagation := flag.String("delete-propagation", string(metav1.DeletePropagationBackground),
+		"Propagation policy used when deleting objects created for nginx instances that do not set spec.deletePropagation: Foreground, Background or Orphan")
+	resync := flag.Duration("resync-period", time.Minute,
+		"Interval at which every nginx instance is reconciled again, in addition to its changes")
+	concurrentReconciles := flag.Int("concurrent-reconciles", 4,
+		"Number of nginx instances reconciled concurrently")
+	reconcileQPS := flag.Float64("reconcile-qps", 10,
+		"Sustained number of events handled per second, across all instances")
+	reconcileBurst := flag.Int("reconcile-burst", 100,
+		"Number of events handled at once after a quiet period, above --reconcile-qps")
+	maxReconcileBackoff := flag.Duration("max-reconcile-backoff", 5*time.Minute,
+		"Longest delay between the retries of a failed reconcile, the delay doubling from 1s on each failure")
+	watchNamespaces := flag.String("watch-namespaces", os.Getenv(k8sutil.WatchNamespaceEnvVar),
+		"Comma separated list of namespaces whose nginx instances are managed, or * for all namespaces. Defaults to the "+k8sutil.WatchNamespaceEnvVar+" environment variable")
+	watchOwned := flag.Bool("watch-generated-objects", true,
+		"Watch the deployments, statefulsets, daemonsets and services generated for the nginx instances, reconciling an instance as soon as they are deleted or changed")
+	metricsAddr := flag.String("metrics-addr", ":8383", "Address where the operator metrics are served")
+	logLevel := flag.String("log-level", "debug", "Minimum level of the logged messages: debug, info, warning or error")
+	logFormat := flag.String("log-format", "text", "Format of the logged messages: text or json")
+	revisionHistoryLimit := flag.Int("default-revision-history-limit", -1,
+		"Revision history limit of the workloads of nginx instances that do not set spec.revisionHistoryLimit, the Kubernetes default if negative")
+	progressDeadline := flag.Int("default-progress-deadline-seconds", 0,
+		"Progress deadline of the deployments of nginx instances that do not set spec.progressDeadlineSeconds, the Kubernetes default if zero")
+	minReady := flag.Int("default-min-ready-seconds", 0,
+		"Minimum ready seconds of the workloads of nginx instances that do not set spec.minReadySeconds")
+	cpuRequest := flag.String("default-cpu-request", "",
+		"CPU request of the nginx container of instances that do not set spec.podTemplate.resources, none if empty")
+	memoryRequest := flag.String("default-memory-request", "",
+		"Memory request of the nginx container of instances that do not set spec.podTemplate.resources, none if empty")
+	cpuLimit := flag.String("default-cpu-limit", "",
+		"CPU limit of the nginx container of instances that do not set spec.podTemplate.resources, none if empty")
+	memoryLimit := flag.String("default-memory-limit", "",
+		"Memory limit of the nginx container of instances that do not set spec.podTemplate.resources, none if empty")
+	guaranteedQoS := flag.Bool("guaranteed-qos", false,
+		"Set the cpu and memory limits missing from the nginx container to its requests, and the missing requests to its limits, so the pods get the Guaranteed QoS class")
+	maxReplicas := flag.Int("max-replicas", 0,
+		"Highest replicas of the nginx objects, unlimited if 0")
+	maxCPURequest := flag.String("max-cpu-request", "",
+		"Highest cpu request of each container of the nginx pods, unlimited if empty")
+	maxMemoryRequest := flag.String("max-memory-request", "",
+		"Highest memory request of each container of the nginx pods, unlimited if empty")
+	allowedRegistries := flag.String("allowed-registries", "",
+		"Comma separated registries, optionally followed by a repository path, the images of the nginx pods must come from, any if empty")
+	guardrailMode := flag.String("guardrail-mode", string(k8s.GuardrailModeReject),
+		"How nginx objects out of the guardrails are handled: Reject or Clamp")
+	profile := flag.String("profile", "",
+		"Profile of spec.profiles applied to nginx instances whose namespace has no "+k8s.ProfileLabel+" label")
+	fleetStatus := flag.String("fleet-status", "",
+		"Name of the cluster-scoped NginxFleetStatus summarizing the nginx instances handled by the operator, none if empty")
+	certificateExpiry := flag.Duration("certificate-expiry-threshold", k8s.DefaultCertificateExpiryThreshold,
+		"Time before their expiration after which certificates are listed in the fleet status")
+	controllerClass := flag.String("controller-class", "",
+		"Class of the nginx instances handled by the operator, the ones whose spec.controllerClass is the same. Instances without a class are handled if empty")
+	otlpEndpoint := flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		"Base URL of the OpenTelemetry collector the reconcile spans are exported to with OTLP/HTTP, like http://otel-collector:4318. Tracing is disabled if empty")
+	otlpHeaders := flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"),
+		"Headers sent to the OpenTelemetry collector, as key1=value1,key2=value2")
+	tracingServiceName := flag.String("tracing-service-name", envOrDefault("OTEL_SERVICE_NAME", tracing.DefaultServiceName),
+		"Service name of the exported spans")
+	tracingSampleRatio := flag.Float64("tracing-sample-ratio", 1,
+		"Share of the reconciles traced, from 0 to 1")
+	flag.Parse()
+	if err := setFlagsFromEnv(); err != nil {
+		logrus.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// The standard logger is also used by the SDK
+	logger := logrus.StandardLogger()
+	if err := configureLogger(logger, *logLevel, *logFormat); err != nil {
+		logrus.Fatalf("Invalid configuration: %v", err)
+	}
 	printVersion()
-	logger := logrus.New()
-	logger.SetLevel(logrus.DebugLevel)
+
+	metrics.Staleness.SetThreshold(*stalenessThreshold)
+	if err := stub.SetDefaultDeletePropagation(metav1.DeletionPropagation(*deletePropagation)); err != nil {
+		logrus.Fatalf("Invalid --delete-propagation: %v", err)
+	}
+	defaults := workloadDefaults(*revisionHistoryLimit, *progressDeadline, *minReady)
+	defaults.GuaranteedQoS = *guaranteedQoS
+	resources, err := defaultResources(*cpuRequest, *memoryRequest, *cpuLimit, *memoryLimit)
+	if err != nil {
+		logrus.Fatalf("Invalid configuration: %v", err)
+	}
+	defaults.Resources = resources
+	if err := stub.SetWorkloadDefaults(defaults); err != nil {
+		logrus.Fatalf("Invalid workload defaults: %v", err)
+	}
+	guardrails, err := operatorGuardrails(*maxReplicas, *maxCPURequest, *maxMemoryRequest, *allowedRegistries, *guardrailMode)
+	if err != nil {
+		logrus.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := stub.SetGuardrails(guardrails); err != nil {
+		logrus.Fatalf("Invalid guardrails: %v", err)
+	}
+	webhook.SetGuardrails(guardrails)
+	stub.SetProfile(*profile)
+	if *fleetStatus != "" {
+		if msgs := validation.IsDNS1123Subdomain(*fleetStatus); len(msgs) > 0 {
+			logrus.Fatalf("Invalid --fleet-status: %s", strings.Join(msgs, ", "))
+		}
+	}
+	stub.SetFleetStatus(*fleetStatus, *certificateExpiry)
+	if msgs := k8s.ValidateControllerClass(*controllerClass); len(msgs) > 0 {
+		logrus.Fatalf("Invalid --controller-class: %s", strings.Join(msgs, ", "))
+	}
+	stub.SetControllerClass(*controllerClass)
+	if *otlpEndpoint != "" {
+		headers, err := tracing.ParseHeaders(*otlpHeaders)
+		if err != nil {
+			logrus.Fatalf("Invalid --otlp-headers: %v", err)
+		}
+		exporter, err := tracing.NewExporter(tracing.Options{
+			Endpoint:       *otlpEndpoint,
+			ServiceName:    *tracingServiceName,
+			ServiceVersion: version.Version,
+			Headers:        headers,
+			SampleRatio:    *tracingSampleRatio,
+		})
+		if err != nil {
+			logrus.Fatalf("Invalid tracing configuration: %v", err)
+		}
+		tracing.SetExporter(exporter)
+		go exporter.Run(logger, nil)
+		logger.Infof("Exporting reconcile spans to %s", *otlpEndpoint)
+	}
+	go serveMetrics(logger, *metricsAddr)
+	switch {
+	case *webhookCert != "":
+		store := &webhook.CertificateStore{}
+		if _, err := store.LoadFiles(*webhookCert, *webhookKey); err != nil {
+			logrus.Fatalf("Invalid --webhook-tls-cert: %v", err)
+		}
+		go reloadWebhookCertificate(logger, store, *webhookCert, *webhookKey)
+		go serveWebhooks(logger, *webhookAddr, store)
+	case *webhookCertSecret != "":
+		parts := strings.Split(*webhookCertSecret, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			logrus.Fatalf("Invalid --webhook-cert-secret: must be namespace/name")
+		}
+		opts := stub.WebhookCertificateOptions{
+			Namespace:     parts[0],
+			Secret:        parts[1],
+			Service:       *webhookService,
+			Configuration: *webhookConfiguration,
+		}
+		store := &webhook.CertificateStore{}
+		go syncWebhookCertificate(logger, store, opts)
+		go serveWebhooks(logger, *webhookAddr, store)
+	}
 
 	resource := "nginx.tsuru.io/v1alpha1"
 	kind := "Nginx"
-	namespace, err := k8sutil.GetWatchNamespace()
+	namespaces, err := parseWatchNamespaces(*watchNamespaces)
+	if err != nil {
+		logrus.Fatalf("Invalid --watch-namespaces: %v", err)
+	}
+	if *resync < time.Second {
+		logrus.Fatalf("Invalid --resync-period: must be at least 1s")
+	}
+	handler := stub.NewHandler(logger)
+	ctrl, err := controller.New(logger, func(ctx context.Context, obj k8sruntime.Object, deleted bool) error {
+		return handler.Handle(ctx, sdk.Event{Object: obj, Deleted: deleted})
+	}, controller.Options{
+		Workers:    *concurrentReconciles,
+		QPS:        float32(*reconcileQPS),
+		Burst:      *reconcileBurst,
+		MaxBackoff: *maxReconcileBackoff,
+	})
+	if err != nil {
+		logrus.Fatalf("Invalid reconcile configuration: %v", err)
+	}
+	// Each namespace gets its own informer, so only the watched namespaces
+	// are listed and cached
+	for _, namespace := range namespaces {
+		if namespace == metav1.NamespaceAll {
+			logger.Infof("Watching %s, %s, all namespaces, %s", resource, kind, *resync)
+		} else {
+			logger.Infof("Watching %s, %s, %s, %s", resource, kind, namespace, *resync)
+		}
+		watch(ctrl, resource, kind, namespace, *resync)
+		if !*watchOwned {
+			continue
+		}
+		// Generated objects are only handled when they change, their nginx
+		// resyncs reconcile them as well
+		for _, owned := range stub.OwnedKinds {
+			watch(ctrl, owned[0], owned[1], namespace, 0)
+		}
+	}
+	if err := ctrl.Run(context.Background()); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// watch hands the events of the objects of the kind in the namespace to the
+// controller
+func watch(ctrl *controller.Controller, apiVersion, kind, namespace string, resync time.Duration) {
+	client, _, err := k8sclient.GetResourceClient(apiVersion, kind, namespace)
 	if err != nil {
-		logrus.Fatalf("Failed to get watch namespace: %v", err)
+		logrus.Fatalf("Failed to watch %s %s: %v", apiVersion, kind, err)
 	}
-	resyncPeriod := 5
-	logger.Infof("Watching %s, %s, %s, %d", resource, kind, namespace, resyncPeriod)
+	ctrl.Watch(kind, controller.ListWatch(client), resync)
+}
+
+// workloadDefaults returns the workload defaults set by the flags, leaving
+// out the ones that keep the Kubernetes defaults
+func workloadDefaults(revisionHistoryLimit, progressDeadline, minReady int) k8s.WorkloadDefaults {
+	d := k8s.WorkloadDefaults{MinReadySeconds: int32(minReady)}
+	if revisionHistoryLimit >= 0 {
+		limit := int32(revisionHistoryLimit)
+		d.RevisionHistoryLimit = &limit
+	}
+	if progressDeadline != 0 {
+		deadline := int32(progressDeadline)
+		d.ProgressDeadlineSeconds = &deadline
+	}
+	return d
+}
+
+// defaultResources returns the resource requirements set by the
+// --default-cpu-request, --default-memory-request, --default-cpu-limit and
+// --default-memory-limit flags, leaving out the empty ones
+func defaultResources(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) (corev1.ResourceRequirements, error) {
+	var r corev1.ResourceRequirements
+	for _, f := range []struct {
+		flag  string
+		value string
+		name  corev1.ResourceName
+		list  *corev1.ResourceList
+	}{
+		{"default-cpu-request", cpuRequest, corev1.ResourceCPU, &r.Requests},
+		{"default-memory-request", memoryRequest, corev1.ResourceMemory, &r.Requests},
+		{"default-cpu-limit", cpuLimit, corev1.ResourceCPU, &r.Limits},
+		{"default-memory-limit", memoryLimit, corev1.ResourceMemory, &r.Limits},
+	} {
+		if f.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(f.value)
+		if err != nil {
+			return r, fmt.Errorf("invalid --%s: %v", f.flag, err)
+		}
+		if *f.list == nil {
+			*f.list = corev1.ResourceList{}
+		}
+		(*f.list)[f.name] = q
+	}
+	return r, nil
+}
 
-	sdk.Watch(resource, kind, namespace, resyncPeriod)
-	sdk.Handle(stub.NewHandler(logger))
-	sdk.Run(context.TODO())
+// operatorGuardrails returns the guardrails set by the --max-replicas,
+// --max-cpu-request, --max-memory-request, --allowed-registries and
+// --guardrail-mode flags
+func operatorGuardrails(maxReplicas int, maxCPURequest, maxMemoryRequest, allowedRegistries, mode string) (k8s.Guardrails, error) {
+	g := k8s.Guardrails{
+		MaxReplicas: int32(maxReplicas),
+		Mode:        k8s.GuardrailMode(mode),
+	}
+	for _, f := range []struct {
+		flag  string
+		value string
+		name  corev1.ResourceName
+	}{
+		{"max-cpu-request", maxCPURequest, corev1.ResourceCPU},
+		{"max-memory-request", maxMemoryRequest, corev1.ResourceMemory},
+	} {
+		if f.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(f.value)
+		if err != nil {
+			return g, fmt.Errorf("invalid --%s: %v", f.flag, err)
+		}
+		if g.MaxRequests == nil {
+			g.MaxRequests = corev1.ResourceList{}
+		}
+		g.MaxRequests[f.name] = q
+	}
+	for _, r := range strings.Split(allowedRegistries, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			g.AllowedRegistries = append(g.AllowedRegistries, r)
+		}
+	}
+	return g, nil
+}
+
+// setFlagsFromEnv sets the flags missing from the command line from the
+// NGINX_OPERATOR_<FLAG> environment variables, like NGINX_OPERATOR_LOG_LEVEL
+// for --log-level
+func setFlagsFromEnv() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		env := "NGINX_OPERATOR_" + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if value, ok := os.LookupEnv(env); ok {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %v", env, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// envOrDefault returns the value of the environment variable, or the default
+// if it is unset or empty
+func envOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// configureLogger sets the level and the format of the logger. The json
+// format writes one object per message, for log aggregators.
+func configureLogger(logger *logrus.Logger, level, format string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %v", err)
+	}
+	logger.SetLevel(lvl)
+	switch format {
+	case "text":
+		logger.Formatter = &logrus.TextFormatter{}
+	case "json":
+		logger.Formatter = &logrus.JSONFormatter{}
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", format)
+	}
+	return nil
+}
+
+// parseWatchNamespaces returns the namespaces listed in value, or
+// metav1.NamespaceAll when value is *
+func parseWatchNamespaces(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("no namespace set, use * to watch all namespaces")
+	}
+	if value == "*" {
+		return []string{metav1.NamespaceAll}, nil
+	}
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, ns := range strings.Split(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if msgs := validation.IsDNS1123Label(ns); len(msgs) > 0 {
+			return nil, fmt.Errorf("namespace %q is invalid: %s", ns, strings.Join(msgs, ", "))
+		}
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, nil
+}
+
+func serveMetrics(logger *logrus.Logger, metricsAddr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	logger.Infof("Serving metrics at %s", metricsAddr)
+	if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+		logger.Errorf("Failed to serve metrics: %v", err)
+	}
+}
+
+func serveWebhooks(logger *logrus.Logger, addr string, store *webhook.CertificateStore) {
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   webhook.NewServeMux(logger),
+		TLSConfig: &tls.Config{GetCertificate: store.GetCertificate},
+	}
+	logger.Infof("Serving webhooks at %s", addr)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		logger.Errorf("Failed to serve webhooks: %v", err)
+	}
+}
+
+// reloadWebhookCertificate serves the certificate files again when they
+// change, like when cert-manager renews the mounted secret
+func reloadWebhookCertificate(logger *logrus.Logger, store *webhook.CertificateStore, certFile, keyFile string) {
+	for range time.Tick(time.Minute) {
+		reloaded, err := store.LoadFiles(certFile, keyFile)
+		if err != nil {
+			logger.Errorf("Failed to reload the webhook certificate: %v", err)
+		} else if reloaded {
+			logger.Infof("Reloaded the webhook certificate from %s", certFile)
+		}
+	}
+}
+
+// syncWebhookCertificate keeps the generated certificate of the webhooks
+// valid, retrying sooner after failures
+func syncWebhookCertificate(logger *logrus.Logger, store *webhook.CertificateStore, opts stub.WebhookCertificateOptions) {
+	for {
+		interval := time.Hour
+		if err := stub.SyncWebhookCertificate(opts, store, logger); err != nil {
+			logger.Errorf("Failed to sync the webhook certificate: %v", err)
+			interval = 10 * time.Second
+		}
+		time.Sleep(interval)
+	}
 }
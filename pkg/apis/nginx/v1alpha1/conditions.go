@@ -0,0 +1,44 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of the given type, or nil if not set
+func (in *NginxStatus) GetCondition(t NginxConditionType) *NginxCondition {
+	for i := range in.Conditions {
+		if in.Conditions[i].Type == t {
+			return &in.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the same type. The last
+// transition time is only changed when the condition status changes.
+func (in *NginxStatus) SetCondition(c NginxCondition) {
+	existing := in.GetCondition(c.Type)
+	if existing == nil {
+		if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = metav1.Now()
+		}
+		in.Conditions = append(in.Conditions, c)
+		return
+	}
+	if existing.Status != c.Status {
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.Status = c.Status
+	existing.Reason = c.Reason
+	existing.Message = c.Message
+}
+
+// RemoveCondition removes the condition of the given type, if set
+func (in *NginxStatus) RemoveCondition(t NginxConditionType) {
+	for i := range in.Conditions {
+		if in.Conditions[i].Type == t {
+			in.Conditions = append(in.Conditions[:i], in.Conditions[i+1:]...)
+			return
+		}
+	}
+}
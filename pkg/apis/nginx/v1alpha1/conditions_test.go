@@ -0,0 +1,47 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	var status NginxStatus
+	assert.Nil(t, status.GetCondition(NginxConditionConfigValid))
+
+	status.SetCondition(NginxCondition{Type: NginxConditionConfigValid, Status: corev1.ConditionUnknown, Reason: "Validating"})
+	c := status.GetCondition(NginxConditionConfigValid)
+	assert.NotNil(t, c)
+	assert.False(t, c.LastTransitionTime.IsZero())
+
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	c.LastTransitionTime = past
+	status.SetCondition(NginxCondition{Type: NginxConditionConfigValid, Status: corev1.ConditionUnknown, Reason: "StillValidating"})
+	c = status.GetCondition(NginxConditionConfigValid)
+	assert.Equal(t, "StillValidating", c.Reason)
+	assert.Equal(t, past, c.LastTransitionTime)
+
+	status.SetCondition(NginxCondition{Type: NginxConditionConfigValid, Status: corev1.ConditionTrue, Reason: "Valid"})
+	c = status.GetCondition(NginxConditionConfigValid)
+	assert.Equal(t, corev1.ConditionTrue, c.Status)
+	assert.NotEqual(t, past, c.LastTransitionTime)
+	assert.Len(t, status.Conditions, 1)
+}
+
+func TestRemoveCondition(t *testing.T) {
+	var status NginxStatus
+	status.RemoveCondition(NginxConditionProgressing)
+	assert.Empty(t, status.Conditions)
+
+	status.SetCondition(NginxCondition{Type: NginxConditionConfigValid, Status: corev1.ConditionTrue})
+	status.SetCondition(NginxCondition{Type: NginxConditionProgressing, Status: corev1.ConditionTrue})
+	status.SetCondition(NginxCondition{Type: NginxConditionQuotaLimited, Status: corev1.ConditionFalse})
+	status.RemoveCondition(NginxConditionProgressing)
+	assert.Nil(t, status.GetCondition(NginxConditionProgressing))
+	assert.Len(t, status.Conditions, 2)
+	assert.Equal(t, NginxConditionQuotaLimited, status.Conditions[1].Type)
+}
@@ -0,0 +1,96 @@
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+type crdSchema struct {
+	Description string               `json:"description"`
+	Properties  map[string]crdSchema `json:"properties"`
+}
+
+type crdVersion struct {
+	Name   string `json:"name"`
+	Schema struct {
+		OpenAPIV3Schema crdSchema `json:"openAPIV3Schema"`
+	} `json:"schema"`
+}
+
+// Every spec and status field must be documented in the schema of the
+// stored version of the CRD
+func TestCRDDocumentsFields(t *testing.T) {
+	data, err := ioutil.ReadFile("../../../../deploy/crd.yaml")
+	assert.Nil(t, err)
+	var crd struct {
+		Spec struct {
+			Names struct {
+				Plural     string   `json:"plural"`
+				Singular   string   `json:"singular"`
+				ListKind   string   `json:"listKind"`
+				ShortNames []string `json:"shortNames"`
+			} `json:"names"`
+			Versions []crdVersion `json:"versions"`
+		} `json:"spec"`
+	}
+	assert.Nil(t, yaml.Unmarshal(data, &crd))
+	assert.Equal(t, "nginxs", crd.Spec.Names.Plural)
+	assert.Equal(t, "nginx", crd.Spec.Names.Singular)
+	assert.Equal(t, "NginxList", crd.Spec.Names.ListKind)
+	assert.Equal(t, []string{"ngx"}, crd.Spec.Names.ShortNames)
+
+	if !assert.NotEmpty(t, crd.Spec.Versions) {
+		return
+	}
+	assert.Equal(t, "v1alpha1", crd.Spec.Versions[0].Name)
+	schema := crd.Spec.Versions[0].Schema.OpenAPIV3Schema
+	assert.NotEmpty(t, schema.Description)
+	for name, typ := range map[string]reflect.Type{"spec": reflect.TypeOf(NginxSpec{}), "status": reflect.TypeOf(NginxStatus{})} {
+		fields := schema.Properties[name].Properties
+		assert.Len(t, fields, typ.NumField(), "%s fields", name)
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			field := strings.Split(f.Tag.Get("json"), ",")[0]
+			if field == "" {
+				field = f.Name
+			}
+			assert.NotEmpty(t, fields[field].Description, "%s.%s is not documented in the CRD", name, field)
+		}
+	}
+}
+
+// Every status field of the fleet status must be documented in its CRD
+func TestFleetCRDDocumentsFields(t *testing.T) {
+	data, err := ioutil.ReadFile("../../../../deploy/fleet-crd.yaml")
+	assert.Nil(t, err)
+	var crd struct {
+		Spec struct {
+			Names struct {
+				Kind     string `json:"kind"`
+				ListKind string `json:"listKind"`
+			} `json:"names"`
+			Scope    string       `json:"scope"`
+			Versions []crdVersion `json:"versions"`
+		} `json:"spec"`
+	}
+	assert.Nil(t, yaml.Unmarshal(data, &crd))
+	assert.Equal(t, "NginxFleetStatus", crd.Spec.Names.Kind)
+	assert.Equal(t, "NginxFleetStatusList", crd.Spec.Names.ListKind)
+	assert.Equal(t, "Cluster", crd.Spec.Scope)
+
+	if !assert.Len(t, crd.Spec.Versions, 1) {
+		return
+	}
+	fields := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["status"].Properties
+	typ := reflect.TypeOf(NginxFleetSummary{})
+	assert.Len(t, fields, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		assert.NotEmpty(t, fields[field].Description, "status.%s is not documented in the CRD", field)
+	}
+}
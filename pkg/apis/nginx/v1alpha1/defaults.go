@@ -0,0 +1,449 @@
+package v1alpha1
+
+import (
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultImage is the docker image used for nginx when none is specified
+	DefaultImage = "nginx:latest"
+
+	// DefaultTLSKeyField is the secret field holding the TLS key
+	DefaultTLSKeyField = "tls.key"
+
+	// DefaultTLSCertificateField is the secret field holding the TLS certificate
+	DefaultTLSCertificateField = "tls.crt"
+
+	// DefaultIngressPath is the path routed by the ingress when none is specified
+	DefaultIngressPath = "/"
+
+	// DefaultRedirectCode is the status code of redirect locations when none is specified
+	DefaultRedirectCode = 302
+
+	// DefaultFastCGIPort is the port of FastCGI locations when none is specified
+	DefaultFastCGIPort = 9000
+
+	// DefaultFastCGIRoot is the directory holding the scripts of FastCGI
+	// locations when none is specified, the one used by the php-fpm image
+	DefaultFastCGIRoot = "/var/www/html"
+
+	// DefaultFastCGIIndex is the index script of FastCGI locations when none
+	// is specified
+	DefaultFastCGIIndex = "index.php"
+
+	// DefaultSigningProxyImage is the docker image used for the sidecar
+	// signing the requests of object storage locations when none is specified
+	DefaultSigningProxyImage = "public.ecr.aws/aws-observability/aws-sigv4-proxy:1.0"
+
+	// DefaultSigningRegion is the region used to sign the requests of object
+	// storage locations when none is specified
+	DefaultSigningRegion = "us-east-1"
+
+	// DefaultSigningService is the service name used to sign the requests of
+	// object storage locations when none is specified
+	DefaultSigningService = "s3"
+
+	// DefaultStaticSitePath is the path a static site is served under when
+	// none is specified
+	DefaultStaticSitePath = "/"
+
+	// DefaultStaticSiteIndex is the index file of static sites when none is specified
+	DefaultStaticSiteIndex = "index.html"
+
+	// DefaultS3SyncImage and DefaultGCSSyncImage are the docker images used
+	// to copy static sites from object storages when none is specified
+	DefaultS3SyncImage  = "mesosphere/aws-cli:1.14.5"
+	DefaultGCSSyncImage = "google/cloud-sdk:alpine"
+
+	// DefaultOverloadRetryAfterSeconds is the Retry-After of the requests
+	// shed by the overload protection when none is specified
+	DefaultOverloadRetryAfterSeconds = 5
+
+	// DefaultOverloadCPUThresholdPercent is the CPU usage above which the
+	// CPU shedding sidecar sheds requests when none is specified
+	DefaultOverloadCPUThresholdPercent = 90
+
+	// DefaultLogErrorLevel is the minimum level of the error log messages
+	// when none is specified
+	DefaultLogErrorLevel = "error"
+
+	// DefaultSyslogFacility and DefaultSyslogTag are the facility and tag of
+	// the access log messages shipped to syslog when none is specified
+	DefaultSyslogFacility = "local7"
+	DefaultSyslogTag      = "nginx"
+
+	// DefaultFluentBitImage is the docker image used for the fluent-bit
+	// sidecar when none is specified
+	DefaultFluentBitImage = "fluent/fluent-bit:1.9.10"
+
+	// DefaultUnknownHostCode is the status code of the requests for unknown
+	// hosts when none is specified
+	DefaultUnknownHostCode = 421
+
+	// DefaultGitSyncImage is the docker image used to sync git repositories
+	// when none is specified
+	DefaultGitSyncImage = "k8s.gcr.io/git-sync:v3.1.1"
+
+	// DefaultGitSyncRef is the git branch synced when none is specified
+	DefaultGitSyncRef = "master"
+
+	// DefaultGitSyncInterval is how often, in seconds, git repositories are
+	// pulled when not specified
+	DefaultGitSyncInterval = 60
+
+	// DefaultGitSyncMountPath is where git repositories are mounted in the
+	// nginx container when not specified
+	DefaultGitSyncMountPath = "/usr/share/nginx/git"
+
+	// DefaultWaitForImage is the docker image used to wait for upstreams
+	// when none is specified
+	DefaultWaitForImage = "busybox:1.36"
+
+	// DefaultCacheZoneSize is the size of the keys of cache zones when none
+	// is specified
+	DefaultCacheZoneSize = "10m"
+
+	// DefaultCacheKey is the key of cached responses when none is specified
+	DefaultCacheKey = "$scheme$proxy_host$request_uri"
+
+	// DefaultCachePath is the directory holding the cache zones when their
+	// path is not specified
+	DefaultCachePath = "/var/cache/nginx"
+
+	// DefaultExternalAuthPath is the path requested to the external auth
+	// service when none is specified
+	DefaultExternalAuthPath = "/"
+
+	// DefaultExternalAuthCacheKey is the key of the cached answers of the
+	// external auth service when none is specified
+	DefaultExternalAuthCacheKey = "$http_authorization$http_cookie"
+
+	// DefaultExternalAuthCacheTTL is how long the answers of the external
+	// auth service are cached when not specified
+	DefaultExternalAuthCacheTTL = "1m"
+
+	// DefaultMetricsExporterImage is the docker image used for the metrics
+	// exporter sidecar when none is specified
+	DefaultMetricsExporterImage = "nginx/nginx-prometheus-exporter:0.1.0"
+
+	// DefaultSLOAvailability is the percentage of requests that must not
+	// fail when spec.slo.availability is not set
+	DefaultSLOAvailability = "99.9"
+
+	// DefaultSLOLatencyTarget is the percentage of requests that must be
+	// answered within the threshold when spec.slo.latency.target is not set
+	DefaultSLOLatencyTarget = "99"
+
+	// DefaultUpstreamMetricsImage is the docker image used for the upstream
+	// metrics sidecar when none is specified
+	DefaultUpstreamMetricsImage = "quay.io/martinhelmich/prometheus-nginxlog-exporter:v1.11.0"
+
+	// DefaultCanaryCheckPath is the path requested to the canary pods
+	DefaultCanaryCheckPath = "/"
+
+	// DefaultCanaryCheckPort is the port requested to the canary pods
+	DefaultCanaryCheckPort = int32(80)
+
+	// DefaultRootlessHTTPPort and DefaultRootlessHTTPSPort are the ports nginx
+	// listens on in rootless mode, which cannot bind privileged ports
+	DefaultRootlessHTTPPort  = int32(8080)
+	DefaultRootlessHTTPSPort = int32(8443)
+
+	// DefaultRootlessUser is the uid nginx runs as in rootless mode, the one
+	// of the nginx user of the official images
+	DefaultRootlessUser = int64(101)
+
+	// DefaultNodeUnhealthySeconds is how long a node must be unhealthy
+	// before the nginx pods on it are replaced
+	DefaultNodeUnhealthySeconds = int32(60)
+
+	// DefaultSessionAffinityTimeout is the session affinity timeout of the
+	// service when none is specified, the one of Kubernetes
+	DefaultSessionAffinityTimeout = int32(10800)
+
+	// DefaultLoadBalancerTimeoutSeconds is how long the load balancer of a
+	// LoadBalancer service may take to be allocated before it is reported
+	// stuck
+	DefaultLoadBalancerTimeoutSeconds = int32(600)
+
+	// DefaultPreStopSleepSeconds is how long the default preStop hook waits
+	// for the pod to be removed from the endpoints before stopping nginx
+	DefaultPreStopSleepSeconds = int32(5)
+
+	// DefaultEventRetentionSeconds is how long the events of the nginx are
+	// kept with spec.retention
+	DefaultEventRetentionSeconds = int32(3600)
+
+	// DefaultMaxEvents is the number of events of the nginx kept with
+	// spec.retention
+	DefaultMaxEvents = int32(50)
+
+	// DefaultCachePurgeHistory is the number of cache purges kept in the
+	// nginx status
+	DefaultCachePurgeHistory = int32(5)
+
+	// DefaultSpecHistoryLimit is the number of previous specs kept to roll
+	// back to
+	DefaultSpecHistoryLimit = int32(10)
+
+	// DefaultCanaryCheckExpectedStatus is the status code expected from the
+	// canary pods
+	DefaultCanaryCheckExpectedStatus = int32(200)
+
+	// DefaultConfigTemplateKey is the key of the ConfigMap holding the config
+	// template when none is specified
+	DefaultConfigTemplateKey = "nginx.conf"
+
+	// DefaultCertificateIssuerKind is the kind of the cert-manager issuer
+	// when none is specified
+	DefaultCertificateIssuerKind = "Issuer"
+
+	// DefaultCertificateIssuerGroup is the API group of the cert-manager
+	// issuer when none is specified
+	DefaultCertificateIssuerGroup = "cert-manager.io"
+
+	// DefaultExternalSecretStoreKind is the kind of the External Secrets
+	// store when none is specified
+	DefaultExternalSecretStoreKind = "SecretStore"
+
+	// DefaultExternalSecretRefreshInterval is how often the External Secrets
+	// operator reads the data from the store when no interval is specified
+	DefaultExternalSecretRefreshInterval = "1h"
+)
+
+// DefaultUpstreamMetricsBuckets are the buckets, in seconds, of the upstream
+// latency histograms when none are specified
+var DefaultUpstreamMetricsBuckets = []string{"0.005", "0.01", "0.025", "0.05", "0.1", "0.25", "0.5", "1", "2.5", "5", "10"}
+
+// WithDefaults returns a copy of the spec with the default values set on the
+// fields left empty. The receiver is never modified.
+func (in *NginxSpec) WithDefaults() *NginxSpec {
+	out := in.DeepCopy()
+	out.Image = valueOrDefault(out.Image, DefaultImage)
+	if tls := out.TLSSecret; tls != nil {
+		tls.KeyField = valueOrDefault(tls.KeyField, DefaultTLSKeyField)
+		tls.CertificateField = valueOrDefault(tls.CertificateField, DefaultTLSCertificateField)
+		tls.KeyPath = valueOrDefault(tls.KeyPath, tls.KeyField)
+		tls.CertificatePath = valueOrDefault(tls.CertificatePath, tls.CertificateField)
+	}
+	if r := out.Rollout; r != nil && r.CanaryCheck != nil {
+		c := r.CanaryCheck
+		c.Path = valueOrDefault(c.Path, DefaultCanaryCheckPath)
+		if c.Port == 0 {
+			c.Port = DefaultCanaryCheckPort
+			if out.Rootless {
+				c.Port = DefaultRootlessHTTPPort
+			}
+		}
+		if c.ExpectedStatus == 0 {
+			c.ExpectedStatus = DefaultCanaryCheckExpectedStatus
+		}
+	}
+	if r := out.NodeRemediation; r != nil && r.UnhealthySeconds == 0 {
+		r.UnhealthySeconds = DefaultNodeUnhealthySeconds
+	}
+	if svc := out.Service; svc != nil {
+		if svc.Type == "" {
+			svc.Type = corev1.ServiceTypeClusterIP
+		}
+		if a := svc.SessionAffinity; a != nil && a.TimeoutSeconds == 0 {
+			a.TimeoutSeconds = DefaultSessionAffinityTimeout
+		}
+		if svc.Type == corev1.ServiceTypeLoadBalancer && svc.LoadBalancerTimeoutSeconds == 0 {
+			svc.LoadBalancerTimeoutSeconds = DefaultLoadBalancerTimeoutSeconds
+		}
+	}
+	if a := out.Autoscaling; a != nil && a.Vertical != nil && a.Vertical.UpdateMode == "" {
+		a.Vertical.UpdateMode = VerticalUpdateModeOff
+	}
+	if l := out.Lifecycle; l != nil && l.PreStop == nil && l.PreStopSleepSeconds == nil {
+		sleep := DefaultPreStopSleepSeconds
+		l.PreStopSleepSeconds = &sleep
+	}
+	if r := out.Retention; r != nil {
+		if r.EventSeconds == 0 {
+			r.EventSeconds = DefaultEventRetentionSeconds
+		}
+		if r.MaxEvents == 0 {
+			r.MaxEvents = DefaultMaxEvents
+		}
+		if r.CachePurgeHistory == 0 {
+			r.CachePurgeHistory = DefaultCachePurgeHistory
+		}
+	}
+	if t := out.ConfigTemplate; t != nil && t.ConfigMap != "" {
+		t.Key = valueOrDefault(t.Key, DefaultConfigTemplateKey)
+	}
+	if c := out.Certificates; c != nil {
+		c.IssuerRef.Kind = valueOrDefault(c.IssuerRef.Kind, DefaultCertificateIssuerKind)
+		c.IssuerRef.Group = valueOrDefault(c.IssuerRef.Group, DefaultCertificateIssuerGroup)
+	}
+	for i := range out.ExternalSecrets {
+		e := &out.ExternalSecrets[i]
+		e.SecretStoreRef.Kind = valueOrDefault(e.SecretStoreRef.Kind, DefaultExternalSecretStoreKind)
+		e.RefreshInterval = valueOrDefault(e.RefreshInterval, DefaultExternalSecretRefreshInterval)
+	}
+	if c := out.Config; c != nil && c.Mount == "" {
+		c.Mount = ConfigMountFile
+		if out.ConfigReload == ConfigReloadReload {
+			c.Mount = ConfigMountDirectory
+		}
+	}
+	for i := range out.ConfigFiles {
+		f := &out.ConfigFiles[i]
+		f.Key = valueOrDefault(f.Key, f.Name)
+	}
+	for i := range out.ExtraFiles {
+		f := &out.ExtraFiles[i]
+		f.Key = valueOrDefault(f.Key, path.Base(f.Path))
+	}
+	if ing := out.Ingress; ing != nil {
+		ing.Path = valueOrDefault(ing.Path, DefaultIngressPath)
+	}
+	if m := out.Metrics; m != nil {
+		m.Image = valueOrDefault(m.Image, DefaultMetricsExporterImage)
+		if u := m.Upstreams; u != nil {
+			u.Image = valueOrDefault(u.Image, DefaultUpstreamMetricsImage)
+			if len(u.Buckets) == 0 {
+				u.Buckets = append([]string{}, DefaultUpstreamMetricsBuckets...)
+			}
+		}
+	}
+	if s := out.SLO; s != nil {
+		s.Availability = valueOrDefault(s.Availability, DefaultSLOAvailability)
+		if s.Latency != nil {
+			s.Latency.Target = valueOrDefault(s.Latency.Target, DefaultSLOLatencyTarget)
+		}
+	}
+	for i := range out.Locations {
+		l := &out.Locations[i]
+		l.Match = LocationMatch(valueOrDefault(string(l.Match), string(LocationMatchPrefix)))
+		if l.Redirect != nil && l.Redirect.Code == 0 {
+			l.Redirect.Code = DefaultRedirectCode
+		}
+		if f := l.FastCGI; f != nil {
+			if f.Port == 0 {
+				f.Port = DefaultFastCGIPort
+			}
+			f.Root = valueOrDefault(f.Root, DefaultFastCGIRoot)
+			f.Index = valueOrDefault(f.Index, DefaultFastCGIIndex)
+		}
+		if o := l.ObjectStorage; o != nil && o.Signing != nil {
+			o.Signing.Region = valueOrDefault(o.Signing.Region, DefaultSigningRegion)
+			o.Signing.Service = valueOrDefault(o.Signing.Service, DefaultSigningService)
+			o.Signing.Image = valueOrDefault(o.Signing.Image, DefaultSigningProxyImage)
+		}
+	}
+	for i := range out.StaticSites {
+		site := &out.StaticSites[i]
+		site.Path = valueOrDefault(site.Path, DefaultStaticSitePath)
+		site.Index = valueOrDefault(site.Index, DefaultStaticSiteIndex)
+		if o := site.ObjectStorage; o != nil {
+			switch {
+			case strings.HasPrefix(o.URL, "s3://"):
+				o.Image = valueOrDefault(o.Image, DefaultS3SyncImage)
+			case strings.HasPrefix(o.URL, "gs://"):
+				o.Image = valueOrDefault(o.Image, DefaultGCSSyncImage)
+			}
+		}
+	}
+	if p := out.NetworkPolicy; p != nil {
+		for i := range p.Egress {
+			for j := range p.Egress[i].Ports {
+				if port := &p.Egress[i].Ports[j]; port.Protocol == nil {
+					tcp := corev1.ProtocolTCP
+					port.Protocol = &tcp
+				}
+			}
+		}
+	}
+	if o := out.OverloadProtection; o != nil {
+		if o.ExcessRequests == "" {
+			o.ExcessRequests = OverloadQueue
+		}
+		if o.RetryAfterSeconds == 0 {
+			o.RetryAfterSeconds = DefaultOverloadRetryAfterSeconds
+		}
+		if c := o.CPUShedding; c != nil && c.ThresholdPercent == 0 {
+			c.ThresholdPercent = DefaultOverloadCPUThresholdPercent
+		}
+	}
+	if l := out.Logging; l != nil {
+		if l.Format == "" {
+			l.Format = LogFormatCombined
+		}
+		l.ErrorLogLevel = valueOrDefault(l.ErrorLogLevel, DefaultLogErrorLevel)
+		if s := l.Syslog; s != nil {
+			s.Facility = valueOrDefault(s.Facility, DefaultSyslogFacility)
+			s.Tag = valueOrDefault(s.Tag, DefaultSyslogTag)
+		}
+		if f := l.FluentBit; f != nil {
+			f.Image = valueOrDefault(f.Image, DefaultFluentBitImage)
+		}
+	}
+	if u := out.UnknownHosts; u != nil {
+		if u.Code == 0 {
+			u.Code = DefaultUnknownHostCode
+		}
+		if len(u.ServerNames) == 0 {
+			if out.Ingress != nil {
+				u.ServerNames = append(u.ServerNames, out.Ingress.Hosts...)
+			}
+			if out.Certificates != nil {
+				u.ServerNames = append(u.ServerNames, out.Certificates.DNSNames...)
+			}
+		}
+	}
+	if s := out.Security; s != nil && s.HeadersProfile == "" {
+		s.HeadersProfile = SecurityHeadersModerate
+	}
+	if a := out.Auth; a != nil && a.External != nil {
+		e := a.External
+		e.Path = valueOrDefault(e.Path, DefaultExternalAuthPath)
+		if c := e.Cache; c != nil {
+			c.Key = valueOrDefault(c.Key, DefaultExternalAuthCacheKey)
+			c.TTL = valueOrDefault(c.TTL, DefaultExternalAuthCacheTTL)
+		}
+	}
+	for i := range out.WaitFor {
+		w := &out.WaitFor[i]
+		w.Image = valueOrDefault(w.Image, DefaultWaitForImage)
+	}
+	if g := out.GitSync; g != nil {
+		g.Ref = valueOrDefault(g.Ref, DefaultGitSyncRef)
+		g.Image = valueOrDefault(g.Image, DefaultGitSyncImage)
+		g.MountPath = valueOrDefault(g.MountPath, DefaultGitSyncMountPath)
+		if g.Interval == 0 {
+			g.Interval = DefaultGitSyncInterval
+		}
+	}
+	if c := out.Cache; c != nil {
+		c.MountPath = valueOrDefault(c.MountPath, DefaultCachePath)
+		if c.PersistentVolumeClaim != nil && len(c.PersistentVolumeClaim.AccessModes) == 0 {
+			c.PersistentVolumeClaim.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+		}
+	}
+	if c := out.CachePolicy; c != nil {
+		for i := range c.Zones {
+			z := &c.Zones[i]
+			z.Path = valueOrDefault(z.Path, DefaultCachePath+"/"+z.Name)
+			z.Size = valueOrDefault(z.Size, DefaultCacheZoneSize)
+			z.Key = valueOrDefault(z.Key, DefaultCacheKey)
+		}
+	}
+	for i := range out.PodTemplate.Ports {
+		p := &out.PodTemplate.Ports[i]
+		p.Protocol = corev1.Protocol(valueOrDefault(string(p.Protocol), string(corev1.ProtocolTCP)))
+	}
+	return out
+}
+
+func valueOrDefault(value, def string) string {
+	if value != "" {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,186 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNginxSpecWithDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		spec NginxSpec
+		want NginxSpec
+	}{
+		{
+			name: "empty",
+			spec: NginxSpec{},
+			want: NginxSpec{Image: "nginx:latest"},
+		},
+		{
+			name: "tls-defaults",
+			spec: NginxSpec{Image: "custom", TLSSecret: &TLSSecret{SecretName: "s", KeyField: "k"}},
+			want: NginxSpec{Image: "custom", TLSSecret: &TLSSecret{
+				SecretName:       "s",
+				KeyField:         "k",
+				KeyPath:          "k",
+				CertificateField: "tls.crt",
+				CertificatePath:  "tls.crt",
+			}},
+		},
+		{
+			name: "config-mount",
+			spec: NginxSpec{Image: "custom", Config: &ConfigRef{Name: "conf"}},
+			want: NginxSpec{Image: "custom", Config: &ConfigRef{Name: "conf", Mount: ConfigMountFile}},
+		},
+		{
+			name: "config-mount-with-reload",
+			spec: NginxSpec{Image: "custom", Config: &ConfigRef{Name: "conf"}, ConfigReload: ConfigReloadReload},
+			want: NginxSpec{Image: "custom", Config: &ConfigRef{Name: "conf", Mount: ConfigMountDirectory}, ConfigReload: ConfigReloadReload},
+		},
+		{
+			name: "config-files",
+			spec: NginxSpec{Image: "custom", ConfigFiles: []NginxConfigFile{
+				{Name: "mime.types", ConfigMap: "mime"},
+				{Name: "fastcgi_params", ConfigMap: "php", Key: "params"},
+			}},
+			want: NginxSpec{Image: "custom", ConfigFiles: []NginxConfigFile{
+				{Name: "mime.types", ConfigMap: "mime", Key: "mime.types"},
+				{Name: "fastcgi_params", ConfigMap: "php", Key: "params"},
+			}},
+		},
+		{
+			name: "retention",
+			spec: NginxSpec{Image: "custom", Retention: &NginxRetention{MaxEvents: 10}},
+			want: NginxSpec{Image: "custom", Retention: &NginxRetention{EventSeconds: 3600, MaxEvents: 10, CachePurgeHistory: 5}},
+		},
+		{
+			name: "extra-files",
+			spec: NginxSpec{Image: "custom", ExtraFiles: []NginxExtraFile{
+				{Path: "/etc/nginx/htpasswd/users", Secret: "users"},
+				{Path: "/etc/nginx/dhparam.pem", Secret: "dhparam", Key: "dhparam"},
+			}},
+			want: NginxSpec{Image: "custom", ExtraFiles: []NginxExtraFile{
+				{Path: "/etc/nginx/htpasswd/users", Secret: "users", Key: "users"},
+				{Path: "/etc/nginx/dhparam.pem", Secret: "dhparam", Key: "dhparam"},
+			}},
+		},
+		{
+			name: "metrics-exporter-image",
+			spec: NginxSpec{Image: "custom", Metrics: &NginxMetrics{}},
+			want: NginxSpec{Image: "custom", Metrics: &NginxMetrics{Image: "nginx/nginx-prometheus-exporter:0.1.0"}},
+		},
+		{
+			name: "canary-check",
+			spec: NginxSpec{Image: "custom", Rollout: &NginxRollout{CanaryPods: 1, CanaryCheck: &CanaryCheck{Host: "example.com"}}},
+			want: NginxSpec{Image: "custom", Rollout: &NginxRollout{CanaryPods: 1, CanaryCheck: &CanaryCheck{Path: "/", Port: 80, Host: "example.com", ExpectedStatus: 200}}},
+		},
+		{
+			name: "config-template",
+			spec: NginxSpec{Image: "custom", ConfigTemplate: &NginxConfigTemplate{ConfigMap: "templates"}},
+			want: NginxSpec{Image: "custom", ConfigTemplate: &NginxConfigTemplate{ConfigMap: "templates", Key: "nginx.conf"}},
+		},
+		{
+			name: "certificates",
+			spec: NginxSpec{Image: "custom", Certificates: &NginxCertificates{IssuerRef: CertificateIssuerRef{Name: "letsencrypt"}}},
+			want: NginxSpec{Image: "custom", Certificates: &NginxCertificates{IssuerRef: CertificateIssuerRef{Name: "letsencrypt", Kind: "Issuer", Group: "cert-manager.io"}}},
+		},
+		{
+			name: "ingress-path",
+			spec: NginxSpec{Image: "custom", Ingress: &NginxIngress{Hosts: []string{"example.com"}}},
+			want: NginxSpec{Image: "custom", Ingress: &NginxIngress{Hosts: []string{"example.com"}, Path: "/"}},
+		},
+		{
+			name: "locations",
+			spec: NginxSpec{Image: "custom", Locations: []NginxLocation{
+				{Path: "/old", Redirect: &RedirectAction{URL: "/new"}},
+				{Path: "/health", Match: LocationMatchExact, Return: &ReturnAction{Code: 200}},
+				{Path: "/", FastCGI: &FastCGIAction{Service: "php"}},
+				{Path: "/assets/", ObjectStorage: &ObjectStorageAction{Endpoint: "https://b.s3.amazonaws.com/", Signing: &ObjectStorageSigning{CredentialsSecret: "aws"}}},
+			}},
+			want: NginxSpec{Image: "custom", Locations: []NginxLocation{
+				{Path: "/old", Match: LocationMatchPrefix, Redirect: &RedirectAction{URL: "/new", Code: 302}},
+				{Path: "/health", Match: LocationMatchExact, Return: &ReturnAction{Code: 200}},
+				{Path: "/", Match: LocationMatchPrefix, FastCGI: &FastCGIAction{Service: "php", Port: 9000, Root: "/var/www/html", Index: "index.php"}},
+				{Path: "/assets/", Match: LocationMatchPrefix, ObjectStorage: &ObjectStorageAction{Endpoint: "https://b.s3.amazonaws.com/", Signing: &ObjectStorageSigning{
+					CredentialsSecret: "aws",
+					Region:            "us-east-1",
+					Service:           "s3",
+					Image:             "public.ecr.aws/aws-observability/aws-sigv4-proxy:1.0",
+				}}},
+			}},
+		},
+		{
+			name: "static-sites",
+			spec: NginxSpec{Image: "custom", StaticSites: []NginxStaticSite{
+				{Name: "www", ConfigMap: &StaticConfigMapSource{Name: "www"}},
+				{Name: "docs", Path: "/docs/", Index: "README.html", ObjectStorage: &StaticObjectStorageSource{URL: "s3://bucket/docs"}},
+				{Name: "blog", Path: "/blog/", ObjectStorage: &StaticObjectStorageSource{URL: "gs://bucket/blog", Image: "custom-sync"}},
+			}},
+			want: NginxSpec{Image: "custom", StaticSites: []NginxStaticSite{
+				{Name: "www", Path: "/", Index: "index.html", ConfigMap: &StaticConfigMapSource{Name: "www"}},
+				{Name: "docs", Path: "/docs/", Index: "README.html", ObjectStorage: &StaticObjectStorageSource{URL: "s3://bucket/docs", Image: "mesosphere/aws-cli:1.14.5"}},
+				{Name: "blog", Path: "/blog/", Index: "index.html", ObjectStorage: &StaticObjectStorageSource{URL: "gs://bucket/blog", Image: "custom-sync"}},
+			}},
+		},
+		{
+			name: "git-sync",
+			spec: NginxSpec{Image: "custom", GitSync: &NginxGitSync{Repository: "https://github.com/example/site"}},
+			want: NginxSpec{Image: "custom", GitSync: &NginxGitSync{
+				Repository: "https://github.com/example/site",
+				Ref:        "master",
+				Interval:   60,
+				Image:      "k8s.gcr.io/git-sync:v3.1.1",
+				MountPath:  "/usr/share/nginx/git",
+			}},
+		},
+		{
+			name: "wait-for",
+			spec: NginxSpec{Image: "custom", WaitFor: []NginxWaitFor{{TCP: "db:5432"}, {HTTP: "http://api", Image: "tools"}}},
+			want: NginxSpec{Image: "custom", WaitFor: []NginxWaitFor{
+				{TCP: "db:5432", Image: "busybox:1.36"},
+				{HTTP: "http://api", Image: "tools"},
+			}},
+		},
+		{
+			name: "cache-zones",
+			spec: NginxSpec{Image: "custom", CachePolicy: &NginxCachePolicy{Zones: []NginxCacheZone{
+				{Name: "api"},
+				{Name: "static", Path: "/cache", Size: "1m", Key: "$uri"},
+			}}},
+			want: NginxSpec{Image: "custom", CachePolicy: &NginxCachePolicy{Zones: []NginxCacheZone{
+				{Name: "api", Path: "/var/cache/nginx/api", Size: "10m", Key: "$scheme$proxy_host$request_uri"},
+				{Name: "static", Path: "/cache", Size: "1m", Key: "$uri"},
+			}}},
+		},
+		{
+			name: "cache-volume",
+			spec: NginxSpec{Image: "custom", Cache: &NginxCache{PersistentVolumeClaim: &NginxCacheClaim{}}},
+			want: NginxSpec{Image: "custom", Cache: &NginxCache{
+				MountPath: "/var/cache/nginx",
+				PersistentVolumeClaim: &NginxCacheClaim{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				},
+			}},
+		},
+		{
+			name: "port-protocol",
+			spec: NginxSpec{Image: "custom", PodTemplate: NginxPodTemplateSpec{Ports: []NginxPort{
+				{Name: "mysql", ContainerPort: 3306},
+				{Name: "syslog", ContainerPort: 514, Protocol: corev1.ProtocolUDP},
+			}}},
+			want: NginxSpec{Image: "custom", PodTemplate: NginxPodTemplateSpec{Ports: []NginxPort{
+				{Name: "mysql", ContainerPort: 3306, Protocol: corev1.ProtocolTCP},
+				{Name: "syslog", ContainerPort: 514, Protocol: corev1.ProtocolUDP},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := tt.spec.DeepCopy()
+			assert.Equal(t, &tt.want, tt.spec.WithDefaults())
+			assert.Equal(t, orig, &tt.spec)
+		})
+	}
+}
@@ -1,13 +1,22 @@
 package v1alpha1
 
 import (
+	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+// Nginx is an nginx server managed by the operator, which runs its pods and
+// creates the Service and the other objects it needs. The schema of the CRD
+// in deploy/crd.yaml is generated from these types by make manifests, with
+// their doc comments as field descriptions.
 type Nginx struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
@@ -15,22 +24,1432 @@ type Nginx struct {
 	Status            NginxStatus `json:"status,omitempty"`
 }
 
+// NginxSpec is the desired state of the nginx.
 type NginxSpec struct {
 	// Number of desired pods. This is a pointer to distinguish between explicit
 	// zero and not specified. Defaults to the default deployment replicas value.
 	// +optional
 	Replicas *int32 `json:"replicas"`
+	// ClampReplicasToQuota scales up only to the replicas whose pods fit in
+	// the resource quotas of the namespace, instead of leaving the extra
+	// pods failing to be created.
+	// +optional
+	ClampReplicasToQuota bool `json:"clampReplicasToQuota,omitempty"`
+	// Autoscaling configures the autoscalers of the nginx pods.
+	// +optional
+	Autoscaling *NginxAutoscaling `json:"autoscaling,omitempty"`
 	// Docker image name. Defaults to "nginx:latest".
 	// +optional
-	Image string `json:"image"`
-	// Reference to the nginx config object.
-	Config *ConfigRef `json:"configRef"`
-	// References to a secret containing tls certificate and key pairs.
+	Image string `json:"image"`
+	// Reference to the nginx config object.
+	Config *ConfigRef `json:"configRef"`
+	// ConfigTemplate renders nginx.conf from a Go template into a ConfigMap
+	// owned by this nginx, used as its config.
+	// +optional
+	ConfigTemplate *NginxConfigTemplate `json:"configTemplate,omitempty"`
+	// Values are custom values available to the config template as .Values.
+	// +optional
+	Values map[string]string `json:"values,omitempty"`
+	// ConfigFiles are auxiliary config files, like mime.types or
+	// fastcgi_params, placed next to nginx.conf in /etc/nginx.
+	// +optional
+	ConfigFiles []NginxConfigFile `json:"configFiles,omitempty"`
+	// ExtraFiles are files from ConfigMaps or Secrets placed under
+	// /etc/nginx, like htpasswd files, dhparams, GeoIP databases or snippets
+	// included from conf.d.
+	// +optional
+	ExtraFiles []NginxExtraFile `json:"extraFiles,omitempty"`
+	// References to a secret containing tls certificate and key pairs.
+	// +optional
+	TLSSecret *TLSSecret `json:"tlsSecret,omitempty"`
+	// Template used to configure the nginx pod.
+	// +optional
+	PodTemplate NginxPodTemplateSpec `json:"podTemplate"`
+	// Labels added to the objects generated for this nginx, like the
+	// workload, its pods and the services.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the objects generated for this nginx, like the
+	// workload, its pods and the services.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ControllerClass selects the operator handling this nginx, the one
+	// started with the same --controller-class. Nginx objects without it are
+	// handled by the operators started without a class.
+	// +optional
+	ControllerClass string `json:"controllerClass,omitempty"`
+	// Kind of the workload used to run the nginx pods. Defaults to WorkloadKindDeployment.
+	// +optional
+	WorkloadKind WorkloadKind `json:"workloadKind,omitempty"`
+	// Rollout configures how changes are progressively rolled out to the nginx pods.
+	// +optional
+	Rollout *NginxRollout `json:"rollout,omitempty"`
+	// Flagger enables the integration with Flagger canary analysis.
+	// +optional
+	Flagger *FlaggerSpec `json:"flagger,omitempty"`
+	// ValidateConfig runs `nginx -t` against the config in a Job before
+	// rolling out changes, refusing to roll out configs that fail the test.
+	// +optional
+	ValidateConfig bool `json:"validateConfig,omitempty"`
+	// DeletePropagation is the propagation policy used when deleting the
+	// objects created for this nginx, either because a feature was disabled
+	// or because the nginx itself was deleted. One of "Foreground",
+	// "Background" or "Orphan". Defaults to the operator --delete-propagation flag.
+	// +optional
+	DeletePropagation *metav1.DeletionPropagation `json:"deletePropagation,omitempty"`
+	// Certificates requests a TLS certificate from cert-manager, used as the
+	// TLS secret of this nginx.
+	// +optional
+	Certificates *NginxCertificates `json:"certificates,omitempty"`
+	// ExternalSecrets are Secrets materialized by the External Secrets
+	// operator from an external store, like Vault, and used as the TLS
+	// secret or as extra files of this nginx.
+	// +optional
+	ExternalSecrets []NginxExternalSecret `json:"externalSecrets,omitempty"`
+	// CleanupPolicy controls the cleanup done by the operator before the
+	// objects created for this nginx are removed on its deletion.
+	// +optional
+	CleanupPolicy *CleanupPolicy `json:"cleanupPolicy,omitempty"`
+	// ConfigReload is how running pods pick up changes to the content of the
+	// config. Defaults to ConfigReloadRestart.
+	// +optional
+	ConfigReload ConfigReloadStrategy `json:"configReload,omitempty"`
+	// Metrics enables a nginx-prometheus-exporter sidecar exposing the nginx
+	// metrics on the "metrics" port of the pods and the service.
+	// +optional
+	Metrics *NginxMetrics `json:"metrics,omitempty"`
+	// Ingress exposes the nginx service through an Ingress owned by the nginx.
+	// +optional
+	Ingress *NginxIngress `json:"ingress,omitempty"`
+	// Locations are rendered, in order, as nginx location blocks. Without a
+	// custom config they are served by the default server, custom configs
+	// must include them.
+	// +optional
+	Locations []NginxLocation `json:"locations,omitempty"`
+	// Snippets are nginx directives merged into the config managed by the
+	// operator. They cannot be used with a custom config.
+	// +optional
+	Snippets *NginxSnippets `json:"snippets,omitempty"`
+	// PodDisruptionBudget limits how many nginx pods can be voluntarily
+	// evicted at the same time, like during node drains.
+	// +optional
+	PodDisruptionBudget *NginxPodDisruptionBudget `json:"podDisruptionBudget,omitempty"`
+	// SpreadReplicas prefers scheduling the nginx pods on different nodes
+	// and zones, on top of the affinity of the pod template.
+	// +optional
+	SpreadReplicas bool `json:"spreadReplicas,omitempty"`
+	// NetworkPolicy creates a NetworkPolicy allowing the traffic to the
+	// ports of the nginx pods and, optionally, restricting their egress.
+	// +optional
+	NetworkPolicy *NginxNetworkPolicy `json:"networkPolicy,omitempty"`
+	// StaticSites are directories of static files served by the nginx,
+	// each one under its own path. Like the locations, custom configs must
+	// include them.
+	// +optional
+	StaticSites []NginxStaticSite `json:"staticSites,omitempty"`
+	// Healthcheck configures the probes of the nginx container. Without it
+	// the pods are only checked for readiness, with a GET on "/".
+	// +optional
+	Healthcheck *NginxHealthcheck `json:"healthcheck,omitempty"`
+	// GitSync keeps a clone of a git repository in the nginx pods, for
+	// static content or config files included by the nginx config. Nginx
+	// is reloaded whenever new commits are checked out.
+	// +optional
+	GitSync *NginxGitSync `json:"gitSync,omitempty"`
+	// Strategy is the deployment strategy used to replace the nginx pods.
+	// Not supported with WorkloadKindRollout, whose strategy is set by
+	// Rollout.
+	// +optional
+	Strategy *appv1.DeploymentStrategy `json:"strategy,omitempty"`
+	// RevisionHistoryLimit is the number of old ReplicaSets kept to allow
+	// rollbacks. Defaults to the operator default, or to the Kubernetes
+	// default.
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// MinReadySeconds is the minimum number of seconds a new pod must be
+	// ready, without any of its containers crashing, to be considered
+	// available.
+	// +optional
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+	// ProgressDeadlineSeconds is the number of seconds a rollout may take to
+	// make progress before it is reported as failed. Only supported with
+	// WorkloadKindDeployment and WorkloadKindRollout. Defaults to the
+	// operator default, or to the Kubernetes default.
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+	// CachePolicy declares the proxy cache zones used by proxy locations.
+	// +optional
+	CachePolicy *NginxCachePolicy `json:"cachePolicy,omitempty"`
+	// Cache mounts a volume for the proxy cache in the nginx container.
+	// +optional
+	Cache *NginxCache `json:"cache,omitempty"`
+	// NginxArgs are extra arguments of the nginx binary.
+	// +optional
+	NginxArgs *NginxArgs `json:"nginxArgs,omitempty"`
+	// Modules are dynamic modules copied from their images into the nginx
+	// pods by init containers and loaded with load_module.
+	// +optional
+	Modules []NginxModule `json:"modules,omitempty"`
+	// WaitFor are upstreams the nginx pods wait for before starting, each
+	// one checked by an init container until it is reachable.
+	// +optional
+	WaitFor []NginxWaitFor `json:"waitFor,omitempty"`
+	// OverloadProtection limits the connections and requests served by
+	// each pod, answering the excess with 503, so instances degrade
+	// gracefully during traffic spikes.
+	// +optional
+	OverloadProtection *NginxOverloadProtection `json:"overloadProtection,omitempty"`
+	// Logging configures the format and level of the nginx logs, and where
+	// the access log is shipped to.
+	// +optional
+	Logging *NginxLogging `json:"logging,omitempty"`
+	// UnknownHosts restricts the server generated by the operator to the
+	// given hostnames, answering the requests for other hosts from a
+	// catch-all default server. Not supported with custom configs.
+	// +optional
+	UnknownHosts *NginxUnknownHosts `json:"unknownHosts,omitempty"`
+	// Security adds a vetted set of security headers, like HSTS, to the
+	// responses of the server generated by the operator.
+	// +optional
+	Security *NginxSecurity `json:"security,omitempty"`
+	// Auth restricts the access to the server generated by the operator.
+	// +optional
+	Auth *NginxAuth `json:"auth,omitempty"`
+	// ServiceAccount runs the nginx pods under an existing service account,
+	// or under one created for the nginx with the given permissions,
+	// instead of the default service account of the namespace.
+	// +optional
+	ServiceAccount *NginxServiceAccount `json:"serviceAccount,omitempty"`
+	// SLO creates a Prometheus Operator PrometheusRule recording the error
+	// and slow request ratios of the nginx and alerting when they burn its
+	// error budget too fast. Requires spec.metrics.upstreams.
+	// +optional
+	SLO *NginxSLO `json:"slo,omitempty"`
+	// DNS publishes hostnames pointing to the nginx through external-dns.
+	// +optional
+	DNS *NginxDNS `json:"dns,omitempty"`
+	// Endpoints publishes the addresses of the ready nginx pods in the
+	// status, for load balancers outside the cluster sending traffic to the
+	// pods directly.
+	// +optional
+	Endpoints *NginxEndpoints `json:"endpoints,omitempty"`
+	// AppProtocol served by the default server on the http and https
+	// ports: http, http2 for cleartext HTTP/2 (h2c) or grpc. Defaults to
+	// http.
+	// +optional
+	AppProtocol AppProtocol `json:"appProtocol,omitempty"`
+	// Rootless runs nginx as a non-root user on the ports 8080 and 8443,
+	// with a read-only root filesystem and no capabilities, for namespaces
+	// enforcing the restricted Pod Security Standard.
+	// +optional
+	Rootless bool `json:"rootless,omitempty"`
+	// Service configures the services exposing the nginx pods.
+	// +optional
+	Service *NginxServiceSpec `json:"service,omitempty"`
+	// Profiles are overlays of the spec for each environment. The profile
+	// selected by the nginx.tsuru.io/profile label of the namespace, or else
+	// by the operator --profile flag, is merged into the spec when
+	// reconciling.
+	// +optional
+	Profiles map[string]NginxProfile `json:"profiles,omitempty"`
+	// NodeRemediation replaces the nginx pods running on unhealthy nodes,
+	// like nodes that stopped reporting or that the node-problem-detector
+	// flagged, instead of waiting for Kubernetes to evict them.
+	// +optional
+	NodeRemediation *NginxNodeRemediation `json:"nodeRemediation,omitempty"`
+	// Lifecycle configures the hooks of the nginx container and how long
+	// the pods have to drain their connections when stopped.
+	// +optional
+	Lifecycle *NginxLifecycle `json:"lifecycle,omitempty"`
+	// MaxUnavailable is the number or percentage of nginx pods that can be
+	// unavailable at the same time because of the operator actions, like
+	// the rollouts of new configs and restarts, node remediation and
+	// workload kind migrations, on top of the deployment strategy.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// Retention bounds the events recorded for the nginx and the history
+	// kept in its status, removed by the operator periodically.
+	// +optional
+	Retention *NginxRetention `json:"retention,omitempty"`
+	// SpecHistoryLimit is the number of previous specs kept in
+	// ControllerRevisions, besides the current one, to be restored with
+	// rollbackTo. Defaults to 10.
+	// +optional
+	SpecHistoryLimit *int32 `json:"specHistoryLimit,omitempty"`
+	// RollbackTo restores the spec of a revision of the history. The
+	// operator replaces the spec with the one of the revision, which clears
+	// this field.
+	// +optional
+	RollbackTo *NginxRollback `json:"rollbackTo,omitempty"`
+	// ApplyMode is how changes to the spec are applied to the objects of
+	// the nginx. Defaults to ApplyModeAutomatic.
+	// +optional
+	ApplyMode ApplyMode `json:"applyMode,omitempty"`
+	// Paused stops the operator from reconciling the objects of the nginx,
+	// which can then be changed by hand, like during an incident. The
+	// status is still updated. Unpausing reverts the manual changes.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+type ApplyMode string
+
+const (
+	// ApplyModeAutomatic applies the changes to the spec as soon as they are
+	// made.
+	ApplyModeAutomatic = ApplyMode("Automatic")
+	// ApplyModeManual publishes the changes to the objects of the nginx in
+	// status.pendingApply and applies them once the
+	// nginx.tsuru.io/approve-apply annotation is set to their revision.
+	ApplyModeManual = ApplyMode("Manual")
+)
+
+// NginxProfile overrides fields of the spec for an environment. Fields left
+// empty keep the value set in the spec.
+type NginxProfile struct {
+	// Replicas overrides spec.replicas.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Image overrides spec.image.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Resources overrides spec.podTemplate.resources.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector overrides spec.podTemplate.nodeSelector.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations overrides spec.podTemplate.tolerations.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Values are merged into spec.values, replacing the values with the
+	// same keys.
+	// +optional
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// NginxNodeRemediation describes when the nginx pods are replaced because
+// of the health of their node.
+type NginxNodeRemediation struct {
+	// Conditions are the node conditions marking the node unhealthy when
+	// true, like the KernelDeadlock or ReadonlyFilesystem conditions of the
+	// node-problem-detector. Nodes whose Ready condition is not true are
+	// always unhealthy.
+	// +optional
+	Conditions []corev1.NodeConditionType `json:"conditions,omitempty"`
+	// UnhealthySeconds is how long a node must be unhealthy before its
+	// nginx pods are replaced. Defaults to 60.
+	// +optional
+	UnhealthySeconds int32 `json:"unhealthySeconds,omitempty"`
+}
+
+// NginxRetention bounds the events and the status history kept for the
+// nginx.
+type NginxRetention struct {
+	// EventSeconds is how long the events recorded by the operator for the
+	// nginx are kept after they last happened. Defaults to 3600.
+	// +optional
+	EventSeconds int32 `json:"eventSeconds,omitempty"`
+	// MaxEvents is the number of events recorded by the operator for the
+	// nginx that are kept, the latest ones. Defaults to 50.
+	// +optional
+	MaxEvents int32 `json:"maxEvents,omitempty"`
+	// CachePurgeHistory is the number of cache purges kept in the status.
+	// Defaults to 5.
+	// +optional
+	CachePurgeHistory int32 `json:"cachePurgeHistory,omitempty"`
+}
+
+// NginxRollback is the revision of the spec history restored.
+type NginxRollback struct {
+	// Revision of status.specHistory to restore. Defaults to 0, the
+	// revision reconciled before the current one.
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// NginxLifecycle configures the hooks of the nginx container and the
+// termination grace period of the nginx pods.
+type NginxLifecycle struct {
+	// PreStop is the hook run before the nginx container is stopped.
+	// Defaults to waiting PreStopSleepSeconds, so the pod is removed from
+	// the service endpoints, and stopping nginx with "nginx -s quit", which
+	// waits for the in-flight requests.
+	// +optional
+	PreStop *corev1.Handler `json:"preStop,omitempty"`
+	// PreStopSleepSeconds is how long the default preStop hook waits before
+	// stopping nginx. Defaults to 5.
+	// +optional
+	PreStopSleepSeconds *int32 `json:"preStopSleepSeconds,omitempty"`
+	// PostStart is the hook run after the nginx container is created.
+	// +optional
+	PostStart *corev1.Handler `json:"postStart,omitempty"`
+	// TerminationGracePeriodSeconds is the time given to the nginx pod to
+	// stop, including the preStop hook, before it is killed. Defaults to
+	// the Kubernetes default, 30 seconds.
+	// +optional
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+}
+
+// NginxServiceSpec configures the services exposing the nginx pods.
+type NginxServiceSpec struct {
+	// Headless creates an additional headless Service, named
+	// <name>-headless, resolving to the address of each nginx pod, for
+	// clients balancing or health checking the pods themselves.
+	// +optional
+	Headless bool `json:"headless,omitempty"`
+	// Type of the service, ClusterIP, NodePort or LoadBalancer. Defaults
+	// to ClusterIP.
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// SessionAffinity sends the requests of each client address to the
+	// same nginx pod.
+	// +optional
+	SessionAffinity *NginxSessionAffinity `json:"sessionAffinity,omitempty"`
+	// ProxyProtocol makes the cloud load balancer of a LoadBalancer service
+	// send the client address with the PROXY protocol, which nginx takes
+	// as the address of the requests. Custom configs must accept the PROXY
+	// protocol on their listeners.
+	// +optional
+	ProxyProtocol bool `json:"proxyProtocol,omitempty"`
+	// LoadBalancerTimeoutSeconds is how long the cloud load balancer of a
+	// LoadBalancer service may take to be allocated before the
+	// LoadBalancerReady condition reports it stuck. Defaults to 600.
+	// +optional
+	LoadBalancerTimeoutSeconds int32 `json:"loadBalancerTimeoutSeconds,omitempty"`
+	// IPFamilyPolicy of the services, SingleStack, PreferDualStack or
+	// RequireDualStack. Defaults to the cluster default, SingleStack.
+	// +optional
+	IPFamilyPolicy IPFamilyPolicy `json:"ipFamilyPolicy,omitempty"`
+	// IPFamilies of the services, IPv4 or IPv6, the first one being the
+	// primary family. The servers generated by the operator listen on
+	// each of them, on IPv4 only when unset.
+	// +optional
+	IPFamilies []IPFamily `json:"ipFamilies,omitempty"`
+}
+
+// IPFamilyPolicy is the IP family policy of the services of the nginx.
+type IPFamilyPolicy string
+
+const (
+	// IPFamilyPolicySingleStack allocates a single IP family
+	IPFamilyPolicySingleStack = IPFamilyPolicy("SingleStack")
+	// IPFamilyPolicyPreferDualStack allocates both IP families on dual-stack
+	// clusters, a single one otherwise
+	IPFamilyPolicyPreferDualStack = IPFamilyPolicy("PreferDualStack")
+	// IPFamilyPolicyRequireDualStack allocates both IP families, failing on
+	// single-stack clusters
+	IPFamilyPolicyRequireDualStack = IPFamilyPolicy("RequireDualStack")
+)
+
+// IPFamily is an IP family of the services of the nginx.
+type IPFamily string
+
+const (
+	// IPv4Protocol is the IPv4 family
+	IPv4Protocol = IPFamily("IPv4")
+	// IPv6Protocol is the IPv6 family
+	IPv6Protocol = IPFamily("IPv6")
+)
+
+// NginxSessionAffinity configures the ClientIP session affinity of the
+// service.
+type NginxSessionAffinity struct {
+	// TimeoutSeconds is how long the requests of a client keep going to
+	// the same pod after its last request, up to 86400. Defaults to 10800.
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// NginxArgs are extra arguments passed to the nginx binary of the nginx
+// container, for tweaks not worth a custom config.
+type NginxArgs struct {
+	// Globals are directives set in the main context through the -g flag,
+	// like "worker_processes 4". Each one must be a single directive
+	// without blocks, quotes or shell characters. The daemon directive is
+	// set by the operator.
+	// +optional
+	Globals []string `json:"globals,omitempty"`
+}
+
+// NginxModule is a dynamic nginx module shipped in an image.
+type NginxModule struct {
+	// Name of the module, like brotli. It names the init container copying
+	// the module.
+	Name string `json:"name"`
+	// Image holding the shared objects of the module, built for the nginx
+	// version of the nginx image. It must provide the cp command.
+	Image string `json:"image"`
+	// Files are the absolute paths of the shared objects in the image, like
+	// /usr/lib/nginx/modules/ngx_http_brotli_filter_module.so, loaded in
+	// order.
+	Files []string `json:"files"`
+}
+
+// NginxOverloadProtection describes how each nginx pod sheds load once
+// overloaded. Shed requests are answered with 503 and a Retry-After header.
+type NginxOverloadProtection struct {
+	// MaxConnections is the maximum number of connections served at once
+	// by each pod.
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+	// MaxRequestsPerSecond is the maximum rate of requests served by each
+	// pod.
+	// +optional
+	MaxRequestsPerSecond int32 `json:"maxRequestsPerSecond,omitempty"`
+	// Burst is the number of requests above the rate that are accepted.
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
+	// ExcessRequests is what happens to the requests of the burst. Defaults
+	// to OverloadQueue.
+	// +optional
+	ExcessRequests OverloadExcessPolicy `json:"excessRequests,omitempty"`
+	// RetryAfterSeconds is the value of the Retry-After header of the shed
+	// requests. Defaults to 5.
+	// +optional
+	RetryAfterSeconds int32 `json:"retryAfterSeconds,omitempty"`
+	// CPUShedding runs a sidecar shedding every request while the CPU usage
+	// of the pod is above a threshold.
+	// +optional
+	CPUShedding *NginxCPUShedding `json:"cpuShedding,omitempty"`
+}
+
+type OverloadExcessPolicy string
+
+const (
+	// OverloadQueue delays the requests of the burst to keep to the rate.
+	OverloadQueue = OverloadExcessPolicy("Queue")
+	// OverloadReject serves the requests of the burst without delay and
+	// rejects the ones above it.
+	OverloadReject = OverloadExcessPolicy("Reject")
+)
+
+// NginxCPUShedding describes the sidecar monitoring the CPU usage of the
+// pod. The sidecar creates the file in $NGINX_OVERLOAD_SHED_FILE while the
+// usage is above $NGINX_OVERLOAD_CPU_THRESHOLD percent of the CPU limit of
+// the nginx container, in millicores in $NGINX_CPU_LIMIT, and removes it
+// once below.
+type NginxCPUShedding struct {
+	// Image of the sidecar.
+	Image string `json:"image"`
+	// ThresholdPercent is the CPU usage, as a percentage of the CPU limit,
+	// above which requests are shed. Defaults to 90.
+	// +optional
+	ThresholdPercent int32 `json:"thresholdPercent,omitempty"`
+	// Resources of the sidecar.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// NginxLogging describes the access and error logs of nginx. The access log
+// is written to the stdout of the nginx container unless shipped to syslog
+// or fluent-bit, at most one of which can be set.
+type NginxLogging struct {
+	// Format of the access log. Defaults to LogFormatCombined.
+	// +optional
+	Format LogFormat `json:"format,omitempty"`
+	// CustomFormat is the log_format string of the access log, with nginx
+	// variables. Required by LogFormatCustom.
+	// +optional
+	CustomFormat string `json:"customFormat,omitempty"`
+	// ErrorLogLevel is the minimum level of the messages written to the
+	// error log: debug, info, notice, warn, error, crit, alert or emerg.
+	// Defaults to "error".
+	// +optional
+	ErrorLogLevel string `json:"errorLogLevel,omitempty"`
+	// Syslog ships the access log to a syslog server.
+	// +optional
+	Syslog *NginxSyslog `json:"syslog,omitempty"`
+	// FluentBit ships the access log to a fluent-bit sidecar, which
+	// forwards it to the configured output.
+	// +optional
+	FluentBit *NginxFluentBit `json:"fluentBit,omitempty"`
+}
+
+type LogFormat string
+
+const (
+	// LogFormatCombined is the combined format of the nginx image.
+	LogFormatCombined = LogFormat("combined")
+	// LogFormatJSON writes each request as a JSON object.
+	LogFormatJSON = LogFormat("json")
+	// LogFormatCustom uses the format in CustomFormat.
+	LogFormatCustom = LogFormat("custom")
+)
+
+// NginxSyslog describes the syslog server receiving the access log over
+// UDP.
+type NginxSyslog struct {
+	// Server is the address of the syslog server, as host or host:port, or
+	// the path of a UNIX socket prefixed with "unix:".
+	Server string `json:"server"`
+	// Facility of the messages. Defaults to "local7".
+	// +optional
+	Facility string `json:"facility,omitempty"`
+	// Tag of the messages. Defaults to "nginx".
+	// +optional
+	Tag string `json:"tag,omitempty"`
+}
+
+// NginxFluentBit describes the fluent-bit sidecar receiving the access log
+// over syslog on localhost.
+type NginxFluentBit struct {
+	// Image of the sidecar. Defaults to "fluent/fluent-bit:1.9.10".
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Output is the name of the fluent-bit output plugin, like "es",
+	// "forward" or "loki".
+	Output string `json:"output"`
+	// Properties of the output plugin, like its host and port.
+	// +optional
+	Properties map[string]string `json:"properties,omitempty"`
+	// Resources of the sidecar.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// NginxUnknownHosts describes how the requests for hosts not served by the
+// nginx are answered.
+type NginxUnknownHosts struct {
+	// ServerNames served by the nginx, exact or with a leading wildcard like
+	// "*.example.com". Defaults to the hosts of the ingress and the DNS
+	// names of the certificates.
+	// +optional
+	ServerNames []string `json:"serverNames,omitempty"`
+	// Code of the responses to the requests for other hosts, a 4xx status
+	// code or 444 to close the connection. Defaults to 421.
+	// +optional
+	Code int32 `json:"code,omitempty"`
+}
+
+// NginxSecurity describes the security headers added to the responses.
+type NginxSecurity struct {
+	// HeadersProfile is the set of security headers added to the
+	// responses. Defaults to SecurityHeadersModerate.
+	// +optional
+	HeadersProfile SecurityHeadersProfile `json:"headersProfile,omitempty"`
+	// HSTSPreload adds the preload directive to the
+	// Strict-Transport-Security header, so the domains can be submitted to
+	// the preload lists of the browsers. Requires SecurityHeadersStrict.
+	// +optional
+	HSTSPreload bool `json:"hstsPreload,omitempty"`
+	// ContentSecurityPolicy is the value of the Content-Security-Policy
+	// header. Not supported with SecurityHeadersOff.
+	// +optional
+	ContentSecurityPolicy string `json:"contentSecurityPolicy,omitempty"`
+}
+
+type SecurityHeadersProfile string
+
+const (
+	// SecurityHeadersStrict enables HSTS for two years, including the
+	// subdomains, forbids framing and sends no referrer.
+	SecurityHeadersStrict = SecurityHeadersProfile("strict")
+	// SecurityHeadersModerate enables HSTS for a year, only allows framing
+	// by the same origin and sends the origin as referrer to other sites.
+	SecurityHeadersModerate = SecurityHeadersProfile("moderate")
+	// SecurityHeadersOff adds no security header.
+	SecurityHeadersOff = SecurityHeadersProfile("off")
+)
+
+// NginxAutoscaling describes the autoscalers of the nginx pods.
+type NginxAutoscaling struct {
+	// Vertical creates a VerticalPodAutoscaler sizing the resources of the
+	// nginx container. Requires the VerticalPodAutoscaler CRD and the
+	// recommender to be installed.
+	// +optional
+	Vertical *NginxVerticalAutoscaling `json:"vertical,omitempty"`
+}
+
+// NginxVerticalAutoscaling describes the VerticalPodAutoscaler of the nginx.
+type NginxVerticalAutoscaling struct {
+	// UpdateMode is how the recommendations are applied: Off only computes
+	// them, Initial sets them on the pods when they are created and Auto
+	// also replaces the pods whose resources are far from them. Defaults to
+	// Off.
+	// +optional
+	UpdateMode VerticalUpdateMode `json:"updateMode,omitempty"`
+	// MinAllowed are the lowest resources recommended for the nginx
+	// container.
+	// +optional
+	MinAllowed corev1.ResourceList `json:"minAllowed,omitempty"`
+	// MaxAllowed are the highest resources recommended for the nginx
+	// container.
+	// +optional
+	MaxAllowed corev1.ResourceList `json:"maxAllowed,omitempty"`
+}
+
+type VerticalUpdateMode string
+
+const (
+	// VerticalUpdateModeOff only computes the recommendations
+	VerticalUpdateModeOff = VerticalUpdateMode("Off")
+	// VerticalUpdateModeInitial sets the recommendations on the pods when
+	// they are created
+	VerticalUpdateModeInitial = VerticalUpdateMode("Initial")
+	// VerticalUpdateModeAuto sets the recommendations on the pods when they
+	// are created and replaces the running pods to apply them
+	VerticalUpdateModeAuto = VerticalUpdateMode("Auto")
+)
+
+// NginxDNS describes the DNS records published for the nginx by
+// external-dns, which must be running in the cluster.
+type NginxDNS struct {
+	// Hostnames pointing to the load balancer of the ingress of the nginx,
+	// or of its service when it has no ingress.
+	Hostnames []string `json:"hostnames"`
+	// TTL of the records, in seconds. Defaults to the external-dns one.
+	// +optional
+	TTL int32 `json:"ttl,omitempty"`
+}
+
+// NginxEndpoints describes where the addresses of the ready nginx pods are
+// published, besides status.endpoints.
+type NginxEndpoints struct {
+	// ConfigMap also writes the addresses, as JSON, into the endpoints.json
+	// key of the <name>-endpoints ConfigMap, which can be mounted or read by
+	// clients not allowed to read the nginx.
+	// +optional
+	ConfigMap bool `json:"configMap,omitempty"`
+}
+
+// NginxSLO describes the service level objectives of the nginx, measured
+// over 30 days from the metrics of the upstream metrics sidecar.
+type NginxSLO struct {
+	// Availability is the percentage of requests, like "99.9", that must
+	// not be answered with a 5xx status. Defaults to
+	// DefaultSLOAvailability.
+	// +optional
+	Availability string `json:"availability,omitempty"`
+	// Latency adds an objective on the time taken to answer the requests.
+	// +optional
+	Latency *NginxSLOLatency `json:"latency,omitempty"`
+	// Labels added to the PrometheusRule, usually the ones selected by the
+	// Prometheus instance.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// AlertLabels are added to the alerts, like the team they are routed
+	// to.
+	// +optional
+	AlertLabels map[string]string `json:"alertLabels,omitempty"`
+}
+
+// NginxSLOLatency describes the latency objective of the nginx.
+type NginxSLOLatency struct {
+	// Threshold, in seconds, requests must be answered within. It must be
+	// one of the buckets of spec.metrics.upstreams.
+	Threshold string `json:"threshold"`
+	// Target is the percentage of requests, like "99", that must be
+	// answered within the threshold. Defaults to DefaultSLOLatencyTarget.
+	// +optional
+	Target string `json:"target,omitempty"`
+}
+
+// NginxServiceAccount describes the service account running the nginx pods.
+// Exactly one of Name and Create must be set.
+type NginxServiceAccount struct {
+	// Name of an existing service account in the nginx namespace.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Create makes the operator create a service account named after the
+	// nginx, removed along with it.
+	// +optional
+	Create bool `json:"create,omitempty"`
+	// Annotations of the created service account, like the cloud IAM role
+	// it is bound to.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Rules are the permissions granted to the created service account in
+	// the nginx namespace, through a Role and a RoleBinding named after
+	// the nginx, like reading the TLS secret from a sidecar. Only the get,
+	// list and watch verbs are supported, and the operator must hold the
+	// permissions it grants. The token of the service account is mounted
+	// in the pods when rules are set, unless
+	// podTemplate.automountServiceAccountToken says otherwise.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+// NginxAuth describes how the requests are authorized.
+type NginxAuth struct {
+	// External authorizes each request with a subrequest to a service.
+	// +optional
+	External *NginxExternalAuth `json:"external,omitempty"`
+}
+
+// NginxExternalAuth authorizes the requests with a subrequest to a service in
+// the nginx namespace, like oauth2-proxy. Requests are allowed when it
+// answers with a 2xx, and denied with its 401 or 403 otherwise. The
+// subrequest carries the headers of the request, without its body, and the
+// X-Original-URI and X-Original-Method headers.
+type NginxExternalAuth struct {
+	// Service name.
+	Service string `json:"service"`
+	// Port of the service.
+	Port int32 `json:"port"`
+	// Path requested on the service. Defaults to "/".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Cache caches the answers of the service, so it is not requested for
+	// every request.
+	// +optional
+	Cache *NginxExternalAuthCache `json:"cache,omitempty"`
+}
+
+// NginxExternalAuthCache caches the answers of the external auth service.
+// The 2xx, 401 and 403 answers are cached for the TTL, regardless of their
+// Cache-Control, Expires and Set-Cookie headers, and concurrent requests with
+// the same key wait for a single subrequest.
+type NginxExternalAuthCache struct {
+	// Zone is the name of a zone of the cache policy.
+	Zone string `json:"zone"`
+	// Key identifying the cached answers. It must hold everything the
+	// service authorizes on, like the credentials, and the URI when it
+	// authorizes by path. Defaults to "$http_authorization$http_cookie".
+	// +optional
+	Key string `json:"key,omitempty"`
+	// TTL of the cached answers. Defaults to "1m".
+	// +optional
+	TTL string `json:"ttl,omitempty"`
+}
+
+// NginxCache describes the volume holding the proxy cache. At most one of
+// EmptyDir and PersistentVolumeClaim can be set, an emptyDir is used when
+// none is.
+type NginxCache struct {
+	// MountPath of the volume in the nginx container. Defaults to
+	// "/var/cache/nginx".
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+	// EmptyDir keeps the cache in an emptyDir volume, optionally in memory
+	// and with a size limit.
+	// +optional
+	EmptyDir *corev1.EmptyDirVolumeSource `json:"emptyDir,omitempty"`
+	// PersistentVolumeClaim keeps the cache in a volume claimed for each
+	// replica. Requires WorkloadKindStatefulSet.
+	// +optional
+	PersistentVolumeClaim *NginxCacheClaim `json:"persistentVolumeClaim,omitempty"`
+}
+
+// NginxCacheClaim describes the volume claimed for the cache of each replica.
+type NginxCacheClaim struct {
+	// StorageClassName of the claim. Defaults to the default storage class.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	// Size requested by the claim.
+	Size resource.Quantity `json:"size"`
+	// AccessModes of the claim. Defaults to ReadWriteOnce.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+}
+
+// NginxCachePolicy describes the proxy cache zones of the nginx.
+type NginxCachePolicy struct {
+	// Zones are rendered as proxy_cache_path directives.
+	Zones []NginxCacheZone `json:"zones"`
+}
+
+// NginxCacheZone is a proxy cache zone and the caching rules of the
+// locations using it.
+type NginxCacheZone struct {
+	// Name of the zone, referenced by the proxy locations.
+	Name string `json:"name"`
+	// Path of the cache directory. Defaults to "/var/cache/nginx/<name>".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Size of the shared memory zone holding the keys, like "10m". Defaults
+	// to "10m".
+	// +optional
+	Size string `json:"size,omitempty"`
+	// MaxSize is the maximum size of the cached data, like "1g".
+	// +optional
+	MaxSize string `json:"maxSize,omitempty"`
+	// Inactive is how long entries not accessed are kept, like "60m".
+	// +optional
+	Inactive string `json:"inactive,omitempty"`
+	// Key of the cached responses. Defaults to "$scheme$proxy_host$request_uri".
+	// +optional
+	Key string `json:"key,omitempty"`
+	// Valid sets how long responses are cached per status code.
+	// +optional
+	Valid []NginxCacheValid `json:"valid,omitempty"`
+	// Bypass are conditions, like "$cookie_nocache", under which the
+	// response is not taken from the cache.
+	// +optional
+	Bypass []string `json:"bypass,omitempty"`
+	// NoCache are conditions under which the response is not saved to the
+	// cache.
+	// +optional
+	NoCache []string `json:"noCache,omitempty"`
+	// UseStale are the cases in which a stale cached response is served,
+	// like "error" or "http_502".
+	// +optional
+	UseStale []string `json:"useStale,omitempty"`
+	// StaleWhileRevalidate serves the stale response while it is updated
+	// in the background.
+	// +optional
+	StaleWhileRevalidate bool `json:"staleWhileRevalidate,omitempty"`
+}
+
+// NginxCacheValid is how long responses with some status codes are cached.
+type NginxCacheValid struct {
+	// Codes of the responses. When empty 200, 301 and 302 responses are cached.
+	// +optional
+	Codes []int32 `json:"codes,omitempty"`
+	// TTL of the responses, like "10m".
+	TTL string `json:"ttl"`
+}
+
+// NginxGitSync describes the git repository synced into the nginx pods.
+type NginxGitSync struct {
+	// Repository is the URL of the git repository.
+	Repository string `json:"repository"`
+	// Ref is the branch or tag checked out. Defaults to "master".
+	// +optional
+	Ref string `json:"ref,omitempty"`
+	// Interval is how often, in seconds, the repository is pulled.
+	// Defaults to 60.
+	// +optional
+	Interval int32 `json:"interval,omitempty"`
+	// Secret is the name of a secret whose keys are set as environment
+	// variables of git-sync, like GIT_SYNC_USERNAME and GIT_SYNC_PASSWORD.
+	// +optional
+	Secret string `json:"secret,omitempty"`
+	// Image of the git-sync containers.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// MountPath is where the shared volume is mounted in the nginx
+	// container, the checkout is found at <mountPath>/repo. Defaults to
+	// "/usr/share/nginx/git".
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// NginxWaitFor is an upstream the nginx pods wait for before starting, set
+// either as a TCP address or as an HTTP URL.
+type NginxWaitFor struct {
+	// TCP is the host:port address of the upstream, reachable once it
+	// accepts connections.
+	// +optional
+	TCP string `json:"tcp,omitempty"`
+	// HTTP is the http or https URL of the upstream, reachable once it
+	// answers with a status below 400.
+	// +optional
+	HTTP string `json:"http,omitempty"`
+	// TimeoutSeconds is how long the pods wait for the upstream before the
+	// init container fails, restarting it with a backoff. Defaults to 0,
+	// waiting until it is reachable.
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// Image of the init container, which must provide sh, nc, wget and
+	// timeout. Defaults to "busybox:1.36".
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// NginxHealthcheck describes the probes of the nginx container.
+type NginxHealthcheck struct {
+	// Readiness replaces the default readiness probe.
+	// +optional
+	Readiness *NginxProbe `json:"readiness,omitempty"`
+	// Liveness adds a liveness probe, restarting the containers that fail it.
+	// +optional
+	Liveness *NginxProbe `json:"liveness,omitempty"`
+	// Startup gives slow starting containers time before the liveness
+	// probe starts counting failures.
+	// +optional
+	Startup *NginxStartupProbe `json:"startup,omitempty"`
+}
+
+// NginxProbe is an HTTP probe of the nginx container. Path, port and scheme
+// default to the ones of the default readiness probe: "/" on the http port,
+// or on the https port when TLS is enabled.
+type NginxProbe struct {
+	// Path requested by the probe.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Port number or name requested by the probe.
+	// +optional
+	Port *intstr.IntOrString `json:"port,omitempty"`
+	// Scheme used by the probe, HTTP or HTTPS.
+	// +optional
+	Scheme corev1.URIScheme `json:"scheme,omitempty"`
+	// Number of seconds after the container has started before the probe
+	// is initiated.
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// Number of seconds after which the probe times out.
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// How often, in seconds, to perform the probe.
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// Minimum consecutive successes for the probe to be considered
+	// successful after having failed.
+	// +optional
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+	// Minimum consecutive failures for the probe to be considered failed
+	// after having succeeded.
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// NginxStartupProbe describes how long containers may take to start. The
+// Kubernetes versions supported by the operator have no startup probes, so
+// the liveness probe is delayed by the whole startup budget instead,
+// InitialDelaySeconds + PeriodSeconds * FailureThreshold.
+type NginxStartupProbe struct {
+	// Number of seconds after the container has started before the
+	// startup budget starts counting.
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// How often, in seconds, the container would be probed. Defaults to 10.
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// Number of periods the container may take to start. Defaults to 3.
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// NginxStaticSite serves the files of a source under a path. Exactly one
+// source must be set.
+type NginxStaticSite struct {
+	// Name of the site, used to name its volume. Must be unique among the
+	// static sites.
+	Name string `json:"name"`
+	// Path the site is served under. Defaults to "/".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Index is the file served for requests to directories. Defaults to
+	// "index.html".
+	// +optional
+	Index string `json:"index,omitempty"`
+	// ConfigMap serves the files of a ConfigMap, one file per key.
+	// +optional
+	ConfigMap *StaticConfigMapSource `json:"configMap,omitempty"`
+	// PersistentVolumeClaim serves the files of a volume claim.
+	// +optional
+	PersistentVolumeClaim *StaticPersistentVolumeClaimSource `json:"persistentVolumeClaim,omitempty"`
+	// ObjectStorage serves the files of a bucket, copied by an init
+	// container when the pod starts.
+	// +optional
+	ObjectStorage *StaticObjectStorageSource `json:"objectStorage,omitempty"`
+}
+
+// StaticConfigMapSource references a ConfigMap in the nginx namespace.
+type StaticConfigMapSource struct {
+	// ConfigMap name.
+	Name string `json:"name"`
+}
+
+// StaticPersistentVolumeClaimSource references a PersistentVolumeClaim in
+// the nginx namespace.
+type StaticPersistentVolumeClaimSource struct {
+	// ClaimName is the name of the claim.
+	ClaimName string `json:"claimName"`
+	// SubPath is the directory of the volume holding the site.
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+}
+
+// StaticObjectStorageSource references a bucket of an object storage.
+type StaticObjectStorageSource struct {
+	// URL of the bucket and prefix holding the site, like
+	// "s3://bucket/site" or "gs://bucket/site".
+	URL string `json:"url"`
+	// Image of the init container copying the files. Defaults to an image
+	// with the CLI of the storage provider.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// CredentialsSecret is the name of a secret whose keys are set as
+	// environment variables of the init container, like
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+	// +optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// NginxPodDisruptionBudget describes the PodDisruptionBudget created for the
+// nginx pods. Exactly one of the fields must be set.
+type NginxPodDisruptionBudget struct {
+	// MinAvailable is the number or percentage of pods that must remain
+	// available during evictions.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// MaxUnavailable is the number or percentage of pods that can be
+	// unavailable during evictions.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// NginxNetworkPolicy describes the NetworkPolicy created for the nginx pods.
+// The ports exposed by the service are always allowed, from the given peers.
+type NginxNetworkPolicy struct {
+	// From are the peers allowed to connect to the nginx ports, like the
+	// namespace of the ingress controller. Any peer is allowed when empty.
+	// +optional
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+	// Egress are the upstreams the nginx pods can connect to. When set, any
+	// other egress traffic is denied, except DNS. Egress is not restricted
+	// when empty.
+	// +optional
+	Egress []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
+}
+
+// NginxLocation maps a path to an action. Exactly one action must be set.
+type NginxLocation struct {
+	// Path matched by the location.
+	Path string `json:"path"`
+	// Match is how the path is matched. Defaults to LocationMatchPrefix.
+	// +optional
+	Match LocationMatch `json:"match,omitempty"`
+	// Proxy passes the requests to a service.
+	// +optional
+	Proxy *ProxyAction `json:"proxy,omitempty"`
+	// FastCGI passes the requests to a FastCGI server, like PHP-FPM.
+	// +optional
+	FastCGI *FastCGIAction `json:"fastcgi,omitempty"`
+	// ObjectStorage serves the objects of a bucket.
+	// +optional
+	ObjectStorage *ObjectStorageAction `json:"objectStorage,omitempty"`
+	// Static serves the files of a ConfigMap.
+	// +optional
+	Static *StaticAction `json:"static,omitempty"`
+	// Redirect redirects the requests to another URL.
+	// +optional
+	Redirect *RedirectAction `json:"redirect,omitempty"`
+	// Return responds with a fixed status code and body.
+	// +optional
+	Return *ReturnAction `json:"return,omitempty"`
+	// Options are additional nginx directives set in the location, like
+	// "client_max_body_size": "10m".
+	// +optional
+	Options map[string]string `json:"options,omitempty"`
+	// Bandwidth throttles the responses and limits the connections of the
+	// location.
+	// +optional
+	Bandwidth *LocationBandwidth `json:"bandwidth,omitempty"`
+}
+
+// NginxSnippets are nginx directives added to the blocks of the config
+// managed by the operator
+type NginxSnippets struct {
+	// HTTP is added to the http context.
+	// +optional
+	HTTP string `json:"http,omitempty"`
+	// Server is added to the default server.
+	// +optional
+	Server string `json:"server,omitempty"`
+	// Location is added to every location of spec.locations, or without
+	// them to the location serving the html directory of the image.
+	// +optional
+	Location string `json:"location,omitempty"`
+}
+
+// LocationBandwidth limits the transfer rate and the concurrent connections
+// of a location. Limits are enforced by each nginx pod independently.
+type LocationBandwidth struct {
+	// Rate limits the transfer rate of each response, in bytes per second,
+	// like "500k".
+	// +optional
+	Rate string `json:"rate,omitempty"`
+	// RateAfter is the amount of each response sent before the rate limit
+	// applies, like "10m".
+	// +optional
+	RateAfter string `json:"rateAfter,omitempty"`
+	// MaxConnections limits the concurrent connections to the location.
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+	// MaxConnectionsPerClient limits the concurrent connections of each
+	// client address to the location.
+	// +optional
+	MaxConnectionsPerClient int32 `json:"maxConnectionsPerClient,omitempty"`
+}
+
+type LocationMatch string
+
+const (
+	// LocationMatchPrefix matches the requests whose path starts with the location path
+	LocationMatchPrefix = LocationMatch("Prefix")
+	// LocationMatchExact matches the requests whose path is the location path
+	LocationMatchExact = LocationMatch("Exact")
+)
+
+// ProxyAction passes the requests to a service in the nginx namespace.
+type ProxyAction struct {
+	// Service name.
+	Service string `json:"service"`
+	// Port of the service.
+	Port int32 `json:"port"`
+	// Cache caches the responses of the service.
+	// +optional
+	Cache *ProxyCache `json:"cache,omitempty"`
+}
+
+// ProxyCache caches the responses of a proxy location.
+type ProxyCache struct {
+	// Zone is the name of a zone of the cache policy.
+	Zone string `json:"zone"`
+	// PurgeFrom are the addresses, or CIDRs, allowed to purge cached
+	// responses by sending PURGE requests to the location. Requires an
+	// nginx image with the ngx_cache_purge module.
+	// +optional
+	PurgeFrom []string `json:"purgeFrom,omitempty"`
+}
+
+// FastCGIAction passes the requests to a FastCGI server, like PHP-FPM, in the
+// nginx namespace.
+type FastCGIAction struct {
+	// Service name.
+	Service string `json:"service"`
+	// Port of the service. Defaults to 9000.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Root is the directory holding the scripts in the FastCGI server.
+	// Defaults to "/var/www/html".
+	// +optional
+	Root string `json:"root,omitempty"`
+	// Index is the script run for paths ending with a slash. Defaults to
+	// "index.php".
+	// +optional
+	Index string `json:"index,omitempty"`
+	// Script, relative to Root, runs every request, like the "/index.php"
+	// front controller of most PHP frameworks. When empty the script is
+	// taken from the request path.
+	// +optional
+	Script string `json:"script,omitempty"`
+	// Params are additional FastCGI params, like "APP_ENV": "production".
+	// +optional
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// ObjectStorageAction serves the objects of a bucket through its HTTP
+// endpoint. Only GET and HEAD requests are allowed.
+type ObjectStorageAction struct {
+	// Endpoint is the URL the location path is mapped to, like
+	// "https://my-bucket.s3.amazonaws.com/site/".
+	Endpoint string `json:"endpoint"`
+	// Signing signs the requests sent to the bucket, to serve private buckets.
+	// +optional
+	Signing *ObjectStorageSigning `json:"signing,omitempty"`
+}
+
+// ObjectStorageSigning signs the requests sent to a bucket with AWS Signature
+// Version 4, which is also supported by GCS with HMAC keys. Requests are
+// signed by a proxy sidecar.
+type ObjectStorageSigning struct {
+	// CredentialsSecret is the name of a Secret holding the
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY keys.
+	CredentialsSecret string `json:"credentialsSecret"`
+	// Region of the bucket. Defaults to "us-east-1".
+	// +optional
+	Region string `json:"region,omitempty"`
+	// Service name used in the signature. Defaults to "s3".
+	// +optional
+	Service string `json:"service,omitempty"`
+	// Image of the signing proxy sidecar. Defaults to
+	// "public.ecr.aws/aws-observability/aws-sigv4-proxy:1.0".
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// StaticAction serves the files of a ConfigMap, one file per key.
+type StaticAction struct {
+	// ConfigMap name.
+	ConfigMap string `json:"configMap"`
+}
+
+// RedirectAction redirects the requests to another URL.
+type RedirectAction struct {
+	// URL the requests are redirected to.
+	URL string `json:"url"`
+	// Code of the redirect response. Defaults to 302.
 	// +optional
-	TLSSecret *TLSSecret `json:"tlsSecret,omitempty`
-	// Template used to configure the nginx pod.
+	Code int32 `json:"code,omitempty"`
+}
+
+// ReturnAction responds with a fixed status code and body.
+type ReturnAction struct {
+	// Code of the response.
+	Code int32 `json:"code"`
+	// Body of the response.
+	// +optional
+	Body string `json:"body,omitempty"`
+}
+
+// NginxIngress describes the Ingress created for the nginx.
+type NginxIngress struct {
+	// Hosts routed to the nginx service. When empty all hosts are routed.
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+	// Path routed to the nginx service. Defaults to "/".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// IngressClassName selects the ingress controller, it is set in the
+	// kubernetes.io/ingress.class annotation.
+	// +optional
+	IngressClassName string `json:"ingressClassName,omitempty"`
+	// TLS terminates TLS for the hosts in the ingress controller.
+	// +optional
+	TLS *NginxIngressTLS `json:"tls,omitempty"`
+}
+
+// NginxIngressTLS is the TLS configuration of the Ingress.
+type NginxIngressTLS struct {
+	// Name of the Secret holding the certificate and key for the hosts.
+	SecretName string `json:"secretName"`
+}
+
+// NginxMetrics configures the metrics exporter sidecar.
+type NginxMetrics struct {
+	// Image of the exporter. Defaults to DefaultMetricsExporterImage.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// ServiceMonitor creates a Prometheus Operator ServiceMonitor scraping
+	// the exporter. Requires the ServiceMonitor CRD to be installed.
+	// +optional
+	ServiceMonitor *NginxServiceMonitor `json:"serviceMonitor,omitempty"`
+	// Upstreams adds a sidecar deriving the latency and the responses by
+	// status class of each upstream from the access log, which the
+	// stub_status page does not provide.
+	// +optional
+	Upstreams *NginxUpstreamMetrics `json:"upstreams,omitempty"`
+}
+
+// NginxUpstreamMetrics configures the sidecar exporting the metrics of the
+// upstreams, a prometheus-nginxlog-exporter receiving a dedicated access log
+// over syslog on localhost.
+type NginxUpstreamMetrics struct {
+	// Image of the exporter. Defaults to DefaultUpstreamMetricsImage.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Buckets are the upper bounds, in seconds, of the buckets of the
+	// latency histograms, like "0.1". Defaults to
+	// DefaultUpstreamMetricsBuckets.
+	// +optional
+	Buckets []string `json:"buckets,omitempty"`
+	// Resources of the sidecar.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// NginxServiceMonitor configures the ServiceMonitor created for the nginx.
+type NginxServiceMonitor struct {
+	// Interval between scrapes, like "30s". Defaults to the Prometheus one.
+	// +optional
+	Interval string `json:"interval,omitempty"`
+	// Labels added to the ServiceMonitor, usually the ones selected by the
+	// Prometheus instance.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type ConfigReloadStrategy string
+
+const (
+	// ConfigReloadRestart applies config changes by rolling out new pods.
+	// Changes made to the content of a ConfigMap are only picked up by pods
+	// created afterwards.
+	ConfigReloadRestart = ConfigReloadStrategy("Restart")
+	// ConfigReloadReload runs `nginx -s reload` in the running pods when the
+	// mounted config changes, including inline configs. Pods are only
+	// replaced when the pod spec changes.
+	ConfigReloadReload = ConfigReloadStrategy("Reload")
+)
+
+// CleanupPolicy controls what happens to the objects created for the nginx
+// when it is deleted.
+type CleanupPolicy struct {
+	// Retain lists the objects kept after the nginx is deleted. They are
+	// detached from the nginx instead of being garbage collected.
+	// +optional
+	Retain []CleanupObject `json:"retain,omitempty"`
+	// DrainSeconds is the time the pods keep running after the ingress and
+	// the service of the nginx are removed, so clients and external load
+	// balancers stop sending new connections before the pods go away.
+	// +optional
+	DrainSeconds int32 `json:"drainSeconds,omitempty"`
+}
+
+type CleanupObject string
+
+const (
+	// CleanupObjectWorkload is the workload running the nginx pods
+	CleanupObjectWorkload = CleanupObject("Workload")
+	// CleanupObjectService is the service of the nginx
+	CleanupObjectService = CleanupObject("Service")
+	// CleanupObjectIngress is the ingress of the nginx
+	CleanupObjectIngress = CleanupObject("Ingress")
+	// CleanupObjectPodDisruptionBudget is the pod disruption budget of the nginx
+	CleanupObjectPodDisruptionBudget = CleanupObject("PodDisruptionBudget")
+)
+
+type WorkloadKind string
+
+const (
+	// WorkloadKindDeployment runs nginx using a Deployment
+	WorkloadKindDeployment = WorkloadKind("Deployment")
+	// WorkloadKindRollout runs nginx using an Argo Rollouts Rollout. Requires the
+	// Rollout CRD to be installed in the cluster, falls back to a Deployment otherwise.
+	WorkloadKindRollout = WorkloadKind("Rollout")
+	// WorkloadKindStatefulSet runs nginx using a StatefulSet, which allows a
+	// cache volume to be claimed for each replica.
+	WorkloadKindStatefulSet = WorkloadKind("StatefulSet")
+	// WorkloadKindDaemonSet runs one nginx pod on each eligible node using a
+	// DaemonSet, usually along with HostNetwork or HostPorts.
+	WorkloadKindDaemonSet = WorkloadKind("DaemonSet")
+)
+
+// NginxRollout describes the progressive rollout of new nginx pods.
+type NginxRollout struct {
+	// Canary is the canary strategy used to roll out changes. With
+	// WorkloadKindDeployment the new pod template is rolled out through a
+	// canary Deployment, receiving the weight of each step as a share of
+	// the pods selected by the Service.
+	// +optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+	// CanaryPods is the number of pods started with a new pod template
+	// before the deployment is updated. The rest of the pods are only rolled
+	// out once they are ready and pass the CanaryCheck. Only supported with
+	// WorkloadKindDeployment.
+	// +optional
+	CanaryPods int32 `json:"canaryPods,omitempty"`
+	// CanaryCheck is a request the canary pods must answer as expected.
+	// +optional
+	CanaryCheck *CanaryCheck `json:"canaryCheck,omitempty"`
+}
+
+// CanaryCheck is an HTTP request sent by the operator to each canary pod.
+type CanaryCheck struct {
+	// Path requested. Defaults to /.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Port of the nginx container requested. Defaults to 80, or to 8080
+	// with Rootless.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Host header of the request.
+	// +optional
+	Host string `json:"host,omitempty"`
+	// ExpectedStatus is the status code of the expected response. Defaults
+	// to 200.
+	// +optional
+	ExpectedStatus int32 `json:"expectedStatus,omitempty"`
+}
+
+// CanaryStrategy is a list of steps executed in order when rolling out changes.
+type CanaryStrategy struct {
+	Steps []CanaryStep `json:"steps,omitempty"`
+}
+
+// CanaryStep is either a traffic weight change or a pause. When both fields
+// are set the weight is applied before the pause.
+type CanaryStep struct {
+	// Percentage of the traffic that should be routed to the new pods.
 	// +optional
-	PodTemplate NginxPodTemplateSpec
+	Weight *int32 `json:"weight,omitempty"`
+	// Pause duration in seconds. Zero pauses until the rollout is manually promoted.
+	// +optional
+	Pause *int32 `json:"pause,omitempty"`
 }
 
 type NginxPodTemplateSpec struct {
@@ -40,11 +1459,361 @@ type NginxPodTemplateSpec struct {
 	// Affinity to be set on the nginx pod.
 	// +optional
 	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Ports are additional ports exposed by the nginx container and the
+	// service, like the ones of stream {} proxies.
+	// +optional
+	Ports []NginxPort `json:"ports,omitempty"`
+	// Env are environment variables set on the nginx container.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// EnvFrom are sources of environment variables of the nginx container.
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+	// Volumes are additional volumes of the nginx pod.
+	// +optional
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+	// VolumeMounts are additional volume mounts of the nginx container.
+	// +optional
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// Containers are sidecar containers added to the nginx pod.
+	// +optional
+	Containers []corev1.Container `json:"containers,omitempty"`
+	// InitContainers are run before the nginx container starts.
+	// +optional
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+	// ImagePullSecrets are used to pull the images of the nginx pod.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// ServiceAccountName is the service account used to run the nginx pod.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// AutomountServiceAccountToken mounts the token of the service account
+	// in the nginx pod. Defaults to false, since nginx does not use the
+	// Kubernetes API.
+	// +optional
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+	// NodeSelector restricts the nodes the nginx pod can be scheduled on.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations of the nginx pod.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// TerminationGracePeriodSeconds is the time given to the nginx pod to
+	// shut down gracefully.
+	// +optional
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+	// SecurityContext of the nginx pod.
+	// +optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+	// HostNetwork runs the nginx pod in the network namespace of the node.
+	// +optional
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+	// HostPorts exposes the ports of the nginx container on the node.
+	// +optional
+	HostPorts bool `json:"hostPorts,omitempty"`
+	// PriorityClassName is the PriorityClass of the nginx pod.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// SchedulerName is the scheduler of the nginx pod. Defaults to the
+	// default scheduler of the cluster.
+	// +optional
+	SchedulerName string `json:"schedulerName,omitempty"`
+	// RuntimeClassName is the RuntimeClass of the nginx pod, like a
+	// sandboxed runtime. Defaults to the default runtime of the cluster.
+	// +optional
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+	// TopologySpreadConstraints spread the nginx pods across nodes, zones
+	// or other topology domains.
+	// +optional
+	TopologySpreadConstraints []TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// Labels added to the nginx pod, besides the ones of spec.labels.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the nginx pod, besides the ones of
+	// spec.annotations.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// TopologySpreadConstraint limits how unevenly the nginx pods are spread
+// across the domains of a topology key.
+type TopologySpreadConstraint struct {
+	// MaxSkew is the maximum difference between the number of matching pods
+	// in any two domains.
+	MaxSkew int32 `json:"maxSkew"`
+	// TopologyKey is the node label whose values are the domains, like
+	// topology.kubernetes.io/zone.
+	TopologyKey string `json:"topologyKey"`
+	// WhenUnsatisfiable is what the scheduler does with a pod that would
+	// exceed the skew: DoNotSchedule or ScheduleAnyway.
+	WhenUnsatisfiable UnsatisfiableConstraintAction `json:"whenUnsatisfiable"`
+	// LabelSelector selects the pods counted in each domain. Defaults to
+	// the nginx pods of the instance.
+	// +optional
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+// UnsatisfiableConstraintAction is what the scheduler does with a pod that
+// does not satisfy a topology spread constraint.
+type UnsatisfiableConstraintAction string
+
+const (
+	// DoNotSchedule keeps the pod pending
+	DoNotSchedule = UnsatisfiableConstraintAction("DoNotSchedule")
+	// ScheduleAnyway schedules the pod, preferring the domains reducing
+	// the skew
+	ScheduleAnyway = UnsatisfiableConstraintAction("ScheduleAnyway")
+)
+
+// NginxPort is a port exposed by the nginx container and the service.
+type NginxPort struct {
+	// Name of the port, must be unique within the nginx.
+	Name string `json:"name"`
+	// ContainerPort is the port number nginx listens on, also used as the
+	// service port.
+	ContainerPort int32 `json:"containerPort"`
+	// Protocol of the port, TCP or UDP. Defaults to TCP.
+	// +optional
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+	// AppProtocol served on the port, like http2 or grpc, for the probes
+	// and the service port name.
+	// +optional
+	AppProtocol AppProtocol `json:"appProtocol,omitempty"`
 }
 
+// AppProtocol is the application protocol served on a port.
+type AppProtocol string
+
+const (
+	// AppProtocolHTTP serves HTTP/1.1, and HTTP/2 negotiated over TLS
+	AppProtocolHTTP = AppProtocol("http")
+	// AppProtocolHTTP2 serves cleartext HTTP/2 (h2c) only
+	AppProtocolHTTP2 = AppProtocol("http2")
+	// AppProtocolGRPC serves gRPC over HTTP/2
+	AppProtocolGRPC = AppProtocol("grpc")
+)
+
+// NginxStatus is the observed state of the nginx, set by the operator.
 type NginxStatus struct {
-	Pods     []NginxPod     `json:"pods,omitempty"`
+	// Pods are the nginx pods.
+	Pods []NginxPod `json:"pods,omitempty"`
+	// Services are the services of the nginx.
 	Services []NginxService `json:"services,omitempty"`
+	// Addresses are the load balancer addresses the spec.dns hostnames
+	// point to, once allocated.
+	// +optional
+	Addresses []NginxAddress `json:"addresses,omitempty"`
+	// Service describes the load balancer of the service of the nginx, when
+	// it is of type LoadBalancer.
+	// +optional
+	Service *NginxServiceStatus `json:"service,omitempty"`
+	// Endpoints are the addresses of the ready nginx pods published for
+	// spec.endpoints.
+	// +optional
+	Endpoints *NginxEndpointsStatus `json:"endpoints,omitempty"`
+	// VerticalAutoscaler is the state of the VerticalPodAutoscaler created
+	// for spec.autoscaling.vertical.
+	// +optional
+	VerticalAutoscaler *NginxVerticalAutoscalerStatus `json:"verticalAutoscaler,omitempty"`
+	// LastReconcileTime is the last time the nginx was successfully
+	// reconciled, with a resolution of one minute.
+	// +optional
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+	// Conditions are the latest observations of the nginx state.
+	// +optional
+	Conditions []NginxCondition `json:"conditions,omitempty"`
+	// CachePurges are the latest cache purges requested through the
+	// nginx.tsuru.io/purge-cache annotation, oldest first.
+	// +optional
+	CachePurges []NginxCachePurge `json:"cachePurges,omitempty"`
+	// CertificateRevision identifies the content of the certificate issued
+	// through spec.certificates. A new revision replaces the pods.
+	// +optional
+	CertificateRevision string `json:"certificateRevision,omitempty"`
+	// ExternalSecretsRevision identifies the content of the secrets
+	// materialized through spec.externalSecrets. A new revision replaces the
+	// pods.
+	// +optional
+	ExternalSecretsRevision string `json:"externalSecretsRevision,omitempty"`
+	// ConfigTemplateRevision identifies the content rendered from
+	// spec.configTemplate. A new revision replaces the pods, unless the
+	// config is reloaded in place.
+	// +optional
+	ConfigTemplateRevision string `json:"configTemplateRevision,omitempty"`
+	// Deployment mirrors the rollout state of the generated Deployment. It
+	// is not set for other workload kinds.
+	// +optional
+	Deployment *NginxDeploymentStatus `json:"deployment,omitempty"`
+	// Canary describes the rollout of a new pod template through the
+	// canary Deployment created for spec.rollout.canary.
+	// +optional
+	Canary *NginxCanaryStatus `json:"canary,omitempty"`
+	// Profile is the name of the profile of spec.profiles merged into the
+	// spec in the last reconcile.
+	// +optional
+	Profile string `json:"profile,omitempty"`
+
+	// CertificateNotAfter is when the certificate of spec.tlsSecret
+	// expires, read in the last reconcile.
+	// +optional
+	CertificateNotAfter *metav1.Time `json:"certificateNotAfter,omitempty"`
+	// PendingApply describes the changes waiting for approval with the
+	// Manual apply mode.
+	// +optional
+	PendingApply *NginxPendingApply `json:"pendingApply,omitempty"`
+	// AppliedRevision identifies the spec last applied with the Manual
+	// apply mode.
+	// +optional
+	AppliedRevision string `json:"appliedRevision,omitempty"`
+	// SpecRevision is the revision of the spec last reconciled successfully.
+	// +optional
+	SpecRevision int64 `json:"specRevision,omitempty"`
+	// SpecHistory are the revisions of the spec kept to roll back to,
+	// newest first.
+	// +optional
+	SpecHistory []NginxSpecRevision `json:"specHistory,omitempty"`
+}
+
+// NginxSpecRevision is a spec of the history.
+type NginxSpecRevision struct {
+	// Revision number, increased each time a spec is reconciled
+	// successfully for the first time or again after other ones.
+	Revision int64 `json:"revision"`
+	// Name of the ControllerRevision holding the spec.
+	Name string `json:"name"`
+	// Image of the nginx container of the spec.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// NginxPendingApply describes the changes to the objects of the nginx
+// waiting for approval.
+type NginxPendingApply struct {
+	// Revision identifies the spec whose changes are pending. Setting the
+	// nginx.tsuru.io/approve-apply annotation to it applies them.
+	Revision string `json:"revision"`
+	// Changes summarizes the objects created, updated or deleted by the
+	// revision, with the fields updated.
+	Changes []string `json:"changes"`
+	// Time the changes were first seen.
+	Time metav1.Time `json:"time"`
+}
+
+// NginxDeploymentStatus describes the rollout of the generated Deployment.
+type NginxDeploymentStatus struct {
+	// UpdatedReplicas is the number of pods running the latest pod template.
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+	// ReadyReplicas is the number of ready pods.
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// UnavailableReplicas is the number of pods still needed for the
+	// Deployment to be fully available.
+	UnavailableReplicas int32 `json:"unavailableReplicas"`
+	// RevisionHash is the pod template hash of the latest revision.
+	// +optional
+	RevisionHash string `json:"revisionHash,omitempty"`
+	// LastRolloutTime is when the latest revision started rolling out.
+	// +optional
+	LastRolloutTime *metav1.Time `json:"lastRolloutTime,omitempty"`
+}
+
+type NginxCanaryPhase string
+
+const (
+	// NginxCanaryProgressing is set while the canary Deployment rolls out
+	// the weight of the current step.
+	NginxCanaryProgressing = NginxCanaryPhase("Progressing")
+	// NginxCanaryPaused is set while the current step pauses.
+	NginxCanaryPaused = NginxCanaryPhase("Paused")
+	// NginxCanaryPromoting is set once all the steps are done, while the
+	// new pod template is rolled out to the Deployment.
+	NginxCanaryPromoting = NginxCanaryPhase("Promoting")
+	// NginxCanaryFailed is set when the canary pods failed and were rolled
+	// back. It is kept until the pod template changes again.
+	NginxCanaryFailed = NginxCanaryPhase("Failed")
+)
+
+// NginxCanaryStatus describes the rollout of a pod template through the
+// canary Deployment.
+type NginxCanaryStatus struct {
+	// TemplateHash identifies the pod template rolled out.
+	TemplateHash string `json:"templateHash"`
+	// Phase of the rollout.
+	Phase NginxCanaryPhase `json:"phase"`
+	// Step is the index of the current step in spec.rollout.canary.steps.
+	Step int32 `json:"step"`
+	// PauseStartTime is when the canary pods of the current step were
+	// ready and its pause started.
+	// +optional
+	PauseStartTime *metav1.Time `json:"pauseStartTime,omitempty"`
+	// Weight is the percentage of the pods running the new pod template.
+	Weight int32 `json:"weight"`
+	// PromoteRequest is the value of the nginx.tsuru.io/promote-canary
+	// annotation when the current step started. Changing it promotes a
+	// step paused indefinitely.
+	// +optional
+	PromoteRequest string `json:"promoteRequest,omitempty"`
+	// Message is a human readable description of the phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// NginxCachePurge describes a cache purge of the nginx pods.
+type NginxCachePurge struct {
+	// ID is the value of the annotation that requested the purge.
+	ID string `json:"id"`
+	// Time the pods started being replaced.
+	Time metav1.Time `json:"time"`
+}
+
+type NginxConditionType string
+
+const (
+	// NginxConditionConfigValid reports the result of the config validation
+	// run before rolling out changes.
+	NginxConditionConfigValid = NginxConditionType("ConfigValid")
+	// NginxConditionTerminatingBlocked is set when the deletion of a protected
+	// nginx is waiting for confirmation.
+	NginxConditionTerminatingBlocked = NginxConditionType("TerminatingBlocked")
+	// NginxConditionBlockedByPolicy is set when the pods of the nginx would
+	// be rejected by the policies of its namespace.
+	NginxConditionBlockedByPolicy = NginxConditionType("BlockedByPolicy")
+	// NginxConditionQuotaLimited is set when the replicas of the nginx are
+	// clamped to the ones fitting in the resource quotas of its namespace.
+	NginxConditionQuotaLimited = NginxConditionType("QuotaLimited")
+	// NginxConditionCanaryVerified reports the result of the canary pods
+	// started before rolling out a new pod template.
+	NginxConditionCanaryVerified = NginxConditionType("CanaryVerified")
+	// NginxConditionProgressing mirrors the Progressing condition of the
+	// generated Deployment, with the same reasons.
+	NginxConditionProgressing = NginxConditionType("Progressing")
+	// NginxConditionPaused is set when the reconciliation of the nginx is
+	// paused through spec.paused.
+	NginxConditionPaused = NginxConditionType("Paused")
+	// NginxConditionLoadBalancerReady reports whether the load balancer of a
+	// LoadBalancer service has its external addresses, and whether their
+	// allocation is stuck.
+	NginxConditionLoadBalancerReady = NginxConditionType("LoadBalancerReady")
+	// NginxConditionDegraded is set when the spec of the nginx is out of the
+	// guardrails of the operator, reporting whether it was clamped or
+	// rejected.
+	NginxConditionDegraded = NginxConditionType("Degraded")
+)
+
+// NginxCondition describes the state of an aspect of the nginx.
+type NginxCondition struct {
+	// Type of the condition.
+	Type NginxConditionType `json:"type"`
+	// Status of the condition, one of True, False or Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+	// Last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Machine readable reason for the last transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Human readable message with details about the last transition.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 type NginxPod struct {
@@ -63,14 +1832,171 @@ type NginxService struct {
 	ServiceIP string `json:"serviceIP"`
 }
 
+// NginxServiceStatus describes the load balancer of a LoadBalancer service.
+type NginxServiceStatus struct {
+	// ExternalAddresses are the addresses allocated to the load balancer,
+	// empty while it is pending.
+	// +optional
+	ExternalAddresses []NginxAddress `json:"externalAddresses,omitempty"`
+}
+
+// NginxEndpointsStatus are the addresses of the ready nginx pods.
+type NginxEndpointsStatus struct {
+	// Addresses of the ready pods, sorted by IP.
+	// +optional
+	Addresses []NginxEndpoint `json:"addresses,omitempty"`
+	// ConfigMap the addresses are also written to, if any.
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+}
+
+// NginxEndpoint is the address of a ready nginx pod.
+type NginxEndpoint struct {
+	// Pod is the name of the pod.
+	Pod string `json:"pod"`
+	// IP of the pod, the one of its node when using the host network.
+	IP string `json:"ip"`
+	// NodeName is the node running the pod.
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+	// Ports of the nginx container.
+	Ports []NginxEndpointPort `json:"ports"`
+}
+
+// NginxEndpointPort is a port of the nginx container.
+type NginxEndpointPort struct {
+	// Name of the port, like http or https.
+	Name string `json:"name"`
+	// Port number.
+	Port int32 `json:"port"`
+	// Protocol of the port.
+	Protocol corev1.Protocol `json:"protocol"`
+}
+
+// NginxVerticalAutoscalerStatus is the state of the VerticalPodAutoscaler
+// of the nginx.
+type NginxVerticalAutoscalerStatus struct {
+	// Name of the VerticalPodAutoscaler.
+	Name string `json:"name"`
+	// Recommendation of the resources of the nginx container, missing until
+	// the recommender computes one.
+	// +optional
+	Recommendation *NginxResourceRecommendation `json:"recommendation,omitempty"`
+}
+
+// NginxResourceRecommendation are the resources recommended for a container
+// by the VerticalPodAutoscaler.
+type NginxResourceRecommendation struct {
+	// Target are the recommended resources.
+	Target corev1.ResourceList `json:"target,omitempty"`
+	// LowerBound are the lowest resources the container should get.
+	// +optional
+	LowerBound corev1.ResourceList `json:"lowerBound,omitempty"`
+	// UpperBound are the highest resources the container should get.
+	// +optional
+	UpperBound corev1.ResourceList `json:"upperBound,omitempty"`
+	// UncappedTarget are the recommended resources before applying the
+	// minAllowed and maxAllowed bounds.
+	// +optional
+	UncappedTarget corev1.ResourceList `json:"uncappedTarget,omitempty"`
+}
+
+// NginxAddress is a load balancer address of the nginx.
+type NginxAddress struct {
+	// IP of the load balancer, published as A or AAAA records.
+	// +optional
+	IP string `json:"ip,omitempty"`
+	// Hostname of the load balancer, published as CNAME records.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+}
+
 // ConfigRef is a reference to a config object.
 type ConfigRef struct {
-	// Name of the config object.
+	// Name of the config object. Optional when Sources are set, keeping the
+	// nginx.conf of the image, and not used by inline configs.
 	Name string `json:"name"`
 	// Kind of the config object. Defaults to ConfigKindConfigMap.
 	Kind ConfigKind `json:"kind"`
 	// Optional value used by some ConfigKinds.
 	Value string `json:"value"`
+	// Mount is how the config is mounted in /etc/nginx. Defaults to
+	// ConfigMountFile, or to ConfigMountDirectory with ConfigReloadReload.
+	// +optional
+	Mount ConfigMount `json:"mount,omitempty"`
+	// Sources are ConfigMaps and Secrets whose keys are projected, in
+	// order, as files of /etc/nginx/conf.d. A file of a source replaces the
+	// one of the same name of the sources before it, so shared base configs
+	// can be combined with per-instance overrides.
+	// +optional
+	Sources []ConfigSource `json:"sources,omitempty"`
+}
+
+// ConfigSource is a ConfigMap or a Secret projected into /etc/nginx/conf.d.
+// Exactly one of ConfigMap or Secret must be set.
+type ConfigSource struct {
+	// ConfigMap whose keys are projected.
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+	// Secret whose keys are projected.
+	// +optional
+	Secret string `json:"secret,omitempty"`
+}
+
+type ConfigMount string
+
+const (
+	// ConfigMountFile mounts only nginx.conf over the one of the image,
+	// keeping the other files of /etc/nginx, like mime.types. Files mounted
+	// this way are not updated in running pods.
+	ConfigMountFile = ConfigMount("File")
+	// ConfigMountDirectory mounts the whole config object at /etc/nginx,
+	// replacing the files of the image.
+	ConfigMountDirectory = ConfigMount("Directory")
+)
+
+// NginxConfigTemplate is the source of a Go template rendered into
+// nginx.conf. Exactly one of ConfigMap or Inline must be set.
+type NginxConfigTemplate struct {
+	// ConfigMap holding the template.
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+	// Key of the ConfigMap holding the template. Defaults to nginx.conf.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// Inline is the template itself.
+	// +optional
+	Inline string `json:"inline,omitempty"`
+}
+
+// NginxConfigFile is an auxiliary config file read from a ConfigMap.
+type NginxConfigFile struct {
+	// Name of the file in /etc/nginx, like mime.types or uwsgi_params.
+	Name string `json:"name"`
+	// ConfigMap holding the content of the file.
+	ConfigMap string `json:"configMap"`
+	// Key of the ConfigMap holding the content of the file. Defaults to Name.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// NginxExtraFile is a file read from a key of a ConfigMap or a Secret.
+type NginxExtraFile struct {
+	// Path of the file, under /etc/nginx, like /etc/nginx/htpasswd/users.
+	Path string `json:"path"`
+	// ConfigMap holding the content of the file.
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+	// Secret holding the content of the file.
+	// +optional
+	Secret string `json:"secret,omitempty"`
+	// Key of the ConfigMap or Secret holding the content of the file.
+	// Defaults to the file name of Path.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// Mode bits of the file. Defaults to 0644.
+	// +optional
+	Mode *int32 `json:"mode,omitempty"`
 }
 
 type ConfigKind string
@@ -78,8 +2004,10 @@ type ConfigKind string
 const (
 	// ConfigKindConfigMap is a Kind of configuration that points to a configmap
 	ConfigKindConfigMap = ConfigKind("ConfigMap")
-	// ConfigKindInline is a kinda of configuration that is setup as a annotation on the Pod
-	// and is inject as a file on the container using the Downward API.
+	// ConfigKindInline is a Kind of configuration whose Value is written by
+	// the operator into the <name>-inline-config ConfigMap, mounted like the
+	// ConfigMap ones. Changes to it replace the pods, unless reloaded in
+	// place.
 	ConfigKindInline = ConfigKind("Inline")
 )
 
@@ -103,6 +2031,94 @@ type TLSSecret struct {
 	CertificatePath string
 }
 
+// NginxCertificates describes the cert-manager Certificate requested for the
+// nginx.
+type NginxCertificates struct {
+	// IssuerRef is the cert-manager issuer of the certificate.
+	IssuerRef CertificateIssuerRef `json:"issuerRef"`
+	// DNSNames of the certificate.
+	DNSNames []string `json:"dnsNames"`
+	// SecretName is the Secret where cert-manager stores the certificate.
+	// Defaults to <name>-tls.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// NginxExternalSecret describes the External Secrets ExternalSecret
+// materializing a Secret used by the nginx.
+type NginxExternalSecret struct {
+	// Name of the materialized Secret, referenced by spec.tlsSecret or
+	// spec.extraFiles. The ExternalSecret has the same name.
+	Name string `json:"name"`
+	// SecretStoreRef is the store the data is read from.
+	SecretStoreRef ExternalSecretStoreRef `json:"secretStoreRef"`
+	// Data are the keys of the Secret and where their values are read from.
+	Data []ExternalSecretData `json:"data"`
+	// RefreshInterval is how often the data is read from the store again,
+	// like 15m. Defaults to 1h.
+	// +optional
+	RefreshInterval string `json:"refreshInterval,omitempty"`
+}
+
+// ExternalSecretStoreRef references an External Secrets store.
+type ExternalSecretStoreRef struct {
+	// Name of the store.
+	Name string `json:"name"`
+	// Kind of the store, SecretStore or ClusterSecretStore. Defaults to
+	// SecretStore.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// ExternalSecretData is a key of a materialized Secret.
+type ExternalSecretData struct {
+	// SecretKey is the key of the Secret, like tls.crt.
+	SecretKey string `json:"secretKey"`
+	// RemoteRef is where the value is read from in the store.
+	RemoteRef ExternalSecretRemoteRef `json:"remoteRef"`
+}
+
+// ExternalSecretRemoteRef references a value of an External Secrets store.
+type ExternalSecretRemoteRef struct {
+	// Key of the value in the store, like the path of a Vault secret.
+	Key string `json:"key"`
+	// Property of the value holding the data, when it is structured like
+	// the fields of a Vault secret.
+	// +optional
+	Property string `json:"property,omitempty"`
+}
+
+// CertificateIssuerRef references a cert-manager issuer.
+type CertificateIssuerRef struct {
+	// Name of the issuer.
+	Name string `json:"name"`
+	// Kind of the issuer, Issuer or ClusterIssuer. Defaults to Issuer.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Group of the issuer. Defaults to cert-manager.io.
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// FlaggerSpec configures the objects required by Flagger to run canary
+// analysis against the nginx deployment.
+type FlaggerSpec struct {
+	// Address of the Prometheus server queried by the generated metric templates.
+	PrometheusAddress string `json:"prometheusAddress"`
+	// Additional metric templates to be created for the canary analysis.
+	// +optional
+	MetricTemplates []FlaggerMetricTemplate `json:"metricTemplates,omitempty"`
+}
+
+// FlaggerMetricTemplate is a Prometheus query used by Flagger during the canary
+// analysis. The query may use the Flagger template variables, e.g. {{ target }}.
+type FlaggerMetricTemplate struct {
+	// Name of the metric template, prefixed by the Nginx name when created.
+	Name string `json:"name"`
+	// Prometheus query returning a single value.
+	Query string `json:"query"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 type NginxList struct {
@@ -110,3 +2126,70 @@ type NginxList struct {
 	metav1.ListMeta `json:"metadata"`
 	Items           []Nginx `json:"items"`
 }
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NginxFleetStatus summarizes the nginx instances handled by the operator,
+// so dashboards do not need to read every nginx. It is cluster-scoped and
+// written by the operator, named after its --fleet-status flag.
+type NginxFleetStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Status            NginxFleetSummary `json:"status,omitempty"`
+}
+
+// NginxFleetSummary is the state of the nginx instances of the fleet.
+type NginxFleetSummary struct {
+	// Instances is the number of nginx instances handled by the operator.
+	Instances int32 `json:"instances"`
+	// UnhealthyInstances is the number of instances failing to reconcile,
+	// stale, with an invalid config, blocked by a policy or with
+	// unavailable pods.
+	UnhealthyInstances int32 `json:"unhealthyInstances"`
+	// Unhealthy lists the unhealthy instances, up to 100.
+	// +optional
+	Unhealthy []NginxFleetInstance `json:"unhealthy,omitempty"`
+	// Images are the nginx images in use, most used first.
+	// +optional
+	Images []NginxFleetImage `json:"images,omitempty"`
+	// ExpiringCertificates lists the certificates expiring within the
+	// threshold of the operator, up to 100, soonest first.
+	// +optional
+	ExpiringCertificates []NginxFleetCertificate `json:"expiringCertificates,omitempty"`
+	// LastUpdateTime is when the summary was written.
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// NginxFleetInstance is an unhealthy nginx instance.
+type NginxFleetInstance struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Reason the instance is unhealthy, like ReconcileFailed or
+	// PodsUnavailable.
+	Reason string `json:"reason"`
+}
+
+// NginxFleetImage is an nginx image and the instances using it.
+type NginxFleetImage struct {
+	Image     string `json:"image"`
+	Instances int32  `json:"instances"`
+}
+
+// NginxFleetCertificate is the certificate of an nginx instance.
+type NginxFleetCertificate struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Secret holding the certificate.
+	Secret string `json:"secret"`
+	// NotAfter is when the certificate expires.
+	NotAfter metav1.Time `json:"notAfter"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type NginxFleetStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []NginxFleetStatus `json:"items"`
+}
@@ -5,13 +5,125 @@
 package v1alpha1
 
 import (
+	apps_v1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	rbac_v1 "k8s.io/api/rbac/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryCheck) DeepCopyInto(out *CanaryCheck) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryCheck.
+func (in *CanaryCheck) DeepCopy() *CanaryCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStep) DeepCopyInto(out *CanaryStep) {
+	*out = *in
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Pause != nil {
+		in, out := &in.Pause, &out.Pause
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStep.
+func (in *CanaryStep) DeepCopy() *CanaryStep {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStrategy) DeepCopyInto(out *CanaryStrategy) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]CanaryStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStrategy.
+func (in *CanaryStrategy) DeepCopy() *CanaryStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateIssuerRef) DeepCopyInto(out *CertificateIssuerRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateIssuerRef.
+func (in *CertificateIssuerRef) DeepCopy() *CertificateIssuerRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateIssuerRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupPolicy) DeepCopyInto(out *CleanupPolicy) {
+	*out = *in
+	if in.Retain != nil {
+		in, out := &in.Retain, &out.Retain
+		*out = make([]CleanupObject, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupPolicy.
+func (in *CleanupPolicy) DeepCopy() *CleanupPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigRef) DeepCopyInto(out *ConfigRef) {
 	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]ConfigSource, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -25,6 +137,147 @@ func (in *ConfigRef) DeepCopy() *ConfigRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigSource) DeepCopyInto(out *ConfigSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigSource.
+func (in *ConfigSource) DeepCopy() *ConfigSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalSecretData) DeepCopyInto(out *ExternalSecretData) {
+	*out = *in
+	out.RemoteRef = in.RemoteRef
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalSecretData.
+func (in *ExternalSecretData) DeepCopy() *ExternalSecretData {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalSecretData)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalSecretRemoteRef) DeepCopyInto(out *ExternalSecretRemoteRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalSecretRemoteRef.
+func (in *ExternalSecretRemoteRef) DeepCopy() *ExternalSecretRemoteRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalSecretRemoteRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalSecretStoreRef) DeepCopyInto(out *ExternalSecretStoreRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalSecretStoreRef.
+func (in *ExternalSecretStoreRef) DeepCopy() *ExternalSecretStoreRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalSecretStoreRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FastCGIAction) DeepCopyInto(out *FastCGIAction) {
+	*out = *in
+	if in.Params != nil {
+		in, out := &in.Params, &out.Params
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FastCGIAction.
+func (in *FastCGIAction) DeepCopy() *FastCGIAction {
+	if in == nil {
+		return nil
+	}
+	out := new(FastCGIAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlaggerMetricTemplate) DeepCopyInto(out *FlaggerMetricTemplate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlaggerMetricTemplate.
+func (in *FlaggerMetricTemplate) DeepCopy() *FlaggerMetricTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(FlaggerMetricTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlaggerSpec) DeepCopyInto(out *FlaggerSpec) {
+	*out = *in
+	if in.MetricTemplates != nil {
+		in, out := &in.MetricTemplates, &out.MetricTemplates
+		*out = make([]FlaggerMetricTemplate, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlaggerSpec.
+func (in *FlaggerSpec) DeepCopy() *FlaggerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FlaggerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocationBandwidth) DeepCopyInto(out *LocationBandwidth) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocationBandwidth.
+func (in *LocationBandwidth) DeepCopy() *LocationBandwidth {
+	if in == nil {
+		return nil
+	}
+	out := new(LocationBandwidth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Nginx) DeepCopyInto(out *Nginx) {
 	*out = *in
@@ -54,154 +307,2402 @@ func (in *Nginx) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NginxList) DeepCopyInto(out *NginxList) {
+func (in *NginxAddress) DeepCopyInto(out *NginxAddress) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]Nginx, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxList.
-func (in *NginxList) DeepCopy() *NginxList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxAddress.
+func (in *NginxAddress) DeepCopy() *NginxAddress {
 	if in == nil {
 		return nil
 	}
-	out := new(NginxList)
+	out := new(NginxAddress)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *NginxList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxArgs) DeepCopyInto(out *NginxArgs) {
+	*out = *in
+	if in.Globals != nil {
+		in, out := &in.Globals, &out.Globals
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
-	return nil
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxArgs.
+func (in *NginxArgs) DeepCopy() *NginxArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxArgs)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NginxPod) DeepCopyInto(out *NginxPod) {
+func (in *NginxAuth) DeepCopyInto(out *NginxAuth) {
 	*out = *in
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(NginxExternalAuth)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxPod.
-func (in *NginxPod) DeepCopy() *NginxPod {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxAuth.
+func (in *NginxAuth) DeepCopy() *NginxAuth {
 	if in == nil {
 		return nil
 	}
-	out := new(NginxPod)
+	out := new(NginxAuth)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NginxPodTemplateSpec) DeepCopyInto(out *NginxPodTemplateSpec) {
+func (in *NginxAutoscaling) DeepCopyInto(out *NginxAutoscaling) {
 	*out = *in
-	in.Resources.DeepCopyInto(&out.Resources)
-	if in.Affinity != nil {
-		in, out := &in.Affinity, &out.Affinity
-		*out = new(v1.Affinity)
+	if in.Vertical != nil {
+		in, out := &in.Vertical, &out.Vertical
+		*out = new(NginxVerticalAutoscaling)
 		(*in).DeepCopyInto(*out)
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxPodTemplateSpec.
-func (in *NginxPodTemplateSpec) DeepCopy() *NginxPodTemplateSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxAutoscaling.
+func (in *NginxAutoscaling) DeepCopy() *NginxAutoscaling {
 	if in == nil {
 		return nil
 	}
-	out := new(NginxPodTemplateSpec)
+	out := new(NginxAutoscaling)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NginxService) DeepCopyInto(out *NginxService) {
+func (in *NginxCPUShedding) DeepCopyInto(out *NginxCPUShedding) {
 	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxService.
-func (in *NginxService) DeepCopy() *NginxService {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCPUShedding.
+func (in *NginxCPUShedding) DeepCopy() *NginxCPUShedding {
 	if in == nil {
 		return nil
 	}
-	out := new(NginxService)
+	out := new(NginxCPUShedding)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NginxSpec) DeepCopyInto(out *NginxSpec) {
+func (in *NginxCache) DeepCopyInto(out *NginxCache) {
 	*out = *in
-	if in.Replicas != nil {
-		in, out := &in.Replicas, &out.Replicas
-		*out = new(int32)
-		**out = **in
-	}
-	if in.Config != nil {
-		in, out := &in.Config, &out.Config
-		*out = new(ConfigRef)
-		**out = **in
+	if in.EmptyDir != nil {
+		in, out := &in.EmptyDir, &out.EmptyDir
+		*out = new(v1.EmptyDirVolumeSource)
+		(*in).DeepCopyInto(*out)
 	}
-	if in.TLSSecret != nil {
-		in, out := &in.TLSSecret, &out.TLSSecret
-		*out = new(TLSSecret)
-		**out = **in
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(NginxCacheClaim)
+		(*in).DeepCopyInto(*out)
 	}
-	in.PodTemplate.DeepCopyInto(&out.PodTemplate)
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSpec.
-func (in *NginxSpec) DeepCopy() *NginxSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCache.
+func (in *NginxCache) DeepCopy() *NginxCache {
 	if in == nil {
 		return nil
 	}
-	out := new(NginxSpec)
+	out := new(NginxCache)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NginxStatus) DeepCopyInto(out *NginxStatus) {
+func (in *NginxCacheClaim) DeepCopyInto(out *NginxCacheClaim) {
 	*out = *in
-	if in.Pods != nil {
-		in, out := &in.Pods, &out.Pods
-		*out = make([]NginxPod, len(*in))
-		copy(*out, *in)
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
 	}
-	if in.Services != nil {
-		in, out := &in.Services, &out.Services
-		*out = make([]NginxService, len(*in))
+	out.Size = in.Size.DeepCopy()
+	if in.AccessModes != nil {
+		in, out := &in.AccessModes, &out.AccessModes
+		*out = make([]v1.PersistentVolumeAccessMode, len(*in))
 		copy(*out, *in)
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxStatus.
-func (in *NginxStatus) DeepCopy() *NginxStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCacheClaim.
+func (in *NginxCacheClaim) DeepCopy() *NginxCacheClaim {
 	if in == nil {
 		return nil
 	}
-	out := new(NginxStatus)
+	out := new(NginxCacheClaim)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TLSSecret) DeepCopyInto(out *TLSSecret) {
+func (in *NginxCachePolicy) DeepCopyInto(out *NginxCachePolicy) {
 	*out = *in
-	return
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]NginxCacheZone, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCachePolicy.
+func (in *NginxCachePolicy) DeepCopy() *NginxCachePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxCachePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxCachePurge) DeepCopyInto(out *NginxCachePurge) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCachePurge.
+func (in *NginxCachePurge) DeepCopy() *NginxCachePurge {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxCachePurge)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxCacheValid) DeepCopyInto(out *NginxCacheValid) {
+	*out = *in
+	if in.Codes != nil {
+		in, out := &in.Codes, &out.Codes
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCacheValid.
+func (in *NginxCacheValid) DeepCopy() *NginxCacheValid {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxCacheValid)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxCacheZone) DeepCopyInto(out *NginxCacheZone) {
+	*out = *in
+	if in.Valid != nil {
+		in, out := &in.Valid, &out.Valid
+		*out = make([]NginxCacheValid, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Bypass != nil {
+		in, out := &in.Bypass, &out.Bypass
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NoCache != nil {
+		in, out := &in.NoCache, &out.NoCache
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UseStale != nil {
+		in, out := &in.UseStale, &out.UseStale
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCacheZone.
+func (in *NginxCacheZone) DeepCopy() *NginxCacheZone {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxCacheZone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxCanaryStatus) DeepCopyInto(out *NginxCanaryStatus) {
+	*out = *in
+	if in.PauseStartTime != nil {
+		in, out := &in.PauseStartTime, &out.PauseStartTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCanaryStatus.
+func (in *NginxCanaryStatus) DeepCopy() *NginxCanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxCanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxCertificates) DeepCopyInto(out *NginxCertificates) {
+	*out = *in
+	out.IssuerRef = in.IssuerRef
+	if in.DNSNames != nil {
+		in, out := &in.DNSNames, &out.DNSNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCertificates.
+func (in *NginxCertificates) DeepCopy() *NginxCertificates {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxCertificates)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxCondition) DeepCopyInto(out *NginxCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxCondition.
+func (in *NginxCondition) DeepCopy() *NginxCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxConfigFile) DeepCopyInto(out *NginxConfigFile) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxConfigFile.
+func (in *NginxConfigFile) DeepCopy() *NginxConfigFile {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxConfigFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxConfigTemplate) DeepCopyInto(out *NginxConfigTemplate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxConfigTemplate.
+func (in *NginxConfigTemplate) DeepCopy() *NginxConfigTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxConfigTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxDNS) DeepCopyInto(out *NginxDNS) {
+	*out = *in
+	if in.Hostnames != nil {
+		in, out := &in.Hostnames, &out.Hostnames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxDNS.
+func (in *NginxDNS) DeepCopy() *NginxDNS {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxDNS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxDeploymentStatus) DeepCopyInto(out *NginxDeploymentStatus) {
+	*out = *in
+	if in.LastRolloutTime != nil {
+		in, out := &in.LastRolloutTime, &out.LastRolloutTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxDeploymentStatus.
+func (in *NginxDeploymentStatus) DeepCopy() *NginxDeploymentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxDeploymentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxEndpoint) DeepCopyInto(out *NginxEndpoint) {
+	*out = *in
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]NginxEndpointPort, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxEndpoint.
+func (in *NginxEndpoint) DeepCopy() *NginxEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxEndpointPort) DeepCopyInto(out *NginxEndpointPort) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxEndpointPort.
+func (in *NginxEndpointPort) DeepCopy() *NginxEndpointPort {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxEndpointPort)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxEndpoints) DeepCopyInto(out *NginxEndpoints) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxEndpoints.
+func (in *NginxEndpoints) DeepCopy() *NginxEndpoints {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxEndpoints)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxEndpointsStatus) DeepCopyInto(out *NginxEndpointsStatus) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]NginxEndpoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxEndpointsStatus.
+func (in *NginxEndpointsStatus) DeepCopy() *NginxEndpointsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxEndpointsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxExternalAuth) DeepCopyInto(out *NginxExternalAuth) {
+	*out = *in
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(NginxExternalAuthCache)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxExternalAuth.
+func (in *NginxExternalAuth) DeepCopy() *NginxExternalAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxExternalAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxExternalAuthCache) DeepCopyInto(out *NginxExternalAuthCache) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxExternalAuthCache.
+func (in *NginxExternalAuthCache) DeepCopy() *NginxExternalAuthCache {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxExternalAuthCache)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxExternalSecret) DeepCopyInto(out *NginxExternalSecret) {
+	*out = *in
+	out.SecretStoreRef = in.SecretStoreRef
+	if in.Data != nil {
+		in, out := &in.Data, &out.Data
+		*out = make([]ExternalSecretData, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxExternalSecret.
+func (in *NginxExternalSecret) DeepCopy() *NginxExternalSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxExternalSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxExtraFile) DeepCopyInto(out *NginxExtraFile) {
+	*out = *in
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxExtraFile.
+func (in *NginxExtraFile) DeepCopy() *NginxExtraFile {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxExtraFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxFleetCertificate) DeepCopyInto(out *NginxFleetCertificate) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxFleetCertificate.
+func (in *NginxFleetCertificate) DeepCopy() *NginxFleetCertificate {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxFleetCertificate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxFleetImage) DeepCopyInto(out *NginxFleetImage) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxFleetImage.
+func (in *NginxFleetImage) DeepCopy() *NginxFleetImage {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxFleetImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxFleetInstance) DeepCopyInto(out *NginxFleetInstance) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxFleetInstance.
+func (in *NginxFleetInstance) DeepCopy() *NginxFleetInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxFleetInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxFleetStatus) DeepCopyInto(out *NginxFleetStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxFleetStatus.
+func (in *NginxFleetStatus) DeepCopy() *NginxFleetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxFleetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NginxFleetStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxFleetStatusList) DeepCopyInto(out *NginxFleetStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NginxFleetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxFleetStatusList.
+func (in *NginxFleetStatusList) DeepCopy() *NginxFleetStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxFleetStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NginxFleetStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxFleetSummary) DeepCopyInto(out *NginxFleetSummary) {
+	*out = *in
+	if in.Unhealthy != nil {
+		in, out := &in.Unhealthy, &out.Unhealthy
+		*out = make([]NginxFleetInstance, len(*in))
+		copy(*out, *in)
+	}
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]NginxFleetImage, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExpiringCertificates != nil {
+		in, out := &in.ExpiringCertificates, &out.ExpiringCertificates
+		*out = make([]NginxFleetCertificate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxFleetSummary.
+func (in *NginxFleetSummary) DeepCopy() *NginxFleetSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxFleetSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxFluentBit) DeepCopyInto(out *NginxFluentBit) {
+	*out = *in
+	if in.Properties != nil {
+		in, out := &in.Properties, &out.Properties
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxFluentBit.
+func (in *NginxFluentBit) DeepCopy() *NginxFluentBit {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxFluentBit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxGitSync) DeepCopyInto(out *NginxGitSync) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxGitSync.
+func (in *NginxGitSync) DeepCopy() *NginxGitSync {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxGitSync)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxHealthcheck) DeepCopyInto(out *NginxHealthcheck) {
+	*out = *in
+	if in.Readiness != nil {
+		in, out := &in.Readiness, &out.Readiness
+		*out = new(NginxProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Liveness != nil {
+		in, out := &in.Liveness, &out.Liveness
+		*out = new(NginxProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Startup != nil {
+		in, out := &in.Startup, &out.Startup
+		*out = new(NginxStartupProbe)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxHealthcheck.
+func (in *NginxHealthcheck) DeepCopy() *NginxHealthcheck {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxHealthcheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxIngress) DeepCopyInto(out *NginxIngress) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(NginxIngressTLS)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxIngress.
+func (in *NginxIngress) DeepCopy() *NginxIngress {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxIngress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxIngressTLS) DeepCopyInto(out *NginxIngressTLS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxIngressTLS.
+func (in *NginxIngressTLS) DeepCopy() *NginxIngressTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxIngressTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxLifecycle) DeepCopyInto(out *NginxLifecycle) {
+	*out = *in
+	if in.PreStop != nil {
+		in, out := &in.PreStop, &out.PreStop
+		*out = new(v1.Handler)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreStopSleepSeconds != nil {
+		in, out := &in.PreStopSleepSeconds, &out.PreStopSleepSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PostStart != nil {
+		in, out := &in.PostStart, &out.PostStart
+		*out = new(v1.Handler)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxLifecycle.
+func (in *NginxLifecycle) DeepCopy() *NginxLifecycle {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxLifecycle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxList) DeepCopyInto(out *NginxList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Nginx, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxList.
+func (in *NginxList) DeepCopy() *NginxList {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NginxList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxLocation) DeepCopyInto(out *NginxLocation) {
+	*out = *in
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(ProxyAction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FastCGI != nil {
+		in, out := &in.FastCGI, &out.FastCGI
+		*out = new(FastCGIAction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ObjectStorage != nil {
+		in, out := &in.ObjectStorage, &out.ObjectStorage
+		*out = new(ObjectStorageAction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Static != nil {
+		in, out := &in.Static, &out.Static
+		*out = new(StaticAction)
+		**out = **in
+	}
+	if in.Redirect != nil {
+		in, out := &in.Redirect, &out.Redirect
+		*out = new(RedirectAction)
+		**out = **in
+	}
+	if in.Return != nil {
+		in, out := &in.Return, &out.Return
+		*out = new(ReturnAction)
+		**out = **in
+	}
+	if in.Options != nil {
+		in, out := &in.Options, &out.Options
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Bandwidth != nil {
+		in, out := &in.Bandwidth, &out.Bandwidth
+		*out = new(LocationBandwidth)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxLocation.
+func (in *NginxLocation) DeepCopy() *NginxLocation {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxLocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxLogging) DeepCopyInto(out *NginxLogging) {
+	*out = *in
+	if in.Syslog != nil {
+		in, out := &in.Syslog, &out.Syslog
+		*out = new(NginxSyslog)
+		**out = **in
+	}
+	if in.FluentBit != nil {
+		in, out := &in.FluentBit, &out.FluentBit
+		*out = new(NginxFluentBit)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxLogging.
+func (in *NginxLogging) DeepCopy() *NginxLogging {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxLogging)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxMetrics) DeepCopyInto(out *NginxMetrics) {
+	*out = *in
+	if in.ServiceMonitor != nil {
+		in, out := &in.ServiceMonitor, &out.ServiceMonitor
+		*out = new(NginxServiceMonitor)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = new(NginxUpstreamMetrics)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxMetrics.
+func (in *NginxMetrics) DeepCopy() *NginxMetrics {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxMetrics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxModule) DeepCopyInto(out *NginxModule) {
+	*out = *in
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxModule.
+func (in *NginxModule) DeepCopy() *NginxModule {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxModule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxNetworkPolicy) DeepCopyInto(out *NginxNetworkPolicy) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]networking_v1.NetworkPolicyPeer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Egress != nil {
+		in, out := &in.Egress, &out.Egress
+		*out = make([]networking_v1.NetworkPolicyEgressRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxNetworkPolicy.
+func (in *NginxNetworkPolicy) DeepCopy() *NginxNetworkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxNetworkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxNodeRemediation) DeepCopyInto(out *NginxNodeRemediation) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.NodeConditionType, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxNodeRemediation.
+func (in *NginxNodeRemediation) DeepCopy() *NginxNodeRemediation {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxNodeRemediation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxOverloadProtection) DeepCopyInto(out *NginxOverloadProtection) {
+	*out = *in
+	if in.CPUShedding != nil {
+		in, out := &in.CPUShedding, &out.CPUShedding
+		*out = new(NginxCPUShedding)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxOverloadProtection.
+func (in *NginxOverloadProtection) DeepCopy() *NginxOverloadProtection {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxOverloadProtection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxPendingApply) DeepCopyInto(out *NginxPendingApply) {
+	*out = *in
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxPendingApply.
+func (in *NginxPendingApply) DeepCopy() *NginxPendingApply {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxPendingApply)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxPod) DeepCopyInto(out *NginxPod) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxPod.
+func (in *NginxPod) DeepCopy() *NginxPod {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxPod)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxPodDisruptionBudget) DeepCopyInto(out *NginxPodDisruptionBudget) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxPodDisruptionBudget.
+func (in *NginxPodDisruptionBudget) DeepCopy() *NginxPodDisruptionBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxPodDisruptionBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxPodTemplateSpec) DeepCopyInto(out *NginxPodTemplateSpec) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]NginxPort, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]v1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]v1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]v1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = make([]v1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InitContainers != nil {
+		in, out := &in.InitContainers, &out.InitContainers
+		*out = make([]v1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.AutomountServiceAccountToken != nil {
+		in, out := &in.AutomountServiceAccountToken, &out.AutomountServiceAccountToken
+		*out = new(bool)
+		**out = **in
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(v1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxPodTemplateSpec.
+func (in *NginxPodTemplateSpec) DeepCopy() *NginxPodTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxPodTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxPort) DeepCopyInto(out *NginxPort) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxPort.
+func (in *NginxPort) DeepCopy() *NginxPort {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxPort)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxProbe) DeepCopyInto(out *NginxProbe) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxProbe.
+func (in *NginxProbe) DeepCopy() *NginxProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxProfile) DeepCopyInto(out *NginxProfile) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxProfile.
+func (in *NginxProfile) DeepCopy() *NginxProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxResourceRecommendation) DeepCopyInto(out *NginxResourceRecommendation) {
+	*out = *in
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.LowerBound != nil {
+		in, out := &in.LowerBound, &out.LowerBound
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.UpperBound != nil {
+		in, out := &in.UpperBound, &out.UpperBound
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.UncappedTarget != nil {
+		in, out := &in.UncappedTarget, &out.UncappedTarget
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxResourceRecommendation.
+func (in *NginxResourceRecommendation) DeepCopy() *NginxResourceRecommendation {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxResourceRecommendation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxRetention) DeepCopyInto(out *NginxRetention) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxRetention.
+func (in *NginxRetention) DeepCopy() *NginxRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxRollback) DeepCopyInto(out *NginxRollback) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxRollback.
+func (in *NginxRollback) DeepCopy() *NginxRollback {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxRollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxRollout) DeepCopyInto(out *NginxRollout) {
+	*out = *in
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanaryStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CanaryCheck != nil {
+		in, out := &in.CanaryCheck, &out.CanaryCheck
+		*out = new(CanaryCheck)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxRollout.
+func (in *NginxRollout) DeepCopy() *NginxRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSLO) DeepCopyInto(out *NginxSLO) {
+	*out = *in
+	if in.Latency != nil {
+		in, out := &in.Latency, &out.Latency
+		*out = new(NginxSLOLatency)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AlertLabels != nil {
+		in, out := &in.AlertLabels, &out.AlertLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSLO.
+func (in *NginxSLO) DeepCopy() *NginxSLO {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSLO)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSLOLatency) DeepCopyInto(out *NginxSLOLatency) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSLOLatency.
+func (in *NginxSLOLatency) DeepCopy() *NginxSLOLatency {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSLOLatency)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSecurity) DeepCopyInto(out *NginxSecurity) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSecurity.
+func (in *NginxSecurity) DeepCopy() *NginxSecurity {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSecurity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxService) DeepCopyInto(out *NginxService) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxService.
+func (in *NginxService) DeepCopy() *NginxService {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxService)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxServiceAccount) DeepCopyInto(out *NginxServiceAccount) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]rbac_v1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxServiceAccount.
+func (in *NginxServiceAccount) DeepCopy() *NginxServiceAccount {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxServiceAccount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxServiceMonitor) DeepCopyInto(out *NginxServiceMonitor) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxServiceMonitor.
+func (in *NginxServiceMonitor) DeepCopy() *NginxServiceMonitor {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxServiceMonitor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxServiceSpec) DeepCopyInto(out *NginxServiceSpec) {
+	*out = *in
+	if in.SessionAffinity != nil {
+		in, out := &in.SessionAffinity, &out.SessionAffinity
+		*out = new(NginxSessionAffinity)
+		**out = **in
+	}
+	if in.IPFamilies != nil {
+		in, out := &in.IPFamilies, &out.IPFamilies
+		*out = make([]IPFamily, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxServiceSpec.
+func (in *NginxServiceSpec) DeepCopy() *NginxServiceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxServiceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxServiceStatus) DeepCopyInto(out *NginxServiceStatus) {
+	*out = *in
+	if in.ExternalAddresses != nil {
+		in, out := &in.ExternalAddresses, &out.ExternalAddresses
+		*out = make([]NginxAddress, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxServiceStatus.
+func (in *NginxServiceStatus) DeepCopy() *NginxServiceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxServiceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSessionAffinity) DeepCopyInto(out *NginxSessionAffinity) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSessionAffinity.
+func (in *NginxSessionAffinity) DeepCopy() *NginxSessionAffinity {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSessionAffinity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSnippets) DeepCopyInto(out *NginxSnippets) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSnippets.
+func (in *NginxSnippets) DeepCopy() *NginxSnippets {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSnippets)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSpec) DeepCopyInto(out *NginxSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(NginxAutoscaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(ConfigRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigTemplate != nil {
+		in, out := &in.ConfigTemplate, &out.ConfigTemplate
+		*out = new(NginxConfigTemplate)
+		**out = **in
+	}
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ConfigFiles != nil {
+		in, out := &in.ConfigFiles, &out.ConfigFiles
+		*out = make([]NginxConfigFile, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExtraFiles != nil {
+		in, out := &in.ExtraFiles, &out.ExtraFiles
+		*out = make([]NginxExtraFile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TLSSecret != nil {
+		in, out := &in.TLSSecret, &out.TLSSecret
+		*out = new(TLSSecret)
+		**out = **in
+	}
+	in.PodTemplate.DeepCopyInto(&out.PodTemplate)
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(NginxRollout)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Flagger != nil {
+		in, out := &in.Flagger, &out.Flagger
+		*out = new(FlaggerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeletePropagation != nil {
+		in, out := &in.DeletePropagation, &out.DeletePropagation
+		*out = new(meta_v1.DeletionPropagation)
+		**out = **in
+	}
+	if in.Certificates != nil {
+		in, out := &in.Certificates, &out.Certificates
+		*out = new(NginxCertificates)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExternalSecrets != nil {
+		in, out := &in.ExternalSecrets, &out.ExternalSecrets
+		*out = make([]NginxExternalSecret, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CleanupPolicy != nil {
+		in, out := &in.CleanupPolicy, &out.CleanupPolicy
+		*out = new(CleanupPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(NginxMetrics)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(NginxIngress)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Locations != nil {
+		in, out := &in.Locations, &out.Locations
+		*out = make([]NginxLocation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Snippets != nil {
+		in, out := &in.Snippets, &out.Snippets
+		*out = new(NginxSnippets)
+		**out = **in
+	}
+	if in.PodDisruptionBudget != nil {
+		in, out := &in.PodDisruptionBudget, &out.PodDisruptionBudget
+		*out = new(NginxPodDisruptionBudget)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(NginxNetworkPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StaticSites != nil {
+		in, out := &in.StaticSites, &out.StaticSites
+		*out = make([]NginxStaticSite, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Healthcheck != nil {
+		in, out := &in.Healthcheck, &out.Healthcheck
+		*out = new(NginxHealthcheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GitSync != nil {
+		in, out := &in.GitSync, &out.GitSync
+		*out = new(NginxGitSync)
+		**out = **in
+	}
+	if in.Strategy != nil {
+		in, out := &in.Strategy, &out.Strategy
+		*out = new(apps_v1.DeploymentStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ProgressDeadlineSeconds != nil {
+		in, out := &in.ProgressDeadlineSeconds, &out.ProgressDeadlineSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CachePolicy != nil {
+		in, out := &in.CachePolicy, &out.CachePolicy
+		*out = new(NginxCachePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(NginxCache)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NginxArgs != nil {
+		in, out := &in.NginxArgs, &out.NginxArgs
+		*out = new(NginxArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Modules != nil {
+		in, out := &in.Modules, &out.Modules
+		*out = make([]NginxModule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.WaitFor != nil {
+		in, out := &in.WaitFor, &out.WaitFor
+		*out = make([]NginxWaitFor, len(*in))
+		copy(*out, *in)
+	}
+	if in.OverloadProtection != nil {
+		in, out := &in.OverloadProtection, &out.OverloadProtection
+		*out = new(NginxOverloadProtection)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Logging != nil {
+		in, out := &in.Logging, &out.Logging
+		*out = new(NginxLogging)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnknownHosts != nil {
+		in, out := &in.UnknownHosts, &out.UnknownHosts
+		*out = new(NginxUnknownHosts)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Security != nil {
+		in, out := &in.Security, &out.Security
+		*out = new(NginxSecurity)
+		**out = **in
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(NginxAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(NginxServiceAccount)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SLO != nil {
+		in, out := &in.SLO, &out.SLO
+		*out = new(NginxSLO)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(NginxDNS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = new(NginxEndpoints)
+		**out = **in
+	}
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(NginxServiceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Profiles != nil {
+		in, out := &in.Profiles, &out.Profiles
+		*out = make(map[string]NginxProfile, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.NodeRemediation != nil {
+		in, out := &in.NodeRemediation, &out.NodeRemediation
+		*out = new(NginxNodeRemediation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Lifecycle != nil {
+		in, out := &in.Lifecycle, &out.Lifecycle
+		*out = new(NginxLifecycle)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(NginxRetention)
+		**out = **in
+	}
+	if in.SpecHistoryLimit != nil {
+		in, out := &in.SpecHistoryLimit, &out.SpecHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RollbackTo != nil {
+		in, out := &in.RollbackTo, &out.RollbackTo
+		*out = new(NginxRollback)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSpec.
+func (in *NginxSpec) DeepCopy() *NginxSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSpecRevision) DeepCopyInto(out *NginxSpecRevision) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSpecRevision.
+func (in *NginxSpecRevision) DeepCopy() *NginxSpecRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSpecRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxStartupProbe) DeepCopyInto(out *NginxStartupProbe) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxStartupProbe.
+func (in *NginxStartupProbe) DeepCopy() *NginxStartupProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxStartupProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxStaticSite) DeepCopyInto(out *NginxStaticSite) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(StaticConfigMapSource)
+		**out = **in
+	}
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(StaticPersistentVolumeClaimSource)
+		**out = **in
+	}
+	if in.ObjectStorage != nil {
+		in, out := &in.ObjectStorage, &out.ObjectStorage
+		*out = new(StaticObjectStorageSource)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxStaticSite.
+func (in *NginxStaticSite) DeepCopy() *NginxStaticSite {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxStaticSite)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxStatus) DeepCopyInto(out *NginxStatus) {
+	*out = *in
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
+		*out = make([]NginxPod, len(*in))
+		copy(*out, *in)
+	}
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make([]NginxService, len(*in))
+		copy(*out, *in)
+	}
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]NginxAddress, len(*in))
+		copy(*out, *in)
+	}
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(NginxServiceStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = new(NginxEndpointsStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VerticalAutoscaler != nil {
+		in, out := &in.VerticalAutoscaler, &out.VerticalAutoscaler
+		*out = new(NginxVerticalAutoscalerStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastReconcileTime != nil {
+		in, out := &in.LastReconcileTime, &out.LastReconcileTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]NginxCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CachePurges != nil {
+		in, out := &in.CachePurges, &out.CachePurges
+		*out = make([]NginxCachePurge, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Deployment != nil {
+		in, out := &in.Deployment, &out.Deployment
+		*out = new(NginxDeploymentStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(NginxCanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CertificateNotAfter != nil {
+		in, out := &in.CertificateNotAfter, &out.CertificateNotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.PendingApply != nil {
+		in, out := &in.PendingApply, &out.PendingApply
+		*out = new(NginxPendingApply)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SpecHistory != nil {
+		in, out := &in.SpecHistory, &out.SpecHistory
+		*out = make([]NginxSpecRevision, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxStatus.
+func (in *NginxStatus) DeepCopy() *NginxStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxSyslog) DeepCopyInto(out *NginxSyslog) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxSyslog.
+func (in *NginxSyslog) DeepCopy() *NginxSyslog {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxSyslog)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxUnknownHosts) DeepCopyInto(out *NginxUnknownHosts) {
+	*out = *in
+	if in.ServerNames != nil {
+		in, out := &in.ServerNames, &out.ServerNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxUnknownHosts.
+func (in *NginxUnknownHosts) DeepCopy() *NginxUnknownHosts {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxUnknownHosts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxUpstreamMetrics) DeepCopyInto(out *NginxUpstreamMetrics) {
+	*out = *in
+	if in.Buckets != nil {
+		in, out := &in.Buckets, &out.Buckets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxUpstreamMetrics.
+func (in *NginxUpstreamMetrics) DeepCopy() *NginxUpstreamMetrics {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxUpstreamMetrics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxVerticalAutoscalerStatus) DeepCopyInto(out *NginxVerticalAutoscalerStatus) {
+	*out = *in
+	if in.Recommendation != nil {
+		in, out := &in.Recommendation, &out.Recommendation
+		*out = new(NginxResourceRecommendation)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxVerticalAutoscalerStatus.
+func (in *NginxVerticalAutoscalerStatus) DeepCopy() *NginxVerticalAutoscalerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxVerticalAutoscalerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxVerticalAutoscaling) DeepCopyInto(out *NginxVerticalAutoscaling) {
+	*out = *in
+	if in.MinAllowed != nil {
+		in, out := &in.MinAllowed, &out.MinAllowed
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.MaxAllowed != nil {
+		in, out := &in.MaxAllowed, &out.MaxAllowed
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxVerticalAutoscaling.
+func (in *NginxVerticalAutoscaling) DeepCopy() *NginxVerticalAutoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxVerticalAutoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NginxWaitFor) DeepCopyInto(out *NginxWaitFor) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NginxWaitFor.
+func (in *NginxWaitFor) DeepCopy() *NginxWaitFor {
+	if in == nil {
+		return nil
+	}
+	out := new(NginxWaitFor)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectStorageAction) DeepCopyInto(out *ObjectStorageAction) {
+	*out = *in
+	if in.Signing != nil {
+		in, out := &in.Signing, &out.Signing
+		*out = new(ObjectStorageSigning)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectStorageAction.
+func (in *ObjectStorageAction) DeepCopy() *ObjectStorageAction {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectStorageAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectStorageSigning) DeepCopyInto(out *ObjectStorageSigning) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectStorageSigning.
+func (in *ObjectStorageSigning) DeepCopy() *ObjectStorageSigning {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectStorageSigning)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyAction) DeepCopyInto(out *ProxyAction) {
+	*out = *in
+	if in.Cache != nil {
+		in, out := &in.Cache, &out.Cache
+		*out = new(ProxyCache)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyAction.
+func (in *ProxyAction) DeepCopy() *ProxyAction {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyCache) DeepCopyInto(out *ProxyCache) {
+	*out = *in
+	if in.PurgeFrom != nil {
+		in, out := &in.PurgeFrom, &out.PurgeFrom
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyCache.
+func (in *ProxyCache) DeepCopy() *ProxyCache {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyCache)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedirectAction) DeepCopyInto(out *RedirectAction) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedirectAction.
+func (in *RedirectAction) DeepCopy() *RedirectAction {
+	if in == nil {
+		return nil
+	}
+	out := new(RedirectAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReturnAction) DeepCopyInto(out *ReturnAction) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReturnAction.
+func (in *ReturnAction) DeepCopy() *ReturnAction {
+	if in == nil {
+		return nil
+	}
+	out := new(ReturnAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticAction) DeepCopyInto(out *StaticAction) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticAction.
+func (in *StaticAction) DeepCopy() *StaticAction {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticConfigMapSource) DeepCopyInto(out *StaticConfigMapSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticConfigMapSource.
+func (in *StaticConfigMapSource) DeepCopy() *StaticConfigMapSource {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticConfigMapSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticObjectStorageSource) DeepCopyInto(out *StaticObjectStorageSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticObjectStorageSource.
+func (in *StaticObjectStorageSource) DeepCopy() *StaticObjectStorageSource {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticObjectStorageSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticPersistentVolumeClaimSource) DeepCopyInto(out *StaticPersistentVolumeClaimSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticPersistentVolumeClaimSource.
+func (in *StaticPersistentVolumeClaimSource) DeepCopy() *StaticPersistentVolumeClaimSource {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticPersistentVolumeClaimSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSSecret) DeepCopyInto(out *TLSSecret) {
+	*out = *in
+	return
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSSecret.
@@ -213,3 +2714,24 @@ func (in *TLSSecret) DeepCopy() *TLSSecret {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopologySpreadConstraint) DeepCopyInto(out *TopologySpreadConstraint) {
+	*out = *in
+	if in.LabelSelector != nil {
+		in, out := &in.LabelSelector, &out.LabelSelector
+		*out = new(meta_v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopologySpreadConstraint.
+func (in *TopologySpreadConstraint) DeepCopy() *TopologySpreadConstraint {
+	if in == nil {
+		return nil
+	}
+	out := new(TopologySpreadConstraint)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,121 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+// ConvertToV1alpha1 converts the JSON object of a v1beta1 Nginx to
+// v1alpha1, in place. Fields not renamed between the versions are kept as
+// is, including the ones unknown to this package.
+func ConvertToV1alpha1(obj map[string]interface{}) error {
+	obj["apiVersion"] = v1alpha1.SchemeGroupVersion.String()
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if tls, ok := spec["tls"]; ok {
+		delete(spec, "tls")
+		list, _ := tls.([]interface{})
+		switch len(list) {
+		case 0:
+		case 1:
+			spec["tlsSecret"] = renameKeys(list[0], tlsFields, true)
+		default:
+			return fmt.Errorf("spec.tls supports a single certificate, got %d", len(list))
+		}
+	}
+	return nil
+}
+
+// ConvertFromV1alpha1 converts the JSON object of a v1alpha1 Nginx to
+// v1beta1, in place. Fields not renamed between the versions are kept as is,
+// including the ones unknown to this package.
+func ConvertFromV1alpha1(obj map[string]interface{}) error {
+	obj["apiVersion"] = SchemeGroupVersion.String()
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	// v1alpha1 objects written before the json tags of these fields were
+	// fixed have them keyed by their Go names
+	rename(spec, "TLSSecret", "tlsSecret")
+	rename(spec, "PodTemplate", "podTemplate")
+	if tls, ok := spec["tlsSecret"]; ok {
+		delete(spec, "tlsSecret")
+		if tls != nil {
+			spec["tls"] = []interface{}{renameKeys(tls, tlsFields, false)}
+		}
+	}
+	return nil
+}
+
+// tlsFields maps the fields of the v1alpha1 TLS secret to the v1beta1 ones
+var tlsFields = map[string]string{
+	"SecretName":       "secretName",
+	"KeyField":         "keyField",
+	"CertificateField": "certificateField",
+	"KeyPath":          "keyPath",
+	"CertificatePath":  "certificatePath",
+}
+
+// renameKeys renames the keys of the object using the given mapping, or its
+// reverse
+func renameKeys(obj interface{}, fields map[string]string, reverse bool) interface{} {
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		return obj
+	}
+	for from, to := range fields {
+		if reverse {
+			from, to = to, from
+		}
+		rename(m, from, to)
+	}
+	return m
+}
+
+func rename(m map[string]interface{}, from, to string) {
+	if v, ok := m[from]; ok {
+		delete(m, from)
+		m[to] = v
+	}
+}
+
+// FromV1alpha1 returns the v1beta1 version of the Nginx
+func FromV1alpha1(in *v1alpha1.Nginx) (*Nginx, error) {
+	out := &Nginx{}
+	if err := convert(in, out, ConvertFromV1alpha1); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ToV1alpha1 returns the v1alpha1 version of the Nginx
+func (in *Nginx) ToV1alpha1() (*v1alpha1.Nginx, error) {
+	out := &v1alpha1.Nginx{}
+	if err := convert(in, out, ConvertToV1alpha1); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func convert(in, out interface{}, fn func(map[string]interface{}) error) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if err := fn(obj); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(obj); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,122 @@
+package v1beta1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConversion(t *testing.T) {
+	replicas := int32(3)
+	alpha := &v1alpha1.Nginx{
+		TypeMeta:   metav1.TypeMeta{Kind: "Nginx", APIVersion: "nginx.tsuru.io/v1alpha1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx", Namespace: "default"},
+		Spec: v1alpha1.NginxSpec{
+			Replicas:  &replicas,
+			Image:     "nginx:1.25",
+			Config:    &v1alpha1.ConfigRef{Name: "my-config"},
+			TLSSecret: &v1alpha1.TLSSecret{SecretName: "my-secret", KeyPath: "site.key"},
+			PodTemplate: v1alpha1.NginxPodTemplateSpec{
+				NodeSelector: map[string]string{"pool": "edge"},
+				Env:          []corev1.EnvVar{{Name: "TZ", Value: "UTC"}},
+			},
+		},
+		Status: v1alpha1.NginxStatus{CertificateRevision: "0123456789abcdef"},
+	}
+
+	beta, err := FromV1alpha1(alpha)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx.tsuru.io/v1beta1", beta.APIVersion)
+	assert.Equal(t, []NginxTLS{{SecretName: "my-secret", KeyPath: "site.key"}}, beta.Spec.TLS)
+	assert.Equal(t, alpha.Spec.PodTemplate, beta.Spec.PodTemplate)
+	assert.Equal(t, alpha.Spec.Config, beta.Spec.Config)
+	assert.Equal(t, alpha.Status, beta.Status)
+
+	back, err := beta.ToV1alpha1()
+	assert.Nil(t, err)
+	assert.Equal(t, alpha, back)
+
+	beta.Spec.TLS = append(beta.Spec.TLS, NginxTLS{SecretName: "other"})
+	_, err = beta.ToV1alpha1()
+	assert.EqualError(t, err, "spec.tls supports a single certificate, got 2")
+
+	beta.Spec.TLS = nil
+	back, err = beta.ToV1alpha1()
+	assert.Nil(t, err)
+	assert.Nil(t, back.Spec.TLSSecret)
+}
+
+func TestConversionKeepsUnknownFields(t *testing.T) {
+	obj := map[string]interface{}{
+		"apiVersion": "nginx.tsuru.io/v1beta1",
+		"spec": map[string]interface{}{
+			"podTemplate": map[string]interface{}{"hostNetwork": true},
+			"newField":    "value",
+		},
+	}
+	assert.Nil(t, ConvertToV1alpha1(obj))
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "nginx.tsuru.io/v1alpha1",
+		"spec": map[string]interface{}{
+			"podTemplate": map[string]interface{}{"hostNetwork": true},
+			"newField":    "value",
+		},
+	}, obj)
+}
+
+func TestConversionRenamesLegacyKeys(t *testing.T) {
+	obj := map[string]interface{}{
+		"apiVersion": "nginx.tsuru.io/v1alpha1",
+		"spec": map[string]interface{}{
+			"TLSSecret":   map[string]interface{}{"SecretName": "s"},
+			"PodTemplate": map[string]interface{}{"hostNetwork": true},
+		},
+	}
+	assert.Nil(t, ConvertFromV1alpha1(obj))
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "nginx.tsuru.io/v1beta1",
+		"spec": map[string]interface{}{
+			"tls":         []interface{}{map[string]interface{}{"secretName": "s"}},
+			"podTemplate": map[string]interface{}{"hostNetwork": true},
+		},
+	}, obj)
+}
+
+// The specs must only differ in the renamed fields, new v1alpha1 fields
+// must be added to v1beta1 as well
+func TestSpecFieldsMatch(t *testing.T) {
+	renamed := map[string]string{"tlsSecret": "tls"}
+	alphaFields := jsonFields(reflect.TypeOf(v1alpha1.NginxSpec{}))
+	betaFields := jsonFields(reflect.TypeOf(NginxSpec{}))
+	assert.Len(t, betaFields, len(alphaFields))
+	for name, alphaField := range alphaFields {
+		if to, ok := renamed[name]; ok {
+			name = to
+		}
+		betaField, ok := betaFields[name]
+		if !assert.True(t, ok, "spec field %s missing from v1beta1", name) {
+			continue
+		}
+		if name != "tls" {
+			assert.Equal(t, alphaField.Type, betaField.Type, "spec field %s", name)
+		}
+	}
+}
+
+func jsonFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
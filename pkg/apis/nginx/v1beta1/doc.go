@@ -0,0 +1,3 @@
+// +k8s:deepcopy-gen=package
+// +groupName=nginx.tsuru.io
+package v1beta1
@@ -0,0 +1,323 @@
+package v1beta1
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Nginx is the v1beta1 version of the Nginx resource. Objects are stored as
+// v1alpha1 and converted by the conversion webhook, the types of the fields
+// left unchanged are shared with v1alpha1.
+type Nginx struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              NginxSpec            `json:"spec"`
+	Status            v1alpha1.NginxStatus `json:"status,omitempty"`
+}
+
+// NginxSpec is the v1alpha1 spec with the cleaned-up field names: the TLS
+// secret became the tls list, with lower camel case fields, and PodTemplate
+// is spelled podTemplate.
+type NginxSpec struct {
+	// Number of desired pods. This is a pointer to distinguish between explicit
+	// zero and not specified. Defaults to the default deployment replicas value.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// ClampReplicasToQuota scales up only to the replicas whose pods fit in
+	// the resource quotas of the namespace, instead of leaving the extra
+	// pods failing to be created.
+	// +optional
+	ClampReplicasToQuota bool `json:"clampReplicasToQuota,omitempty"`
+	// Autoscaling configures the autoscalers of the nginx pods.
+	// +optional
+	Autoscaling *v1alpha1.NginxAutoscaling `json:"autoscaling,omitempty"`
+	// Docker image name. Defaults to "nginx:latest".
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Reference to the nginx config object.
+	// +optional
+	Config *v1alpha1.ConfigRef `json:"configRef,omitempty"`
+	// ConfigTemplate renders nginx.conf from a Go template into a ConfigMap
+	// owned by this nginx, used as its config.
+	// +optional
+	ConfigTemplate *v1alpha1.NginxConfigTemplate `json:"configTemplate,omitempty"`
+	// Values are custom values available to the config template as .Values.
+	// +optional
+	Values map[string]string `json:"values,omitempty"`
+	// ConfigFiles are auxiliary config files, like mime.types or
+	// fastcgi_params, placed next to nginx.conf in /etc/nginx.
+	// +optional
+	ConfigFiles []v1alpha1.NginxConfigFile `json:"configFiles,omitempty"`
+	// ExtraFiles are files from ConfigMaps or Secrets placed under
+	// /etc/nginx, like htpasswd files, dhparams, GeoIP databases or snippets
+	// included from conf.d.
+	// +optional
+	ExtraFiles []v1alpha1.NginxExtraFile `json:"extraFiles,omitempty"`
+	// TLS are the secrets holding the certificate and key pairs served by
+	// nginx. A single certificate is supported for now.
+	// +optional
+	TLS []NginxTLS `json:"tls,omitempty"`
+	// Template used to configure the nginx pod.
+	// +optional
+	PodTemplate v1alpha1.NginxPodTemplateSpec `json:"podTemplate,omitempty"`
+	// Labels added to the objects generated for this nginx, like the
+	// workload, its pods and the services.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the objects generated for this nginx, like the
+	// workload, its pods and the services.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ControllerClass selects the operator handling this nginx, the one
+	// started with the same --controller-class. Nginx objects without it are
+	// handled by the operators started without a class.
+	// +optional
+	ControllerClass string `json:"controllerClass,omitempty"`
+	// Kind of the workload used to run the nginx pods. Defaults to WorkloadKindDeployment.
+	// +optional
+	WorkloadKind v1alpha1.WorkloadKind `json:"workloadKind,omitempty"`
+	// Rollout configures how changes are progressively rolled out to the nginx pods.
+	// +optional
+	Rollout *v1alpha1.NginxRollout `json:"rollout,omitempty"`
+	// Flagger enables the integration with Flagger canary analysis.
+	// +optional
+	Flagger *v1alpha1.FlaggerSpec `json:"flagger,omitempty"`
+	// ValidateConfig runs `nginx -t` against the config in a Job before
+	// rolling out changes, refusing to roll out configs that fail the test.
+	// +optional
+	ValidateConfig bool `json:"validateConfig,omitempty"`
+	// DeletePropagation is the propagation policy used when deleting the
+	// objects created for this nginx, either because a feature was disabled
+	// or because the nginx itself was deleted. One of "Foreground",
+	// "Background" or "Orphan". Defaults to the operator --delete-propagation flag.
+	// +optional
+	DeletePropagation *metav1.DeletionPropagation `json:"deletePropagation,omitempty"`
+	// Certificates requests a TLS certificate from cert-manager, used as the
+	// TLS secret of this nginx.
+	// +optional
+	Certificates *v1alpha1.NginxCertificates `json:"certificates,omitempty"`
+	// ExternalSecrets are Secrets materialized by the External Secrets
+	// operator from an external store, like Vault, and used as the TLS
+	// secret or as extra files of this nginx.
+	// +optional
+	ExternalSecrets []v1alpha1.NginxExternalSecret `json:"externalSecrets,omitempty"`
+	// CleanupPolicy controls the cleanup done by the operator before the
+	// objects created for this nginx are removed on its deletion.
+	// +optional
+	CleanupPolicy *v1alpha1.CleanupPolicy `json:"cleanupPolicy,omitempty"`
+	// ConfigReload is how running pods pick up changes to the content of the
+	// config. Defaults to ConfigReloadRestart.
+	// +optional
+	ConfigReload v1alpha1.ConfigReloadStrategy `json:"configReload,omitempty"`
+	// Metrics enables a nginx-prometheus-exporter sidecar exposing the nginx
+	// metrics on the "metrics" port of the pods and the service.
+	// +optional
+	Metrics *v1alpha1.NginxMetrics `json:"metrics,omitempty"`
+	// Ingress exposes the nginx service through an Ingress owned by the nginx.
+	// +optional
+	Ingress *v1alpha1.NginxIngress `json:"ingress,omitempty"`
+	// Locations are rendered, in order, as nginx location blocks. Without a
+	// custom config they are served by the default server, custom configs
+	// must include them.
+	// +optional
+	Locations []v1alpha1.NginxLocation `json:"locations,omitempty"`
+	// Snippets are nginx directives merged into the config managed by the
+	// operator. They cannot be used with a custom config.
+	// +optional
+	Snippets *v1alpha1.NginxSnippets `json:"snippets,omitempty"`
+	// PodDisruptionBudget limits how many nginx pods can be voluntarily
+	// evicted at the same time, like during node drains.
+	// +optional
+	PodDisruptionBudget *v1alpha1.NginxPodDisruptionBudget `json:"podDisruptionBudget,omitempty"`
+	// SpreadReplicas prefers scheduling the nginx pods on different nodes
+	// and zones, on top of the affinity of the pod template.
+	// +optional
+	SpreadReplicas bool `json:"spreadReplicas,omitempty"`
+	// NetworkPolicy creates a NetworkPolicy allowing the traffic to the
+	// ports of the nginx pods and, optionally, restricting their egress.
+	// +optional
+	NetworkPolicy *v1alpha1.NginxNetworkPolicy `json:"networkPolicy,omitempty"`
+	// StaticSites are directories of static files served by the nginx,
+	// each one under its own path. Like the locations, custom configs must
+	// include them.
+	// +optional
+	StaticSites []v1alpha1.NginxStaticSite `json:"staticSites,omitempty"`
+	// Healthcheck configures the probes of the nginx container. Without it
+	// the pods are only checked for readiness, with a GET on "/".
+	// +optional
+	Healthcheck *v1alpha1.NginxHealthcheck `json:"healthcheck,omitempty"`
+	// GitSync keeps a clone of a git repository in the nginx pods, for
+	// static content or config files included by the nginx config. Nginx
+	// is reloaded whenever new commits are checked out.
+	// +optional
+	GitSync *v1alpha1.NginxGitSync `json:"gitSync,omitempty"`
+	// Strategy is the deployment strategy used to replace the nginx pods.
+	// Not supported with WorkloadKindRollout, whose strategy is set by
+	// Rollout.
+	// +optional
+	Strategy *appv1.DeploymentStrategy `json:"strategy,omitempty"`
+	// RevisionHistoryLimit is the number of old ReplicaSets kept to allow
+	// rollbacks. Defaults to the operator default, or to the Kubernetes
+	// default.
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// MinReadySeconds is the minimum number of seconds a new pod must be
+	// ready, without any of its containers crashing, to be considered
+	// available.
+	// +optional
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+	// ProgressDeadlineSeconds is the number of seconds a rollout may take to
+	// make progress before it is reported as failed. Only supported with
+	// WorkloadKindDeployment and WorkloadKindRollout. Defaults to the
+	// operator default, or to the Kubernetes default.
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+	// CachePolicy declares the proxy cache zones used by proxy locations.
+	// +optional
+	CachePolicy *v1alpha1.NginxCachePolicy `json:"cachePolicy,omitempty"`
+	// Cache mounts a volume for the proxy cache in the nginx container.
+	// +optional
+	Cache *v1alpha1.NginxCache `json:"cache,omitempty"`
+	// NginxArgs are extra arguments of the nginx binary.
+	// +optional
+	NginxArgs *v1alpha1.NginxArgs `json:"nginxArgs,omitempty"`
+	// Modules are dynamic modules copied from their images into the nginx
+	// pods by init containers and loaded with load_module.
+	// +optional
+	Modules []v1alpha1.NginxModule `json:"modules,omitempty"`
+	// WaitFor are upstreams the nginx pods wait for before starting, each
+	// one checked by an init container until it is reachable.
+	// +optional
+	WaitFor []v1alpha1.NginxWaitFor `json:"waitFor,omitempty"`
+	// OverloadProtection limits the connections and requests served by
+	// each pod, answering the excess with 503, so instances degrade
+	// gracefully during traffic spikes.
+	// +optional
+	OverloadProtection *v1alpha1.NginxOverloadProtection `json:"overloadProtection,omitempty"`
+	// Logging configures the format and level of the nginx logs, and where
+	// the access log is shipped to.
+	// +optional
+	Logging *v1alpha1.NginxLogging `json:"logging,omitempty"`
+	// UnknownHosts restricts the server generated by the operator to the
+	// given hostnames, answering the requests for other hosts from a
+	// catch-all default server. Not supported with custom configs.
+	// +optional
+	UnknownHosts *v1alpha1.NginxUnknownHosts `json:"unknownHosts,omitempty"`
+	// Security adds a vetted set of security headers, like HSTS, to the
+	// responses of the server generated by the operator.
+	// +optional
+	Security *v1alpha1.NginxSecurity `json:"security,omitempty"`
+	// Auth restricts the access to the server generated by the operator.
+	// +optional
+	Auth *v1alpha1.NginxAuth `json:"auth,omitempty"`
+	// ServiceAccount runs the nginx pods under an existing service account,
+	// or under one created for the nginx with the given permissions,
+	// instead of the default service account of the namespace.
+	// +optional
+	ServiceAccount *v1alpha1.NginxServiceAccount `json:"serviceAccount,omitempty"`
+	// SLO creates a Prometheus Operator PrometheusRule recording the error
+	// and slow request ratios of the nginx and alerting when they burn its
+	// error budget too fast. Requires spec.metrics.upstreams.
+	// +optional
+	SLO *v1alpha1.NginxSLO `json:"slo,omitempty"`
+	// DNS publishes hostnames pointing to the nginx through external-dns.
+	// +optional
+	DNS *v1alpha1.NginxDNS `json:"dns,omitempty"`
+	// Endpoints publishes the addresses of the ready nginx pods in the
+	// status, for load balancers outside the cluster sending traffic to the
+	// pods directly.
+	// +optional
+	Endpoints *v1alpha1.NginxEndpoints `json:"endpoints,omitempty"`
+	// AppProtocol served by the default server on the http and https
+	// ports: http, http2 for cleartext HTTP/2 (h2c) or grpc. Defaults to
+	// http.
+	// +optional
+	AppProtocol v1alpha1.AppProtocol `json:"appProtocol,omitempty"`
+	// Rootless runs nginx as a non-root user on the ports 8080 and 8443,
+	// with a read-only root filesystem and no capabilities, for namespaces
+	// enforcing the restricted Pod Security Standard.
+	// +optional
+	Rootless bool `json:"rootless,omitempty"`
+	// Service configures the services exposing the nginx pods.
+	// +optional
+	Service *v1alpha1.NginxServiceSpec `json:"service,omitempty"`
+	// Profiles are overlays of the spec for each environment. The profile
+	// selected by the nginx.tsuru.io/profile label of the namespace, or else
+	// by the operator --profile flag, is merged into the spec when
+	// reconciling.
+	// +optional
+	Profiles map[string]v1alpha1.NginxProfile `json:"profiles,omitempty"`
+	// NodeRemediation replaces the nginx pods running on unhealthy nodes,
+	// like nodes that stopped reporting or that the node-problem-detector
+	// flagged, instead of waiting for Kubernetes to evict them.
+	// +optional
+	NodeRemediation *v1alpha1.NginxNodeRemediation `json:"nodeRemediation,omitempty"`
+	// Lifecycle configures the hooks of the nginx container and how long
+	// the pods have to drain their connections when stopped.
+	// +optional
+	Lifecycle *v1alpha1.NginxLifecycle `json:"lifecycle,omitempty"`
+	// MaxUnavailable is the number or percentage of nginx pods that can be
+	// unavailable at the same time because of the operator actions, like
+	// the rollouts of new configs and restarts, node remediation and
+	// workload kind migrations, on top of the deployment strategy.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// Retention bounds the events recorded for the nginx and the history
+	// kept in its status, removed by the operator periodically.
+	// +optional
+	Retention *v1alpha1.NginxRetention `json:"retention,omitempty"`
+	// SpecHistoryLimit is the number of previous specs kept in
+	// ControllerRevisions, besides the current one, to be restored with
+	// rollbackTo. Defaults to 10.
+	// +optional
+	SpecHistoryLimit *int32 `json:"specHistoryLimit,omitempty"`
+	// RollbackTo restores the spec of a revision of the history. The
+	// operator replaces the spec with the one of the revision, which clears
+	// this field.
+	// +optional
+	RollbackTo *v1alpha1.NginxRollback `json:"rollbackTo,omitempty"`
+	// ApplyMode is how changes to the spec are applied to the objects of
+	// the nginx. Defaults to ApplyModeAutomatic.
+	// +optional
+	ApplyMode v1alpha1.ApplyMode `json:"applyMode,omitempty"`
+	// Paused stops the operator from reconciling the objects of the nginx,
+	// which can then be changed by hand, like during an incident. The
+	// status is still updated. Unpausing reverts the manual changes.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// NginxTLS is a reference to tls certificate and key pairs stored in a
+// secret.
+type NginxTLS struct {
+	// Name of the Secret holding the certificate and key.
+	SecretName string `json:"secretName"`
+	// Secret field that contains the key. Defaults to tls.key.
+	// +optional
+	KeyField string `json:"keyField,omitempty"`
+	// Secret field that contains the certificate. Defaults to tls.crt.
+	// +optional
+	CertificateField string `json:"certificateField,omitempty"`
+	// Path where the key is mounted in the nginx container, relative to
+	// /etc/nginx/certs/. Defaults to the key field.
+	// +optional
+	KeyPath string `json:"keyPath,omitempty"`
+	// Path where the certificate is mounted in the nginx container,
+	// relative to /etc/nginx/certs/. Defaults to the certificate field.
+	// +optional
+	CertificatePath string `json:"certificatePath,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type NginxList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []Nginx `json:"items"`
+}
@@ -0,0 +1,255 @@
+// Package controller feeds the events of the watched objects to the operator
+// handler through a single rate limited workqueue. It replaces the informers
+// of the SDK, which reconcile every object at each resync, one at a time.
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// QueueName is the name of the workqueue in its metrics
+	QueueName = "nginx-operator"
+
+	// baseBackoff is the delay of the first retry of a failed object, doubled
+	// on each following failure
+	baseBackoff = time.Second
+
+	// resyncJitter spreads the resyncs of the objects over a tenth of the
+	// resync period, so they are not all reconciled at the same time
+	resyncJitter = 0.1
+)
+
+// Handler handles an event of a watched object. Failed events are retried
+// with an exponential backoff.
+type Handler func(ctx context.Context, obj runtime.Object, deleted bool) error
+
+// Options configure how the events are handled
+type Options struct {
+	// Workers is the number of objects handled concurrently. The same object
+	// is never handled by two workers at once.
+	Workers int
+	// QPS is the sustained number of objects handled per second, Burst the
+	// number handled at once after a quiet period
+	QPS   float32
+	Burst int
+	// MaxBackoff is the longest delay between the retries of a failed object
+	MaxBackoff time.Duration
+}
+
+// Validate returns an error if the options can not be used
+func (o Options) Validate() error {
+	if o.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1")
+	}
+	if o.QPS <= 0 {
+		return fmt.Errorf("qps must be greater than 0")
+	}
+	if o.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1")
+	}
+	if o.MaxBackoff < baseBackoff {
+		return fmt.Errorf("max backoff must be at least %s", baseBackoff)
+	}
+	return nil
+}
+
+// Controller watches objects and hands their events to the handler
+type Controller struct {
+	logger    logrus.FieldLogger
+	handler   Handler
+	opts      Options
+	queue     workqueue.RateLimitingInterface
+	limiter   flowcontrol.RateLimiter
+	informers []*informer
+}
+
+// informer caches the objects of a kind in a namespace
+type informer struct {
+	kind   string
+	resync time.Duration
+	shared cache.SharedIndexInformer
+
+	mu sync.Mutex
+	// deleted holds the last known state of the deleted objects until their
+	// deletion is handled
+	deleted map[string]*unstructured.Unstructured
+}
+
+// item is an object in the queue
+type item struct {
+	informer *informer
+	key      string
+}
+
+// New returns a controller handing the events to the handler
+func New(logger logrus.FieldLogger, handler Handler, opts Options) (*Controller, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return &Controller{
+		logger:  logger,
+		handler: handler,
+		opts:    opts,
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(baseBackoff, opts.MaxBackoff), QueueName),
+		limiter: flowcontrol.NewTokenBucketRateLimiter(opts.QPS, opts.Burst),
+	}, nil
+}
+
+// ListWatch lists and watches the objects of the resource client
+func ListWatch(client dynamic.ResourceInterface) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.Watch(options)
+		},
+	}
+}
+
+// Watch hands the events of the objects of the kind to the handler. Objects
+// are handled again every resync period after they were last handled, zero
+// to only handle their changes. Watch must be called before Run.
+func (c *Controller) Watch(kind string, lw cache.ListerWatcher, resync time.Duration) {
+	i := &informer{
+		kind:    kind,
+		resync:  resync,
+		deleted: make(map[string]*unstructured.Unstructured),
+		// The informer itself never resyncs, the objects are requeued one
+		// by one once handled
+		shared: cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{}),
+	}
+	i.shared.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.enqueue(i, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			c.enqueue(i, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			key, err := cache.MetaNamespaceKeyFunc(u)
+			if err != nil {
+				c.logger.Errorf("invalid deleted %s: %v", i.kind, err)
+				return
+			}
+			i.mu.Lock()
+			i.deleted[key] = u.DeepCopy()
+			i.mu.Unlock()
+			c.queue.Add(item{informer: i, key: key})
+		},
+	})
+	c.informers = append(c.informers, i)
+}
+
+func (c *Controller) enqueue(i *informer, obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.logger.Errorf("invalid %s: %v", i.kind, err)
+		return
+	}
+	c.queue.Add(item{informer: i, key: key})
+}
+
+// Run starts the informers and handles the events until the context is done
+func (c *Controller) Run(ctx context.Context) error {
+	defer c.queue.ShutDown()
+	synced := make([]cache.InformerSynced, 0, len(c.informers))
+	for _, i := range c.informers {
+		go i.shared.Run(ctx.Done())
+		synced = append(synced, i.shared.HasSynced)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("failed to wait for the caches to sync")
+	}
+	c.logger.Infof("Handling events with %d workers", c.opts.Workers)
+	for n := 0; n < c.opts.Workers; n++ {
+		go wait.Until(func() { c.runWorker(ctx) }, time.Second, ctx.Done())
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	obj, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(obj)
+	it := obj.(item)
+
+	c.limiter.Accept()
+	exists, err := c.handle(ctx, it)
+	if err != nil {
+		c.logger.Warnf("failed to handle %s %s, retry %d: %v", it.informer.kind, it.key, c.queue.NumRequeues(it)+1, err)
+		c.queue.AddRateLimited(it)
+		return true
+	}
+	c.queue.Forget(it)
+	if exists && it.informer.resync > 0 {
+		c.queue.AddAfter(it, wait.Jitter(it.informer.resync, resyncJitter))
+	}
+	return true
+}
+
+// handle hands the current state of the object to the handler, or its last
+// known state once deleted, returning whether it still exists
+func (c *Controller) handle(ctx context.Context, it item) (bool, error) {
+	i := it.informer
+	obj, exists, err := i.shared.GetIndexer().GetByKey(it.key)
+	if err != nil {
+		return false, err
+	}
+	i.mu.Lock()
+	last, ok := i.deleted[it.key]
+	if exists {
+		// The object was created again before its deletion was handled
+		delete(i.deleted, it.key)
+	}
+	i.mu.Unlock()
+	if !exists {
+		if !ok {
+			return false, nil
+		}
+		obj = last
+	}
+
+	object := k8sutil.RuntimeObjectFromUnstructured(obj.(*unstructured.Unstructured).DeepCopy())
+	if err := c.handler(ctx, object, !exists); err != nil {
+		return exists, err
+	}
+	if !exists {
+		i.mu.Lock()
+		delete(i.deleted, it.key)
+		i.mu.Unlock()
+	}
+	return exists, nil
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+type event struct {
+	name    string
+	deleted bool
+}
+
+type recorder struct {
+	mu       sync.Mutex
+	events   []event
+	failures map[string]int
+}
+
+func (r *recorder) handle(ctx context.Context, obj runtime.Object, deleted bool) error {
+	cm := obj.(*corev1.ConfigMap)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event{name: cm.Name, deleted: deleted})
+	if r.failures[cm.Name] > 0 {
+		r.failures[cm.Name]--
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (r *recorder) count(e event) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, got := range r.events {
+		if got == e {
+			n++
+		}
+	}
+	return n
+}
+
+func configMap(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "default",
+			"resourceVersion": "1",
+		},
+	}}
+}
+
+func fakeListWatch(watcher watch.Interface, objs ...*unstructured.Unstructured) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list := &unstructured.UnstructuredList{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMapList",
+				"metadata":   map[string]interface{}{"resourceVersion": "1"},
+			}}
+			for _, obj := range objs {
+				list.Items = append(list.Items, *obj)
+			}
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watcher, nil
+		},
+	}
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestController(t *testing.T) {
+	r := &recorder{failures: map[string]int{"flaky": 1}}
+	c, err := New(logrus.New(), r.handle, Options{Workers: 2, QPS: 100, Burst: 10, MaxBackoff: time.Minute})
+	assert.NoError(t, err)
+
+	resynced := watch.NewFake()
+	changed := watch.NewFake()
+	c.Watch("ConfigMap", fakeListWatch(resynced, configMap("resynced")), 100*time.Millisecond)
+	c.Watch("ConfigMap", fakeListWatch(changed, configMap("flaky"), configMap("deleted")), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	// Objects of informers with a resync period are handled again once it
+	// elapses
+	eventually(t, func() bool { return r.count(event{name: "resynced"}) >= 3 })
+
+	// Failed objects are retried with a backoff
+	eventually(t, func() bool { return r.count(event{name: "flaky"}) == 2 })
+
+	// Deleted objects are handled with their last known state, the other
+	// objects only once without a resync period
+	changed.Delete(configMap("deleted"))
+	eventually(t, func() bool { return r.count(event{name: "deleted", deleted: true}) == 1 })
+	assert.Equal(t, 1, r.count(event{name: "deleted"}))
+	assert.Equal(t, 2, r.count(event{name: "flaky"}))
+}
+
+func TestOptionsValidate(t *testing.T) {
+	valid := Options{Workers: 1, QPS: 10, Burst: 100, MaxBackoff: time.Minute}
+	tests := []struct {
+		change func(*Options)
+		err    string
+	}{
+		{func(o *Options) {}, ""},
+		{func(o *Options) { o.Workers = 0 }, "workers must be at least 1"},
+		{func(o *Options) { o.QPS = 0 }, "qps must be greater than 0"},
+		{func(o *Options) { o.Burst = 0 }, "burst must be at least 1"},
+		{func(o *Options) { o.MaxBackoff = time.Millisecond }, "max backoff must be at least 1s"},
+	}
+	for _, tt := range tests {
+		opts := valid
+		tt.change(&opts)
+		err := opts.Validate()
+		if tt.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ApproveApplyAnnotation approves the changes pending with the Manual apply
+// mode when set on the nginx to their revision
+const ApproveApplyAnnotation = "nginx.tsuru.io/approve-apply"
+
+// ApplyRevision identifies the changes made by the spec to the objects of
+// the nginx. The apply mode is left out, so switching it does not require an
+// approval by itself.
+func ApplyRevision(spec *v1alpha1.NginxSpec) (string, error) {
+	s := spec.DeepCopy()
+	s.ApplyMode = ""
+	hash, err := SpecHash(*s)
+	if err != nil {
+		return "", err
+	}
+	return hash[:16], nil
+}
+
+// ApplyApproved returns whether the changes of the revision were approved
+// through ApproveApplyAnnotation
+func ApplyApproved(n *v1alpha1.Nginx, revision string) bool {
+	return n.Annotations[ApproveApplyAnnotation] == revision
+}
+
+// PlannedChange summarizes the change applying the desired object makes to
+// the current one, either of which may be nil when the object is created or
+// deleted. It returns an empty string when nothing changes. Workloads built
+// by the operator also differ by their generated hash, which covers the pod
+// template fields left out of their drift.
+func PlannedChange(kind, name string, desired, current runtime.Object) string {
+	switch {
+	case desired == nil && current == nil:
+		return ""
+	case desired == nil:
+		return fmt.Sprintf("delete %s %s", kind, name)
+	case current == nil:
+		return fmt.Sprintf("create %s %s", kind, name)
+	}
+	fields := ObjectDrift(desired, current)
+	d, dok := desired.(metav1.Object)
+	c, cok := current.(metav1.Object)
+	if dok && cok {
+		dh, dhok := GeneratedHashOf(d)
+		ch, chok := GeneratedHashOf(c)
+		if dhok && chok && dh != ch && (len(fields) == 0 || (len(fields) == 1 && fields[0] == "replicas")) {
+			if dh.Template != ch.Template {
+				fields = append(fields, "podTemplate")
+			} else if len(fields) == 0 {
+				fields = append(fields, "spec")
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("update %s %s: %s", kind, name, strings.Join(fields, ", "))
+}
+
+// validateApplyMode returns the errors found in spec.applyMode
+func validateApplyMode(spec *v1alpha1.NginxSpec) []string {
+	switch spec.ApplyMode {
+	case "", v1alpha1.ApplyModeAutomatic, v1alpha1.ApplyModeManual:
+		return nil
+	}
+	return []string{fmt.Sprintf("spec.applyMode %q must be Automatic or Manual", spec.ApplyMode)}
+}
@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestApplyRevision(t *testing.T) {
+	nginx := baseNginx()
+	revision, err := ApplyRevision(&nginx.Spec)
+	assert.Nil(t, err)
+	assert.Len(t, revision, 16)
+
+	nginx.Spec.ApplyMode = v1alpha1.ApplyModeManual
+	manual, err := ApplyRevision(&nginx.Spec)
+	assert.Nil(t, err)
+	assert.Equal(t, revision, manual)
+	assert.Equal(t, v1alpha1.ApplyModeManual, nginx.Spec.ApplyMode)
+
+	nginx.Spec.Image = "nginx:1.25"
+	changed, err := ApplyRevision(&nginx.Spec)
+	assert.Nil(t, err)
+	assert.NotEqual(t, revision, changed)
+
+	assert.False(t, ApplyApproved(&nginx, changed))
+	nginx.Annotations = map[string]string{ApproveApplyAnnotation: changed}
+	assert.True(t, ApplyApproved(&nginx, changed))
+	assert.False(t, ApplyApproved(&nginx, revision))
+}
+
+func TestPlannedChange(t *testing.T) {
+	nginx := baseNginx()
+	current, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	nginx.Spec.Image = "nginx:1.25"
+	image, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	nginx = baseNginx()
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindConfigMap, Name: "my-config"}
+	replicas := int32(3)
+	nginx.Spec.Replicas = &replicas
+	config, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	service := NewService(&nginx)
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "my-tls"}
+	tlsService := NewService(&nginx)
+
+	tests := []struct {
+		name             string
+		desired, current runtime.Object
+		want             string
+	}{
+		{name: "none"},
+		{name: "create", desired: current, want: "create Deployment my-nginx-deployment"},
+		{name: "delete", current: current, want: "delete Deployment my-nginx-deployment"},
+		{name: "unchanged", desired: current, current: current.DeepCopy()},
+		{name: "image", desired: image, current: current, want: "update Deployment my-nginx-deployment: image"},
+		{name: "pod-template", desired: config, current: current, want: "update Deployment my-nginx-deployment: replicas, podTemplate"},
+		{name: "service", desired: tlsService, current: service, want: "update Service my-nginx-service: ports"},
+		{name: "kind", desired: current, current: &appv1.StatefulSet{}, want: "update Deployment my-nginx-deployment: kind"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, name := "Deployment", "my-nginx-deployment"
+			if _, ok := tt.desired.(*corev1.Service); ok {
+				kind, name = "Service", "my-nginx-service"
+			}
+			assert.Equal(t, tt.want, PlannedChange(kind, name, tt.desired, tt.current))
+		})
+	}
+}
+
+func TestValidateApplyMode(t *testing.T) {
+	assert.Nil(t, validateApplyMode(&v1alpha1.NginxSpec{}))
+	assert.Nil(t, validateApplyMode(&v1alpha1.NginxSpec{ApplyMode: v1alpha1.ApplyModeManual}))
+	assert.Equal(t, []string{`spec.applyMode "manual" must be Automatic or Manual`},
+		validateApplyMode(&v1alpha1.NginxSpec{ApplyMode: "manual"}))
+}
@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// http2AppProtocol returns whether the protocol is served over HTTP/2 only,
+// failing the HTTP/1.1 requests of the kubelet probes
+func http2AppProtocol(p v1alpha1.AppProtocol) bool {
+	return p == v1alpha1.AppProtocolHTTP2 || p == v1alpha1.AppProtocolGRPC
+}
+
+// httpPortName returns the name of the http port of the nginx container and
+// service. Ports serving HTTP/2 only are named after their protocol, the
+// convention used by service meshes to detect it, since the Kubernetes API
+// the operator is built against has no appProtocol field.
+func httpPortName(spec *v1alpha1.NginxSpec) string {
+	if http2AppProtocol(spec.AppProtocol) {
+		return string(spec.AppProtocol)
+	}
+	return defaultHTTPPortName
+}
+
+// servicePortName returns the name of the service port of a port of the pod
+// template, prefixed by its app protocol unless it already is
+func servicePortName(p v1alpha1.NginxPort) string {
+	proto := string(p.AppProtocol)
+	if proto == "" || p.Name == proto || strings.HasPrefix(p.Name, proto+"-") {
+		return p.Name
+	}
+	return proto + "-" + p.Name
+}
+
+// appProtocolListen returns the parameter added to the listen directives of
+// the default server
+func appProtocolListen(spec *v1alpha1.NginxSpec) string {
+	if http2AppProtocol(spec.AppProtocol) {
+		return " http2"
+	}
+	return ""
+}
+
+// setupAppProtocol replaces the HTTP probes of the nginx container targeting
+// ports serving HTTP/2 only by TCP ones, since the kubelet probes speak
+// HTTP/1.1 and the gRPC probes are not part of the Kubernetes API the
+// operator is built against. It must run after setupProbes. The spec must
+// have its default values already set.
+func setupAppProtocol(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	nginx := &dep.Spec.Template.Spec.Containers[0]
+	// Probes may refer to the ports by name or number
+	http2Ports := make(map[string]bool)
+	if http2AppProtocol(spec.AppProtocol) {
+		httpPort, httpsPort := listenPorts(spec)
+		for _, port := range []string{httpPortName(spec), defaultHTTPSPortName, fmt.Sprint(httpPort), fmt.Sprint(httpsPort)} {
+			http2Ports[port] = true
+		}
+	}
+	for _, p := range spec.PodTemplate.Ports {
+		if http2AppProtocol(p.AppProtocol) {
+			http2Ports[p.Name] = true
+			http2Ports[fmt.Sprint(p.ContainerPort)] = true
+		}
+	}
+	if len(http2Ports) == 0 {
+		return
+	}
+	for _, probe := range []*corev1.Probe{nginx.ReadinessProbe, nginx.LivenessProbe} {
+		if probe == nil || probe.HTTPGet == nil || !http2Ports[probe.HTTPGet.Port.String()] {
+			continue
+		}
+		probe.TCPSocket = &corev1.TCPSocketAction{Port: probe.HTTPGet.Port}
+		probe.HTTPGet = nil
+	}
+}
+
+// validateAppProtocols returns the errors found in the app protocols of the
+// spec
+func validateAppProtocols(spec *v1alpha1.NginxSpec) []string {
+	var errs []string
+	if !validAppProtocol(spec.AppProtocol) {
+		errs = append(errs, fmt.Sprintf("spec.appProtocol %q is not supported", spec.AppProtocol))
+	}
+	names := make(map[string]bool)
+	for _, p := range spec.PodTemplate.Ports {
+		names[p.Name] = true
+	}
+	for i, p := range spec.PodTemplate.Ports {
+		if name := servicePortName(p); name != p.Name && names[name] {
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.ports[%d] service port name %q is already used by another port", i, name))
+		}
+		if !validAppProtocol(p.AppProtocol) {
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.ports[%d].appProtocol %q is not supported", i, p.AppProtocol))
+		}
+		if p.AppProtocol != "" && p.Protocol == corev1.ProtocolUDP {
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.ports[%d].appProtocol cannot be set on UDP ports", i))
+		}
+	}
+	return errs
+}
+
+func validAppProtocol(p v1alpha1.AppProtocol) bool {
+	switch p {
+	case "", v1alpha1.AppProtocolHTTP, v1alpha1.AppProtocolHTTP2, v1alpha1.AppProtocolGRPC:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestAppProtocol(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.AppProtocol = v1alpha1.AppProtocolGRPC
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "tls"}
+	nginx.Spec.Locations = []v1alpha1.NginxLocation{{Path: "/", Return: &v1alpha1.ReturnAction{Code: 200}}}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	container := dep.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "grpc", container.Ports[0].Name)
+	assert.Equal(t, &corev1.Probe{
+		Handler: corev1.Handler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("https")}},
+	}, container.ReadinessProbe)
+	conf := defaultServer(&nginx)
+	assert.Contains(t, conf, "    listen 80 http2;\n")
+	assert.Contains(t, conf, "    listen 443 ssl http2;\n")
+
+	svc := NewService(&nginx)
+	assert.Equal(t, "grpc", svc.Spec.Ports[0].Name)
+	assert.Equal(t, intstr.FromString("grpc"), svc.Spec.Ports[0].TargetPort)
+
+	nginx.Spec.Ingress = &v1alpha1.NginxIngress{}
+	assert.Equal(t, intstr.FromString("grpc"), NewIngress(&nginx).Spec.Rules[0].HTTP.Paths[0].Backend.ServicePort)
+}
+
+func TestAppProtocolPorts(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.PodTemplate.Ports = []v1alpha1.NginxPort{
+		{Name: "api", ContainerPort: 9000, AppProtocol: v1alpha1.AppProtocolHTTP2},
+		{Name: "grpc-admin", ContainerPort: 9001, AppProtocol: v1alpha1.AppProtocolGRPC},
+		{Name: "web", ContainerPort: 9002, AppProtocol: v1alpha1.AppProtocolHTTP},
+	}
+	port := intstr.FromInt(9000)
+	nginx.Spec.Healthcheck = &v1alpha1.NginxHealthcheck{
+		Readiness: &v1alpha1.NginxProbe{Port: &port},
+		Liveness:  &v1alpha1.NginxProbe{Path: "/healthz"},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	container := dep.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "http", container.Ports[0].Name)
+	assert.Equal(t, "api", container.Ports[1].Name)
+	assert.Nil(t, container.ReadinessProbe.HTTPGet)
+	assert.Equal(t, &corev1.TCPSocketAction{Port: port}, container.ReadinessProbe.TCPSocket)
+	assert.Equal(t, "/healthz", container.LivenessProbe.HTTPGet.Path)
+	assert.NotContains(t, defaultServer(&nginx), "http2")
+
+	var names []string
+	for _, p := range NewService(&nginx).Spec.Ports {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"http", "http2-api", "grpc-admin", "http-web"}, names)
+}
+
+func TestValidateAppProtocols(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "unset"},
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{
+				AppProtocol: v1alpha1.AppProtocolHTTP2,
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{Ports: []v1alpha1.NginxPort{{Name: "api", ContainerPort: 9000, AppProtocol: v1alpha1.AppProtocolGRPC}}},
+			},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{
+				AppProtocol: "h3",
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{Ports: []v1alpha1.NginxPort{
+					{Name: "dns", ContainerPort: 53, Protocol: corev1.ProtocolUDP, AppProtocol: "grpc-web"},
+					{Name: "api", ContainerPort: 9000, AppProtocol: v1alpha1.AppProtocolGRPC},
+					{Name: "grpc-api", ContainerPort: 9001},
+				}},
+			},
+			want: []string{
+				`spec.appProtocol "h3" is not supported`,
+				`spec.podTemplate.ports[0].appProtocol "grpc-web" is not supported`,
+				"spec.podTemplate.ports[0].appProtocol cannot be set on UDP ports",
+				`spec.podTemplate.ports[1] service port name "grpc-api" is already used by another port`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateAppProtocols(&tt.spec))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	// Pod annotation holding the server context directives authorizing the
+	// requests
+	authConfigAnnotation = "nginx.tsuru.io/auth-conf"
+
+	// externalAuthLocation is the internal location requested by the
+	// auth_request subrequests
+	externalAuthLocation = "/_nginx_operator_auth"
+)
+
+// setupAuth renders the external auth subrequest and its location into
+// /etc/nginx-operator/auth.conf, which must be included in the server
+// contexts. The spec must have its default values already set.
+func setupAuth(spec *v1alpha1.NginxSpec, namespace string, dep *appv1.Deployment) {
+	if conf := renderAuth(spec, namespace); conf != "" {
+		addOperatorConfig(dep, authConfigAnnotation, "auth.conf", conf)
+	}
+}
+
+// renderAuth renders the auth_request directive and the internal location
+// proxying the subrequests to the external auth service. The body of the
+// requests is not sent, so the answers only depend on the headers, and they
+// are cached in the zone of the cache policy when requested.
+func renderAuth(spec *v1alpha1.NginxSpec, namespace string) string {
+	if spec.Auth == nil || spec.Auth.External == nil {
+		return ""
+	}
+	e := spec.Auth.External
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "auth_request %s;\n", externalAuthLocation)
+	fmt.Fprintf(&buf, "location = %s {\n    internal;\n", externalAuthLocation)
+	buf.WriteString("    proxy_pass_request_body off;\n")
+	buf.WriteString("    proxy_set_header Content-Length \"\";\n")
+	buf.WriteString("    proxy_set_header X-Original-URI $request_uri;\n")
+	buf.WriteString("    proxy_set_header X-Original-Method $request_method;\n")
+	if c := e.Cache; c != nil {
+		fmt.Fprintf(&buf, "    proxy_cache %s;\n", c.Zone)
+		fmt.Fprintf(&buf, "    proxy_cache_key %s;\n", quote(c.Key))
+		fmt.Fprintf(&buf, "    proxy_cache_valid 200 202 204 401 403 %s;\n", c.TTL)
+		// Auth services usually answer with no-cache headers, and their
+		// answers are not forwarded to the clients
+		buf.WriteString("    proxy_ignore_headers Cache-Control Expires Set-Cookie;\n")
+		buf.WriteString("    proxy_cache_lock on;\n")
+	}
+	fmt.Fprintf(&buf, "    proxy_pass http://%s.%s.svc:%d%s;\n}\n", e.Service, namespace, e.Port, e.Path)
+	return buf.String()
+}
+
+// validateAuth returns the errors found in the auth of the spec
+func validateAuth(spec *v1alpha1.NginxSpec) []string {
+	if spec.Auth == nil || spec.Auth.External == nil {
+		return nil
+	}
+	e := spec.Auth.External
+	var errs []string
+	if e.Service == "" {
+		errs = append(errs, "spec.auth.external.service is required")
+	}
+	if e.Port < 1 || e.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("spec.auth.external.port %d is out of range", e.Port))
+	}
+	if e.Path != "" && (!strings.HasPrefix(e.Path, "/") || strings.ContainsAny(e.Path, " \t\n{};\"'")) {
+		errs = append(errs, fmt.Sprintf("spec.auth.external.path %q must be an absolute path", e.Path))
+	}
+	for i, l := range spec.Locations {
+		if l.Path == externalAuthLocation {
+			errs = append(errs, fmt.Sprintf("spec.locations[%d].path %s is reserved for the external auth", i, l.Path))
+		}
+	}
+	c := e.Cache
+	if c == nil {
+		return errs
+	}
+	if _, ok := cacheZones(spec)[c.Zone]; !ok {
+		errs = append(errs, fmt.Sprintf("spec.auth.external.cache.zone %q is not a zone of spec.cachePolicy", c.Zone))
+	}
+	if strings.ContainsAny(c.Key, "\n{};") {
+		errs = append(errs, fmt.Sprintf("spec.auth.external.cache.key %q must not contain braces or semicolons", c.Key))
+	}
+	if c.TTL != "" && !nginxTimeRegexp.MatchString(c.TTL) {
+		errs = append(errs, fmt.Sprintf("spec.auth.external.cache.ttl %q is not a valid time", c.TTL))
+	}
+	return errs
+}
@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestExternalAuth(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Auth = &v1alpha1.NginxAuth{External: &v1alpha1.NginxExternalAuth{Service: "oauth2-proxy", Port: 4180}}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, `auth_request /_nginx_operator_auth;
+location = /_nginx_operator_auth {
+    internal;
+    proxy_pass_request_body off;
+    proxy_set_header Content-Length "";
+    proxy_set_header X-Original-URI $request_uri;
+    proxy_set_header X-Original-Method $request_method;
+    proxy_pass http://oauth2-proxy.default.svc:4180/;
+}
+`, annotations[authConfigAnnotation])
+	assert.Contains(t, defaultServer(&nginx), "    include /etc/nginx-operator/auth.conf;\n")
+
+	nginx.Spec.CachePolicy = &v1alpha1.NginxCachePolicy{Zones: []v1alpha1.NginxCacheZone{{Name: "auth"}}}
+	nginx.Spec.Auth.External.Path = "/oauth2/auth"
+	nginx.Spec.Auth.External.Cache = &v1alpha1.NginxExternalAuthCache{Zone: "auth"}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, `auth_request /_nginx_operator_auth;
+location = /_nginx_operator_auth {
+    internal;
+    proxy_pass_request_body off;
+    proxy_set_header Content-Length "";
+    proxy_set_header X-Original-URI $request_uri;
+    proxy_set_header X-Original-Method $request_method;
+    proxy_cache auth;
+    proxy_cache_key "$http_authorization$http_cookie";
+    proxy_cache_valid 200 202 204 401 403 1m;
+    proxy_ignore_headers Cache-Control Expires Set-Cookie;
+    proxy_cache_lock on;
+    proxy_pass http://oauth2-proxy.default.svc:4180/oauth2/auth;
+}
+`, dep.Spec.Template.Annotations[authConfigAnnotation])
+
+	nginx.Spec.Auth = &v1alpha1.NginxAuth{}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, authConfigAnnotation)
+	assert.NotContains(t, defaultServer(&nginx), "auth.conf")
+}
+
+func TestValidateAuth(t *testing.T) {
+	zones := &v1alpha1.NginxCachePolicy{Zones: []v1alpha1.NginxCacheZone{{Name: "auth"}}}
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "none"},
+		{name: "empty", spec: v1alpha1.NginxSpec{Auth: &v1alpha1.NginxAuth{}}},
+		{
+			name: "cached",
+			spec: v1alpha1.NginxSpec{
+				CachePolicy: zones,
+				Auth: &v1alpha1.NginxAuth{External: &v1alpha1.NginxExternalAuth{
+					Service: "auth",
+					Port:    80,
+					Path:    "/verify",
+					Cache:   &v1alpha1.NginxExternalAuthCache{Zone: "auth", Key: "$http_authorization$request_uri", TTL: "30s"},
+				}},
+			},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{
+				Locations: []v1alpha1.NginxLocation{{Path: "/_nginx_operator_auth"}},
+				Auth: &v1alpha1.NginxAuth{External: &v1alpha1.NginxExternalAuth{
+					Port:  70000,
+					Path:  "verify; return 200",
+					Cache: &v1alpha1.NginxExternalAuthCache{Zone: "auth", Key: "${cookie}", TTL: "soon"},
+				}},
+			},
+			want: []string{
+				"spec.auth.external.service is required",
+				"spec.auth.external.port 70000 is out of range",
+				`spec.auth.external.path "verify; return 200" must be an absolute path`,
+				"spec.locations[0].path /_nginx_operator_auth is reserved for the external auth",
+				`spec.auth.external.cache.zone "auth" is not a zone of spec.cachePolicy`,
+				`spec.auth.external.cache.key "${cookie}" must not contain braces or semicolons`,
+				`spec.auth.external.cache.ttl "soon" is not a valid time`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateAuth(&tt.spec))
+		})
+	}
+}
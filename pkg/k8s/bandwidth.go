@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+// renderBandwidth renders the rate and connection limits of the i-th location
+func renderBandwidth(buf *bytes.Buffer, b *v1alpha1.LocationBandwidth, i int) {
+	if b.Rate != "" {
+		fmt.Fprintf(buf, "    limit_rate %s;\n", b.Rate)
+	}
+	if b.RateAfter != "" {
+		fmt.Fprintf(buf, "    limit_rate_after %s;\n", b.RateAfter)
+	}
+	if b.MaxConnections > 0 {
+		fmt.Fprintf(buf, "    limit_conn location_%d_conn %d;\n", i, b.MaxConnections)
+	}
+	if b.MaxConnectionsPerClient > 0 {
+		fmt.Fprintf(buf, "    limit_conn location_%d_addr %d;\n", i, b.MaxConnectionsPerClient)
+	}
+}
+
+// renderConnectionZones renders the zones counting the connections of the
+// locations with connection limits. The zones of total connections use a
+// key with the same value for every request, so each zone has a single
+// counter.
+func renderConnectionZones(buf *bytes.Buffer, locations []v1alpha1.NginxLocation) {
+	for i, l := range locations {
+		b := l.Bandwidth
+		if b == nil {
+			continue
+		}
+		if b.MaxConnections > 0 {
+			fmt.Fprintf(buf, "limit_conn_zone $server_name zone=location_%d_conn:1m;\n", i)
+		}
+		if b.MaxConnectionsPerClient > 0 {
+			fmt.Fprintf(buf, "limit_conn_zone $binary_remote_addr zone=location_%d_addr:10m;\n", i)
+		}
+	}
+}
+
+// validateBandwidth returns the errors found in the bandwidth limits of a location
+func validateBandwidth(field string, b *v1alpha1.LocationBandwidth) []string {
+	if b == nil {
+		return nil
+	}
+	var errs []string
+	if b.Rate != "" && !nginxSizeRegexp.MatchString(b.Rate) {
+		errs = append(errs, fmt.Sprintf("%s.bandwidth.rate %q is not a valid size", field, b.Rate))
+	}
+	if b.RateAfter != "" && !nginxSizeRegexp.MatchString(b.RateAfter) {
+		errs = append(errs, fmt.Sprintf("%s.bandwidth.rateAfter %q is not a valid size", field, b.RateAfter))
+	}
+	if b.MaxConnections < 0 {
+		errs = append(errs, fmt.Sprintf("%s.bandwidth.maxConnections must not be negative", field))
+	}
+	if b.MaxConnectionsPerClient < 0 {
+		errs = append(errs, fmt.Sprintf("%s.bandwidth.maxConnectionsPerClient must not be negative", field))
+	}
+	return errs
+}
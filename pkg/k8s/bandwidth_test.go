@@ -0,0 +1,55 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestBandwidth(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Locations = []v1alpha1.NginxLocation{
+		{Path: "/api", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 8080}},
+		{Path: "/downloads", Static: &v1alpha1.StaticAction{ConfigMap: "files"}, Bandwidth: &v1alpha1.LocationBandwidth{
+			Rate:                    "500k",
+			RateAfter:               "10m",
+			MaxConnections:          100,
+			MaxConnectionsPerClient: 2,
+		}},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, `limit_conn_zone $server_name zone=location_1_conn:1m;
+limit_conn_zone $binary_remote_addr zone=location_1_addr:10m;
+`, annotations["nginx.tsuru.io/http-conf"])
+	assert.Equal(t, `location /api {
+    proxy_pass http://api.default.svc:8080;
+}
+location /downloads {
+    limit_rate 500k;
+    limit_rate_after 10m;
+    limit_conn location_1_conn 100;
+    limit_conn location_1_addr 2;
+    alias /usr/share/nginx/locations/1/;
+}
+`, annotations["nginx.tsuru.io/locations-conf"])
+	assert.Contains(t, defaultServer(&nginx), "include /etc/nginx-operator/http.conf;\nserver {\n")
+}
+
+func TestValidateBandwidth(t *testing.T) {
+	assert.Nil(t, validateBandwidth("spec.locations[0]", &v1alpha1.LocationBandwidth{Rate: "1m", MaxConnections: 10}))
+	assert.Equal(t, []string{
+		`spec.locations[0].bandwidth.rate "fast" is not a valid size`,
+		`spec.locations[0].bandwidth.rateAfter "1 m" is not a valid size`,
+		"spec.locations[0].bandwidth.maxConnections must not be negative",
+		"spec.locations[0].bandwidth.maxConnectionsPerClient must not be negative",
+	}, validateBandwidth("spec.locations[0]", &v1alpha1.LocationBandwidth{
+		Rate:                    "fast",
+		RateAfter:               "1 m",
+		MaxConnections:          -1,
+		MaxConnectionsPerClient: -1,
+	}))
+}
@@ -0,0 +1,164 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// builderNginx sets most of the spec fields, leaving the defaulted ones
+// empty, so builders writing back into their input are caught
+func builderNginx() *v1alpha1.Nginx {
+	replicas := int32(3)
+	weight := int32(20)
+	minAvailable := intstr.FromInt(1)
+	probePort := intstr.FromInt(8080)
+	return &v1alpha1.Nginx{
+		TypeMeta: metav1.TypeMeta{Kind: "Nginx", APIVersion: "nginx.tsuru.io/v1alpha1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-nginx",
+			Namespace:   "default",
+			Annotations: map[string]string{CachePurgeAnnotation: "purge-1"},
+		},
+		Spec: v1alpha1.NginxSpec{
+			Replicas:       &replicas,
+			Config:         &v1alpha1.ConfigRef{Name: "my-config", Kind: v1alpha1.ConfigKindConfigMap},
+			ConfigTemplate: &v1alpha1.NginxConfigTemplate{ConfigMap: "my-template"},
+			Values:         map[string]string{"worker": "4"},
+			ConfigFiles:    []v1alpha1.NginxConfigFile{{Name: "extra.conf", ConfigMap: "extra"}},
+			TLSSecret:      &v1alpha1.TLSSecret{SecretName: "my-secret"},
+			PodTemplate: v1alpha1.NginxPodTemplateSpec{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+				},
+				Affinity:        &corev1.Affinity{},
+				Ports:           []v1alpha1.NginxPort{{Name: "dns", ContainerPort: 53, Protocol: corev1.ProtocolUDP}},
+				Env:             []corev1.EnvVar{{Name: "TZ", Value: "UTC"}},
+				Volumes:         []corev1.Volume{{Name: "data"}},
+				VolumeMounts:    []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+				Containers:      []corev1.Container{{Name: "sidecar", Image: "busybox"}},
+				NodeSelector:    map[string]string{"pool": "edge"},
+				Tolerations:     []corev1.Toleration{{Key: "edge", Operator: corev1.TolerationOpExists}},
+				SecurityContext: &corev1.PodSecurityContext{},
+			},
+			Rollout: &v1alpha1.NginxRollout{
+				Canary:      &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{Weight: &weight}}},
+				CanaryPods:  1,
+				CanaryCheck: &v1alpha1.CanaryCheck{},
+			},
+			Flagger: &v1alpha1.FlaggerSpec{
+				PrometheusAddress: "http://prometheus:9090",
+				MetricTemplates:   []v1alpha1.FlaggerMetricTemplate{{Name: "errors", Query: "up"}},
+			},
+			Certificates: &v1alpha1.NginxCertificates{
+				IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt"},
+				DNSNames:  []string{"example.com"},
+			},
+			Metrics: &v1alpha1.NginxMetrics{
+				ServiceMonitor: &v1alpha1.NginxServiceMonitor{Labels: map[string]string{"team": "edge"}},
+			},
+			Ingress: &v1alpha1.NginxIngress{Hosts: []string{"example.com"}},
+			Locations: []v1alpha1.NginxLocation{
+				{Path: "/api", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 8080}, Options: map[string]string{"proxy_read_timeout": "30s"}},
+				{Path: "/php", FastCGI: &v1alpha1.FastCGIAction{}},
+			},
+			Snippets:            &v1alpha1.NginxSnippets{Location: "add_header X-Test 1;"},
+			PodDisruptionBudget: &v1alpha1.NginxPodDisruptionBudget{MinAvailable: &minAvailable},
+			StaticSites:         []v1alpha1.NginxStaticSite{{Name: "docs", Path: "/docs", ConfigMap: &v1alpha1.StaticConfigMapSource{Name: "docs"}}},
+			Healthcheck: &v1alpha1.NginxHealthcheck{
+				Readiness: &v1alpha1.NginxProbe{Path: "/healthz", Port: &probePort},
+			},
+			GitSync:   &v1alpha1.NginxGitSync{Repository: "https://example.com/site.git"},
+			Cache:     &v1alpha1.NginxCache{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			NginxArgs: &v1alpha1.NginxArgs{Globals: []string{"worker_processes 4"}},
+			Rootless:  true,
+			Lifecycle: &v1alpha1.NginxLifecycle{PostStart: &corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"true"}}}},
+		},
+		Status: v1alpha1.NginxStatus{
+			CertificateRevision:    "0123456789abcdef",
+			ConfigTemplateRevision: "fedcba9876543210",
+		},
+	}
+}
+
+func TestBuildersDoNotModifyInput(t *testing.T) {
+	deployment, err := NewDeployment(builderNginx())
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name  string
+		build func(n *v1alpha1.Nginx) error
+	}{
+		{name: "deployment", build: func(n *v1alpha1.Nginx) error { _, err := NewDeployment(n); return err }},
+		{name: "statefulset", build: func(n *v1alpha1.Nginx) error { _, err := NewStatefulSet(n); return err }},
+		{name: "daemonset", build: func(n *v1alpha1.Nginx) error { _, err := NewDaemonSet(n); return err }},
+		{name: "rollout", build: func(n *v1alpha1.Nginx) error { _, err := NewRollout(n); return err }},
+		{name: "service", build: func(n *v1alpha1.Nginx) error { NewService(n); return nil }},
+		{name: "ingress", build: func(n *v1alpha1.Nginx) error { NewIngress(n); return nil }},
+		{name: "pdb", build: func(n *v1alpha1.Nginx) error { NewPodDisruptionBudget(n); return nil }},
+		{name: "certificate", build: func(n *v1alpha1.Nginx) error { NewCertificate(n); return nil }},
+		{name: "service-account", build: func(n *v1alpha1.Nginx) error { NewServiceAccount(n); return nil }},
+		{name: "role", build: func(n *v1alpha1.Nginx) error { NewRole(n); return nil }},
+		{name: "role-binding", build: func(n *v1alpha1.Nginx) error { NewRoleBinding(n); return nil }},
+		{name: "service-monitor", build: func(n *v1alpha1.Nginx) error { NewServiceMonitor(n); return nil }},
+		{name: "prometheus-rule", build: func(n *v1alpha1.Nginx) error { NewPrometheusRule(n); return nil }},
+		{name: "inline-config-map", build: func(n *v1alpha1.Nginx) error { NewInlineConfigMap(n); return nil }},
+		{name: "vertical-pod-autoscaler", build: func(n *v1alpha1.Nginx) error { NewVerticalPodAutoscaler(n); return nil }},
+		{name: "endpoints-config-map", build: func(n *v1alpha1.Nginx) error { _, err := NewEndpointsConfigMap(n, nil); return err }},
+		{name: "metric-templates", build: func(n *v1alpha1.Nginx) error { NewMetricTemplates(n); return nil }},
+		{name: "canary-pods", build: func(n *v1alpha1.Nginx) error { _, err := NewCanaryPods(n, deployment); return err }},
+		{name: "config-check-job", build: func(n *v1alpha1.Nginx) error {
+			_, err := NewConfigCheckJob(n, deployment, ConfigCheckOptions{})
+			return err
+		}},
+		{name: "config-template", build: func(n *v1alpha1.Nginx) error {
+			_, err := RenderConfigTemplate(n, "worker_processes {{ .Values.worker }};")
+			return err
+		}},
+		{name: "config-template-config-map", build: func(n *v1alpha1.Nginx) error { NewConfigTemplateConfigMap(n, ""); return nil }},
+		{name: "certificate-tls", build: func(n *v1alpha1.Nginx) error { WithCertificateTLS(n); return nil }},
+		{name: "template-config", build: func(n *v1alpha1.Nginx) error { WithTemplateConfig(n); return nil }},
+		{name: "validate", build: func(n *v1alpha1.Nginx) error { Validate(n); return nil }},
+		{name: "render", build: func(n *v1alpha1.Nginx) error { Render(n); return nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := builderNginx()
+			assert.Nil(t, tt.build(n))
+			assert.Equal(t, builderNginx(), n)
+		})
+	}
+}
+
+func TestNewDeploymentDoesNotShareInput(t *testing.T) {
+	n := builderNginx()
+	deployment, err := NewDeployment(n)
+	assert.Nil(t, err)
+
+	podSpec := &deployment.Spec.Template.Spec
+	podSpec.NodeSelector["pool"] = "changed"
+	podSpec.Tolerations[0].Key = "changed"
+	podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+		if c.Resources.Limits != nil {
+			c.Resources.Limits[corev1.ResourceCPU] = resource.MustParse("1")
+		}
+		for j := range c.Env {
+			c.Env[j].Value = "changed"
+		}
+		for j := range c.VolumeMounts {
+			c.VolumeMounts[j].MountPath = "/changed"
+		}
+	}
+	for i := range podSpec.Volumes {
+		podSpec.Volumes[i].Name = "changed"
+	}
+	*deployment.Spec.Replicas = 10
+	assert.Equal(t, builderNginx(), n)
+}
@@ -0,0 +1,223 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// cacheVolume is the name of the cache volume, and of the volume claim
+// template of statefulsets
+const cacheVolume = "nginx-cache"
+
+var (
+	cacheZoneNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	nginxSizeRegexp     = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+	nginxTimeRegexp     = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|M|y)?)+$`)
+
+	// cacheUseStaleValues are the arguments accepted by proxy_cache_use_stale
+	cacheUseStaleValues = map[string]bool{
+		"error": true, "timeout": true, "invalid_header": true, "updating": true,
+		"http_500": true, "http_502": true, "http_503": true, "http_504": true,
+		"http_403": true, "http_404": true, "http_429": true, "off": true,
+	}
+)
+
+// setupCacheVolume mounts the cache volume in the nginx container. The
+// deployment always uses an emptyDir, statefulsets replace it with a claim
+// when requested. The spec must have its default values already set.
+func setupCacheVolume(cache *v1alpha1.NginxCache, dep *appv1.Deployment) {
+	if cache == nil {
+		return
+	}
+	emptyDir := cache.EmptyDir
+	if emptyDir == nil {
+		emptyDir = &corev1.EmptyDirVolumeSource{}
+	}
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         cacheVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: emptyDir.DeepCopy()},
+	})
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      cacheVolume,
+		MountPath: cache.MountPath,
+	})
+}
+
+// validateCache returns the errors found in the cache volume of the spec
+func validateCache(spec *v1alpha1.NginxSpec) []string {
+	cache := spec.Cache
+	if cache == nil {
+		return nil
+	}
+	var errs []string
+	if cache.MountPath != "" && !strings.HasPrefix(cache.MountPath, "/") {
+		errs = append(errs, fmt.Sprintf("spec.cache.mountPath %q must be an absolute path", cache.MountPath))
+	}
+	if cache.EmptyDir != nil && cache.PersistentVolumeClaim != nil {
+		errs = append(errs, "spec.cache must set at most one of emptyDir or persistentVolumeClaim")
+	}
+	if claim := cache.PersistentVolumeClaim; claim != nil {
+		if spec.WorkloadKind != v1alpha1.WorkloadKindStatefulSet {
+			errs = append(errs, "spec.cache.persistentVolumeClaim requires workload kind StatefulSet")
+		}
+		if claim.Size.Sign() <= 0 {
+			errs = append(errs, "spec.cache.persistentVolumeClaim.size must be greater than zero")
+		}
+	}
+	return errs
+}
+
+// renderCacheZones renders a proxy_cache_path directive for each zone
+func renderCacheZones(buf *bytes.Buffer, spec *v1alpha1.NginxSpec) {
+	if spec.CachePolicy == nil {
+		return
+	}
+	for _, z := range spec.CachePolicy.Zones {
+		fmt.Fprintf(buf, "proxy_cache_path %s levels=1:2 keys_zone=%s:%s", z.Path, z.Name, z.Size)
+		if z.MaxSize != "" {
+			fmt.Fprintf(buf, " max_size=%s", z.MaxSize)
+		}
+		if z.Inactive != "" {
+			fmt.Fprintf(buf, " inactive=%s", z.Inactive)
+		}
+		buf.WriteString(";\n")
+	}
+}
+
+// renderProxyCache renders the caching directives of a proxy location using
+// the given zone
+func renderProxyCache(buf *bytes.Buffer, cache *v1alpha1.ProxyCache, zone v1alpha1.NginxCacheZone) {
+	fmt.Fprintf(buf, "    proxy_cache %s;\n", zone.Name)
+	fmt.Fprintf(buf, "    proxy_cache_key %s;\n", quote(zone.Key))
+	for _, v := range zone.Valid {
+		codes := make([]string, len(v.Codes))
+		for i, c := range v.Codes {
+			codes[i] = fmt.Sprint(c)
+		}
+		fmt.Fprintf(buf, "    proxy_cache_valid %s;\n", strings.Join(append(codes, v.TTL), " "))
+	}
+	if len(zone.Bypass) > 0 {
+		fmt.Fprintf(buf, "    proxy_cache_bypass %s;\n", strings.Join(zone.Bypass, " "))
+	}
+	if len(zone.NoCache) > 0 {
+		fmt.Fprintf(buf, "    proxy_no_cache %s;\n", strings.Join(zone.NoCache, " "))
+	}
+	useStale := zone.UseStale
+	if zone.StaleWhileRevalidate && !containsString(useStale, "updating") {
+		useStale = append(append([]string{}, useStale...), "updating")
+	}
+	if len(useStale) > 0 {
+		fmt.Fprintf(buf, "    proxy_cache_use_stale %s;\n", strings.Join(useStale, " "))
+	}
+	if zone.StaleWhileRevalidate {
+		buf.WriteString("    proxy_cache_background_update on;\n")
+	}
+	if len(cache.PurgeFrom) > 0 {
+		fmt.Fprintf(buf, "    proxy_cache_purge PURGE from %s;\n", strings.Join(cache.PurgeFrom, " "))
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheZones indexes the cache zones of the spec by name
+func cacheZones(spec *v1alpha1.NginxSpec) map[string]v1alpha1.NginxCacheZone {
+	zones := make(map[string]v1alpha1.NginxCacheZone)
+	if spec.CachePolicy != nil {
+		for _, z := range spec.CachePolicy.Zones {
+			zones[z.Name] = z
+		}
+	}
+	return zones
+}
+
+// validateCachePolicy returns the errors found in the cache zones of the
+// spec and in their use by the proxy locations
+func validateCachePolicy(spec *v1alpha1.NginxSpec) []string {
+	var errs []string
+	zones := make(map[string]int)
+	if policy := spec.CachePolicy; policy != nil {
+		for i, z := range policy.Zones {
+			field := fmt.Sprintf("spec.cachePolicy.zones[%d]", i)
+			if !cacheZoneNameRegexp.MatchString(z.Name) {
+				errs = append(errs, fmt.Sprintf("%s.name %q must consist of alphanumeric characters, '-' or '_'", field, z.Name))
+			} else if other, ok := zones[z.Name]; ok {
+				errs = append(errs, fmt.Sprintf("%s.name %q is already used by spec.cachePolicy.zones[%d]", field, z.Name, other))
+			} else {
+				zones[z.Name] = i
+			}
+			if z.Path != "" && (!strings.HasPrefix(z.Path, "/") || strings.ContainsAny(z.Path, " \t\n{};")) {
+				errs = append(errs, fmt.Sprintf("%s.path %q must be an absolute path", field, z.Path))
+			}
+			if z.Size != "" && !nginxSizeRegexp.MatchString(z.Size) {
+				errs = append(errs, fmt.Sprintf("%s.size %q is not a valid size", field, z.Size))
+			}
+			if z.MaxSize != "" && !nginxSizeRegexp.MatchString(z.MaxSize) {
+				errs = append(errs, fmt.Sprintf("%s.maxSize %q is not a valid size", field, z.MaxSize))
+			}
+			if z.Inactive != "" && !nginxTimeRegexp.MatchString(z.Inactive) {
+				errs = append(errs, fmt.Sprintf("%s.inactive %q is not a valid time", field, z.Inactive))
+			}
+			if strings.ContainsAny(z.Key, "\n{};") {
+				errs = append(errs, fmt.Sprintf("%s.key %q must not contain braces or semicolons", field, z.Key))
+			}
+			for j, v := range z.Valid {
+				if !nginxTimeRegexp.MatchString(v.TTL) {
+					errs = append(errs, fmt.Sprintf("%s.valid[%d].ttl %q is not a valid time", field, j, v.TTL))
+				}
+				for _, c := range v.Codes {
+					if c < 100 || c > 599 {
+						errs = append(errs, fmt.Sprintf("%s.valid[%d].codes %d is out of range", field, j, c))
+					}
+				}
+			}
+			errs = append(errs, validateCacheConditions(field+".bypass", z.Bypass)...)
+			errs = append(errs, validateCacheConditions(field+".noCache", z.NoCache)...)
+			for _, s := range z.UseStale {
+				if !cacheUseStaleValues[s] {
+					errs = append(errs, fmt.Sprintf("%s.useStale %q is not supported", field, s))
+				}
+			}
+		}
+	}
+
+	for i, l := range spec.Locations {
+		if l.Proxy == nil || l.Proxy.Cache == nil {
+			continue
+		}
+		field := fmt.Sprintf("spec.locations[%d].proxy.cache", i)
+		if _, ok := zones[l.Proxy.Cache.Zone]; !ok {
+			errs = append(errs, fmt.Sprintf("%s.zone %q is not a zone of spec.cachePolicy", field, l.Proxy.Cache.Zone))
+		}
+		for _, addr := range l.Proxy.Cache.PurgeFrom {
+			if addr == "" || strings.ContainsAny(addr, " \t\n{};") {
+				errs = append(errs, fmt.Sprintf("%s.purgeFrom %q must be an address or CIDR", field, addr))
+			}
+		}
+	}
+	return errs
+}
+
+func validateCacheConditions(field string, conditions []string) []string {
+	var errs []string
+	for _, c := range conditions {
+		if c == "" || strings.ContainsAny(c, " \t\n{};") {
+			errs = append(errs, fmt.Sprintf("%s %q must be a single variable or value", field, c))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,172 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSetupCache(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.CachePolicy = &v1alpha1.NginxCachePolicy{Zones: []v1alpha1.NginxCacheZone{
+		{Name: "api", MaxSize: "1g", Inactive: "60m", Valid: []v1alpha1.NginxCacheValid{
+			{Codes: []int32{200, 302}, TTL: "10m"},
+			{Codes: []int32{404}, TTL: "1m"},
+		}, Bypass: []string{"$cookie_nocache", "$arg_nocache"}, NoCache: []string{"$http_authorization"}, UseStale: []string{"error", "timeout"}, StaleWhileRevalidate: true},
+		{Name: "static", Path: "/cache/static"},
+	}}
+	nginx.Spec.Locations = []v1alpha1.NginxLocation{
+		{Path: "/api", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 8080, Cache: &v1alpha1.ProxyCache{Zone: "api", PurgeFrom: []string{"127.0.0.1", "10.0.0.0/8"}}}},
+		{Path: "/static", Proxy: &v1alpha1.ProxyAction{Service: "static", Port: 80, Cache: &v1alpha1.ProxyCache{Zone: "static"}}},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, `proxy_cache_path /var/cache/nginx/api levels=1:2 keys_zone=api:10m max_size=1g inactive=60m;
+proxy_cache_path /cache/static levels=1:2 keys_zone=static:10m;
+`, annotations["nginx.tsuru.io/http-conf"])
+	assert.Equal(t, `location /api {
+    proxy_cache api;
+    proxy_cache_key "$scheme$proxy_host$request_uri";
+    proxy_cache_valid 200 302 10m;
+    proxy_cache_valid 404 1m;
+    proxy_cache_bypass $cookie_nocache $arg_nocache;
+    proxy_no_cache $http_authorization;
+    proxy_cache_use_stale error timeout updating;
+    proxy_cache_background_update on;
+    proxy_cache_purge PURGE from 127.0.0.1 10.0.0.0/8;
+    proxy_pass http://api.default.svc:8080;
+}
+location /static {
+    proxy_cache static;
+    proxy_cache_key "$scheme$proxy_host$request_uri";
+    proxy_pass http://static.default.svc:80;
+}
+`, annotations["nginx.tsuru.io/locations-conf"])
+	assert.Equal(t, `include /etc/nginx-operator/http.conf;
+server {
+    listen 80;
+    include /etc/nginx-operator/locations.conf;
+}
+`, defaultServer(&nginx))
+}
+
+func TestValidateCachePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{
+				CachePolicy: &v1alpha1.NginxCachePolicy{Zones: []v1alpha1.NginxCacheZone{
+					{Name: "api", Size: "1m", MaxSize: "2g", Inactive: "1h30m", Valid: []v1alpha1.NginxCacheValid{{TTL: "5m"}}, UseStale: []string{"http_502"}},
+				}},
+				Locations: []v1alpha1.NginxLocation{
+					{Path: "/", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 80, Cache: &v1alpha1.ProxyCache{Zone: "api"}}},
+				},
+			},
+		},
+		{
+			name: "invalid-zones",
+			spec: v1alpha1.NginxSpec{
+				CachePolicy: &v1alpha1.NginxCachePolicy{Zones: []v1alpha1.NginxCacheZone{
+					{Name: "api", Path: "cache", Size: "ten", Inactive: "forever", Valid: []v1alpha1.NginxCacheValid{{Codes: []int32{99}, TTL: "1 minute"}}},
+					{Name: "api", Bypass: []string{"$a; $b"}, UseStale: []string{"always"}},
+					{Name: "a b"},
+				}},
+			},
+			want: []string{
+				`spec.cachePolicy.zones[0].path "cache" must be an absolute path`,
+				`spec.cachePolicy.zones[0].size "ten" is not a valid size`,
+				`spec.cachePolicy.zones[0].inactive "forever" is not a valid time`,
+				`spec.cachePolicy.zones[0].valid[0].ttl "1 minute" is not a valid time`,
+				`spec.cachePolicy.zones[0].valid[0].codes 99 is out of range`,
+				`spec.cachePolicy.zones[1].name "api" is already used by spec.cachePolicy.zones[0]`,
+				`spec.cachePolicy.zones[1].bypass "$a; $b" must be a single variable or value`,
+				`spec.cachePolicy.zones[1].useStale "always" is not supported`,
+				`spec.cachePolicy.zones[2].name "a b" must consist of alphanumeric characters, '-' or '_'`,
+			},
+		},
+		{
+			name: "unknown-zone",
+			spec: v1alpha1.NginxSpec{
+				Locations: []v1alpha1.NginxLocation{
+					{Path: "/", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 80, Cache: &v1alpha1.ProxyCache{Zone: "api", PurgeFrom: []string{""}}}},
+				},
+			},
+			want: []string{
+				`spec.locations[0].proxy.cache.zone "api" is not a zone of spec.cachePolicy`,
+				`spec.locations[0].proxy.cache.purgeFrom "" must be an address or CIDR`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateCachePolicy(&tt.spec))
+		})
+	}
+}
+
+func TestSetupCacheVolume(t *testing.T) {
+	sizeLimit := resource.MustParse("256Mi")
+	nginx := baseNginx()
+	nginx.Spec.Cache = &v1alpha1.NginxCache{
+		MountPath: "/cache",
+		EmptyDir:  &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: &sizeLimit},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.Volume{{
+		Name: "nginx-cache",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{
+			Medium:    corev1.StorageMediumMemory,
+			SizeLimit: &sizeLimit,
+		}},
+	}}, dep.Spec.Template.Spec.Volumes)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "nginx-cache", MountPath: "/cache"}}, dep.Spec.Template.Spec.Containers[0].VolumeMounts)
+}
+
+func TestValidateCache(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{
+			name: "empty-dir",
+			spec: v1alpha1.NginxSpec{Cache: &v1alpha1.NginxCache{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+		{
+			name: "claim",
+			spec: v1alpha1.NginxSpec{
+				WorkloadKind: v1alpha1.WorkloadKindStatefulSet,
+				Cache:        &v1alpha1.NginxCache{PersistentVolumeClaim: &v1alpha1.NginxCacheClaim{Size: resource.MustParse("1Gi")}},
+			},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{Cache: &v1alpha1.NginxCache{
+				MountPath:             "cache",
+				EmptyDir:              &corev1.EmptyDirVolumeSource{},
+				PersistentVolumeClaim: &v1alpha1.NginxCacheClaim{},
+			}},
+			want: []string{
+				`spec.cache.mountPath "cache" must be an absolute path`,
+				"spec.cache must set at most one of emptyDir or persistentVolumeClaim",
+				"spec.cache.persistentVolumeClaim requires workload kind StatefulSet",
+				"spec.cache.persistentVolumeClaim.size must be greater than zero",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateCache(&tt.spec))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CachePurgeAnnotation requests a cache purge when set on the nginx to a
+	// value different from the one of the last purge, like a timestamp
+	CachePurgeAnnotation = "nginx.tsuru.io/purge-cache"
+
+	// CachePurgePodAnnotation is the pod template annotation holding the
+	// last purge request. Changing it replaces the pods, and with them the
+	// cache they hold.
+	CachePurgePodAnnotation = "nginx.tsuru.io/cache-purge"
+)
+
+// CachePurgeRequest returns the cache purge requested for the nginx, if any
+func CachePurgeRequest(n *v1alpha1.Nginx) string {
+	return n.Annotations[CachePurgeAnnotation]
+}
+
+// CachePurgePending returns whether the nginx requested a cache purge that
+// is not recorded in its status yet
+func CachePurgePending(n *v1alpha1.Nginx) bool {
+	request := CachePurgeRequest(n)
+	if request == "" {
+		return false
+	}
+	purges := n.Status.CachePurges
+	return len(purges) == 0 || purges[len(purges)-1].ID != request
+}
+
+// RecordCachePurge appends a purge to the status, keeping only the given
+// number of latest ones. Recording the last purge again does nothing.
+func RecordCachePurge(status *v1alpha1.NginxStatus, id string, t metav1.Time, history int) {
+	if n := len(status.CachePurges); n > 0 && status.CachePurges[n-1].ID == id {
+		return
+	}
+	status.CachePurges = append(status.CachePurges, v1alpha1.NginxCachePurge{ID: id, Time: t})
+	TrimCachePurges(status, history)
+}
+
+// TrimCachePurges removes the oldest purges from the status, keeping the
+// given number of latest ones
+func TrimCachePurges(status *v1alpha1.NginxStatus, history int) {
+	if extra := len(status.CachePurges) - history; extra > 0 {
+		status.CachePurges = status.CachePurges[extra:]
+	}
+}
+
+// PodRestartRequested returns whether the pod template annotations that
+// replace the pods, like a cache purge, a renewed certificate, rotated
+// external secrets, a new rendered or inline config or a restart, differ
+// between the desired and the current pod templates
+func PodRestartRequested(desired, current map[string]string) bool {
+	for _, a := range []string{CachePurgePodAnnotation, CertificateRevisionPodAnnotation, ExternalSecretsRevisionPodAnnotation, ConfigTemplateRevisionPodAnnotation, InlineConfigHashPodAnnotation, RestartPodAnnotation} {
+		if desired[a] != current[a] {
+			return true
+		}
+	}
+	return false
+}
+
+// setupCachePurge sets the last purge request in the pod template, so pods
+// are only replaced when a new purge is requested
+func setupCachePurge(n *v1alpha1.Nginx, dep *appv1.Deployment) {
+	request := CachePurgeRequest(n)
+	if request == "" {
+		return
+	}
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = make(map[string]string)
+	}
+	dep.Spec.Template.Annotations[CachePurgePodAnnotation] = request
+}
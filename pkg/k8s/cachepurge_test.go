@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCachePurgePending(t *testing.T) {
+	nginx := baseNginx()
+	assert.False(t, CachePurgePending(&nginx))
+
+	nginx.Annotations = map[string]string{CachePurgeAnnotation: "1"}
+	assert.True(t, CachePurgePending(&nginx))
+
+	RecordCachePurge(&nginx.Status, "1", metav1.Now(), 5)
+	assert.False(t, CachePurgePending(&nginx))
+
+	nginx.Annotations[CachePurgeAnnotation] = "2"
+	assert.True(t, CachePurgePending(&nginx))
+}
+
+func TestRecordCachePurge(t *testing.T) {
+	var status v1alpha1.NginxStatus
+	now := metav1.NewTime(time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC))
+	for i := 0; i < 7; i++ {
+		RecordCachePurge(&status, fmt.Sprint(i), now, 5)
+	}
+	RecordCachePurge(&status, "6", metav1.Now(), 5)
+	assert.Equal(t, []v1alpha1.NginxCachePurge{
+		{ID: "2", Time: now},
+		{ID: "3", Time: now},
+		{ID: "4", Time: now},
+		{ID: "5", Time: now},
+		{ID: "6", Time: now},
+	}, status.CachePurges)
+}
+
+func TestSetupCachePurge(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, CachePurgePodAnnotation)
+
+	nginx.Annotations = map[string]string{CachePurgeAnnotation: "2018-06-01T00:00:00Z"}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-06-01T00:00:00Z", dep.Spec.Template.Annotations[CachePurgePodAnnotation])
+}
@@ -0,0 +1,157 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CanaryPodLabel is set on the canary pods started before rolling out a new
+// pod template
+const CanaryPodLabel = "nginx.tsuru.io/canary"
+
+// Container waiting reasons that a canary pod does not recover from by itself
+var canaryFailureReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+// LabelsForCanary returns the labels selecting the canary pods of the Nginx
+// CR with the given name
+func LabelsForCanary(name string) map[string]string {
+	return map[string]string{
+		"nginx_cr":     name,
+		CanaryPodLabel: "true",
+	}
+}
+
+// NewCanaryPods assembles the canary pods running the pod template of the
+// given deployment. They keep the labels of the nginx pods, so they receive
+// traffic from the nginx service, but are not managed by the deployment.
+// Their names are derived from the template, so a new template starts new
+// canary pods.
+func NewCanaryPods(n *v1alpha1.Nginx, deployment *appv1.Deployment) ([]*corev1.Pod, error) {
+	template := deployment.Spec.Template.DeepCopy()
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	labels := make(map[string]string)
+	for k, v := range template.Labels {
+		labels[k] = v
+	}
+	for k, v := range LabelsForCanary(n.Name) {
+		labels[k] = v
+	}
+
+	var pods []*corev1.Pod
+	for i := int32(0); i < n.Spec.Rollout.CanaryPods; i++ {
+		pods = append(pods, &corev1.Pod{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Pod",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-canary-%s-%d", n.Name, hash[:10], i),
+				Namespace:   n.Namespace,
+				Labels:      labels,
+				Annotations: template.Annotations,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(n, schema.GroupVersionKind{
+						Group:   v1alpha1.SchemeGroupVersion.Group,
+						Version: v1alpha1.SchemeGroupVersion.Version,
+						Kind:    "Nginx",
+					}),
+				},
+			},
+			Spec: template.Spec,
+		})
+	}
+	return pods, nil
+}
+
+// CanaryPodReady returns whether the canary pod is ready
+func CanaryPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// CanaryPodFailure returns why the canary pod failed, or an empty string.
+// Restarted containers count as failures, the new template must run as is.
+func CanaryPodFailure(pod *corev1.Pod) string {
+	if pod.Status.Phase == corev1.PodFailed {
+		return fmt.Sprintf("pod %s failed: %s", pod.Name, pod.Status.Message)
+	}
+	for _, s := range pod.Status.ContainerStatuses {
+		if w := s.State.Waiting; w != nil && canaryFailureReasons[w.Reason] {
+			return fmt.Sprintf("container %s of pod %s is in %s: %s", s.Name, pod.Name, w.Reason, w.Message)
+		}
+		if s.RestartCount > 0 {
+			return fmt.Sprintf("container %s of pod %s restarted %d times", s.Name, pod.Name, s.RestartCount)
+		}
+	}
+	return ""
+}
+
+// CanaryCheckURL returns the URL requested to the canary pod. The check must
+// have its default values already set.
+func CanaryCheckURL(pod *corev1.Pod, check *v1alpha1.CanaryCheck) string {
+	host := net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(check.Port)))
+	return "http://" + host + check.Path
+}
+
+// validateCanary returns the errors found in the canary pods settings
+func validateCanary(spec *v1alpha1.NginxSpec) []string {
+	r := spec.Rollout
+	if r == nil {
+		return nil
+	}
+	var errs []string
+	if r.CanaryPods < 0 {
+		errs = append(errs, "spec.rollout.canaryPods must not be negative")
+	}
+	if r.CanaryPods > 0 {
+		switch {
+		case spec.WorkloadKind != "" && spec.WorkloadKind != v1alpha1.WorkloadKindDeployment:
+			errs = append(errs, fmt.Sprintf("spec.rollout.canaryPods is not supported with workload kind %s", spec.WorkloadKind))
+		case spec.Flagger != nil:
+			errs = append(errs, "spec.rollout.canaryPods is not supported with spec.flagger, Flagger runs its own canary analysis")
+		}
+	}
+	if c := r.CanaryCheck; c != nil {
+		if r.CanaryPods == 0 {
+			errs = append(errs, "spec.rollout.canaryCheck requires spec.rollout.canaryPods")
+		}
+		if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+			errs = append(errs, fmt.Sprintf("spec.rollout.canaryCheck.path %q must start with /", c.Path))
+		}
+		if c.Port < 0 || c.Port > 65535 {
+			errs = append(errs, fmt.Sprintf("spec.rollout.canaryCheck.port %d is out of range", c.Port))
+		}
+		if c.ExpectedStatus != 0 && (c.ExpectedStatus < 100 || c.ExpectedStatus > 599) {
+			errs = append(errs, fmt.Sprintf("spec.rollout.canaryCheck.expectedStatus %d is out of range", c.ExpectedStatus))
+		}
+	}
+	return errs
+}
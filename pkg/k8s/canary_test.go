@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewCanaryPods(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Rollout = &v1alpha1.NginxRollout{CanaryPods: 2}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	pods, err := NewCanaryPods(&nginx, dep)
+	assert.Nil(t, err)
+	assert.Len(t, pods, 2)
+	for _, pod := range pods {
+		assert.Regexp(t, "^my-nginx-canary-[0-9a-f]{10}-[01]$", pod.Name)
+		assert.Equal(t, "default", pod.Namespace)
+		assert.Len(t, pod.OwnerReferences, 1)
+		assert.Equal(t, dep.Spec.Template.Spec, pod.Spec)
+		for k, v := range dep.Spec.Template.Labels {
+			assert.Equal(t, v, pod.Labels[k])
+		}
+		assert.Equal(t, "true", pod.Labels[CanaryPodLabel])
+	}
+	assert.NotContains(t, dep.Spec.Template.Labels, CanaryPodLabel)
+
+	nginx.Spec.Image = "nginx:other"
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	other, err := NewCanaryPods(&nginx, dep)
+	assert.Nil(t, err)
+	assert.NotEqual(t, pods[0].Name, other[0].Name)
+}
+
+func TestCanaryPodStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  corev1.PodStatus
+		ready   bool
+		failure string
+	}{
+		{name: "pending", status: corev1.PodStatus{Phase: corev1.PodPending}},
+		{
+			name: "ready",
+			status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+			ready: true,
+		},
+		{
+			name: "image-pull",
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "nginx", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "not found"}}},
+			}},
+			failure: "container nginx of pod canary is in ImagePullBackOff: not found",
+		},
+		{
+			name: "restarted",
+			status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "nginx", RestartCount: 1},
+			}},
+			failure: "container nginx of pod canary restarted 1 times",
+		},
+		{
+			name:    "failed",
+			status:  corev1.PodStatus{Phase: corev1.PodFailed, Message: "evicted"},
+			failure: "pod canary failed: evicted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Status: tt.status}
+			pod.Name = "canary"
+			assert.Equal(t, tt.ready, CanaryPodReady(pod))
+			assert.Equal(t, tt.failure, CanaryPodFailure(pod))
+		})
+	}
+}
+
+func TestCanaryCheckURL(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: "10.0.0.1"}}
+	check := &v1alpha1.CanaryCheck{Path: "/healthz", Port: 8080}
+	assert.Equal(t, "http://10.0.0.1:8080/healthz", CanaryCheckURL(pod, check))
+
+	pod.Status.PodIP = "fd00::1"
+	assert.Equal(t, "http://[fd00::1]:8080/healthz", CanaryCheckURL(pod, check))
+}
+
+func TestValidateCanary(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "none"},
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{Rollout: &v1alpha1.NginxRollout{CanaryPods: 1, CanaryCheck: &v1alpha1.CanaryCheck{Path: "/healthz", ExpectedStatus: 204}}},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{Rollout: &v1alpha1.NginxRollout{CanaryPods: -1, CanaryCheck: &v1alpha1.CanaryCheck{Path: "healthz", Port: 70000, ExpectedStatus: 1}}},
+			want: []string{
+				"spec.rollout.canaryPods must not be negative",
+				`spec.rollout.canaryCheck.path "healthz" must start with /`,
+				"spec.rollout.canaryCheck.port 70000 is out of range",
+				"spec.rollout.canaryCheck.expectedStatus 1 is out of range",
+			},
+		},
+		{
+			name: "check-without-pods",
+			spec: v1alpha1.NginxSpec{Rollout: &v1alpha1.NginxRollout{CanaryCheck: &v1alpha1.CanaryCheck{}}},
+			want: []string{"spec.rollout.canaryCheck requires spec.rollout.canaryPods"},
+		},
+		{
+			name: "statefulset",
+			spec: v1alpha1.NginxSpec{WorkloadKind: v1alpha1.WorkloadKindStatefulSet, Rollout: &v1alpha1.NginxRollout{CanaryPods: 1}},
+			want: []string{"spec.rollout.canaryPods is not supported with workload kind StatefulSet"},
+		},
+		{
+			name: "flagger",
+			spec: v1alpha1.NginxSpec{Flagger: &v1alpha1.FlaggerSpec{}, Rollout: &v1alpha1.NginxRollout{CanaryPods: 1}},
+			want: []string{"spec.rollout.canaryPods is not supported with spec.flagger, Flagger runs its own canary analysis"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateCanary(&tt.spec))
+		})
+	}
+}
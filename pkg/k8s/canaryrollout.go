@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PromoteCanaryAnnotation promotes the canary rollout step pausing
+	// indefinitely when its value changes
+	PromoteCanaryAnnotation = "nginx.tsuru.io/promote-canary"
+
+	// CanaryTrackLabel is set to "canary" on the pods of the canary
+	// deployment
+	CanaryTrackLabel = "nginx.tsuru.io/track"
+)
+
+// CanaryRolloutEnabled returns whether the pod template changes of the
+// deployment of the nginx are rolled out through a canary deployment
+func CanaryRolloutEnabled(n *v1alpha1.Nginx) bool {
+	r := n.Spec.Rollout
+	if r == nil || r.Canary == nil || len(r.Canary.Steps) == 0 {
+		return false
+	}
+	return n.Spec.Flagger == nil
+}
+
+// NewCanaryDeployment assembles the canary deployment running the pod
+// template of the given deployment of the nginx with the given replicas.
+// Its pods keep the labels selected by the service, so they receive a share
+// of the traffic matching their share of the pods.
+func NewCanaryDeployment(n *v1alpha1.Nginx, deployment *appv1.Deployment, replicas int32) *appv1.Deployment {
+	canary := deployment.DeepCopy()
+	canary.Name = n.Name + "-canary-deployment"
+	canary.Spec.Replicas = &replicas
+	canary.Spec.Selector.MatchLabels = withCanaryTrack(canary.Spec.Selector.MatchLabels)
+	canary.Spec.Template.Labels = withCanaryTrack(canary.Spec.Template.Labels)
+	return canary
+}
+
+// CanaryReplicas splits the replicas between the canary and the stable
+// deployment for the given weight. The canary gets at least one pod for any
+// positive weight.
+func CanaryReplicas(replicas, weight int32) (canary, stable int32) {
+	canary = (replicas*weight + 99) / 100
+	if canary == 0 && weight > 0 {
+		canary = 1
+	}
+	if canary > replicas {
+		canary = replicas
+	}
+	return canary, replicas - canary
+}
+
+// CanaryStepWeight returns the weight of the canary after the given step,
+// the last weight set by the previous steps when the step only pauses
+func CanaryStepWeight(steps []v1alpha1.CanaryStep, step int) int32 {
+	for i := step; i >= 0; i-- {
+		if i < len(steps) && steps[i].Weight != nil {
+			return *steps[i].Weight
+		}
+	}
+	return 0
+}
+
+// DeploymentRolledOut returns whether all the replicas of the deployment run
+// its current pod template and are available
+func DeploymentRolledOut(dep *appv1.Deployment) bool {
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	s := dep.Status
+	return s.ObservedGeneration >= dep.Generation &&
+		s.UpdatedReplicas == replicas &&
+		s.Replicas == replicas &&
+		s.AvailableReplicas == replicas
+}
+
+// DeploymentFailure returns why the rollout of the deployment failed, or an
+// empty string. The deployment fails when it exceeds its progress deadline
+// or one of the given pods does not recover by itself.
+func DeploymentFailure(dep *appv1.Deployment, pods []corev1.Pod) string {
+	for _, c := range dep.Status.Conditions {
+		if c.Type == appv1.DeploymentProgressing && c.Status == corev1.ConditionFalse {
+			return fmt.Sprintf("deployment %s is not progressing: %s", dep.Name, c.Message)
+		}
+	}
+	for i := range pods {
+		if failure := CanaryPodFailure(&pods[i]); failure != "" {
+			return failure
+		}
+	}
+	return ""
+}
+
+func withCanaryTrack(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[CanaryTrackLabel] = "canary"
+	return result
+}
+
+// validateCanaryRollout returns the errors found in the canary steps of the
+// spec
+func validateCanaryRollout(spec *v1alpha1.NginxSpec) []string {
+	r := spec.Rollout
+	if r == nil || r.Canary == nil {
+		return nil
+	}
+	var errs []string
+	for i, step := range r.Canary.Steps {
+		if w := step.Weight; w != nil && (*w < 0 || *w > 100) {
+			errs = append(errs, fmt.Sprintf("spec.rollout.canary.steps[%d].weight must be between 0 and 100", i))
+		}
+		if p := step.Pause; p != nil && *p < 0 {
+			errs = append(errs, fmt.Sprintf("spec.rollout.canary.steps[%d].pause must not be negative", i))
+		}
+	}
+	nativeCanary := len(r.Canary.Steps) > 0 && spec.Flagger == nil &&
+		(spec.WorkloadKind == "" || spec.WorkloadKind == v1alpha1.WorkloadKindDeployment)
+	if nativeCanary && r.CanaryPods > 0 {
+		errs = append(errs, "spec.rollout.canaryPods and spec.rollout.canary cannot be used together with workload kind Deployment")
+	}
+	return errs
+}
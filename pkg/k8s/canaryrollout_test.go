@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewCanaryDeployment(t *testing.T) {
+	nginx := baseNginx()
+	replicas := int32(5)
+	nginx.Spec.Replicas = &replicas
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	canary := NewCanaryDeployment(&nginx, dep, 2)
+	assert.Equal(t, "my-nginx-canary-deployment", canary.Name)
+	assert.Equal(t, int32(2), *canary.Spec.Replicas)
+	assert.Equal(t, dep.Spec.Template.Spec, canary.Spec.Template.Spec)
+	assert.Equal(t, dep.OwnerReferences, canary.OwnerReferences)
+	assert.Equal(t, "canary", canary.Spec.Selector.MatchLabels[CanaryTrackLabel])
+	assert.Equal(t, "canary", canary.Spec.Template.Labels[CanaryTrackLabel])
+	for k, v := range LabelsForNginx(nginx.Name) {
+		assert.Equal(t, v, canary.Spec.Template.Labels[k])
+	}
+	assert.NotContains(t, dep.Spec.Selector.MatchLabels, CanaryTrackLabel)
+	assert.NotContains(t, dep.Spec.Template.Labels, CanaryTrackLabel)
+	assert.Equal(t, int32(5), *dep.Spec.Replicas)
+}
+
+func TestCanaryReplicas(t *testing.T) {
+	tests := []struct {
+		replicas, weight int32
+		canary, stable   int32
+	}{
+		{replicas: 10, weight: 0, canary: 0, stable: 10},
+		{replicas: 10, weight: 20, canary: 2, stable: 8},
+		{replicas: 10, weight: 25, canary: 3, stable: 7},
+		{replicas: 3, weight: 1, canary: 1, stable: 2},
+		{replicas: 3, weight: 100, canary: 3, stable: 0},
+		{replicas: 1, weight: 50, canary: 1, stable: 0},
+		{replicas: 0, weight: 50, canary: 0, stable: 0},
+	}
+	for _, tt := range tests {
+		canary, stable := CanaryReplicas(tt.replicas, tt.weight)
+		assert.Equal(t, tt.canary, canary, "replicas %d, weight %d", tt.replicas, tt.weight)
+		assert.Equal(t, tt.stable, stable, "replicas %d, weight %d", tt.replicas, tt.weight)
+	}
+}
+
+func TestCanaryStepWeight(t *testing.T) {
+	w := func(v int32) *int32 { return &v }
+	steps := []v1alpha1.CanaryStep{
+		{Pause: w(60)},
+		{Weight: w(20)},
+		{Pause: w(0)},
+		{Weight: w(50), Pause: w(60)},
+	}
+	for step, want := range []int32{0, 20, 20, 50} {
+		assert.Equal(t, want, CanaryStepWeight(steps, step), "step %d", step)
+	}
+}
+
+func TestDeploymentRolledOut(t *testing.T) {
+	replicas := int32(2)
+	dep := &appv1.Deployment{Spec: appv1.DeploymentSpec{Replicas: &replicas}}
+	dep.Generation = 2
+	dep.Status = appv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}
+	assert.False(t, DeploymentRolledOut(dep))
+
+	dep.Status.Replicas = 2
+	assert.True(t, DeploymentRolledOut(dep))
+
+	dep.Generation = 3
+	assert.False(t, DeploymentRolledOut(dep))
+}
+
+func TestDeploymentFailure(t *testing.T) {
+	dep := &appv1.Deployment{}
+	dep.Name = "my-nginx-canary-deployment"
+	assert.Equal(t, "", DeploymentFailure(dep, nil))
+
+	pod := corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+		{Name: "nginx", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull", Message: "not found"}}},
+	}}}
+	pod.Name = "canary"
+	assert.Equal(t, "container nginx of pod canary is in ErrImagePull: not found", DeploymentFailure(dep, []corev1.Pod{pod}))
+
+	dep.Status.Conditions = []appv1.DeploymentCondition{
+		{Type: appv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: "timed out"},
+	}
+	assert.Equal(t, "deployment my-nginx-canary-deployment is not progressing: timed out", DeploymentFailure(dep, nil))
+}
+
+func TestValidateCanaryRollout(t *testing.T) {
+	w := func(v int32) *int32 { return &v }
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "no-rollout"},
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{Rollout: &v1alpha1.NginxRollout{Canary: &v1alpha1.CanaryStrategy{
+				Steps: []v1alpha1.CanaryStep{{Weight: w(20), Pause: w(0)}, {Weight: w(100)}},
+			}}},
+		},
+		{
+			name: "invalid-steps",
+			spec: v1alpha1.NginxSpec{Rollout: &v1alpha1.NginxRollout{Canary: &v1alpha1.CanaryStrategy{
+				Steps: []v1alpha1.CanaryStep{{Weight: w(120)}, {Pause: w(-1)}},
+			}}},
+			want: []string{
+				"spec.rollout.canary.steps[0].weight must be between 0 and 100",
+				"spec.rollout.canary.steps[1].pause must not be negative",
+			},
+		},
+		{
+			name: "canary-pods",
+			spec: v1alpha1.NginxSpec{Rollout: &v1alpha1.NginxRollout{
+				CanaryPods: 1,
+				Canary:     &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{Weight: w(20)}}},
+			}},
+			want: []string{"spec.rollout.canaryPods and spec.rollout.canary cannot be used together with workload kind Deployment"},
+		},
+		{
+			name: "canary-pods-flagger",
+			spec: v1alpha1.NginxSpec{Flagger: &v1alpha1.FlaggerSpec{}, Rollout: &v1alpha1.NginxRollout{
+				CanaryPods: 1,
+				Canary:     &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{Weight: w(20)}}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateCanaryRollout(&tt.spec))
+		})
+	}
+}
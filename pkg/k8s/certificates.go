@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// CertificateAPIVersion is the api version of the cert-manager Certificate resource
+	CertificateAPIVersion = "cert-manager.io/v1"
+
+	// CertificateKind is the kind of the cert-manager Certificate resource
+	CertificateKind = "Certificate"
+
+	// CertificateRevisionPodAnnotation is the pod template annotation holding
+	// the revision of the issued certificate. Changing it replaces the pods,
+	// so nginx loads the renewed certificate.
+	CertificateRevisionPodAnnotation = "nginx.tsuru.io/certificate-revision"
+)
+
+// CertificateSecretName returns the name of the secret where cert-manager
+// stores the certificate of the nginx
+func CertificateSecretName(n *v1alpha1.Nginx) string {
+	if n.Spec.Certificates == nil || n.Spec.Certificates.SecretName == "" {
+		return n.Name + "-tls"
+	}
+	return n.Spec.Certificates.SecretName
+}
+
+// WithCertificateTLS returns a copy of the spec using the certificate secret
+// as the TLS secret when certificates are requested and no TLS secret is
+// set. The receiver is never modified.
+func WithCertificateTLS(n *v1alpha1.Nginx) *v1alpha1.NginxSpec {
+	out := n.Spec.DeepCopy()
+	if out.Certificates != nil && out.TLSSecret == nil {
+		out.TLSSecret = &v1alpha1.TLSSecret{SecretName: CertificateSecretName(n)}
+	}
+	return out
+}
+
+// NewCertificate assembles the cert-manager Certificate for the Nginx. It
+// returns nil if no certificate was requested.
+func NewCertificate(n *v1alpha1.Nginx) *unstructured.Unstructured {
+	certificates := n.Spec.WithDefaults().Certificates
+	if certificates == nil {
+		return nil
+	}
+	var dnsNames []interface{}
+	for _, name := range certificates.DNSNames {
+		dnsNames = append(dnsNames, name)
+	}
+	o := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"secretName": CertificateSecretName(n),
+			"dnsNames":   dnsNames,
+			"issuerRef": map[string]interface{}{
+				"name":  certificates.IssuerRef.Name,
+				"kind":  certificates.IssuerRef.Kind,
+				"group": certificates.IssuerRef.Group,
+			},
+		},
+	}}
+	o.SetAPIVersion(CertificateAPIVersion)
+	o.SetKind(CertificateKind)
+	o.SetName(n.Name)
+	o.SetNamespace(n.Namespace)
+	o.SetLabels(LabelsForNginx(n.Name))
+	o.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(n, schema.GroupVersionKind{
+			Group:   v1alpha1.SchemeGroupVersion.Group,
+			Version: v1alpha1.SchemeGroupVersion.Version,
+			Kind:    "Nginx",
+		}),
+	})
+	setCustomMetadata(&n.Spec, o)
+	return o
+}
+
+// CertificateRevision returns the revision identifying the content of an
+// issued certificate
+func CertificateRevision(certificate []byte) string {
+	sum := sha256.Sum256(certificate)
+	return hex.EncodeToString(sum[:8])
+}
+
+// setupCertificateRevision sets the revision of the issued certificate in
+// the pod template, so pods are only replaced when it is renewed
+func setupCertificateRevision(n *v1alpha1.Nginx, dep *appv1.Deployment) {
+	if n.Spec.Certificates == nil || n.Status.CertificateRevision == "" {
+		return
+	}
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = make(map[string]string)
+	}
+	dep.Spec.Template.Annotations[CertificateRevisionPodAnnotation] = n.Status.CertificateRevision
+}
+
+// validateCertificates returns the errors found in the requested certificates
+func validateCertificates(n *v1alpha1.Nginx) []string {
+	c := n.Spec.Certificates
+	if c == nil {
+		return nil
+	}
+	var errs []string
+	if c.IssuerRef.Name == "" {
+		errs = append(errs, "spec.certificates.issuerRef.name is required")
+	}
+	if len(c.DNSNames) == 0 {
+		errs = append(errs, "spec.certificates.dnsNames must not be empty")
+	}
+	for i, name := range c.DNSNames {
+		if msgs := validation.IsDNS1123Subdomain(strings.TrimPrefix(name, "*.")); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("spec.certificates.dnsNames[%d] %q is invalid: %s", i, name, strings.Join(msgs, ", ")))
+		}
+	}
+	if c.SecretName != "" {
+		if msgs := validation.IsDNS1123Subdomain(c.SecretName); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("spec.certificates.secretName %q is invalid: %s", c.SecretName, strings.Join(msgs, ", ")))
+		}
+	}
+	if tls := n.Spec.TLSSecret; tls != nil && tls.SecretName != CertificateSecretName(n) {
+		errs = append(errs, fmt.Sprintf("spec.tlsSecret.SecretName must be the certificate secret %q when spec.certificates is set", CertificateSecretName(n)))
+	}
+	return errs
+}
@@ -0,0 +1,111 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewCertificate(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewCertificate(&nginx))
+
+	nginx.Spec.Certificates = &v1alpha1.NginxCertificates{
+		IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer"},
+		DNSNames:  []string{"example.com", "*.example.com"},
+	}
+	cert := NewCertificate(&nginx)
+	assert.Equal(t, "cert-manager.io/v1", cert.GetAPIVersion())
+	assert.Equal(t, "Certificate", cert.GetKind())
+	assert.Equal(t, "my-nginx", cert.GetName())
+	assert.Equal(t, "default", cert.GetNamespace())
+	assert.Len(t, cert.GetOwnerReferences(), 1)
+	assert.Equal(t, LabelsForNginx("my-nginx"), cert.GetLabels())
+	spec, _ := unstructured.NestedMap(cert.Object, "spec")
+	assert.Equal(t, map[string]interface{}{
+		"secretName": "my-nginx-tls",
+		"dnsNames":   []interface{}{"example.com", "*.example.com"},
+		"issuerRef": map[string]interface{}{
+			"name":  "letsencrypt",
+			"kind":  "ClusterIssuer",
+			"group": "cert-manager.io",
+		},
+	}, spec)
+
+	nginx.Spec.Certificates.SecretName = "example-com"
+	secretName, _ := unstructured.NestedString(NewCertificate(&nginx).Object, "spec", "secretName")
+	assert.Equal(t, "example-com", secretName)
+}
+
+func TestWithCertificateTLS(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, WithCertificateTLS(&nginx).TLSSecret)
+
+	nginx.Spec.Certificates = &v1alpha1.NginxCertificates{IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt"}}
+	assert.Equal(t, &v1alpha1.TLSSecret{SecretName: "my-nginx-tls"}, WithCertificateTLS(&nginx).TLSSecret)
+	assert.Nil(t, nginx.Spec.TLSSecret)
+
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "my-nginx-tls", KeyPath: "site.key"}
+	assert.Equal(t, nginx.Spec.TLSSecret, WithCertificateTLS(&nginx).TLSSecret)
+}
+
+func TestCertificateRevision(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Certificates = &v1alpha1.NginxCertificates{IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt"}}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, CertificateRevisionPodAnnotation)
+
+	revision := CertificateRevision([]byte("certificate"))
+	assert.Len(t, revision, 16)
+	assert.NotEqual(t, revision, CertificateRevision([]byte("renewed certificate")))
+	nginx.Status.CertificateRevision = revision
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, revision, dep.Spec.Template.Annotations[CertificateRevisionPodAnnotation])
+
+	assert.False(t, PodRestartRequested(dep.Spec.Template.Annotations, map[string]string{CertificateRevisionPodAnnotation: revision}))
+	assert.True(t, PodRestartRequested(dep.Spec.Template.Annotations, nil))
+}
+
+func TestValidateCertificates(t *testing.T) {
+	tests := []struct {
+		name         string
+		certificates *v1alpha1.NginxCertificates
+		tls          *v1alpha1.TLSSecret
+		want         []string
+	}{
+		{name: "none"},
+		{
+			name:         "valid",
+			certificates: &v1alpha1.NginxCertificates{IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt"}, DNSNames: []string{"*.example.com"}},
+			tls:          &v1alpha1.TLSSecret{SecretName: "my-nginx-tls", KeyPath: "site.key"},
+		},
+		{
+			name:         "invalid",
+			certificates: &v1alpha1.NginxCertificates{DNSNames: []string{"Example.com"}, SecretName: "my_secret"},
+			tls:          &v1alpha1.TLSSecret{SecretName: "other"},
+			want: []string{
+				"spec.certificates.issuerRef.name is required",
+				`spec.certificates.dnsNames[0] "Example.com" is invalid: a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+				`spec.certificates.secretName "my_secret" is invalid: a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+				`spec.tlsSecret.SecretName must be the certificate secret "my_secret" when spec.certificates is set`,
+			},
+		},
+		{
+			name:         "no-dns-names",
+			certificates: &v1alpha1.NginxCertificates{IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt"}},
+			want:         []string{"spec.certificates.dnsNames must not be empty"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.Certificates = tt.certificates
+			nginx.Spec.TLSSecret = tt.tls
+			assert.Equal(t, tt.want, validateCertificates(&nginx))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CleanupFinalizer is set on nginx objects with a cleanup policy, so the
+// operator can drain the pods and detach the retained objects before the
+// garbage collector removes the objects created for the nginx.
+const CleanupFinalizer = "nginx.tsuru.io/cleanup"
+
+// NeedsCleanup reports whether the nginx requires cleanup on deletion
+func NeedsCleanup(n *v1alpha1.Nginx) bool {
+	p := n.Spec.CleanupPolicy
+	return p != nil && (len(p.Retain) > 0 || p.DrainSeconds > 0)
+}
+
+// Retains reports whether the object is kept after the nginx is deleted
+func Retains(n *v1alpha1.Nginx, o v1alpha1.CleanupObject) bool {
+	if n.Spec.CleanupPolicy == nil {
+		return false
+	}
+	for _, r := range n.Spec.CleanupPolicy.Retain {
+		if r == o {
+			return true
+		}
+	}
+	return false
+}
+
+// DrainRemaining returns how long the pods of a nginx being deleted must
+// still be kept running, counting from its deletion timestamp
+func DrainRemaining(n *v1alpha1.Nginx, now time.Time) time.Duration {
+	if n.Spec.CleanupPolicy == nil || n.DeletionTimestamp == nil {
+		return 0
+	}
+	end := n.DeletionTimestamp.Add(time.Duration(n.Spec.CleanupPolicy.DrainSeconds) * time.Second)
+	if remaining := end.Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// validateCleanupPolicy returns the errors found in the cleanup policy
+func validateCleanupPolicy(spec *v1alpha1.NginxSpec) []string {
+	p := spec.CleanupPolicy
+	if p == nil {
+		return nil
+	}
+	var errs []string
+	if p.DrainSeconds < 0 {
+		errs = append(errs, "spec.cleanupPolicy.drainSeconds must not be negative")
+	}
+	seen := make(map[v1alpha1.CleanupObject]int)
+	for i, r := range p.Retain {
+		field := fmt.Sprintf("spec.cleanupPolicy.retain[%d]", i)
+		switch r {
+		case v1alpha1.CleanupObjectWorkload, v1alpha1.CleanupObjectService, v1alpha1.CleanupObjectIngress, v1alpha1.CleanupObjectPodDisruptionBudget:
+		default:
+			errs = append(errs, fmt.Sprintf("%s %q is not supported", field, r))
+			continue
+		}
+		if other, ok := seen[r]; ok {
+			errs = append(errs, fmt.Sprintf("%s %q is already listed in spec.cleanupPolicy.retain[%d]", field, r, other))
+			continue
+		}
+		seen[r] = i
+	}
+	if _, ok := seen[v1alpha1.CleanupObjectWorkload]; ok {
+		if d := spec.DeletePropagation; d != nil && *d == metav1.DeletePropagationForeground {
+			errs = append(errs, "spec.cleanupPolicy.retain Workload is not supported with spec.deletePropagation Foreground")
+		}
+	}
+	return errs
+}
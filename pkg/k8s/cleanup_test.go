@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNeedsCleanup(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *v1alpha1.CleanupPolicy
+		want   bool
+	}{
+		{name: "no-policy"},
+		{name: "empty-policy", policy: &v1alpha1.CleanupPolicy{}},
+		{name: "retain", policy: &v1alpha1.CleanupPolicy{Retain: []v1alpha1.CleanupObject{v1alpha1.CleanupObjectService}}, want: true},
+		{name: "drain", policy: &v1alpha1.CleanupPolicy{DrainSeconds: 30}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.CleanupPolicy = tt.policy
+			assert.Equal(t, tt.want, NeedsCleanup(&nginx))
+		})
+	}
+}
+
+func TestRetains(t *testing.T) {
+	nginx := baseNginx()
+	assert.False(t, Retains(&nginx, v1alpha1.CleanupObjectService))
+	nginx.Spec.CleanupPolicy = &v1alpha1.CleanupPolicy{
+		Retain: []v1alpha1.CleanupObject{v1alpha1.CleanupObjectService, v1alpha1.CleanupObjectIngress},
+	}
+	assert.True(t, Retains(&nginx, v1alpha1.CleanupObjectService))
+	assert.True(t, Retains(&nginx, v1alpha1.CleanupObjectIngress))
+	assert.False(t, Retains(&nginx, v1alpha1.CleanupObjectWorkload))
+}
+
+func TestDrainRemaining(t *testing.T) {
+	deleted := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		policy    *v1alpha1.CleanupPolicy
+		deletedAt *metav1.Time
+		now       time.Time
+		want      time.Duration
+	}{
+		{name: "no-policy", deletedAt: &metav1.Time{Time: deleted}, now: deleted},
+		{name: "not-deleted", policy: &v1alpha1.CleanupPolicy{DrainSeconds: 30}, now: deleted},
+		{name: "draining", policy: &v1alpha1.CleanupPolicy{DrainSeconds: 30}, deletedAt: &metav1.Time{Time: deleted}, now: deleted.Add(10 * time.Second), want: 20 * time.Second},
+		{name: "drained", policy: &v1alpha1.CleanupPolicy{DrainSeconds: 30}, deletedAt: &metav1.Time{Time: deleted}, now: deleted.Add(time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.CleanupPolicy = tt.policy
+			nginx.DeletionTimestamp = tt.deletedAt
+			assert.Equal(t, tt.want, DrainRemaining(&nginx, tt.now))
+		})
+	}
+}
+
+func TestValidateCleanupPolicy(t *testing.T) {
+	foreground := metav1.DeletePropagationForeground
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "no-policy"},
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{CleanupPolicy: &v1alpha1.CleanupPolicy{
+				Retain:       []v1alpha1.CleanupObject{v1alpha1.CleanupObjectWorkload, v1alpha1.CleanupObjectPodDisruptionBudget},
+				DrainSeconds: 30,
+			}},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{CleanupPolicy: &v1alpha1.CleanupPolicy{
+				Retain:       []v1alpha1.CleanupObject{"ConfigMap", v1alpha1.CleanupObjectService, v1alpha1.CleanupObjectService},
+				DrainSeconds: -1,
+			}},
+			want: []string{
+				"spec.cleanupPolicy.drainSeconds must not be negative",
+				`spec.cleanupPolicy.retain[0] "ConfigMap" is not supported`,
+				`spec.cleanupPolicy.retain[2] "Service" is already listed in spec.cleanupPolicy.retain[1]`,
+			},
+		},
+		{
+			name: "retain-workload-with-foreground",
+			spec: v1alpha1.NginxSpec{
+				DeletePropagation: &foreground,
+				CleanupPolicy:     &v1alpha1.CleanupPolicy{Retain: []v1alpha1.CleanupObject{v1alpha1.CleanupObjectWorkload}},
+			},
+			want: []string{"spec.cleanupPolicy.retain Workload is not supported with spec.deletePropagation Foreground"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateCleanupPolicy(&tt.spec))
+		})
+	}
+}
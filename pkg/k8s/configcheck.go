@@ -0,0 +1,87 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ConfigCheckLabel is set on the jobs validating the nginx config
+const ConfigCheckLabel = "nginx.tsuru.io/config-check"
+
+// LabelsForConfigCheck returns the labels of the config validation jobs of
+// the Nginx CR with the given name. They do not match LabelsForNginx, so the
+// job pods are never selected by the nginx service.
+func LabelsForConfigCheck(name string) map[string]string {
+	return map[string]string{
+		"nginx_cr":       name,
+		ConfigCheckLabel: "true",
+	}
+}
+
+// ConfigCheckOptions are the options of the config validation jobs
+type ConfigCheckOptions struct {
+	// ConfigVersion identifies the content of the config. It should change
+	// whenever the content changes, so the new content is validated.
+	ConfigVersion string
+}
+
+// NewConfigCheckJob assembles a job running `nginx -t` with the pod template
+// of the given deployment. The job name is derived from the template and the
+// config version.
+func NewConfigCheckJob(n *v1alpha1.Nginx, deployment *appv1.Deployment, opts ConfigCheckOptions) (*batchv1.Job, error) {
+	template := deployment.Spec.Template.DeepCopy()
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(append(data, opts.ConfigVersion...)))
+
+	template.Labels = LabelsForConfigCheck(n.Name)
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	// Sidecars would keep the job running
+	template.Spec.Containers = template.Spec.Containers[:1]
+	container := &template.Spec.Containers[0]
+	container.Command = []string{"nginx", "-t"}
+	if hasCustomGlobals(&n.Spec) {
+		container.Command = append(container.Command, "-g", nginxGlobals(&n.Spec))
+	}
+	container.Args = nil
+	container.Ports = nil
+	container.ReadinessProbe = nil
+	container.LivenessProbe = nil
+	container.Lifecycle = nil
+	container.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+
+	backoffLimit := int32(0)
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n.Name + "-config-check-" + hash[:10],
+			Namespace: n.Namespace,
+			Labels:    LabelsForConfigCheck(n.Name),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     *template,
+		},
+	}, nil
+}
@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewConfigCheckJob(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindConfigMap, Name: "my-config"}
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{}
+	deployment, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	job, err := NewConfigCheckJob(&nginx, deployment, ConfigCheckOptions{ConfigVersion: "1"})
+	assert.Nil(t, err)
+	assert.Regexp(t, "^my-nginx-config-check-[0-9a-f]{10}$", job.Name)
+	assert.Equal(t, "default", job.Namespace)
+	assert.Equal(t, map[string]string{"nginx_cr": "my-nginx", ConfigCheckLabel: "true"}, job.Labels)
+	assert.Len(t, job.OwnerReferences, 1)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, job.Labels, job.Spec.Template.Labels)
+	assert.Equal(t, corev1.RestartPolicyNever, podSpec.RestartPolicy)
+	assert.Len(t, podSpec.Containers, 1)
+	assert.Equal(t, []string{"nginx", "-t"}, podSpec.Containers[0].Command)
+	assert.Nil(t, podSpec.Containers[0].ReadinessProbe)
+	assert.Nil(t, podSpec.Containers[0].Ports)
+	assert.Equal(t, deployment.Spec.Template.Spec.Volumes, podSpec.Volumes)
+	assert.Equal(t, deployment.Spec.Template.Spec.Containers[0].VolumeMounts, podSpec.Containers[0].VolumeMounts)
+
+	sameJob, err := NewConfigCheckJob(&nginx, deployment, ConfigCheckOptions{ConfigVersion: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, job.Name, sameJob.Name)
+
+	otherVersion, err := NewConfigCheckJob(&nginx, deployment, ConfigCheckOptions{ConfigVersion: "2"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, job.Name, otherVersion.Name)
+
+	assert.NotNil(t, deployment.Spec.Template.Spec.Containers[0].ReadinessProbe)
+}
@@ -0,0 +1,215 @@
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Volume holding the auxiliary config files when no config is mounted
+const configFilesVolume = "nginx-config-files"
+
+// reservedConfigFiles are the entries of /etc/nginx managed by other fields
+var reservedConfigFiles = map[string]string{
+	"nginx.conf": "spec.configRef",
+	"conf.d":     "the default server config",
+	"certs":      "spec.tlsSecret",
+}
+
+// reservedExtraFiles are the files of /etc/nginx managed by other fields
+// that extra files cannot replace. Extra files may be placed in conf.d next
+// to them.
+var reservedExtraFiles = map[string]string{
+	"nginx.conf":              "spec.configRef",
+	"conf.d/default.conf":     "the default server config",
+	"conf.d/stub_status.conf": "spec.metrics",
+}
+
+// configFile is a file placed in /etc/nginx from a key of a ConfigMap or a
+// Secret
+type configFile struct {
+	// path of the file relative to /etc/nginx
+	path   string
+	source corev1.VolumeProjection
+}
+
+// configFiles returns the auxiliary config files and the extra files of the
+// spec. The spec must have its default values already set.
+func configFiles(spec *v1alpha1.NginxSpec) []configFile {
+	var files []configFile
+	for _, f := range spec.ConfigFiles {
+		files = append(files, configFile{path: f.Name, source: corev1.VolumeProjection{ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: f.ConfigMap},
+			Items:                []corev1.KeyToPath{{Key: f.Key, Path: f.Name}},
+		}}})
+	}
+	for _, f := range spec.ExtraFiles {
+		path := extraFilePath(f.Path)
+		items := []corev1.KeyToPath{{Key: f.Key, Path: path, Mode: f.Mode}}
+		var source corev1.VolumeProjection
+		if f.Secret != "" {
+			source.Secret = &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: f.Secret},
+				Items:                items,
+			}
+		} else {
+			source.ConfigMap = &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: f.ConfigMap},
+				Items:                items,
+			}
+		}
+		files = append(files, configFile{path: path, source: source})
+	}
+	return files
+}
+
+// extraFilePath returns the path of an extra file relative to /etc/nginx
+func extraFilePath(p string) string {
+	return strings.TrimPrefix(p, configMountPath+"/")
+}
+
+// setupConfigFiles places the auxiliary config files and the extra files in
+// /etc/nginx. It must run after mountConfig: with a config mounted
+// as a directory over /etc/nginx the files are projected into the config
+// volume, since the mount shadows the files of the image, otherwise each file
+// is mounted over the one of the image.
+func setupConfigFiles(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	files := configFiles(spec)
+	if len(files) == 0 {
+		return
+	}
+	var sources []corev1.VolumeProjection
+	for _, f := range files {
+		sources = append(sources, f.source)
+	}
+
+	podSpec := &dep.Spec.Template.Spec
+	if configDirectoryMounted(spec) {
+		for i := range podSpec.Volumes {
+			v := &podSpec.Volumes[i]
+			if v.Name != "nginx-config" {
+				continue
+			}
+			config := corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: v.ConfigMap.LocalObjectReference},
+			}
+			v.VolumeSource = corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources: append([]corev1.VolumeProjection{config}, sources...),
+			}}
+		}
+		return
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         configFilesVolume,
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: sources}},
+	})
+	nginx := &podSpec.Containers[0]
+	for _, f := range files {
+		nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+			Name:      configFilesVolume,
+			MountPath: configMountPath + "/" + f.path,
+			SubPath:   f.path,
+		})
+	}
+}
+
+// validateConfigFiles returns the errors found in the auxiliary config files
+func validateConfigFiles(files []v1alpha1.NginxConfigFile) []string {
+	var errs []string
+	names := make(map[string]int)
+	for i, f := range files {
+		field := fmt.Sprintf("spec.configFiles[%d]", i)
+		if f.Name == "" {
+			errs = append(errs, fmt.Sprintf("%s.name is required", field))
+		} else if msgs := validation.IsConfigMapKey(f.Name); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s.name %q is invalid: %s", field, f.Name, strings.Join(msgs, ", ")))
+		} else if owner, ok := reservedConfigFiles[f.Name]; ok {
+			errs = append(errs, fmt.Sprintf("%s.name %q is managed by %s", field, f.Name, owner))
+		} else if other, ok := names[f.Name]; ok {
+			errs = append(errs, fmt.Sprintf("%s.name %q is already used by spec.configFiles[%d]", field, f.Name, other))
+		} else {
+			names[f.Name] = i
+		}
+		if f.ConfigMap == "" {
+			errs = append(errs, fmt.Sprintf("%s.configMap is required", field))
+		}
+		if f.Key != "" {
+			if msgs := validation.IsConfigMapKey(f.Key); len(msgs) > 0 {
+				errs = append(errs, fmt.Sprintf("%s.key %q is invalid: %s", field, f.Key, strings.Join(msgs, ", ")))
+			}
+		}
+	}
+	return errs
+}
+
+// validateExtraFiles returns the errors found in the extra files. They
+// cannot replace the auxiliary config files, nor be placed in a directory
+// that is another file.
+func validateExtraFiles(spec *v1alpha1.NginxSpec) []string {
+	var errs []string
+	paths := make(map[string]string)
+	for i, f := range spec.ConfigFiles {
+		paths[f.Name] = fmt.Sprintf("spec.configFiles[%d]", i)
+	}
+	for i, f := range spec.ExtraFiles {
+		field := fmt.Sprintf("spec.extraFiles[%d]", i)
+		p := extraFilePath(f.Path)
+		switch {
+		case f.Path == "":
+			errs = append(errs, fmt.Sprintf("%s.path is required", field))
+		case !strings.HasPrefix(f.Path, configMountPath+"/") || path.Clean(f.Path) != f.Path:
+			errs = append(errs, fmt.Sprintf("%s.path %q must be a clean absolute path under %s", field, f.Path, configMountPath))
+		default:
+			if msg := extraFilePathError(p, paths); msg != "" {
+				errs = append(errs, fmt.Sprintf("%s.path %q %s", field, f.Path, msg))
+			} else {
+				paths[p] = field
+			}
+		}
+		if (f.ConfigMap == "") == (f.Secret == "") {
+			errs = append(errs, fmt.Sprintf("%s must set exactly one of configMap or secret", field))
+		}
+		if f.Key != "" {
+			if msgs := validation.IsConfigMapKey(f.Key); len(msgs) > 0 {
+				errs = append(errs, fmt.Sprintf("%s.key %q is invalid: %s", field, f.Key, strings.Join(msgs, ", ")))
+			}
+		}
+		if m := f.Mode; m != nil && (*m < 0 || *m > 0777) {
+			errs = append(errs, fmt.Sprintf("%s.mode must be between 0 and 0777", field))
+		}
+	}
+	return errs
+}
+
+// extraFilePathError returns why the given path of an extra file, relative
+// to /etc/nginx, cannot be used next to the given paths of the other files
+func extraFilePathError(p string, paths map[string]string) string {
+	segments := strings.Split(p, "/")
+	for _, s := range segments {
+		if msgs := validation.IsConfigMapKey(s); len(msgs) > 0 {
+			return fmt.Sprintf("is invalid: %s", strings.Join(msgs, ", "))
+		}
+	}
+	if owner, ok := reservedExtraFiles[p]; ok {
+		return fmt.Sprintf("is managed by %s", owner)
+	}
+	if segments[0] == "certs" || p == "conf.d" {
+		return fmt.Sprintf("is managed by %s", reservedConfigFiles[segments[0]])
+	}
+	if other, ok := paths[p]; ok {
+		return fmt.Sprintf("is already used by %s", other)
+	}
+	for other, field := range paths {
+		if strings.HasPrefix(other, p+"/") || strings.HasPrefix(p, other+"/") {
+			return fmt.Sprintf("conflicts with the path of %s", field)
+		}
+	}
+	return ""
+}
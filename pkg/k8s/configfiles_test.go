@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetupConfigFiles(t *testing.T) {
+	files := []v1alpha1.NginxConfigFile{
+		{Name: "mime.types", ConfigMap: "mime"},
+		{Name: "fastcgi_params", ConfigMap: "php", Key: "params"},
+	}
+	projections := []corev1.VolumeProjection{
+		{ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "mime"},
+			Items:                []corev1.KeyToPath{{Key: "mime.types", Path: "mime.types"}},
+		}},
+		{ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "php"},
+			Items:                []corev1.KeyToPath{{Key: "params", Path: "fastcgi_params"}},
+		}},
+	}
+
+	t.Run("without-config", func(t *testing.T) {
+		nginx := baseNginx()
+		nginx.Spec.ConfigFiles = files
+		dep, err := NewDeployment(&nginx)
+		assert.Nil(t, err)
+		podSpec := dep.Spec.Template.Spec
+		assert.Contains(t, podSpec.Volumes, corev1.Volume{
+			Name:         "nginx-config-files",
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: projections}},
+		})
+		assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name: "nginx-config-files", MountPath: "/etc/nginx/mime.types", SubPath: "mime.types",
+		})
+		assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name: "nginx-config-files", MountPath: "/etc/nginx/fastcgi_params", SubPath: "fastcgi_params",
+		})
+	})
+
+	t.Run("config-file", func(t *testing.T) {
+		nginx := baseNginx()
+		nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "conf"}
+		nginx.Spec.ConfigFiles = files
+		dep, err := NewDeployment(&nginx)
+		assert.Nil(t, err)
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: "nginx-config", MountPath: "/etc/nginx/nginx.conf", SubPath: "nginx.conf"},
+			{Name: "nginx-config-files", MountPath: "/etc/nginx/mime.types", SubPath: "mime.types"},
+			{Name: "nginx-config-files", MountPath: "/etc/nginx/fastcgi_params", SubPath: "fastcgi_params"},
+		}, dep.Spec.Template.Spec.Containers[0].VolumeMounts)
+	})
+
+	t.Run("configmap-config-directory", func(t *testing.T) {
+		nginx := baseNginx()
+		nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "conf", Mount: v1alpha1.ConfigMountDirectory}
+		nginx.Spec.ConfigFiles = files
+		dep, err := NewDeployment(&nginx)
+		assert.Nil(t, err)
+		config := corev1.VolumeProjection{ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "conf"},
+		}}
+		assert.Equal(t, []corev1.Volume{{
+			Name: "nginx-config",
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources: append([]corev1.VolumeProjection{config}, projections...),
+			}},
+		}}, dep.Spec.Template.Spec.Volumes)
+		assert.Equal(t, []corev1.VolumeMount{{Name: "nginx-config", MountPath: "/etc/nginx"}}, dep.Spec.Template.Spec.Containers[0].VolumeMounts)
+	})
+
+	t.Run("inline-config-directory", func(t *testing.T) {
+		nginx := baseNginx()
+		nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "inline", Kind: v1alpha1.ConfigKindInline, Value: "events {}", Mount: v1alpha1.ConfigMountDirectory}
+		nginx.Spec.ConfigFiles = files[:1]
+		dep, err := NewDeployment(&nginx)
+		assert.Nil(t, err)
+		sources := dep.Spec.Template.Spec.Volumes[0].Projected.Sources
+		assert.Len(t, sources, 2)
+		assert.Equal(t, "my-nginx-inline-config", sources[0].ConfigMap.Name)
+		assert.Equal(t, projections[0], sources[1])
+	})
+}
+
+func TestValidateConfigFiles(t *testing.T) {
+	assert.Nil(t, validateConfigFiles([]v1alpha1.NginxConfigFile{
+		{Name: "mime.types", ConfigMap: "mime"},
+		{Name: "uwsgi_params", ConfigMap: "python", Key: "uwsgi"},
+	}))
+	assert.Equal(t, []string{
+		"spec.configFiles[0].name is required",
+		`spec.configFiles[1].name "conf/mime.types" is invalid: a valid config key must consist of alphanumeric characters, '-', '_' or '.' (e.g. 'key.name',  or 'KEY_NAME',  or 'key-name', regex used for validation is '[-._a-zA-Z0-9]+')`,
+		"spec.configFiles[1].configMap is required",
+		`spec.configFiles[2].name "nginx.conf" is managed by spec.configRef`,
+		`spec.configFiles[4].name "mime.types" is already used by spec.configFiles[3]`,
+		`spec.configFiles[4].key ".." is invalid: must not be '..'`,
+	}, validateConfigFiles([]v1alpha1.NginxConfigFile{
+		{ConfigMap: "a"},
+		{Name: "conf/mime.types"},
+		{Name: "nginx.conf", ConfigMap: "a"},
+		{Name: "mime.types", ConfigMap: "a"},
+		{Name: "mime.types", ConfigMap: "b", Key: ".."},
+	}))
+}
+
+func TestSetupExtraFiles(t *testing.T) {
+	mode := int32(0640)
+	nginx := baseNginx()
+	nginx.Spec.ConfigFiles = []v1alpha1.NginxConfigFile{{Name: "mime.types", ConfigMap: "mime"}}
+	nginx.Spec.ExtraFiles = []v1alpha1.NginxExtraFile{
+		{Path: "/etc/nginx/htpasswd/users", Secret: "users", Mode: &mode},
+		{Path: "/etc/nginx/conf.d/cors.conf", ConfigMap: "snippets", Key: "cors"},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	podSpec := dep.Spec.Template.Spec
+	assert.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name: "nginx-config-files",
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+			{ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "mime"},
+				Items:                []corev1.KeyToPath{{Key: "mime.types", Path: "mime.types"}},
+			}},
+			{Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "users"},
+				Items:                []corev1.KeyToPath{{Key: "users", Path: "htpasswd/users", Mode: &mode}},
+			}},
+			{ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "snippets"},
+				Items:                []corev1.KeyToPath{{Key: "cors", Path: "conf.d/cors.conf"}},
+			}},
+		}}},
+	})
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name: "nginx-config-files", MountPath: "/etc/nginx/htpasswd/users", SubPath: "htpasswd/users",
+	})
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name: "nginx-config-files", MountPath: "/etc/nginx/conf.d/cors.conf", SubPath: "conf.d/cors.conf",
+	})
+
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "conf", Mount: v1alpha1.ConfigMountDirectory}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "nginx-config", MountPath: "/etc/nginx"}}, dep.Spec.Template.Spec.Containers[0].VolumeMounts[:1])
+	sources := dep.Spec.Template.Spec.Volumes[0].Projected.Sources
+	assert.Len(t, sources, 4)
+	assert.Equal(t, "users", sources[2].Secret.Name)
+}
+
+func TestValidateExtraFiles(t *testing.T) {
+	mode := int32(01000)
+	assert.Nil(t, validateExtraFiles(&v1alpha1.NginxSpec{ExtraFiles: []v1alpha1.NginxExtraFile{
+		{Path: "/etc/nginx/htpasswd/users", Secret: "users"},
+		{Path: "/etc/nginx/conf.d/cors.conf", ConfigMap: "snippets", Key: "cors"},
+		{Path: "/etc/nginx/geoip/GeoLite2-Country.mmdb", Secret: "geoip"},
+	}}))
+	assert.Equal(t, []string{
+		"spec.extraFiles[0].path is required",
+		"spec.extraFiles[0] must set exactly one of configMap or secret",
+		`spec.extraFiles[1].path "/etc/htpasswd" must be a clean absolute path under /etc/nginx`,
+		"spec.extraFiles[1] must set exactly one of configMap or secret",
+		`spec.extraFiles[2].path "/etc/nginx/../passwd" must be a clean absolute path under /etc/nginx`,
+		`spec.extraFiles[3].path "/etc/nginx/conf.d/default.conf" is managed by the default server config`,
+		`spec.extraFiles[4].path "/etc/nginx/certs/dhparam.pem" is managed by spec.tlsSecret`,
+		`spec.extraFiles[5].path "/etc/nginx/mime.types" is already used by spec.configFiles[0]`,
+		`spec.extraFiles[7].path "/etc/nginx/htpasswd/users" conflicts with the path of spec.extraFiles[6]`,
+		`spec.extraFiles[7].key ".." is invalid: must not be '..'`,
+		"spec.extraFiles[7].mode must be between 0 and 0777",
+	}, validateExtraFiles(&v1alpha1.NginxSpec{
+		ConfigFiles: []v1alpha1.NginxConfigFile{{Name: "mime.types", ConfigMap: "mime"}},
+		ExtraFiles: []v1alpha1.NginxExtraFile{
+			{},
+			{Path: "/etc/htpasswd", ConfigMap: "a", Secret: "a"},
+			{Path: "/etc/nginx/../passwd", Secret: "a"},
+			{Path: "/etc/nginx/conf.d/default.conf", ConfigMap: "a"},
+			{Path: "/etc/nginx/certs/dhparam.pem", Secret: "a"},
+			{Path: "/etc/nginx/mime.types", ConfigMap: "a"},
+			{Path: "/etc/nginx/htpasswd", Secret: "a"},
+			{Path: "/etc/nginx/htpasswd/users", Secret: "a", Key: "..", Mode: &mode},
+		},
+	}))
+}
@@ -0,0 +1,85 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Volume holding the config sources projected into conf.d
+const configSourcesVolume = "nginx-config-sources"
+
+// configDirectoryMounted returns whether a config object is mounted as a
+// directory over /etc/nginx
+func configDirectoryMounted(spec *v1alpha1.NginxSpec) bool {
+	return configMounted(spec.Config) && spec.Config.Mount == v1alpha1.ConfigMountDirectory
+}
+
+// mountConfigSources projects the config sources, in order, into a volume
+// mounted over /etc/nginx/conf.d. The files of a source replace the ones of
+// the same name of the sources before it, like the projected volumes do.
+func mountConfigSources(conf *v1alpha1.ConfigRef, dep *appv1.Deployment) {
+	if conf == nil || len(conf.Sources) == 0 {
+		return
+	}
+	var sources []corev1.VolumeProjection
+	for _, s := range conf.Sources {
+		if s.Secret != "" {
+			sources = append(sources, corev1.VolumeProjection{Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.Secret},
+			}})
+		} else {
+			sources = append(sources, corev1.VolumeProjection{ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.ConfigMap},
+			}})
+		}
+	}
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         configSourcesVolume,
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: sources}},
+	})
+	nginx := &podSpec.Containers[0]
+	nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+		Name:      configSourcesVolume,
+		MountPath: defaultConfigIncludePath,
+		ReadOnly:  true,
+	})
+}
+
+// validateConfigSources returns the errors found in the config sources. The
+// extra files cannot be placed in conf.d, which is replaced by the sources.
+func validateConfigSources(spec *v1alpha1.NginxSpec) []string {
+	conf := spec.Config
+	if conf == nil || len(conf.Sources) == 0 {
+		return nil
+	}
+	var errs []string
+	seen := make(map[v1alpha1.ConfigSource]int)
+	for i, s := range conf.Sources {
+		field := fmt.Sprintf("spec.configRef.sources[%d]", i)
+		if (s.ConfigMap == "") == (s.Secret == "") {
+			errs = append(errs, fmt.Sprintf("%s must set exactly one of configMap or secret", field))
+			continue
+		}
+		name := s.ConfigMap + s.Secret
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s name %q is invalid: %s", field, name, strings.Join(msgs, ", ")))
+		} else if other, ok := seen[s]; ok {
+			errs = append(errs, fmt.Sprintf("%s is already projected by spec.configRef.sources[%d]", field, other))
+		} else {
+			seen[s] = i
+		}
+	}
+	for i, f := range spec.ExtraFiles {
+		if strings.HasPrefix(f.Path, defaultConfigIncludePath+"/") {
+			errs = append(errs, fmt.Sprintf("spec.extraFiles[%d].path %q cannot be placed in conf.d, which is replaced by spec.configRef.sources", i, f.Path))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMountConfigSources(t *testing.T) {
+	sources := []v1alpha1.ConfigSource{
+		{ConfigMap: "base"},
+		{Secret: "credentials"},
+		{ConfigMap: "overrides"},
+	}
+	projected := corev1.Volume{
+		Name: "nginx-config-sources",
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+			{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "base"}}},
+			{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "credentials"}}},
+			{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "overrides"}}},
+		}}},
+	}
+	sourcesMount := corev1.VolumeMount{Name: "nginx-config-sources", MountPath: "/etc/nginx/conf.d", ReadOnly: true}
+
+	t.Run("without-name", func(t *testing.T) {
+		nginx := baseNginx()
+		nginx.Spec.Config = &v1alpha1.ConfigRef{Sources: sources}
+		dep, err := NewDeployment(&nginx)
+		assert.Nil(t, err)
+		assert.Equal(t, []corev1.Volume{projected}, dep.Spec.Template.Spec.Volumes)
+		assert.Equal(t, []corev1.VolumeMount{sourcesMount}, dep.Spec.Template.Spec.Containers[0].VolumeMounts)
+	})
+
+	t.Run("with-name", func(t *testing.T) {
+		nginx := baseNginx()
+		nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "conf", Sources: sources}
+		dep, err := NewDeployment(&nginx)
+		assert.Nil(t, err)
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: "nginx-config", MountPath: "/etc/nginx/nginx.conf", SubPath: "nginx.conf"},
+			sourcesMount,
+		}, dep.Spec.Template.Spec.Containers[0].VolumeMounts)
+		assert.Contains(t, dep.Spec.Template.Spec.Volumes, projected)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		nginx := baseNginx()
+		nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "conf", Sources: sources}
+		nginx.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+		assert.Equal(t, []string{"/etc/nginx/..data", "/etc/nginx/conf.d/..data"}, reloadLinks(nginx.Spec.WithDefaults()))
+
+		nginx.Spec.Config.Name = ""
+		assert.Equal(t, []string{"/etc/nginx/conf.d/..data"}, reloadLinks(nginx.Spec.WithDefaults()))
+		dep, err := NewDeployment(&nginx)
+		assert.Nil(t, err)
+		assert.NotContains(t, dep.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "nginx-config", MountPath: "/etc/nginx"})
+	})
+}
+
+func TestValidateConfigSources(t *testing.T) {
+	assert.Nil(t, validateConfigSources(&v1alpha1.NginxSpec{}))
+	assert.Nil(t, validateConfigSources(&v1alpha1.NginxSpec{
+		Config: &v1alpha1.ConfigRef{Sources: []v1alpha1.ConfigSource{{ConfigMap: "base"}, {Secret: "base"}}},
+		ExtraFiles: []v1alpha1.NginxExtraFile{
+			{Path: "/etc/nginx/htpasswd/users", Secret: "users"},
+		},
+	}))
+	assert.Equal(t, []string{
+		"spec.configRef.sources[0] must set exactly one of configMap or secret",
+		"spec.configRef.sources[1] must set exactly one of configMap or secret",
+		`spec.configRef.sources[2] name "Base" is invalid: a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+		"spec.configRef.sources[4] is already projected by spec.configRef.sources[3]",
+		`spec.extraFiles[0].path "/etc/nginx/conf.d/cors.conf" cannot be placed in conf.d, which is replaced by spec.configRef.sources`,
+	}, validateConfigSources(&v1alpha1.NginxSpec{
+		Config: &v1alpha1.ConfigRef{Sources: []v1alpha1.ConfigSource{
+			{},
+			{ConfigMap: "a", Secret: "a"},
+			{ConfigMap: "Base"},
+			{ConfigMap: "base"},
+			{ConfigMap: "base"},
+		}},
+		ExtraFiles: []v1alpha1.NginxExtraFile{
+			{Path: "/etc/nginx/conf.d/cors.conf", ConfigMap: "snippets"},
+		},
+	}))
+}
@@ -0,0 +1,186 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ConfigTemplateRevisionPodAnnotation is the pod template annotation holding
+// the revision of the config rendered from the config template. Changing it
+// replaces the pods, so nginx loads the new config.
+const ConfigTemplateRevisionPodAnnotation = "nginx.tsuru.io/config-template-revision"
+
+// ConfigTemplateData holds the values available to config templates
+type ConfigTemplateData struct {
+	Name      string
+	Namespace string
+	Replicas  int32
+	HTTPPort  int32
+	// HTTPSPort is zero when TLS is not enabled
+	HTTPSPort int32
+	Ports     []v1alpha1.NginxPort
+	// TLS is nil when TLS is not enabled
+	TLS    *ConfigTemplateTLS
+	Values map[string]string
+}
+
+// ConfigTemplateTLS holds the paths where the certificate and key pair are
+// mounted in the nginx container
+type ConfigTemplateTLS struct {
+	CertificatePath string
+	KeyPath         string
+}
+
+// GeneratedConfigName returns the name of the ConfigMap holding the config
+// rendered from the config template
+func GeneratedConfigName(n *v1alpha1.Nginx) string {
+	return n.Name + "-config"
+}
+
+// WithTemplateConfig returns a copy of the spec using the generated ConfigMap
+// as the config when a config template is set and no config is. The receiver
+// is never modified.
+func WithTemplateConfig(n *v1alpha1.Nginx) *v1alpha1.NginxSpec {
+	out := n.Spec.DeepCopy()
+	if out.ConfigTemplate != nil && out.Config == nil {
+		out.Config = &v1alpha1.ConfigRef{
+			Name: GeneratedConfigName(n),
+			Kind: v1alpha1.ConfigKindConfigMap,
+		}
+	}
+	return out
+}
+
+// NewConfigTemplateData returns the values of the Nginx made available to
+// its config template
+func NewConfigTemplateData(n *v1alpha1.Nginx) ConfigTemplateData {
+	spec := n.Spec.WithDefaults()
+	httpPort, httpsPort := listenPorts(spec)
+	data := ConfigTemplateData{
+		Name:      n.Name,
+		Namespace: n.Namespace,
+		Replicas:  1,
+		HTTPPort:  httpPort,
+		Ports:     spec.PodTemplate.Ports,
+		Values:    spec.Values,
+	}
+	if spec.Replicas != nil {
+		data.Replicas = *spec.Replicas
+	}
+	if data.Values == nil {
+		data.Values = map[string]string{}
+	}
+	if tls := spec.TLSSecret; tls != nil {
+		data.HTTPSPort = httpsPort
+		data.TLS = &ConfigTemplateTLS{
+			CertificatePath: certMountPath + "/" + tls.CertificatePath,
+			KeyPath:         certMountPath + "/" + tls.KeyPath,
+		}
+	}
+	return data
+}
+
+// RenderConfigTemplate renders the config template of the Nginx. Missing
+// keys of .Values are errors rather than empty strings, so typos do not go
+// unnoticed in the config.
+func RenderConfigTemplate(n *v1alpha1.Nginx, text string) (string, error) {
+	tmpl, err := template.New("nginx.conf").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, NewConfigTemplateData(n)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// NewConfigTemplateConfigMap assembles the ConfigMap holding the config
+// rendered from the config template
+func NewConfigTemplateConfigMap(n *v1alpha1.Nginx, config string) *corev1.ConfigMap {
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GeneratedConfigName(n),
+			Namespace: n.Namespace,
+			Labels:    LabelsForNginx(n.Name),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+		},
+		Data: map[string]string{
+			"nginx.conf": config,
+		},
+	}
+	setCustomMetadata(&n.Spec, cm)
+	return cm
+}
+
+// ConfigTemplateRevision returns the revision identifying a rendered config
+func ConfigTemplateRevision(config string) string {
+	return CertificateRevision([]byte(config))
+}
+
+// setupConfigTemplateRevision sets the revision of the rendered config in
+// the pod template, so pods are replaced when it changes. Configs reloaded
+// in place leave the pods running.
+func setupConfigTemplateRevision(n *v1alpha1.Nginx, spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if spec.ConfigTemplate == nil || n.Status.ConfigTemplateRevision == "" {
+		return
+	}
+	if spec.ConfigReload == v1alpha1.ConfigReloadReload && spec.Config != nil && spec.Config.Mount == v1alpha1.ConfigMountDirectory {
+		return
+	}
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = make(map[string]string)
+	}
+	dep.Spec.Template.Annotations[ConfigTemplateRevisionPodAnnotation] = n.Status.ConfigTemplateRevision
+}
+
+// validateConfigTemplate returns the errors found in the config template
+func validateConfigTemplate(n *v1alpha1.Nginx) []string {
+	t := n.Spec.ConfigTemplate
+	if t == nil {
+		if len(n.Spec.Values) > 0 {
+			return []string{"spec.values requires spec.configTemplate"}
+		}
+		return nil
+	}
+	var errs []string
+	switch {
+	case t.ConfigMap == "" && t.Inline == "":
+		errs = append(errs, "spec.configTemplate requires one of configMap or inline")
+	case t.ConfigMap != "" && t.Inline != "":
+		errs = append(errs, "spec.configTemplate configMap and inline are mutually exclusive")
+	case t.Inline != "":
+		if _, err := template.New("nginx.conf").Parse(t.Inline); err != nil {
+			errs = append(errs, fmt.Sprintf("spec.configTemplate.inline is invalid: %v", err))
+		}
+	}
+	if t.Key != "" {
+		if msgs := validation.IsConfigMapKey(t.Key); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("spec.configTemplate.key %q is invalid: %s", t.Key, strings.Join(msgs, ", ")))
+		}
+	}
+	if conf := n.Spec.Config; conf != nil && (conf.Kind == v1alpha1.ConfigKindInline || conf.Name != GeneratedConfigName(n)) {
+		errs = append(errs, fmt.Sprintf("spec.configRef must be the generated config map %q when spec.configTemplate is set", GeneratedConfigName(n)))
+	}
+	return errs
+}
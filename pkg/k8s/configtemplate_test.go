@@ -0,0 +1,155 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestWithTemplateConfig(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, WithTemplateConfig(&nginx).Config)
+
+	nginx.Spec.ConfigTemplate = &v1alpha1.NginxConfigTemplate{Inline: "events {}"}
+	assert.Equal(t, &v1alpha1.ConfigRef{Name: "my-nginx-config", Kind: v1alpha1.ConfigKindConfigMap}, WithTemplateConfig(&nginx).Config)
+	assert.Nil(t, nginx.Spec.Config)
+
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "my-nginx-config", Mount: v1alpha1.ConfigMountFile}
+	assert.Equal(t, nginx.Spec.Config, WithTemplateConfig(&nginx).Config)
+}
+
+func TestRenderConfigTemplate(t *testing.T) {
+	replicas := int32(3)
+	tests := []struct {
+		name     string
+		spec     v1alpha1.NginxSpec
+		template string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "defaults",
+			template: "{{ .Namespace }}/{{ .Name }} replicas={{ .Replicas }} listen={{ .HTTPPort }} tls={{ if .TLS }}on{{ else }}off{{ end }}",
+			want:     "default/my-nginx replicas=1 listen=80 tls=off",
+		},
+		{
+			name: "tls-ports-and-values",
+			spec: v1alpha1.NginxSpec{
+				Replicas:    &replicas,
+				TLSSecret:   &v1alpha1.TLSSecret{SecretName: "my-secret", KeyPath: "site.key"},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{Ports: []v1alpha1.NginxPort{{Name: "admin", ContainerPort: 8080}}},
+				Values:      map[string]string{"upstream": "app:8000"},
+			},
+			template: "{{ .Replicas }} {{ .HTTPSPort }} {{ .TLS.CertificatePath }} {{ .TLS.KeyPath }}{{ range .Ports }} {{ .Name }}:{{ .ContainerPort }}{{ end }} {{ .Values.upstream }}",
+			want:     "3 443 /etc/nginx/certs/tls.crt /etc/nginx/certs/site.key admin:8080 app:8000",
+		},
+		{
+			name:     "missing-value",
+			template: "{{ .Values.upstream }}",
+			wantErr:  `template: nginx.conf:1:10: executing "nginx.conf" at <.Values.upstream>: map has no entry for key "upstream"`,
+		},
+		{
+			name:     "parse-error",
+			template: "{{ .Name ",
+			wantErr:  "template: nginx.conf:1: unclosed action",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec = tt.spec
+			got, err := RenderConfigTemplate(&nginx, tt.template)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewConfigTemplateConfigMap(t *testing.T) {
+	nginx := baseNginx()
+	cm := NewConfigTemplateConfigMap(&nginx, "events {}")
+	assert.Equal(t, "my-nginx-config", cm.Name)
+	assert.Equal(t, "default", cm.Namespace)
+	assert.Equal(t, LabelsForNginx("my-nginx"), cm.Labels)
+	assert.Len(t, cm.OwnerReferences, 1)
+	assert.Equal(t, map[string]string{"nginx.conf": "events {}"}, cm.Data)
+}
+
+func TestConfigTemplateRevision(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.ConfigTemplate = &v1alpha1.NginxConfigTemplate{Inline: "events {}"}
+	nginx.Spec = *WithTemplateConfig(&nginx)
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, ConfigTemplateRevisionPodAnnotation)
+
+	revision := ConfigTemplateRevision("events {}")
+	assert.NotEqual(t, revision, ConfigTemplateRevision("events { worker_connections 512; }"))
+	nginx.Status.ConfigTemplateRevision = revision
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, revision, dep.Spec.Template.Annotations[ConfigTemplateRevisionPodAnnotation])
+	assert.True(t, PodRestartRequested(dep.Spec.Template.Annotations, nil))
+
+	nginx.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, ConfigTemplateRevisionPodAnnotation)
+}
+
+func TestValidateConfigTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template *v1alpha1.NginxConfigTemplate
+		config   *v1alpha1.ConfigRef
+		values   map[string]string
+		want     []string
+	}{
+		{name: "none"},
+		{
+			name:     "configmap",
+			template: &v1alpha1.NginxConfigTemplate{ConfigMap: "templates", Key: "site.conf.tmpl"},
+			config:   &v1alpha1.ConfigRef{Name: "my-nginx-config", Mount: v1alpha1.ConfigMountFile},
+			values:   map[string]string{"upstream": "app"},
+		},
+		{
+			name:   "values-without-template",
+			values: map[string]string{"upstream": "app"},
+			want:   []string{"spec.values requires spec.configTemplate"},
+		},
+		{
+			name:     "empty",
+			template: &v1alpha1.NginxConfigTemplate{},
+			want:     []string{"spec.configTemplate requires one of configMap or inline"},
+		},
+		{
+			name:     "both",
+			template: &v1alpha1.NginxConfigTemplate{ConfigMap: "templates", Inline: "events {}"},
+			want:     []string{"spec.configTemplate configMap and inline are mutually exclusive"},
+		},
+		{
+			name:     "invalid",
+			template: &v1alpha1.NginxConfigTemplate{Inline: "{{ .Name ", Key: "a/b"},
+			config:   &v1alpha1.ConfigRef{Name: "other"},
+			want: []string{
+				"spec.configTemplate.inline is invalid: template: nginx.conf:1: unclosed action",
+				`spec.configTemplate.key "a/b" is invalid: a valid config key must consist of alphanumeric characters, '-', '_' or '.' (e.g. 'key.name',  or 'KEY_NAME',  or 'key-name', regex used for validation is '[-._a-zA-Z0-9]+')`,
+				`spec.configRef must be the generated config map "my-nginx-config" when spec.configTemplate is set`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.ConfigTemplate = tt.template
+			nginx.Spec.Config = tt.config
+			nginx.Spec.Values = tt.values
+			assert.Equal(t, tt.want, validateConfigTemplate(&nginx))
+		})
+	}
+}
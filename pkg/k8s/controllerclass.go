@@ -0,0 +1,35 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// HandledBy returns whether the nginx is handled by the operator started
+// with the given controller class. Operators without a class only handle the
+// nginx objects without one.
+func HandledBy(n *v1alpha1.Nginx, class string) bool {
+	return n.Spec.ControllerClass == class
+}
+
+// ValidateControllerClass returns the errors found in a controller class,
+// which must be a qualified name like team-a or example.com/team-a
+func ValidateControllerClass(class string) []string {
+	if class == "" {
+		return nil
+	}
+	return validation.IsQualifiedName(class)
+}
+
+// validateControllerClass returns the errors found in the controller class
+// of the nginx
+func validateControllerClass(spec *v1alpha1.NginxSpec) []string {
+	if msgs := ValidateControllerClass(spec.ControllerClass); len(msgs) > 0 {
+		return []string{fmt.Sprintf("spec.controllerClass %q is invalid: %s", spec.ControllerClass, strings.Join(msgs, ", "))}
+	}
+	return nil
+}
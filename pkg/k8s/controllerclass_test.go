@@ -0,0 +1,40 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandledBy(t *testing.T) {
+	nginx := baseNginx()
+	assert.True(t, HandledBy(&nginx, ""))
+	assert.False(t, HandledBy(&nginx, "team-a"))
+
+	nginx.Spec.ControllerClass = "team-a"
+	assert.False(t, HandledBy(&nginx, ""))
+	assert.True(t, HandledBy(&nginx, "team-a"))
+	assert.False(t, HandledBy(&nginx, "team-b"))
+}
+
+func TestValidateControllerClass(t *testing.T) {
+	tests := []struct {
+		class string
+		want  []string
+	}{
+		{class: ""},
+		{class: "team-a"},
+		{class: "example.com/team-a"},
+		{
+			class: "team a",
+			want:  []string{`spec.controllerClass "team a" is invalid: name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.class, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.ControllerClass = tt.class
+			assert.Equal(t, tt.want, validateControllerClass(&nginx.Spec))
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewDaemonSet creates a DaemonSet for a given Nginx resource, running one pod
+// on each eligible node. The pod template is the same one generated for the
+// Deployment.
+func NewDaemonSet(n *v1alpha1.Nginx) (*appv1.DaemonSet, error) {
+	deployment, err := NewDeployment(n)
+	if err != nil {
+		return nil, err
+	}
+
+	daemonSet := &appv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            n.Name + "-daemonset",
+			Namespace:       n.Namespace,
+			OwnerReferences: deployment.OwnerReferences,
+			Labels:          deployment.Labels,
+			Annotations:     deployment.Annotations,
+		},
+		Spec: appv1.DaemonSetSpec{
+			Selector:             deployment.Spec.Selector,
+			Template:             deployment.Spec.Template,
+			MinReadySeconds:      deployment.Spec.MinReadySeconds,
+			RevisionHistoryLimit: deployment.Spec.RevisionHistoryLimit,
+		},
+	}
+	if v := n.Spec.MaxUnavailable; v != nil {
+		maxUnavailable := *v
+		daemonSet.Spec.UpdateStrategy = appv1.DaemonSetUpdateStrategy{
+			Type:          appv1.RollingUpdateDaemonSetStrategyType,
+			RollingUpdate: &appv1.RollingUpdateDaemonSet{MaxUnavailable: &maxUnavailable},
+		}
+	}
+	if err := setWorkloadHash(n, daemonSet, &daemonSet.Spec, &daemonSet.Spec.Template); err != nil {
+		return nil, err
+	}
+	return daemonSet, nil
+}
@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewDaemonSet(t *testing.T) {
+	limit := int32(3)
+	nginx := baseNginx()
+	nginx.Spec.WorkloadKind = v1alpha1.WorkloadKindDaemonSet
+	nginx.Spec.MinReadySeconds = 10
+	nginx.Spec.RevisionHistoryLimit = &limit
+	ds, err := NewDaemonSet(&nginx)
+	assert.Nil(t, err)
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, metav1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"}, ds.TypeMeta)
+	assert.Equal(t, "my-nginx-daemonset", ds.Name)
+	assert.Equal(t, dep.OwnerReferences, ds.OwnerReferences)
+	assert.Equal(t, dep.Annotations[TemplateHashAnnotation], ds.Annotations[TemplateHashAnnotation])
+	assert.NotEqual(t, dep.Annotations[SpecHashAnnotation], ds.Annotations[SpecHashAnnotation])
+	assert.Equal(t, dep.Spec.Selector, ds.Spec.Selector)
+	assert.Equal(t, dep.Spec.Template, ds.Spec.Template)
+	assert.Equal(t, int32(10), ds.Spec.MinReadySeconds)
+	assert.Equal(t, &limit, ds.Spec.RevisionHistoryLimit)
+}
+
+func TestHostNetworkAndPorts(t *testing.T) {
+	tests := []struct {
+		name        string
+		hostNetwork bool
+		hostPorts   bool
+		wantPolicy  corev1.DNSPolicy
+		wantPort    int32
+	}{
+		{name: "none"},
+		{name: "host-ports", hostPorts: true, wantPort: 80},
+		{name: "host-network", hostNetwork: true, wantPolicy: corev1.DNSClusterFirstWithHostNet, wantPort: 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.WorkloadKind = v1alpha1.WorkloadKindDaemonSet
+			nginx.Spec.PodTemplate.HostNetwork = tt.hostNetwork
+			nginx.Spec.PodTemplate.HostPorts = tt.hostPorts
+			ds, err := NewDaemonSet(&nginx)
+			assert.Nil(t, err)
+			podSpec := ds.Spec.Template.Spec
+			assert.Equal(t, tt.hostNetwork, podSpec.HostNetwork)
+			assert.Equal(t, tt.wantPolicy, podSpec.DNSPolicy)
+			assert.Equal(t, tt.wantPort, podSpec.Containers[0].Ports[0].HostPort)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DeletePropagationFinalizer is set on nginx objects whose children must not
+// be deleted in the background by the garbage collector, so the operator can
+// apply the configured propagation policy before the nginx goes away.
+const DeletePropagationFinalizer = "nginx.tsuru.io/delete-propagation"
+
+// DeletePropagation returns the propagation policy used when deleting the
+// objects created for the nginx, falling back to the given operator default.
+func DeletePropagation(n *v1alpha1.Nginx, fallback metav1.DeletionPropagation) metav1.DeletionPropagation {
+	if n.Spec.DeletePropagation != nil && *n.Spec.DeletePropagation != "" {
+		return *n.Spec.DeletePropagation
+	}
+	return fallback
+}
+
+// ValidDeletePropagation reports whether p is a propagation policy known by
+// the API server
+func ValidDeletePropagation(p metav1.DeletionPropagation) bool {
+	switch p {
+	case metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+		return true
+	}
+	return false
+}
+
+// HasFinalizer reports whether the finalizer is set on the object
+func HasFinalizer(o metav1.ObjectMeta, finalizer string) bool {
+	for _, f := range o.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFinalizer adds or removes the finalizer from the object, returning
+// whether the object changed
+func SetFinalizer(o *metav1.ObjectMeta, finalizer string, set bool) bool {
+	if !set {
+		return RemoveFinalizer(o, finalizer)
+	}
+	if HasFinalizer(*o, finalizer) {
+		return false
+	}
+	o.Finalizers = append(o.Finalizers, finalizer)
+	return true
+}
+
+// RemoveFinalizer removes the finalizer from the object, returning whether it
+// was set
+func RemoveFinalizer(o *metav1.ObjectMeta, finalizer string) bool {
+	var finalizers []string
+	for _, f := range o.Finalizers {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	removed := len(finalizers) != len(o.Finalizers)
+	o.Finalizers = finalizers
+	return removed
+}
+
+// RemoveOwnerReference removes the references to the owner with the given
+// UID, returning whether any was found
+func RemoveOwnerReference(refs []metav1.OwnerReference, owner types.UID) ([]metav1.OwnerReference, bool) {
+	var result []metav1.OwnerReference
+	for _, r := range refs {
+		if r.UID != owner {
+			result = append(result, r)
+		}
+	}
+	return result, len(result) != len(refs)
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeletePropagation(t *testing.T) {
+	orphan := metav1.DeletePropagationOrphan
+	empty := metav1.DeletionPropagation("")
+	tests := []struct {
+		name   string
+		policy *metav1.DeletionPropagation
+		want   metav1.DeletionPropagation
+	}{
+		{
+			name: "operator-default",
+			want: metav1.DeletePropagationBackground,
+		},
+		{
+			name:   "empty-uses-operator-default",
+			policy: &empty,
+			want:   metav1.DeletePropagationBackground,
+		},
+		{
+			name:   "spec-overrides-default",
+			policy: &orphan,
+			want:   metav1.DeletePropagationOrphan,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.DeletePropagation = tt.policy
+			assert.Equal(t, tt.want, DeletePropagation(&nginx, metav1.DeletePropagationBackground))
+		})
+	}
+}
+
+func TestFinalizers(t *testing.T) {
+	meta := metav1.ObjectMeta{Finalizers: []string{"other", DeletePropagationFinalizer}}
+	assert.True(t, HasFinalizer(meta, DeletePropagationFinalizer))
+	assert.True(t, RemoveFinalizer(&meta, DeletePropagationFinalizer))
+	assert.Equal(t, []string{"other"}, meta.Finalizers)
+	assert.False(t, HasFinalizer(meta, DeletePropagationFinalizer))
+	assert.False(t, RemoveFinalizer(&meta, DeletePropagationFinalizer))
+	assert.True(t, SetFinalizer(&meta, ProtectionFinalizer, true))
+	assert.False(t, SetFinalizer(&meta, ProtectionFinalizer, true))
+	assert.Equal(t, []string{"other", ProtectionFinalizer}, meta.Finalizers)
+	assert.True(t, SetFinalizer(&meta, ProtectionFinalizer, false))
+	assert.Equal(t, []string{"other"}, meta.Finalizers)
+}
+
+func TestRemoveOwnerReference(t *testing.T) {
+	refs := []metav1.OwnerReference{{Name: "a", UID: "1"}, {Name: "b", UID: "2"}}
+	got, removed := RemoveOwnerReference(refs, "1")
+	assert.True(t, removed)
+	assert.Equal(t, []metav1.OwnerReference{{Name: "b", UID: "2"}}, got)
+	_, removed = RemoveOwnerReference(got, "1")
+	assert.False(t, removed)
+}
@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ExternalDNSHostnameAnnotation lists the hostnames external-dns
+	// publishes for a service or ingress
+	ExternalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+
+	// ExternalDNSTTLAnnotation is the TTL, in seconds, of the records
+	// published by external-dns
+	ExternalDNSTTLAnnotation = "external-dns.alpha.kubernetes.io/ttl"
+
+	// externalDNSManagedAnnotation marks the objects whose external-dns
+	// annotations were set from spec.dns, so the ones set by hand on other
+	// objects are left alone
+	externalDNSManagedAnnotation = "nginx.tsuru.io/external-dns"
+)
+
+// externalDNSAnnotations are the annotations managed by the operator on the
+// object spec.dns applies to, removed when no longer requested
+var externalDNSAnnotations = []string{ExternalDNSHostnameAnnotation, ExternalDNSTTLAnnotation, externalDNSManagedAnnotation}
+
+// dnsOnIngress returns whether the hostnames of spec.dns are published for
+// the ingress, whose load balancer is the one receiving the traffic, instead
+// of the service
+func dnsOnIngress(spec *v1alpha1.NginxSpec) bool {
+	return spec.Ingress != nil
+}
+
+// setupDNS adds the external-dns annotations of spec.dns to the object
+func setupDNS(spec *v1alpha1.NginxSpec, obj metav1.Object) {
+	dns := spec.DNS
+	if dns == nil || len(dns.Hostnames) == 0 {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[externalDNSManagedAnnotation] = "true"
+	annotations[ExternalDNSHostnameAnnotation] = strings.Join(dns.Hostnames, ",")
+	if dns.TTL > 0 {
+		annotations[ExternalDNSTTLAnnotation] = fmt.Sprint(dns.TTL)
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// externalDNSManaged returns whether the external-dns annotations of the
+// object are set from spec.dns
+func externalDNSManaged(obj metav1.Object) bool {
+	return obj.GetAnnotations()[externalDNSManagedAnnotation] == "true"
+}
+
+// externalDNSDrift returns whether the external-dns annotations managed by
+// the operator differ between the objects
+func externalDNSDrift(desired, current metav1.Object) bool {
+	if !externalDNSManaged(desired) && !externalDNSManaged(current) {
+		return false
+	}
+	for _, k := range externalDNSAnnotations {
+		if desired.GetAnnotations()[k] != current.GetAnnotations()[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// RestoreExternalDNS sets the external-dns annotations of the current
+// object to the ones of the desired object, removing the ones it lacks when
+// they were set from spec.dns
+func RestoreExternalDNS(current, desired metav1.Object) {
+	if !externalDNSManaged(desired) && !externalDNSManaged(current) {
+		return
+	}
+	annotations := current.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for _, k := range externalDNSAnnotations {
+		if v, ok := desired.GetAnnotations()[k]; ok {
+			annotations[k] = v
+		} else {
+			delete(annotations, k)
+		}
+	}
+	current.SetAnnotations(annotations)
+}
+
+// Addresses returns the addresses of the load balancer, sorted like the API
+// server reports them
+func Addresses(lb corev1.LoadBalancerStatus) []v1alpha1.NginxAddress {
+	var addresses []v1alpha1.NginxAddress
+	for _, i := range lb.Ingress {
+		if i.IP == "" && i.Hostname == "" {
+			continue
+		}
+		addresses = append(addresses, v1alpha1.NginxAddress{IP: i.IP, Hostname: i.Hostname})
+	}
+	return addresses
+}
+
+// validateDNS returns the errors found in the DNS settings of the spec
+func validateDNS(spec *v1alpha1.NginxSpec) []string {
+	dns := spec.DNS
+	if dns == nil {
+		return nil
+	}
+	var errs []string
+	if len(dns.Hostnames) == 0 {
+		errs = append(errs, "spec.dns.hostnames is required")
+	}
+	seen := make(map[string]bool)
+	for i, name := range dns.Hostnames {
+		if msgs := validation.IsDNS1123Subdomain(strings.TrimPrefix(name, "*.")); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("spec.dns.hostnames[%d] %q is invalid: %s", i, name, strings.Join(msgs, ", ")))
+		} else if seen[name] {
+			errs = append(errs, fmt.Sprintf("spec.dns.hostnames[%d] %q is duplicated", i, name))
+		}
+		seen[name] = true
+	}
+	if dns.TTL < 0 {
+		errs = append(errs, "spec.dns.ttl must not be negative")
+	}
+	return errs
+}
@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDNS(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.DNS = &v1alpha1.NginxDNS{Hostnames: []string{"www.example.com", "example.com"}, TTL: 60}
+	svc := NewService(&nginx)
+	assert.Equal(t, map[string]string{
+		"external-dns.alpha.kubernetes.io/hostname": "www.example.com,example.com",
+		"external-dns.alpha.kubernetes.io/ttl":      "60",
+		"nginx.tsuru.io/external-dns":               "true",
+	}, svc.Annotations)
+
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{Headless: true}
+	assert.Empty(t, NewHeadlessService(&nginx).Annotations)
+
+	nginx.Spec.Ingress = &v1alpha1.NginxIngress{Hosts: []string{"www.example.com"}}
+	assert.Empty(t, NewService(&nginx).Annotations)
+	assert.Equal(t, "www.example.com,example.com", NewIngress(&nginx).Annotations[ExternalDNSHostnameAnnotation])
+
+	current := NewIngress(&nginx)
+	nginx.Spec.DNS = nil
+	desired := NewIngress(&nginx)
+	assert.Equal(t, []string{"dns"}, IngressDrift(desired, current))
+	RestoreExternalDNS(current, desired)
+	assert.Empty(t, current.Annotations)
+	assert.Empty(t, IngressDrift(desired, current))
+}
+
+func TestDNSKeepsAnnotationsSetByHand(t *testing.T) {
+	nginx := baseNginx()
+	desired := NewService(&nginx)
+	current := desired.DeepCopy()
+	current.Annotations = map[string]string{ExternalDNSHostnameAnnotation: "manual.example.com"}
+	assert.Empty(t, ServiceDrift(desired, current))
+	RestoreService(current, desired)
+	assert.Equal(t, map[string]string{ExternalDNSHostnameAnnotation: "manual.example.com"}, current.Annotations)
+
+	nginx.Spec.DNS = &v1alpha1.NginxDNS{Hostnames: []string{"www.example.com"}}
+	desired = NewService(&nginx)
+	assert.Equal(t, []string{"dns"}, ServiceDrift(desired, current))
+	RestoreService(current, desired)
+	assert.Equal(t, desired.Annotations, current.Annotations)
+}
+
+func TestAddresses(t *testing.T) {
+	assert.Nil(t, Addresses(corev1.LoadBalancerStatus{}))
+	assert.Equal(t, []v1alpha1.NginxAddress{{IP: "203.0.113.10"}, {Hostname: "lb.elb.amazonaws.com"}}, Addresses(corev1.LoadBalancerStatus{
+		Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}, {}, {Hostname: "lb.elb.amazonaws.com"}},
+	}))
+}
+
+func TestValidateDNS(t *testing.T) {
+	tests := []struct {
+		name string
+		dns  *v1alpha1.NginxDNS
+		want []string
+	}{
+		{name: "unset"},
+		{name: "valid", dns: &v1alpha1.NginxDNS{Hostnames: []string{"example.com", "*.example.com"}, TTL: 300}},
+		{name: "empty", dns: &v1alpha1.NginxDNS{}, want: []string{"spec.dns.hostnames is required"}},
+		{
+			name: "invalid",
+			dns:  &v1alpha1.NginxDNS{Hostnames: []string{"example.com", "Example_com", "example.com"}, TTL: -1},
+			want: []string{
+				`spec.dns.hostnames[1] "Example_com" is invalid: a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+				`spec.dns.hostnames[2] "example.com" is duplicated`,
+				"spec.dns.ttl must not be negative",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateDNS(&v1alpha1.NginxSpec{DNS: tt.dns}))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+// Package k8s builds the Kubernetes objects of an Nginx resource, like its
+// Deployment, Service and Ingress, and implements the checks the operator
+// runs against them. It has no dependency on the operator runtime, so other
+// operators can embed it to manage nginx objects the same way.
+//
+// The exported API follows the semantic versioning of the operator releases:
+// exported identifiers are not removed or changed in incompatible ways within
+// a major version. Builders taking an options struct treat its zero value as
+// the default behavior, so new options can be added without breaking
+// callers. The names and labels of the built objects are part of the API,
+// see the Generated objects section of the README.
+//
+// Builders never modify the Nginx they receive. Default values are applied
+// to a copy of its spec, so the objects built from cached informer objects
+// can be changed freely.
+package k8s
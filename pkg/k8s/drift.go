@@ -0,0 +1,370 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ShouldUpdate reports whether the current object must be updated to match
+// the desired one assembled by the operator. Only the fields managed by the
+// operator are compared, so fields defaulted or allocated by the API server,
+// the status and the annotations set by other controllers never trigger an
+// update. Objects of kinds without a specific comparison are compared by their
+// spec.
+func ShouldUpdate(current, desired runtime.Object) bool {
+	return len(ObjectDrift(desired, current)) > 0
+}
+
+// ObjectDrift returns the fields managed by the operator that differ between
+// the desired and the current object, as compared by ShouldUpdate. Objects
+// of different kinds differ by their kind.
+func ObjectDrift(desired, current runtime.Object) []string {
+	switch d := desired.(type) {
+	case *appv1.Deployment:
+		if c, ok := current.(*appv1.Deployment); ok {
+			return DeploymentDrift(d, c)
+		}
+	case *appv1.StatefulSet:
+		if c, ok := current.(*appv1.StatefulSet); ok {
+			return StatefulSetDrift(d, c)
+		}
+	case *appv1.DaemonSet:
+		if c, ok := current.(*appv1.DaemonSet); ok {
+			return DaemonSetDrift(d, c)
+		}
+	case *corev1.Service:
+		if c, ok := current.(*corev1.Service); ok {
+			return ServiceDrift(d, c)
+		}
+	case *extv1beta1.Ingress:
+		if c, ok := current.(*extv1beta1.Ingress); ok {
+			return IngressDrift(d, c)
+		}
+	case *policyv1beta1.PodDisruptionBudget:
+		if c, ok := current.(*policyv1beta1.PodDisruptionBudget); ok {
+			return PodDisruptionBudgetDrift(d, c)
+		}
+	case *networkingv1.NetworkPolicy:
+		if c, ok := current.(*networkingv1.NetworkPolicy); ok {
+			return NetworkPolicyDrift(d, c)
+		}
+	case *unstructured.Unstructured:
+		if c, ok := current.(*unstructured.Unstructured); ok {
+			if jsonEqual(d.Object["spec"], c.Object["spec"]) {
+				return nil
+			}
+			return []string{"spec"}
+		}
+	default:
+		return []string{"spec"}
+	}
+	return []string{"kind"}
+}
+
+// DeploymentDrift returns the fields managed by the operator that differ
+// between the desired and the current deployment. Fields defaulted by the
+// API server are not taken into account.
+func DeploymentDrift(desired, current *appv1.Deployment) []string {
+	var drift []string
+	if !replicasEqual(desired.Spec.Replicas, current.Spec.Replicas) {
+		drift = append(drift, "replicas")
+	}
+	return append(drift, podTemplateDrift(&desired.Spec.Template, &current.Spec.Template)...)
+}
+
+// StatefulSetDrift returns the fields managed by the operator that differ
+// between the desired and the current statefulset, ignoring the fields
+// defaulted by the API server.
+func StatefulSetDrift(desired, current *appv1.StatefulSet) []string {
+	var drift []string
+	if !replicasEqual(desired.Spec.Replicas, current.Spec.Replicas) {
+		drift = append(drift, "replicas")
+	}
+	return append(drift, podTemplateDrift(&desired.Spec.Template, &current.Spec.Template)...)
+}
+
+// DaemonSetDrift returns the fields managed by the operator that differ
+// between the desired and the current daemonset, ignoring the fields
+// defaulted by the API server.
+func DaemonSetDrift(desired, current *appv1.DaemonSet) []string {
+	return podTemplateDrift(&desired.Spec.Template, &current.Spec.Template)
+}
+
+// IngressDrift returns the fields managed by the operator that differ between
+// the desired and the current ingress. Annotations other than the ingress
+// class and the external-dns ones, usually set by the ingress controllers,
+// are not taken into account.
+func IngressDrift(desired, current *extv1beta1.Ingress) []string {
+	var drift []string
+	if desired.Annotations[IngressClassAnnotation] != current.Annotations[IngressClassAnnotation] {
+		drift = append(drift, "class")
+	}
+	if !ingressRulesEqual(desired.Spec.Rules, current.Spec.Rules) {
+		drift = append(drift, "rules")
+	}
+	if !ingressTLSEqual(desired.Spec.TLS, current.Spec.TLS) {
+		drift = append(drift, "tls")
+	}
+	if externalDNSDrift(desired, current) {
+		drift = append(drift, "dns")
+	}
+	return drift
+}
+
+// PodDisruptionBudgetDrift returns the fields managed by the operator that
+// differ between the desired and the current pod disruption budget.
+func PodDisruptionBudgetDrift(desired, current *policyv1beta1.PodDisruptionBudget) []string {
+	var drift []string
+	if !intOrStringEqual(desired.Spec.MinAvailable, current.Spec.MinAvailable) {
+		drift = append(drift, "minAvailable")
+	}
+	if !intOrStringEqual(desired.Spec.MaxUnavailable, current.Spec.MaxUnavailable) {
+		drift = append(drift, "maxUnavailable")
+	}
+	if !labelSelectorEqual(desired.Spec.Selector, current.Spec.Selector) {
+		drift = append(drift, "selector")
+	}
+	return drift
+}
+
+// NetworkPolicyDrift returns the fields managed by the operator that differ
+// between the desired and the current network policy.
+func NetworkPolicyDrift(desired, current *networkingv1.NetworkPolicy) []string {
+	var drift []string
+	if !labelSelectorEqual(&desired.Spec.PodSelector, &current.Spec.PodSelector) {
+		drift = append(drift, "podSelector")
+	}
+	if !jsonEqual(desired.Spec.Ingress, current.Spec.Ingress) {
+		drift = append(drift, "ingress")
+	}
+	if !jsonEqual(desired.Spec.Egress, current.Spec.Egress) {
+		drift = append(drift, "egress")
+	}
+	if !jsonEqual(desired.Spec.PolicyTypes, current.Spec.PolicyTypes) {
+		drift = append(drift, "policyTypes")
+	}
+	return drift
+}
+
+// ServiceDrift returns the fields managed by the operator that differ between
+// the desired and the current service. Fields allocated by the API server, like
+// the cluster IP and node ports, are not taken into account.
+func ServiceDrift(desired, current *corev1.Service) []string {
+	var drift []string
+	if desired.Spec.Type != current.Spec.Type {
+		drift = append(drift, "type")
+	}
+	if !reflect.DeepEqual(desired.Spec.Selector, current.Spec.Selector) {
+		drift = append(drift, "selector")
+	}
+	if !servicePortsEqual(desired.Spec.Ports, current.Spec.Ports) {
+		drift = append(drift, "ports")
+	}
+	if sessionAffinity(desired) != sessionAffinity(current) ||
+		!reflect.DeepEqual(desired.Spec.SessionAffinityConfig, current.Spec.SessionAffinityConfig) {
+		drift = append(drift, "sessionAffinity")
+	}
+	for k := range proxyProtocolAnnotations {
+		if desired.Annotations[k] != current.Annotations[k] {
+			drift = append(drift, "annotations")
+			break
+		}
+	}
+	if externalDNSDrift(desired, current) {
+		drift = append(drift, "dns")
+	}
+	return drift
+}
+
+// sessionAffinity returns the session affinity of the service, None when
+// left for the API server to default
+func sessionAffinity(s *corev1.Service) corev1.ServiceAffinity {
+	if s.Spec.SessionAffinity == "" {
+		return corev1.ServiceAffinityNone
+	}
+	return s.Spec.SessionAffinity
+}
+
+// podTemplateDrift compares the containers of the pod templates, stopping at
+// the first container whose name differs
+func podTemplateDrift(desired, current *corev1.PodTemplateSpec) []string {
+	var drift []string
+	desiredContainers := desired.Spec.Containers
+	currentContainers := current.Spec.Containers
+	if len(desiredContainers) != len(currentContainers) {
+		return append(drift, "containers")
+	}
+	for i := range desiredContainers {
+		d, c := desiredContainers[i], currentContainers[i]
+		if d.Name != c.Name {
+			return append(drift, "containers")
+		}
+		if d.Image != c.Image {
+			drift = append(drift, "image")
+		}
+		if !containerPortsEqual(d.Ports, c.Ports) {
+			drift = append(drift, "ports")
+		}
+		if !resourcesEqual(d.Resources, c.Resources) {
+			drift = append(drift, "resources")
+		}
+	}
+	return drift
+}
+
+// replicasEqual compares the replicas, which are defaulted by the API server
+// when not desired
+func replicasEqual(desired, current *int32) bool {
+	return desired == nil || (current != nil && *desired == *current)
+}
+
+func containerPortsEqual(desired, current []corev1.ContainerPort) bool {
+	if len(desired) != len(current) {
+		return false
+	}
+	for i := range desired {
+		if desired[i].Name != current[i].Name ||
+			desired[i].ContainerPort != current[i].ContainerPort ||
+			desired[i].Protocol != current[i].Protocol {
+			return false
+		}
+	}
+	return true
+}
+
+func servicePortsEqual(desired, current []corev1.ServicePort) bool {
+	if len(desired) != len(current) {
+		return false
+	}
+	for i := range desired {
+		if desired[i].Name != current[i].Name ||
+			desired[i].Port != current[i].Port ||
+			desired[i].TargetPort != current[i].TargetPort ||
+			desired[i].Protocol != current[i].Protocol {
+			return false
+		}
+	}
+	return true
+}
+
+func resourcesEqual(desired, current corev1.ResourceRequirements) bool {
+	return resourceListEqual(desired.Limits, current.Limits) && resourceListEqual(desired.Requests, current.Requests)
+}
+
+func resourceListEqual(desired, current corev1.ResourceList) bool {
+	if len(desired) != len(current) {
+		return false
+	}
+	for name, quantity := range desired {
+		q, ok := current[name]
+		if !ok || quantity.Cmp(q) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func ingressRulesEqual(desired, current []extv1beta1.IngressRule) bool {
+	if len(desired) != len(current) {
+		return false
+	}
+	for i := range desired {
+		d, c := desired[i], current[i]
+		if d.Host != c.Host || (d.HTTP == nil) != (c.HTTP == nil) {
+			return false
+		}
+		if d.HTTP == nil {
+			continue
+		}
+		if len(d.HTTP.Paths) != len(c.HTTP.Paths) {
+			return false
+		}
+		for j := range d.HTTP.Paths {
+			dp, cp := d.HTTP.Paths[j], c.HTTP.Paths[j]
+			if dp.Path != cp.Path ||
+				dp.Backend.ServiceName != cp.Backend.ServiceName ||
+				dp.Backend.ServicePort != cp.Backend.ServicePort {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func ingressTLSEqual(desired, current []extv1beta1.IngressTLS) bool {
+	if len(desired) != len(current) {
+		return false
+	}
+	for i := range desired {
+		if desired[i].SecretName != current[i].SecretName || !stringsEqual(desired[i].Hosts, current[i].Hosts) {
+			return false
+		}
+	}
+	return true
+}
+
+func intOrStringEqual(desired, current *intstr.IntOrString) bool {
+	if desired == nil || current == nil {
+		return desired == current
+	}
+	return *desired == *current
+}
+
+func labelSelectorEqual(desired, current *metav1.LabelSelector) bool {
+	if desired == nil || current == nil {
+		return desired == current
+	}
+	if len(desired.MatchLabels) != len(current.MatchLabels) || len(desired.MatchExpressions) != len(current.MatchExpressions) {
+		return false
+	}
+	for k, v := range desired.MatchLabels {
+		if cv, ok := current.MatchLabels[k]; !ok || cv != v {
+			return false
+		}
+	}
+	for i := range desired.MatchExpressions {
+		d, c := desired.MatchExpressions[i], current.MatchExpressions[i]
+		if d.Key != c.Key || d.Operator != c.Operator || !stringsEqual(d.Values, c.Values) {
+			return false
+		}
+	}
+	return true
+}
+
+func stringsEqual(desired, current []string) bool {
+	if len(desired) != len(current) {
+		return false
+	}
+	for i := range desired {
+		if desired[i] != current[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonEqual compares the JSON representation of both values, which avoids
+// false positives caused by different numeric types after decoding. Values
+// that cannot be encoded are never equal.
+func jsonEqual(a, b interface{}) bool {
+	aData, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bData, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aData, bData)
+}
@@ -0,0 +1,241 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestDeploymentDrift(t *testing.T) {
+	tests := []struct {
+		name      string
+		currentFn func(d appv1.Deployment) appv1.Deployment
+		want      []string
+	}{
+		{
+			name: "no-drift",
+			currentFn: func(d appv1.Deployment) appv1.Deployment {
+				return d
+			},
+		},
+		{
+			name: "server-defaulted-fields-are-ignored",
+			currentFn: func(d appv1.Deployment) appv1.Deployment {
+				v := int32(1)
+				d.Spec.Replicas = &v
+				d.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
+				d.Spec.Template.Spec.Containers[0].ReadinessProbe.PeriodSeconds = 10
+				d.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirst
+				return d
+			},
+		},
+		{
+			name: "image-and-ports-changed",
+			currentFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].Image = "nginx:1.13"
+				d.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort = 8080
+				return d
+			},
+			want: []string{"image", "ports"},
+		},
+		{
+			name: "resources-changed",
+			currentFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].Resources.Limits = corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("1"),
+				}
+				return d
+			},
+			want: []string{"resources"},
+		},
+		{
+			name: "container-removed",
+			currentFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers = nil
+				return d
+			},
+			want: []string{"containers"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := baseDeployment()
+			current := baseDeployment()
+			current.Spec.Template.Spec.Containers[0].ReadinessProbe = desired.Spec.Template.Spec.Containers[0].ReadinessProbe.DeepCopy()
+			current = tt.currentFn(current)
+			assert.Equal(t, tt.want, DeploymentDrift(&desired, &current))
+		})
+	}
+}
+
+func TestDeploymentDriftReplicas(t *testing.T) {
+	desired := baseDeployment()
+	current := baseDeployment()
+	three, one := int32(3), int32(1)
+	desired.Spec.Replicas = &three
+	current.Spec.Replicas = &one
+	assert.Equal(t, []string{"replicas"}, DeploymentDrift(&desired, &current))
+}
+
+func TestServiceDrift(t *testing.T) {
+	tests := []struct {
+		name      string
+		currentFn func(s *corev1.Service)
+		want      []string
+	}{
+		{
+			name:      "no-drift",
+			currentFn: func(s *corev1.Service) {},
+		},
+		{
+			name: "server-allocated-fields-are-ignored",
+			currentFn: func(s *corev1.Service) {
+				s.Spec.ClusterIP = "10.0.0.1"
+				s.Spec.SessionAffinity = corev1.ServiceAffinityNone
+			},
+		},
+		{
+			name: "ports-and-type-changed",
+			currentFn: func(s *corev1.Service) {
+				s.Spec.Type = corev1.ServiceTypeNodePort
+				s.Spec.Ports[0].TargetPort = intstr.FromInt(8080)
+			},
+			want: []string{"type", "ports"},
+		},
+		{
+			name: "selector-changed",
+			currentFn: func(s *corev1.Service) {
+				s.Spec.Selector = map[string]string{"app": "other"}
+			},
+			want: []string{"selector"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			desired := NewService(&nginx)
+			current := NewService(&nginx)
+			tt.currentFn(current)
+			assert.Equal(t, tt.want, ServiceDrift(desired, current))
+		})
+	}
+}
+
+func TestIngressDrift(t *testing.T) {
+	tests := []struct {
+		name      string
+		currentFn func(i *extv1beta1.Ingress)
+		want      []string
+	}{
+		{
+			name:      "no-drift",
+			currentFn: func(i *extv1beta1.Ingress) {},
+		},
+		{
+			name: "controller-annotations-and-status-are-ignored",
+			currentFn: func(i *extv1beta1.Ingress) {
+				i.Annotations = map[string]string{
+					IngressClassAnnotation:                             "nginx",
+					"ingress.kubernetes.io/backends":                   `{"k8s-be-30000":"HEALTHY"}`,
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				}
+				i.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+			},
+		},
+		{
+			name: "class-and-rules-changed",
+			currentFn: func(i *extv1beta1.Ingress) {
+				i.Annotations = map[string]string{IngressClassAnnotation: "other"}
+				i.Spec.Rules[0].HTTP.Paths[0].Path = "/other"
+			},
+			want: []string{"class", "rules"},
+		},
+		{
+			name: "tls-removed",
+			currentFn: func(i *extv1beta1.Ingress) {
+				i.Spec.TLS = nil
+			},
+			want: []string{"tls"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.Ingress = &v1alpha1.NginxIngress{
+				Hosts:            []string{"example.com"},
+				IngressClassName: "nginx",
+				TLS:              &v1alpha1.NginxIngressTLS{SecretName: "example-tls"},
+			}
+			desired := NewIngress(&nginx)
+			current := NewIngress(&nginx)
+			tt.currentFn(current)
+			assert.Equal(t, tt.want, IngressDrift(desired, current))
+		})
+	}
+}
+
+func TestPodDisruptionBudgetDrift(t *testing.T) {
+	nginx := baseNginx()
+	one := intstr.FromInt(1)
+	nginx.Spec.PodDisruptionBudget = &v1alpha1.NginxPodDisruptionBudget{MinAvailable: &one}
+	desired := NewPodDisruptionBudget(&nginx)
+
+	current := NewPodDisruptionBudget(&nginx)
+	current.Status.CurrentHealthy = 2
+	current.Spec.Selector.MatchExpressions = []metav1.LabelSelectorRequirement{}
+	assert.Nil(t, PodDisruptionBudgetDrift(desired, current))
+
+	half := intstr.FromString("50%")
+	current.Spec.MinAvailable = nil
+	current.Spec.MaxUnavailable = &half
+	current.Spec.Selector.MatchLabels = map[string]string{"app": "other"}
+	assert.Equal(t, []string{"minAvailable", "maxUnavailable", "selector"}, PodDisruptionBudgetDrift(desired, current))
+}
+
+func TestStatefulSetDrift(t *testing.T) {
+	nginx := baseNginx()
+	desired, err := NewStatefulSet(&nginx)
+	assert.Nil(t, err)
+	current, err := NewStatefulSet(&nginx)
+	assert.Nil(t, err)
+	current.Spec.PodManagementPolicy = appv1.OrderedReadyPodManagement
+	current.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	assert.Nil(t, StatefulSetDrift(desired, current))
+
+	current.Spec.Template.Spec.Containers[0].Image = "nginx:1.13"
+	assert.Equal(t, []string{"image"}, StatefulSetDrift(desired, current))
+}
+
+func TestShouldUpdate(t *testing.T) {
+	nginx := baseNginx()
+	service := NewService(&nginx)
+	current := NewService(&nginx)
+	current.Spec.ClusterIP = "10.0.0.1"
+	current.Spec.Ports[0].NodePort = 30000
+	assert.False(t, ShouldUpdate(current, service))
+	current.Spec.Type = corev1.ServiceTypeNodePort
+	assert.True(t, ShouldUpdate(current, service))
+
+	deployment, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.True(t, ShouldUpdate(service, deployment), "objects of different kinds")
+
+	monitor := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"interval": "30s", "port": int64(9113)},
+	}}
+	currentMonitor := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": "42"},
+		"spec":     map[string]interface{}{"interval": "30s", "port": float64(9113)},
+	}}
+	assert.False(t, ShouldUpdate(currentMonitor, monitor))
+	currentMonitor.Object["spec"] = map[string]interface{}{"interval": "10s", "port": float64(9113)}
+	assert.True(t, ShouldUpdate(currentMonitor, monitor))
+}
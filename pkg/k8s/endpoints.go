@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// EndpointsConfigMapKey is the key of the endpoints ConfigMap holding the
+// addresses of the ready pods
+const EndpointsConfigMapKey = "endpoints.json"
+
+// EndpointsConfigMapName returns the name of the ConfigMap the addresses of
+// the ready pods of the nginx are written to
+func EndpointsConfigMapName(n *v1alpha1.Nginx) string {
+	return n.Name + "-endpoints"
+}
+
+// PodEndpoints returns the addresses of the pods ready to receive traffic,
+// like the ones of the service endpoints, sorted by IP so the published
+// list only changes along with the pods. Terminating pods are left out.
+func PodEndpoints(pods []corev1.Pod) []v1alpha1.NginxEndpoint {
+	var endpoints []v1alpha1.NginxEndpoint
+	for _, p := range pods {
+		if p.DeletionTimestamp != nil || p.Status.PodIP == "" || !CanaryPodReady(&p) {
+			continue
+		}
+		e := v1alpha1.NginxEndpoint{
+			Pod:      p.Name,
+			IP:       p.Status.PodIP,
+			NodeName: p.Spec.NodeName,
+			Ports:    []v1alpha1.NginxEndpointPort{},
+		}
+		for _, c := range p.Spec.Containers {
+			if c.Name != "nginx" {
+				continue
+			}
+			for _, port := range c.Ports {
+				e.Ports = append(e.Ports, v1alpha1.NginxEndpointPort{
+					Name:     port.Name,
+					Port:     port.ContainerPort,
+					Protocol: port.Protocol,
+				})
+			}
+		}
+		endpoints = append(endpoints, e)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].IP != endpoints[j].IP {
+			return endpoints[i].IP < endpoints[j].IP
+		}
+		return endpoints[i].Pod < endpoints[j].Pod
+	})
+	return endpoints
+}
+
+// NewEndpointsConfigMap assembles the ConfigMap holding the addresses of the
+// ready pods of the Nginx, as a JSON list in the endpoints.json key. It
+// returns nil if the addresses are not published in a ConfigMap.
+func NewEndpointsConfigMap(n *v1alpha1.Nginx, endpoints []v1alpha1.NginxEndpoint) (*corev1.ConfigMap, error) {
+	if n.Spec.Endpoints == nil || !n.Spec.Endpoints.ConfigMap {
+		return nil, nil
+	}
+	if endpoints == nil {
+		endpoints = []v1alpha1.NginxEndpoint{}
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(endpoints); err != nil {
+		return nil, err
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      EndpointsConfigMapName(n),
+			Namespace: n.Namespace,
+			Labels:    LabelsForNginx(n.Name),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+		},
+		Data: map[string]string{
+			EndpointsConfigMapKey: buf.String(),
+		},
+	}
+	setCustomMetadata(&n.Spec, cm)
+	return cm, nil
+}
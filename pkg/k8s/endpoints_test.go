@@ -0,0 +1,95 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodEndpoints(t *testing.T) {
+	pod := func(name, ip string, ready bool) corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PodSpec{
+				NodeName: "node-1",
+				Containers: []corev1.Container{
+					{Name: "nginx", Ports: []corev1.ContainerPort{
+						{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+						{Name: "https", ContainerPort: 8443, Protocol: corev1.ProtocolTCP},
+					}},
+					{Name: "exporter", Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9113}}},
+				},
+			},
+			Status: corev1.PodStatus{
+				PodIP:      ip,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		}
+	}
+	terminating := pod("nginx-d", "10.0.0.4", true)
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	ports := []v1alpha1.NginxEndpointPort{
+		{Name: "http", Port: 8080, Protocol: corev1.ProtocolTCP},
+		{Name: "https", Port: 8443, Protocol: corev1.ProtocolTCP},
+	}
+	assert.Nil(t, PodEndpoints(nil))
+	assert.Equal(t, []v1alpha1.NginxEndpoint{
+		{Pod: "nginx-c", IP: "10.0.0.1", NodeName: "node-1", Ports: ports},
+		{Pod: "nginx-a", IP: "10.0.0.2", NodeName: "node-1", Ports: ports},
+	}, PodEndpoints([]corev1.Pod{
+		pod("nginx-a", "10.0.0.2", true),
+		pod("nginx-b", "10.0.0.3", false),
+		pod("nginx-c", "10.0.0.1", true),
+		pod("nginx-e", "", true),
+		terminating,
+	}))
+}
+
+func TestNewEndpointsConfigMap(t *testing.T) {
+	nginx := baseNginx()
+	cm, err := NewEndpointsConfigMap(&nginx, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, cm)
+
+	nginx.Spec.Endpoints = &v1alpha1.NginxEndpoints{}
+	cm, err = NewEndpointsConfigMap(&nginx, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, cm)
+
+	nginx.Spec.Endpoints.ConfigMap = true
+	cm, err = NewEndpointsConfigMap(&nginx, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-nginx-endpoints", cm.Name)
+	assert.Equal(t, "default", cm.Namespace)
+	assert.Equal(t, LabelsForNginx("my-nginx"), cm.Labels)
+	assert.Len(t, cm.OwnerReferences, 1)
+	assert.Equal(t, map[string]string{"endpoints.json": "[]\n"}, cm.Data)
+
+	cm, err = NewEndpointsConfigMap(&nginx, []v1alpha1.NginxEndpoint{
+		{Pod: "nginx-a", IP: "10.0.0.2", Ports: []v1alpha1.NginxEndpointPort{{Name: "http", Port: 8080, Protocol: corev1.ProtocolTCP}}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `[
+  {
+    "pod": "nginx-a",
+    "ip": "10.0.0.2",
+    "ports": [
+      {
+        "name": "http",
+        "port": 8080,
+        "protocol": "TCP"
+      }
+    ]
+  }
+]
+`, cm.Data["endpoints.json"])
+}
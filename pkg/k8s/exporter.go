@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ServiceMonitorAPIVersion is the api version of the Prometheus Operator ServiceMonitor resource
+	ServiceMonitorAPIVersion = "monitoring.coreos.com/v1"
+
+	// ServiceMonitorKind is the kind of the Prometheus Operator ServiceMonitor resource
+	ServiceMonitorKind = "ServiceMonitor"
+
+	// StubStatusPort is the port, bound to localhost, where nginx serves the
+	// stub_status page read by the metrics exporter
+	StubStatusPort = 8091
+
+	// Port name and number of the metrics exporter
+	metricsPortName = "metrics"
+	metricsPort     = 9113
+
+	// Pod annotation holding the server block serving stub_status, it is
+	// mounted in the nginx container using the Downward API
+	stubStatusAnnotation = "nginx.tsuru.io/stub-status-conf"
+)
+
+var stubStatusConfig = fmt.Sprintf(`server {
+    listen 127.0.0.1:%d;
+    location /stub_status {
+        stub_status;
+    }
+}
+`, StubStatusPort)
+
+// setupMetrics adds the metrics exporter sidecar and mounts the stub_status
+// server block in the nginx container. Custom configs must include
+// /etc/nginx-operator/*.conf in their http block, the default config of the
+// nginx image picks it up from conf.d. The metrics spec must have its default
+// values already set.
+func setupMetrics(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if spec.Metrics == nil {
+		return
+	}
+	addOperatorConfig(dep, stubStatusAnnotation, "stub_status.conf", stubStatusConfig)
+	if spec.Config == nil {
+		nginx := &dep.Spec.Template.Spec.Containers[0]
+		nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+			Name:      operatorConfigVolume,
+			MountPath: defaultConfigIncludePath + "/stub_status.conf",
+			SubPath:   "stub_status.conf",
+		})
+	}
+
+	dep.Spec.Template.Spec.Containers = append(dep.Spec.Template.Spec.Containers, corev1.Container{
+		Name:  "exporter",
+		Image: spec.Metrics.Image,
+		Args:  []string{fmt.Sprintf("-nginx.scrape-uri=http://127.0.0.1:%d/stub_status", StubStatusPort)},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          metricsPortName,
+				ContainerPort: int32(metricsPort),
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+	})
+}
+
+// NewServiceMonitor assembles the Prometheus Operator ServiceMonitor for the
+// Nginx. It returns nil if no ServiceMonitor was requested.
+func NewServiceMonitor(n *v1alpha1.Nginx) *unstructured.Unstructured {
+	if n.Spec.Metrics == nil || n.Spec.Metrics.ServiceMonitor == nil {
+		return nil
+	}
+	var endpoints []interface{}
+	ports := []string{metricsPortName}
+	if n.Spec.Metrics.Upstreams != nil {
+		ports = append(ports, upstreamMetricsPortName)
+	}
+	for _, port := range ports {
+		endpoint := map[string]interface{}{
+			"port": port,
+		}
+		if interval := n.Spec.Metrics.ServiceMonitor.Interval; interval != "" {
+			endpoint["interval"] = interval
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	selector := make(map[string]interface{})
+	for k, v := range LabelsForNginx(n.Name) {
+		selector[k] = v
+	}
+	o := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": selector,
+			},
+			"namespaceSelector": map[string]interface{}{
+				"matchNames": []interface{}{n.Namespace},
+			},
+			"endpoints": endpoints,
+		},
+	}}
+	labels := LabelsForNginx(n.Name)
+	for k, v := range n.Spec.Metrics.ServiceMonitor.Labels {
+		labels[k] = v
+	}
+	o.SetAPIVersion(ServiceMonitorAPIVersion)
+	o.SetKind(ServiceMonitorKind)
+	o.SetName(n.Name)
+	o.SetNamespace(n.Namespace)
+	o.SetLabels(labels)
+	o.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(n, schema.GroupVersionKind{
+			Group:   v1alpha1.SchemeGroupVersion.Group,
+			Version: v1alpha1.SchemeGroupVersion.Version,
+			Kind:    "Nginx",
+		}),
+	})
+	setCustomMetadata(&n.Spec, o)
+	return o
+}
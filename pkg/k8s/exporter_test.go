@@ -0,0 +1,50 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNewServiceMonitor(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewServiceMonitor(&nginx))
+
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{}
+	assert.Nil(t, NewServiceMonitor(&nginx))
+
+	nginx.Spec.Metrics.ServiceMonitor = &v1alpha1.NginxServiceMonitor{
+		Interval: "30s",
+		Labels:   map[string]string{"prometheus": "main"},
+	}
+	sm := NewServiceMonitor(&nginx)
+	assert.Equal(t, "monitoring.coreos.com/v1", sm.GetAPIVersion())
+	assert.Equal(t, "ServiceMonitor", sm.GetKind())
+	assert.Equal(t, "my-nginx", sm.GetName())
+	assert.Equal(t, "default", sm.GetNamespace())
+	assert.Len(t, sm.GetOwnerReferences(), 1)
+	assert.Equal(t, map[string]string{"nginx_cr": "my-nginx", "app": "nginx", "prometheus": "main"}, sm.GetLabels())
+	selector, _ := unstructured.NestedStringMap(sm.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, LabelsForNginx("my-nginx"), selector)
+	endpoints, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	assert.Equal(t, []interface{}{map[string]interface{}{"port": "metrics", "interval": "30s"}}, endpoints)
+}
+
+func TestMetricsPorts(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{}
+	svc := NewService(&nginx)
+	assert.Equal(t, corev1.ServicePort{
+		Name:       "metrics",
+		Protocol:   corev1.ProtocolTCP,
+		TargetPort: intstr.FromString("metrics"),
+		Port:       9113,
+	}, svc.Spec.Ports[1])
+
+	nginx.Spec.PodTemplate.Ports = []v1alpha1.NginxPort{{Name: "status", ContainerPort: StubStatusPort}}
+	assert.Equal(t, []string{`spec.podTemplate.ports[0] ("status") uses port 8091/TCP, already used by the stub_status page read by the metrics exporter`}, Validate(&nginx))
+}
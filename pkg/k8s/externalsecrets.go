@@ -0,0 +1,191 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ExternalSecretAPIVersion is the api version of the External Secrets
+	// ExternalSecret resource
+	ExternalSecretAPIVersion = "external-secrets.io/v1beta1"
+
+	// ExternalSecretKind is the kind of the External Secrets ExternalSecret
+	// resource
+	ExternalSecretKind = "ExternalSecret"
+
+	// ExternalSecretsRevisionPodAnnotation is the pod template annotation
+	// holding the revision of the materialized external secrets. Changing it
+	// replaces the pods, so nginx loads the rotated secrets.
+	ExternalSecretsRevisionPodAnnotation = "nginx.tsuru.io/external-secrets-revision"
+)
+
+// NewExternalSecrets assembles the External Secrets ExternalSecrets of the
+// Nginx, each one materializing the Secret with its name
+func NewExternalSecrets(n *v1alpha1.Nginx) []*unstructured.Unstructured {
+	var objects []*unstructured.Unstructured
+	for _, e := range n.Spec.WithDefaults().ExternalSecrets {
+		var data []interface{}
+		for _, d := range e.Data {
+			remoteRef := map[string]interface{}{"key": d.RemoteRef.Key}
+			if d.RemoteRef.Property != "" {
+				remoteRef["property"] = d.RemoteRef.Property
+			}
+			data = append(data, map[string]interface{}{
+				"secretKey": d.SecretKey,
+				"remoteRef": remoteRef,
+			})
+		}
+		o := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"refreshInterval": e.RefreshInterval,
+				"secretStoreRef": map[string]interface{}{
+					"name": e.SecretStoreRef.Name,
+					"kind": e.SecretStoreRef.Kind,
+				},
+				"target": map[string]interface{}{
+					"name":           e.Name,
+					"creationPolicy": "Owner",
+				},
+				"data": data,
+			},
+		}}
+		o.SetAPIVersion(ExternalSecretAPIVersion)
+		o.SetKind(ExternalSecretKind)
+		o.SetName(e.Name)
+		o.SetNamespace(n.Namespace)
+		o.SetLabels(LabelsForNginx(n.Name))
+		o.SetOwnerReferences([]metav1.OwnerReference{
+			*metav1.NewControllerRef(n, schema.GroupVersionKind{
+				Group:   v1alpha1.SchemeGroupVersion.Group,
+				Version: v1alpha1.SchemeGroupVersion.Version,
+				Kind:    "Nginx",
+			}),
+		})
+		setCustomMetadata(&n.Spec, o)
+		objects = append(objects, o)
+	}
+	return objects
+}
+
+// ExternalSecretMaterialized returns whether the secret holds every key of
+// the external secret
+func ExternalSecretMaterialized(e v1alpha1.NginxExternalSecret, secret *corev1.Secret) bool {
+	for _, d := range e.Data {
+		if _, ok := secret.Data[d.SecretKey]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ExternalSecretsRevision returns the revision identifying the content of
+// the materialized secrets
+func ExternalSecretsRevision(secrets []corev1.Secret) string {
+	h := sha256.New()
+	for _, s := range secrets {
+		keys := make([]string, 0, len(s.Data))
+		for k := range s.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(h, "%s\x00", s.Name)
+		for _, k := range keys {
+			fmt.Fprintf(h, "%s\x00%d\x00", k, len(s.Data[k]))
+			h.Write(s.Data[k])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// setupExternalSecretsRevision sets the revision of the materialized
+// external secrets in the pod template, so pods are only replaced when they
+// are rotated
+func setupExternalSecretsRevision(n *v1alpha1.Nginx, dep *appv1.Deployment) {
+	if len(n.Spec.ExternalSecrets) == 0 || n.Status.ExternalSecretsRevision == "" {
+		return
+	}
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = make(map[string]string)
+	}
+	dep.Spec.Template.Annotations[ExternalSecretsRevisionPodAnnotation] = n.Status.ExternalSecretsRevision
+}
+
+// validateExternalSecrets returns the errors found in the external secrets.
+// Each one must be used by the TLS secret or the extra files, and hold the
+// keys they read.
+func validateExternalSecrets(n *v1alpha1.Nginx) []string {
+	spec := n.Spec.WithDefaults()
+	var errs []string
+	names := make(map[string]bool)
+	for i, e := range spec.ExternalSecrets {
+		field := fmt.Sprintf("spec.externalSecrets[%d]", i)
+		if msgs := validation.IsDNS1123Subdomain(e.Name); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s.name %q is invalid: %s", field, e.Name, strings.Join(msgs, ", ")))
+		}
+		if names[e.Name] {
+			errs = append(errs, fmt.Sprintf("%s.name %q is duplicated", field, e.Name))
+		}
+		names[e.Name] = true
+		if spec.Certificates != nil && e.Name == CertificateSecretName(n) {
+			errs = append(errs, fmt.Sprintf("%s.name %q is the secret of spec.certificates", field, e.Name))
+		}
+		if e.SecretStoreRef.Name == "" {
+			errs = append(errs, fmt.Sprintf("%s.secretStoreRef.name is required", field))
+		}
+		switch e.SecretStoreRef.Kind {
+		case "SecretStore", "ClusterSecretStore":
+		default:
+			errs = append(errs, fmt.Sprintf("%s.secretStoreRef.kind %q is not supported", field, e.SecretStoreRef.Kind))
+		}
+		if d, err := time.ParseDuration(e.RefreshInterval); err != nil || d < 0 {
+			errs = append(errs, fmt.Sprintf("%s.refreshInterval %q is not a valid duration", field, e.RefreshInterval))
+		}
+		if len(e.Data) == 0 {
+			errs = append(errs, fmt.Sprintf("%s.data must not be empty", field))
+		}
+		keys := make(map[string]bool)
+		for j, d := range e.Data {
+			if d.SecretKey == "" {
+				errs = append(errs, fmt.Sprintf("%s.data[%d].secretKey is required", field, j))
+			}
+			if d.RemoteRef.Key == "" {
+				errs = append(errs, fmt.Sprintf("%s.data[%d].remoteRef.key is required", field, j))
+			}
+			keys[d.SecretKey] = true
+		}
+
+		var used []string
+		if tls := spec.TLSSecret; tls != nil && tls.SecretName == e.Name {
+			used = append(used, tls.KeyField, tls.CertificateField)
+		}
+		for _, f := range spec.ExtraFiles {
+			if f.Secret == e.Name {
+				used = append(used, f.Key)
+			}
+		}
+		if used == nil {
+			errs = append(errs, fmt.Sprintf("%s %q is not used by spec.tlsSecret or spec.extraFiles", field, e.Name))
+		}
+		for _, k := range used {
+			if !keys[k] {
+				errs = append(errs, fmt.Sprintf("%s.data has no secretKey %q", field, k))
+				keys[k] = true
+			}
+		}
+	}
+	return errs
+}
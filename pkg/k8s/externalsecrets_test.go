@@ -0,0 +1,185 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func tlsExternalSecret() v1alpha1.NginxExternalSecret {
+	return v1alpha1.NginxExternalSecret{
+		Name:           "my-tls",
+		SecretStoreRef: v1alpha1.ExternalSecretStoreRef{Name: "vault"},
+		Data: []v1alpha1.ExternalSecretData{
+			{SecretKey: "tls.crt", RemoteRef: v1alpha1.ExternalSecretRemoteRef{Key: "secret/nginx", Property: "crt"}},
+			{SecretKey: "tls.key", RemoteRef: v1alpha1.ExternalSecretRemoteRef{Key: "secret/nginx", Property: "key"}},
+		},
+	}
+}
+
+func TestNewExternalSecrets(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewExternalSecrets(&nginx))
+
+	nginx.Spec.ExternalSecrets = []v1alpha1.NginxExternalSecret{tlsExternalSecret(), {
+		Name:            "my-auth",
+		SecretStoreRef:  v1alpha1.ExternalSecretStoreRef{Name: "vault", Kind: "ClusterSecretStore"},
+		RefreshInterval: "15m",
+		Data:            []v1alpha1.ExternalSecretData{{SecretKey: "users", RemoteRef: v1alpha1.ExternalSecretRemoteRef{Key: "secret/htpasswd"}}},
+	}}
+	objects := NewExternalSecrets(&nginx)
+	if !assert.Len(t, objects, 2) {
+		return
+	}
+	e := objects[0]
+	assert.Equal(t, "external-secrets.io/v1beta1", e.GetAPIVersion())
+	assert.Equal(t, "ExternalSecret", e.GetKind())
+	assert.Equal(t, "my-tls", e.GetName())
+	assert.Equal(t, "default", e.GetNamespace())
+	assert.Len(t, e.GetOwnerReferences(), 1)
+	assert.Equal(t, LabelsForNginx("my-nginx"), e.GetLabels())
+	spec, _ := unstructured.NestedMap(e.Object, "spec")
+	assert.Equal(t, map[string]interface{}{
+		"refreshInterval": "1h",
+		"secretStoreRef":  map[string]interface{}{"name": "vault", "kind": "SecretStore"},
+		"target":          map[string]interface{}{"name": "my-tls", "creationPolicy": "Owner"},
+		"data": []interface{}{
+			map[string]interface{}{"secretKey": "tls.crt", "remoteRef": map[string]interface{}{"key": "secret/nginx", "property": "crt"}},
+			map[string]interface{}{"secretKey": "tls.key", "remoteRef": map[string]interface{}{"key": "secret/nginx", "property": "key"}},
+		},
+	}, spec)
+
+	spec, _ = unstructured.NestedMap(objects[1].Object, "spec")
+	assert.Equal(t, "15m", spec["refreshInterval"])
+	assert.Equal(t, map[string]interface{}{"name": "vault", "kind": "ClusterSecretStore"}, spec["secretStoreRef"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"secretKey": "users", "remoteRef": map[string]interface{}{"key": "secret/htpasswd"}},
+	}, spec["data"])
+}
+
+func TestExternalSecretMaterialized(t *testing.T) {
+	e := tlsExternalSecret()
+	assert.False(t, ExternalSecretMaterialized(e, &corev1.Secret{}))
+	assert.False(t, ExternalSecretMaterialized(e, &corev1.Secret{Data: map[string][]byte{"tls.crt": []byte("crt")}}))
+	assert.True(t, ExternalSecretMaterialized(e, &corev1.Secret{Data: map[string][]byte{"tls.crt": []byte("crt"), "tls.key": []byte("key")}}))
+}
+
+func TestExternalSecretsRevision(t *testing.T) {
+	secret := func(name string, data map[string]string) corev1.Secret {
+		s := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}, Data: map[string][]byte{}}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	revision := ExternalSecretsRevision([]corev1.Secret{secret("my-tls", map[string]string{"tls.crt": "crt", "tls.key": "key"})})
+	assert.Len(t, revision, 16)
+	assert.Equal(t, revision, ExternalSecretsRevision([]corev1.Secret{secret("my-tls", map[string]string{"tls.key": "key", "tls.crt": "crt"})}))
+	assert.NotEqual(t, revision, ExternalSecretsRevision([]corev1.Secret{secret("my-tls", map[string]string{"tls.crt": "rotated", "tls.key": "key"})}))
+	assert.NotEqual(t, revision, ExternalSecretsRevision([]corev1.Secret{secret("my-tls", map[string]string{"tls.crt": "crttls.key", "": "key"})}))
+
+	nginx := baseNginx()
+	nginx.Status.ExternalSecretsRevision = revision
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, ExternalSecretsRevisionPodAnnotation)
+
+	nginx.Spec.ExternalSecrets = []v1alpha1.NginxExternalSecret{tlsExternalSecret()}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, revision, dep.Spec.Template.Annotations[ExternalSecretsRevisionPodAnnotation])
+	assert.False(t, PodRestartRequested(dep.Spec.Template.Annotations, map[string]string{ExternalSecretsRevisionPodAnnotation: revision}))
+	assert.True(t, PodRestartRequested(dep.Spec.Template.Annotations, nil))
+}
+
+func TestValidateExternalSecrets(t *testing.T) {
+	tests := []struct {
+		name            string
+		externalSecrets func() []v1alpha1.NginxExternalSecret
+		tls             *v1alpha1.TLSSecret
+		extraFiles      []v1alpha1.NginxExtraFile
+		certificates    *v1alpha1.NginxCertificates
+		want            []string
+	}{
+		{name: "none", externalSecrets: func() []v1alpha1.NginxExternalSecret { return nil }},
+		{
+			name: "tls-and-extra-files",
+			externalSecrets: func() []v1alpha1.NginxExternalSecret {
+				return []v1alpha1.NginxExternalSecret{tlsExternalSecret(), {
+					Name:           "my-auth",
+					SecretStoreRef: v1alpha1.ExternalSecretStoreRef{Name: "vault", Kind: "ClusterSecretStore"},
+					Data:           []v1alpha1.ExternalSecretData{{SecretKey: "users", RemoteRef: v1alpha1.ExternalSecretRemoteRef{Key: "secret/htpasswd"}}},
+				}}
+			},
+			tls:        &v1alpha1.TLSSecret{SecretName: "my-tls"},
+			extraFiles: []v1alpha1.NginxExtraFile{{Path: "/etc/nginx/htpasswd/users", Secret: "my-auth"}},
+		},
+		{
+			name: "unused",
+			externalSecrets: func() []v1alpha1.NginxExternalSecret {
+				return []v1alpha1.NginxExternalSecret{tlsExternalSecret()}
+			},
+			tls:  &v1alpha1.TLSSecret{SecretName: "other"},
+			want: []string{`spec.externalSecrets[0] "my-tls" is not used by spec.tlsSecret or spec.extraFiles`},
+		},
+		{
+			name: "missing-keys",
+			externalSecrets: func() []v1alpha1.NginxExternalSecret {
+				e := tlsExternalSecret()
+				e.Data = e.Data[:1]
+				return []v1alpha1.NginxExternalSecret{e}
+			},
+			tls:        &v1alpha1.TLSSecret{SecretName: "my-tls"},
+			extraFiles: []v1alpha1.NginxExtraFile{{Path: "/etc/nginx/dhparam.pem", Secret: "my-tls"}},
+			want: []string{
+				`spec.externalSecrets[0].data has no secretKey "tls.key"`,
+				`spec.externalSecrets[0].data has no secretKey "dhparam.pem"`,
+			},
+		},
+		{
+			name: "invalid",
+			externalSecrets: func() []v1alpha1.NginxExternalSecret {
+				return []v1alpha1.NginxExternalSecret{
+					{
+						Name:            "my-nginx-tls",
+						SecretStoreRef:  v1alpha1.ExternalSecretStoreRef{Kind: "Vault"},
+						RefreshInterval: "hourly",
+						Data:            []v1alpha1.ExternalSecretData{{}},
+					},
+					{Name: "my-nginx-tls", SecretStoreRef: v1alpha1.ExternalSecretStoreRef{Name: "vault"}},
+				}
+			},
+			tls:          &v1alpha1.TLSSecret{SecretName: "my-nginx-tls"},
+			certificates: &v1alpha1.NginxCertificates{IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt"}, DNSNames: []string{"example.com"}},
+			want: []string{
+				`spec.externalSecrets[0].name "my-nginx-tls" is the secret of spec.certificates`,
+				"spec.externalSecrets[0].secretStoreRef.name is required",
+				`spec.externalSecrets[0].secretStoreRef.kind "Vault" is not supported`,
+				`spec.externalSecrets[0].refreshInterval "hourly" is not a valid duration`,
+				"spec.externalSecrets[0].data[0].secretKey is required",
+				"spec.externalSecrets[0].data[0].remoteRef.key is required",
+				`spec.externalSecrets[0].data has no secretKey "tls.key"`,
+				`spec.externalSecrets[0].data has no secretKey "tls.crt"`,
+				`spec.externalSecrets[1].name "my-nginx-tls" is duplicated`,
+				`spec.externalSecrets[1].name "my-nginx-tls" is the secret of spec.certificates`,
+				"spec.externalSecrets[1].data must not be empty",
+				`spec.externalSecrets[1].data has no secretKey "tls.key"`,
+				`spec.externalSecrets[1].data has no secretKey "tls.crt"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.ExternalSecrets = tt.externalSecrets()
+			nginx.Spec.TLSSecret = tt.tls
+			nginx.Spec.ExtraFiles = tt.extraFiles
+			nginx.Spec.Certificates = tt.certificates
+			assert.Equal(t, tt.want, validateExternalSecrets(&nginx))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+// fastCGIParamRegexp matches the names of FastCGI params
+var fastCGIParamRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// fastCGIManagedParams are the params set by the operator from the other
+// fields of the action
+var fastCGIManagedParams = map[string]string{
+	"SCRIPT_FILENAME": "root or script",
+	"PATH_INFO":       "script",
+}
+
+// renderFastCGI renders the directives passing the requests of a location to
+// a FastCGI server. The standard params are included from the fastcgi_params
+// file shipped with nginx. The action must have its default values already
+// set.
+func renderFastCGI(buf *bytes.Buffer, f *v1alpha1.FastCGIAction, namespace string) {
+	root := strings.TrimSuffix(f.Root, "/")
+	if f.Script == "" {
+		buf.WriteString("    fastcgi_split_path_info ^(.+?\\.php)(/.*)$;\n")
+	}
+	buf.WriteString("    include fastcgi_params;\n")
+	fmt.Fprintf(buf, "    fastcgi_index %s;\n", f.Index)
+	if f.Script == "" {
+		fmt.Fprintf(buf, "    fastcgi_param SCRIPT_FILENAME %s$fastcgi_script_name;\n", root)
+		buf.WriteString("    fastcgi_param PATH_INFO $fastcgi_path_info;\n")
+	} else {
+		fmt.Fprintf(buf, "    fastcgi_param SCRIPT_FILENAME %s%s;\n", root, f.Script)
+	}
+
+	keys := make([]string, 0, len(f.Params))
+	for k := range f.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "    fastcgi_param %s %s;\n", k, quote(f.Params[k]))
+	}
+	fmt.Fprintf(buf, "    fastcgi_pass %s.%s.svc:%d;\n", f.Service, namespace, f.Port)
+}
+
+// validateFastCGI returns the errors found in the FastCGI action of a location
+func validateFastCGI(field string, f *v1alpha1.FastCGIAction) []string {
+	var errs []string
+	if f.Service == "" {
+		errs = append(errs, fmt.Sprintf("%s.fastcgi.service is required", field))
+	}
+	if f.Port < 0 || f.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("%s.fastcgi.port %d is out of range", field, f.Port))
+	}
+	if f.Root != "" && (!strings.HasPrefix(f.Root, "/") || strings.ContainsAny(f.Root, " \t\n{};$")) {
+		errs = append(errs, fmt.Sprintf("%s.fastcgi.root %q must be an absolute path", field, f.Root))
+	}
+	if strings.ContainsAny(f.Index, "/ \t\n{};$") {
+		errs = append(errs, fmt.Sprintf("%s.fastcgi.index %q must be a file name", field, f.Index))
+	}
+	if f.Script != "" && (!strings.HasPrefix(f.Script, "/") || strings.ContainsAny(f.Script, " \t\n{};$")) {
+		errs = append(errs, fmt.Sprintf("%s.fastcgi.script %q must start with /", field, f.Script))
+	}
+
+	keys := make([]string, 0, len(f.Params))
+	for k := range f.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if owner, ok := fastCGIManagedParams[k]; ok {
+			errs = append(errs, fmt.Sprintf("%s.fastcgi.params %q is set from %s", field, k, owner))
+		} else if !fastCGIParamRegexp.MatchString(k) || strings.Contains(f.Params[k], "\n") {
+			errs = append(errs, fmt.Sprintf("%s.fastcgi.params %q must be a single param", field, k))
+		}
+	}
+	return errs
+}
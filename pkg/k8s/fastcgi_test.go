@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestRenderFastCGI(t *testing.T) {
+	spec := &v1alpha1.NginxSpec{Locations: []v1alpha1.NginxLocation{
+		{Path: "/", FastCGI: &v1alpha1.FastCGIAction{Service: "php"}},
+		{Path: "/app/", FastCGI: &v1alpha1.FastCGIAction{
+			Service: "app",
+			Port:    9001,
+			Root:    "/srv/app/public/",
+			Script:  "/index.php",
+			Params:  map[string]string{"APP_ENV": "production", "APP_NAME": `my "app"`},
+		}},
+	}}
+	assert.Equal(t, `location / {
+    fastcgi_split_path_info ^(.+?\.php)(/.*)$;
+    include fastcgi_params;
+    fastcgi_index index.php;
+    fastcgi_param SCRIPT_FILENAME /var/www/html$fastcgi_script_name;
+    fastcgi_param PATH_INFO $fastcgi_path_info;
+    fastcgi_pass php.default.svc:9000;
+}
+location /app/ {
+    include fastcgi_params;
+    fastcgi_index index.php;
+    fastcgi_param SCRIPT_FILENAME /srv/app/public/index.php;
+    fastcgi_param APP_ENV "production";
+    fastcgi_param APP_NAME "my \"app\"";
+    fastcgi_pass app.default.svc:9001;
+}
+`, renderLocations(spec.WithDefaults(), "default"))
+}
+
+func TestValidateFastCGI(t *testing.T) {
+	assert.Nil(t, validateFastCGI("spec.locations[0]", &v1alpha1.FastCGIAction{
+		Service: "php",
+		Root:    "/srv/app",
+		Script:  "/index.php",
+		Params:  map[string]string{"APP_ENV": "production"},
+	}))
+	assert.Equal(t, []string{
+		"spec.locations[0].fastcgi.service is required",
+		"spec.locations[0].fastcgi.port 70000 is out of range",
+		`spec.locations[0].fastcgi.root "srv" must be an absolute path`,
+		`spec.locations[0].fastcgi.index "app/index.php" must be a file name`,
+		`spec.locations[0].fastcgi.script "index.php" must start with /`,
+		`spec.locations[0].fastcgi.params "APP ENV" must be a single param`,
+		`spec.locations[0].fastcgi.params "SCRIPT_FILENAME" is set from root or script`,
+	}, validateFastCGI("spec.locations[0]", &v1alpha1.FastCGIAction{
+		Port:   70000,
+		Root:   "srv",
+		Index:  "app/index.php",
+		Script: "index.php",
+		Params: map[string]string{"APP ENV": "x", "SCRIPT_FILENAME": "/x.php"},
+	}))
+}
@@ -0,0 +1,75 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// FlaggerSelectorLabel is the label added to the deployment selector when
+	// the Flagger integration is enabled. Flagger uses its value to name the
+	// primary deployment, so it must be unique per Nginx.
+	FlaggerSelectorLabel = "app.kubernetes.io/name"
+
+	// MetricTemplateAPIVersion is the api version of the Flagger MetricTemplate resource
+	MetricTemplateAPIVersion = "flagger.app/v1beta1"
+
+	// MetricTemplateKind is the kind of the Flagger MetricTemplate resource
+	MetricTemplateKind = "MetricTemplate"
+
+	// defaultRequestRateQuery is the query of the request rate metric template
+	// created for every Nginx using the Flagger integration
+	defaultRequestRateQuery = `sum(rate(nginx_http_requests_total{namespace="{{ namespace }}",pod=~"{{ target }}-[0-9a-zA-Z]+(-[0-9a-zA-Z]+)"}[{{ interval }}]))`
+)
+
+// NewMetricTemplates assembles the Flagger metric templates for the Nginx.
+// It returns nil if the Flagger integration is disabled.
+func NewMetricTemplates(n *v1alpha1.Nginx) []*unstructured.Unstructured {
+	if n.Spec.Flagger == nil {
+		return nil
+	}
+	templates := append([]v1alpha1.FlaggerMetricTemplate{
+		{Name: "request-rate", Query: defaultRequestRateQuery},
+	}, n.Spec.Flagger.MetricTemplates...)
+
+	var objects []*unstructured.Unstructured
+	for _, t := range templates {
+		o := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"provider": map[string]interface{}{
+					"type":    "prometheus",
+					"address": n.Spec.Flagger.PrometheusAddress,
+				},
+				"query": t.Query,
+			},
+		}}
+		o.SetAPIVersion(MetricTemplateAPIVersion)
+		o.SetKind(MetricTemplateKind)
+		o.SetName(n.Name + "-" + t.Name)
+		o.SetNamespace(n.Namespace)
+		o.SetLabels(LabelsForNginx(n.Name))
+		o.SetOwnerReferences([]metav1.OwnerReference{
+			*metav1.NewControllerRef(n, schema.GroupVersionKind{
+				Group:   v1alpha1.SchemeGroupVersion.Group,
+				Version: v1alpha1.SchemeGroupVersion.Version,
+				Kind:    "Nginx",
+			}),
+		})
+		setCustomMetadata(&n.Spec, o)
+		objects = append(objects, o)
+	}
+	return objects
+}
+
+// podLabelsForNginx returns the labels set on the nginx pods, which are also
+// used as the deployment selector
+func podLabelsForNginx(n *v1alpha1.Nginx) map[string]string {
+	labels := LabelsForNginx(n.Name)
+	if n.Spec.Flagger != nil {
+		labels[FlaggerSelectorLabel] = n.Name
+	}
+	return labels
+}
@@ -0,0 +1,38 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewMetricTemplates(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewMetricTemplates(&nginx))
+
+	nginx.Spec.Flagger = &v1alpha1.FlaggerSpec{
+		PrometheusAddress: "http://prometheus:9090",
+		MetricTemplates: []v1alpha1.FlaggerMetricTemplate{
+			{Name: "active-connections", Query: "sum(nginx_connections_active)"},
+		},
+	}
+	templates := NewMetricTemplates(&nginx)
+	assert.Len(t, templates, 2)
+
+	var names, queries []string
+	for _, tmpl := range templates {
+		assert.Equal(t, "flagger.app/v1beta1", tmpl.GetAPIVersion())
+		assert.Equal(t, "MetricTemplate", tmpl.GetKind())
+		assert.Equal(t, "default", tmpl.GetNamespace())
+		assert.Len(t, tmpl.GetOwnerReferences(), 1)
+		address, _ := unstructured.NestedString(tmpl.Object, "spec", "provider", "address")
+		assert.Equal(t, "http://prometheus:9090", address)
+		query, _ := unstructured.NestedString(tmpl.Object, "spec", "query")
+		names = append(names, tmpl.GetName())
+		queries = append(queries, query)
+	}
+	assert.Equal(t, []string{"my-nginx-request-rate", "my-nginx-active-connections"}, names)
+	assert.Equal(t, []string{defaultRequestRateQuery, "sum(nginx_connections_active)"}, queries)
+}
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"sort"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultCertificateExpiryThreshold is how long before their expiration
+	// the certificates are listed in the fleet status
+	DefaultCertificateExpiryThreshold = 30 * 24 * time.Hour
+
+	// maxFleetListed bounds the instances and certificates listed in the
+	// fleet status, keeping the object small for large fleets
+	maxFleetListed = 100
+)
+
+// FleetInstance is the state of an nginx instance summarized in the fleet
+// status
+type FleetInstance struct {
+	Namespace           string
+	Name                string
+	Image               string
+	Problem             string
+	CertificateSecret   string
+	CertificateNotAfter *metav1.Time
+}
+
+// NewFleetInstance returns the state of the nginx for the fleet status,
+// unhealthy for the given problem, if any
+func NewFleetInstance(n *v1alpha1.Nginx, problem string) FleetInstance {
+	spec := n.Spec.WithDefaults()
+	instance := FleetInstance{
+		Namespace: n.Namespace,
+		Name:      n.Name,
+		Image:     spec.Image,
+		Problem:   problem,
+	}
+	if spec.TLSSecret != nil && n.Status.CertificateNotAfter != nil {
+		instance.CertificateSecret = spec.TLSSecret.SecretName
+		instance.CertificateNotAfter = n.Status.CertificateNotAfter
+	}
+	return instance
+}
+
+// InstanceProblem returns why the nginx is unhealthy according to its
+// status, or an empty string
+func InstanceProblem(n *v1alpha1.Nginx) string {
+	if c := n.Status.GetCondition(v1alpha1.NginxConditionConfigValid); c != nil && c.Status == corev1.ConditionFalse {
+		return "InvalidConfig"
+	}
+	if c := n.Status.GetCondition(v1alpha1.NginxConditionBlockedByPolicy); c != nil && c.Status == corev1.ConditionTrue {
+		return "BlockedByPolicy"
+	}
+	if c := n.Status.GetCondition(v1alpha1.NginxConditionLoadBalancerReady); c != nil && c.Reason == LoadBalancerStuck {
+		return "LoadBalancerStuck"
+	}
+	if d := n.Status.Deployment; d != nil && d.UnavailableReplicas > 0 {
+		return "PodsUnavailable"
+	}
+	return ""
+}
+
+// CertificateNotAfter returns when the first certificate of the PEM data
+// expires, or nil when there is none
+func CertificateNotAfter(data []byte) *metav1.Time {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+		notAfter := metav1.NewTime(cert.NotAfter)
+		return &notAfter
+	}
+}
+
+// SummarizeFleet returns the summary of the given instances, listing the
+// certificates expiring before the given time
+func SummarizeFleet(instances []FleetInstance, expiringBefore time.Time) v1alpha1.NginxFleetSummary {
+	sorted := append([]FleetInstance(nil), instances...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Namespace != sorted[j].Namespace {
+			return sorted[i].Namespace < sorted[j].Namespace
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	summary := v1alpha1.NginxFleetSummary{Instances: int32(len(sorted))}
+	images := make(map[string]int32)
+	for _, i := range sorted {
+		images[i.Image]++
+		if i.Problem != "" {
+			summary.UnhealthyInstances++
+			if len(summary.Unhealthy) < maxFleetListed {
+				summary.Unhealthy = append(summary.Unhealthy, v1alpha1.NginxFleetInstance{
+					Namespace: i.Namespace,
+					Name:      i.Name,
+					Reason:    i.Problem,
+				})
+			}
+		}
+		if i.CertificateNotAfter != nil && i.CertificateNotAfter.Time.Before(expiringBefore) {
+			summary.ExpiringCertificates = append(summary.ExpiringCertificates, v1alpha1.NginxFleetCertificate{
+				Namespace: i.Namespace,
+				Name:      i.Name,
+				Secret:    i.CertificateSecret,
+				NotAfter:  *i.CertificateNotAfter,
+			})
+		}
+	}
+
+	for image, count := range images {
+		summary.Images = append(summary.Images, v1alpha1.NginxFleetImage{Image: image, Instances: count})
+	}
+	sort.Slice(summary.Images, func(i, j int) bool {
+		a, b := summary.Images[i], summary.Images[j]
+		if a.Instances != b.Instances {
+			return a.Instances > b.Instances
+		}
+		return a.Image < b.Image
+	})
+
+	certs := summary.ExpiringCertificates
+	sort.SliceStable(certs, func(i, j int) bool {
+		return certs[i].NotAfter.Before(&certs[j].NotAfter)
+	})
+	if len(certs) > maxFleetListed {
+		summary.ExpiringCertificates = certs[:maxFleetListed]
+	}
+	return summary
+}
@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCertificateNotAfter(t *testing.T) {
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+
+	got := CertificateNotAfter(data)
+	if assert.NotNil(t, got) {
+		assert.True(t, notAfter.Equal(got.Time))
+	}
+	assert.Nil(t, CertificateNotAfter(nil))
+	assert.Nil(t, CertificateNotAfter([]byte("not a certificate")))
+}
+
+func TestInstanceProblem(t *testing.T) {
+	nginx := baseNginx()
+	assert.Equal(t, "", InstanceProblem(&nginx))
+
+	nginx.Status.Deployment = &v1alpha1.NginxDeploymentStatus{UnavailableReplicas: 1}
+	assert.Equal(t, "PodsUnavailable", InstanceProblem(&nginx))
+
+	nginx.Status.Conditions = []v1alpha1.NginxCondition{{Type: v1alpha1.NginxConditionLoadBalancerReady, Status: corev1.ConditionFalse, Reason: LoadBalancerStuck}}
+	assert.Equal(t, "LoadBalancerStuck", InstanceProblem(&nginx))
+
+	nginx.Status.Conditions = append(nginx.Status.Conditions, v1alpha1.NginxCondition{Type: v1alpha1.NginxConditionBlockedByPolicy, Status: corev1.ConditionTrue})
+	assert.Equal(t, "BlockedByPolicy", InstanceProblem(&nginx))
+
+	nginx.Status.Conditions = append(nginx.Status.Conditions, v1alpha1.NginxCondition{Type: v1alpha1.NginxConditionConfigValid, Status: corev1.ConditionFalse})
+	assert.Equal(t, "InvalidConfig", InstanceProblem(&nginx))
+}
+
+func TestNewFleetInstance(t *testing.T) {
+	nginx := baseNginx()
+	notAfter := metav1.NewTime(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	nginx.Status.CertificateNotAfter = &notAfter
+	assert.Equal(t, FleetInstance{Namespace: "default", Name: "my-nginx", Image: "nginx:latest", Problem: "ReconcileFailed"},
+		NewFleetInstance(&nginx, "ReconcileFailed"))
+
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "my-tls"}
+	assert.Equal(t, FleetInstance{Namespace: "default", Name: "my-nginx", Image: "nginx:latest", CertificateSecret: "my-tls", CertificateNotAfter: &notAfter},
+		NewFleetInstance(&nginx, ""))
+}
+
+func TestSummarizeFleet(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	soon := metav1.NewTime(now.Add(24 * time.Hour))
+	sooner := metav1.NewTime(now.Add(time.Hour))
+	later := metav1.NewTime(now.Add(90 * 24 * time.Hour))
+	summary := SummarizeFleet([]FleetInstance{
+		{Namespace: "b", Name: "web", Image: "nginx:1.25", Problem: "PodsUnavailable", CertificateSecret: "web-tls", CertificateNotAfter: &soon},
+		{Namespace: "a", Name: "web", Image: "nginx:1.24", CertificateSecret: "web-tls", CertificateNotAfter: &later},
+		{Namespace: "a", Name: "api", Image: "nginx:1.25", Problem: "ReconcileFailed", CertificateSecret: "api-tls", CertificateNotAfter: &sooner},
+		{Namespace: "c", Name: "static", Image: "nginx:1.23"},
+	}, now.Add(30*24*time.Hour))
+
+	assert.Equal(t, v1alpha1.NginxFleetSummary{
+		Instances:          4,
+		UnhealthyInstances: 2,
+		Unhealthy: []v1alpha1.NginxFleetInstance{
+			{Namespace: "a", Name: "api", Reason: "ReconcileFailed"},
+			{Namespace: "b", Name: "web", Reason: "PodsUnavailable"},
+		},
+		Images: []v1alpha1.NginxFleetImage{
+			{Image: "nginx:1.25", Instances: 2},
+			{Image: "nginx:1.23", Instances: 1},
+			{Image: "nginx:1.24", Instances: 1},
+		},
+		ExpiringCertificates: []v1alpha1.NginxFleetCertificate{
+			{Namespace: "a", Name: "api", Secret: "api-tls", NotAfter: sooner},
+			{Namespace: "b", Name: "web", Secret: "web-tls", NotAfter: soon},
+		},
+	}, summary)
+
+	assert.Equal(t, v1alpha1.NginxFleetSummary{}, SummarizeFleet(nil, now))
+
+	var many []FleetInstance
+	for i := 0; i < 150; i++ {
+		many = append(many, FleetInstance{Namespace: "ns", Name: string(rune('a' + i%26)), Image: "nginx", Problem: "ReconcileStale"})
+	}
+	summary = SummarizeFleet(many, now)
+	assert.Equal(t, int32(150), summary.UnhealthyInstances)
+	assert.Len(t, summary.Unhealthy, 100)
+}
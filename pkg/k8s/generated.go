@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SpecHashAnnotation holds the hash of the workload spec generated by
+	// the operator
+	SpecHashAnnotation = "nginx.tsuru.io/spec-hash"
+
+	// TemplateHashAnnotation holds the hash of the pod template generated by
+	// the operator
+	TemplateHashAnnotation = "nginx.tsuru.io/template-hash"
+)
+
+// GeneratedHash identifies the workload spec and pod template generated by
+// the operator. Workloads are compared through it instead of their live
+// spec, which holds fields defaulted by the API server, or the nginx spec,
+// whose changes do not always change the generated objects.
+type GeneratedHash struct {
+	Spec     string
+	Template string
+}
+
+// WorkloadBuilder builds a workload of the nginx, like NewDeployment
+type WorkloadBuilder func(n *v1alpha1.Nginx) (metav1.Object, error)
+
+// GeneratedHashOf returns the hash recorded in the annotations of a workload
+// built by the operator. It returns false if the workload has none, like the
+// ones created by operator versions storing the nginx spec instead.
+func GeneratedHashOf(o metav1.Object) (GeneratedHash, bool) {
+	ann := o.GetAnnotations()
+	h := GeneratedHash{Spec: ann[SpecHashAnnotation], Template: ann[TemplateHashAnnotation]}
+	return h, h.Spec != "" && h.Template != ""
+}
+
+// CurrentGeneratedHash returns the hash of the generated objects the current
+// workload was last updated with. Workloads created by older operator versions
+// are rebuilt with the given builder from the nginx spec stored in their
+// generated-from annotation, so upgrading the operator does not replace pods
+// whose generated objects did not change. An empty hash is returned when the
+// workload has neither annotation.
+func CurrentGeneratedHash(n *v1alpha1.Nginx, current metav1.Object, build WorkloadBuilder) (GeneratedHash, error) {
+	if h, ok := GeneratedHashOf(current); ok {
+		return h, nil
+	}
+	if _, ok := current.GetAnnotations()[generatedFromAnnotation]; !ok {
+		return GeneratedHash{}, nil
+	}
+	spec, err := ExtractNginxSpec(metav1.ObjectMeta{Annotations: current.GetAnnotations()})
+	if err != nil {
+		return GeneratedHash{}, err
+	}
+	legacy := n.DeepCopy()
+	legacy.Spec = spec
+	o, err := build(legacy)
+	if err != nil {
+		return GeneratedHash{}, err
+	}
+	h, _ := GeneratedHashOf(o)
+	return h, nil
+}
+
+// CopyGeneratedHash records the generated hash of desired into the
+// annotations of current, removing the nginx spec stored by older operator
+// versions
+func CopyGeneratedHash(current, desired metav1.Object) {
+	h, _ := GeneratedHashOf(desired)
+	ann := current.GetAnnotations()
+	if ann == nil {
+		ann = make(map[string]string)
+	}
+	delete(ann, generatedFromAnnotation)
+	ann[SpecHashAnnotation] = h.Spec
+	ann[TemplateHashAnnotation] = h.Template
+	current.SetAnnotations(ann)
+}
+
+// setGeneratedHash records the hash of the generated workload spec and pod
+// template into the workload annotations
+func setGeneratedHash(o metav1.Object, spec, template interface{}) error {
+	specHash, err := objectHash(spec)
+	if err != nil {
+		return err
+	}
+	templateHash, err := objectHash(template)
+	if err != nil {
+		return err
+	}
+	ann := make(map[string]string)
+	for k, v := range o.GetAnnotations() {
+		ann[k] = v
+	}
+	ann[SpecHashAnnotation] = specHash
+	ann[TemplateHashAnnotation] = templateHash
+	o.SetAnnotations(ann)
+	return nil
+}
+
+func objectHash(o interface{}) (string, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16], nil
+}
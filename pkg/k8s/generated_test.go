@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func buildDeployment(n *v1alpha1.Nginx) (metav1.Object, error) {
+	return NewDeployment(n)
+}
+
+func TestGeneratedHash(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	h, ok := GeneratedHashOf(dep)
+	assert.True(t, ok)
+
+	// Spec fields that do not change the deployment keep its hash
+	policy := metav1.DeletePropagationForeground
+	nginx.Spec.DeletePropagation = &policy
+	nginx.Spec.ClampReplicasToQuota = true
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	same, _ := GeneratedHashOf(dep)
+	assert.Equal(t, h, same)
+
+	replicas := int32(3)
+	nginx.Spec.Replicas = &replicas
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	scaled, _ := GeneratedHashOf(dep)
+	assert.NotEqual(t, h.Spec, scaled.Spec)
+	assert.Equal(t, h.Template, scaled.Template)
+
+	nginx.Spec.Image = "nginx:1.25"
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	updated, _ := GeneratedHashOf(dep)
+	assert.NotEqual(t, h.Template, updated.Template)
+}
+
+func TestCurrentGeneratedHash(t *testing.T) {
+	nginx := baseNginx()
+	desired, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	want, _ := GeneratedHashOf(desired)
+
+	legacy := func(spec v1alpha1.NginxSpec) metav1.Object {
+		o := &metav1.ObjectMeta{}
+		assert.Nil(t, SetNginxSpec(o, spec))
+		return o
+	}
+	otherSpec := nginx.Spec
+	otherSpec.Image = "nginx:1.25"
+
+	tests := []struct {
+		name    string
+		current metav1.Object
+		want    GeneratedHash
+	}{
+		{
+			name:    "hashed",
+			current: desired,
+			want:    want,
+		},
+		{
+			name:    "legacy-same-spec",
+			current: legacy(nginx.Spec),
+			want:    want,
+		},
+		{
+			name:    "not-annotated",
+			current: &metav1.ObjectMeta{},
+			want:    GeneratedHash{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CurrentGeneratedHash(&nginx, tt.current, buildDeployment)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	got, err := CurrentGeneratedHash(&nginx, legacy(otherSpec), buildDeployment)
+	assert.Nil(t, err)
+	assert.NotEqual(t, want.Template, got.Template)
+}
+
+func TestCopyGeneratedHash(t *testing.T) {
+	nginx := baseNginx()
+	desired, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	current := &metav1.ObjectMeta{Annotations: map[string]string{"other": "value"}}
+	assert.Nil(t, SetNginxSpec(current, nginx.Spec))
+	CopyGeneratedHash(current, desired)
+	assert.Equal(t, map[string]string{
+		"other":                "value",
+		SpecHashAnnotation:     desired.Annotations[SpecHashAnnotation],
+		TemplateHashAnnotation: desired.Annotations[TemplateHashAnnotation],
+	}, current.Annotations)
+}
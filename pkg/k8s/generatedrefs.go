@@ -0,0 +1,13 @@
+package k8s
+
+import "github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+// WithGeneratedRefs returns a copy of the spec referencing the objects
+// generated for the Nginx: the certificate secret as the TLS secret and the
+// config map rendered from the config template as the config, unless the
+// spec sets them. The receiver is never modified.
+func WithGeneratedRefs(n *v1alpha1.Nginx) *v1alpha1.NginxSpec {
+	n = n.DeepCopy()
+	n.Spec = *WithCertificateTLS(n)
+	return WithTemplateConfig(n)
+}
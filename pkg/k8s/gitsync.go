@@ -0,0 +1,89 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	gitSyncVolume = "git-sync"
+
+	// Mount path of the shared volume in the git-sync containers
+	gitSyncRoot = "/git"
+
+	// Name of the symlink, relative to the volume root, pointing to the
+	// current checkout
+	gitSyncDest = "repo"
+)
+
+// setupGitSync adds the volume shared by nginx and git-sync, an init
+// container cloning the repository before nginx starts and a sidecar pulling
+// it periodically. The spec must have its default values already set.
+func setupGitSync(gs *v1alpha1.NginxGitSync, dep *appv1.Deployment) {
+	if gs == nil {
+		return
+	}
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         gitSyncVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      gitSyncVolume,
+		MountPath: gs.MountPath,
+		ReadOnly:  true,
+	})
+
+	initContainer := gitSyncContainer(gs, "git-sync-init")
+	initContainer.Env = append(initContainer.Env, corev1.EnvVar{Name: "GIT_SYNC_ONE_TIME", Value: "true"})
+	podSpec.InitContainers = append(podSpec.InitContainers, initContainer)
+	podSpec.Containers = append(podSpec.Containers, gitSyncContainer(gs, "git-sync"))
+}
+
+func gitSyncContainer(gs *v1alpha1.NginxGitSync, name string) corev1.Container {
+	container := corev1.Container{
+		Name:  name,
+		Image: gs.Image,
+		Env: []corev1.EnvVar{
+			{Name: "GIT_SYNC_REPO", Value: gs.Repository},
+			{Name: "GIT_SYNC_BRANCH", Value: gs.Ref},
+			{Name: "GIT_SYNC_ROOT", Value: gitSyncRoot},
+			{Name: "GIT_SYNC_DEST", Value: gitSyncDest},
+			{Name: "GIT_SYNC_WAIT", Value: fmt.Sprint(gs.Interval)},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: gitSyncVolume, MountPath: gitSyncRoot},
+		},
+	}
+	if gs.Secret != "" {
+		container.EnvFrom = []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: gs.Secret},
+			},
+		}}
+	}
+	return container
+}
+
+// validateGitSync returns the errors found in the git-sync spec
+func validateGitSync(gs *v1alpha1.NginxGitSync) []string {
+	if gs == nil {
+		return nil
+	}
+	var errs []string
+	if gs.Repository == "" {
+		errs = append(errs, "spec.gitSync.repository is required")
+	}
+	if gs.Interval < 0 {
+		errs = append(errs, "spec.gitSync.interval must not be negative")
+	}
+	if gs.MountPath != "" && !strings.HasPrefix(gs.MountPath, "/") {
+		errs = append(errs, fmt.Sprintf("spec.gitSync.mountPath %q must be an absolute path", gs.MountPath))
+	}
+	return errs
+}
@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetupGitSync(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "conf"}
+	nginx.Spec.GitSync = &v1alpha1.NginxGitSync{
+		Repository: "https://github.com/example/site",
+		Ref:        "v1.0",
+		Interval:   30,
+		Secret:     "git-credentials",
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	podSpec := dep.Spec.Template.Spec
+	assert.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name:         "git-sync",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "git-sync",
+		MountPath: "/usr/share/nginx/git",
+		ReadOnly:  true,
+	})
+	env := []corev1.EnvVar{
+		{Name: "GIT_SYNC_REPO", Value: "https://github.com/example/site"},
+		{Name: "GIT_SYNC_BRANCH", Value: "v1.0"},
+		{Name: "GIT_SYNC_ROOT", Value: "/git"},
+		{Name: "GIT_SYNC_DEST", Value: "repo"},
+		{Name: "GIT_SYNC_WAIT", Value: "30"},
+	}
+	envFrom := []corev1.EnvFromSource{{
+		SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "git-credentials"}},
+	}}
+	mounts := []corev1.VolumeMount{{Name: "git-sync", MountPath: "/git"}}
+	assert.Equal(t, []corev1.Container{{
+		Name:         "git-sync-init",
+		Image:        "k8s.gcr.io/git-sync:v3.1.1",
+		Env:          append(env, corev1.EnvVar{Name: "GIT_SYNC_ONE_TIME", Value: "true"}),
+		EnvFrom:      envFrom,
+		VolumeMounts: mounts,
+	}}, podSpec.InitContainers)
+	assert.Len(t, podSpec.Containers, 2)
+	assert.Equal(t, corev1.Container{
+		Name:         "git-sync",
+		Image:        "k8s.gcr.io/git-sync:v3.1.1",
+		Env:          env,
+		EnvFrom:      envFrom,
+		VolumeMounts: mounts,
+	}, podSpec.Containers[1])
+
+	// The checkout is reloaded even without the Reload strategy
+	assert.Equal(t, []string{"/bin/sh", "-c", reloadScript(defaultGlobals, "/usr/share/nginx/git/repo", "/etc/nginx-reload/..data")}, podSpec.Containers[0].Command)
+
+	nginx.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", reloadScript(defaultGlobals, "/etc/nginx/..data", "/usr/share/nginx/git/repo", "/etc/nginx-reload/..data")}, dep.Spec.Template.Spec.Containers[0].Command)
+}
+
+func TestReloadScript(t *testing.T) {
+	assert.Contains(t, reloadScript(defaultGlobals, "/etc/nginx/..data", "/usr/share/nginx/git/repo"),
+		"current=$(readlink /etc/nginx/..data; readlink /usr/share/nginx/git/repo)\n")
+}
+
+func TestValidateGitSync(t *testing.T) {
+	assert.Nil(t, validateGitSync(nil))
+	assert.Nil(t, validateGitSync(&v1alpha1.NginxGitSync{Repository: "https://github.com/example/site"}))
+	assert.Equal(t, []string{
+		"spec.gitSync.repository is required",
+		"spec.gitSync.interval must not be negative",
+		`spec.gitSync.mountPath "git" must be an absolute path`,
+	}, validateGitSync(&v1alpha1.NginxGitSync{Interval: -1, MountPath: "git"}))
+}
@@ -0,0 +1,240 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// GuardrailMode is how the operator handles the nginx objects out of its
+// guardrails
+type GuardrailMode string
+
+const (
+	// GuardrailModeReject holds the reconcile of out of policy nginx objects
+	GuardrailModeReject = GuardrailMode("Reject")
+	// GuardrailModeClamp lowers the replicas and resource requests of out of
+	// policy nginx objects to the maximums, rejecting the images that are
+	// not allowed
+	GuardrailModeClamp = GuardrailMode("Clamp")
+)
+
+// Reasons of the Degraded condition set by the guardrails
+const (
+	GuardrailsRejected = "GuardrailsRejected"
+	GuardrailsClamped  = "GuardrailsClamped"
+)
+
+// Guardrails are the operator limits enforced on every nginx, so the Nginx
+// resource can be exposed to the tenants of a shared cluster. Zero values
+// leave the settings unlimited.
+type Guardrails struct {
+	// MaxReplicas of the workload
+	MaxReplicas int32
+
+	// MaxRequests are the highest resource requests of each container of
+	// the pods
+	MaxRequests corev1.ResourceList
+
+	// AllowedRegistries are the registries, optionally followed by a
+	// repository path, like quay.io/team, the images of the pods must come
+	// from. Images without a registry come from docker.io.
+	AllowedRegistries []string
+
+	// Mode is how nginx objects out of the guardrails are handled, Reject
+	// when empty
+	Mode GuardrailMode
+}
+
+// Enabled returns whether the guardrails limit any setting
+func (g Guardrails) Enabled() bool {
+	return g.MaxReplicas > 0 || len(g.MaxRequests) > 0 || len(g.AllowedRegistries) > 0
+}
+
+// Validate returns an error if the guardrails could never be met
+func (g Guardrails) Validate() error {
+	switch g.Mode {
+	case "", GuardrailModeReject, GuardrailModeClamp:
+	default:
+		return fmt.Errorf("mode %q is not supported, must be Reject or Clamp", g.Mode)
+	}
+	if g.MaxReplicas < 0 {
+		return fmt.Errorf("max replicas must not be negative")
+	}
+	for _, name := range sortedResourceNames(g.MaxRequests) {
+		if q := g.MaxRequests[name]; q.Sign() <= 0 {
+			return fmt.Errorf("max %s request must be positive", name)
+		}
+	}
+	for _, r := range g.AllowedRegistries {
+		if r == "" || strings.ContainsAny(r, "@ ") {
+			return fmt.Errorf("allowed registry %q is invalid", r)
+		}
+	}
+	return nil
+}
+
+// GuardrailViolations returns the settings of the nginx out of the
+// guardrails. The images and requests checked are the ones of the pods
+// assembled from its spec.
+func GuardrailViolations(n *v1alpha1.Nginx, g Guardrails) []string {
+	if !g.Enabled() {
+		return nil
+	}
+	var errs []string
+	if g.MaxReplicas > 0 && n.Spec.WorkloadKind != v1alpha1.WorkloadKindDaemonSet {
+		if replicas := specReplicas(&n.Spec); replicas > g.MaxReplicas {
+			errs = append(errs, fmt.Sprintf("spec.replicas %d is above the maximum of %d", replicas, g.MaxReplicas))
+		}
+	}
+	if v := verticalAutoscaling(&n.Spec); v != nil {
+		for _, name := range sortedResourceNames(g.MaxRequests) {
+			max := g.MaxRequests[name]
+			if allowed, ok := v.MaxAllowed[name]; !ok || allowed.Cmp(max) > 0 {
+				errs = append(errs, fmt.Sprintf("spec.autoscaling.vertical.maxAllowed must keep %s within %s", name, max.String()))
+			}
+		}
+	}
+
+	deployment, err := NewDeployment(n)
+	if err != nil {
+		return errs
+	}
+	podSpec := deployment.Spec.Template.Spec
+	containers := append(append([]corev1.Container(nil), podSpec.InitContainers...), podSpec.Containers...)
+	for _, c := range containers {
+		for _, name := range sortedResourceNames(g.MaxRequests) {
+			max := g.MaxRequests[name]
+			if request, ok := effectiveRequest(c.Resources, name); ok && request.Cmp(max) > 0 {
+				errs = append(errs, fmt.Sprintf("container %q requests %s %s, above the maximum of %s", c.Name, name, request.String(), max.String()))
+			}
+		}
+	}
+	if len(g.AllowedRegistries) > 0 {
+		for _, c := range containers {
+			if c.Image != "" && !imageAllowed(c.Image, g.AllowedRegistries) {
+				errs = append(errs, fmt.Sprintf("image %q of container %q is not from an allowed registry (%s)", c.Image, c.Name, strings.Join(g.AllowedRegistries, ", ")))
+			}
+		}
+	}
+	return errs
+}
+
+// ClampToGuardrails returns a copy of the spec with its replicas and the
+// resource requests of the containers it sets lowered to the guardrails,
+// along with the settings that were clamped. Images cannot be clamped, nor
+// the resources of the containers added by the operator from other fields.
+func ClampToGuardrails(spec *v1alpha1.NginxSpec, g Guardrails) (*v1alpha1.NginxSpec, []string) {
+	out := spec.DeepCopy()
+	var clamped []string
+	if g.MaxReplicas > 0 && out.WorkloadKind != v1alpha1.WorkloadKindDaemonSet {
+		if replicas := specReplicas(out); replicas > g.MaxReplicas {
+			max := g.MaxReplicas
+			out.Replicas = &max
+			clamped = append(clamped, fmt.Sprintf("spec.replicas from %d to %d", replicas, max))
+		}
+	}
+	clampRequests := func(field string, r *corev1.ResourceRequirements) {
+		for _, name := range sortedResourceNames(g.MaxRequests) {
+			max := g.MaxRequests[name]
+			request, ok := effectiveRequest(*r, name)
+			if !ok || request.Cmp(max) <= 0 {
+				continue
+			}
+			if r.Requests == nil {
+				r.Requests = corev1.ResourceList{}
+			}
+			r.Requests[name] = max.DeepCopy()
+			clamped = append(clamped, fmt.Sprintf("%s.requests.%s from %s to %s", field, name, request.String(), max.String()))
+		}
+	}
+	clampRequests("spec.podTemplate.resources", &out.PodTemplate.Resources)
+	for i := range out.PodTemplate.Containers {
+		clampRequests(fmt.Sprintf("spec.podTemplate.containers[%d].resources", i), &out.PodTemplate.Containers[i].Resources)
+	}
+	for i := range out.PodTemplate.InitContainers {
+		clampRequests(fmt.Sprintf("spec.podTemplate.initContainers[%d].resources", i), &out.PodTemplate.InitContainers[i].Resources)
+	}
+	if v := verticalAutoscaling(out); v != nil {
+		for _, name := range sortedResourceNames(g.MaxRequests) {
+			max := g.MaxRequests[name]
+			if allowed, ok := v.MaxAllowed[name]; ok && allowed.Cmp(max) <= 0 {
+				continue
+			}
+			if v.MaxAllowed == nil {
+				v.MaxAllowed = corev1.ResourceList{}
+			}
+			v.MaxAllowed[name] = max.DeepCopy()
+			clamped = append(clamped, fmt.Sprintf("spec.autoscaling.vertical.maxAllowed.%s to %s", name, max.String()))
+		}
+	}
+	return out, clamped
+}
+
+// specReplicas returns the replicas of the spec, 1 when unset
+func specReplicas(spec *v1alpha1.NginxSpec) int32 {
+	if spec.Replicas == nil {
+		return 1
+	}
+	return *spec.Replicas
+}
+
+// verticalAutoscaling returns the vertical autoscaling of the spec when its
+// recommendations are set on the pods, bypassing their requests
+func verticalAutoscaling(spec *v1alpha1.NginxSpec) *v1alpha1.NginxVerticalAutoscaling {
+	if spec.Autoscaling == nil || spec.Autoscaling.Vertical == nil {
+		return nil
+	}
+	v := spec.Autoscaling.Vertical
+	if v.UpdateMode == "" || v.UpdateMode == v1alpha1.VerticalUpdateModeOff {
+		return nil
+	}
+	return v
+}
+
+// effectiveRequest returns the request of the resource, which defaults to
+// its limit when unset
+func effectiveRequest(r corev1.ResourceRequirements, name corev1.ResourceName) (q resource.Quantity, ok bool) {
+	if q, ok = r.Requests[name]; ok {
+		return q, true
+	}
+	q, ok = r.Limits[name]
+	return q, ok
+}
+
+// imageAllowed returns whether the image comes from one of the registries
+func imageAllowed(image string, registries []string) bool {
+	repository := imageRepository(image)
+	for _, r := range registries {
+		r = strings.TrimSuffix(r, "/")
+		if repository == r || strings.HasPrefix(repository, r+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// imageRepository returns the repository of the image qualified with its
+// registry and without its tag or digest, like docker.io/library/nginx for
+// nginx:1.25
+func imageRepository(image string) string {
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return name
+	}
+	if len(parts) == 1 {
+		name = "library/" + name
+	}
+	return "docker.io/" + name
+}
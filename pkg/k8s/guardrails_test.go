@@ -0,0 +1,179 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestGuardrailsValidate(t *testing.T) {
+	tests := []struct {
+		guardrails Guardrails
+		want       string
+	}{
+		{Guardrails{}, ""},
+		{Guardrails{MaxReplicas: 3, Mode: GuardrailModeClamp, AllowedRegistries: []string{"docker.io", "localhost:5000/team"}}, ""},
+		{Guardrails{Mode: "Warn"}, `mode "Warn" is not supported, must be Reject or Clamp`},
+		{Guardrails{MaxReplicas: -1}, "max replicas must not be negative"},
+		{Guardrails{MaxRequests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("0")}}, "max cpu request must be positive"},
+		{Guardrails{AllowedRegistries: []string{"quay.io", ""}}, `allowed registry "" is invalid`},
+	}
+	for _, tt := range tests {
+		err := tt.guardrails.Validate()
+		if tt.want == "" {
+			assert.Nil(t, err)
+		} else if assert.NotNil(t, err) {
+			assert.Equal(t, tt.want, err.Error())
+		}
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                          "docker.io/library/nginx",
+		"nginx:1.25":                     "docker.io/library/nginx",
+		"tsuru/nginx:1.25":               "docker.io/tsuru/nginx",
+		"quay.io/team/nginx@sha256:abcd": "quay.io/team/nginx",
+		"localhost:5000/nginx:1.25":      "localhost:5000/nginx",
+		"localhost/nginx":                "localhost/nginx",
+	}
+	for image, want := range tests {
+		assert.Equal(t, want, imageRepository(image), image)
+	}
+}
+
+func TestImageAllowed(t *testing.T) {
+	registries := []string{"docker.io/library", "quay.io/team/"}
+	assert.True(t, imageAllowed("nginx:1.25", registries))
+	assert.False(t, imageAllowed("tsuru/nginx", registries))
+	assert.True(t, imageAllowed("quay.io/team/nginx", registries))
+	assert.False(t, imageAllowed("quay.io/teams/nginx", registries))
+	assert.False(t, imageAllowed("evil.io/docker.io/library/nginx", registries))
+}
+
+func TestGuardrailViolations(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	guardrails := Guardrails{
+		MaxReplicas:       3,
+		MaxRequests:       corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		AllowedRegistries: []string{"docker.io"},
+	}
+	tests := []struct {
+		name   string
+		modify func(n *v1alpha1.Nginx)
+		want   []string
+	}{
+		{
+			name:   "within guardrails",
+			modify: func(n *v1alpha1.Nginx) {},
+		},
+		{
+			name: "replicas",
+			modify: func(n *v1alpha1.Nginx) {
+				n.Spec.Replicas = int32Ptr(4)
+			},
+			want: []string{"spec.replicas 4 is above the maximum of 3"},
+		},
+		{
+			name: "daemonset replicas",
+			modify: func(n *v1alpha1.Nginx) {
+				n.Spec.WorkloadKind = v1alpha1.WorkloadKindDaemonSet
+				n.Spec.Replicas = int32Ptr(4)
+			},
+		},
+		{
+			name: "requests",
+			modify: func(n *v1alpha1.Nginx) {
+				n.Spec.PodTemplate.Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}
+				n.Spec.PodTemplate.Containers = []corev1.Container{{
+					Name:      "sidecar",
+					Image:     "busybox",
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1500m")}},
+				}}
+			},
+			want: []string{
+				`container "nginx" requests cpu 2, above the maximum of 1`,
+				`container "sidecar" requests cpu 1500m, above the maximum of 1`,
+			},
+		},
+		{
+			name: "vertical autoscaling",
+			modify: func(n *v1alpha1.Nginx) {
+				n.Spec.Autoscaling = &v1alpha1.NginxAutoscaling{Vertical: &v1alpha1.NginxVerticalAutoscaling{UpdateMode: v1alpha1.VerticalUpdateModeAuto}}
+			},
+			want: []string{"spec.autoscaling.vertical.maxAllowed must keep cpu within 1"},
+		},
+		{
+			name: "images",
+			modify: func(n *v1alpha1.Nginx) {
+				n.Spec.Image = "quay.io/nginx/nginx:1.25"
+				n.Spec.WaitFor = []v1alpha1.NginxWaitFor{{TCP: "db:5432", Image: "ghcr.io/tools"}}
+			},
+			want: []string{
+				`image "ghcr.io/tools" of container "wait-for-0" is not from an allowed registry (docker.io)`,
+				`image "quay.io/nginx/nginx:1.25" of container "nginx" is not from an allowed registry (docker.io)`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			tt.modify(&nginx)
+			assert.Equal(t, tt.want, GuardrailViolations(&nginx, guardrails))
+		})
+	}
+	assert.Nil(t, GuardrailViolations(&v1alpha1.Nginx{}, Guardrails{Mode: GuardrailModeReject}))
+}
+
+func TestClampToGuardrails(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	guardrails := Guardrails{
+		MaxReplicas: 3,
+		MaxRequests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+		Mode: GuardrailModeClamp,
+	}
+	spec := &v1alpha1.NginxSpec{
+		Replicas: int32Ptr(5),
+		PodTemplate: v1alpha1.NginxPodTemplateSpec{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			},
+			InitContainers: []corev1.Container{{
+				Name:      "init",
+				Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")}},
+			}},
+		},
+		Autoscaling: &v1alpha1.NginxAutoscaling{Vertical: &v1alpha1.NginxVerticalAutoscaling{
+			UpdateMode: v1alpha1.VerticalUpdateModeInitial,
+			MaxAllowed: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+		}},
+	}
+	orig := spec.DeepCopy()
+
+	out, clamped := ClampToGuardrails(spec, guardrails)
+	assert.Equal(t, orig, spec)
+	assert.Equal(t, []string{
+		"spec.replicas from 5 to 3",
+		"spec.podTemplate.resources.requests.cpu from 2 to 1",
+		"spec.podTemplate.initContainers[0].resources.requests.memory from 2Gi to 1Gi",
+		"spec.autoscaling.vertical.maxAllowed.memory to 1Gi",
+	}, clamped)
+	assert.Equal(t, int32(3), *out.Replicas)
+	assert.Equal(t, "1", out.PodTemplate.Resources.Requests.Cpu().String())
+	assert.Equal(t, "512Mi", out.PodTemplate.Resources.Requests.Memory().String())
+	assert.Equal(t, "4", out.PodTemplate.Resources.Limits.Cpu().String())
+	assert.Equal(t, "1Gi", out.PodTemplate.InitContainers[0].Resources.Requests.Memory().String())
+	assert.Equal(t, "500m", out.Autoscaling.Vertical.MaxAllowed.Cpu().String())
+	assert.Equal(t, "1Gi", out.Autoscaling.Vertical.MaxAllowed.Memory().String())
+
+	out, clamped = ClampToGuardrails(out, guardrails)
+	assert.Nil(t, clamped)
+	assert.Nil(t, GuardrailViolations(&v1alpha1.Nginx{Spec: *out}, guardrails))
+}
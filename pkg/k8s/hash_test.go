@@ -0,0 +1,21 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecHash(t *testing.T) {
+	nginx := baseNginx()
+	h1, err := SpecHash(nginx.Spec)
+	assert.Nil(t, err)
+	h2, err := SpecHash(nginx.Spec)
+	assert.Nil(t, err)
+	assert.Equal(t, h1, h2)
+
+	nginx.Spec.Image = "nginx:1.14"
+	h3, err := SpecHash(nginx.Spec)
+	assert.Nil(t, err)
+	assert.NotEqual(t, h1, h3)
+}
@@ -0,0 +1,34 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewHeadlessService assembles the headless service of the Nginx, resolving
+// to the address of each pod. It returns nil if it was not requested. The
+// metrics port is left out, so the pods are not scraped through both
+// services, and the type, session affinity and load balancer annotations of
+// the service do not apply to it.
+func NewHeadlessService(n *v1alpha1.Nginx) *corev1.Service {
+	if n.Spec.Service == nil || !n.Spec.Service.Headless {
+		return nil
+	}
+	service := NewService(n)
+	service.Name = n.Name + "-headless"
+	service.Annotations = nil
+	setCustomMetadata(&n.Spec, service)
+	service.Spec.Type = corev1.ServiceTypeClusterIP
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.SessionAffinity = ""
+	service.Spec.SessionAffinityConfig = nil
+	var ports []corev1.ServicePort
+	for _, p := range service.Spec.Ports {
+		if p.Name != metricsPortName && p.Name != upstreamMetricsPortName {
+			ports = append(ports, p)
+		}
+	}
+	service.Spec.Ports = ports
+	return service
+}
@@ -0,0 +1,27 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewHeadlessService(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewHeadlessService(&nginx))
+
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{Headless: true}
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{}
+	service := NewHeadlessService(&nginx)
+	main := NewService(&nginx)
+	assert.Equal(t, "my-nginx-headless", service.Name)
+	assert.Equal(t, "None", service.Spec.ClusterIP)
+	assert.Equal(t, corev1.ServiceTypeClusterIP, service.Spec.Type)
+	assert.Equal(t, main.Spec.Selector, service.Spec.Selector)
+	assert.Equal(t, main.Labels, service.Labels)
+	assert.Equal(t, main.OwnerReferences, service.OwnerReferences)
+	assert.Equal(t, main.Spec.Ports[:1], service.Spec.Ports)
+	assert.Equal(t, "", main.Spec.ClusterIP)
+}
@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	"bytes"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+)
+
+// Pod annotation holding the rendered http context directives
+const httpConfigAnnotation = "nginx.tsuru.io/http-conf"
+
+// setupHTTPConfig renders the directives the locations depend on, like the
+// cache and connection limit zones, the overload limits and the access log
+// format into /etc/nginx-operator/http.conf, which must be included in the
+// http context. The spec must have its default values already set.
+func setupHTTPConfig(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if conf := renderHTTPConfig(spec); conf != "" {
+		addOperatorConfig(dep, httpConfigAnnotation, "http.conf", conf)
+	}
+}
+
+func renderHTTPConfig(spec *v1alpha1.NginxSpec) string {
+	var buf bytes.Buffer
+	renderCacheZones(&buf, spec)
+	renderConnectionZones(&buf, spec.Locations)
+	renderOverloadLimits(&buf, spec.OverloadProtection)
+	renderLogFormat(&buf, spec.Logging)
+	renderUpstreamMetricsLogFormat(&buf, spec)
+	return buf.String()
+}
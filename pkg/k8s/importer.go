@@ -0,0 +1,289 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// HTTPProxyAPIVersion is the api version of the Contour HTTPProxy resource
+	HTTPProxyAPIVersion = "projectcontour.io/v1"
+
+	// HTTPProxyKind is the kind of the Contour HTTPProxy resource
+	HTTPProxyKind = "HTTPProxy"
+
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+)
+
+// ServicePortResolver returns the number of a named port of a service in the
+// namespace of the imported object
+type ServicePortResolver func(service, port string) (int32, error)
+
+// importedIngressOptions are the ingress-nginx annotations converted into
+// options of the imported locations, with the suffix added to their values
+var importedIngressOptions = map[string]struct{ directive, suffix string }{
+	"nginx.ingress.kubernetes.io/proxy-body-size":       {"client_max_body_size", ""},
+	"nginx.ingress.kubernetes.io/proxy-connect-timeout": {"proxy_connect_timeout", "s"},
+	"nginx.ingress.kubernetes.io/proxy-read-timeout":    {"proxy_read_timeout", "s"},
+	"nginx.ingress.kubernetes.io/proxy-send-timeout":    {"proxy_send_timeout", "s"},
+}
+
+// ImportIngress converts an Ingress into an Nginx routing the same paths to
+// the same services through spec.locations. The hosts, class and TLS
+// certificate of the Ingress are kept in spec.ingress, so the ingress
+// controller routes them to the nginx. Features that cannot be converted are
+// returned, the Nginx serves the same locations for every host. Named service
+// ports are looked up with resolve, they are reported if it is nil.
+func ImportIngress(ing *extensionsv1beta1.Ingress, resolve ServicePortResolver) (*v1alpha1.Nginx, []string) {
+	n := importedNginx(ing.ObjectMeta)
+	im := &importer{resolve: resolve, paths: make(map[string]string)}
+	spec := &n.Spec
+	spec.Ingress = &v1alpha1.NginxIngress{IngressClassName: ing.Annotations[ingressClassAnnotation]}
+
+	var options map[string]string
+	for _, k := range sortedKeys(ing.Annotations) {
+		if o, ok := importedIngressOptions[k]; ok {
+			if options == nil {
+				options = make(map[string]string)
+			}
+			options[o.directive] = ing.Annotations[k] + o.suffix
+			continue
+		}
+		if strings.Contains(k, "ingress.kubernetes.io/") {
+			im.unsupported("annotation %s", k)
+		}
+	}
+
+	hosts := make(map[string]bool)
+	for i, rule := range ing.Spec.Rules {
+		if rule.Host != "" && !hosts[rule.Host] {
+			hosts[rule.Host] = true
+			spec.Ingress.Hosts = append(spec.Ingress.Hosts, rule.Host)
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for j, p := range rule.HTTP.Paths {
+			field := fmt.Sprintf("spec.rules[%d].http.paths[%d]", i, j)
+			im.addLocation(spec, field, rule.Host, p.Path, p.Backend.ServiceName, p.Backend.ServicePort, options)
+		}
+	}
+	if b := ing.Spec.Backend; b != nil {
+		im.addLocation(spec, "spec.backend", "", "/", b.ServiceName, b.ServicePort, options)
+	}
+	if len(spec.Ingress.Hosts) > 1 && len(spec.Locations) > 0 {
+		im.unsupported("routing by host, the locations of hosts %s are served for all of them", strings.Join(spec.Ingress.Hosts, ", "))
+	}
+
+	for i, tls := range ing.Spec.TLS {
+		if i > 0 {
+			im.unsupported("spec.tls[%d], only the certificate of secret %s is used", i, spec.Ingress.TLS.SecretName)
+			continue
+		}
+		spec.Ingress.TLS = &v1alpha1.NginxIngressTLS{SecretName: tls.SecretName}
+		for _, h := range tls.Hosts {
+			if !hosts[h] {
+				im.unsupported("spec.tls[%d] host %s without rules", i, h)
+			}
+		}
+	}
+	return n, im.errs
+}
+
+// ImportHTTPProxy converts a Contour HTTPProxy into an Nginx routing the same
+// path prefixes to the same services through spec.locations. The fqdn, class
+// and TLS certificate of its virtual host are kept in spec.ingress, so an
+// ingress controller routes them to the nginx. Features that cannot be
+// converted, like header conditions, weighted services and includes, are
+// returned. Named service ports are looked up with resolve, they are
+// reported if it is nil.
+func ImportHTTPProxy(proxy *unstructured.Unstructured, resolve ServicePortResolver) (*v1alpha1.Nginx, []string) {
+	n := importedNginx(metav1.ObjectMeta{
+		Name:      proxy.GetName(),
+		Namespace: proxy.GetNamespace(),
+		Labels:    proxy.GetLabels(),
+	})
+	im := &importer{resolve: resolve, paths: make(map[string]string)}
+	spec := &n.Spec
+	obj := proxy.Object
+
+	class, _ := unstructured.NestedString(obj, "spec", "ingressClassName")
+	if class == "" {
+		class = proxy.GetAnnotations()[ingressClassAnnotation]
+	}
+	spec.Ingress = &v1alpha1.NginxIngress{IngressClassName: class}
+	if fqdn, _ := unstructured.NestedString(obj, "spec", "virtualhost", "fqdn"); fqdn != "" {
+		spec.Ingress.Hosts = []string{fqdn}
+	}
+	if secret, _ := unstructured.NestedString(obj, "spec", "virtualhost", "tls", "secretName"); secret != "" {
+		spec.Ingress.TLS = &v1alpha1.NginxIngressTLS{SecretName: secret}
+	}
+	virtualHost, _ := unstructured.NestedMap(obj, "spec", "virtualhost")
+	for _, k := range sortedInterfaceKeys(virtualHost) {
+		if k != "fqdn" && k != "tls" {
+			im.unsupported("spec.virtualhost.%s", k)
+		}
+	}
+	for _, k := range []string{"includes", "tcpproxy"} {
+		if _, ok := unstructured.NestedFieldCopy(obj, "spec", k); ok {
+			im.unsupported("spec.%s", k)
+		}
+	}
+
+	routes, _ := unstructured.NestedSlice(obj, "spec", "routes")
+	for i, r := range routes {
+		route, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field := fmt.Sprintf("spec.routes[%d]", i)
+		path := "/"
+		conditions, _ := unstructured.NestedSlice(route, "conditions")
+		for j, c := range conditions {
+			condition, _ := c.(map[string]interface{})
+			for _, k := range sortedInterfaceKeys(condition) {
+				if prefix, ok := condition[k].(string); ok && k == "prefix" {
+					path = prefix
+				} else {
+					im.unsupported("%s.conditions[%d].%s", field, j, k)
+				}
+			}
+		}
+		var options map[string]string
+		if timeout, _ := unstructured.NestedString(route, "timeoutPolicy", "response"); timeout != "" {
+			options = map[string]string{"proxy_read_timeout": timeout}
+		}
+		for _, k := range sortedInterfaceKeys(route) {
+			switch k {
+			case "conditions", "services":
+			case "timeoutPolicy":
+				if policy, _ := route[k].(map[string]interface{}); len(policy) > 1 || policy["response"] == nil {
+					im.unsupported("%s.timeoutPolicy other than response", field)
+				}
+			default:
+				im.unsupported("%s.%s", field, k)
+			}
+		}
+		services, _ := unstructured.NestedSlice(route, "services")
+		if len(services) == 0 {
+			im.unsupported("%s without services", field)
+			continue
+		}
+		if len(services) > 1 {
+			im.unsupported("%s with several services, only the first one is used", field)
+		}
+		service, _ := services[0].(map[string]interface{})
+		name, _ := unstructured.NestedString(service, "name")
+		port, _ := unstructured.NestedInt64(service, "port")
+		if port == 0 {
+			// Numbers decoded from JSON are float64
+			f, _ := unstructured.NestedFloat64(service, "port")
+			port = int64(f)
+		}
+		im.addLocation(spec, field+".services[0]", "", path, name, intstr.FromInt(int(port)), options)
+	}
+	return n, im.errs
+}
+
+// importer accumulates the locations and the unsupported features of an
+// imported object
+type importer struct {
+	resolve ServicePortResolver
+	// paths maps the imported paths to the field that set them
+	paths map[string]string
+	errs  []string
+}
+
+func (im *importer) unsupported(format string, args ...interface{}) {
+	im.errs = append(im.errs, fmt.Sprintf(format, args...))
+}
+
+// addLocation adds a prefix location proxying path to the service port.
+// Paths already imported from the rules of other hosts are reported.
+func (im *importer) addLocation(spec *v1alpha1.NginxSpec, field, host, path, service string, port intstr.IntOrString, options map[string]string) {
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, " \t\n{};") {
+		im.unsupported("%s path %q", field, path)
+		return
+	}
+	if strings.ContainsAny(path, "*()[]$^+?|\\") {
+		im.unsupported("%s regular expression path %q, imported as a prefix", field, path)
+	}
+	if other, ok := im.paths[path]; ok {
+		if host != "" {
+			im.unsupported("%s for host %s, path %s is already routed by %s", field, host, path, other)
+		} else {
+			im.unsupported("%s, path %s is already routed by %s", field, path, other)
+		}
+		return
+	}
+	number := int32(port.IntValue())
+	if port.Type == intstr.String {
+		if im.resolve == nil {
+			im.unsupported("%s named port %s of service %s", field, port.StrVal, service)
+			return
+		}
+		var err error
+		if number, err = im.resolve(service, port.StrVal); err != nil {
+			im.unsupported("%s port %s of service %s: %v", field, port.StrVal, service, err)
+			return
+		}
+	}
+	if number < 1 || number > 65535 {
+		im.unsupported("%s port %d of service %s", field, number, service)
+		return
+	}
+	im.paths[path] = field
+	l := v1alpha1.NginxLocation{
+		Path:  path,
+		Proxy: &v1alpha1.ProxyAction{Service: service, Port: number},
+	}
+	if len(options) > 0 {
+		l.Options = make(map[string]string, len(options))
+		for k, v := range options {
+			l.Options[k] = v
+		}
+	}
+	spec.Locations = append(spec.Locations, l)
+}
+
+// importedNginx returns the Nginx replacing the object with the given
+// metadata, keeping its name, namespace and labels
+func importedNginx(meta metav1.ObjectMeta) *v1alpha1.Nginx {
+	n := &v1alpha1.Nginx{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "Nginx",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      meta.Name,
+			Namespace: meta.Namespace,
+		},
+	}
+	if len(meta.Labels) > 0 {
+		n.Labels = make(map[string]string, len(meta.Labels))
+		for k, v := range meta.Labels {
+			n.Labels[k] = v
+		}
+	}
+	return n
+}
+
+func sortedInterfaceKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,255 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func testResolver(service, port string) (int32, error) {
+	if service == "web" && port == "http" {
+		return 8080, nil
+	}
+	return 0, errors.New("not found")
+}
+
+func TestImportIngress(t *testing.T) {
+	backend := func(service string, port intstr.IntOrString) extensionsv1beta1.IngressBackend {
+		return extensionsv1beta1.IngressBackend{ServiceName: service, ServicePort: port}
+	}
+	rule := func(host string, paths ...extensionsv1beta1.HTTPIngressPath) extensionsv1beta1.IngressRule {
+		return extensionsv1beta1.IngressRule{
+			Host: host,
+			IngressRuleValue: extensionsv1beta1.IngressRuleValue{
+				HTTP: &extensionsv1beta1.HTTPIngressRuleValue{Paths: paths},
+			},
+		}
+	}
+	tests := []struct {
+		name            string
+		ingress         extensionsv1beta1.Ingress
+		resolve         ServicePortResolver
+		wantSpec        v1alpha1.NginxSpec
+		wantUnsupported []string
+	}{
+		{
+			name: "paths",
+			ingress: extensionsv1beta1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"kubernetes.io/ingress.class":                    "public",
+						"nginx.ingress.kubernetes.io/proxy-body-size":    "10m",
+						"nginx.ingress.kubernetes.io/proxy-read-timeout": "30",
+					},
+				},
+				Spec: extensionsv1beta1.IngressSpec{
+					TLS: []extensionsv1beta1.IngressTLS{{Hosts: []string{"example.com"}, SecretName: "example-tls"}},
+					Rules: []extensionsv1beta1.IngressRule{
+						rule("example.com",
+							extensionsv1beta1.HTTPIngressPath{Path: "/api", Backend: backend("api", intstr.FromInt(80))},
+							extensionsv1beta1.HTTPIngressPath{Backend: backend("web", intstr.FromString("http"))},
+						),
+					},
+				},
+			},
+			resolve: testResolver,
+			wantSpec: v1alpha1.NginxSpec{
+				Ingress: &v1alpha1.NginxIngress{
+					Hosts:            []string{"example.com"},
+					IngressClassName: "public",
+					TLS:              &v1alpha1.NginxIngressTLS{SecretName: "example-tls"},
+				},
+				Locations: []v1alpha1.NginxLocation{
+					{
+						Path:    "/api",
+						Proxy:   &v1alpha1.ProxyAction{Service: "api", Port: 80},
+						Options: map[string]string{"client_max_body_size": "10m", "proxy_read_timeout": "30s"},
+					},
+					{
+						Path:    "/",
+						Proxy:   &v1alpha1.ProxyAction{Service: "web", Port: 8080},
+						Options: map[string]string{"client_max_body_size": "10m", "proxy_read_timeout": "30s"},
+					},
+				},
+			},
+		},
+		{
+			name: "default-backend",
+			ingress: extensionsv1beta1.Ingress{
+				Spec: extensionsv1beta1.IngressSpec{
+					Backend: &extensionsv1beta1.IngressBackend{ServiceName: "web", ServicePort: intstr.FromInt(80)},
+				},
+			},
+			wantSpec: v1alpha1.NginxSpec{
+				Ingress: &v1alpha1.NginxIngress{},
+				Locations: []v1alpha1.NginxLocation{
+					{Path: "/", Proxy: &v1alpha1.ProxyAction{Service: "web", Port: 80}},
+				},
+			},
+		},
+		{
+			name: "unsupported",
+			ingress: extensionsv1beta1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"nginx.ingress.kubernetes.io/rewrite-target": "/"},
+				},
+				Spec: extensionsv1beta1.IngressSpec{
+					Backend: &extensionsv1beta1.IngressBackend{ServiceName: "fallback", ServicePort: intstr.FromInt(80)},
+					TLS: []extensionsv1beta1.IngressTLS{
+						{Hosts: []string{"a.example.com"}, SecretName: "a-tls"},
+						{Hosts: []string{"b.example.com"}, SecretName: "b-tls"},
+					},
+					Rules: []extensionsv1beta1.IngressRule{
+						rule("a.example.com",
+							extensionsv1beta1.HTTPIngressPath{Path: "/", Backend: backend("a", intstr.FromInt(80))},
+							extensionsv1beta1.HTTPIngressPath{Path: "/v1/(.*)", Backend: backend("a", intstr.FromInt(80))},
+						),
+						rule("b.example.com",
+							extensionsv1beta1.HTTPIngressPath{Path: "/", Backend: backend("b", intstr.FromInt(80))},
+							extensionsv1beta1.HTTPIngressPath{Path: "/named", Backend: backend("b", intstr.FromString("http"))},
+						),
+					},
+				},
+			},
+			wantSpec: v1alpha1.NginxSpec{
+				Ingress: &v1alpha1.NginxIngress{
+					Hosts: []string{"a.example.com", "b.example.com"},
+					TLS:   &v1alpha1.NginxIngressTLS{SecretName: "a-tls"},
+				},
+				Locations: []v1alpha1.NginxLocation{
+					{Path: "/", Proxy: &v1alpha1.ProxyAction{Service: "a", Port: 80}},
+					{Path: "/v1/(.*)", Proxy: &v1alpha1.ProxyAction{Service: "a", Port: 80}},
+				},
+			},
+			wantUnsupported: []string{
+				"annotation nginx.ingress.kubernetes.io/rewrite-target",
+				`spec.rules[0].http.paths[1] regular expression path "/v1/(.*)", imported as a prefix`,
+				"spec.rules[1].http.paths[0] for host b.example.com, path / is already routed by spec.rules[0].http.paths[0]",
+				"spec.rules[1].http.paths[1] named port http of service b",
+				"spec.backend, path / is already routed by spec.rules[0].http.paths[0]",
+				"routing by host, the locations of hosts a.example.com, b.example.com are served for all of them",
+				"spec.tls[1], only the certificate of secret a-tls is used",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.ingress.Name = "my-app"
+			tt.ingress.Namespace = "apps"
+			n, unsupported := ImportIngress(&tt.ingress, tt.resolve)
+			assert.Equal(t, "Nginx", n.Kind)
+			assert.Equal(t, "nginx.tsuru.io/v1alpha1", n.APIVersion)
+			assert.Equal(t, "my-app", n.Name)
+			assert.Equal(t, "apps", n.Namespace)
+			assert.Equal(t, tt.wantSpec, n.Spec)
+			assert.Equal(t, tt.wantUnsupported, unsupported)
+		})
+	}
+}
+
+func TestImportHTTPProxy(t *testing.T) {
+	tests := []struct {
+		name            string
+		spec            map[string]interface{}
+		wantSpec        v1alpha1.NginxSpec
+		wantUnsupported []string
+	}{
+		{
+			name: "routes",
+			spec: map[string]interface{}{
+				"ingressClassName": "contour",
+				"virtualhost": map[string]interface{}{
+					"fqdn": "example.com",
+					"tls":  map[string]interface{}{"secretName": "example-tls"},
+				},
+				"routes": []interface{}{
+					map[string]interface{}{
+						"conditions":    []interface{}{map[string]interface{}{"prefix": "/api"}},
+						"services":      []interface{}{map[string]interface{}{"name": "api", "port": float64(80)}},
+						"timeoutPolicy": map[string]interface{}{"response": "30s"},
+					},
+					map[string]interface{}{
+						"services": []interface{}{map[string]interface{}{"name": "web", "port": int64(8080)}},
+					},
+				},
+			},
+			wantSpec: v1alpha1.NginxSpec{
+				Ingress: &v1alpha1.NginxIngress{
+					Hosts:            []string{"example.com"},
+					IngressClassName: "contour",
+					TLS:              &v1alpha1.NginxIngressTLS{SecretName: "example-tls"},
+				},
+				Locations: []v1alpha1.NginxLocation{
+					{
+						Path:    "/api",
+						Proxy:   &v1alpha1.ProxyAction{Service: "api", Port: 80},
+						Options: map[string]string{"proxy_read_timeout": "30s"},
+					},
+					{Path: "/", Proxy: &v1alpha1.ProxyAction{Service: "web", Port: 8080}},
+				},
+			},
+		},
+		{
+			name: "unsupported",
+			spec: map[string]interface{}{
+				"virtualhost": map[string]interface{}{
+					"fqdn":            "example.com",
+					"corsPolicy":      map[string]interface{}{},
+					"rateLimitPolicy": map[string]interface{}{},
+				},
+				"includes": []interface{}{},
+				"routes": []interface{}{
+					map[string]interface{}{
+						"conditions": []interface{}{
+							map[string]interface{}{"prefix": "/api"},
+							map[string]interface{}{"header": map[string]interface{}{"name": "x-canary"}},
+						},
+						"services": []interface{}{
+							map[string]interface{}{"name": "api", "port": int64(80), "weight": int64(90)},
+							map[string]interface{}{"name": "api-canary", "port": int64(80), "weight": int64(10)},
+						},
+						"retryPolicy": map[string]interface{}{"count": int64(3)},
+					},
+					map[string]interface{}{
+						"conditions": []interface{}{map[string]interface{}{"prefix": "/empty"}},
+					},
+				},
+			},
+			wantSpec: v1alpha1.NginxSpec{
+				Ingress: &v1alpha1.NginxIngress{Hosts: []string{"example.com"}},
+				Locations: []v1alpha1.NginxLocation{
+					{Path: "/api", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 80}},
+				},
+			},
+			wantUnsupported: []string{
+				"spec.virtualhost.corsPolicy",
+				"spec.virtualhost.rateLimitPolicy",
+				"spec.includes",
+				"spec.routes[0].conditions[1].header",
+				"spec.routes[0].retryPolicy",
+				"spec.routes[0] with several services, only the first one is used",
+				"spec.routes[1] without services",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &unstructured.Unstructured{Object: map[string]interface{}{"spec": tt.spec}}
+			proxy.SetAPIVersion(HTTPProxyAPIVersion)
+			proxy.SetKind(HTTPProxyKind)
+			proxy.SetName("my-app")
+			proxy.SetNamespace("apps")
+			n, unsupported := ImportHTTPProxy(proxy, nil)
+			assert.Equal(t, "my-app", n.Name)
+			assert.Equal(t, "apps", n.Namespace)
+			assert.Equal(t, tt.wantSpec, n.Spec)
+			assert.Equal(t, tt.wantUnsupported, unsupported)
+		})
+	}
+}
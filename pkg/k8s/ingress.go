@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// IngressClassAnnotation selects the ingress controller of an Ingress
+const IngressClassAnnotation = "kubernetes.io/ingress.class"
+
+// NewIngress assembles the Ingress routing to the Nginx service. It returns
+// nil if no ingress was requested.
+func NewIngress(n *v1alpha1.Nginx) *extv1beta1.Ingress {
+	if n.Spec.Ingress == nil {
+		return nil
+	}
+	spec := n.Spec.WithDefaults().Ingress
+
+	path := extv1beta1.HTTPIngressPath{
+		Path: spec.Path,
+		Backend: extv1beta1.IngressBackend{
+			ServiceName: NewService(n).Name,
+			ServicePort: intstr.FromString(httpPortName(n.Spec.WithDefaults())),
+		},
+	}
+	hosts := spec.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	var rules []extv1beta1.IngressRule
+	for _, host := range hosts {
+		rules = append(rules, extv1beta1.IngressRule{
+			Host: host,
+			IngressRuleValue: extv1beta1.IngressRuleValue{
+				HTTP: &extv1beta1.HTTPIngressRuleValue{
+					Paths: []extv1beta1.HTTPIngressPath{path},
+				},
+			},
+		})
+	}
+
+	ingress := &extv1beta1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: "extensions/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n.Name + "-ingress",
+			Namespace: n.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+			Labels: LabelsForNginx(n.Name),
+		},
+		Spec: extv1beta1.IngressSpec{
+			Rules: rules,
+		},
+	}
+	if spec.IngressClassName != "" {
+		ingress.Annotations = map[string]string{IngressClassAnnotation: spec.IngressClassName}
+	}
+	if spec.TLS != nil {
+		ingress.Spec.TLS = []extv1beta1.IngressTLS{
+			{
+				Hosts:      spec.Hosts,
+				SecretName: spec.TLS.SecretName,
+			},
+		}
+	}
+	setupDNS(&n.Spec, ingress)
+	setCustomMetadata(&n.Spec, ingress)
+	return ingress
+}
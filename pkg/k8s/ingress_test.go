@@ -0,0 +1,71 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNewIngress(t *testing.T) {
+	backend := extv1beta1.IngressBackend{
+		ServiceName: "my-nginx-service",
+		ServicePort: intstr.FromString("http"),
+	}
+	rule := func(host, path string) extv1beta1.IngressRule {
+		return extv1beta1.IngressRule{
+			Host: host,
+			IngressRuleValue: extv1beta1.IngressRuleValue{
+				HTTP: &extv1beta1.HTTPIngressRuleValue{
+					Paths: []extv1beta1.HTTPIngressPath{{Path: path, Backend: backend}},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name            string
+		ingress         *v1alpha1.NginxIngress
+		wantSpec        extv1beta1.IngressSpec
+		wantAnnotations map[string]string
+	}{
+		{
+			name:     "all-hosts",
+			ingress:  &v1alpha1.NginxIngress{},
+			wantSpec: extv1beta1.IngressSpec{Rules: []extv1beta1.IngressRule{rule("", "/")}},
+		},
+		{
+			name: "hosts-with-tls-and-class",
+			ingress: &v1alpha1.NginxIngress{
+				Hosts:            []string{"a.example.com", "b.example.com"},
+				Path:             "/app",
+				IngressClassName: "public",
+				TLS:              &v1alpha1.NginxIngressTLS{SecretName: "example-cert"},
+			},
+			wantSpec: extv1beta1.IngressSpec{
+				Rules: []extv1beta1.IngressRule{rule("a.example.com", "/app"), rule("b.example.com", "/app")},
+				TLS: []extv1beta1.IngressTLS{
+					{Hosts: []string{"a.example.com", "b.example.com"}, SecretName: "example-cert"},
+				},
+			},
+			wantAnnotations: map[string]string{"kubernetes.io/ingress.class": "public"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.Ingress = tt.ingress
+			ingress := NewIngress(&nginx)
+			assert.Equal(t, "my-nginx-ingress", ingress.Name)
+			assert.Equal(t, "default", ingress.Namespace)
+			assert.Equal(t, LabelsForNginx("my-nginx"), ingress.Labels)
+			assert.Len(t, ingress.OwnerReferences, 1)
+			assert.Equal(t, tt.wantAnnotations, ingress.Annotations)
+			assert.Equal(t, tt.wantSpec, ingress.Spec)
+		})
+	}
+
+	nginx := baseNginx()
+	assert.Nil(t, NewIngress(&nginx))
+}
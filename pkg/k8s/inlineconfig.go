@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// InlineConfigHashPodAnnotation is the pod template annotation holding the
+// hash of the inline config. Changing it replaces the pods, so nginx loads
+// the new config.
+const InlineConfigHashPodAnnotation = "nginx.tsuru.io/inline-config-hash"
+
+// InlineConfigName returns the name of the ConfigMap holding the inline
+// config of the nginx
+func InlineConfigName(n *v1alpha1.Nginx) string {
+	return n.Name + "-inline-config"
+}
+
+// InlineConfigHash returns the hash identifying the content of an inline
+// config
+func InlineConfigHash(config string) string {
+	return CertificateRevision([]byte(config))
+}
+
+// inlineConfig returns whether the config of the spec is inline
+func inlineConfig(spec *v1alpha1.NginxSpec) bool {
+	return spec.Config != nil && spec.Config.Kind == v1alpha1.ConfigKindInline
+}
+
+// NewInlineConfigMap assembles the ConfigMap holding the inline config of
+// the Nginx, mounted like the config of a ConfigMap, since configs kept in
+// pod annotations are limited in size. It returns nil if the config is not
+// inline.
+func NewInlineConfigMap(n *v1alpha1.Nginx) *corev1.ConfigMap {
+	if !inlineConfig(&n.Spec) {
+		return nil
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      InlineConfigName(n),
+			Namespace: n.Namespace,
+			Labels:    LabelsForNginx(n.Name),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+		},
+		Data: map[string]string{
+			"nginx.conf": n.Spec.Config.Value,
+		},
+	}
+	setCustomMetadata(&n.Spec, cm)
+	return cm
+}
+
+// setupInlineConfigHash sets the hash of the inline config in the pod
+// template, so pods are replaced when it changes. Configs reloaded in place
+// leave the pods running. The spec must have its default values already set.
+func setupInlineConfigHash(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if !inlineConfig(spec) {
+		return
+	}
+	if spec.ConfigReload == v1alpha1.ConfigReloadReload && configDirectoryMounted(spec) {
+		return
+	}
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = make(map[string]string)
+	}
+	dep.Spec.Template.Annotations[InlineConfigHashPodAnnotation] = InlineConfigHash(spec.Config.Value)
+}
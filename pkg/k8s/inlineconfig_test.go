@@ -0,0 +1,41 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestNewInlineConfigMap(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewInlineConfigMap(&nginx))
+
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "my-config"}
+	assert.Nil(t, NewInlineConfigMap(&nginx))
+
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindInline, Value: "events {}"}
+	cm := NewInlineConfigMap(&nginx)
+	assert.Equal(t, "my-nginx-inline-config", cm.Name)
+	assert.Equal(t, "default", cm.Namespace)
+	assert.Equal(t, LabelsForNginx("my-nginx"), cm.Labels)
+	assert.Len(t, cm.OwnerReferences, 1)
+	assert.Equal(t, map[string]string{"nginx.conf": "events {}"}, cm.Data)
+}
+
+func TestInlineConfigHash(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindInline, Value: "events {}"}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	hash := InlineConfigHash("events {}")
+	assert.NotEqual(t, hash, InlineConfigHash("events { worker_connections 512; }"))
+	assert.Equal(t, hash, dep.Spec.Template.Annotations[InlineConfigHashPodAnnotation])
+	assert.True(t, PodRestartRequested(dep.Spec.Template.Annotations, nil))
+
+	nginx.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, InlineConfigHashPodAnnotation)
+	assert.Equal(t, []string{"/etc/nginx/..data"}, reloadLinks(nginx.Spec.WithDefaults()))
+}
@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ReadyPods returns the number of ready pods
+func ReadyPods(pods []corev1.Pod) int32 {
+	var ready int32
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil && CanaryPodReady(&pods[i]) {
+			ready++
+		}
+	}
+	return ready
+}
+
+// Endpoints returns the addresses where the nginx is reachable: the ingress
+// hosts, the load balancer addresses and the cluster IPs of its services
+func Endpoints(n *v1alpha1.Nginx, services []corev1.Service) []string {
+	var endpoints []string
+	if ing := n.Spec.Ingress; ing != nil {
+		scheme := "http"
+		if ing.TLS != nil {
+			scheme = "https"
+		}
+		path := ing.Path
+		if path == "" {
+			path = "/"
+		}
+		for _, host := range ing.Hosts {
+			endpoints = append(endpoints, fmt.Sprintf("%s://%s%s", scheme, host, path))
+		}
+	}
+	for _, svc := range services {
+		var hosts []string
+		for _, lb := range svc.Status.LoadBalancer.Ingress {
+			if lb.Hostname != "" {
+				hosts = append(hosts, lb.Hostname)
+			} else if lb.IP != "" {
+				hosts = append(hosts, lb.IP)
+			}
+		}
+		if len(hosts) == 0 && svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != corev1.ClusterIPNone {
+			hosts = append(hosts, svc.Spec.ClusterIP)
+		}
+		for _, host := range hosts {
+			for _, p := range svc.Spec.Ports {
+				endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(int(p.Port))))
+			}
+		}
+	}
+	return endpoints
+}
+
+// ForwardPort returns the port of the nginx container of the pod to forward
+// to, and the scheme it serves: the https port when the pod serves TLS, the
+// http port otherwise.
+func ForwardPort(pod *corev1.Pod) (int32, string, error) {
+	for _, c := range pod.Spec.Containers {
+		if c.Name != "nginx" || len(c.Ports) == 0 {
+			continue
+		}
+		for _, p := range c.Ports {
+			if p.Name == defaultHTTPSPortName {
+				return p.ContainerPort, "https", nil
+			}
+		}
+		// The http port comes first, whatever its app protocol name
+		return c.Ports[0].ContainerPort, "http", nil
+	}
+	return 0, "", fmt.Errorf("pod %s has no nginx container port", pod.Name)
+}
+
+// PodConfig returns where the nginx.conf of the nginx pod comes from: the
+// name of the ConfigMap holding it, including the one generated for inline
+// configs, or the config itself for pods created when inline configs were
+// kept in a pod annotation. Both are empty when the pod uses the config of
+// the image.
+func PodConfig(pod *corev1.Pod) (configMap, inline string) {
+	for _, v := range pod.Spec.Volumes {
+		if v.Name != "nginx-config" {
+			continue
+		}
+		if v.ConfigMap != nil {
+			return v.ConfigMap.Name, ""
+		}
+		if v.DownwardAPI != nil {
+			for _, item := range v.DownwardAPI.Items {
+				if item.Path != "nginx.conf" || item.FieldRef == nil {
+					continue
+				}
+				annotation := strings.TrimSuffix(strings.TrimPrefix(item.FieldRef.FieldPath, "metadata.annotations['"), "']")
+				return "", pod.Annotations[annotation]
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadyPods(t *testing.T) {
+	ready := corev1.Pod{Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}}}
+	terminating := *ready.DeepCopy()
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	assert.Equal(t, int32(0), ReadyPods(nil))
+	assert.Equal(t, int32(1), ReadyPods([]corev1.Pod{ready, terminating, {}}))
+}
+
+func TestEndpoints(t *testing.T) {
+	nginx := baseNginx()
+	services := []corev1.Service{
+		{
+			Spec: corev1.ServiceSpec{
+				ClusterIP: "10.0.0.1",
+				Ports:     []corev1.ServicePort{{Port: 80}, {Port: 443}},
+			},
+		},
+		{
+			Spec: corev1.ServiceSpec{
+				ClusterIP: "10.0.0.2",
+				Ports:     []corev1.ServicePort{{Port: 80}},
+			},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{
+				{IP: "203.0.113.10"},
+				{Hostname: "lb.example.com"},
+			}}},
+		},
+		{
+			Spec: corev1.ServiceSpec{
+				ClusterIP: corev1.ClusterIPNone,
+				Ports:     []corev1.ServicePort{{Port: 80}},
+			},
+		},
+		{
+			Spec: corev1.ServiceSpec{
+				ClusterIP: "fd00::1",
+				Ports:     []corev1.ServicePort{{Port: 80}},
+			},
+		},
+	}
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.1:443", "203.0.113.10:80", "lb.example.com:80", "[fd00::1]:80"}, Endpoints(&nginx, services))
+
+	nginx.Spec.Ingress = &v1alpha1.NginxIngress{Hosts: []string{"example.com"}, Path: "/app", TLS: &v1alpha1.NginxIngressTLS{}}
+	assert.Equal(t, []string{"https://example.com/app"}, Endpoints(&nginx, nil))
+	nginx.Spec.Ingress = nil
+	assert.Nil(t, Endpoints(&nginx, nil))
+}
+
+func TestPodConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *v1alpha1.ConfigRef
+		configMap string
+		inline    string
+	}{
+		{name: "image"},
+		{name: "config-map", config: &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindConfigMap, Name: "my-config"}, configMap: "my-config"},
+		{name: "inline", config: &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindInline, Value: "events {}"}, configMap: "my-nginx-inline-config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.Config = tt.config
+			dep, err := NewDeployment(&nginx)
+			assert.Nil(t, err)
+			pod := &corev1.Pod{ObjectMeta: dep.Spec.Template.ObjectMeta, Spec: dep.Spec.Template.Spec}
+			configMap, inline := PodConfig(pod)
+			assert.Equal(t, tt.configMap, configMap)
+			assert.Equal(t, tt.inline, inline)
+		})
+	}
+
+	t.Run("annotation-inline", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"nginx.tsuru.io/conf": "events {}"}},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name: "nginx-config",
+				VolumeSource: corev1.VolumeSource{DownwardAPI: &corev1.DownwardAPIVolumeSource{
+					Items: []corev1.DownwardAPIVolumeFile{{
+						Path:     "nginx.conf",
+						FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.annotations['nginx.tsuru.io/conf']"},
+					}},
+				}},
+			}}},
+		}
+		configMap, inline := PodConfig(pod)
+		assert.Equal(t, "", configMap)
+		assert.Equal(t, "events {}", inline)
+	})
+}
+
+func TestForwardPort(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Rootless = true
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	pod := &corev1.Pod{Spec: dep.Spec.Template.Spec}
+	port, scheme, err := ForwardPort(pod)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(8080), port)
+	assert.Equal(t, "http", scheme)
+
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "tls"}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	pod = &corev1.Pod{Spec: dep.Spec.Template.Spec}
+	port, scheme, err = ForwardPort(pod)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(8443), port)
+	assert.Equal(t, "https", scheme)
+
+	_, _, err = ForwardPort(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other"}})
+	assert.EqualError(t, err, "pod other has no nginx container port")
+}
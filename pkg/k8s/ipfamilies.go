@@ -0,0 +1,152 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// HasIPFamilies returns whether the spec sets the IP family policy or the IP
+// families of the services
+func HasIPFamilies(spec *v1alpha1.NginxSpec) bool {
+	svc := spec.Service
+	return svc != nil && (svc.IPFamilyPolicy != "" || len(svc.IPFamilies) > 0)
+}
+
+// listenFamilies returns the IP families the servers generated by the
+// operator listen on: the ones of the services, both with the
+// RequireDualStack policy, IPv4 only by default
+func listenFamilies(spec *v1alpha1.NginxSpec) (ipv4, ipv6 bool) {
+	svc := spec.Service
+	if svc == nil {
+		return true, false
+	}
+	if svc.IPFamilyPolicy == v1alpha1.IPFamilyPolicyRequireDualStack {
+		return true, true
+	}
+	if len(svc.IPFamilies) == 0 {
+		return true, false
+	}
+	for _, f := range svc.IPFamilies {
+		switch f {
+		case v1alpha1.IPv4Protocol:
+			ipv4 = true
+		case v1alpha1.IPv6Protocol:
+			ipv6 = true
+		}
+	}
+	return ipv4, ipv6
+}
+
+// servesIPv6 returns whether the servers generated by the operator listen
+// on IPv6
+func servesIPv6(spec *v1alpha1.NginxSpec) bool {
+	_, ipv6 := listenFamilies(spec)
+	return ipv6
+}
+
+// writeListen writes the listen directives of a server generated by the
+// operator on the port, one for each IP family it listens on
+func writeListen(buf *bytes.Buffer, spec *v1alpha1.NginxSpec, port int32, params string) {
+	ipv4, ipv6 := listenFamilies(spec)
+	if ipv4 {
+		fmt.Fprintf(buf, "    listen %d%s;\n", port, params)
+	}
+	if ipv6 {
+		fmt.Fprintf(buf, "    listen [::]:%d%s;\n", port, params)
+	}
+}
+
+// UnstructuredService returns the service with the IP family policy and
+// families of the spec. The Kubernetes API the operator is built against has
+// no such fields, so services setting them are written as unstructured
+// objects.
+func UnstructuredService(spec *v1alpha1.NginxSpec, service *corev1.Service) (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: obj}
+	SetIPFamilies(spec, u)
+	return u, nil
+}
+
+// SetIPFamilies sets the IP family policy and families of the spec in the
+// service, returning whether they changed. Fields unset in the spec are left
+// to the cluster, as are the secondary families it allocated beyond the
+// ones of the spec.
+func SetIPFamilies(spec *v1alpha1.NginxSpec, service *unstructured.Unstructured) bool {
+	svc := spec.Service
+	if svc == nil {
+		return false
+	}
+	changed := false
+	if svc.IPFamilyPolicy != "" {
+		current, _ := unstructured.NestedString(service.Object, "spec", "ipFamilyPolicy")
+		if current != string(svc.IPFamilyPolicy) {
+			unstructured.SetNestedField(service.Object, string(svc.IPFamilyPolicy), "spec", "ipFamilyPolicy")
+			changed = true
+		}
+	}
+	if len(svc.IPFamilies) > 0 {
+		current, _ := unstructured.NestedStringSlice(service.Object, "spec", "ipFamilies")
+		if !hasFamiliesPrefix(current, svc.IPFamilies) {
+			families := make([]string, len(svc.IPFamilies))
+			for i, f := range svc.IPFamilies {
+				families[i] = string(f)
+			}
+			unstructured.SetNestedStringSlice(service.Object, families, "spec", "ipFamilies")
+			changed = true
+		}
+	}
+	return changed
+}
+
+func hasFamiliesPrefix(current []string, families []v1alpha1.IPFamily) bool {
+	if len(current) < len(families) {
+		return false
+	}
+	for i, f := range families {
+		if current[i] != string(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateIPFamilies returns the errors found in the IP family policy and
+// families of the services
+func validateIPFamilies(spec *v1alpha1.NginxSpec) []string {
+	svc := spec.Service
+	if svc == nil {
+		return nil
+	}
+	var errs []string
+	switch svc.IPFamilyPolicy {
+	case "", v1alpha1.IPFamilyPolicySingleStack, v1alpha1.IPFamilyPolicyPreferDualStack, v1alpha1.IPFamilyPolicyRequireDualStack:
+	default:
+		errs = append(errs, fmt.Sprintf("spec.service.ipFamilyPolicy %q is not supported", svc.IPFamilyPolicy))
+	}
+	seen := make(map[v1alpha1.IPFamily]bool)
+	for i, f := range svc.IPFamilies {
+		switch f {
+		case v1alpha1.IPv4Protocol, v1alpha1.IPv6Protocol:
+		default:
+			errs = append(errs, fmt.Sprintf("spec.service.ipFamilies[%d] %q is not supported", i, f))
+			continue
+		}
+		if seen[f] {
+			errs = append(errs, fmt.Sprintf("spec.service.ipFamilies[%d] %q is duplicated", i, f))
+		}
+		seen[f] = true
+	}
+	if len(svc.IPFamilies) > 1 && svc.IPFamilyPolicy != v1alpha1.IPFamilyPolicyPreferDualStack && svc.IPFamilyPolicy != v1alpha1.IPFamilyPolicyRequireDualStack {
+		errs = append(errs, "spec.service.ipFamilies with two families requires spec.service.ipFamilyPolicy PreferDualStack or RequireDualStack")
+	}
+	return errs
+}
@@ -0,0 +1,171 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIPFamiliesDefaultServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		service *v1alpha1.NginxServiceSpec
+		want    string
+	}{
+		{
+			name: "ipv4 by default",
+			want: "server {\n    listen 80;\n    listen 443 ssl;\n",
+		},
+		{
+			name:    "ipv6 only",
+			service: &v1alpha1.NginxServiceSpec{IPFamilies: []v1alpha1.IPFamily{v1alpha1.IPv6Protocol}},
+			want:    "server {\n    listen [::]:80;\n    listen [::]:443 ssl;\n",
+		},
+		{
+			name: "dual-stack",
+			service: &v1alpha1.NginxServiceSpec{
+				IPFamilyPolicy: v1alpha1.IPFamilyPolicyPreferDualStack,
+				IPFamilies:     []v1alpha1.IPFamily{v1alpha1.IPv6Protocol, v1alpha1.IPv4Protocol},
+			},
+			want: "server {\n    listen 80;\n    listen [::]:80;\n    listen 443 ssl;\n    listen [::]:443 ssl;\n",
+		},
+		{
+			name:    "required dual-stack",
+			service: &v1alpha1.NginxServiceSpec{IPFamilyPolicy: v1alpha1.IPFamilyPolicyRequireDualStack},
+			want:    "server {\n    listen 80;\n    listen [::]:80;\n    listen 443 ssl;\n    listen [::]:443 ssl;\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "cert"}
+			nginx.Spec.Service = tt.service
+			assert.Contains(t, defaultServer(&nginx), tt.want)
+		})
+	}
+}
+
+func TestIPFamiliesReplaceImageDefaultServer(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, DefaultServerHashPodAnnotation)
+	assert.Nil(t, NewDefaultServerConfigMap(&nginx))
+
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{IPFamilies: []v1alpha1.IPFamily{v1alpha1.IPv6Protocol}}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Contains(t, dep.Spec.Template.Annotations, DefaultServerHashPodAnnotation)
+	assert.Equal(t, "server {\n    listen [::]:80;\n    location / {\n        root /usr/share/nginx/html;\n        index index.html index.htm;\n    }\n}\n",
+		defaultServer(&nginx))
+}
+
+func TestUnstructuredService(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{
+		IPFamilyPolicy: v1alpha1.IPFamilyPolicyPreferDualStack,
+		IPFamilies:     []v1alpha1.IPFamily{v1alpha1.IPv6Protocol, v1alpha1.IPv4Protocol},
+	}
+	u, err := UnstructuredService(&nginx.Spec, NewService(&nginx))
+	assert.Nil(t, err)
+	assert.Equal(t, "Service", u.GetKind())
+	assert.Equal(t, "my-nginx-service", u.GetName())
+	policy, _ := unstructured.NestedString(u.Object, "spec", "ipFamilyPolicy")
+	assert.Equal(t, "PreferDualStack", policy)
+	families, _ := unstructured.NestedStringSlice(u.Object, "spec", "ipFamilies")
+	assert.Equal(t, []string{"IPv6", "IPv4"}, families)
+}
+
+func TestSetIPFamilies(t *testing.T) {
+	service := func(policy string, families ...string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		unstructured.SetNestedField(u.Object, policy, "spec", "ipFamilyPolicy")
+		unstructured.SetNestedStringSlice(u.Object, families, "spec", "ipFamilies")
+		return u
+	}
+	tests := []struct {
+		name     string
+		spec     *v1alpha1.NginxServiceSpec
+		current  *unstructured.Unstructured
+		changed  bool
+		policy   string
+		families []string
+	}{
+		{
+			name:     "unset",
+			current:  service("SingleStack", "IPv4"),
+			policy:   "SingleStack",
+			families: []string{"IPv4"},
+		},
+		{
+			name:     "up to date",
+			spec:     &v1alpha1.NginxServiceSpec{IPFamilyPolicy: v1alpha1.IPFamilyPolicySingleStack, IPFamilies: []v1alpha1.IPFamily{v1alpha1.IPv4Protocol}},
+			current:  service("SingleStack", "IPv4"),
+			policy:   "SingleStack",
+			families: []string{"IPv4"},
+		},
+		{
+			name:     "secondary family allocated by the cluster",
+			spec:     &v1alpha1.NginxServiceSpec{IPFamilyPolicy: v1alpha1.IPFamilyPolicyPreferDualStack, IPFamilies: []v1alpha1.IPFamily{v1alpha1.IPv4Protocol}},
+			current:  service("PreferDualStack", "IPv4", "IPv6"),
+			policy:   "PreferDualStack",
+			families: []string{"IPv4", "IPv6"},
+		},
+		{
+			name:     "upgraded to dual-stack",
+			spec:     &v1alpha1.NginxServiceSpec{IPFamilyPolicy: v1alpha1.IPFamilyPolicyRequireDualStack, IPFamilies: []v1alpha1.IPFamily{v1alpha1.IPv4Protocol, v1alpha1.IPv6Protocol}},
+			current:  service("SingleStack", "IPv4"),
+			changed:  true,
+			policy:   "RequireDualStack",
+			families: []string{"IPv4", "IPv6"},
+		},
+		{
+			name:     "policy only",
+			spec:     &v1alpha1.NginxServiceSpec{IPFamilyPolicy: v1alpha1.IPFamilyPolicyPreferDualStack},
+			current:  service("SingleStack", "IPv6"),
+			changed:  true,
+			policy:   "PreferDualStack",
+			families: []string{"IPv6"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &v1alpha1.NginxSpec{Service: tt.spec}
+			assert.Equal(t, tt.changed, SetIPFamilies(spec, tt.current))
+			policy, _ := unstructured.NestedString(tt.current.Object, "spec", "ipFamilyPolicy")
+			assert.Equal(t, tt.policy, policy)
+			families, _ := unstructured.NestedStringSlice(tt.current.Object, "spec", "ipFamilies")
+			assert.Equal(t, tt.families, families)
+		})
+	}
+}
+
+func TestValidateIPFamilies(t *testing.T) {
+	tests := []struct {
+		service *v1alpha1.NginxServiceSpec
+		want    []string
+	}{
+		{nil, nil},
+		{&v1alpha1.NginxServiceSpec{IPFamilies: []v1alpha1.IPFamily{v1alpha1.IPv6Protocol}}, nil},
+		{&v1alpha1.NginxServiceSpec{
+			IPFamilyPolicy: v1alpha1.IPFamilyPolicyRequireDualStack,
+			IPFamilies:     []v1alpha1.IPFamily{v1alpha1.IPv6Protocol, v1alpha1.IPv4Protocol},
+		}, nil},
+		{&v1alpha1.NginxServiceSpec{IPFamilyPolicy: "DualStack"}, []string{`spec.service.ipFamilyPolicy "DualStack" is not supported`}},
+		{&v1alpha1.NginxServiceSpec{
+			IPFamilyPolicy: v1alpha1.IPFamilyPolicyPreferDualStack,
+			IPFamilies:     []v1alpha1.IPFamily{"ipv4", v1alpha1.IPv6Protocol, v1alpha1.IPv6Protocol},
+		}, []string{
+			`spec.service.ipFamilies[0] "ipv4" is not supported`,
+			`spec.service.ipFamilies[2] "IPv6" is duplicated`,
+		}},
+		{&v1alpha1.NginxServiceSpec{
+			IPFamilies: []v1alpha1.IPFamily{v1alpha1.IPv4Protocol, v1alpha1.IPv6Protocol},
+		}, []string{"spec.service.ipFamilies with two families requires spec.service.ipFamilyPolicy PreferDualStack or RequireDualStack"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, validateIPFamilies(&v1alpha1.NginxSpec{Service: tt.service}))
+	}
+}
@@ -0,0 +1,388 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Default port names used by the nginx container and the ClusterIP service
+	defaultHTTPPortName  = "http"
+	defaultHTTPSPortName = "https"
+
+	// Mount path where nginx.conf will be placed
+	configMountPath = "/etc/nginx"
+
+	// Mount path where certificate and key pair will be placed
+	certMountPath = configMountPath + "/certs"
+
+	// Annotation key used by older versions to store the nginx that created
+	// the deployment
+	generatedFromAnnotation = "nginx.tsuru.io/generated-from"
+)
+
+// NewDeployment creates a deployment for a given Nginx resource.
+func NewDeployment(n *v1alpha1.Nginx) (*appv1.Deployment, error) {
+	spec := n.Spec.WithDefaults()
+	httpPort, _ := listenPorts(spec)
+	deployment := appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n.Name + "-deployment",
+			Namespace: n.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+		},
+		Spec: appv1.DeploymentSpec{
+			Replicas:                spec.Replicas,
+			RevisionHistoryLimit:    spec.RevisionHistoryLimit,
+			MinReadySeconds:         spec.MinReadySeconds,
+			ProgressDeadlineSeconds: spec.ProgressDeadlineSeconds,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podLabelsForNginx(n),
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: n.Namespace,
+					Labels:    podLabelsForNginx(n),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "nginx",
+							Image: spec.Image,
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          httpPortName(spec),
+									ContainerPort: httpPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							Resources: spec.PodTemplate.Resources,
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									HTTPGet: &corev1.HTTPGetAction{
+										Path:   "/",
+										Port:   intstr.FromString(httpPortName(spec)),
+										Scheme: corev1.URISchemeHTTP,
+									},
+								},
+							},
+						},
+					},
+					Affinity: spec.PodTemplate.Affinity,
+				},
+			},
+		},
+	}
+	setupPorts(spec.PodTemplate.Ports, &deployment)
+	setupConfig(n, spec, &deployment)
+	setupNginxArgs(spec, &deployment)
+	setupModules(spec.Modules, &deployment)
+	setupConfigReload(spec, &deployment)
+	setupMetrics(spec, &deployment)
+	setupHTTPConfig(spec, &deployment)
+	setupOverloadProtection(spec, &deployment)
+	setupLogging(spec, &deployment)
+	setupUpstreamMetrics(spec, &deployment)
+	setupSecurity(spec, &deployment)
+	setupAuth(spec, n.Namespace, &deployment)
+	setupCacheVolume(spec.Cache, &deployment)
+	setupLocations(n, spec, &deployment)
+	setupObjectStorage(spec.Locations, &deployment)
+	setupStaticSites(spec.StaticSites, &deployment)
+	setupGitSync(spec.GitSync, &deployment)
+	setupWaitFor(spec.WaitFor, &deployment)
+	setupTLS(spec, &deployment)
+	setupProbes(spec.Healthcheck, &deployment)
+	setupUnknownHosts(spec, &deployment)
+	setupProxyProtocol(spec, &deployment)
+	setupAppProtocol(spec, &deployment)
+	setupPodTemplate(&spec.PodTemplate, &deployment)
+	setupServiceAccount(n, &deployment)
+	setupSpreadReplicas(n.Name, spec, &deployment)
+	setupLifecycle(spec, &deployment)
+	setupRootless(spec, &deployment)
+	setupCachePurge(n, &deployment)
+	setupRestart(n, &deployment)
+	setupCertificateRevision(n, &deployment)
+	setupExternalSecretsRevision(n, &deployment)
+	setupConfigTemplateRevision(n, spec, &deployment)
+	setupInlineConfigHash(spec, &deployment)
+	if spec.Strategy != nil {
+		deployment.Spec.Strategy = *spec.Strategy
+	}
+	setupMaxUnavailable(spec, &deployment)
+	setupMetadata(spec, &deployment)
+
+	if err := setWorkloadHash(n, &deployment, &deployment.Spec, &deployment.Spec.Template); err != nil {
+		return nil, err
+	}
+
+	return &deployment, nil
+}
+
+// NewService assembles the ClusterIP service for the Nginx
+func NewService(n *v1alpha1.Nginx) *corev1.Service {
+	spec := n.Spec.WithDefaults()
+	service := corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n.Name + "-service",
+			Namespace: n.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+			Labels: LabelsForNginx(n.Name),
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       httpPortName(spec),
+					Protocol:   corev1.ProtocolTCP,
+					TargetPort: intstr.FromString(httpPortName(spec)),
+					Port:       int32(80),
+				},
+			},
+			Selector: LabelsForNginx(n.Name),
+			Type:     corev1.ServiceTypeClusterIP,
+		},
+	}
+	if n.Spec.TLSSecret != nil {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       defaultHTTPSPortName,
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromString(defaultHTTPSPortName),
+			Port:       int32(443),
+		})
+	}
+	if n.Spec.Metrics != nil {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       metricsPortName,
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromString(metricsPortName),
+			Port:       int32(metricsPort),
+		})
+		if n.Spec.Metrics.Upstreams != nil {
+			service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+				Name:       upstreamMetricsPortName,
+				Protocol:   corev1.ProtocolTCP,
+				TargetPort: intstr.FromString(upstreamMetricsPortName),
+				Port:       int32(upstreamMetricsPort),
+			})
+		}
+	}
+	for _, p := range spec.PodTemplate.Ports {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       servicePortName(p),
+			Protocol:   p.Protocol,
+			TargetPort: intstr.FromString(p.Name),
+			Port:       p.ContainerPort,
+		})
+	}
+	setupServiceOptions(spec, &service)
+	if !dnsOnIngress(spec) {
+		setupDNS(spec, &service)
+	}
+	setCustomMetadata(&n.Spec, &service)
+	return &service
+}
+
+// LabelsForNginx returns the labels for a Nginx CR with the given name
+func LabelsForNginx(name string) map[string]string {
+	return map[string]string{
+		"nginx_cr": name,
+		"app":      "nginx",
+	}
+}
+
+// ExtractNginxSpec extracts the nginx used to create the object
+//
+// Deprecated: workloads are no longer annotated with the nginx spec, use
+// CurrentGeneratedHash to compare them.
+func ExtractNginxSpec(o metav1.ObjectMeta) (v1alpha1.NginxSpec, error) {
+	ann, ok := o.Annotations[generatedFromAnnotation]
+	if !ok {
+		return v1alpha1.NginxSpec{}, fmt.Errorf("missing %q annotation in deployment", generatedFromAnnotation)
+	}
+	var spec v1alpha1.NginxSpec
+	if err := json.Unmarshal([]byte(ann), &spec); err != nil {
+		return v1alpha1.NginxSpec{}, fmt.Errorf("failed to unmarshal nginx from annotation: %v", err)
+	}
+	return spec, nil
+}
+
+// SetNginxSpec sets the nginx spec into the object annotation to be later extracted
+//
+// Deprecated: builders record the GeneratedHash of the workloads instead.
+func SetNginxSpec(o *metav1.ObjectMeta, spec v1alpha1.NginxSpec) error {
+	if o.Annotations == nil {
+		o.Annotations = make(map[string]string)
+	}
+	origSpec, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	o.Annotations[generatedFromAnnotation] = string(origSpec)
+	return nil
+}
+
+// setupConfig mounts the config of the nginx, its sources in conf.d and the
+// files placed next to it in /etc/nginx, from spec.configFiles and
+// spec.extraFiles. The spec must have its default values already set.
+func setupConfig(n *v1alpha1.Nginx, spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	mountConfig(n, spec.Config, dep)
+	mountConfigSources(spec.Config, dep)
+	setupConfigFiles(spec, dep)
+}
+
+// configMounted returns whether the config ref has a nginx.conf to mount:
+// the one of a ConfigMap or an inline one
+func configMounted(conf *v1alpha1.ConfigRef) bool {
+	return conf != nil && (conf.Name != "" || conf.Kind == v1alpha1.ConfigKindInline)
+}
+
+// mountConfig mounts the nginx.conf of the config ref, if it has one.
+// Inline configs are read from the ConfigMap generated for them.
+func mountConfig(n *v1alpha1.Nginx, conf *v1alpha1.ConfigRef, dep *appv1.Deployment) {
+	if !configMounted(conf) {
+		return
+	}
+	mount := corev1.VolumeMount{
+		Name:      "nginx-config",
+		MountPath: configMountPath,
+	}
+	if conf.Mount == v1alpha1.ConfigMountFile {
+		mount.MountPath = configMountPath + "/nginx.conf"
+		mount.SubPath = "nginx.conf"
+	}
+	name := conf.Name
+	if conf.Kind == v1alpha1.ConfigKindInline {
+		name = InlineConfigName(n)
+	}
+	dep.Spec.Template.Spec.Containers[0].VolumeMounts = append(dep.Spec.Template.Spec.Containers[0].VolumeMounts, mount)
+	dep.Spec.Template.Spec.Volumes = append(dep.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "nginx-config",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: name,
+				},
+			},
+		},
+	})
+}
+
+// setupPorts appends the additional ports to the nginx container. The ports
+// must have their default values already set.
+func setupPorts(ports []v1alpha1.NginxPort, dep *appv1.Deployment) {
+	for _, p := range ports {
+		dep.Spec.Template.Spec.Containers[0].Ports = append(dep.Spec.Template.Spec.Containers[0].Ports, corev1.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: p.ContainerPort,
+			Protocol:      p.Protocol,
+		})
+	}
+}
+
+// setupPodTemplate merges the user provided pod template fields into the
+// deployment, after the ones set up by the operator
+func setupPodTemplate(template *v1alpha1.NginxPodTemplateSpec, dep *appv1.Deployment) {
+	podSpec := &dep.Spec.Template.Spec
+	nginx := &podSpec.Containers[0]
+	nginx.Env = append(nginx.Env, template.Env...)
+	nginx.EnvFrom = append(nginx.EnvFrom, template.EnvFrom...)
+	nginx.VolumeMounts = append(nginx.VolumeMounts, template.VolumeMounts...)
+	podSpec.Volumes = append(podSpec.Volumes, template.Volumes...)
+	podSpec.Containers = append(podSpec.Containers, template.Containers...)
+	podSpec.InitContainers = append(podSpec.InitContainers, template.InitContainers...)
+	podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, template.ImagePullSecrets...)
+	podSpec.ServiceAccountName = template.ServiceAccountName
+	podSpec.AutomountServiceAccountToken = boolPtr(false)
+	if template.AutomountServiceAccountToken != nil {
+		podSpec.AutomountServiceAccountToken = boolPtr(*template.AutomountServiceAccountToken)
+	}
+	podSpec.NodeSelector = template.NodeSelector
+	podSpec.Tolerations = template.Tolerations
+	podSpec.TerminationGracePeriodSeconds = template.TerminationGracePeriodSeconds
+	podSpec.SecurityContext = template.SecurityContext
+	podSpec.PriorityClassName = template.PriorityClassName
+	podSpec.SchedulerName = template.SchedulerName
+	if template.HostNetwork {
+		podSpec.HostNetwork = true
+		podSpec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+	if template.HostNetwork || template.HostPorts {
+		// With the host network the host port must match the container port,
+		// setting it keeps the defaulted ports from showing up as drift
+		for i := range nginx.Ports {
+			nginx.Ports[i].HostPort = nginx.Ports[i].ContainerPort
+		}
+	}
+}
+
+// setupTLS appends an https port if TLS secrets are specified. The spec
+// must have its default values already set.
+func setupTLS(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	secret := spec.TLSSecret
+	if secret == nil {
+		return
+	}
+	_, httpsPort := listenPorts(spec)
+
+	dep.Spec.Template.Spec.Containers[0].Ports = append(dep.Spec.Template.Spec.Containers[0].Ports, corev1.ContainerPort{
+		Name:          defaultHTTPSPortName,
+		ContainerPort: httpsPort,
+		Protocol:      corev1.ProtocolTCP,
+	})
+	dep.Spec.Template.Spec.Containers[0].ReadinessProbe = &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   "/",
+				Port:   intstr.FromString(defaultHTTPSPortName),
+				Scheme: corev1.URISchemeHTTPS,
+			},
+		},
+	}
+	dep.Spec.Template.Spec.Containers[0].VolumeMounts = append(dep.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "nginx-certs",
+		MountPath: certMountPath,
+	})
+
+	dep.Spec.Template.Spec.Volumes = append(dep.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "nginx-certs",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secret.SecretName,
+				Items: []corev1.KeyToPath{
+					{Key: secret.KeyField, Path: secret.KeyPath},
+					{Key: secret.CertificateField, Path: secret.CertificatePath},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,801 @@
+package k8s
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func baseNginx() v1alpha1.Nginx {
+	return v1alpha1.Nginx{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-nginx",
+			Namespace: "default",
+		},
+		Spec:   v1alpha1.NginxSpec{},
+		Status: v1alpha1.NginxStatus{},
+	}
+}
+
+func baseDeployment() appv1.Deployment {
+	return appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-nginx-deployment",
+			Namespace:   "default",
+			Annotations: make(map[string]string),
+		},
+		Spec: appv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"nginx_cr": "my-nginx",
+					"app":      "nginx",
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "",
+					Namespace: "default",
+					Labels: map[string]string{
+						"nginx_cr": "my-nginx",
+						"app":      "nginx",
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "nginx",
+							Image: "nginx:latest",
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "http",
+									ContainerPort: int32(80),
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									HTTPGet: &corev1.HTTPGetAction{
+										Path:   "/",
+										Port:   intstr.FromString(defaultHTTPPortName),
+										Scheme: corev1.URISchemeHTTP,
+									},
+								},
+							},
+						},
+					},
+					AutomountServiceAccountToken: boolPtr(false),
+				},
+			},
+		},
+	}
+}
+
+func Test_NewDeployment(t *testing.T) {
+	tests := []struct {
+		name     string
+		nginxFn  func(n v1alpha1.Nginx) v1alpha1.Nginx
+		deployFn func(d appv1.Deployment) appv1.Deployment
+	}{
+		{
+			name: "empty-spec",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				return d
+			},
+		},
+		{
+			name: "multiple-replicas",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				v := int32(3)
+				n.Spec.Replicas = &v
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				v := int32(3)
+				d.Spec.Replicas = &v
+				return d
+			},
+		},
+		{
+			name: "custom-image",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.Image = "tsuru/nginx:latest"
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].Image = "tsuru/nginx:latest"
+				return d
+			},
+		},
+		{
+			name: "with-config-configmap",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.Config = &v1alpha1.ConfigRef{
+					Kind: v1alpha1.ConfigKindConfigMap,
+					Name: "config-map-xpto",
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+					{
+						Name:      "nginx-config",
+						MountPath: "/etc/nginx/nginx.conf",
+						SubPath:   "nginx.conf",
+					},
+				}
+				d.Spec.Template.Spec.Volumes = []corev1.Volume{
+					{
+						Name: "nginx-config",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "config-map-xpto",
+								},
+							},
+						},
+					},
+				}
+				return d
+			},
+		},
+		{
+			name: "with-config-directory",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.Config = &v1alpha1.ConfigRef{
+					Name:  "config-map-xpto",
+					Mount: v1alpha1.ConfigMountDirectory,
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+					{
+						Name:      "nginx-config",
+						MountPath: "/etc/nginx",
+					},
+				}
+				d.Spec.Template.Spec.Volumes = []corev1.Volume{
+					{
+						Name: "nginx-config",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "config-map-xpto",
+								},
+							},
+						},
+					},
+				}
+				return d
+			},
+		},
+		{
+			name: "with-config-inline",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.Config = &v1alpha1.ConfigRef{
+					Kind:  v1alpha1.ConfigKindInline,
+					Name:  "config-inline",
+					Value: "server {}",
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+					{
+						Name:      "nginx-config",
+						MountPath: "/etc/nginx/nginx.conf",
+						SubPath:   "nginx.conf",
+					},
+				}
+				d.Spec.Template.Annotations = map[string]string{
+					"nginx.tsuru.io/inline-config-hash": InlineConfigHash("server {}"),
+				}
+				d.Spec.Template.Spec.Volumes = []corev1.Volume{
+					{
+						Name: "nginx-config",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "my-nginx-inline-config",
+								},
+							},
+						},
+					},
+				}
+				return d
+			},
+		},
+		{
+			name: "with-tls",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.TLSSecret = &v1alpha1.TLSSecret{
+					SecretName:       "my-secret",
+					KeyField:         "key-field",
+					KeyPath:          "key-path",
+					CertificateField: "cert-field",
+					CertificatePath:  "cert-path",
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				withDefaultServer(&d, "server {\n    listen 80;\n    listen 443 ssl;\n    ssl_certificate /etc/nginx/certs/cert-path;\n"+
+					"    ssl_certificate_key /etc/nginx/certs/key-path;\n    location / {\n        root /usr/share/nginx/html;\n"+
+					"        index index.html index.htm;\n    }\n}\n")
+				d.Spec.Template.Spec.Containers[0].Ports = []corev1.ContainerPort{
+					{
+						Name:          "http",
+						ContainerPort: int32(80),
+						Protocol:      corev1.ProtocolTCP,
+					},
+					{
+						Name:          "https",
+						ContainerPort: int32(443),
+						Protocol:      corev1.ProtocolTCP,
+					},
+				}
+				d.Spec.Template.Spec.Containers[0].VolumeMounts = append(d.Spec.Template.Spec.Containers[0].VolumeMounts,
+					corev1.VolumeMount{Name: "nginx-certs", MountPath: "/etc/nginx/certs"},
+				)
+				d.Spec.Template.Spec.Containers[0].ReadinessProbe = &corev1.Probe{
+					Handler: corev1.Handler{
+						HTTPGet: &corev1.HTTPGetAction{
+							Path:   "/",
+							Port:   intstr.FromString(defaultHTTPSPortName),
+							Scheme: corev1.URISchemeHTTPS,
+						},
+					},
+				}
+				d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes,
+					corev1.Volume{
+						Name: "nginx-certs",
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{
+								SecretName: "my-secret",
+								Items: []corev1.KeyToPath{
+									{Key: "key-field", Path: "key-path"},
+									{Key: "cert-field", Path: "cert-path"},
+								},
+							},
+						},
+					},
+				)
+				return d
+			},
+		},
+		{
+			name: "with-tls-default-values",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.TLSSecret = &v1alpha1.TLSSecret{
+					SecretName: "my-secret",
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				withDefaultServer(&d, "server {\n    listen 80;\n    listen 443 ssl;\n    ssl_certificate /etc/nginx/certs/tls.crt;\n"+
+					"    ssl_certificate_key /etc/nginx/certs/tls.key;\n    location / {\n        root /usr/share/nginx/html;\n"+
+					"        index index.html index.htm;\n    }\n}\n")
+				d.Spec.Template.Spec.Containers[0].Ports = []corev1.ContainerPort{
+					{
+						Name:          "http",
+						ContainerPort: int32(80),
+						Protocol:      corev1.ProtocolTCP,
+					},
+					{
+						Name:          "https",
+						ContainerPort: int32(443),
+						Protocol:      corev1.ProtocolTCP,
+					},
+				}
+				d.Spec.Template.Spec.Containers[0].VolumeMounts = append(d.Spec.Template.Spec.Containers[0].VolumeMounts,
+					corev1.VolumeMount{Name: "nginx-certs", MountPath: "/etc/nginx/certs"},
+				)
+				d.Spec.Template.Spec.Containers[0].ReadinessProbe = &corev1.Probe{
+					Handler: corev1.Handler{
+						HTTPGet: &corev1.HTTPGetAction{
+							Path:   "/",
+							Port:   intstr.FromString(defaultHTTPSPortName),
+							Scheme: corev1.URISchemeHTTPS,
+						},
+					},
+				}
+				d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes,
+					corev1.Volume{
+						Name: "nginx-certs",
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{
+								SecretName: "my-secret",
+								Items: []corev1.KeyToPath{
+									{Key: "tls.key", Path: "tls.key"},
+									{Key: "tls.crt", Path: "tls.crt"},
+								},
+							},
+						},
+					},
+				)
+				return d
+			},
+		},
+		{
+			name: "with-affinity",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.PodTemplate.Affinity = &corev1.Affinity{
+					NodeAffinity: &corev1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+							NodeSelectorTerms: []corev1.NodeSelectorTerm{
+								{MatchExpressions: []corev1.NodeSelectorRequirement{
+									{Key: "tsuru.io/pool", Values: []string{"my-pool"}},
+								}},
+							},
+						},
+					},
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Affinity = &corev1.Affinity{
+					NodeAffinity: &corev1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+							NodeSelectorTerms: []corev1.NodeSelectorTerm{
+								{MatchExpressions: []corev1.NodeSelectorRequirement{
+									{Key: "tsuru.io/pool", Values: []string{"my-pool"}},
+								}},
+							},
+						},
+					},
+				}
+				return d
+			},
+		},
+
+		{
+			name: "with-resources",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.PodTemplate.Resources = corev1.ResourceRequirements{
+					Limits: corev1.ResourceList(map[corev1.ResourceName]resource.Quantity{
+						corev1.ResourceMemory: *resource.NewQuantity(int64(100), resource.DecimalSI),
+					}),
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].Resources = corev1.ResourceRequirements{
+					Limits: corev1.ResourceList(map[corev1.ResourceName]resource.Quantity{
+						corev1.ResourceMemory: *resource.NewQuantity(int64(100), resource.DecimalSI),
+					}),
+				}
+				return d
+			},
+		},
+		{
+			name: "with-config-reload",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.Config = &v1alpha1.ConfigRef{
+					Kind: v1alpha1.ConfigKindConfigMap,
+					Name: "config-map-xpto",
+				}
+				n.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].Command = []string{"/bin/sh", "-c", reloadScript(defaultGlobals, "/etc/nginx/..data", "/etc/nginx-reload/..data")}
+				d.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+					{
+						Name:      "nginx-config",
+						MountPath: "/etc/nginx",
+					},
+					{
+						Name:      "nginx-reload",
+						MountPath: "/etc/nginx-reload",
+						ReadOnly:  true,
+					},
+				}
+				d.Spec.Template.Spec.Volumes = []corev1.Volume{
+					{
+						Name: "nginx-config",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "config-map-xpto",
+								},
+							},
+						},
+					},
+					{
+						Name: "nginx-reload",
+						VolumeSource: corev1.VolumeSource{
+							DownwardAPI: &corev1.DownwardAPIVolumeSource{
+								Items: []corev1.DownwardAPIVolumeFile{
+									{
+										Path: "request",
+										FieldRef: &corev1.ObjectFieldSelector{
+											FieldPath: "metadata.annotations['nginx.tsuru.io/reload']",
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				return d
+			},
+		},
+		{
+			name: "with-config-reload-without-config",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				return d
+			},
+		},
+		{
+			name: "with-stream-ports",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.PodTemplate.Ports = []v1alpha1.NginxPort{
+					{Name: "mysql", ContainerPort: 3306},
+					{Name: "syslog", ContainerPort: 514, Protocol: corev1.ProtocolUDP},
+				}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Spec.Containers[0].Ports = append(d.Spec.Template.Spec.Containers[0].Ports,
+					corev1.ContainerPort{Name: "mysql", ContainerPort: 3306, Protocol: corev1.ProtocolTCP},
+					corev1.ContainerPort{Name: "syslog", ContainerPort: 514, Protocol: corev1.ProtocolUDP},
+				)
+				return d
+			},
+		},
+		{
+			name: "with-metrics",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.Metrics = &v1alpha1.NginxMetrics{}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Template.Annotations = map[string]string{
+					"nginx.tsuru.io/stub-status-conf": "server {\n    listen 127.0.0.1:8091;\n    location /stub_status {\n        stub_status;\n    }\n}\n",
+				}
+				d.Spec.Template.Spec.Volumes = []corev1.Volume{
+					{
+						Name: "nginx-operator-config",
+						VolumeSource: corev1.VolumeSource{
+							DownwardAPI: &corev1.DownwardAPIVolumeSource{
+								Items: []corev1.DownwardAPIVolumeFile{
+									{
+										Path: "stub_status.conf",
+										FieldRef: &corev1.ObjectFieldSelector{
+											FieldPath: "metadata.annotations['nginx.tsuru.io/stub-status-conf']",
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				d.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+					{
+						Name:      "nginx-operator-config",
+						MountPath: "/etc/nginx-operator",
+					},
+					{
+						Name:      "nginx-operator-config",
+						MountPath: "/etc/nginx/conf.d/stub_status.conf",
+						SubPath:   "stub_status.conf",
+					},
+				}
+				d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{
+					Name:  "exporter",
+					Image: "nginx/nginx-prometheus-exporter:0.1.0",
+					Args:  []string{"-nginx.scrape-uri=http://127.0.0.1:8091/stub_status"},
+					Ports: []corev1.ContainerPort{
+						{Name: "metrics", ContainerPort: 9113, Protocol: corev1.ProtocolTCP},
+					},
+				})
+				return d
+			},
+		},
+		{
+			name: "with-flagger",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				n.Spec.Flagger = &v1alpha1.FlaggerSpec{PrometheusAddress: "http://prometheus:9090"}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				d.Spec.Selector.MatchLabels["app.kubernetes.io/name"] = "my-nginx"
+				d.Spec.Template.Labels["app.kubernetes.io/name"] = "my-nginx"
+				return d
+			},
+		},
+		{
+			name: "with-strategy",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				limit := int32(2)
+				n.Spec.RevisionHistoryLimit = &limit
+				deadline := int32(120)
+				n.Spec.MinReadySeconds = 15
+				n.Spec.ProgressDeadlineSeconds = &deadline
+				n.Spec.Strategy = &appv1.DeploymentStrategy{Type: appv1.RecreateDeploymentStrategyType}
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				limit := int32(2)
+				d.Spec.RevisionHistoryLimit = &limit
+				deadline := int32(120)
+				d.Spec.MinReadySeconds = 15
+				d.Spec.ProgressDeadlineSeconds = &deadline
+				d.Spec.Strategy = appv1.DeploymentStrategy{Type: appv1.RecreateDeploymentStrategyType}
+				return d
+			},
+		},
+		{
+			name: "with-pod-template",
+			nginxFn: func(n v1alpha1.Nginx) v1alpha1.Nginx {
+				grace := int64(60)
+				n.Spec.PodTemplate.Env = []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}
+				n.Spec.PodTemplate.Volumes = []corev1.Volume{
+					{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				}
+				n.Spec.PodTemplate.VolumeMounts = []corev1.VolumeMount{{Name: "cache", MountPath: "/var/cache/nginx"}}
+				n.Spec.PodTemplate.Containers = []corev1.Container{{Name: "logger", Image: "fluent-bit"}}
+				n.Spec.PodTemplate.InitContainers = []corev1.Container{{Name: "warmup", Image: "busybox"}}
+				n.Spec.PodTemplate.ServiceAccountName = "nginx"
+				n.Spec.PodTemplate.PriorityClassName = "high-priority"
+				n.Spec.PodTemplate.SchedulerName = "edge-scheduler"
+				n.Spec.PodTemplate.NodeSelector = map[string]string{"pool": "edge"}
+				n.Spec.PodTemplate.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+				n.Spec.PodTemplate.TerminationGracePeriodSeconds = &grace
+				return n
+			},
+			deployFn: func(d appv1.Deployment) appv1.Deployment {
+				grace := int64(60)
+				spec := &d.Spec.Template.Spec
+				spec.Containers[0].Env = []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}
+				spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "cache", MountPath: "/var/cache/nginx"}}
+				spec.Volumes = []corev1.Volume{
+					{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				}
+				spec.Containers = append(spec.Containers, corev1.Container{Name: "logger", Image: "fluent-bit"})
+				spec.InitContainers = []corev1.Container{{Name: "warmup", Image: "busybox"}}
+				spec.ServiceAccountName = "nginx"
+				spec.PriorityClassName = "high-priority"
+				spec.SchedulerName = "edge-scheduler"
+				spec.NodeSelector = map[string]string{"pool": "edge"}
+				spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+				spec.TerminationGracePeriodSeconds = &grace
+				return d
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := tt.nginxFn(baseNginx())
+			want := tt.deployFn(baseDeployment())
+			want.OwnerReferences = []metav1.OwnerReference{
+				*metav1.NewControllerRef(&nginx, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			}
+			orig := nginx.DeepCopy()
+			dep, err := NewDeployment(&nginx)
+			assert.Nil(t, err)
+			assert.Equal(t, orig, &nginx)
+			assert.Nil(t, setGeneratedHash(&want, want.Spec, want.Spec.Template))
+			assertDeployment(t, &want, dep)
+		})
+	}
+}
+
+// withDefaultServer adds the default server replacing the one of the nginx
+// image to the deployment
+func withDefaultServer(d *appv1.Deployment, conf string) {
+	d.Spec.Template.Annotations = map[string]string{DefaultServerHashPodAnnotation: CertificateRevision([]byte(conf))}
+	d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "nginx-default-server",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "my-nginx-default-server"},
+			},
+		},
+	})
+	d.Spec.Template.Spec.Containers[0].VolumeMounts = append(d.Spec.Template.Spec.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "nginx-default-server", MountPath: "/etc/nginx/conf.d/default.conf", SubPath: "default.conf"},
+	)
+}
+
+// defaultServer returns the default server rendered for the nginx, empty
+// when the one of the image is kept
+func defaultServer(n *v1alpha1.Nginx) string {
+	cm := NewDefaultServerConfigMap(n)
+	if cm == nil {
+		return ""
+	}
+	return cm.Data["default.conf"]
+}
+
+func assertDeployment(t *testing.T, want, got *appv1.Deployment) {
+	assert.Equal(t, want.TypeMeta, got.TypeMeta)
+	assert.Equal(t, want.ObjectMeta, got.ObjectMeta)
+	assert.Equal(t, want.Spec, got.Spec)
+	assert.Equal(t, want, got)
+}
+
+func TestAutomountServiceAccountToken(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.PodTemplate.ServiceAccountName = "nginx-reader"
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, boolPtr(false), dep.Spec.Template.Spec.AutomountServiceAccountToken)
+
+	nginx.Spec.PodTemplate.AutomountServiceAccountToken = boolPtr(true)
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx-reader", dep.Spec.Template.Spec.ServiceAccountName)
+	assert.Equal(t, boolPtr(true), dep.Spec.Template.Spec.AutomountServiceAccountToken)
+}
+
+func TestNewService(t *testing.T) {
+	tests := []struct {
+		name  string
+		nginx v1alpha1.Nginx
+		want  *corev1.Service
+	}{
+		{
+			name:  "base",
+			nginx: baseNginx(),
+			want: &corev1.Service{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Service",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "my-nginx-service",
+					Namespace: "default",
+					Labels: map[string]string{
+						"nginx_cr": "my-nginx",
+						"app":      "nginx",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "http",
+							Protocol:   corev1.ProtocolTCP,
+							TargetPort: intstr.FromString("http"),
+							Port:       int32(80),
+						},
+					},
+					Selector: map[string]string{
+						"nginx_cr": "my-nginx",
+						"app":      "nginx",
+					},
+					Type: corev1.ServiceTypeClusterIP,
+				},
+			},
+		},
+		{
+			name: "with-stream-ports",
+			nginx: func() v1alpha1.Nginx {
+				n := baseNginx()
+				n.Spec.PodTemplate.Ports = []v1alpha1.NginxPort{
+					{Name: "mysql", ContainerPort: 3306},
+					{Name: "syslog", ContainerPort: 514, Protocol: corev1.ProtocolUDP},
+				}
+				return n
+			}(),
+			want: &corev1.Service{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Service",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "my-nginx-service",
+					Namespace: "default",
+					Labels: map[string]string{
+						"nginx_cr": "my-nginx",
+						"app":      "nginx",
+					},
+				},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "http",
+							Protocol:   corev1.ProtocolTCP,
+							TargetPort: intstr.FromString("http"),
+							Port:       int32(80),
+						},
+						{
+							Name:       "mysql",
+							Protocol:   corev1.ProtocolTCP,
+							TargetPort: intstr.FromString("mysql"),
+							Port:       int32(3306),
+						},
+						{
+							Name:       "syslog",
+							Protocol:   corev1.ProtocolUDP,
+							TargetPort: intstr.FromString("syslog"),
+							Port:       int32(514),
+						},
+					},
+					Selector: map[string]string{
+						"nginx_cr": "my-nginx",
+						"app":      "nginx",
+					},
+					Type: corev1.ServiceTypeClusterIP,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.OwnerReferences = []metav1.OwnerReference{
+				*metav1.NewControllerRef(&tt.nginx, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			}
+			assert.Equal(t, tt.want, NewService(&tt.nginx))
+		})
+	}
+}
+
+func TestExtractNginxSpec(t *testing.T) {
+	mustMarshal := func(t *testing.T, n v1alpha1.NginxSpec) string {
+		data, err := json.Marshal(n)
+		assert.Nil(t, err)
+		return string(data)
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        v1alpha1.NginxSpec
+		wantedErr   string
+	}{
+		{
+			name:      "missing-annotation",
+			want:      v1alpha1.NginxSpec{},
+			wantedErr: `missing "nginx.tsuru.io/generated-from" annotation in deployment`,
+		},
+		{
+			name: "default",
+			annotations: map[string]string{
+				generatedFromAnnotation: mustMarshal(t, v1alpha1.NginxSpec{
+					Image: "custom-image",
+				}),
+			},
+			want:      v1alpha1.NginxSpec{Image: "custom-image"},
+			wantedErr: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := metav1.ObjectMeta{
+				Annotations: tt.annotations,
+			}
+			got, err := ExtractNginxSpec(o)
+			if tt.wantedErr != "" {
+				assert.EqualError(t, err, tt.wantedErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultTerminationGracePeriod is the Kubernetes default of the time given
+// to pods to stop
+const defaultTerminationGracePeriod = int64(30)
+
+// preStopScript waits for the pod to be removed from the service endpoints,
+// then stops nginx gracefully and waits for the container process to exit,
+// so the kubelet only sends TERM once the in-flight requests are done
+func preStopScript(globals string, sleep int32) string {
+	return fmt.Sprintf("sleep %d; %s -s quit; while kill -0 1 2>/dev/null; do sleep 1; done", sleep, signalCommand(globals))
+}
+
+// setupLifecycle sets the hooks of the nginx container and the termination
+// grace period of the pod. It must run after setupPodTemplate, since the
+// grace period of the lifecycle takes precedence. The spec must have its
+// default values already set.
+func setupLifecycle(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	l := spec.Lifecycle
+	if l == nil {
+		return
+	}
+	lifecycle := &corev1.Lifecycle{PostStart: l.PostStart, PreStop: l.PreStop}
+	if lifecycle.PreStop == nil {
+		lifecycle.PreStop = &corev1.Handler{Exec: &corev1.ExecAction{
+			Command: []string{"/bin/sh", "-c", preStopScript(nginxGlobals(spec), *l.PreStopSleepSeconds)},
+		}}
+	}
+	dep.Spec.Template.Spec.Containers[0].Lifecycle = lifecycle
+	if l.TerminationGracePeriodSeconds != nil {
+		grace := *l.TerminationGracePeriodSeconds
+		dep.Spec.Template.Spec.TerminationGracePeriodSeconds = &grace
+	}
+}
+
+// validateLifecycle returns the errors found in the lifecycle settings of
+// the spec
+func validateLifecycle(spec *v1alpha1.NginxSpec) []string {
+	l := spec.WithDefaults().Lifecycle
+	if l == nil {
+		return nil
+	}
+	var errs []string
+	errs = append(errs, validateHandler("spec.lifecycle.preStop", l.PreStop)...)
+	errs = append(errs, validateHandler("spec.lifecycle.postStart", l.PostStart)...)
+	if l.PreStop != nil && l.PreStopSleepSeconds != nil {
+		errs = append(errs, "spec.lifecycle.preStopSleepSeconds cannot be used with spec.lifecycle.preStop")
+	}
+	if l.TerminationGracePeriodSeconds != nil && spec.PodTemplate.TerminationGracePeriodSeconds != nil {
+		errs = append(errs, "spec.lifecycle.terminationGracePeriodSeconds and spec.podTemplate.terminationGracePeriodSeconds cannot be used together")
+	}
+	grace := defaultTerminationGracePeriod
+	if g := l.TerminationGracePeriodSeconds; g != nil {
+		grace = *g
+	} else if g := spec.PodTemplate.TerminationGracePeriodSeconds; g != nil {
+		grace = *g
+	}
+	if grace < 0 {
+		errs = append(errs, "spec.lifecycle.terminationGracePeriodSeconds must not be negative")
+	}
+	if s := l.PreStopSleepSeconds; s != nil {
+		switch {
+		case *s < 0:
+			errs = append(errs, "spec.lifecycle.preStopSleepSeconds must not be negative")
+		case int64(*s) >= grace:
+			errs = append(errs, fmt.Sprintf("spec.lifecycle.preStopSleepSeconds must be shorter than the termination grace period of %ds", grace))
+		}
+	}
+	return errs
+}
+
+// validateHandler returns the errors found in the lifecycle hook
+func validateHandler(field string, h *corev1.Handler) []string {
+	if h == nil {
+		return nil
+	}
+	actions := 0
+	if h.Exec != nil {
+		actions++
+	}
+	if h.HTTPGet != nil {
+		actions++
+	}
+	if h.TCPSocket != nil {
+		actions++
+	}
+	if actions != 1 {
+		return []string{fmt.Sprintf("%s must set exactly one of exec, httpGet or tcpSocket", field)}
+	}
+	return nil
+}
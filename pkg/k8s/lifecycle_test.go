@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestSetupLifecycle(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Nil(t, dep.Spec.Template.Spec.Containers[0].Lifecycle)
+
+	grace := int64(60)
+	nginx.Spec.Lifecycle = &v1alpha1.NginxLifecycle{TerminationGracePeriodSeconds: &grace}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	lifecycle := dep.Spec.Template.Spec.Containers[0].Lifecycle
+	assert.Equal(t, []string{"/bin/sh", "-c", "sleep 5; nginx -s quit; while kill -0 1 2>/dev/null; do sleep 1; done"}, lifecycle.PreStop.Exec.Command)
+	assert.Nil(t, lifecycle.PostStart)
+	assert.Equal(t, int64(60), *dep.Spec.Template.Spec.TerminationGracePeriodSeconds)
+
+	sleep := int32(10)
+	nginx.Spec.Lifecycle = &v1alpha1.NginxLifecycle{PreStopSleepSeconds: &sleep}
+	nginx.Spec.NginxArgs = &v1alpha1.NginxArgs{Globals: []string{"pid /tmp/nginx.pid"}}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, `sleep 10; nginx -g "daemon off; pid /tmp/nginx.pid;" -s quit; while kill -0 1 2>/dev/null; do sleep 1; done`,
+		dep.Spec.Template.Spec.Containers[0].Lifecycle.PreStop.Exec.Command[2])
+	assert.Nil(t, dep.Spec.Template.Spec.TerminationGracePeriodSeconds)
+
+	preStop := &corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/drain", Port: intstr.FromInt(80)}}
+	postStart := &corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"/warmup.sh"}}}
+	nginx.Spec.Lifecycle = &v1alpha1.NginxLifecycle{PreStop: preStop, PostStart: postStart}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, &corev1.Lifecycle{PreStop: preStop, PostStart: postStart}, dep.Spec.Template.Spec.Containers[0].Lifecycle)
+}
+
+func TestValidateLifecycle(t *testing.T) {
+	sleep := func(v int32) *int32 { return &v }
+	grace := func(v int64) *int64 { return &v }
+	exec := &corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"true"}}}
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "no-lifecycle"},
+		{
+			name: "defaults",
+			spec: v1alpha1.NginxSpec{Lifecycle: &v1alpha1.NginxLifecycle{}},
+		},
+		{
+			name: "custom-hooks",
+			spec: v1alpha1.NginxSpec{Lifecycle: &v1alpha1.NginxLifecycle{PreStop: exec, PostStart: exec, TerminationGracePeriodSeconds: grace(2)}},
+		},
+		{
+			name: "invalid-hooks",
+			spec: v1alpha1.NginxSpec{Lifecycle: &v1alpha1.NginxLifecycle{
+				PreStop:             &corev1.Handler{},
+				PreStopSleepSeconds: sleep(1),
+				PostStart:           &corev1.Handler{Exec: exec.Exec, TCPSocket: &corev1.TCPSocketAction{}},
+			}},
+			want: []string{
+				"spec.lifecycle.preStop must set exactly one of exec, httpGet or tcpSocket",
+				"spec.lifecycle.postStart must set exactly one of exec, httpGet or tcpSocket",
+				"spec.lifecycle.preStopSleepSeconds cannot be used with spec.lifecycle.preStop",
+			},
+		},
+		{
+			name: "sleep-longer-than-grace",
+			spec: v1alpha1.NginxSpec{
+				Lifecycle:   &v1alpha1.NginxLifecycle{},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{TerminationGracePeriodSeconds: grace(5)},
+			},
+			want: []string{"spec.lifecycle.preStopSleepSeconds must be shorter than the termination grace period of 5s"},
+		},
+		{
+			name: "two-grace-periods",
+			spec: v1alpha1.NginxSpec{
+				Lifecycle:   &v1alpha1.NginxLifecycle{PreStopSleepSeconds: sleep(-1), TerminationGracePeriodSeconds: grace(-1)},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{TerminationGracePeriodSeconds: grace(30)},
+			},
+			want: []string{
+				"spec.lifecycle.terminationGracePeriodSeconds and spec.podTemplate.terminationGracePeriodSeconds cannot be used together",
+				"spec.lifecycle.terminationGracePeriodSeconds must not be negative",
+				"spec.lifecycle.preStopSleepSeconds must not be negative",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateLifecycle(&tt.spec))
+		})
+	}
+}
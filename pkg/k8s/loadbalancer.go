@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons of the LoadBalancerReady condition
+const (
+	LoadBalancerAllocated = "Allocated"
+	LoadBalancerPending   = "Pending"
+	LoadBalancerStuck     = "AllocationStuck"
+)
+
+// NewServiceStatus returns the load balancer state of the service of the
+// nginx, nil when it is not of type LoadBalancer
+func NewServiceStatus(service *corev1.Service) *v1alpha1.NginxServiceStatus {
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return nil
+	}
+	return &v1alpha1.NginxServiceStatus{ExternalAddresses: Addresses(service.Status.LoadBalancer)}
+}
+
+// LoadBalancerCondition returns the LoadBalancerReady condition of the
+// LoadBalancer service of the nginx, given the current one, if any:
+// Allocated once the load balancer has external addresses, Pending while
+// waiting for them, and AllocationStuck when waiting for longer than
+// spec.service.loadBalancerTimeoutSeconds. The wait starts when the
+// condition becomes Pending. It returns nil for services of other types.
+func LoadBalancerCondition(spec *v1alpha1.NginxSpec, current *v1alpha1.NginxCondition, service *corev1.Service, now time.Time) *v1alpha1.NginxCondition {
+	status := NewServiceStatus(service)
+	if status == nil {
+		return nil
+	}
+	if len(status.ExternalAddresses) > 0 {
+		var addresses []string
+		for _, a := range status.ExternalAddresses {
+			addresses = append(addresses, a.IP+a.Hostname)
+		}
+		return &v1alpha1.NginxCondition{
+			Type:    v1alpha1.NginxConditionLoadBalancerReady,
+			Status:  corev1.ConditionTrue,
+			Reason:  LoadBalancerAllocated,
+			Message: fmt.Sprintf("Load balancer of service %s allocated at %s", service.Name, strings.Join(addresses, ", ")),
+		}
+	}
+
+	if current != nil && current.Reason == LoadBalancerStuck {
+		return current.DeepCopy()
+	}
+	since := now
+	if current != nil && current.Status == corev1.ConditionUnknown {
+		since = current.LastTransitionTime.Time
+	}
+	timeout := loadBalancerTimeout(spec)
+	if now.Sub(since) >= timeout {
+		return &v1alpha1.NginxCondition{
+			Type:    v1alpha1.NginxConditionLoadBalancerReady,
+			Status:  corev1.ConditionFalse,
+			Reason:  LoadBalancerStuck,
+			Message: fmt.Sprintf("Load balancer of service %s not allocated after %s", service.Name, timeout),
+		}
+	}
+	return &v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionLoadBalancerReady,
+		Status:  corev1.ConditionUnknown,
+		Reason:  LoadBalancerPending,
+		Message: fmt.Sprintf("Waiting for the load balancer of service %s", service.Name),
+	}
+}
+
+// loadBalancerTimeout returns how long the load balancer of the service may
+// take to be allocated. Services changed to LoadBalancer by hand, or not yet
+// changed back by the operator, use the default timeout.
+func loadBalancerTimeout(spec *v1alpha1.NginxSpec) time.Duration {
+	timeout := v1alpha1.DefaultLoadBalancerTimeoutSeconds
+	if svc := spec.Service; svc != nil && svc.LoadBalancerTimeoutSeconds > 0 {
+		timeout = svc.LoadBalancerTimeoutSeconds
+	}
+	return time.Duration(timeout) * time.Second
+}
@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewServiceStatus(t *testing.T) {
+	service := &corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP}}
+	assert.Nil(t, NewServiceStatus(service))
+
+	service.Spec.Type = corev1.ServiceTypeLoadBalancer
+	assert.Equal(t, &v1alpha1.NginxServiceStatus{}, NewServiceStatus(service))
+
+	service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}, {Hostname: "lb.example.com"}}
+	assert.Equal(t, &v1alpha1.NginxServiceStatus{ExternalAddresses: []v1alpha1.NginxAddress{
+		{IP: "203.0.113.10"},
+		{Hostname: "lb.example.com"},
+	}}, NewServiceStatus(service))
+}
+
+func TestLoadBalancerCondition(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	spec := &v1alpha1.NginxSpec{Service: &v1alpha1.NginxServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerTimeoutSeconds: 300}}
+	pending := &v1alpha1.NginxCondition{
+		Type:               v1alpha1.NginxConditionLoadBalancerReady,
+		Status:             corev1.ConditionUnknown,
+		Reason:             LoadBalancerPending,
+		LastTransitionTime: metav1.NewTime(now.Add(-4 * time.Minute)),
+	}
+	stuck := &v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionLoadBalancerReady,
+		Status:  corev1.ConditionFalse,
+		Reason:  LoadBalancerStuck,
+		Message: "Load balancer of service my-nginx-service not allocated after 5m0s",
+	}
+	service := func(ingress ...corev1.LoadBalancerIngress) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-service"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status:     corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: ingress}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		spec    *v1alpha1.NginxSpec
+		current *v1alpha1.NginxCondition
+		service *corev1.Service
+		now     time.Time
+		want    *v1alpha1.NginxCondition
+	}{
+		{
+			name:    "cluster-ip",
+			spec:    &v1alpha1.NginxSpec{},
+			service: &corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP}},
+			now:     now,
+		},
+		{
+			name:    "new-pending",
+			spec:    spec,
+			service: service(),
+			now:     now,
+			want: &v1alpha1.NginxCondition{
+				Type:    v1alpha1.NginxConditionLoadBalancerReady,
+				Status:  corev1.ConditionUnknown,
+				Reason:  LoadBalancerPending,
+				Message: "Waiting for the load balancer of service my-nginx-service",
+			},
+		},
+		{
+			name:    "still-pending",
+			spec:    spec,
+			current: pending,
+			service: service(),
+			now:     now,
+			want: &v1alpha1.NginxCondition{
+				Type:    v1alpha1.NginxConditionLoadBalancerReady,
+				Status:  corev1.ConditionUnknown,
+				Reason:  LoadBalancerPending,
+				Message: "Waiting for the load balancer of service my-nginx-service",
+			},
+		},
+		{
+			name:    "stuck",
+			spec:    spec,
+			current: pending,
+			service: service(),
+			now:     now.Add(time.Minute),
+			want:    stuck,
+		},
+		{
+			name:    "stays-stuck",
+			spec:    spec,
+			current: stuck,
+			service: service(),
+			now:     now,
+			want:    stuck,
+		},
+		{
+			name:    "default-timeout",
+			spec:    &v1alpha1.NginxSpec{},
+			current: pending,
+			service: service(),
+			now:     now.Add(time.Minute),
+			want: &v1alpha1.NginxCondition{
+				Type:    v1alpha1.NginxConditionLoadBalancerReady,
+				Status:  corev1.ConditionUnknown,
+				Reason:  LoadBalancerPending,
+				Message: "Waiting for the load balancer of service my-nginx-service",
+			},
+		},
+		{
+			name:    "allocated",
+			spec:    spec,
+			current: stuck,
+			service: service(corev1.LoadBalancerIngress{IP: "203.0.113.10"}, corev1.LoadBalancerIngress{Hostname: "lb.example.com"}),
+			now:     now,
+			want: &v1alpha1.NginxCondition{
+				Type:    v1alpha1.NginxConditionLoadBalancerReady,
+				Status:  corev1.ConditionTrue,
+				Reason:  LoadBalancerAllocated,
+				Message: "Load balancer of service my-nginx-service allocated at 203.0.113.10, lb.example.com",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, LoadBalancerCondition(tt.spec, tt.current, tt.service, tt.now))
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Pod annotation holding the rendered locations
+	locationsAnnotation = "nginx.tsuru.io/locations-conf"
+
+	// DefaultServerHashPodAnnotation is the pod template annotation holding
+	// the hash of the default server rendered by the operator. Changing it
+	// replaces the pods, since files mounted with a sub path are not
+	// updated.
+	DefaultServerHashPodAnnotation = "nginx.tsuru.io/default-server-hash"
+
+	// Volume of the ConfigMap holding the default server
+	defaultServerVolume = "nginx-default-server"
+
+	// Mount path of the ConfigMaps served by static locations
+	staticLocationsMountPath = "/usr/share/nginx/locations"
+)
+
+// DefaultServerConfigName returns the name of the ConfigMap holding the
+// default server rendered for the nginx
+func DefaultServerConfigName(n *v1alpha1.Nginx) string {
+	return n.Name + "-default-server"
+}
+
+// customizesServer returns whether the nginx needs more than the default
+// server of the image. Rootless pods cannot listen on its port, the PROXY
+// protocol must be enabled on its listeners, it does not serve the mounted
+// certificate and only listens on IPv6 when the image entrypoint enables it.
+func customizesServer(spec *v1alpha1.NginxSpec) bool {
+	return len(spec.Locations) > 0 || len(spec.StaticSites) > 0 || spec.Snippets != nil || spec.OverloadProtection != nil || spec.Logging != nil || spec.UnknownHosts != nil || spec.Security != nil || spec.Auth != nil || spec.TLSSecret != nil || spec.Rootless || ProxyProtocolEnabled(spec) || upstreamMetricsEnabled(spec) || servesIPv6(spec)
+}
+
+// replacesDefaultServer returns whether the default server of the image is
+// replaced by the one rendered by the operator, which is done without a
+// custom config only
+func replacesDefaultServer(spec *v1alpha1.NginxSpec) bool {
+	return spec.Config == nil && customizesServer(spec)
+}
+
+// NewDefaultServerConfigMap assembles the ConfigMap holding the default
+// server rendered for the Nginx, mounted over conf.d/default.conf. It is kept
+// in a ConfigMap rather than in a pod annotation like the other generated
+// files, since locations and snippets can make it larger than annotations
+// allow. It returns nil if the default server of the image is kept.
+func NewDefaultServerConfigMap(n *v1alpha1.Nginx) *corev1.ConfigMap {
+	spec := n.Spec.WithDefaults()
+	if !replacesDefaultServer(spec) {
+		return nil
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DefaultServerConfigName(n),
+			Namespace: n.Namespace,
+			Labels:    LabelsForNginx(n.Name),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+		},
+		Data: map[string]string{
+			"default.conf": renderDefaultServer(spec),
+		},
+	}
+	setCustomMetadata(&n.Spec, cm)
+	return cm
+}
+
+// setupLocations renders the locations and static sites of the nginx into
+// /etc/nginx-operator/locations.conf. Without a custom config they are
+// included by a server replacing the default one of the nginx image, which
+// also holds the snippets and is mounted from the ConfigMap returned by
+// NewDefaultServerConfigMap. The spec must have its default values already
+// set.
+func setupLocations(n *v1alpha1.Nginx, spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if !customizesServer(spec) {
+		return
+	}
+	if len(spec.Locations) > 0 || len(spec.StaticSites) > 0 {
+		conf := renderLocations(spec, n.Namespace) + renderStaticSites(spec.StaticSites)
+		addOperatorConfig(dep, locationsAnnotation, "locations.conf", conf)
+	}
+	if replacesDefaultServer(spec) {
+		template := &dep.Spec.Template
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
+		}
+		template.Annotations[DefaultServerHashPodAnnotation] = CertificateRevision([]byte(renderDefaultServer(spec)))
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: defaultServerVolume,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: DefaultServerConfigName(n),
+					},
+				},
+			},
+		})
+		nginx := &template.Spec.Containers[0]
+		nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+			Name:      defaultServerVolume,
+			MountPath: defaultConfigIncludePath + "/default.conf",
+			SubPath:   "default.conf",
+		})
+	}
+
+	for i, l := range spec.Locations {
+		if l.Static == nil {
+			continue
+		}
+		name := fmt.Sprintf("location-static-%d", i)
+		dep.Spec.Template.Spec.Volumes = append(dep.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: l.Static.ConfigMap,
+					},
+				},
+			},
+		})
+		nginx := &dep.Spec.Template.Spec.Containers[0]
+		nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: fmt.Sprintf("%s/%d", staticLocationsMountPath, i),
+			ReadOnly:  true,
+		})
+	}
+}
+
+// renderLocations renders the location blocks in the order they are listed
+func renderLocations(spec *v1alpha1.NginxSpec, namespace string) string {
+	var buf bytes.Buffer
+	zones := cacheZones(spec)
+	for i, l := range spec.Locations {
+		modifier := ""
+		if l.Match == v1alpha1.LocationMatchExact {
+			modifier = "= "
+		}
+		fmt.Fprintf(&buf, "location %s%s {\n", modifier, l.Path)
+
+		keys := make([]string, 0, len(l.Options))
+		for k := range l.Options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "    %s %s;\n", k, l.Options[k])
+		}
+		if b := l.Bandwidth; b != nil {
+			renderBandwidth(&buf, b, i)
+		}
+		if s := spec.Snippets; s != nil {
+			renderSnippet(&buf, s.Location, "    ")
+		}
+
+		switch {
+		case l.Proxy != nil:
+			if c := l.Proxy.Cache; c != nil {
+				renderProxyCache(&buf, c, zones[c.Zone])
+			}
+			fmt.Fprintf(&buf, "    proxy_pass http://%s.%s.svc:%d;\n", l.Proxy.Service, namespace, l.Proxy.Port)
+		case l.FastCGI != nil:
+			renderFastCGI(&buf, l.FastCGI, namespace)
+		case l.ObjectStorage != nil:
+			renderObjectStorage(&buf, l.ObjectStorage, i)
+		case l.Static != nil:
+			fmt.Fprintf(&buf, "    alias %s/%d/;\n", staticLocationsMountPath, i)
+		case l.Redirect != nil:
+			fmt.Fprintf(&buf, "    return %d %s;\n", l.Redirect.Code, quote(l.Redirect.URL))
+		case l.Return != nil:
+			if l.Return.Body == "" {
+				fmt.Fprintf(&buf, "    return %d;\n", l.Return.Code)
+			} else {
+				fmt.Fprintf(&buf, "    return %d %s;\n", l.Return.Code, quote(l.Return.Body))
+			}
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.String()
+}
+
+// renderDefaultServer renders the server used when no custom config is set,
+// listening on the ports exposed by the nginx container. The http context
+// directives are included before it, since the file is included in the http
+// context. Without locations the server keeps serving the html directory of
+// the nginx image, like the default server it replaces.
+func renderDefaultServer(spec *v1alpha1.NginxSpec) string {
+	var buf bytes.Buffer
+	if renderHTTPConfig(spec) != "" {
+		fmt.Fprintf(&buf, "include %s/http.conf;\n", operatorConfigMountPath)
+	}
+	snippets := spec.Snippets
+	if snippets == nil {
+		snippets = &v1alpha1.NginxSnippets{}
+	}
+	renderSnippet(&buf, snippets.HTTP, "")
+	renderUnknownHostsServer(&buf, spec)
+	httpPort, httpsPort := listenPorts(spec)
+	proxyProtocol := proxyProtocolListen(spec)
+	buf.WriteString("server {\n")
+	writeListen(&buf, spec, httpPort, appProtocolListen(spec)+proxyProtocol)
+	if tls := spec.TLSSecret; tls != nil {
+		writeListen(&buf, spec, httpsPort, " ssl"+appProtocolListen(spec)+proxyProtocol)
+		fmt.Fprintf(&buf, "    ssl_certificate %s/%s;\n    ssl_certificate_key %s/%s;\n",
+			certMountPath, tls.CertificatePath, certMountPath, tls.KeyPath)
+	}
+	if u := spec.UnknownHosts; u != nil {
+		fmt.Fprintf(&buf, "    server_name %s;\n", strings.Join(serverNames(u), " "))
+	}
+	if proxyProtocol != "" {
+		buf.WriteString("    set_real_ip_from 0.0.0.0/0;\n    set_real_ip_from ::/0;\n    real_ip_header proxy_protocol;\n")
+	}
+	if spec.OverloadProtection != nil {
+		fmt.Fprintf(&buf, "    include %s/overload.conf;\n", operatorConfigMountPath)
+	}
+	if spec.Logging != nil {
+		fmt.Fprintf(&buf, "    include %s/logging.conf;\n", operatorConfigMountPath)
+	}
+	if upstreamMetricsEnabled(spec) {
+		fmt.Fprintf(&buf, "    include %s/upstream-metrics.conf;\n", operatorConfigMountPath)
+	}
+	if renderSecurityHeaders(spec.Security) != "" {
+		fmt.Fprintf(&buf, "    include %s/security.conf;\n", operatorConfigMountPath)
+	}
+	if spec.Auth != nil && spec.Auth.External != nil {
+		fmt.Fprintf(&buf, "    include %s/auth.conf;\n", operatorConfigMountPath)
+	}
+	renderSnippet(&buf, snippets.Server, "    ")
+	if len(spec.Locations) > 0 || len(spec.StaticSites) > 0 {
+		fmt.Fprintf(&buf, "    include %s/locations.conf;\n}\n", operatorConfigMountPath)
+		return buf.String()
+	}
+	buf.WriteString("    location / {\n        root /usr/share/nginx/html;\n        index index.html index.htm;\n")
+	renderSnippet(&buf, snippets.Location, "        ")
+	buf.WriteString("    }\n}\n")
+	return buf.String()
+}
+
+// quote returns s as a nginx double quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// validateLocations returns the errors found in the locations of the spec
+func validateLocations(locations []v1alpha1.NginxLocation) []string {
+	var errs []string
+	seen := make(map[string]int)
+	for i, l := range locations {
+		field := fmt.Sprintf("spec.locations[%d]", i)
+		if !strings.HasPrefix(l.Path, "/") {
+			errs = append(errs, fmt.Sprintf("%s.path %q must start with /", field, l.Path))
+		} else if strings.ContainsAny(l.Path, " \t\n{};") {
+			errs = append(errs, fmt.Sprintf("%s.path %q must not contain whitespace, braces or semicolons", field, l.Path))
+		}
+
+		match := l.Match
+		switch match {
+		case "":
+			match = v1alpha1.LocationMatchPrefix
+		case v1alpha1.LocationMatchPrefix, v1alpha1.LocationMatchExact:
+		default:
+			errs = append(errs, fmt.Sprintf("%s.match %q is not supported", field, l.Match))
+		}
+		key := string(match) + " " + l.Path
+		if other, ok := seen[key]; ok {
+			errs = append(errs, fmt.Sprintf("%s overlaps spec.locations[%d], both match %s %s", field, other, strings.ToLower(string(match)), l.Path))
+		} else {
+			seen[key] = i
+		}
+
+		actions := 0
+		if a := l.Proxy; a != nil {
+			actions++
+			if a.Service == "" {
+				errs = append(errs, fmt.Sprintf("%s.proxy.service is required", field))
+			}
+			if a.Port < 1 || a.Port > 65535 {
+				errs = append(errs, fmt.Sprintf("%s.proxy.port %d is out of range", field, a.Port))
+			}
+		}
+		if a := l.FastCGI; a != nil {
+			actions++
+			errs = append(errs, validateFastCGI(field, a)...)
+		}
+		if a := l.ObjectStorage; a != nil {
+			actions++
+			errs = append(errs, validateObjectStorage(field, a)...)
+		}
+		if a := l.Static; a != nil {
+			actions++
+			if a.ConfigMap == "" {
+				errs = append(errs, fmt.Sprintf("%s.static.configMap is required", field))
+			}
+		}
+		if a := l.Redirect; a != nil {
+			actions++
+			if a.URL == "" {
+				errs = append(errs, fmt.Sprintf("%s.redirect.url is required", field))
+			}
+			switch a.Code {
+			case 0, 301, 302, 303, 307, 308:
+			default:
+				errs = append(errs, fmt.Sprintf("%s.redirect.code %d is not a redirect code", field, a.Code))
+			}
+		}
+		if a := l.Return; a != nil {
+			actions++
+			if a.Code < 100 || a.Code > 599 {
+				errs = append(errs, fmt.Sprintf("%s.return.code %d is out of range", field, a.Code))
+			}
+		}
+		if actions != 1 {
+			errs = append(errs, fmt.Sprintf("%s must set exactly one of proxy, fastcgi, objectStorage, static, redirect or return", field))
+		}
+
+		errs = append(errs, validateBandwidth(field, l.Bandwidth)...)
+
+		for k, v := range l.Options {
+			if k == "" || strings.ContainsAny(k, " \t\n{};") || strings.ContainsAny(v, "\n{};") {
+				errs = append(errs, fmt.Sprintf("%s.options %q must be a single directive", field, k))
+			}
+		}
+	}
+	return errs
+}
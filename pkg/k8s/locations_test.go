@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderLocations(t *testing.T) {
+	spec := v1alpha1.NginxSpec{Locations: []v1alpha1.NginxLocation{
+		{Path: "/api", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 8080}, Options: map[string]string{
+			"proxy_read_timeout":   "30s",
+			"client_max_body_size": "10m",
+		}},
+		{Path: "/assets/", Static: &v1alpha1.StaticAction{ConfigMap: "assets"}},
+		{Path: "/old", Redirect: &v1alpha1.RedirectAction{URL: "https://example.com/new"}},
+		{Path: "/healthz", Match: v1alpha1.LocationMatchExact, Return: &v1alpha1.ReturnAction{Code: 200, Body: `say "ok"`}},
+		{Path: "/gone", Return: &v1alpha1.ReturnAction{Code: 410}},
+	}}
+	assert.Equal(t, `location /api {
+    client_max_body_size 10m;
+    proxy_read_timeout 30s;
+    proxy_pass http://api.default.svc:8080;
+}
+location /assets/ {
+    alias /usr/share/nginx/locations/1/;
+}
+location /old {
+    return 302 "https://example.com/new";
+}
+location = /healthz {
+    return 200 "say \"ok\"";
+}
+location /gone {
+    return 410;
+}
+`, renderLocations(spec.WithDefaults(), "default"))
+}
+
+func TestSetupLocations(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "cert"}
+	nginx.Spec.Locations = []v1alpha1.NginxLocation{
+		{Path: "/", Static: &v1alpha1.StaticAction{ConfigMap: "site"}},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `server {
+    listen 80;
+    listen 443 ssl;
+    ssl_certificate /etc/nginx/certs/tls.crt;
+    ssl_certificate_key /etc/nginx/certs/tls.key;
+    include /etc/nginx-operator/locations.conf;
+}
+`, defaultServer(&nginx))
+	cm := NewDefaultServerConfigMap(&nginx)
+	assert.Equal(t, "my-nginx-default-server", cm.Name)
+	assert.Equal(t, "default", cm.Namespace)
+	assert.True(t, metav1.IsControlledBy(cm, &nginx))
+	assert.Equal(t, CertificateRevision([]byte(cm.Data["default.conf"])), dep.Spec.Template.Annotations[DefaultServerHashPodAnnotation])
+	assert.NotContains(t, dep.Spec.Template.Annotations, "nginx.tsuru.io/default-server-conf")
+	assert.Contains(t, dep.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "nginx-default-server",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "my-nginx-default-server"},
+			},
+		},
+	})
+	assert.Contains(t, dep.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "nginx-default-server",
+		MountPath: "/etc/nginx/conf.d/default.conf",
+		SubPath:   "default.conf",
+	})
+	assert.Contains(t, dep.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "location-static-0",
+		MountPath: "/usr/share/nginx/locations/0",
+		ReadOnly:  true,
+	})
+
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "custom"}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Nil(t, NewDefaultServerConfigMap(&nginx))
+	assert.NotContains(t, dep.Spec.Template.Annotations, DefaultServerHashPodAnnotation)
+	assert.Contains(t, dep.Spec.Template.Annotations, "nginx.tsuru.io/locations-conf")
+}
+
+func TestValidateLocations(t *testing.T) {
+	tests := []struct {
+		name      string
+		locations []v1alpha1.NginxLocation
+		want      []string
+	}{
+		{
+			name: "valid",
+			locations: []v1alpha1.NginxLocation{
+				{Path: "/", Proxy: &v1alpha1.ProxyAction{Service: "app", Port: 80}},
+				{Path: "/", Match: v1alpha1.LocationMatchExact, Return: &v1alpha1.ReturnAction{Code: 204}},
+			},
+		},
+		{
+			name: "overlapping-paths",
+			locations: []v1alpha1.NginxLocation{
+				{Path: "/a", Return: &v1alpha1.ReturnAction{Code: 200}},
+				{Path: "/a", Match: v1alpha1.LocationMatchPrefix, Return: &v1alpha1.ReturnAction{Code: 404}},
+			},
+			want: []string{"spec.locations[1] overlaps spec.locations[0], both match prefix /a"},
+		},
+		{
+			name: "no-action",
+			locations: []v1alpha1.NginxLocation{
+				{Path: "/a"},
+			},
+			want: []string{"spec.locations[0] must set exactly one of proxy, fastcgi, objectStorage, static, redirect or return"},
+		},
+		{
+			name: "two-actions",
+			locations: []v1alpha1.NginxLocation{
+				{Path: "/a", Return: &v1alpha1.ReturnAction{Code: 200}, Redirect: &v1alpha1.RedirectAction{URL: "/b"}},
+			},
+			want: []string{"spec.locations[0] must set exactly one of proxy, fastcgi, objectStorage, static, redirect or return"},
+		},
+		{
+			name: "invalid-fields",
+			locations: []v1alpha1.NginxLocation{
+				{Path: "a", Match: "Regex", Redirect: &v1alpha1.RedirectAction{Code: 200}},
+				{Path: "/p", Proxy: &v1alpha1.ProxyAction{}, Options: map[string]string{"deny": "all; allow all"}},
+			},
+			want: []string{
+				`spec.locations[0].path "a" must start with /`,
+				`spec.locations[0].match "Regex" is not supported`,
+				"spec.locations[0].redirect.url is required",
+				"spec.locations[0].redirect.code 200 is not a redirect code",
+				"spec.locations[1].proxy.service is required",
+				"spec.locations[1].proxy.port 0 is out of range",
+				`spec.locations[1].options "deny" must be a single directive`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateLocations(tt.locations))
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Pod annotation holding the server context directives of the logs
+	loggingConfigAnnotation = "nginx.tsuru.io/logging-conf"
+
+	// Name of the log_format of the json and custom access log formats
+	accessLogFormatName = "nginx_operator"
+
+	fluentBitSidecarName = "fluent-bit"
+
+	// fluentBitSyslogPort is the localhost UDP port the fluent-bit sidecar
+	// receives the access log on
+	fluentBitSyslogPort = 5140
+)
+
+// jsonLogFormat is the log_format of LogFormatJSON
+const jsonLogFormat = `'{"time":"$time_iso8601","remote_addr":"$remote_addr","request_method":"$request_method",` +
+	`"request_uri":"$request_uri","status":$status,"body_bytes_sent":$body_bytes_sent,"request_time":$request_time,` +
+	`"http_referer":"$http_referer","http_user_agent":"$http_user_agent","upstream_addr":"$upstream_addr",` +
+	`"upstream_response_time":"$upstream_response_time"}'`
+
+var (
+	errorLogLevels = map[string]bool{
+		"debug": true, "info": true, "notice": true, "warn": true,
+		"error": true, "crit": true, "alert": true, "emerg": true,
+	}
+
+	syslogFacilities = map[string]bool{
+		"kern": true, "user": true, "mail": true, "daemon": true, "auth": true,
+		"intern": true, "lpr": true, "news": true, "uucp": true, "clock": true,
+		"authpriv": true, "ftp": true, "ntp": true, "audit": true, "alert": true,
+		"cron": true, "local0": true, "local1": true, "local2": true, "local3": true,
+		"local4": true, "local5": true, "local6": true, "local7": true,
+	}
+
+	syslogTagRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{1,32}$`)
+)
+
+// setupLogging renders the access_log and error_log directives into
+// /etc/nginx-operator/logging.conf, which must be included in the server
+// contexts, and adds the fluent-bit sidecar. The log_format is rendered into
+// http.conf. The spec must have its default values already set.
+func setupLogging(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	l := spec.Logging
+	if l == nil {
+		return
+	}
+	addOperatorConfig(dep, loggingConfigAnnotation, "logging.conf", renderLoggingServer(l))
+	f := l.FluentBit
+	if f == nil {
+		return
+	}
+	args := []string{
+		"-R", "/fluent-bit/etc/parsers.conf",
+		"-i", "syslog", "-p", "mode=udp", "-p", "listen=127.0.0.1",
+		"-p", fmt.Sprintf("port=%d", fluentBitSyslogPort), "-p", "parser=syslog-rfc3164",
+		"-o", f.Output, "-m", "*",
+	}
+	for _, k := range sortedKeys(f.Properties) {
+		args = append(args, "-p", k+"="+f.Properties[k])
+	}
+	dep.Spec.Template.Spec.Containers = append(dep.Spec.Template.Spec.Containers, corev1.Container{
+		Name:      fluentBitSidecarName,
+		Image:     f.Image,
+		Args:      args,
+		Resources: f.Resources,
+	})
+}
+
+// renderLogFormat renders the http context log_format of the json and
+// custom access log formats
+func renderLogFormat(buf *bytes.Buffer, l *v1alpha1.NginxLogging) {
+	if l == nil {
+		return
+	}
+	switch l.Format {
+	case v1alpha1.LogFormatJSON:
+		fmt.Fprintf(buf, "log_format %s escape=json %s;\n", accessLogFormatName, jsonLogFormat)
+	case v1alpha1.LogFormatCustom:
+		fmt.Fprintf(buf, "log_format %s %s;\n", accessLogFormatName, quote(l.CustomFormat))
+	}
+}
+
+// renderLoggingServer renders the server context directives of the access
+// and error logs. Being set in the server context, they replace the logs of
+// the http context of the nginx image instead of adding to them.
+func renderLoggingServer(l *v1alpha1.NginxLogging) string {
+	format := string(l.Format)
+	if l.Format != v1alpha1.LogFormatCombined {
+		format = accessLogFormatName
+	}
+	dest := "/dev/stdout"
+	switch {
+	case l.Syslog != nil:
+		dest = fmt.Sprintf("syslog:server=%s,facility=%s,tag=%s", l.Syslog.Server, l.Syslog.Facility, l.Syslog.Tag)
+	case l.FluentBit != nil:
+		dest = fmt.Sprintf("syslog:server=127.0.0.1:%d,tag=%s", fluentBitSyslogPort, v1alpha1.DefaultSyslogTag)
+	}
+	return fmt.Sprintf("access_log %s %s;\nerror_log stderr %s;\n", dest, format, l.ErrorLogLevel)
+}
+
+// validateLogging returns the errors found in the logging of the spec
+func validateLogging(spec *v1alpha1.NginxSpec) []string {
+	l := spec.Logging
+	if l == nil {
+		return nil
+	}
+	var errs []string
+	switch l.Format {
+	case "", v1alpha1.LogFormatCombined, v1alpha1.LogFormatJSON:
+		if l.CustomFormat != "" {
+			errs = append(errs, "spec.logging.customFormat requires the custom format")
+		}
+	case v1alpha1.LogFormatCustom:
+		if strings.TrimSpace(l.CustomFormat) == "" {
+			errs = append(errs, "spec.logging.customFormat is required by the custom format")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("spec.logging.format %q is not supported", l.Format))
+	}
+	if l.ErrorLogLevel != "" && !errorLogLevels[l.ErrorLogLevel] {
+		errs = append(errs, fmt.Sprintf("spec.logging.errorLogLevel %q is not supported", l.ErrorLogLevel))
+	}
+	if l.Syslog != nil && l.FluentBit != nil {
+		errs = append(errs, "spec.logging must not set both syslog and fluentBit")
+	}
+	if s := l.Syslog; s != nil {
+		if s.Server == "" {
+			errs = append(errs, "spec.logging.syslog.server is required")
+		} else if strings.ContainsAny(s.Server, " \t\n,;{}") {
+			errs = append(errs, fmt.Sprintf("spec.logging.syslog.server %q must not contain whitespace, commas, braces or semicolons", s.Server))
+		}
+		if s.Facility != "" && !syslogFacilities[s.Facility] {
+			errs = append(errs, fmt.Sprintf("spec.logging.syslog.facility %q is not supported", s.Facility))
+		}
+		if s.Tag != "" && !syslogTagRegexp.MatchString(s.Tag) {
+			errs = append(errs, fmt.Sprintf("spec.logging.syslog.tag %q must have up to 32 alphanumeric characters or underscores", s.Tag))
+		}
+	}
+	if f := l.FluentBit; f != nil {
+		if f.Output == "" {
+			errs = append(errs, "spec.logging.fluentBit.output is required")
+		}
+		for _, k := range sortedKeys(f.Properties) {
+			if k == "" || strings.ContainsAny(k, "= \t\n") {
+				errs = append(errs, fmt.Sprintf("spec.logging.fluentBit.properties key %q is invalid", k))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLogging(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Logging = &v1alpha1.NginxLogging{}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, "access_log /dev/stdout combined;\nerror_log stderr error;\n", annotations[loggingConfigAnnotation])
+	assert.Empty(t, annotations[httpConfigAnnotation])
+	assert.Contains(t, defaultServer(&nginx), "    include /etc/nginx-operator/logging.conf;\n")
+	assert.NotContains(t, defaultServer(&nginx), "http.conf")
+
+	nginx.Spec.Logging = &v1alpha1.NginxLogging{
+		Format:        v1alpha1.LogFormatJSON,
+		ErrorLogLevel: "warn",
+		Syslog:        &v1alpha1.NginxSyslog{Server: "syslog.logging:514"},
+	}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations = dep.Spec.Template.Annotations
+	assert.Equal(t, "log_format nginx_operator escape=json "+jsonLogFormat+";\n", annotations[httpConfigAnnotation])
+	assert.Equal(t, "access_log syslog:server=syslog.logging:514,facility=local7,tag=nginx nginx_operator;\n"+
+		"error_log stderr warn;\n", annotations[loggingConfigAnnotation])
+	assert.Contains(t, defaultServer(&nginx), "include /etc/nginx-operator/http.conf;\n")
+	assert.Len(t, dep.Spec.Template.Spec.Containers, 1)
+
+	nginx.Spec.Logging = &v1alpha1.NginxLogging{
+		Format:       v1alpha1.LogFormatCustom,
+		CustomFormat: `$remote_addr "$request" $status`,
+		FluentBit: &v1alpha1.NginxFluentBit{
+			Output:     "forward",
+			Properties: map[string]string{"port": "24224", "host": "fluentd.logging"},
+		},
+	}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations = dep.Spec.Template.Annotations
+	assert.Equal(t, `log_format nginx_operator "$remote_addr \"$request\" $status";`+"\n", annotations[httpConfigAnnotation])
+	assert.Equal(t, "access_log syslog:server=127.0.0.1:5140,tag=nginx nginx_operator;\nerror_log stderr error;\n", annotations[loggingConfigAnnotation])
+	if assert.Len(t, dep.Spec.Template.Spec.Containers, 2) {
+		assert.Equal(t, corev1.Container{
+			Name:  "fluent-bit",
+			Image: "fluent/fluent-bit:1.9.10",
+			Args: []string{
+				"-R", "/fluent-bit/etc/parsers.conf",
+				"-i", "syslog", "-p", "mode=udp", "-p", "listen=127.0.0.1", "-p", "port=5140", "-p", "parser=syslog-rfc3164",
+				"-o", "forward", "-m", "*", "-p", "host=fluentd.logging", "-p", "port=24224",
+			},
+		}, dep.Spec.Template.Spec.Containers[1])
+	}
+}
+
+func TestValidateLogging(t *testing.T) {
+	tests := []struct {
+		name    string
+		logging *v1alpha1.NginxLogging
+		want    []string
+	}{
+		{name: "none"},
+		{name: "defaults", logging: &v1alpha1.NginxLogging{}},
+		{
+			name: "syslog",
+			logging: &v1alpha1.NginxLogging{
+				Format:        v1alpha1.LogFormatJSON,
+				ErrorLogLevel: "debug",
+				Syslog:        &v1alpha1.NginxSyslog{Server: "unix:/var/log/nginx.sock", Facility: "local0", Tag: "edge_nginx"},
+			},
+		},
+		{
+			name: "fluent-bit",
+			logging: &v1alpha1.NginxLogging{
+				Format:       v1alpha1.LogFormatCustom,
+				CustomFormat: "$remote_addr $status",
+				FluentBit:    &v1alpha1.NginxFluentBit{Output: "es", Properties: map[string]string{"host": "es.logging"}},
+			},
+		},
+		{
+			name: "invalid",
+			logging: &v1alpha1.NginxLogging{
+				Format:        "xml",
+				ErrorLogLevel: "verbose",
+				Syslog:        &v1alpha1.NginxSyslog{Server: "syslog:514,tag=x", Facility: "local8", Tag: "edge-nginx"},
+				FluentBit:     &v1alpha1.NginxFluentBit{Properties: map[string]string{"host name": "es"}},
+			},
+			want: []string{
+				`spec.logging.format "xml" is not supported`,
+				`spec.logging.errorLogLevel "verbose" is not supported`,
+				"spec.logging must not set both syslog and fluentBit",
+				`spec.logging.syslog.server "syslog:514,tag=x" must not contain whitespace, commas, braces or semicolons`,
+				`spec.logging.syslog.facility "local8" is not supported`,
+				`spec.logging.syslog.tag "edge-nginx" must have up to 32 alphanumeric characters or underscores`,
+				"spec.logging.fluentBit.output is required",
+				`spec.logging.fluentBit.properties key "host name" is invalid`,
+			},
+		},
+		{
+			name:    "custom format",
+			logging: &v1alpha1.NginxLogging{Format: v1alpha1.LogFormatCustom, Syslog: &v1alpha1.NginxSyslog{}},
+			want: []string{
+				"spec.logging.customFormat is required by the custom format",
+				"spec.logging.syslog.server is required",
+			},
+		},
+		{
+			name:    "custom format without custom",
+			logging: &v1alpha1.NginxLogging{CustomFormat: "$status"},
+			want:    []string{"spec.logging.customFormat requires the custom format"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateLogging(&v1alpha1.NginxSpec{Logging: tt.logging}))
+		})
+	}
+}
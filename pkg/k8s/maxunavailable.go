@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// defaultRollingMaxUnavailable is the maxUnavailable of the rolling updates
+// of Deployments and Argo Rollouts when none is specified
+var defaultRollingMaxUnavailable = intstr.FromString("25%")
+
+// MaxUnavailable returns how many pods of the nginx can be unavailable
+// because of the operator actions for the given desired replicas, and
+// whether spec.maxUnavailable is set. Percentages are rounded down, like the
+// maxUnavailable of Deployments.
+func MaxUnavailable(spec *v1alpha1.NginxSpec, replicas int32) (int32, bool) {
+	if spec.MaxUnavailable == nil {
+		return 0, false
+	}
+	v, err := intstr.GetValueFromIntOrPercent(spec.MaxUnavailable, int(replicas), false)
+	if err != nil || v < 0 {
+		return 0, true
+	}
+	return int32(v), true
+}
+
+// UnavailablePods returns how many pods of the nginx are unavailable, the
+// ones missing to reach the desired replicas or not ready. The pods that
+// exist count as desired too, so replicas set by an autoscaler are taken
+// into account. Terminating pods are left out.
+func UnavailablePods(replicas int32, pods []corev1.Pod) int32 {
+	var existing, ready int32
+	for i := range pods {
+		if pods[i].DeletionTimestamp != nil {
+			continue
+		}
+		existing++
+		if CanaryPodReady(&pods[i]) {
+			ready++
+		}
+	}
+	if existing > replicas {
+		replicas = existing
+	}
+	return replicas - ready
+}
+
+// RemainingUnavailable returns how many more pods of the nginx the operator
+// can take down without exceeding spec.maxUnavailable, given its current
+// pods, and whether spec.maxUnavailable is set
+func RemainingUnavailable(spec *v1alpha1.NginxSpec, pods []corev1.Pod) (int32, bool) {
+	replicas := replicasOf(spec.Replicas)
+	limit, ok := MaxUnavailable(spec, replicas)
+	if !ok {
+		return 0, false
+	}
+	remaining := limit - UnavailablePods(replicas, pods)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// limitMaxUnavailable returns the lowest of the given rolling update
+// maxUnavailable and spec.maxUnavailable, resolved for the given replicas.
+// The given value is returned as is when spec.maxUnavailable is not set.
+func limitMaxUnavailable(spec *v1alpha1.NginxSpec, current *intstr.IntOrString, replicas int32) *intstr.IntOrString {
+	limit, ok := MaxUnavailable(spec, replicas)
+	if !ok {
+		return current
+	}
+	if current == nil {
+		current = &defaultRollingMaxUnavailable
+	}
+	v, err := intstr.GetValueFromIntOrPercent(current, int(replicas), false)
+	if err == nil && int32(v) < limit {
+		limit = int32(v)
+	}
+	result := intstr.FromInt(int(limit))
+	return &result
+}
+
+// setupMaxUnavailable limits the pods taken down by the rolling updates of
+// the deployment to spec.maxUnavailable
+func setupMaxUnavailable(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if spec.MaxUnavailable == nil || dep.Spec.Strategy.Type == appv1.RecreateDeploymentStrategyType {
+		return
+	}
+	strategy := &dep.Spec.Strategy
+	strategy.Type = appv1.RollingUpdateDeploymentStrategyType
+	if strategy.RollingUpdate == nil {
+		strategy.RollingUpdate = &appv1.RollingUpdateDeployment{}
+	} else {
+		strategy.RollingUpdate = strategy.RollingUpdate.DeepCopy()
+	}
+	strategy.RollingUpdate.MaxUnavailable = limitMaxUnavailable(spec, strategy.RollingUpdate.MaxUnavailable, replicasOf(dep.Spec.Replicas))
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// validateMaxUnavailable returns the errors found in spec.maxUnavailable
+func validateMaxUnavailable(spec *v1alpha1.NginxSpec) []string {
+	if spec.MaxUnavailable == nil {
+		return nil
+	}
+	v, errs := rollingUpdateValue("spec.maxUnavailable", spec.MaxUnavailable)
+	if len(errs) > 0 {
+		return errs
+	}
+	if s := spec.Strategy; s != nil {
+		if s.Type == appv1.RecreateDeploymentStrategyType {
+			errs = append(errs, "spec.maxUnavailable cannot be used with strategy type Recreate, which stops all the pods at once")
+		}
+		if ru := s.RollingUpdate; ru != nil && ru.MaxSurge != nil {
+			if surge, _ := rollingUpdateValue("", ru.MaxSurge); surge == 0 {
+				errs = append(errs, "spec.maxUnavailable requires spec.strategy.rollingUpdate.maxSurge to be greater than zero")
+			}
+		}
+	}
+	switch spec.WorkloadKind {
+	case v1alpha1.WorkloadKindStatefulSet, v1alpha1.WorkloadKindDaemonSet:
+		if v == 0 {
+			errs = append(errs, fmt.Sprintf("spec.maxUnavailable must be greater than zero with workload kind %s, which replaces pods without surge", spec.WorkloadKind))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,163 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestMaxUnavailable(t *testing.T) {
+	tests := []struct {
+		value    *intstr.IntOrString
+		replicas int32
+		want     int32
+		set      bool
+	}{
+		{replicas: 4},
+		{value: intOrString(intstr.FromInt(2)), replicas: 4, want: 2, set: true},
+		{value: intOrString(intstr.FromString("25%")), replicas: 4, want: 1, set: true},
+		{value: intOrString(intstr.FromString("25%")), replicas: 3, want: 0, set: true},
+		{value: intOrString(intstr.FromString("50%")), replicas: 5, want: 2, set: true},
+	}
+	for _, tt := range tests {
+		got, set := MaxUnavailable(&v1alpha1.NginxSpec{MaxUnavailable: tt.value}, tt.replicas)
+		assert.Equal(t, tt.want, got, "%v of %d", tt.value, tt.replicas)
+		assert.Equal(t, tt.set, set, "%v of %d", tt.value, tt.replicas)
+	}
+}
+
+func TestUnavailablePods(t *testing.T) {
+	ready := corev1.Pod{Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}}}
+	notReady := corev1.Pod{}
+	terminating := *ready.DeepCopy()
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	assert.Equal(t, int32(3), UnavailablePods(3, nil))
+	assert.Equal(t, int32(0), UnavailablePods(2, []corev1.Pod{ready, ready}))
+	assert.Equal(t, int32(1), UnavailablePods(2, []corev1.Pod{ready, terminating}))
+	assert.Equal(t, int32(1), UnavailablePods(2, []corev1.Pod{ready, notReady}))
+	assert.Equal(t, int32(1), UnavailablePods(1, []corev1.Pod{ready, ready, notReady}))
+
+	replicas := int32(4)
+	spec := &v1alpha1.NginxSpec{Replicas: &replicas, MaxUnavailable: intOrString(intstr.FromInt(2))}
+	remaining, ok := RemainingUnavailable(spec, []corev1.Pod{ready, ready, ready, notReady})
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), remaining)
+	remaining, _ = RemainingUnavailable(spec, []corev1.Pod{ready, notReady})
+	assert.Equal(t, int32(0), remaining)
+	_, ok = RemainingUnavailable(&v1alpha1.NginxSpec{}, nil)
+	assert.False(t, ok)
+}
+
+func TestSetupMaxUnavailable(t *testing.T) {
+	nginx := baseNginx()
+	replicas := int32(10)
+	nginx.Spec.Replicas = &replicas
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, appv1.DeploymentStrategy{}, dep.Spec.Strategy)
+
+	nginx.Spec.MaxUnavailable = intOrString(intstr.FromString("10%"))
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, appv1.RollingUpdateDeploymentStrategyType, dep.Spec.Strategy.Type)
+	assert.Equal(t, intOrString(intstr.FromInt(1)), dep.Spec.Strategy.RollingUpdate.MaxUnavailable)
+	assert.Nil(t, dep.Spec.Strategy.RollingUpdate.MaxSurge)
+
+	surge := intstr.FromInt(3)
+	nginx.Spec.MaxUnavailable = intOrString(intstr.FromInt(5))
+	nginx.Spec.Strategy = &appv1.DeploymentStrategy{RollingUpdate: &appv1.RollingUpdateDeployment{
+		MaxUnavailable: intOrString(intstr.FromString("20%")),
+		MaxSurge:       &surge,
+	}}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, intOrString(intstr.FromInt(2)), dep.Spec.Strategy.RollingUpdate.MaxUnavailable)
+	assert.Equal(t, &surge, dep.Spec.Strategy.RollingUpdate.MaxSurge)
+	assert.Equal(t, intOrString(intstr.FromString("20%")), nginx.Spec.Strategy.RollingUpdate.MaxUnavailable)
+
+	nginx.Spec.Strategy = &appv1.DeploymentStrategy{Type: appv1.RecreateDeploymentStrategyType}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Nil(t, dep.Spec.Strategy.RollingUpdate)
+}
+
+func TestMaxUnavailableWorkloads(t *testing.T) {
+	nginx := baseNginx()
+	replicas := int32(8)
+	nginx.Spec.Replicas = &replicas
+	nginx.Spec.MaxUnavailable = intOrString(intstr.FromString("50%"))
+
+	ds, err := NewDaemonSet(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, appv1.RollingUpdateDaemonSetStrategyType, ds.Spec.UpdateStrategy.Type)
+	assert.Equal(t, intOrString(intstr.FromString("50%")), ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable)
+
+	nginx.Spec.Rollout = &v1alpha1.NginxRollout{}
+	rollout, err := NewRollout(&nginx)
+	assert.Nil(t, err)
+	v, ok := unstructured.NestedInt64(rollout.Object, "spec", "strategy", "canary", "maxUnavailable")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), v)
+
+	nginx.Spec.MaxUnavailable = nil
+	rollout, err = NewRollout(&nginx)
+	assert.Nil(t, err)
+	_, ok = unstructured.NestedInt64(rollout.Object, "spec", "strategy", "canary", "maxUnavailable")
+	assert.False(t, ok)
+}
+
+func TestValidateMaxUnavailable(t *testing.T) {
+	zero := intstr.FromInt(0)
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "not-set"},
+		{name: "valid", spec: v1alpha1.NginxSpec{MaxUnavailable: intOrString(intstr.FromString("10%"))}},
+		{name: "zero-deployment", spec: v1alpha1.NginxSpec{MaxUnavailable: &zero}},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{MaxUnavailable: intOrString(intstr.FromString("ten"))},
+			want: []string{`spec.maxUnavailable "ten" must be a number or a percentage between 0% and 100%`},
+		},
+		{
+			name: "recreate",
+			spec: v1alpha1.NginxSpec{
+				MaxUnavailable: intOrString(intstr.FromInt(1)),
+				Strategy:       &appv1.DeploymentStrategy{Type: appv1.RecreateDeploymentStrategyType},
+			},
+			want: []string{"spec.maxUnavailable cannot be used with strategy type Recreate, which stops all the pods at once"},
+		},
+		{
+			name: "no-surge",
+			spec: v1alpha1.NginxSpec{
+				MaxUnavailable: &zero,
+				Strategy:       &appv1.DeploymentStrategy{RollingUpdate: &appv1.RollingUpdateDeployment{MaxSurge: &zero}},
+			},
+			want: []string{"spec.maxUnavailable requires spec.strategy.rollingUpdate.maxSurge to be greater than zero"},
+		},
+		{
+			name: "zero-daemonset",
+			spec: v1alpha1.NginxSpec{MaxUnavailable: intOrString(intstr.FromString("0%")), WorkloadKind: v1alpha1.WorkloadKindDaemonSet},
+			want: []string{"spec.maxUnavailable must be greater than zero with workload kind DaemonSet, which replaces pods without surge"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateMaxUnavailable(&tt.spec))
+		})
+	}
+}
+
+func intOrString(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
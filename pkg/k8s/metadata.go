@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// reservedKeyPrefix is the prefix of the labels and annotations managed by
+// the operator
+const reservedKeyPrefix = "nginx.tsuru.io/"
+
+// reservedLabels are the labels set by the operator to select the nginx
+// objects and pods, which cannot be overridden
+var reservedLabels = map[string]bool{
+	"nginx_cr":           true,
+	"app":                true,
+	FlaggerSelectorLabel: true,
+}
+
+// setupMetadata adds the custom labels and annotations to the deployment and
+// its pod template. The pods also get the ones of spec.podTemplate, which
+// take precedence over spec.labels and spec.annotations.
+func setupMetadata(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	setCustomMetadata(spec, dep)
+	template := &dep.Spec.Template
+	template.Labels = mergeMetadata(template.Labels, spec.Labels, spec.PodTemplate.Labels)
+	template.Annotations = mergeMetadata(template.Annotations, spec.Annotations, spec.PodTemplate.Annotations)
+}
+
+// setCustomMetadata adds spec.labels and spec.annotations to an object
+// generated for the nginx, keeping the ones set by the operator
+func setCustomMetadata(spec *v1alpha1.NginxSpec, o metav1.Object) {
+	o.SetLabels(mergeMetadata(o.GetLabels(), spec.Labels))
+	o.SetAnnotations(mergeMetadata(o.GetAnnotations(), spec.Annotations))
+}
+
+// mergeMetadata returns the generated labels or annotations with the custom
+// ones added, later ones overriding earlier ones. The generated ones are
+// never overridden.
+func mergeMetadata(generated map[string]string, custom ...map[string]string) map[string]string {
+	size := len(generated)
+	for _, c := range custom {
+		size += len(c)
+	}
+	if size == len(generated) {
+		return generated
+	}
+	result := make(map[string]string, size)
+	for _, c := range custom {
+		for k, v := range c {
+			result[k] = v
+		}
+	}
+	for k, v := range generated {
+		result[k] = v
+	}
+	return result
+}
+
+// MetadataDrift returns whether the current object lacks any of the labels
+// and annotations of the desired one. Labels and annotations only found in
+// the current object, like the ones set by other controllers, are not taken
+// into account.
+func MetadataDrift(desired, current metav1.Object) bool {
+	return !containsAll(current.GetLabels(), desired.GetLabels()) ||
+		!containsAll(current.GetAnnotations(), desired.GetAnnotations())
+}
+
+// MergeMetadata copies the labels and annotations of the desired object into
+// the current one. Custom labels and annotations removed from the nginx are
+// left in the existing objects.
+func MergeMetadata(current, desired metav1.Object) {
+	current.SetLabels(mergeMetadata(desired.GetLabels(), current.GetLabels()))
+	current.SetAnnotations(mergeMetadata(desired.GetAnnotations(), current.GetAnnotations()))
+}
+
+func containsAll(m, subset map[string]string) bool {
+	for k, v := range subset {
+		if cur, ok := m[k]; !ok || cur != v {
+			return false
+		}
+	}
+	return true
+}
+
+// validateMetadata returns the errors found in the custom labels and
+// annotations
+func validateMetadata(spec *v1alpha1.NginxSpec) []string {
+	var errs []string
+	errs = append(errs, validateLabels("spec.labels", spec.Labels)...)
+	errs = append(errs, validateAnnotations("spec.annotations", spec.Annotations)...)
+	errs = append(errs, validateLabels("spec.podTemplate.labels", spec.PodTemplate.Labels)...)
+	errs = append(errs, validateAnnotations("spec.podTemplate.annotations", spec.PodTemplate.Annotations)...)
+	return errs
+}
+
+func validateLabels(field string, labels map[string]string) []string {
+	var errs []string
+	for _, k := range sortedKeys(labels) {
+		errs = append(errs, validateMetadataKey(field, k)...)
+		if reservedLabels[k] {
+			errs = append(errs, fmt.Sprintf("%s key %q is reserved by the operator", field, k))
+		}
+		if msgs := validation.IsValidLabelValue(labels[k]); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s[%q] value %q is invalid: %s", field, k, labels[k], strings.Join(msgs, ", ")))
+		}
+	}
+	return errs
+}
+
+func validateAnnotations(field string, annotations map[string]string) []string {
+	var errs []string
+	for _, k := range sortedKeys(annotations) {
+		errs = append(errs, validateMetadataKey(field, k)...)
+	}
+	return errs
+}
+
+func validateMetadataKey(field, key string) []string {
+	if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+		return []string{fmt.Sprintf("%s key %q is invalid: %s", field, key, strings.Join(msgs, ", "))}
+	}
+	if strings.HasPrefix(key, reservedKeyPrefix) {
+		return []string{fmt.Sprintf("%s key %q is reserved by the operator", field, key)}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCustomMetadata(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Labels = map[string]string{"team": "edge", "cost-center": "cdn", "app": "ignored"}
+	nginx.Spec.Annotations = map[string]string{"example.com/owner": "edge@example.com"}
+	nginx.Spec.PodTemplate.Labels = map[string]string{"cost-center": "cdn-pods"}
+	nginx.Spec.PodTemplate.Annotations = map[string]string{"sidecar.istio.io/inject": "true"}
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{Headless: true}
+	nginx.Spec.Ingress = &v1alpha1.NginxIngress{}
+
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"team": "edge", "cost-center": "cdn", "app": "ignored"}, dep.Labels)
+	assert.Equal(t, "edge@example.com", dep.Annotations["example.com/owner"])
+	assert.NotEmpty(t, dep.Annotations[TemplateHashAnnotation])
+	assert.Equal(t, map[string]string{"nginx_cr": "my-nginx", "app": "nginx", "team": "edge", "cost-center": "cdn-pods"}, dep.Spec.Template.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "edge@example.com", "sidecar.istio.io/inject": "true"}, dep.Spec.Template.Annotations)
+	assert.Equal(t, LabelsForNginx("my-nginx"), dep.Spec.Selector.MatchLabels)
+
+	service := NewService(&nginx)
+	assert.Equal(t, map[string]string{"nginx_cr": "my-nginx", "app": "nginx", "team": "edge", "cost-center": "cdn"}, service.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "edge@example.com"}, service.Annotations)
+	assert.Equal(t, LabelsForNginx("my-nginx"), service.Spec.Selector)
+	assert.Equal(t, service.Labels, NewHeadlessService(&nginx).Labels)
+	assert.Equal(t, service.Annotations, NewHeadlessService(&nginx).Annotations)
+	assert.Equal(t, service.Labels, NewIngress(&nginx).Labels)
+
+	ds, err := NewDaemonSet(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, dep.Labels, ds.Labels)
+	rollout, err := NewRollout(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, dep.Labels, rollout.GetLabels())
+	assert.Equal(t, "edge@example.com", rollout.GetAnnotations()["example.com/owner"])
+
+	previous := dep.Annotations[TemplateHashAnnotation]
+	nginx.Spec.PodTemplate.Annotations = nil
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotEqual(t, previous, dep.Annotations[TemplateHashAnnotation])
+}
+
+func TestMetadataDrift(t *testing.T) {
+	desired := &metav1.ObjectMeta{
+		Labels:      map[string]string{"app": "nginx", "team": "edge"},
+		Annotations: map[string]string{"example.com/owner": "edge"},
+	}
+	current := &metav1.ObjectMeta{
+		Labels:      map[string]string{"app": "nginx", "team": "edge", "other": "x"},
+		Annotations: map[string]string{"example.com/owner": "edge", "deployment.kubernetes.io/revision": "2"},
+	}
+	assert.False(t, MetadataDrift(desired, current))
+
+	current.Labels["team"] = "core"
+	delete(current.Annotations, "example.com/owner")
+	assert.True(t, MetadataDrift(desired, current))
+
+	MergeMetadata(current, desired)
+	assert.False(t, MetadataDrift(desired, current))
+	assert.Equal(t, map[string]string{"app": "nginx", "team": "edge", "other": "x"}, current.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "edge", "deployment.kubernetes.io/revision": "2"}, current.Annotations)
+}
+
+func TestValidateMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "none"},
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{
+				Labels:      map[string]string{"team": "edge", "example.com/cost-center": "cdn"},
+				Annotations: map[string]string{"example.com/owner": "Edge team <edge@example.com>"},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{
+					Labels:      map[string]string{"version": "v2"},
+					Annotations: map[string]string{"sidecar.istio.io/inject": "true"},
+				},
+			},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{
+				Labels:      map[string]string{"app": "web", "team": "edge team", "-team": "edge"},
+				Annotations: map[string]string{"nginx.tsuru.io/restart": "now"},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{
+					Labels: map[string]string{"nginx_cr": "other", "nginx.tsuru.io/track": "canary"},
+				},
+			},
+			want: []string{
+				`spec.labels key "-team" is invalid: name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')`,
+				`spec.labels key "app" is reserved by the operator`,
+				`spec.labels["team"] value "edge team" is invalid: a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')`,
+				`spec.annotations key "nginx.tsuru.io/restart" is reserved by the operator`,
+				`spec.podTemplate.labels key "nginx.tsuru.io/track" is reserved by the operator`,
+				`spec.podTemplate.labels key "nginx_cr" is reserved by the operator`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateMetadata(&tt.spec))
+		})
+	}
+}
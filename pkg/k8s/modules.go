@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	modulesVolume = "nginx-modules"
+
+	// Mount path of the shared objects of the modules in the nginx container
+	// and in the init containers copying them
+	modulesMountPath = "/etc/nginx-modules"
+)
+
+// moduleFilePattern matches the file names of shared objects that can be
+// safely quoted in the -g flag and in the reload script
+var moduleFilePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+\.so$`)
+
+// moduleDirectives returns the load_module directives of the modules, in
+// order
+func moduleDirectives(modules []v1alpha1.NginxModule) []string {
+	var directives []string
+	for _, m := range modules {
+		for _, f := range m.Files {
+			directives = append(directives, fmt.Sprintf("load_module %s/%s;", modulesMountPath, path.Base(f)))
+		}
+	}
+	return directives
+}
+
+// setupModules adds the volume holding the shared objects of the modules,
+// mounted read-only in the nginx container, and an init container per
+// module copying them from its image. They are loaded through the -g flag.
+func setupModules(modules []v1alpha1.NginxModule, dep *appv1.Deployment) {
+	if len(modules) == 0 {
+		return
+	}
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         modulesVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      modulesVolume,
+		MountPath: modulesMountPath,
+		ReadOnly:  true,
+	})
+	for _, m := range modules {
+		command := append([]string{"cp"}, m.Files...)
+		podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+			Name:    "module-" + m.Name,
+			Image:   m.Image,
+			Command: append(command, modulesMountPath+"/"),
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: modulesVolume, MountPath: modulesMountPath},
+			},
+		})
+	}
+}
+
+// validateModules returns the errors found in the modules
+func validateModules(modules []v1alpha1.NginxModule) []string {
+	var errs []string
+	names := make(map[string]bool)
+	files := make(map[string]bool)
+	for i, m := range modules {
+		field := fmt.Sprintf("spec.modules[%d]", i)
+		if m.Name == "" {
+			errs = append(errs, fmt.Sprintf("%s.name is required", field))
+		} else if msgs := validation.IsDNS1123Label("module-" + m.Name); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s.name %q is invalid: %s", field, m.Name, strings.Join(msgs, ", ")))
+		}
+		if names[m.Name] {
+			errs = append(errs, fmt.Sprintf("%s.name %q is duplicated", field, m.Name))
+		}
+		names[m.Name] = true
+		if m.Image == "" {
+			errs = append(errs, fmt.Sprintf("%s.image is required", field))
+		}
+		if len(m.Files) == 0 {
+			errs = append(errs, fmt.Sprintf("%s.files must not be empty", field))
+		}
+		for j, f := range m.Files {
+			base := path.Base(f)
+			switch {
+			case !path.IsAbs(f) || !moduleFilePattern.MatchString(base):
+				errs = append(errs, fmt.Sprintf("%s.files[%d] %q must be the absolute path of a .so file", field, j, f))
+			case files[base]:
+				errs = append(errs, fmt.Sprintf("%s.files[%d] %q has the same file name as another module file", field, j, f))
+			}
+			files[base] = true
+		}
+	}
+	return errs
+}
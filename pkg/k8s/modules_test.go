@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestModules(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Modules = []v1alpha1.NginxModule{
+		{
+			Name:  "brotli",
+			Image: "example/nginx-brotli:1.25",
+			Files: []string{"/usr/lib/nginx/modules/ngx_http_brotli_filter_module.so", "/usr/lib/nginx/modules/ngx_http_brotli_static_module.so"},
+		},
+		{Name: "headers-more", Image: "example/nginx-headers-more:1.25", Files: []string{"/modules/ngx_http_headers_more_filter_module.so"}},
+	}
+	nginx.Spec.NginxArgs = &v1alpha1.NginxArgs{Globals: []string{"worker_processes 4"}}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	podSpec := dep.Spec.Template.Spec
+	globals := "daemon off; " +
+		"load_module /etc/nginx-modules/ngx_http_brotli_filter_module.so; " +
+		"load_module /etc/nginx-modules/ngx_http_brotli_static_module.so; " +
+		"load_module /etc/nginx-modules/ngx_http_headers_more_filter_module.so; " +
+		"worker_processes 4;"
+	assert.Equal(t, []string{"nginx", "-g", globals}, podSpec.Containers[0].Command)
+	assert.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name:         "nginx-modules",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "nginx-modules", MountPath: "/etc/nginx-modules", ReadOnly: true})
+	assert.Equal(t, []corev1.Container{
+		{
+			Name:  "module-brotli",
+			Image: "example/nginx-brotli:1.25",
+			Command: []string{"cp", "/usr/lib/nginx/modules/ngx_http_brotli_filter_module.so",
+				"/usr/lib/nginx/modules/ngx_http_brotli_static_module.so", "/etc/nginx-modules/"},
+			VolumeMounts: []corev1.VolumeMount{{Name: "nginx-modules", MountPath: "/etc/nginx-modules"}},
+		},
+		{
+			Name:         "module-headers-more",
+			Image:        "example/nginx-headers-more:1.25",
+			Command:      []string{"cp", "/modules/ngx_http_headers_more_filter_module.so", "/etc/nginx-modules/"},
+			VolumeMounts: []corev1.VolumeMount{{Name: "nginx-modules", MountPath: "/etc/nginx-modules"}},
+		},
+	}, podSpec.InitContainers)
+
+	job, err := NewConfigCheckJob(&nginx, dep, ConfigCheckOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nginx", "-t", "-g", globals}, job.Spec.Template.Spec.Containers[0].Command)
+	assert.Len(t, job.Spec.Template.Spec.InitContainers, 2)
+
+	nginx.Spec.NginxArgs = nil
+	nginx.Spec.Modules = nginx.Spec.Modules[1:]
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nginx", "-g", "daemon off; load_module /etc/nginx-modules/ngx_http_headers_more_filter_module.so;"},
+		dep.Spec.Template.Spec.Containers[0].Command)
+}
+
+func TestValidateModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []v1alpha1.NginxModule
+		want    []string
+	}{
+		{name: "none"},
+		{
+			name: "valid",
+			modules: []v1alpha1.NginxModule{
+				{Name: "brotli", Image: "example/brotli", Files: []string{"/modules/ngx_http_brotli_filter_module.so", "/modules/ngx_http_brotli_static_module.so"}},
+				{Name: "otel", Image: "example/otel", Files: []string{"/usr/lib/nginx/modules/ngx_otel_module.so"}},
+			},
+		},
+		{
+			name: "invalid",
+			modules: []v1alpha1.NginxModule{
+				{Image: "example/brotli", Files: []string{"modules/brotli.so", "/modules/brotli.o", "/modules/it's.so"}},
+				{Name: "Lua"},
+				{Name: "lua", Image: "example/lua", Files: []string{"/a/ndk.so", "/b/ndk.so"}},
+				{Name: "lua", Image: "example/lua", Files: []string{"/a/lua.so"}},
+			},
+			want: []string{
+				"spec.modules[0].name is required",
+				`spec.modules[0].files[0] "modules/brotli.so" must be the absolute path of a .so file`,
+				`spec.modules[0].files[1] "/modules/brotli.o" must be the absolute path of a .so file`,
+				`spec.modules[0].files[2] "/modules/it's.so" must be the absolute path of a .so file`,
+				`spec.modules[1].name "Lua" is invalid: a DNS-1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')`,
+				"spec.modules[1].image is required",
+				"spec.modules[1].files must not be empty",
+				`spec.modules[2].files[1] "/b/ndk.so" has the same file name as another module file`,
+				`spec.modules[3].name "lua" is duplicated`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateModules(tt.modules))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultImageAnnotation is the namespace annotation holding the image
+	// used by nginx objects in the namespace that do not set one
+	DefaultImageAnnotation = "nginx.tsuru.io/default-image"
+
+	// DefaultTLSSecretAnnotation is the namespace annotation holding the name
+	// of the TLS secret used by nginx objects in the namespace that do not set one
+	DefaultTLSSecretAnnotation = "nginx.tsuru.io/default-tls-secret"
+
+	// DefaultResourcesAnnotation is the namespace annotation holding, as JSON,
+	// the resource requirements of the nginx container used by nginx objects
+	// in the namespace that do not set them
+	DefaultResourcesAnnotation = "nginx.tsuru.io/default-resources"
+)
+
+// WithNamespaceDefaults returns a copy of the spec with the defaults set in
+// the namespace annotations applied to the fields left empty. The receiver is
+// never modified.
+func WithNamespaceDefaults(spec *v1alpha1.NginxSpec, annotations map[string]string) (*v1alpha1.NginxSpec, error) {
+	out := spec.DeepCopy()
+	if image := annotations[DefaultImageAnnotation]; image != "" && out.Image == "" {
+		out.Image = image
+	}
+	if secret := annotations[DefaultTLSSecretAnnotation]; secret != "" && out.TLSSecret == nil {
+		out.TLSSecret = &v1alpha1.TLSSecret{SecretName: secret}
+	}
+	if data := annotations[DefaultResourcesAnnotation]; data != "" && resourcesEmpty(out.PodTemplate.Resources) {
+		var resources corev1.ResourceRequirements
+		if err := json.Unmarshal([]byte(data), &resources); err != nil {
+			return nil, fmt.Errorf("invalid %s namespace annotation: %v", DefaultResourcesAnnotation, err)
+		}
+		out.PodTemplate.Resources = resources
+	}
+	return out, nil
+}
+
+func resourcesEmpty(r corev1.ResourceRequirements) bool {
+	return len(r.Limits) == 0 && len(r.Requests) == 0
+}
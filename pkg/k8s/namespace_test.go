@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestWithNamespaceDefaults(t *testing.T) {
+	defaults := map[string]string{
+		DefaultImageAnnotation:     "tsuru/nginx:1.14",
+		DefaultTLSSecretAnnotation: "wildcard-cert",
+		DefaultResourcesAnnotation: `{"limits": {"cpu": "500m"}}`,
+	}
+	tests := []struct {
+		name        string
+		spec        v1alpha1.NginxSpec
+		annotations map[string]string
+		want        v1alpha1.NginxSpec
+		wantErr     bool
+	}{
+		{
+			name: "no-annotations",
+			spec: v1alpha1.NginxSpec{},
+			want: v1alpha1.NginxSpec{},
+		},
+		{
+			name:        "empty-fields-are-defaulted",
+			spec:        v1alpha1.NginxSpec{},
+			annotations: defaults,
+			want: v1alpha1.NginxSpec{
+				Image:     "tsuru/nginx:1.14",
+				TLSSecret: &v1alpha1.TLSSecret{SecretName: "wildcard-cert"},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+					},
+				},
+			},
+		},
+		{
+			name: "set-fields-are-kept",
+			spec: v1alpha1.NginxSpec{
+				Image:     "custom",
+				TLSSecret: &v1alpha1.TLSSecret{SecretName: "own-cert"},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+					},
+				},
+			},
+			annotations: defaults,
+			want: v1alpha1.NginxSpec{
+				Image:     "custom",
+				TLSSecret: &v1alpha1.TLSSecret{SecretName: "own-cert"},
+				PodTemplate: v1alpha1.NginxPodTemplateSpec{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+					},
+				},
+			},
+		},
+		{
+			name:        "invalid-resources",
+			spec:        v1alpha1.NginxSpec{},
+			annotations: map[string]string{DefaultResourcesAnnotation: "500m"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := tt.spec.DeepCopy()
+			got, err := WithNamespaceDefaults(&tt.spec, tt.annotations)
+			assert.Equal(t, orig, &tt.spec)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, &tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// NewNetworkPolicy assembles the NetworkPolicy of the Nginx pods, allowing
+// the traffic to the ports of its service. It returns nil if no policy was
+// requested.
+func NewNetworkPolicy(n *v1alpha1.Nginx) *networkingv1.NetworkPolicy {
+	if n.Spec.NetworkPolicy == nil {
+		return nil
+	}
+	spec := n.Spec.WithDefaults().NetworkPolicy
+	var ports []networkingv1.NetworkPolicyPort
+	for _, p := range NewService(n).Spec.Ports {
+		protocol, port := p.Protocol, p.TargetPort
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+	policy := &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n.Name + "-network-policy",
+			Namespace: n.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+			Labels: LabelsForNginx(n.Name),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: LabelsForNginx(n.Name),
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{Ports: ports, From: spec.From},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	if len(spec.Egress) > 0 {
+		// Upstreams are usually reached by their service names
+		udp, tcp, dns := corev1.ProtocolUDP, corev1.ProtocolTCP, intstr.FromInt(53)
+		policy.Spec.Egress = append(spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &udp, Port: &dns},
+				{Protocol: &tcp, Port: &dns},
+			},
+		})
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+	}
+	setCustomMetadata(&n.Spec, policy)
+	return policy
+}
+
+// validateNetworkPolicy returns the errors found in the network policy
+func validateNetworkPolicy(spec *v1alpha1.NginxSpec) []string {
+	policy := spec.NetworkPolicy
+	if policy == nil {
+		return nil
+	}
+	var errs []string
+	for i, peer := range policy.From {
+		errs = append(errs, validateNetworkPolicyPeer(fmt.Sprintf("spec.networkPolicy.from[%d]", i), peer)...)
+	}
+	for i, rule := range policy.Egress {
+		field := fmt.Sprintf("spec.networkPolicy.egress[%d]", i)
+		if len(rule.To) == 0 && len(rule.Ports) == 0 {
+			errs = append(errs, fmt.Sprintf("%s must set to or ports", field))
+		}
+		for j, peer := range rule.To {
+			errs = append(errs, validateNetworkPolicyPeer(fmt.Sprintf("%s.to[%d]", field, j), peer)...)
+		}
+		for j, p := range rule.Ports {
+			if p.Protocol != nil {
+				switch *p.Protocol {
+				case corev1.ProtocolTCP, corev1.ProtocolUDP:
+				default:
+					errs = append(errs, fmt.Sprintf("%s.ports[%d].protocol %q is not supported", field, j, *p.Protocol))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func validateNetworkPolicyPeer(field string, peer networkingv1.NetworkPolicyPeer) []string {
+	var errs []string
+	set := 0
+	if peer.PodSelector != nil || peer.NamespaceSelector != nil {
+		set++
+	}
+	if peer.IPBlock != nil {
+		set++
+	}
+	if set != 1 {
+		errs = append(errs, fmt.Sprintf("%s must set either podSelector and namespaceSelector, or ipBlock", field))
+	}
+	for _, s := range []*metav1.LabelSelector{peer.PodSelector, peer.NamespaceSelector} {
+		if s == nil {
+			continue
+		}
+		if _, err := metav1.LabelSelectorAsSelector(s); err != nil {
+			errs = append(errs, fmt.Sprintf("%s has an invalid selector: %v", field, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNewNetworkPolicy(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewNetworkPolicy(&nginx))
+
+	edge := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"network": "edge"}},
+	}
+	backend := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "backend"}},
+	}
+	upstreamPort := intstr.FromInt(8080)
+	nginx.Spec.NetworkPolicy = &v1alpha1.NginxNetworkPolicy{
+		From: []networkingv1.NetworkPolicyPeer{edge},
+		Egress: []networkingv1.NetworkPolicyEgressRule{
+			{To: []networkingv1.NetworkPolicyPeer{backend}, Ports: []networkingv1.NetworkPolicyPort{{Port: &upstreamPort}}},
+		},
+	}
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "my-tls"}
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{}
+	nginx.Spec.Labels = map[string]string{"team": "edge"}
+
+	policy := NewNetworkPolicy(&nginx)
+	assert.Equal(t, "my-nginx-network-policy", policy.Name)
+	assert.Equal(t, map[string]string{"nginx_cr": "my-nginx", "app": "nginx", "team": "edge"}, policy.Labels)
+	assert.Equal(t, LabelsForNginx("my-nginx"), policy.Spec.PodSelector.MatchLabels)
+
+	tcp, udp := corev1.ProtocolTCP, corev1.ProtocolUDP
+	http, https, metrics := intstr.FromString("http"), intstr.FromString("https"), intstr.FromString(metricsPortName)
+	dns := intstr.FromInt(53)
+	assert.Equal(t, []networkingv1.NetworkPolicyIngressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &tcp, Port: &http},
+				{Protocol: &tcp, Port: &https},
+				{Protocol: &tcp, Port: &metrics},
+			},
+			From: []networkingv1.NetworkPolicyPeer{edge},
+		},
+	}, policy.Spec.Ingress)
+	assert.Equal(t, []networkingv1.NetworkPolicyEgressRule{
+		{To: []networkingv1.NetworkPolicyPeer{backend}, Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &upstreamPort}}},
+		{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, {Protocol: &tcp, Port: &dns}}},
+	}, policy.Spec.Egress)
+	assert.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}, policy.Spec.PolicyTypes)
+	assert.Nil(t, nginx.Spec.NetworkPolicy.Egress[0].Ports[0].Protocol)
+	assert.Len(t, nginx.Spec.NetworkPolicy.Egress, 1)
+
+	nginx.Spec.NetworkPolicy.Egress = nil
+	policy = NewNetworkPolicy(&nginx)
+	assert.Nil(t, policy.Spec.Egress)
+	assert.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}, policy.Spec.PolicyTypes)
+}
+
+func TestNetworkPolicyDrift(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.NetworkPolicy = &v1alpha1.NginxNetworkPolicy{}
+	desired := NewNetworkPolicy(&nginx)
+
+	current := NewNetworkPolicy(&nginx)
+	current.Spec.PodSelector.MatchExpressions = []metav1.LabelSelectorRequirement{}
+	assert.Nil(t, NetworkPolicyDrift(desired, current))
+
+	current.Spec.Ingress[0].From = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}}}
+	current.Spec.PolicyTypes = append(current.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+	assert.Equal(t, []string{"ingress", "policyTypes"}, NetworkPolicyDrift(desired, current))
+}
+
+func TestValidateNetworkPolicy(t *testing.T) {
+	sctp := corev1.Protocol("SCTP")
+	tests := []struct {
+		name   string
+		policy *v1alpha1.NginxNetworkPolicy
+		want   []string
+	}{
+		{name: "none"},
+		{name: "open", policy: &v1alpha1.NginxNetworkPolicy{}},
+		{
+			name: "valid",
+			policy: &v1alpha1.NginxNetworkPolicy{
+				From: []networkingv1.NetworkPolicyPeer{
+					{NamespaceSelector: &metav1.LabelSelector{}, PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ingress"}}},
+					{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}},
+				},
+				Egress: []networkingv1.NetworkPolicyEgressRule{
+					{To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "backend"}}}}},
+				},
+			},
+		},
+		{
+			name: "invalid",
+			policy: &v1alpha1.NginxNetworkPolicy{
+				From: []networkingv1.NetworkPolicyPeer{
+					{},
+					{PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Is"}}}},
+				},
+				Egress: []networkingv1.NetworkPolicyEgressRule{
+					{},
+					{
+						To:    []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}, PodSelector: &metav1.LabelSelector{}}},
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &sctp}},
+					},
+				},
+			},
+			want: []string{
+				"spec.networkPolicy.from[0] must set either podSelector and namespaceSelector, or ipBlock",
+				`spec.networkPolicy.from[1] has an invalid selector: "Is" is not a valid pod selector operator`,
+				"spec.networkPolicy.egress[0] must set to or ports",
+				"spec.networkPolicy.egress[1].to[0] must set either podSelector and namespaceSelector, or ipBlock",
+				`spec.networkPolicy.egress[1].ports[0].protocol "SCTP" is not supported`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateNetworkPolicy(&v1alpha1.NginxSpec{NetworkPolicy: tt.policy}))
+		})
+	}
+}
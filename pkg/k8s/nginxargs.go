@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+)
+
+// defaultGlobals are the directives always passed through -g, keeping nginx
+// in the foreground as the container process
+const defaultGlobals = "daemon off;"
+
+// globalDirectivePattern matches a single directive of the main context.
+// Quotes, blocks, variables and shell characters are rejected, so the
+// directives can be safely quoted in the reload script.
+var globalDirectivePattern = regexp.MustCompile("^[a-z_][a-z0-9_]*(\\s+[^;{}'\"\\\\$`\\s][^;{}'\"\\\\$`\\r\\n]*)?;?$")
+
+// nginxGlobals returns the directives passed to nginx through -g, loading
+// the modules before the globals of the nginx arguments
+func nginxGlobals(spec *v1alpha1.NginxSpec) string {
+	globals := append([]string{defaultGlobals}, moduleDirectives(spec.Modules)...)
+	if args := spec.NginxArgs; args != nil {
+		for _, g := range args.Globals {
+			g = strings.TrimSpace(g)
+			if !strings.HasSuffix(g, ";") {
+				g += ";"
+			}
+			globals = append(globals, g)
+		}
+	}
+	return strings.Join(globals, " ")
+}
+
+// hasCustomGlobals returns whether directives other than the default ones
+// are passed through -g
+func hasCustomGlobals(spec *v1alpha1.NginxSpec) bool {
+	return len(spec.Modules) > 0 || (spec.NginxArgs != nil && len(spec.NginxArgs.Globals) > 0)
+}
+
+// setupNginxArgs runs the nginx container with the extra arguments of the
+// spec and the modules, instead of the command of the image
+func setupNginxArgs(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if !hasCustomGlobals(spec) {
+		return
+	}
+	dep.Spec.Template.Spec.Containers[0].Command = []string{"nginx", "-g", nginxGlobals(spec)}
+}
+
+// validateNginxArgs returns the errors found in the nginx arguments
+func validateNginxArgs(args *v1alpha1.NginxArgs) []string {
+	if args == nil {
+		return nil
+	}
+	var errs []string
+	for i, g := range args.Globals {
+		g = strings.TrimSpace(g)
+		switch {
+		case !globalDirectivePattern.MatchString(g):
+			errs = append(errs, fmt.Sprintf("spec.nginxArgs.globals[%d] %q must be a single directive without blocks, quotes or shell characters", i, g))
+		case strings.Fields(strings.TrimSuffix(g, ";"))[0] == "daemon":
+			errs = append(errs, fmt.Sprintf("spec.nginxArgs.globals[%d] cannot set daemon, it is set by the operator", i))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestNginxArgs(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Nil(t, dep.Spec.Template.Spec.Containers[0].Command)
+
+	nginx.Spec.NginxArgs = &v1alpha1.NginxArgs{Globals: []string{"worker_processes 4", " pid /tmp/nginx.pid; "}}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nginx", "-g", "daemon off; worker_processes 4; pid /tmp/nginx.pid;"}, dep.Spec.Template.Spec.Containers[0].Command)
+
+	job, err := NewConfigCheckJob(&nginx, dep, ConfigCheckOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nginx", "-t", "-g", "daemon off; worker_processes 4; pid /tmp/nginx.pid;"}, job.Spec.Template.Spec.Containers[0].Command)
+
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Name: "my-config", Kind: v1alpha1.ConfigKindConfigMap}
+	nginx.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	script := dep.Spec.Template.Spec.Containers[0].Command[2]
+	assert.Contains(t, script, "nginx -g 'daemon off; worker_processes 4; pid /tmp/nginx.pid;' &\n")
+	assert.Contains(t, script, `nginx -g "daemon off; worker_processes 4; pid /tmp/nginx.pid;" -s reload`)
+}
+
+func TestValidateNginxArgs(t *testing.T) {
+	tests := []struct {
+		globals []string
+		want    []string
+	}{
+		{globals: []string{"worker_processes 4", "worker_rlimit_nofile 65535;", "pcre_jit on ;", "thread_pool default threads=32 max_queue=65536;"}},
+		{
+			globals: []string{"worker_processes 4; user root"},
+			want:    []string{`spec.nginxArgs.globals[0] "worker_processes 4; user root" must be a single directive without blocks, quotes or shell characters`},
+		},
+		{
+			globals: []string{"env 'A=1'", "env $HOME", "pid `id`", "events { }", "error_log /dev/stderr\nuser root", "4"},
+			want: []string{
+				`spec.nginxArgs.globals[0] "env 'A=1'" must be a single directive without blocks, quotes or shell characters`,
+				`spec.nginxArgs.globals[1] "env $HOME" must be a single directive without blocks, quotes or shell characters`,
+				"spec.nginxArgs.globals[2] \"pid `id`\" must be a single directive without blocks, quotes or shell characters",
+				`spec.nginxArgs.globals[3] "events { }" must be a single directive without blocks, quotes or shell characters`,
+				`spec.nginxArgs.globals[4] "error_log /dev/stderr\nuser root" must be a single directive without blocks, quotes or shell characters`,
+				`spec.nginxArgs.globals[5] "4" must be a single directive without blocks, quotes or shell characters`,
+			},
+		},
+		{
+			globals: []string{"daemon on;"},
+			want:    []string{"spec.nginxArgs.globals[0] cannot set daemon, it is set by the operator"},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, validateNginxArgs(&v1alpha1.NginxArgs{Globals: tt.globals}), "globals %q", tt.globals)
+	}
+	assert.Nil(t, validateNginxArgs(nil))
+}
@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeProblem returns why the node is unhealthy for the node remediation of
+// the spec, or an empty string. The node is unhealthy once its Ready
+// condition was not true, or one of the remediation conditions was true, for
+// at least the remediation unhealthy seconds.
+func NodeProblem(node *corev1.Node, spec *v1alpha1.NginxSpec, now time.Time) string {
+	r := spec.WithDefaults().NodeRemediation
+	if r == nil {
+		return ""
+	}
+	threshold := time.Duration(r.UnhealthySeconds) * time.Second
+	unhealthy := func(c corev1.NodeCondition) bool {
+		if c.Type == corev1.NodeReady {
+			return c.Status != corev1.ConditionTrue
+		}
+		for _, t := range r.Conditions {
+			if c.Type == t {
+				return c.Status == corev1.ConditionTrue
+			}
+		}
+		return false
+	}
+	for _, c := range node.Status.Conditions {
+		if !unhealthy(c) {
+			continue
+		}
+		since := now.Sub(c.LastTransitionTime.Time)
+		if since < threshold {
+			continue
+		}
+		return fmt.Sprintf("node %s condition %s is %s for %s: %s", node.Name, c.Type, c.Status, since.Round(time.Second), c.Message)
+	}
+	return ""
+}
+
+// PodsToRemediate returns the pods to replace among the given ones, keyed by
+// name, with the problems of their nodes keyed by node name. Pods that are
+// not ready are always replaced, while ready pods are only replaced up to the
+// given disruptions allowed, so the pod disruption budget is respected.
+// Terminating pods are skipped.
+func PodsToRemediate(pods []corev1.Pod, problems map[string]string, disruptionsAllowed int32) map[string]string {
+	result := make(map[string]string)
+	for i := range pods {
+		pod := &pods[i]
+		problem := problems[pod.Spec.NodeName]
+		if problem == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if CanaryPodReady(pod) {
+			if disruptionsAllowed <= 0 {
+				continue
+			}
+			disruptionsAllowed--
+		}
+		result[pod.Name] = problem
+	}
+	return result
+}
+
+// validateNodeRemediation returns the errors found in the node remediation
+// settings of the spec
+func validateNodeRemediation(spec *v1alpha1.NginxSpec) []string {
+	r := spec.NodeRemediation
+	if r == nil {
+		return nil
+	}
+	var errs []string
+	if r.UnhealthySeconds < 0 {
+		errs = append(errs, "spec.nodeRemediation.unhealthySeconds must not be negative")
+	}
+	for i, c := range r.Conditions {
+		if c == "" || c == corev1.NodeReady {
+			errs = append(errs, fmt.Sprintf("spec.nodeRemediation.conditions[%d] %q must be a condition other than Ready", i, c))
+		}
+	}
+	if spec.WorkloadKind == v1alpha1.WorkloadKindDaemonSet {
+		errs = append(errs, "spec.nodeRemediation cannot be used with workload kind DaemonSet, its pods are bound to their nodes")
+	}
+	return errs
+}
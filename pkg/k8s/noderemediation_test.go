@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeProblem(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) metav1.Time { return metav1.NewTime(now.Add(-d)) }
+	spec := &v1alpha1.NginxSpec{NodeRemediation: &v1alpha1.NginxNodeRemediation{
+		Conditions: []corev1.NodeConditionType{"KernelDeadlock"},
+	}}
+	tests := []struct {
+		name       string
+		spec       *v1alpha1.NginxSpec
+		conditions []corev1.NodeCondition
+		want       string
+	}{
+		{
+			name:       "disabled",
+			spec:       &v1alpha1.NginxSpec{},
+			conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown, LastTransitionTime: ago(time.Hour)}},
+		},
+		{
+			name: "healthy",
+			spec: spec,
+			conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastTransitionTime: ago(time.Hour)},
+				{Type: "KernelDeadlock", Status: corev1.ConditionFalse, LastTransitionTime: ago(time.Hour)},
+				{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue, LastTransitionTime: ago(time.Hour)},
+			},
+		},
+		{
+			name:       "not-ready-recently",
+			spec:       spec,
+			conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown, LastTransitionTime: ago(30 * time.Second)}},
+		},
+		{
+			name:       "not-ready",
+			spec:       spec,
+			conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown, LastTransitionTime: ago(90 * time.Second), Message: "Kubelet stopped posting node status."}},
+			want:       "node node-1 condition Ready is Unknown for 1m30s: Kubelet stopped posting node status.",
+		},
+		{
+			name: "problem-condition",
+			spec: spec,
+			conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastTransitionTime: ago(time.Hour)},
+				{Type: "KernelDeadlock", Status: corev1.ConditionTrue, LastTransitionTime: ago(2 * time.Minute), Message: "task docker blocked"},
+			},
+			want: "node node-1 condition KernelDeadlock is True for 2m0s: task docker blocked",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &corev1.Node{Status: corev1.NodeStatus{Conditions: tt.conditions}}
+			node.Name = "node-1"
+			assert.Equal(t, tt.want, NodeProblem(node, tt.spec, now))
+		})
+	}
+}
+
+func TestPodsToRemediate(t *testing.T) {
+	pod := func(name, node string, ready bool) corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		p := corev1.Pod{
+			Spec:   corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}},
+		}
+		p.Name = name
+		return p
+	}
+	terminating := pod("terminating", "bad", false)
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+	pods := []corev1.Pod{
+		pod("healthy", "good", true),
+		pod("ready-1", "bad", true),
+		pod("unready", "bad", false),
+		pod("ready-2", "bad", true),
+		terminating,
+	}
+	problems := map[string]string{"good": "", "bad": "node bad is not ready"}
+
+	assert.Equal(t, map[string]string{"unready": "node bad is not ready"}, PodsToRemediate(pods, problems, 0))
+	assert.Equal(t, map[string]string{
+		"ready-1": "node bad is not ready",
+		"unready": "node bad is not ready",
+	}, PodsToRemediate(pods, problems, 1))
+	assert.Len(t, PodsToRemediate(pods, problems, 5), 3)
+}
+
+func TestValidateNodeRemediation(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "disabled"},
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{NodeRemediation: &v1alpha1.NginxNodeRemediation{
+				Conditions:       []corev1.NodeConditionType{"KernelDeadlock", "ReadonlyFilesystem"},
+				UnhealthySeconds: 120,
+			}},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{
+				WorkloadKind: v1alpha1.WorkloadKindDaemonSet,
+				NodeRemediation: &v1alpha1.NginxNodeRemediation{
+					Conditions:       []corev1.NodeConditionType{corev1.NodeReady},
+					UnhealthySeconds: -1,
+				},
+			},
+			want: []string{
+				"spec.nodeRemediation.unhealthySeconds must not be negative",
+				`spec.nodeRemediation.conditions[0] "Ready" must be a condition other than Ready`,
+				"spec.nodeRemediation cannot be used with workload kind DaemonSet, its pods are bound to their nodes",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateNodeRemediation(&tt.spec))
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// signingProxyBasePort is the port of the signing proxy of the first
+// location, the proxy of the i-th location listens on signingProxyBasePort+i
+const signingProxyBasePort = 8100
+
+// setupObjectStorage adds a signing proxy sidecar for each object storage
+// location with signing. The spec must have its default values already set.
+func setupObjectStorage(locations []v1alpha1.NginxLocation, dep *appv1.Deployment) {
+	for i, l := range locations {
+		o := l.ObjectStorage
+		if o == nil || o.Signing == nil {
+			continue
+		}
+		endpoint, err := url.Parse(o.Endpoint)
+		if err != nil {
+			continue
+		}
+		name := fmt.Sprintf("sigv4-%d", i)
+		port := int32(signingProxyBasePort + i)
+		dep.Spec.Template.Spec.Containers = append(dep.Spec.Template.Spec.Containers, corev1.Container{
+			Name:  name,
+			Image: o.Signing.Image,
+			Args: []string{
+				"--name", o.Signing.Service,
+				"--region", o.Signing.Region,
+				"--host", endpoint.Host,
+				"--port", fmt.Sprintf(":%d", port),
+			},
+			Ports: []corev1.ContainerPort{{
+				Name:          name,
+				ContainerPort: port,
+				Protocol:      corev1.ProtocolTCP,
+			}},
+			EnvFrom: []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: o.Signing.CredentialsSecret}},
+			}},
+		})
+	}
+}
+
+// renderObjectStorage renders the directives serving the i-th location from
+// a bucket. The location path is replaced by the endpoint path. Signed
+// requests go through the signing proxy of the location, which sends them to
+// the endpoint over https.
+func renderObjectStorage(buf *bytes.Buffer, o *v1alpha1.ObjectStorageAction, i int) {
+	endpoint, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return
+	}
+	path := endpoint.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	buf.WriteString("    limit_except GET HEAD {\n        deny all;\n    }\n")
+	fmt.Fprintf(buf, "    proxy_set_header Host %s;\n", endpoint.Host)
+	buf.WriteString("    proxy_set_header Authorization \"\";\n")
+	buf.WriteString("    proxy_set_header Cookie \"\";\n")
+	buf.WriteString("    proxy_hide_header x-amz-id-2;\n")
+	buf.WriteString("    proxy_hide_header x-amz-request-id;\n")
+	buf.WriteString("    proxy_hide_header x-guploader-uploadid;\n")
+	buf.WriteString("    proxy_hide_header Set-Cookie;\n")
+	if o.Signing != nil {
+		fmt.Fprintf(buf, "    proxy_pass http://127.0.0.1:%d%s;\n", signingProxyBasePort+i, path)
+		return
+	}
+	if endpoint.Scheme == "https" {
+		buf.WriteString("    proxy_ssl_server_name on;\n")
+	}
+	fmt.Fprintf(buf, "    proxy_pass %s://%s%s;\n", endpoint.Scheme, endpoint.Host, path)
+}
+
+// validateObjectStorage returns the errors found in the object storage action
+// of a location
+func validateObjectStorage(field string, o *v1alpha1.ObjectStorageAction) []string {
+	var errs []string
+	endpoint, err := url.Parse(o.Endpoint)
+	switch {
+	case o.Endpoint == "":
+		errs = append(errs, fmt.Sprintf("%s.objectStorage.endpoint is required", field))
+	case err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") ||
+		endpoint.RawQuery != "" || endpoint.Fragment != "" || endpoint.User != nil || strings.ContainsAny(o.Endpoint, " \t\n{};$"):
+		errs = append(errs, fmt.Sprintf("%s.objectStorage.endpoint %q must be an http or https URL without query", field, o.Endpoint))
+	case o.Signing != nil && endpoint.Scheme != "https":
+		errs = append(errs, fmt.Sprintf("%s.objectStorage.endpoint %q must use https with signing", field, o.Endpoint))
+	}
+	if s := o.Signing; s != nil {
+		if s.CredentialsSecret == "" {
+			errs = append(errs, fmt.Sprintf("%s.objectStorage.signing.credentialsSecret is required", field))
+		}
+		if strings.ContainsAny(s.Region+s.Service, " \t\n") {
+			errs = append(errs, fmt.Sprintf("%s.objectStorage.signing region and service must not contain whitespace", field))
+		}
+	}
+	return errs
+}
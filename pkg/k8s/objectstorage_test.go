@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestObjectStorageLocations(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Locations = []v1alpha1.NginxLocation{
+		{Path: "/", ObjectStorage: &v1alpha1.ObjectStorageAction{Endpoint: "https://public.s3.amazonaws.com"}},
+		{Path: "/private/", ObjectStorage: &v1alpha1.ObjectStorageAction{
+			Endpoint: "https://private.s3.eu-west-1.amazonaws.com/site/",
+			Signing:  &v1alpha1.ObjectStorageSigning{CredentialsSecret: "aws", Region: "eu-west-1"},
+		}},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `location / {
+    limit_except GET HEAD {
+        deny all;
+    }
+    proxy_set_header Host public.s3.amazonaws.com;
+    proxy_set_header Authorization "";
+    proxy_set_header Cookie "";
+    proxy_hide_header x-amz-id-2;
+    proxy_hide_header x-amz-request-id;
+    proxy_hide_header x-guploader-uploadid;
+    proxy_hide_header Set-Cookie;
+    proxy_ssl_server_name on;
+    proxy_pass https://public.s3.amazonaws.com/;
+}
+location /private/ {
+    limit_except GET HEAD {
+        deny all;
+    }
+    proxy_set_header Host private.s3.eu-west-1.amazonaws.com;
+    proxy_set_header Authorization "";
+    proxy_set_header Cookie "";
+    proxy_hide_header x-amz-id-2;
+    proxy_hide_header x-amz-request-id;
+    proxy_hide_header x-guploader-uploadid;
+    proxy_hide_header Set-Cookie;
+    proxy_pass http://127.0.0.1:8101/site/;
+}
+`, dep.Spec.Template.Annotations["nginx.tsuru.io/locations-conf"])
+
+	containers := dep.Spec.Template.Spec.Containers
+	assert.Len(t, containers, 2)
+	assert.Equal(t, corev1.Container{
+		Name:  "sigv4-1",
+		Image: "public.ecr.aws/aws-observability/aws-sigv4-proxy:1.0",
+		Args:  []string{"--name", "s3", "--region", "eu-west-1", "--host", "private.s3.eu-west-1.amazonaws.com", "--port", ":8101"},
+		Ports: []corev1.ContainerPort{{Name: "sigv4-1", ContainerPort: 8101, Protocol: corev1.ProtocolTCP}},
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "aws"}},
+		}},
+	}, containers[1])
+}
+
+func TestValidateObjectStorage(t *testing.T) {
+	assert.Nil(t, validateObjectStorage("spec.locations[0]", &v1alpha1.ObjectStorageAction{
+		Endpoint: "https://storage.googleapis.com/bucket/",
+		Signing:  &v1alpha1.ObjectStorageSigning{CredentialsSecret: "hmac", Region: "auto"},
+	}))
+	tests := []struct {
+		action *v1alpha1.ObjectStorageAction
+		want   []string
+	}{
+		{
+			action: &v1alpha1.ObjectStorageAction{Signing: &v1alpha1.ObjectStorageSigning{}},
+			want: []string{
+				"spec.locations[0].objectStorage.endpoint is required",
+				"spec.locations[0].objectStorage.signing.credentialsSecret is required",
+			},
+		},
+		{
+			action: &v1alpha1.ObjectStorageAction{Endpoint: "s3://bucket"},
+			want:   []string{`spec.locations[0].objectStorage.endpoint "s3://bucket" must be an http or https URL without query`},
+		},
+		{
+			action: &v1alpha1.ObjectStorageAction{Endpoint: "https://bucket.s3.amazonaws.com/?list-type=2"},
+			want:   []string{`spec.locations[0].objectStorage.endpoint "https://bucket.s3.amazonaws.com/?list-type=2" must be an http or https URL without query`},
+		},
+		{
+			action: &v1alpha1.ObjectStorageAction{
+				Endpoint: "http://minio:9000/bucket/",
+				Signing:  &v1alpha1.ObjectStorageSigning{CredentialsSecret: "minio"},
+			},
+			want: []string{`spec.locations[0].objectStorage.endpoint "http://minio:9000/bucket/" must use https with signing`},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, validateObjectStorage("spec.locations[0]", tt.action))
+	}
+}
@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"fmt"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Volume holding the configs generated by the operator
+	operatorConfigVolume = "nginx-operator-config"
+
+	// Mount path of the configs generated by the operator
+	operatorConfigMountPath = "/etc/nginx-operator"
+
+	// Directory included by the default nginx.conf of the nginx image
+	defaultConfigIncludePath = configMountPath + "/conf.d"
+)
+
+// addOperatorConfig adds a file generated by the operator to the nginx
+// container, under operatorConfigMountPath. The content is kept in a pod
+// annotation and mounted using the Downward API, like inline configs.
+func addOperatorConfig(dep *appv1.Deployment, annotation, file, content string) {
+	template := &dep.Spec.Template
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[annotation] = content
+	item := corev1.DownwardAPIVolumeFile{
+		Path: file,
+		FieldRef: &corev1.ObjectFieldSelector{
+			FieldPath: fmt.Sprintf("metadata.annotations['%s']", annotation),
+		},
+	}
+
+	for i := range template.Spec.Volumes {
+		if v := &template.Spec.Volumes[i]; v.Name == operatorConfigVolume {
+			v.DownwardAPI.Items = append(v.DownwardAPI.Items, item)
+			return
+		}
+	}
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: operatorConfigVolume,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{item},
+			},
+		},
+	})
+	nginx := &template.Spec.Containers[0]
+	nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+		Name:      operatorConfigVolume,
+		MountPath: operatorConfigMountPath,
+	})
+}
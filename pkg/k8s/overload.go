@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Pod annotation holding the server context directives of the overload
+	// protection
+	overloadConfigAnnotation = "nginx.tsuru.io/overload-conf"
+
+	overloadVolume    = "nginx-overload"
+	overloadMountPath = "/var/run/nginx-overload"
+
+	// overloadShedFile is created by the CPU shedding sidecar while the pod
+	// is overloaded
+	overloadShedFile = overloadMountPath + "/shed"
+
+	overloadSidecarName = "overload-monitor"
+)
+
+// setupOverloadProtection renders the directives shedding the requests into
+// /etc/nginx-operator/overload.conf, which must be included in the server
+// contexts, and adds the CPU shedding sidecar. The limits themselves are
+// rendered into http.conf. The spec must have its default values already
+// set.
+func setupOverloadProtection(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	o := spec.OverloadProtection
+	if o == nil {
+		return
+	}
+	addOperatorConfig(dep, overloadConfigAnnotation, "overload.conf", renderOverloadServer(o))
+	c := o.CPUShedding
+	if c == nil {
+		return
+	}
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         overloadVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	nginx := &podSpec.Containers[0]
+	nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+		Name:      overloadVolume,
+		MountPath: overloadMountPath,
+		ReadOnly:  true,
+	})
+	var cpuLimit int64
+	if limit, ok := nginx.Resources.Limits[corev1.ResourceCPU]; ok {
+		cpuLimit = limit.MilliValue()
+	}
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:  overloadSidecarName,
+		Image: c.Image,
+		Env: []corev1.EnvVar{
+			{Name: "NGINX_OVERLOAD_SHED_FILE", Value: overloadShedFile},
+			{Name: "NGINX_OVERLOAD_CPU_THRESHOLD", Value: strconv.Itoa(int(c.ThresholdPercent))},
+			{Name: "NGINX_CPU_LIMIT", Value: strconv.FormatInt(cpuLimit, 10)},
+		},
+		Resources: c.Resources,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: overloadVolume, MountPath: overloadMountPath},
+		},
+	})
+}
+
+// renderOverloadLimits renders the http context directives limiting the
+// connections and requests of the pod. The zones use a key with the same
+// value for every request, so each zone has a single counter.
+func renderOverloadLimits(buf *bytes.Buffer, o *v1alpha1.NginxOverloadProtection) {
+	if o == nil {
+		return
+	}
+	if o.MaxConnections > 0 {
+		buf.WriteString("limit_conn_zone $nginx_version zone=overload_conn:1m;\n")
+		fmt.Fprintf(buf, "limit_conn overload_conn %d;\n", o.MaxConnections)
+	}
+	if o.MaxRequestsPerSecond > 0 {
+		fmt.Fprintf(buf, "limit_req_zone $nginx_version zone=overload_req:1m rate=%dr/s;\n", o.MaxRequestsPerSecond)
+		nodelay := ""
+		if o.ExcessRequests == v1alpha1.OverloadReject {
+			nodelay = " nodelay"
+		}
+		fmt.Fprintf(buf, "limit_req zone=overload_req burst=%d%s;\n", o.Burst, nodelay)
+	}
+}
+
+// renderOverloadServer renders the server context directives answering the
+// shed requests with a Retry-After header, and shedding every request while
+// the CPU shedding sidecar reports the pod as overloaded
+func renderOverloadServer(o *v1alpha1.NginxOverloadProtection) string {
+	var buf bytes.Buffer
+	buf.WriteString("error_page 503 @overloaded;\n")
+	if o.CPUShedding != nil {
+		fmt.Fprintf(&buf, "if (-f %s) {\n    return 503;\n}\n", overloadShedFile)
+	}
+	fmt.Fprintf(&buf, "location @overloaded {\n    add_header Retry-After %d always;\n    return 503;\n}\n", o.RetryAfterSeconds)
+	return buf.String()
+}
+
+// validateOverloadProtection returns the errors found in the overload
+// protection
+func validateOverloadProtection(spec *v1alpha1.NginxSpec) []string {
+	o := spec.OverloadProtection
+	if o == nil {
+		return nil
+	}
+	var errs []string
+	if o.MaxConnections == 0 && o.MaxRequestsPerSecond == 0 && o.CPUShedding == nil {
+		errs = append(errs, "spec.overloadProtection must set maxConnections, maxRequestsPerSecond or cpuShedding")
+	}
+	if o.MaxConnections < 0 {
+		errs = append(errs, "spec.overloadProtection.maxConnections must not be negative")
+	}
+	if o.MaxRequestsPerSecond < 0 {
+		errs = append(errs, "spec.overloadProtection.maxRequestsPerSecond must not be negative")
+	}
+	if o.Burst < 0 {
+		errs = append(errs, "spec.overloadProtection.burst must not be negative")
+	} else if o.Burst > 0 && o.MaxRequestsPerSecond == 0 {
+		errs = append(errs, "spec.overloadProtection.burst requires maxRequestsPerSecond")
+	}
+	switch o.ExcessRequests {
+	case "", v1alpha1.OverloadQueue, v1alpha1.OverloadReject:
+	default:
+		errs = append(errs, fmt.Sprintf("spec.overloadProtection.excessRequests %q is not supported", o.ExcessRequests))
+	}
+	if o.RetryAfterSeconds < 0 {
+		errs = append(errs, "spec.overloadProtection.retryAfterSeconds must not be negative")
+	}
+	if c := o.CPUShedding; c != nil {
+		if c.Image == "" {
+			errs = append(errs, "spec.overloadProtection.cpuShedding.image is required")
+		}
+		if c.ThresholdPercent < 0 || c.ThresholdPercent > 100 {
+			errs = append(errs, "spec.overloadProtection.cpuShedding.thresholdPercent must be between 1 and 100")
+		}
+		if spec.PodTemplate.Resources.Limits.Cpu().IsZero() {
+			errs = append(errs, "spec.overloadProtection.cpuShedding requires a CPU limit in spec.podTemplate.resources")
+		}
+	}
+	return errs
+}
@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestOverloadProtection(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.OverloadProtection = &v1alpha1.NginxOverloadProtection{
+		MaxConnections:       2000,
+		MaxRequestsPerSecond: 500,
+		Burst:                100,
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, "limit_conn_zone $nginx_version zone=overload_conn:1m;\n"+
+		"limit_conn overload_conn 2000;\n"+
+		"limit_req_zone $nginx_version zone=overload_req:1m rate=500r/s;\n"+
+		"limit_req zone=overload_req burst=100;\n", annotations[httpConfigAnnotation])
+	assert.Equal(t, "error_page 503 @overloaded;\n"+
+		"location @overloaded {\n    add_header Retry-After 5 always;\n    return 503;\n}\n", annotations[overloadConfigAnnotation])
+	assert.Contains(t, defaultServer(&nginx), "include /etc/nginx-operator/http.conf;\n")
+	assert.Contains(t, defaultServer(&nginx), "    include /etc/nginx-operator/overload.conf;\n")
+	assert.Len(t, dep.Spec.Template.Spec.Containers, 1)
+
+	nginx.Spec.PodTemplate.Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")}
+	nginx.Spec.OverloadProtection = &v1alpha1.NginxOverloadProtection{
+		MaxRequestsPerSecond: 500,
+		ExcessRequests:       v1alpha1.OverloadReject,
+		RetryAfterSeconds:    30,
+		CPUShedding:          &v1alpha1.NginxCPUShedding{Image: "example/cpu-shedder:1.0"},
+	}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations = dep.Spec.Template.Annotations
+	assert.Equal(t, "limit_req_zone $nginx_version zone=overload_req:1m rate=500r/s;\n"+
+		"limit_req zone=overload_req burst=0 nodelay;\n", annotations[httpConfigAnnotation])
+	assert.Equal(t, "error_page 503 @overloaded;\n"+
+		"if (-f /var/run/nginx-overload/shed) {\n    return 503;\n}\n"+
+		"location @overloaded {\n    add_header Retry-After 30 always;\n    return 503;\n}\n", annotations[overloadConfigAnnotation])
+	podSpec := dep.Spec.Template.Spec
+	assert.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name:         "nginx-overload",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "nginx-overload", MountPath: "/var/run/nginx-overload", ReadOnly: true})
+	if assert.Len(t, podSpec.Containers, 2) {
+		assert.Equal(t, corev1.Container{
+			Name:  "overload-monitor",
+			Image: "example/cpu-shedder:1.0",
+			Env: []corev1.EnvVar{
+				{Name: "NGINX_OVERLOAD_SHED_FILE", Value: "/var/run/nginx-overload/shed"},
+				{Name: "NGINX_OVERLOAD_CPU_THRESHOLD", Value: "90"},
+				{Name: "NGINX_CPU_LIMIT", Value: "2000"},
+			},
+			VolumeMounts: []corev1.VolumeMount{{Name: "nginx-overload", MountPath: "/var/run/nginx-overload"}},
+		}, podSpec.Containers[1])
+	}
+}
+
+func TestValidateOverloadProtection(t *testing.T) {
+	tests := []struct {
+		name      string
+		overload  *v1alpha1.NginxOverloadProtection
+		resources corev1.ResourceRequirements
+		want      []string
+	}{
+		{name: "none"},
+		{
+			name:     "limits",
+			overload: &v1alpha1.NginxOverloadProtection{MaxConnections: 1000, MaxRequestsPerSecond: 200, Burst: 50, ExcessRequests: v1alpha1.OverloadReject},
+		},
+		{
+			name:      "cpu-shedding",
+			overload:  &v1alpha1.NginxOverloadProtection{CPUShedding: &v1alpha1.NginxCPUShedding{Image: "example/cpu-shedder", ThresholdPercent: 80}},
+			resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}},
+		},
+		{
+			name:     "empty",
+			overload: &v1alpha1.NginxOverloadProtection{},
+			want:     []string{"spec.overloadProtection must set maxConnections, maxRequestsPerSecond or cpuShedding"},
+		},
+		{
+			name: "invalid",
+			overload: &v1alpha1.NginxOverloadProtection{
+				MaxConnections:    -1,
+				Burst:             10,
+				ExcessRequests:    "Drop",
+				RetryAfterSeconds: -5,
+				CPUShedding:       &v1alpha1.NginxCPUShedding{ThresholdPercent: 120},
+			},
+			want: []string{
+				"spec.overloadProtection.maxConnections must not be negative",
+				"spec.overloadProtection.burst requires maxRequestsPerSecond",
+				`spec.overloadProtection.excessRequests "Drop" is not supported`,
+				"spec.overloadProtection.retryAfterSeconds must not be negative",
+				"spec.overloadProtection.cpuShedding.image is required",
+				"spec.overloadProtection.cpuShedding.thresholdPercent must be between 1 and 100",
+				"spec.overloadProtection.cpuShedding requires a CPU limit in spec.podTemplate.resources",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := v1alpha1.NginxSpec{OverloadProtection: tt.overload}
+			spec.PodTemplate.Resources = tt.resources
+			assert.Equal(t, tt.want, validateOverloadProtection(&spec))
+		})
+	}
+}
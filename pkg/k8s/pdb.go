@@ -0,0 +1,51 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// NewPodDisruptionBudget assembles the PodDisruptionBudget of the Nginx pods.
+// It returns nil if no budget was requested.
+func NewPodDisruptionBudget(n *v1alpha1.Nginx) *policyv1beta1.PodDisruptionBudget {
+	budget := n.Spec.PodDisruptionBudget
+	if budget == nil {
+		return nil
+	}
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n.Name + "-pdb",
+			Namespace: n.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+			Labels: LabelsForNginx(n.Name),
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: LabelsForNginx(n.Name),
+			},
+		},
+	}
+	if budget.MinAvailable != nil {
+		v := *budget.MinAvailable
+		pdb.Spec.MinAvailable = &v
+	}
+	if budget.MaxUnavailable != nil {
+		v := *budget.MaxUnavailable
+		pdb.Spec.MaxUnavailable = &v
+	}
+	setCustomMetadata(&n.Spec, pdb)
+	return pdb
+}
@@ -0,0 +1,31 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNewPodDisruptionBudget(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewPodDisruptionBudget(&nginx))
+
+	maxUnavailable := intstr.FromString("25%")
+	nginx.Spec.PodDisruptionBudget = &v1alpha1.NginxPodDisruptionBudget{MaxUnavailable: &maxUnavailable}
+	pdb := NewPodDisruptionBudget(&nginx)
+	assert.Equal(t, "my-nginx-pdb", pdb.Name)
+	assert.Equal(t, "default", pdb.Namespace)
+	assert.Equal(t, LabelsForNginx("my-nginx"), pdb.Labels)
+	assert.Len(t, pdb.OwnerReferences, 1)
+	assert.Equal(t, policyv1beta1.PodDisruptionBudgetSpec{
+		Selector:       &metav1.LabelSelector{MatchLabels: LabelsForNginx("my-nginx")},
+		MaxUnavailable: &maxUnavailable,
+	}, pdb.Spec)
+
+	pdb.Spec.MaxUnavailable.IntVal = 5
+	assert.Equal(t, "25%", nginx.Spec.PodDisruptionBudget.MaxUnavailable.String())
+}
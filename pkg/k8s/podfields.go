@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// HasUnstructuredPodFields returns whether the pod template of the spec sets
+// fields the Kubernetes API the operator is built against lacks, like
+// runtimeClassName or topologySpreadConstraints. Workloads and pods of such
+// specs are written as unstructured objects.
+func HasUnstructuredPodFields(spec *v1alpha1.NginxSpec) bool {
+	template := &spec.PodTemplate
+	return template.RuntimeClassName != "" || len(template.TopologySpreadConstraints) > 0
+}
+
+// unstructuredPodFields returns the pod spec fields of the nginx missing from
+// the Kubernetes API the operator is built against
+func unstructuredPodFields(n *v1alpha1.Nginx) map[string]interface{} {
+	template := &n.Spec.PodTemplate
+	fields := make(map[string]interface{})
+	if name := template.RuntimeClassName; name != "" {
+		fields["runtimeClassName"] = name
+	}
+	if len(template.TopologySpreadConstraints) > 0 {
+		var constraints []interface{}
+		for _, c := range template.TopologySpreadConstraints {
+			selector := c.LabelSelector
+			if selector == nil {
+				selector = &metav1.LabelSelector{MatchLabels: LabelsForNginx(n.Name)}
+			}
+			s, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(selector)
+			constraints = append(constraints, map[string]interface{}{
+				"maxSkew":           int64(c.MaxSkew),
+				"topologyKey":       c.TopologyKey,
+				"whenUnsatisfiable": string(c.WhenUnsatisfiable),
+				"labelSelector":     s,
+			})
+		}
+		fields["topologySpreadConstraints"] = constraints
+	}
+	return fields
+}
+
+// setUnstructuredPodFields sets the unstructured pod fields of the nginx in
+// the pod spec found at the given path of the object
+func setUnstructuredPodFields(n *v1alpha1.Nginx, obj map[string]interface{}, path ...string) {
+	for name, value := range unstructuredPodFields(n) {
+		unstructured.SetNestedField(obj, value, append(path, name)...)
+	}
+}
+
+// UnstructuredWorkload returns the workload or pod of the nginx as an
+// unstructured object with the unstructured pod fields set in its pod spec
+func UnstructuredWorkload(n *v1alpha1.Nginx, obj runtime.Object) (*unstructured.Unstructured, error) {
+	o, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	path := []string{"spec", "template", "spec"}
+	if obj.GetObjectKind().GroupVersionKind().Kind == "Pod" {
+		path = []string{"spec"}
+	}
+	setUnstructuredPodFields(n, o, path...)
+	return &unstructured.Unstructured{Object: o}, nil
+}
+
+// setWorkloadHash records the generated hash of the workload spec and pod
+// template, which must be pointers, including the unstructured pod fields of
+// the nginx. The hash of workloads without them is the one of their typed
+// spec and template.
+func setWorkloadHash(n *v1alpha1.Nginx, o metav1.Object, workloadSpec, template interface{}) error {
+	if !HasUnstructuredPodFields(&n.Spec) {
+		return setGeneratedHash(o, workloadSpec, template)
+	}
+	s, err := runtime.DefaultUnstructuredConverter.ToUnstructured(workloadSpec)
+	if err != nil {
+		return err
+	}
+	setUnstructuredPodFields(n, s, "template", "spec")
+	t, err := runtime.DefaultUnstructuredConverter.ToUnstructured(template)
+	if err != nil {
+		return err
+	}
+	setUnstructuredPodFields(n, t, "spec")
+	return setGeneratedHash(o, s, t)
+}
+
+// validateUnstructuredPodFields returns the errors found in the pod template
+// fields written as unstructured objects
+func validateUnstructuredPodFields(spec *v1alpha1.NginxSpec) []string {
+	template := &spec.PodTemplate
+	var errs []string
+	if name := template.RuntimeClassName; name != "" {
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.runtimeClassName %q is invalid: %s", name, strings.Join(msgs, ", ")))
+		}
+	}
+	seen := make(map[string]bool)
+	for i, c := range template.TopologySpreadConstraints {
+		field := fmt.Sprintf("spec.podTemplate.topologySpreadConstraints[%d]", i)
+		if c.MaxSkew < 1 {
+			errs = append(errs, fmt.Sprintf("%s.maxSkew must be greater than zero", field))
+		}
+		if c.TopologyKey == "" {
+			errs = append(errs, fmt.Sprintf("%s.topologyKey is required", field))
+		}
+		switch c.WhenUnsatisfiable {
+		case v1alpha1.DoNotSchedule, v1alpha1.ScheduleAnyway:
+		default:
+			errs = append(errs, fmt.Sprintf("%s.whenUnsatisfiable %q is not supported", field, c.WhenUnsatisfiable))
+		}
+		if c.LabelSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(c.LabelSelector); err != nil {
+				errs = append(errs, fmt.Sprintf("%s.labelSelector is invalid: %v", field, err))
+			}
+		}
+		key := c.TopologyKey + "/" + string(c.WhenUnsatisfiable)
+		if seen[key] {
+			errs = append(errs, fmt.Sprintf("%s duplicates the topologyKey and whenUnsatisfiable of another constraint", field))
+		}
+		seen[key] = true
+	}
+	return errs
+}
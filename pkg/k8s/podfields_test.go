@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestUnstructuredPodFields(t *testing.T) {
+	nginx := baseNginx()
+	assert.False(t, HasUnstructuredPodFields(&nginx.Spec))
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	typedHash, _ := GeneratedHashOf(dep)
+
+	nginx.Spec.PodTemplate.RuntimeClassName = "gvisor"
+	assert.True(t, HasUnstructuredPodFields(&nginx.Spec))
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	hash, _ := GeneratedHashOf(dep)
+	assert.NotEqual(t, typedHash.Spec, hash.Spec)
+	assert.NotEqual(t, typedHash.Template, hash.Template)
+
+	u, err := UnstructuredWorkload(&nginx, dep)
+	assert.Nil(t, err)
+	assert.Equal(t, "Deployment", u.GetKind())
+	assert.Equal(t, dep.Name, u.GetName())
+	name, _ := unstructured.NestedString(u.Object, "spec", "template", "spec", "runtimeClassName")
+	assert.Equal(t, "gvisor", name)
+
+	nginx.Spec.Rollout = &v1alpha1.NginxRollout{CanaryPods: 1}
+	pods, err := NewCanaryPods(&nginx, dep)
+	assert.Nil(t, err)
+	u, err = UnstructuredWorkload(&nginx, pods[0])
+	assert.Nil(t, err)
+	name, _ = unstructured.NestedString(u.Object, "spec", "runtimeClassName")
+	assert.Equal(t, "gvisor", name)
+
+	rollout, err := NewRollout(&nginx)
+	assert.Nil(t, err)
+	name, _ = unstructured.NestedString(rollout.Object, "spec", "template", "spec", "runtimeClassName")
+	assert.Equal(t, "gvisor", name)
+}
+
+func TestTopologySpreadConstraints(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.PodTemplate.TopologySpreadConstraints = []v1alpha1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: v1alpha1.DoNotSchedule},
+		{
+			MaxSkew:           2,
+			TopologyKey:       "kubernetes.io/hostname",
+			WhenUnsatisfiable: v1alpha1.ScheduleAnyway,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "edge"}},
+		},
+	}
+	assert.True(t, HasUnstructuredPodFields(&nginx.Spec))
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	u, err := UnstructuredWorkload(&nginx, dep)
+	assert.Nil(t, err)
+	constraints, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "topologySpreadConstraints")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"maxSkew":           int64(1),
+			"topologyKey":       "topology.kubernetes.io/zone",
+			"whenUnsatisfiable": "DoNotSchedule",
+			"labelSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"app": "nginx", "nginx_cr": "my-nginx"},
+			},
+		},
+		map[string]interface{}{
+			"maxSkew":           int64(2),
+			"topologyKey":       "kubernetes.io/hostname",
+			"whenUnsatisfiable": "ScheduleAnyway",
+			"labelSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{"tier": "edge"},
+			},
+		},
+	}, constraints)
+}
+
+func TestValidateUnstructuredPodFields(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.PodTemplate.RuntimeClassName = "gvisor"
+	assert.Empty(t, validateUnstructuredPodFields(&nginx.Spec))
+
+	nginx.Spec.PodTemplate.RuntimeClassName = "gVisor_runtime"
+	errs := validateUnstructuredPodFields(&nginx.Spec)
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0], `spec.podTemplate.runtimeClassName "gVisor_runtime" is invalid`)
+	}
+
+	nginx.Spec.PodTemplate.RuntimeClassName = ""
+	nginx.Spec.PodTemplate.TopologySpreadConstraints = []v1alpha1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: v1alpha1.DoNotSchedule},
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: v1alpha1.ScheduleAnyway},
+	}
+	assert.Empty(t, validateUnstructuredPodFields(&nginx.Spec))
+
+	nginx.Spec.PodTemplate.TopologySpreadConstraints = []v1alpha1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: v1alpha1.DoNotSchedule},
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: v1alpha1.DoNotSchedule},
+		{WhenUnsatisfiable: "Maybe"},
+		{
+			MaxSkew:           1,
+			TopologyKey:       "kubernetes.io/hostname",
+			WhenUnsatisfiable: v1alpha1.DoNotSchedule,
+			LabelSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: "Near"},
+			}},
+		},
+	}
+	errs = validateUnstructuredPodFields(&nginx.Spec)
+	assert.Equal(t, []string{
+		"spec.podTemplate.topologySpreadConstraints[1] duplicates the topologyKey and whenUnsatisfiable of another constraint",
+		"spec.podTemplate.topologySpreadConstraints[2].maxSkew must be greater than zero",
+		"spec.podTemplate.topologySpreadConstraints[2].topologyKey is required",
+		`spec.podTemplate.topologySpreadConstraints[2].whenUnsatisfiable "Maybe" is not supported`,
+	}, errs[:4])
+	if assert.Len(t, errs, 5) {
+		assert.Contains(t, errs[4], "spec.podTemplate.topologySpreadConstraints[3].labelSelector is invalid")
+	}
+}
@@ -0,0 +1,301 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodSecurityEnforceLabel is the namespace label with the Pod Security
+// Standard enforced by the PodSecurity admission
+const PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+const (
+	podSecurityPrivileged = "privileged"
+	podSecurityBaseline   = "baseline"
+	podSecurityRestricted = "restricted"
+)
+
+// Capabilities that may be added to containers under the baseline level
+var baselineCapabilities = map[corev1.Capability]bool{
+	"AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true,
+	"FSETID": true, "KILL": true, "MKNOD": true, "NET_BIND_SERVICE": true,
+	"SETFCAP": true, "SETGID": true, "SETPCAP": true, "SETUID": true, "SYS_CHROOT": true,
+}
+
+// PodSecurityViolations returns the reasons why the PodSecurity admission
+// would reject the pod under the given level. Like the admission, unknown
+// levels are enforced as restricted. Checks not expressible in the pod spec
+// of this API version, like seccomp profiles, are left out.
+func PodSecurityViolations(level string, spec *corev1.PodSpec) []string {
+	switch level {
+	case "", podSecurityPrivileged:
+		return nil
+	case podSecurityBaseline:
+	default:
+		level = podSecurityRestricted
+	}
+	restricted := level == podSecurityRestricted
+
+	var errs []string
+	if spec.HostNetwork {
+		errs = append(errs, "hostNetwork must not be set")
+	}
+	if spec.HostPID {
+		errs = append(errs, "hostPID must not be set")
+	}
+	if spec.HostIPC {
+		errs = append(errs, "hostIPC must not be set")
+	}
+	for _, v := range spec.Volumes {
+		if v.HostPath != nil {
+			errs = append(errs, fmt.Sprintf("volume %q must not use hostPath", v.Name))
+		} else if restricted && !restrictedVolume(v.VolumeSource) {
+			errs = append(errs, fmt.Sprintf("volume %q must use an allowed volume type", v.Name))
+		}
+	}
+	podNonRoot := false
+	if sc := spec.SecurityContext; sc != nil {
+		podNonRoot = sc.RunAsNonRoot != nil && *sc.RunAsNonRoot
+		if restricted && sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			errs = append(errs, "securityContext.runAsUser must not be 0")
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		name := fmt.Sprintf("container %q", c.Name)
+		for _, p := range c.Ports {
+			if p.HostPort != 0 {
+				errs = append(errs, fmt.Sprintf("%s must not set hostPort %d", name, p.HostPort))
+			}
+		}
+		sc := c.SecurityContext
+		if sc == nil {
+			sc = &corev1.SecurityContext{}
+		}
+		if sc.Privileged != nil && *sc.Privileged {
+			errs = append(errs, fmt.Sprintf("%s must not be privileged", name))
+		}
+		var added, dropped []corev1.Capability
+		if sc.Capabilities != nil {
+			added, dropped = sc.Capabilities.Add, sc.Capabilities.Drop
+		}
+		for _, capability := range added {
+			if !baselineCapabilities[capability] || (restricted && capability != "NET_BIND_SERVICE") {
+				errs = append(errs, fmt.Sprintf("%s must not add capability %s", name, capability))
+			}
+		}
+		if !restricted {
+			continue
+		}
+		if !dropsAll(dropped) {
+			errs = append(errs, fmt.Sprintf("%s must drop capability ALL", name))
+		}
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			errs = append(errs, fmt.Sprintf("%s must set securityContext.allowPrivilegeEscalation to false", name))
+		}
+		if sc.RunAsNonRoot != nil && !*sc.RunAsNonRoot || sc.RunAsNonRoot == nil && !podNonRoot {
+			errs = append(errs, fmt.Sprintf("%s must set securityContext.runAsNonRoot to true", name))
+		}
+		if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			errs = append(errs, fmt.Sprintf("%s must not set securityContext.runAsUser to 0", name))
+		}
+	}
+	return errs
+}
+
+func restrictedVolume(v corev1.VolumeSource) bool {
+	return v.ConfigMap != nil || v.DownwardAPI != nil || v.EmptyDir != nil ||
+		v.PersistentVolumeClaim != nil || v.Projected != nil || v.Secret != nil
+}
+
+func dropsAll(caps []corev1.Capability) bool {
+	for _, c := range caps {
+		if c == "ALL" {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLimitRangeDefaults returns a copy of the pod spec with the default
+// requests and limits of the container limit ranges applied to the
+// containers that do not set them, like the LimitRanger admission does.
+// Requests missing from containers with limits default to the limits.
+func WithLimitRangeDefaults(spec *corev1.PodSpec, ranges []corev1.LimitRange) *corev1.PodSpec {
+	out := spec.DeepCopy()
+	for _, containers := range [][]corev1.Container{out.InitContainers, out.Containers} {
+		for i := range containers {
+			res := &containers[i].Resources
+			for _, r := range ranges {
+				for _, item := range r.Spec.Limits {
+					if item.Type != corev1.LimitTypeContainer {
+						continue
+					}
+					res.Limits = withDefaults(res.Limits, item.Default)
+					res.Requests = withDefaults(res.Requests, item.DefaultRequest)
+				}
+			}
+			res.Requests = withDefaults(res.Requests, res.Limits)
+		}
+	}
+	return out
+}
+
+func withDefaults(list, defaults corev1.ResourceList) corev1.ResourceList {
+	for name, q := range defaults {
+		if _, ok := list[name]; ok {
+			continue
+		}
+		if list == nil {
+			list = corev1.ResourceList{}
+		}
+		list[name] = q
+	}
+	return list
+}
+
+// LimitRangeViolations returns the reasons why the LimitRanger admission
+// would reject the pod. The limit range defaults must already be applied.
+func LimitRangeViolations(spec *corev1.PodSpec, ranges []corev1.LimitRange) []string {
+	var errs []string
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, r := range ranges {
+		for _, item := range r.Spec.Limits {
+			switch item.Type {
+			case corev1.LimitTypeContainer:
+				for _, c := range containers {
+					errs = append(errs, checkLimitRange(fmt.Sprintf("container %q", c.Name), r.Name, item, c.Resources)...)
+				}
+			case corev1.LimitTypePod:
+				errs = append(errs, checkLimitRange("pod", r.Name, item, podResources(spec))...)
+			}
+		}
+	}
+	return errs
+}
+
+func checkLimitRange(subject, name string, item corev1.LimitRangeItem, res corev1.ResourceRequirements) []string {
+	var errs []string
+	for _, resourceName := range sortedResourceNames(item.Min) {
+		min := item.Min[resourceName]
+		if q, ok := res.Requests[resourceName]; !ok || q.Cmp(min) < 0 {
+			errs = append(errs, fmt.Sprintf("%s %s request must be at least %s, the minimum of limit range %q", subject, resourceName, min.String(), name))
+		}
+	}
+	for _, resourceName := range sortedResourceNames(item.Max) {
+		max := item.Max[resourceName]
+		if q, ok := res.Limits[resourceName]; !ok || q.Cmp(max) > 0 {
+			errs = append(errs, fmt.Sprintf("%s %s limit must be set to at most %s, the maximum of limit range %q", subject, resourceName, max.String(), name))
+		}
+	}
+	return errs
+}
+
+// ResourceQuotaViolations returns the reasons why the ResourceQuota admission
+// would reject the pod, regardless of the usage of the quotas. Quotas with
+// scopes are left out. The limit range defaults must already be applied.
+func ResourceQuotaViolations(spec *corev1.PodSpec, quotas []corev1.ResourceQuota) []string {
+	tracked := []struct {
+		quota    []corev1.ResourceName
+		resource corev1.ResourceName
+		limit    bool
+	}{
+		{[]corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceRequestsCPU}, corev1.ResourceCPU, false},
+		{[]corev1.ResourceName{corev1.ResourceMemory, corev1.ResourceRequestsMemory}, corev1.ResourceMemory, false},
+		{[]corev1.ResourceName{corev1.ResourceLimitsCPU}, corev1.ResourceCPU, true},
+		{[]corev1.ResourceName{corev1.ResourceLimitsMemory}, corev1.ResourceMemory, true},
+	}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	total := podResources(spec)
+
+	var errs []string
+	for _, quota := range quotas {
+		if len(quota.Spec.Scopes) > 0 {
+			continue
+		}
+		hard := quota.Spec.Hard
+		if pods, ok := hard[corev1.ResourcePods]; ok && pods.IsZero() {
+			errs = append(errs, fmt.Sprintf("resource quota %q allows no pods", quota.Name))
+		}
+		for _, t := range tracked {
+			kind, used := "request", total.Requests
+			if t.limit {
+				kind, used = "limit", total.Limits
+			}
+			checked := false
+			for _, quotaName := range t.quota {
+				max, ok := hard[quotaName]
+				if !ok {
+					continue
+				}
+				for _, c := range containers {
+					list := c.Resources.Requests
+					if t.limit {
+						list = c.Resources.Limits
+					}
+					if _, ok := list[t.resource]; !ok && !checked {
+						errs = append(errs, fmt.Sprintf("container %q must set a %s %s, tracked by resource quota %q", c.Name, t.resource, kind, quota.Name))
+					}
+				}
+				checked = true
+				if q, ok := used[t.resource]; ok && q.Cmp(max) > 0 {
+					errs = append(errs, fmt.Sprintf("pod %s %s %s exceeds the %s %s of resource quota %q", t.resource, kind, q.String(), max.String(), quotaName, quota.Name))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// podResources returns the effective requests and limits of the pod: the sum
+// of its containers, or the largest init container if greater. The pod has
+// no limit of a resource when any of its containers has none.
+func podResources(spec *corev1.PodSpec) corev1.ResourceRequirements {
+	total := corev1.ResourceRequirements{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+	unlimited := make(map[corev1.ResourceName]bool)
+	for _, c := range spec.Containers {
+		addResources(total.Requests, c.Resources.Requests)
+		addResources(total.Limits, c.Resources.Limits)
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if _, ok := c.Resources.Limits[name]; !ok {
+				unlimited[name] = true
+			}
+		}
+	}
+	for name := range unlimited {
+		delete(total.Limits, name)
+	}
+	for _, c := range spec.InitContainers {
+		maxResources(total.Requests, c.Resources.Requests)
+		maxResources(total.Limits, c.Resources.Limits)
+	}
+	return total
+}
+
+func addResources(total, list corev1.ResourceList) {
+	for name, q := range list {
+		sum := total[name]
+		sum.Add(q)
+		total[name] = sum
+	}
+}
+
+func maxResources(total, list corev1.ResourceList) {
+	for name, q := range list {
+		if curr, ok := total[name]; !ok || q.Cmp(curr) > 0 {
+			total[name] = q
+		}
+	}
+}
+
+func sortedResourceNames(list corev1.ResourceList) []corev1.ResourceName {
+	var names []corev1.ResourceName
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
@@ -0,0 +1,226 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodSecurityViolations(t *testing.T) {
+	yes, no := true, false
+	root := int64(0)
+	hardened := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &no,
+		RunAsNonRoot:             &yes,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+			Add:  []corev1.Capability{"NET_BIND_SERVICE"},
+		},
+	}
+	tests := []struct {
+		name  string
+		level string
+		spec  corev1.PodSpec
+		want  []string
+	}{
+		{
+			name: "no-level",
+			spec: corev1.PodSpec{HostNetwork: true},
+		},
+		{
+			name:  "privileged",
+			level: "privileged",
+			spec:  corev1.PodSpec{HostNetwork: true},
+		},
+		{
+			name:  "baseline",
+			level: "baseline",
+			spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+				Containers: []corev1.Container{{
+					Name:            "nginx",
+					SecurityContext: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"CHOWN"}}},
+				}},
+			},
+		},
+		{
+			name:  "baseline-violations",
+			level: "baseline",
+			spec: corev1.PodSpec{
+				HostNetwork: true,
+				HostPID:     true,
+				Volumes:     []corev1.Volume{{Name: "logs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log"}}}},
+				Containers: []corev1.Container{{
+					Name:  "nginx",
+					Ports: []corev1.ContainerPort{{ContainerPort: 80, HostPort: 80}},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged:   &yes,
+						Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+					},
+				}},
+			},
+			want: []string{
+				"hostNetwork must not be set",
+				"hostPID must not be set",
+				`volume "logs" must not use hostPath`,
+				`container "nginx" must not set hostPort 80`,
+				`container "nginx" must not be privileged`,
+				`container "nginx" must not add capability NET_ADMIN`,
+			},
+		},
+		{
+			name:  "restricted",
+			level: "restricted",
+			spec: corev1.PodSpec{
+				Volumes:    []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}}}},
+				Containers: []corev1.Container{{Name: "nginx", SecurityContext: hardened}},
+			},
+		},
+		{
+			name:  "restricted-violations",
+			level: "restricted",
+			spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: &root},
+				Volumes:         []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{}}}},
+				Containers: []corev1.Container{{
+					Name:            "nginx",
+					SecurityContext: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"CHOWN"}}},
+				}},
+			},
+			want: []string{
+				`volume "data" must use an allowed volume type`,
+				"securityContext.runAsUser must not be 0",
+				`container "nginx" must not add capability CHOWN`,
+				`container "nginx" must drop capability ALL`,
+				`container "nginx" must set securityContext.allowPrivilegeEscalation to false`,
+				`container "nginx" must set securityContext.runAsNonRoot to true`,
+			},
+		},
+		{
+			name:  "unknown-level-is-restricted",
+			level: "strict",
+			spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: &yes},
+				Containers:      []corev1.Container{{Name: "nginx", SecurityContext: &corev1.SecurityContext{AllowPrivilegeEscalation: &no}}},
+			},
+			want: []string{`container "nginx" must drop capability ALL`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, PodSecurityViolations(tt.level, &tt.spec))
+		})
+	}
+}
+
+func TestLimitRanges(t *testing.T) {
+	ranges := []corev1.LimitRange{{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{
+			{
+				Type:           corev1.LimitTypeContainer,
+				Default:        corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+				DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				Min:            corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+				Max:            corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			},
+			{
+				Type: corev1.LimitTypePod,
+				Max:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("768Mi")},
+			},
+		}},
+	}}
+	tests := []struct {
+		name       string
+		containers []corev1.Container
+		want       []string
+	}{
+		{
+			name:       "defaults",
+			containers: []corev1.Container{{Name: "nginx"}},
+		},
+		{
+			name: "violations",
+			containers: []corev1.Container{
+				{Name: "nginx", Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				}},
+				{Name: "exporter"},
+			},
+			want: []string{
+				`container "nginx" cpu request must be at least 50m, the minimum of limit range "limits"`,
+				`container "nginx" memory limit must be set to at most 512Mi, the maximum of limit range "limits"`,
+				`pod memory limit must be set to at most 768Mi, the maximum of limit range "limits"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := WithLimitRangeDefaults(&corev1.PodSpec{Containers: tt.containers}, ranges)
+			assert.Equal(t, tt.want, LimitRangeViolations(spec, ranges))
+		})
+	}
+
+	spec := WithLimitRangeDefaults(&corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx"}}}, ranges)
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("256Mi")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+	}, spec.Containers[0].Resources)
+}
+
+func TestResourceQuotaViolations(t *testing.T) {
+	quota := func(hard corev1.ResourceList, scopes ...corev1.ResourceQuotaScope) corev1.ResourceQuota {
+		return corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute"},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard, Scopes: scopes},
+		}
+	}
+	requests := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+	}
+	tests := []struct {
+		name       string
+		containers []corev1.Container
+		quotas     []corev1.ResourceQuota
+		want       []string
+	}{
+		{
+			name:       "no-quotas",
+			containers: []corev1.Container{{Name: "nginx"}},
+		},
+		{
+			name:       "within-quota",
+			containers: []corev1.Container{{Name: "nginx", Resources: requests}},
+			quotas:     []corev1.ResourceQuota{quota(corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")})},
+		},
+		{
+			name:       "scoped-quota",
+			containers: []corev1.Container{{Name: "nginx"}},
+			quotas:     []corev1.ResourceQuota{quota(corev1.ResourceList{corev1.ResourceLimitsCPU: resource.MustParse("1")}, corev1.ResourceQuotaScopeNotBestEffort)},
+		},
+		{
+			name:       "violations",
+			containers: []corev1.Container{{Name: "nginx", Resources: requests}, {Name: "exporter", Resources: requests}},
+			quotas: []corev1.ResourceQuota{quota(corev1.ResourceList{
+				corev1.ResourceCPU:          resource.MustParse("800m"),
+				corev1.ResourceLimitsMemory: resource.MustParse("1Gi"),
+				corev1.ResourcePods:         resource.MustParse("0"),
+			})},
+			want: []string{
+				`resource quota "compute" allows no pods`,
+				`pod cpu request 1 exceeds the 800m cpu of resource quota "compute"`,
+				`container "nginx" must set a memory limit, tracked by resource quota "compute"`,
+				`container "exporter" must set a memory limit, tracked by resource quota "compute"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ResourceQuotaViolations(&corev1.PodSpec{Containers: tt.containers}, tt.quotas))
+		})
+	}
+}
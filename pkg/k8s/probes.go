@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// Kubernetes defaults of the probe period and failure threshold, used to
+	// compute the startup budget
+	defaultProbePeriodSeconds    = 10
+	defaultProbeFailureThreshold = 3
+)
+
+// setupProbes applies the healthcheck of the nginx to the nginx container.
+// It must run after setupTLS, since the probes default to the handler of the
+// default readiness probe.
+func setupProbes(hc *v1alpha1.NginxHealthcheck, dep *appv1.Deployment) {
+	if hc == nil {
+		return
+	}
+	nginx := &dep.Spec.Template.Spec.Containers[0]
+	base := *nginx.ReadinessProbe.HTTPGet
+	if hc.Readiness != nil {
+		nginx.ReadinessProbe = newProbe(hc.Readiness, base)
+	}
+	if hc.Liveness != nil {
+		nginx.LivenessProbe = newProbe(hc.Liveness, base)
+		if s := hc.Startup; s != nil {
+			nginx.LivenessProbe.InitialDelaySeconds += startupBudget(s)
+		}
+	}
+}
+
+func newProbe(p *v1alpha1.NginxProbe, base corev1.HTTPGetAction) *corev1.Probe {
+	action := base
+	if p.Path != "" {
+		action.Path = p.Path
+	}
+	if p.Port != nil {
+		action.Port = *p.Port
+	}
+	if p.Scheme != "" {
+		action.Scheme = p.Scheme
+	}
+	return &corev1.Probe{
+		Handler:             corev1.Handler{HTTPGet: &action},
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		SuccessThreshold:    p.SuccessThreshold,
+		FailureThreshold:    p.FailureThreshold,
+	}
+}
+
+// startupBudget returns the number of seconds a container may take to start
+func startupBudget(s *v1alpha1.NginxStartupProbe) int32 {
+	period, threshold := s.PeriodSeconds, s.FailureThreshold
+	if period == 0 {
+		period = defaultProbePeriodSeconds
+	}
+	if threshold == 0 {
+		threshold = defaultProbeFailureThreshold
+	}
+	return s.InitialDelaySeconds + period*threshold
+}
+
+// validateHealthcheck returns the errors found in the healthcheck of the spec
+func validateHealthcheck(hc *v1alpha1.NginxHealthcheck) []string {
+	if hc == nil {
+		return nil
+	}
+	var errs []string
+	errs = append(errs, validateProbe("spec.healthcheck.readiness", hc.Readiness)...)
+	errs = append(errs, validateProbe("spec.healthcheck.liveness", hc.Liveness)...)
+	if l := hc.Liveness; l != nil && l.SuccessThreshold > 1 {
+		errs = append(errs, "spec.healthcheck.liveness.successThreshold must be 1")
+	}
+	if s := hc.Startup; s != nil {
+		if hc.Liveness == nil {
+			errs = append(errs, "spec.healthcheck.startup requires spec.healthcheck.liveness")
+		}
+		errs = append(errs, negativeFields("spec.healthcheck.startup", map[string]int32{
+			"initialDelaySeconds": s.InitialDelaySeconds,
+			"periodSeconds":       s.PeriodSeconds,
+			"failureThreshold":    s.FailureThreshold,
+		})...)
+	}
+	return errs
+}
+
+func validateProbe(field string, p *v1alpha1.NginxProbe) []string {
+	if p == nil {
+		return nil
+	}
+	var errs []string
+	if p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+		errs = append(errs, fmt.Sprintf("%s.path %q must start with /", field, p.Path))
+	}
+	if port := p.Port; port != nil {
+		if port.Type == intstr.Int && (port.IntVal < 1 || port.IntVal > 65535) {
+			errs = append(errs, fmt.Sprintf("%s.port %d is out of range", field, port.IntVal))
+		}
+		if port.Type == intstr.String && port.StrVal == "" {
+			errs = append(errs, fmt.Sprintf("%s.port must not be empty", field))
+		}
+	}
+	switch p.Scheme {
+	case "", corev1.URISchemeHTTP, corev1.URISchemeHTTPS:
+	default:
+		errs = append(errs, fmt.Sprintf("%s.scheme %q is not supported", field, p.Scheme))
+	}
+	return append(errs, negativeFields(field, map[string]int32{
+		"initialDelaySeconds": p.InitialDelaySeconds,
+		"timeoutSeconds":      p.TimeoutSeconds,
+		"periodSeconds":       p.PeriodSeconds,
+		"successThreshold":    p.SuccessThreshold,
+		"failureThreshold":    p.FailureThreshold,
+	})...)
+}
+
+// negativeFields reports, in a stable order, the fields with negative values
+func negativeFields(field string, values map[string]int32) []string {
+	var errs []string
+	for _, name := range []string{"initialDelaySeconds", "timeoutSeconds", "periodSeconds", "successThreshold", "failureThreshold"} {
+		if v, ok := values[name]; ok && v < 0 {
+			errs = append(errs, fmt.Sprintf("%s.%s must not be negative", field, name))
+		}
+	}
+	return errs
+}
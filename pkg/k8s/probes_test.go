@@ -0,0 +1,125 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestSetupProbes(t *testing.T) {
+	port := intstr.FromInt(8080)
+	tests := []struct {
+		name          string
+		tls           bool
+		healthcheck   *v1alpha1.NginxHealthcheck
+		wantReadiness *corev1.Probe
+		wantLiveness  *corev1.Probe
+	}{
+		{
+			name: "no-healthcheck",
+			wantReadiness: &corev1.Probe{Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{
+				Path: "/", Port: intstr.FromString("http"), Scheme: corev1.URISchemeHTTP,
+			}}},
+		},
+		{
+			name: "readiness-and-liveness",
+			healthcheck: &v1alpha1.NginxHealthcheck{
+				Readiness: &v1alpha1.NginxProbe{Path: "/ready", PeriodSeconds: 5, FailureThreshold: 2},
+				Liveness:  &v1alpha1.NginxProbe{Path: "/healthz", Port: &port, TimeoutSeconds: 3},
+			},
+			wantReadiness: &corev1.Probe{
+				Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{
+					Path: "/ready", Port: intstr.FromString("http"), Scheme: corev1.URISchemeHTTP,
+				}},
+				PeriodSeconds:    5,
+				FailureThreshold: 2,
+			},
+			wantLiveness: &corev1.Probe{
+				Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{
+					Path: "/healthz", Port: intstr.FromInt(8080), Scheme: corev1.URISchemeHTTP,
+				}},
+				TimeoutSeconds: 3,
+			},
+		},
+		{
+			name: "tls-defaults-and-startup",
+			tls:  true,
+			healthcheck: &v1alpha1.NginxHealthcheck{
+				Liveness: &v1alpha1.NginxProbe{InitialDelaySeconds: 5},
+				Startup:  &v1alpha1.NginxStartupProbe{InitialDelaySeconds: 10, FailureThreshold: 30},
+			},
+			wantReadiness: &corev1.Probe{Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{
+				Path: "/", Port: intstr.FromString("https"), Scheme: corev1.URISchemeHTTPS,
+			}}},
+			wantLiveness: &corev1.Probe{
+				Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{
+					Path: "/", Port: intstr.FromString("https"), Scheme: corev1.URISchemeHTTPS,
+				}},
+				InitialDelaySeconds: 5 + 10 + 10*30,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			if tt.tls {
+				nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "cert"}
+			}
+			nginx.Spec.Healthcheck = tt.healthcheck
+			dep, err := NewDeployment(&nginx)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantReadiness, dep.Spec.Template.Spec.Containers[0].ReadinessProbe)
+			assert.Equal(t, tt.wantLiveness, dep.Spec.Template.Spec.Containers[0].LivenessProbe)
+		})
+	}
+}
+
+func TestValidateHealthcheck(t *testing.T) {
+	port := intstr.FromInt(0)
+	tests := []struct {
+		name        string
+		healthcheck *v1alpha1.NginxHealthcheck
+		want        []string
+	}{
+		{
+			name: "valid",
+			healthcheck: &v1alpha1.NginxHealthcheck{
+				Readiness: &v1alpha1.NginxProbe{Path: "/ready", Scheme: corev1.URISchemeHTTPS},
+				Liveness:  &v1alpha1.NginxProbe{SuccessThreshold: 1},
+				Startup:   &v1alpha1.NginxStartupProbe{FailureThreshold: 30},
+			},
+		},
+		{
+			name: "invalid-probes",
+			healthcheck: &v1alpha1.NginxHealthcheck{
+				Readiness: &v1alpha1.NginxProbe{Path: "ready", Port: &port, Scheme: "TCP", TimeoutSeconds: -1},
+				Liveness:  &v1alpha1.NginxProbe{SuccessThreshold: 2},
+			},
+			want: []string{
+				`spec.healthcheck.readiness.path "ready" must start with /`,
+				"spec.healthcheck.readiness.port 0 is out of range",
+				`spec.healthcheck.readiness.scheme "TCP" is not supported`,
+				"spec.healthcheck.readiness.timeoutSeconds must not be negative",
+				"spec.healthcheck.liveness.successThreshold must be 1",
+			},
+		},
+		{
+			name: "startup-without-liveness",
+			healthcheck: &v1alpha1.NginxHealthcheck{
+				Startup: &v1alpha1.NginxStartupProbe{PeriodSeconds: -5},
+			},
+			want: []string{
+				"spec.healthcheck.startup requires spec.healthcheck.liveness",
+				"spec.healthcheck.startup.periodSeconds must not be negative",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateHealthcheck(tt.healthcheck))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+// ProfileLabel is the namespace label selecting the profile of spec.profiles
+// merged into the spec of the nginx objects in the namespace
+const ProfileLabel = "nginx.tsuru.io/profile"
+
+// SelectedProfile returns the name of the profile selected by the namespace
+// labels, or else the operator default profile
+func SelectedProfile(nsLabels map[string]string, operatorProfile string) string {
+	if name := nsLabels[ProfileLabel]; name != "" {
+		return name
+	}
+	return operatorProfile
+}
+
+// WithProfile returns a copy of the spec with the named profile merged into
+// it, and whether the spec defines the profile. The spec is copied as is
+// when the profile is not defined. The receiver is never modified.
+func WithProfile(spec *v1alpha1.NginxSpec, name string) (*v1alpha1.NginxSpec, bool) {
+	out := spec.DeepCopy()
+	p, ok := spec.Profiles[name]
+	if name == "" || !ok {
+		return out, false
+	}
+	p = *p.DeepCopy()
+	if p.Replicas != nil {
+		out.Replicas = p.Replicas
+	}
+	if p.Image != "" {
+		out.Image = p.Image
+	}
+	if p.Resources != nil {
+		out.PodTemplate.Resources = *p.Resources
+	}
+	if p.NodeSelector != nil {
+		out.PodTemplate.NodeSelector = p.NodeSelector
+	}
+	if p.Tolerations != nil {
+		out.PodTemplate.Tolerations = p.Tolerations
+	}
+	if len(p.Values) > 0 {
+		values := make(map[string]string, len(out.Values)+len(p.Values))
+		for k, v := range out.Values {
+			values[k] = v
+		}
+		for k, v := range p.Values {
+			values[k] = v
+		}
+		out.Values = values
+	}
+	return out, true
+}
+
+// validateProfiles returns the errors found in the profiles of the spec
+func validateProfiles(spec *v1alpha1.NginxSpec) []string {
+	names := make([]string, 0, len(spec.Profiles))
+	for name := range spec.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []string
+	for _, name := range names {
+		if name == "" {
+			errs = append(errs, "spec.profiles cannot have an empty name")
+			continue
+		}
+		if r := spec.Profiles[name].Replicas; r != nil && *r < 0 {
+			errs = append(errs, fmt.Sprintf("spec.profiles.%s.replicas must not be negative", name))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSelectedProfile(t *testing.T) {
+	assert.Equal(t, "", SelectedProfile(nil, ""))
+	assert.Equal(t, "prod", SelectedProfile(nil, "prod"))
+	assert.Equal(t, "dev", SelectedProfile(map[string]string{ProfileLabel: "dev"}, "prod"))
+	assert.Equal(t, "prod", SelectedProfile(map[string]string{"team": "a"}, "prod"))
+}
+
+func TestWithProfile(t *testing.T) {
+	one, six := int32(1), int32(6)
+	spec := &v1alpha1.NginxSpec{
+		Image:    "nginx:1.15",
+		Replicas: &one,
+		Values:   map[string]string{"upstream": "backend.dev", "timeout": "5s"},
+		PodTemplate: v1alpha1.NginxPodTemplateSpec{
+			NodeSelector: map[string]string{"pool": "default"},
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			},
+		},
+		Profiles: map[string]v1alpha1.NginxProfile{
+			"prod": {
+				Replicas: &six,
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				},
+				Tolerations: []corev1.Toleration{{Key: "edge", Operator: corev1.TolerationOpExists}},
+				Values:      map[string]string{"upstream": "backend.prod"},
+			},
+			"staging": {Image: "nginx:1.16"},
+		},
+	}
+	original := spec.DeepCopy()
+
+	tests := []struct {
+		name    string
+		profile string
+		applied bool
+		check   func(*testing.T, *v1alpha1.NginxSpec)
+	}{
+		{
+			name: "no-profile",
+			check: func(t *testing.T, out *v1alpha1.NginxSpec) {
+				assert.Equal(t, original, out)
+			},
+		},
+		{
+			name:    "unknown-profile",
+			profile: "dev",
+			check: func(t *testing.T, out *v1alpha1.NginxSpec) {
+				assert.Equal(t, original, out)
+			},
+		},
+		{
+			name:    "prod",
+			profile: "prod",
+			applied: true,
+			check: func(t *testing.T, out *v1alpha1.NginxSpec) {
+				assert.Equal(t, int32(6), *out.Replicas)
+				assert.Equal(t, "nginx:1.15", out.Image)
+				assert.Equal(t, "1", out.PodTemplate.Resources.Limits.Cpu().String())
+				assert.Equal(t, map[string]string{"pool": "default"}, out.PodTemplate.NodeSelector)
+				assert.Equal(t, []corev1.Toleration{{Key: "edge", Operator: corev1.TolerationOpExists}}, out.PodTemplate.Tolerations)
+				assert.Equal(t, map[string]string{"upstream": "backend.prod", "timeout": "5s"}, out.Values)
+			},
+		},
+		{
+			name:    "staging",
+			profile: "staging",
+			applied: true,
+			check: func(t *testing.T, out *v1alpha1.NginxSpec) {
+				assert.Equal(t, "nginx:1.16", out.Image)
+				assert.Equal(t, int32(1), *out.Replicas)
+				assert.Equal(t, original.Values, out.Values)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, applied := WithProfile(spec, tt.profile)
+			assert.Equal(t, tt.applied, applied)
+			tt.check(t, out)
+			assert.Equal(t, original, spec)
+		})
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	negative := int32(-1)
+	spec := &v1alpha1.NginxSpec{Profiles: map[string]v1alpha1.NginxProfile{
+		"prod": {Replicas: &negative},
+		"dev":  {},
+		"":     {Image: "nginx"},
+	}}
+	assert.Equal(t, []string{
+		"spec.profiles cannot have an empty name",
+		"spec.profiles.prod.replicas must not be negative",
+	}, validateProfiles(spec))
+	assert.Nil(t, validateProfiles(&v1alpha1.NginxSpec{}))
+}
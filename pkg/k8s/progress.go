@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"strconv"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deploymentRevisionAnnotation is set by the deployment controller on
+// deployments and their replica sets to number the rollouts
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// NewDeploymentStatus mirrors the rollout state of the deployment. The
+// revision hash and the last rollout time are taken from the replica set of
+// the latest revision, among the given ones, when found.
+func NewDeploymentStatus(dep *appv1.Deployment, replicaSets []appv1.ReplicaSet) *v1alpha1.NginxDeploymentStatus {
+	status := &v1alpha1.NginxDeploymentStatus{
+		UpdatedReplicas:     dep.Status.UpdatedReplicas,
+		ReadyReplicas:       dep.Status.ReadyReplicas,
+		UnavailableReplicas: dep.Status.UnavailableReplicas,
+	}
+	if rs := latestReplicaSet(dep, replicaSets); rs != nil {
+		status.RevisionHash = rs.Labels[appv1.DefaultDeploymentUniqueLabelKey]
+		created := rs.CreationTimestamp
+		status.LastRolloutTime = &created
+	}
+	return status
+}
+
+// ProgressingCondition returns the Progressing condition of the deployment
+// as an nginx condition, or nil if the deployment does not report it yet
+func ProgressingCondition(dep *appv1.Deployment) *v1alpha1.NginxCondition {
+	for _, c := range dep.Status.Conditions {
+		if c.Type != appv1.DeploymentProgressing {
+			continue
+		}
+		return &v1alpha1.NginxCondition{
+			Type:               v1alpha1.NginxConditionProgressing,
+			Status:             c.Status,
+			LastTransitionTime: c.LastTransitionTime,
+			Reason:             c.Reason,
+			Message:            c.Message,
+		}
+	}
+	return nil
+}
+
+// latestReplicaSet returns the replica set controlled by the deployment with
+// its current revision. Before the deployment controller numbers the
+// revisions, the replica set with the highest one is used.
+func latestReplicaSet(dep *appv1.Deployment, replicaSets []appv1.ReplicaSet) *appv1.ReplicaSet {
+	want := dep.Annotations[deploymentRevisionAnnotation]
+	var latest *appv1.ReplicaSet
+	latestRevision := int64(-1)
+	for i := range replicaSets {
+		rs := &replicaSets[i]
+		if !metav1.IsControlledBy(rs, dep) {
+			continue
+		}
+		value := rs.Annotations[deploymentRevisionAnnotation]
+		if want != "" && value == want {
+			return rs
+		}
+		revision, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if revision > latestRevision {
+			latest, latestRevision = rs, revision
+		}
+	}
+	return latest
+}
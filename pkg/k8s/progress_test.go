@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func progressReplicaSet(dep *appv1.Deployment, hash, revision string, created time.Time) appv1.ReplicaSet {
+	controller := true
+	return appv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              dep.Name + "-" + hash,
+			Labels:            map[string]string{appv1.DefaultDeploymentUniqueLabelKey: hash},
+			Annotations:       map[string]string{deploymentRevisionAnnotation: revision},
+			CreationTimestamp: metav1.NewTime(created),
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Deployment", Name: dep.Name, UID: dep.UID, Controller: &controller},
+			},
+		},
+	}
+}
+
+func TestNewDeploymentStatus(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	dep := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-nginx-deployment",
+			UID:         types.UID("deployment-uid"),
+			Annotations: map[string]string{},
+		},
+		Status: appv1.DeploymentStatus{UpdatedReplicas: 1, ReadyReplicas: 3, UnavailableReplicas: 1},
+	}
+	other := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: types.UID("other-uid")}}
+
+	tests := []struct {
+		name        string
+		revision    string
+		replicaSets []appv1.ReplicaSet
+		want        *v1alpha1.NginxDeploymentStatus
+	}{
+		{
+			name:     "current-revision",
+			revision: "2",
+			replicaSets: []appv1.ReplicaSet{
+				progressReplicaSet(dep, "aaa", "1", now.Add(-time.Hour)),
+				progressReplicaSet(dep, "bbb", "2", now),
+				progressReplicaSet(other, "ccc", "2", now.Add(time.Hour)),
+			},
+			want: &v1alpha1.NginxDeploymentStatus{
+				UpdatedReplicas: 1, ReadyReplicas: 3, UnavailableReplicas: 1,
+				RevisionHash: "bbb", LastRolloutTime: &metav1.Time{Time: now},
+			},
+		},
+		{
+			name:     "revision-not-numbered-yet",
+			revision: "",
+			replicaSets: []appv1.ReplicaSet{
+				progressReplicaSet(dep, "aaa", "1", now.Add(-time.Hour)),
+				progressReplicaSet(dep, "bbb", "2", now),
+			},
+			want: &v1alpha1.NginxDeploymentStatus{
+				UpdatedReplicas: 1, ReadyReplicas: 3, UnavailableReplicas: 1,
+				RevisionHash: "bbb", LastRolloutTime: &metav1.Time{Time: now},
+			},
+		},
+		{
+			name:     "no-replica-sets",
+			revision: "2",
+			want:     &v1alpha1.NginxDeploymentStatus{UpdatedReplicas: 1, ReadyReplicas: 3, UnavailableReplicas: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dep.DeepCopy()
+			d.Annotations[deploymentRevisionAnnotation] = tt.revision
+			assert.Equal(t, tt.want, NewDeploymentStatus(d, tt.replicaSets))
+		})
+	}
+}
+
+func TestProgressingCondition(t *testing.T) {
+	dep := &appv1.Deployment{}
+	assert.Nil(t, ProgressingCondition(dep))
+
+	transition := metav1.NewTime(time.Now().Truncate(time.Second))
+	dep.Status.Conditions = []appv1.DeploymentCondition{
+		{Type: appv1.DeploymentAvailable, Status: corev1.ConditionTrue, Reason: "MinimumReplicasAvailable"},
+		{
+			Type:               appv1.DeploymentProgressing,
+			Status:             corev1.ConditionFalse,
+			Reason:             "ProgressDeadlineExceeded",
+			Message:            `ReplicaSet "my-nginx-deployment-bbb" has timed out progressing.`,
+			LastTransitionTime: transition,
+		},
+	}
+	assert.Equal(t, &v1alpha1.NginxCondition{
+		Type:               v1alpha1.NginxConditionProgressing,
+		Status:             corev1.ConditionFalse,
+		Reason:             "ProgressDeadlineExceeded",
+		Message:            `ReplicaSet "my-nginx-deployment-bbb" has timed out progressing.`,
+		LastTransitionTime: transition,
+	}, ProgressingCondition(dep))
+}
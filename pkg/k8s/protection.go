@@ -0,0 +1,27 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+const (
+	// ProtectedLabel marks nginx objects whose deletion must be confirmed
+	ProtectedLabel = "nginx.tsuru.io/protected"
+
+	// ConfirmDeletionAnnotation confirms the deletion of a protected nginx
+	ConfirmDeletionAnnotation = "nginx.tsuru.io/confirm-deletion"
+
+	// ProtectionFinalizer holds protected nginx objects until their deletion
+	// is confirmed
+	ProtectionFinalizer = "nginx.tsuru.io/protection"
+)
+
+// IsProtected reports whether the deletion of the nginx must be confirmed
+func IsProtected(n *v1alpha1.Nginx) bool {
+	return n.Labels[ProtectedLabel] == "true"
+}
+
+// DeletionConfirmed reports whether the deletion of the nginx was confirmed
+func DeletionConfirmed(n *v1alpha1.Nginx) bool {
+	return n.Annotations[ConfirmDeletionAnnotation] == "true"
+}
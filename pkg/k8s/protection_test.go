@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtection(t *testing.T) {
+	tests := []struct {
+		name          string
+		labels        map[string]string
+		annotations   map[string]string
+		wantProtected bool
+		wantConfirmed bool
+	}{
+		{
+			name: "not-protected",
+		},
+		{
+			name:          "protected",
+			labels:        map[string]string{ProtectedLabel: "true"},
+			wantProtected: true,
+		},
+		{
+			name:   "protected-label-not-true",
+			labels: map[string]string{ProtectedLabel: "yes"},
+		},
+		{
+			name:          "protected-and-confirmed",
+			labels:        map[string]string{ProtectedLabel: "true"},
+			annotations:   map[string]string{ConfirmDeletionAnnotation: "true"},
+			wantProtected: true,
+			wantConfirmed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Labels = tt.labels
+			nginx.Annotations = tt.annotations
+			assert.Equal(t, tt.wantProtected, IsProtected(&nginx))
+			assert.Equal(t, tt.wantConfirmed, DeletionConfirmed(&nginx))
+		})
+	}
+}
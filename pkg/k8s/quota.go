@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// QuotaReplicas returns the replicas, up to the desired ones, whose pods fit
+// in the remaining usage of the resource quotas, given the current pods of
+// the nginx, already counted in the usage. When fewer replicas fit, the
+// reason names the quota and the resource limiting them. Scaling down is
+// never limited. Quotas with scopes are left out. The limit range defaults
+// must already be applied to the pod.
+func QuotaReplicas(spec *corev1.PodSpec, quotas []corev1.ResourceQuota, current, desired int32) (int32, string) {
+	if desired <= current {
+		return desired, ""
+	}
+	total := podResources(spec)
+	perPod := map[corev1.ResourceName]resource.Quantity{
+		corev1.ResourcePods:           resource.MustParse("1"),
+		corev1.ResourceCPU:            total.Requests[corev1.ResourceCPU],
+		corev1.ResourceRequestsCPU:    total.Requests[corev1.ResourceCPU],
+		corev1.ResourceMemory:         total.Requests[corev1.ResourceMemory],
+		corev1.ResourceRequestsMemory: total.Requests[corev1.ResourceMemory],
+		corev1.ResourceLimitsCPU:      total.Limits[corev1.ResourceCPU],
+		corev1.ResourceLimitsMemory:   total.Limits[corev1.ResourceMemory],
+	}
+
+	replicas, reason := desired, ""
+	for _, quota := range quotas {
+		if len(quota.Spec.Scopes) > 0 {
+			continue
+		}
+		for _, name := range sortedResourceNames(quota.Spec.Hard) {
+			usage, ok := perPod[name]
+			if !ok || usage.IsZero() {
+				continue
+			}
+			remaining := quota.Spec.Hard[name]
+			remaining.Sub(quota.Status.Used[name])
+			fit := int64(0)
+			if remaining.Sign() > 0 {
+				fit = remaining.MilliValue() / usage.MilliValue()
+			}
+			if allowed := int64(current) + fit; allowed < int64(replicas) {
+				replicas = int32(allowed)
+				reason = fmt.Sprintf("%s of resource quota %q", name, quota.Name)
+			}
+		}
+	}
+	return replicas, reason
+}
+
+// QuotaLimited reports whether the replicas of the nginx are clamped to its
+// resource quotas
+func QuotaLimited(n *v1alpha1.Nginx) bool {
+	c := n.Status.GetCondition(v1alpha1.NginxConditionQuotaLimited)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestQuotaReplicas(t *testing.T) {
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{
+		Name: "nginx",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+	}}}
+	quota := func(name string, hard, used corev1.ResourceList, scopes ...corev1.ResourceQuotaScope) corev1.ResourceQuota {
+		return corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard, Scopes: scopes},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+		}
+	}
+	tests := []struct {
+		name       string
+		quotas     []corev1.ResourceQuota
+		current    int32
+		desired    int32
+		want       int32
+		wantReason string
+	}{
+		{
+			name:    "no-quotas",
+			current: 1, desired: 5, want: 5,
+		},
+		{
+			name: "fits",
+			quotas: []corev1.ResourceQuota{quota("compute",
+				corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2")},
+				corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("500m")})},
+			current: 2, desired: 8, want: 8,
+		},
+		{
+			name: "clamped-by-cpu",
+			quotas: []corev1.ResourceQuota{quota("compute",
+				corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2")},
+				corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")})},
+			current: 2, desired: 10, want: 6, wantReason: `requests.cpu of resource quota "compute"`,
+		},
+		{
+			name: "clamped-by-the-tightest-quota",
+			quotas: []corev1.ResourceQuota{
+				quota("compute",
+					corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("1Gi")},
+					corev1.ResourceList{corev1.ResourceLimitsMemory: resource.MustParse("256Mi")}),
+				quota("objects",
+					corev1.ResourceList{corev1.ResourcePods: resource.MustParse("5")},
+					corev1.ResourceList{corev1.ResourcePods: resource.MustParse("4")}),
+			},
+			current: 2, desired: 10, want: 3, wantReason: `pods of resource quota "objects"`,
+		},
+		{
+			name: "exhausted",
+			quotas: []corev1.ResourceQuota{quota("objects",
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("3")})},
+			current: 2, desired: 4, want: 2, wantReason: `pods of resource quota "objects"`,
+		},
+		{
+			name: "scale-down",
+			quotas: []corev1.ResourceQuota{quota("objects",
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("3")})},
+			current: 3, desired: 1, want: 1,
+		},
+		{
+			name: "scoped-quota",
+			quotas: []corev1.ResourceQuota{quota("objects",
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+				corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+				corev1.ResourceQuotaScopeBestEffort)},
+			current: 2, desired: 4, want: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replicas, reason := QuotaReplicas(spec, tt.quotas, tt.current, tt.desired)
+			assert.Equal(t, tt.want, replicas)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+func TestQuotaLimited(t *testing.T) {
+	nginx := baseNginx()
+	assert.False(t, QuotaLimited(&nginx))
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{Type: v1alpha1.NginxConditionQuotaLimited, Status: corev1.ConditionTrue})
+	assert.True(t, QuotaLimited(&nginx))
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{Type: v1alpha1.NginxConditionQuotaLimited, Status: corev1.ConditionFalse})
+	assert.False(t, QuotaLimited(&nginx))
+}
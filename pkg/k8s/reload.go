@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// configReloadInterval is how often, in seconds, the nginx container
+	// checks whether the mounted config changed
+	configReloadInterval = 5
+
+	// ReloadPodAnnotation requests a reload of nginx in place when set on a
+	// pod to a value different from the current one, like a timestamp. It
+	// only applies to pods that reload their config in place.
+	ReloadPodAnnotation = "nginx.tsuru.io/reload"
+
+	// Mount path and name of the Downward API volume exposing the reload
+	// requests to the nginx container
+	reloadRequestMountPath = "/etc/nginx-reload"
+	reloadRequestVolume    = "nginx-reload"
+)
+
+// reloadScript starts nginx with the given -g directives and reloads it
+// whenever one of the given symlinks is swapped, which is how the kubelet
+// atomically updates ConfigMap and Downward API volumes, through their ..data
+// symlink, and how git-sync publishes new checkouts. The directives are
+// validated not to contain quotes or shell characters.
+func reloadScript(globals string, links ...string) string {
+	reads := make([]string, len(links))
+	for i, l := range links {
+		reads[i] = "readlink " + l
+	}
+	signal := signalCommand(globals)
+	return fmt.Sprintf(`nginx -g '%[3]s' &
+pid=$!
+trap '%[4]s -s quit; wait $pid; exit $?' TERM INT
+version=$(%[1]s)
+while kill -0 $pid 2>/dev/null; do
+  sleep %[2]d
+  current=$(%[1]s)
+  if [ "$current" != "$version" ]; then
+    version=$current
+    %[4]s -s reload
+  fi
+done
+wait $pid
+`, strings.Join(reads, "; "), configReloadInterval, globals, signal)
+}
+
+// signalCommand returns the nginx command sending signals to the running
+// nginx. Signals are sent with the extra -g directives too, which may set the
+// pid file.
+func signalCommand(globals string) string {
+	if globals != defaultGlobals {
+		return fmt.Sprintf(`nginx -g "%s"`, globals)
+	}
+	return "nginx"
+}
+
+// PodReloadsInPlace returns whether the nginx pod reloads nginx in place,
+// and so can be asked to with ReloadPodAnnotation
+func PodReloadsInPlace(pod *corev1.Pod) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == reloadRequestVolume {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadLinks returns the symlinks watched by the nginx container to reload
+// nginx in place, none when it is not reloaded. The spec must have its
+// default values already set.
+func reloadLinks(spec *v1alpha1.NginxSpec) []string {
+	var links []string
+	if spec.ConfigReload == v1alpha1.ConfigReloadReload {
+		if configDirectoryMounted(spec) {
+			links = append(links, configMountPath+"/..data")
+		}
+		if spec.Config != nil && len(spec.Config.Sources) > 0 {
+			links = append(links, defaultConfigIncludePath+"/..data")
+		}
+	}
+	if spec.GitSync != nil {
+		links = append(links, spec.GitSync.MountPath+"/"+gitSyncDest)
+	}
+	return links
+}
+
+// setupConfigReload replaces the nginx container command with one that
+// reloads nginx in place when the mounted config, with the Reload strategy,
+// or the git-sync checkout changes, or when a reload is requested through
+// ReloadPodAnnotation. It requires a shell in the nginx image. The spec must
+// have its default values already set.
+func setupConfigReload(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	links := reloadLinks(spec)
+	if len(links) == 0 {
+		return
+	}
+	links = append(links, reloadRequestMountPath+"/..data")
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: reloadRequestVolume,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{{
+					Path: "request",
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: fmt.Sprintf("metadata.annotations['%s']", ReloadPodAnnotation),
+					},
+				}},
+			},
+		},
+	})
+	nginx := &podSpec.Containers[0]
+	nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+		Name:      reloadRequestVolume,
+		MountPath: reloadRequestMountPath,
+		ReadOnly:  true,
+	})
+	nginx.Command = []string{"/bin/sh", "-c", reloadScript(nginxGlobals(spec), links...)}
+}
@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Render returns the objects the operator creates for the Nginx, in the
+// order they are reconciled, without reading the cluster. Like the operator,
+// the objects are assembled from the spec referencing the generated objects.
+// The objects that depend on the cluster state are left out and described in
+// the returned notes. Invalid instances are errors, as the operator would not
+// reconcile them.
+func Render(n *v1alpha1.Nginx) ([]runtime.Object, []string, error) {
+	if errs := Validate(n); len(errs) > 0 {
+		return nil, nil, fmt.Errorf("invalid nginx: %s", strings.Join(errs, ", "))
+	}
+	n = n.DeepCopy()
+	n.Spec = *WithGeneratedRefs(n)
+	spec := n.Spec.WithDefaults()
+
+	var (
+		objects []runtime.Object
+		notes   []string
+	)
+	for _, s := range NewExternalSecrets(n) {
+		objects = append(objects, s)
+	}
+	if t := spec.ConfigTemplate; t != nil {
+		if t.ConfigMap != "" {
+			notes = append(notes, fmt.Sprintf("the config rendered from config map %q is not rendered, the pods are not annotated with its revision", t.ConfigMap))
+		} else {
+			config, err := RenderConfigTemplate(n, t.Inline)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid config template: %v", err)
+			}
+			n.Status.ConfigTemplateRevision = ConfigTemplateRevision(config)
+			objects = append(objects, NewConfigTemplateConfigMap(n, config))
+		}
+	}
+	if cm := NewInlineConfigMap(n); cm != nil {
+		objects = append(objects, cm)
+	}
+	if cm := NewDefaultServerConfigMap(n); cm != nil {
+		objects = append(objects, cm)
+	}
+	if certificate := NewCertificate(n); certificate != nil {
+		objects = append(objects, certificate)
+	}
+	if account := NewServiceAccount(n); account != nil {
+		objects = append(objects, account)
+	}
+	if role := NewRole(n); role != nil {
+		objects = append(objects, role)
+	}
+	if binding := NewRoleBinding(n); binding != nil {
+		objects = append(objects, binding)
+	}
+
+	switch spec.WorkloadKind {
+	case v1alpha1.WorkloadKindStatefulSet:
+		sts, err := NewStatefulSet(n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to assemble statefulset from nginx: %v", err)
+		}
+		objects = append(objects, sts)
+	case v1alpha1.WorkloadKindDaemonSet:
+		ds, err := NewDaemonSet(n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to assemble daemonset from nginx: %v", err)
+		}
+		objects = append(objects, ds)
+	case v1alpha1.WorkloadKindRollout:
+		rollout, err := NewRollout(n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to assemble rollout from nginx: %v", err)
+		}
+		objects = append(objects, rollout)
+	default:
+		dep, err := NewDeployment(n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to assemble deployment from nginx: %v", err)
+		}
+		objects = append(objects, dep)
+	}
+	if spec.ClampReplicasToQuota {
+		notes = append(notes, "the replicas are not clamped to the resource quotas of the namespace")
+	}
+
+	if pdb := NewPodDisruptionBudget(n); pdb != nil {
+		objects = append(objects, pdb)
+	}
+	if vpa := NewVerticalPodAutoscaler(n); vpa != nil {
+		objects = append(objects, vpa)
+	}
+	services := []*corev1.Service{NewService(n)}
+	if headless := NewHeadlessService(n); headless != nil {
+		services = append(services, headless)
+	}
+	for _, service := range services {
+		if !HasIPFamilies(spec) {
+			objects = append(objects, service)
+			continue
+		}
+		u, err := UnstructuredService(spec, service)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to assemble service from nginx: %v", err)
+		}
+		objects = append(objects, u)
+	}
+	if ingress := NewIngress(n); ingress != nil {
+		objects = append(objects, ingress)
+	}
+	if policy := NewNetworkPolicy(n); policy != nil {
+		objects = append(objects, policy)
+	}
+	for _, template := range NewMetricTemplates(n) {
+		objects = append(objects, template)
+	}
+	if sm := NewServiceMonitor(n); sm != nil {
+		objects = append(objects, sm)
+	}
+	if rule := NewPrometheusRule(n); rule != nil {
+		objects = append(objects, rule)
+	}
+	if spec.Endpoints != nil && spec.Endpoints.ConfigMap {
+		notes = append(notes, fmt.Sprintf("config map %q holds the addresses of the ready pods, it is not rendered", EndpointsConfigMapName(n)))
+	}
+	return objects, notes, nil
+}
@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func renderedKinds(objects []runtime.Object) []string {
+	var kinds []string
+	for _, o := range objects {
+		kinds = append(kinds, o.GetObjectKind().GroupVersionKind().Kind)
+	}
+	return kinds
+}
+
+func TestRender(t *testing.T) {
+	replicas := int32(-1)
+	tests := []struct {
+		name   string
+		change func(*v1alpha1.Nginx)
+		kinds  []string
+		notes  []string
+		err    string
+	}{
+		{
+			name:   "minimal",
+			change: func(n *v1alpha1.Nginx) {},
+			kinds:  []string{"Deployment", "Service"},
+		},
+		{
+			name: "statefulset with ingress",
+			change: func(n *v1alpha1.Nginx) {
+				n.Spec.WorkloadKind = v1alpha1.WorkloadKindStatefulSet
+				n.Spec.Ingress = &v1alpha1.NginxIngress{Hosts: []string{"example.com"}}
+			},
+			kinds: []string{"StatefulSet", "Service", "Ingress"},
+		},
+		{
+			name: "inline config template",
+			change: func(n *v1alpha1.Nginx) {
+				n.Spec.ConfigTemplate = &v1alpha1.NginxConfigTemplate{Inline: "events {}\nhttp { server { listen {{ .HTTPPort }}; } }\n"}
+			},
+			kinds: []string{"ConfigMap", "Deployment", "Service"},
+		},
+		{
+			name: "dual-stack services",
+			change: func(n *v1alpha1.Nginx) {
+				n.Spec.Service = &v1alpha1.NginxServiceSpec{
+					Headless:       true,
+					IPFamilyPolicy: v1alpha1.IPFamilyPolicyRequireDualStack,
+				}
+			},
+			kinds: []string{"ConfigMap", "Deployment", "Service", "Service"},
+		},
+		{
+			name: "cluster dependent objects",
+			change: func(n *v1alpha1.Nginx) {
+				n.Spec.ConfigTemplate = &v1alpha1.NginxConfigTemplate{ConfigMap: "my-template"}
+				n.Spec.ClampReplicasToQuota = true
+				n.Spec.Endpoints = &v1alpha1.NginxEndpoints{ConfigMap: true}
+			},
+			kinds: []string{"Deployment", "Service"},
+			notes: []string{
+				`the config rendered from config map "my-template" is not rendered, the pods are not annotated with its revision`,
+				"the replicas are not clamped to the resource quotas of the namespace",
+				`config map "my-nginx-endpoints" holds the addresses of the ready pods, it is not rendered`,
+			},
+		},
+		{
+			name: "invalid template",
+			change: func(n *v1alpha1.Nginx) {
+				n.Spec.ConfigTemplate = &v1alpha1.NginxConfigTemplate{Inline: "{{ .Values.missing }}"}
+			},
+			err: `invalid config template: template: nginx.conf:1:10: executing "nginx.conf" at <.Values.missing>: map has no entry for key "missing"`,
+		},
+		{
+			name:   "invalid nginx",
+			change: func(n *v1alpha1.Nginx) { n.Spec.Replicas = &replicas },
+			err:    "invalid nginx: spec.replicas must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := baseNginx()
+			tt.change(&n)
+			objects, notes, err := Render(&n)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.kinds, renderedKinds(objects))
+			assert.Equal(t, tt.notes, notes)
+		})
+	}
+}
+
+func TestRenderAnnotatesInlineTemplateRevision(t *testing.T) {
+	n := baseNginx()
+	n.Spec.ConfigTemplate = &v1alpha1.NginxConfigTemplate{Inline: "events {}\n"}
+	objects, _, err := Render(&n)
+	assert.Nil(t, err)
+	dep := objects[1].(*appv1.Deployment)
+	assert.Equal(t, ConfigTemplateRevision("events {}\n"), dep.Spec.Template.Annotations[ConfigTemplateRevisionPodAnnotation])
+	assert.Equal(t, "", n.Status.ConfigTemplateRevision)
+}
@@ -0,0 +1,31 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+)
+
+const (
+	// RestartAnnotation requests a rolling restart of the pods when set on
+	// the nginx to a value different from the one of the last restart, like
+	// a timestamp
+	RestartAnnotation = "nginx.tsuru.io/restart"
+
+	// RestartPodAnnotation is the pod template annotation holding the last
+	// restart request. Changing it replaces the pods.
+	RestartPodAnnotation = "nginx.tsuru.io/restarted-at"
+)
+
+// setupRestart sets the last restart request in the pod template, so pods
+// are only replaced when a new restart is requested
+func setupRestart(n *v1alpha1.Nginx, dep *appv1.Deployment) {
+	request := n.Annotations[RestartAnnotation]
+	if request == "" {
+		return
+	}
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = make(map[string]string)
+	}
+	dep.Spec.Template.Annotations[RestartPodAnnotation] = request
+}
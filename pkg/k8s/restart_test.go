@@ -0,0 +1,36 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetupRestart(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, RestartPodAnnotation)
+
+	nginx.Annotations = map[string]string{RestartAnnotation: "2026-10-01T00:00:00Z"}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-10-01T00:00:00Z", dep.Spec.Template.Annotations[RestartPodAnnotation])
+	assert.True(t, PodRestartRequested(dep.Spec.Template.Annotations, nil))
+	assert.False(t, PodRestartRequested(dep.Spec.Template.Annotations, map[string]string{RestartPodAnnotation: "2026-10-01T00:00:00Z"}))
+}
+
+func TestPodReloadsInPlace(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.False(t, PodReloadsInPlace(&corev1.Pod{Spec: dep.Spec.Template.Spec}))
+
+	nginx.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindConfigMap, Name: "my-config"}
+	nginx.Spec.ConfigReload = v1alpha1.ConfigReloadReload
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.True(t, PodReloadsInPlace(&corev1.Pod{Spec: dep.Spec.Template.Spec}))
+}
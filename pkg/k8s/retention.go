@@ -0,0 +1,68 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CachePurgeHistory returns the number of cache purges kept in the status
+// of the nginx
+func CachePurgeHistory(spec *v1alpha1.NginxSpec) int {
+	if r := spec.Retention; r != nil && r.CachePurgeHistory > 0 {
+		return int(r.CachePurgeHistory)
+	}
+	return int(v1alpha1.DefaultCachePurgeHistory)
+}
+
+// ExpiredEvents returns the events to remove according to the retention:
+// the ones that last happened before the retention period and the oldest
+// ones beyond the maximum number of events. The retention must have its
+// default values already set.
+func ExpiredEvents(events []corev1.Event, retention *v1alpha1.NginxRetention, now time.Time) []corev1.Event {
+	sorted := append([]corev1.Event(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return eventTime(&sorted[i]).After(eventTime(&sorted[j]))
+	})
+	cutoff := now.Add(-time.Duration(retention.EventSeconds) * time.Second)
+	var expired []corev1.Event
+	for i := range sorted {
+		if i >= int(retention.MaxEvents) || eventTime(&sorted[i]).Before(cutoff) {
+			expired = append(expired, sorted[i])
+		}
+	}
+	return expired
+}
+
+// eventTime returns when the event last happened
+func eventTime(e *corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// validateRetention returns the errors found in spec.retention
+func validateRetention(r *v1alpha1.NginxRetention) []string {
+	if r == nil {
+		return nil
+	}
+	var errs []string
+	for _, f := range []struct {
+		field string
+		value int32
+	}{
+		{"eventSeconds", r.EventSeconds},
+		{"maxEvents", r.MaxEvents},
+		{"cachePurgeHistory", r.CachePurgeHistory},
+	} {
+		if f.value < 0 {
+			errs = append(errs, fmt.Sprintf("spec.retention.%s must not be negative", f.field))
+		}
+	}
+	return errs
+}
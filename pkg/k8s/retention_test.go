@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpiredEvents(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	event := func(name string, age time.Duration) corev1.Event {
+		return corev1.Event{
+			ObjectMeta:    metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour))},
+			LastTimestamp: metav1.NewTime(now.Add(-age)),
+		}
+	}
+	events := []corev1.Event{
+		event("old", 2*time.Hour),
+		event("recent", time.Minute),
+		event("older-recent", 10*time.Minute),
+		event("latest", time.Second),
+		{ObjectMeta: metav1.ObjectMeta{Name: "no-last-timestamp", CreationTimestamp: metav1.NewTime(now.Add(-30 * time.Minute))}},
+	}
+	names := func(events []corev1.Event) []string {
+		var n []string
+		for _, e := range events {
+			n = append(n, e.Name)
+		}
+		return n
+	}
+
+	tests := []struct {
+		retention v1alpha1.NginxRetention
+		want      []string
+	}{
+		{retention: v1alpha1.NginxRetention{EventSeconds: 3600, MaxEvents: 50}, want: []string{"old"}},
+		{retention: v1alpha1.NginxRetention{EventSeconds: 3600, MaxEvents: 2}, want: []string{"older-recent", "no-last-timestamp", "old"}},
+		{retention: v1alpha1.NginxRetention{EventSeconds: 120, MaxEvents: 50}, want: []string{"older-recent", "no-last-timestamp", "old"}},
+		{retention: v1alpha1.NginxRetention{EventSeconds: 3600, MaxEvents: 0}, want: []string{"latest", "recent", "older-recent", "no-last-timestamp", "old"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, names(ExpiredEvents(events, &tt.retention, now)), "%+v", tt.retention)
+	}
+	assert.Len(t, events, 5)
+	assert.Equal(t, "old", events[0].Name)
+}
+
+func TestCachePurgeHistory(t *testing.T) {
+	assert.Equal(t, 5, CachePurgeHistory(&v1alpha1.NginxSpec{}))
+	assert.Equal(t, 5, CachePurgeHistory(&v1alpha1.NginxSpec{Retention: &v1alpha1.NginxRetention{}}))
+	assert.Equal(t, 2, CachePurgeHistory(&v1alpha1.NginxSpec{Retention: &v1alpha1.NginxRetention{CachePurgeHistory: 2}}))
+
+	status := &v1alpha1.NginxStatus{}
+	for _, id := range []string{"a", "b", "c"} {
+		RecordCachePurge(status, id, metav1.Now(), 5)
+	}
+	TrimCachePurges(status, 2)
+	if assert.Len(t, status.CachePurges, 2) {
+		assert.Equal(t, "b", status.CachePurges[0].ID)
+		assert.Equal(t, "c", status.CachePurges[1].ID)
+	}
+	TrimCachePurges(status, 5)
+	assert.Len(t, status.CachePurges, 2)
+}
+
+func TestValidateRetention(t *testing.T) {
+	assert.Nil(t, validateRetention(nil))
+	assert.Nil(t, validateRetention(&v1alpha1.NginxRetention{EventSeconds: 60}))
+	assert.Equal(t, []string{
+		"spec.retention.eventSeconds must not be negative",
+		"spec.retention.cachePurgeHistory must not be negative",
+	}, validateRetention(&v1alpha1.NginxRetention{EventSeconds: -1, CachePurgeHistory: -3}))
+}
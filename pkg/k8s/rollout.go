@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// RolloutAPIVersion is the api version of the Argo Rollouts Rollout resource
+	RolloutAPIVersion = "argoproj.io/v1alpha1"
+
+	// RolloutKind is the kind of the Argo Rollouts Rollout resource
+	RolloutKind = "Rollout"
+)
+
+// NewRollout creates an Argo Rollouts Rollout for a given Nginx resource.
+// The pod template is the same one generated for the Deployment, the canary
+// steps are taken from the Nginx rollout spec.
+func NewRollout(n *v1alpha1.Nginx) (*unstructured.Unstructured, error) {
+	deployment, err := NewDeployment(n)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&deployment.Spec)
+	if err != nil {
+		return nil, err
+	}
+	setUnstructuredPodFields(n, spec, "template", "spec")
+	canary := map[string]interface{}{
+		"steps": rolloutSteps(n.Spec.Rollout),
+	}
+	if v := limitMaxUnavailable(&n.Spec, nil, replicasOf(deployment.Spec.Replicas)); v != nil {
+		canary["maxUnavailable"] = int64(v.IntValue())
+	}
+	spec["strategy"] = map[string]interface{}{
+		"canary": canary,
+	}
+
+	rollout := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	rollout.SetAPIVersion(RolloutAPIVersion)
+	rollout.SetKind(RolloutKind)
+	rollout.SetName(deployment.Name)
+	rollout.SetNamespace(deployment.Namespace)
+	rollout.SetOwnerReferences(deployment.OwnerReferences)
+	setCustomMetadata(&n.Spec, rollout)
+	if err := setGeneratedHash(rollout, spec, spec["template"]); err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+func rolloutSteps(rollout *v1alpha1.NginxRollout) []interface{} {
+	steps := []interface{}{}
+	if rollout == nil || rollout.Canary == nil {
+		return steps
+	}
+	for _, s := range rollout.Canary.Steps {
+		if s.Weight != nil {
+			steps = append(steps, map[string]interface{}{
+				"setWeight": int64(*s.Weight),
+			})
+		}
+		if s.Pause != nil {
+			pause := map[string]interface{}{}
+			if *s.Pause > 0 {
+				pause["duration"] = int64(*s.Pause)
+			}
+			steps = append(steps, map[string]interface{}{
+				"pause": pause,
+			})
+		}
+	}
+	return steps
+}
@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewRollout(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	tests := []struct {
+		name      string
+		rollout   *v1alpha1.NginxRollout
+		wantSteps []interface{}
+	}{
+		{
+			name:      "no-rollout-spec",
+			wantSteps: []interface{}{},
+		},
+		{
+			name: "canary-steps",
+			rollout: &v1alpha1.NginxRollout{
+				Canary: &v1alpha1.CanaryStrategy{
+					Steps: []v1alpha1.CanaryStep{
+						{Weight: int32Ptr(20), Pause: int32Ptr(60)},
+						{Weight: int32Ptr(50)},
+						{Pause: int32Ptr(0)},
+					},
+				},
+			},
+			wantSteps: []interface{}{
+				map[string]interface{}{"setWeight": int64(20)},
+				map[string]interface{}{"pause": map[string]interface{}{"duration": int64(60)}},
+				map[string]interface{}{"setWeight": int64(50)},
+				map[string]interface{}{"pause": map[string]interface{}{}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.WorkloadKind = v1alpha1.WorkloadKindRollout
+			nginx.Spec.Rollout = tt.rollout
+			rollout, err := NewRollout(&nginx)
+			assert.Nil(t, err)
+			assert.Equal(t, "argoproj.io/v1alpha1", rollout.GetAPIVersion())
+			assert.Equal(t, "Rollout", rollout.GetKind())
+			assert.Equal(t, "my-nginx-deployment", rollout.GetName())
+			assert.Equal(t, "default", rollout.GetNamespace())
+			assert.Len(t, rollout.GetOwnerReferences(), 1)
+			assert.Contains(t, rollout.GetAnnotations(), SpecHashAnnotation)
+			assert.Contains(t, rollout.GetAnnotations(), TemplateHashAnnotation)
+			steps, _ := unstructured.NestedSlice(rollout.Object, "spec", "strategy", "canary", "steps")
+			assert.Equal(t, tt.wantSteps, steps)
+			containers, _ := unstructured.NestedSlice(rollout.Object, "spec", "template", "spec", "containers")
+			assert.Equal(t, "nginx:latest", containers[0].(map[string]interface{})["image"])
+		})
+	}
+}
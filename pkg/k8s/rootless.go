@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// rootlessWritableDirs are the directories nginx writes to, mounted as
+// emptyDirs in rootless mode since the root filesystem is read-only
+var rootlessWritableDirs = []struct {
+	volume, path string
+}{
+	{volume: "nginx-rootless-cache", path: "/var/cache/nginx"},
+	{volume: "nginx-rootless-run", path: "/var/run"},
+}
+
+// listenPorts returns the ports nginx listens on for http and https
+func listenPorts(spec *v1alpha1.NginxSpec) (http, https int32) {
+	if spec.Rootless {
+		return v1alpha1.DefaultRootlessHTTPPort, v1alpha1.DefaultRootlessHTTPSPort
+	}
+	return 80, 443
+}
+
+// setupRootless runs the pod as a non-root user, with no capabilities or
+// privilege escalation, and nginx with a read-only root filesystem. Security
+// contexts set in the pod template take precedence, so it must run after
+// setupPodTemplate.
+func setupRootless(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if !spec.Rootless {
+		return
+	}
+	podSpec := &dep.Spec.Template.Spec
+	sc := &corev1.PodSecurityContext{}
+	if podSpec.SecurityContext != nil {
+		sc = podSpec.SecurityContext.DeepCopy()
+	}
+	if sc.RunAsNonRoot == nil {
+		sc.RunAsNonRoot = boolPtr(true)
+	}
+	podSpec.SecurityContext = sc
+
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			if containers[i].SecurityContext == nil {
+				containers[i].SecurityContext = &corev1.SecurityContext{
+					AllowPrivilegeEscalation: boolPtr(false),
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				}
+			}
+		}
+	}
+
+	nginx := &podSpec.Containers[0]
+	user := v1alpha1.DefaultRootlessUser
+	if sc.RunAsUser == nil {
+		nginx.SecurityContext.RunAsUser = &user
+	}
+	nginx.SecurityContext.ReadOnlyRootFilesystem = boolPtr(true)
+	mounted := make(map[string]bool)
+	for _, m := range nginx.VolumeMounts {
+		mounted[m.MountPath] = true
+	}
+	for _, dir := range rootlessWritableDirs {
+		if mounted[dir.path] {
+			continue
+		}
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name:         dir.volume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		nginx.VolumeMounts = append(nginx.VolumeMounts, corev1.VolumeMount{
+			Name:      dir.volume,
+			MountPath: dir.path,
+		})
+	}
+}
+
+// validateRootless returns the errors found in the rootless mode settings
+func validateRootless(spec *v1alpha1.NginxSpec) []string {
+	if !spec.Rootless {
+		return nil
+	}
+	var errs []string
+	for i, p := range spec.PodTemplate.Ports {
+		if p.ContainerPort > 0 && p.ContainerPort < 1024 {
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.ports[%d].containerPort %d is privileged, rootless pods can only listen on ports above 1023", i, p.ContainerPort))
+		}
+	}
+	if sc := spec.PodTemplate.SecurityContext; sc != nil {
+		if sc.RunAsNonRoot != nil && !*sc.RunAsNonRoot {
+			errs = append(errs, "spec.podTemplate.securityContext.runAsNonRoot cannot be false with spec.rootless")
+		}
+		if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			errs = append(errs, "spec.podTemplate.securityContext.runAsUser cannot be 0 with spec.rootless")
+		}
+	}
+	return errs
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRootless(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Rootless = true
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "my-secret"}
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	podSpec := &dep.Spec.Template.Spec
+	nginxContainer := podSpec.Containers[0]
+	assert.Equal(t, []corev1.ContainerPort{
+		{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+		{Name: "https", ContainerPort: 8443, Protocol: corev1.ProtocolTCP},
+	}, nginxContainer.Ports)
+	assert.Equal(t, &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true)}, podSpec.SecurityContext)
+	user := int64(101)
+	assert.Equal(t, &corev1.SecurityContext{
+		RunAsUser:                &user,
+		ReadOnlyRootFilesystem:   boolPtr(true),
+		AllowPrivilegeEscalation: boolPtr(false),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}, nginxContainer.SecurityContext)
+	assert.Contains(t, nginxContainer.VolumeMounts, corev1.VolumeMount{Name: "nginx-rootless-cache", MountPath: "/var/cache/nginx"})
+	assert.Contains(t, nginxContainer.VolumeMounts, corev1.VolumeMount{Name: "nginx-rootless-run", MountPath: "/var/run"})
+	assert.Contains(t, defaultServer(&nginx), "listen 8080;\n    listen 8443 ssl;")
+	assert.Empty(t, PodSecurityViolations("restricted", podSpec))
+
+	data := NewConfigTemplateData(&nginx)
+	assert.Equal(t, int32(8080), data.HTTPPort)
+	assert.Equal(t, int32(8443), data.HTTPSPort)
+
+	service := NewService(&nginx)
+	assert.Equal(t, int32(80), service.Spec.Ports[0].Port)
+	assert.Equal(t, "http", service.Spec.Ports[0].TargetPort.String())
+}
+
+func TestRootlessKeepsPodTemplate(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Rootless = true
+	nginx.Spec.Cache = &v1alpha1.NginxCache{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+	user := int64(1000)
+	nginx.Spec.PodTemplate.SecurityContext = &corev1.PodSecurityContext{RunAsUser: &user}
+	nginx.Spec.PodTemplate.Containers = []corev1.Container{
+		{Name: "sidecar", SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(false)}},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	podSpec := &dep.Spec.Template.Spec
+	assert.Equal(t, &corev1.PodSecurityContext{RunAsUser: &user, RunAsNonRoot: boolPtr(true)}, podSpec.SecurityContext)
+	assert.Nil(t, podSpec.Containers[0].SecurityContext.RunAsUser)
+	assert.Equal(t, &corev1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(false)}, podSpec.Containers[1].SecurityContext)
+	var cacheMounts int
+	for _, m := range podSpec.Containers[0].VolumeMounts {
+		if m.MountPath == "/var/cache/nginx" {
+			cacheMounts++
+		}
+	}
+	assert.Equal(t, 1, cacheMounts)
+	assert.Nil(t, nginx.Spec.PodTemplate.SecurityContext.RunAsNonRoot)
+}
+
+func TestValidateRootless(t *testing.T) {
+	root := int64(0)
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "disabled", spec: v1alpha1.NginxSpec{PodTemplate: v1alpha1.NginxPodTemplateSpec{Ports: []v1alpha1.NginxPort{{Name: "dns", ContainerPort: 53}}}}},
+		{name: "valid", spec: v1alpha1.NginxSpec{Rootless: true, PodTemplate: v1alpha1.NginxPodTemplateSpec{Ports: []v1alpha1.NginxPort{{Name: "dns", ContainerPort: 5353}}}}},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{Rootless: true, PodTemplate: v1alpha1.NginxPodTemplateSpec{
+				Ports:           []v1alpha1.NginxPort{{Name: "dns", ContainerPort: 53}},
+				SecurityContext: &corev1.PodSecurityContext{RunAsUser: &root, RunAsNonRoot: boolPtr(false)},
+			}},
+			want: []string{
+				"spec.podTemplate.ports[0].containerPort 53 is privileged, rootless pods can only listen on ports above 1023",
+				"spec.podTemplate.securityContext.runAsNonRoot cannot be false with spec.rootless",
+				"spec.podTemplate.securityContext.runAsUser cannot be 0 with spec.rootless",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateRootless(&tt.spec))
+		})
+	}
+}
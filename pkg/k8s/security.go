@@ -0,0 +1,97 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+)
+
+// Pod annotation holding the server context directives adding the security
+// headers
+const securityConfigAnnotation = "nginx.tsuru.io/security-conf"
+
+type securityHeader struct {
+	name, value string
+}
+
+// securityHeaders are the headers of each profile, except
+// Strict-Transport-Security and Content-Security-Policy
+var securityHeaders = map[v1alpha1.SecurityHeadersProfile][]securityHeader{
+	v1alpha1.SecurityHeadersStrict: {
+		{"X-Content-Type-Options", "nosniff"},
+		{"X-Frame-Options", "DENY"},
+		{"Referrer-Policy", "no-referrer"},
+		{"Cross-Origin-Opener-Policy", "same-origin"},
+		{"X-Permitted-Cross-Domain-Policies", "none"},
+	},
+	v1alpha1.SecurityHeadersModerate: {
+		{"X-Content-Type-Options", "nosniff"},
+		{"X-Frame-Options", "SAMEORIGIN"},
+		{"Referrer-Policy", "strict-origin-when-cross-origin"},
+	},
+}
+
+// setupSecurity renders the security headers into
+// /etc/nginx-operator/security.conf, which must be included in the server
+// contexts. The spec must have its default values already set.
+func setupSecurity(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if conf := renderSecurityHeaders(spec.Security); conf != "" {
+		addOperatorConfig(dep, securityConfigAnnotation, "security.conf", conf)
+	}
+}
+
+// renderSecurityHeaders renders the add_header directives of the security
+// headers. They are added to every response, including errors.
+func renderSecurityHeaders(s *v1alpha1.NginxSecurity) string {
+	if s == nil || s.HeadersProfile == v1alpha1.SecurityHeadersOff {
+		return ""
+	}
+	hsts := "max-age=31536000"
+	if s.HeadersProfile == v1alpha1.SecurityHeadersStrict {
+		hsts = "max-age=63072000; includeSubDomains"
+		if s.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	headers := append([]securityHeader{{"Strict-Transport-Security", hsts}}, securityHeaders[s.HeadersProfile]...)
+	if s.ContentSecurityPolicy != "" {
+		headers = append(headers, securityHeader{"Content-Security-Policy", s.ContentSecurityPolicy})
+	}
+	var buf bytes.Buffer
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "add_header %s %s always;\n", h.name, quote(h.value))
+	}
+	return buf.String()
+}
+
+// validateSecurity returns the errors found in the security headers
+func validateSecurity(s *v1alpha1.NginxSecurity) []string {
+	if s == nil {
+		return nil
+	}
+	var errs []string
+	profile := s.HeadersProfile
+	switch profile {
+	case "":
+		profile = v1alpha1.SecurityHeadersModerate
+	case v1alpha1.SecurityHeadersStrict, v1alpha1.SecurityHeadersModerate, v1alpha1.SecurityHeadersOff:
+	default:
+		errs = append(errs, fmt.Sprintf("spec.security.headersProfile %q is not supported", s.HeadersProfile))
+	}
+	if s.HSTSPreload && profile != v1alpha1.SecurityHeadersStrict {
+		errs = append(errs, "spec.security.hstsPreload requires the strict headers profile")
+	}
+	if s.ContentSecurityPolicy != "" {
+		if profile == v1alpha1.SecurityHeadersOff {
+			errs = append(errs, "spec.security.contentSecurityPolicy cannot be used with the off headers profile")
+		}
+		if strings.ContainsAny(s.ContentSecurityPolicy, "\r\n") {
+			errs = append(errs, "spec.security.contentSecurityPolicy must not contain line breaks")
+		}
+	}
+	return errs
+}
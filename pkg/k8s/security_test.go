@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Security = &v1alpha1.NginxSecurity{}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, `add_header Strict-Transport-Security "max-age=31536000" always;`+"\n"+
+		`add_header X-Content-Type-Options "nosniff" always;`+"\n"+
+		`add_header X-Frame-Options "SAMEORIGIN" always;`+"\n"+
+		`add_header Referrer-Policy "strict-origin-when-cross-origin" always;`+"\n", annotations[securityConfigAnnotation])
+	assert.Contains(t, defaultServer(&nginx), "    include /etc/nginx-operator/security.conf;\n")
+
+	nginx.Spec.Security = &v1alpha1.NginxSecurity{
+		HeadersProfile:        v1alpha1.SecurityHeadersStrict,
+		HSTSPreload:           true,
+		ContentSecurityPolicy: `default-src 'self'; img-src "data:"`,
+	}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, `add_header Strict-Transport-Security "max-age=63072000; includeSubDomains; preload" always;`+"\n"+
+		`add_header X-Content-Type-Options "nosniff" always;`+"\n"+
+		`add_header X-Frame-Options "DENY" always;`+"\n"+
+		`add_header Referrer-Policy "no-referrer" always;`+"\n"+
+		`add_header Cross-Origin-Opener-Policy "same-origin" always;`+"\n"+
+		`add_header X-Permitted-Cross-Domain-Policies "none" always;`+"\n"+
+		`add_header Content-Security-Policy "default-src 'self'; img-src \"data:\"" always;`+"\n",
+		dep.Spec.Template.Annotations[securityConfigAnnotation])
+
+	nginx.Spec.Security = &v1alpha1.NginxSecurity{HeadersProfile: v1alpha1.SecurityHeadersOff}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.NotContains(t, dep.Spec.Template.Annotations, securityConfigAnnotation)
+	assert.NotContains(t, defaultServer(&nginx), "security.conf")
+}
+
+func TestValidateSecurity(t *testing.T) {
+	tests := []struct {
+		name     string
+		security *v1alpha1.NginxSecurity
+		want     []string
+	}{
+		{name: "none"},
+		{name: "defaults", security: &v1alpha1.NginxSecurity{ContentSecurityPolicy: "default-src 'self'"}},
+		{name: "strict", security: &v1alpha1.NginxSecurity{HeadersProfile: v1alpha1.SecurityHeadersStrict, HSTSPreload: true}},
+		{name: "off", security: &v1alpha1.NginxSecurity{HeadersProfile: v1alpha1.SecurityHeadersOff}},
+		{
+			name:     "unsupported profile",
+			security: &v1alpha1.NginxSecurity{HeadersProfile: "paranoid"},
+			want:     []string{`spec.security.headersProfile "paranoid" is not supported`},
+		},
+		{
+			name:     "preload",
+			security: &v1alpha1.NginxSecurity{HSTSPreload: true},
+			want:     []string{"spec.security.hstsPreload requires the strict headers profile"},
+		},
+		{
+			name:     "off with csp",
+			security: &v1alpha1.NginxSecurity{HeadersProfile: v1alpha1.SecurityHeadersOff, ContentSecurityPolicy: "default-src 'self'\nX-Injected: 1"},
+			want: []string{
+				"spec.security.contentSecurityPolicy cannot be used with the off headers profile",
+				"spec.security.contentSecurityPolicy must not contain line breaks",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateSecurity(tt.security))
+		})
+	}
+}
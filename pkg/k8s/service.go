@@ -0,0 +1,145 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxSessionAffinityTimeout is the longest session affinity timeout accepted
+// by Kubernetes
+const maxSessionAffinityTimeout = 86400
+
+// proxyProtocolAnnotations are the service annotations enabling the PROXY
+// protocol on the load balancers of the cloud providers supporting it. Each
+// cloud controller ignores the annotations of the others.
+var proxyProtocolAnnotations = map[string]string{
+	"service.beta.kubernetes.io/aws-load-balancer-proxy-protocol":      "*",
+	"service.beta.kubernetes.io/do-loadbalancer-enable-proxy-protocol": "true",
+	"load-balancer.hetzner.cloud/uses-proxyprotocol":                   "true",
+}
+
+// ProxyProtocolEnabled returns whether the load balancer of the service
+// sends the client address to nginx with the PROXY protocol
+func ProxyProtocolEnabled(spec *v1alpha1.NginxSpec) bool {
+	return spec.Service != nil && spec.Service.ProxyProtocol
+}
+
+// setupServiceOptions applies the type, session affinity and PROXY protocol
+// settings of the spec to the service
+func setupServiceOptions(spec *v1alpha1.NginxSpec, service *corev1.Service) {
+	svc := spec.Service
+	if svc == nil {
+		return
+	}
+	service.Spec.Type = svc.Type
+	if a := svc.SessionAffinity; a != nil {
+		timeout := a.TimeoutSeconds
+		service.Spec.SessionAffinity = corev1.ServiceAffinityClientIP
+		service.Spec.SessionAffinityConfig = &corev1.SessionAffinityConfig{
+			ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: &timeout},
+		}
+	}
+	if svc.ProxyProtocol {
+		if service.Annotations == nil {
+			service.Annotations = make(map[string]string)
+		}
+		for k, v := range proxyProtocolAnnotations {
+			service.Annotations[k] = v
+		}
+	}
+}
+
+// RestoreService sets the fields of the current service managed by the
+// operator to the ones of the desired service. The node ports allocated to
+// the current service are kept while its type uses them.
+func RestoreService(current, desired *corev1.Service) {
+	nodePorts := make(map[string]int32)
+	for _, p := range current.Spec.Ports {
+		nodePorts[p.Name] = p.NodePort
+	}
+	current.Spec.Type = desired.Spec.Type
+	current.Spec.Selector = desired.Spec.Selector
+	current.Spec.Ports = append([]corev1.ServicePort(nil), desired.Spec.Ports...)
+	if desired.Spec.Type == corev1.ServiceTypeNodePort || desired.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		for i := range current.Spec.Ports {
+			current.Spec.Ports[i].NodePort = nodePorts[current.Spec.Ports[i].Name]
+		}
+	}
+	current.Spec.SessionAffinity = desired.Spec.SessionAffinity
+	current.Spec.SessionAffinityConfig = desired.Spec.SessionAffinityConfig
+	for k := range proxyProtocolAnnotations {
+		delete(current.Annotations, k)
+	}
+	for k, v := range desired.Annotations {
+		if _, ok := proxyProtocolAnnotations[k]; ok {
+			if current.Annotations == nil {
+				current.Annotations = make(map[string]string)
+			}
+			current.Annotations[k] = v
+		}
+	}
+	RestoreExternalDNS(current, desired)
+}
+
+// setupProxyProtocol replaces the HTTP readiness probe of the nginx
+// container by a TCP one when its listeners expect the PROXY protocol, which
+// the kubelet does not send. It must run after setupProbes.
+func setupProxyProtocol(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if !ProxyProtocolEnabled(spec) {
+		return
+	}
+	nginx := &dep.Spec.Template.Spec.Containers[0]
+	if probe := nginx.ReadinessProbe; probe != nil && probe.HTTPGet != nil {
+		probe.TCPSocket = &corev1.TCPSocketAction{Port: probe.HTTPGet.Port}
+		probe.HTTPGet = nil
+	}
+}
+
+// proxyProtocolListen returns the parameter added to the listen directives
+// of the default server
+func proxyProtocolListen(spec *v1alpha1.NginxSpec) string {
+	if ProxyProtocolEnabled(spec) {
+		return " proxy_protocol"
+	}
+	return ""
+}
+
+// validateService returns the errors found in the service settings of the
+// spec
+func validateService(spec *v1alpha1.NginxSpec) []string {
+	svc := spec.Service
+	if svc == nil {
+		return nil
+	}
+	var errs []string
+	switch svc.Type {
+	case "", corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+	default:
+		errs = append(errs, fmt.Sprintf("spec.service.type %q is not supported", svc.Type))
+	}
+	if a := svc.SessionAffinity; a != nil && (a.TimeoutSeconds < 0 || a.TimeoutSeconds > maxSessionAffinityTimeout) {
+		errs = append(errs, fmt.Sprintf("spec.service.sessionAffinity.timeoutSeconds must be between 1 and %d", maxSessionAffinityTimeout))
+	}
+	if svc.LoadBalancerTimeoutSeconds < 0 {
+		errs = append(errs, "spec.service.loadBalancerTimeoutSeconds must not be negative")
+	} else if svc.LoadBalancerTimeoutSeconds > 0 && svc.Type != corev1.ServiceTypeLoadBalancer {
+		errs = append(errs, "spec.service.loadBalancerTimeoutSeconds requires spec.service.type LoadBalancer")
+	}
+	if !svc.ProxyProtocol {
+		return errs
+	}
+	if svc.Type != corev1.ServiceTypeLoadBalancer {
+		errs = append(errs, "spec.service.proxyProtocol requires spec.service.type LoadBalancer")
+	}
+	if hc := spec.Healthcheck; hc != nil && (hc.Readiness != nil || hc.Liveness != nil) {
+		errs = append(errs, "spec.healthcheck cannot be used with spec.service.proxyProtocol, the kubelet does not send the PROXY protocol")
+	}
+	if r := spec.Rollout; r != nil && r.CanaryCheck != nil {
+		errs = append(errs, "spec.rollout.canaryCheck cannot be used with spec.service.proxyProtocol, its requests do not send the PROXY protocol")
+	}
+	return errs
+}
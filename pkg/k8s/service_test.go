@@ -0,0 +1,151 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNewServiceOptions(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{
+		Headless:        true,
+		Type:            corev1.ServiceTypeLoadBalancer,
+		SessionAffinity: &v1alpha1.NginxSessionAffinity{},
+		ProxyProtocol:   true,
+	}
+
+	service := NewService(&nginx)
+	assert.Equal(t, corev1.ServiceTypeLoadBalancer, service.Spec.Type)
+	assert.Equal(t, corev1.ServiceAffinityClientIP, service.Spec.SessionAffinity)
+	assert.Equal(t, v1alpha1.DefaultSessionAffinityTimeout, *service.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds)
+	assert.Equal(t, "*", service.Annotations["service.beta.kubernetes.io/aws-load-balancer-proxy-protocol"])
+
+	headless := NewHeadlessService(&nginx)
+	assert.Equal(t, corev1.ServiceTypeClusterIP, headless.Spec.Type)
+	assert.Equal(t, corev1.ServiceAffinity(""), headless.Spec.SessionAffinity)
+	assert.Nil(t, headless.Spec.SessionAffinityConfig)
+	assert.Empty(t, headless.Annotations)
+
+	nginx.Spec.Service = nil
+	service = NewService(&nginx)
+	assert.Equal(t, corev1.ServiceTypeClusterIP, service.Spec.Type)
+	assert.Nil(t, service.Spec.SessionAffinityConfig)
+	assert.Empty(t, service.Annotations)
+}
+
+func TestServiceOptionsDrift(t *testing.T) {
+	nginx := baseNginx()
+	desired := NewService(&nginx)
+	current := desired.DeepCopy()
+	current.Spec.SessionAffinity = corev1.ServiceAffinityNone
+	current.Annotations = map[string]string{"other": "annotation"}
+	assert.Empty(t, ServiceDrift(desired, current))
+
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{
+		Type:            corev1.ServiceTypeLoadBalancer,
+		SessionAffinity: &v1alpha1.NginxSessionAffinity{TimeoutSeconds: 60},
+		ProxyProtocol:   true,
+	}
+	desired = NewService(&nginx)
+	assert.Equal(t, []string{"type", "sessionAffinity", "annotations"}, ServiceDrift(desired, current))
+}
+
+func TestRestoreService(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ProxyProtocol: true}
+	desired := NewService(&nginx)
+	current := desired.DeepCopy()
+	current.Spec.Ports[0].NodePort = 30080
+	current.Spec.Ports[0].Port = 8080
+	current.Annotations = map[string]string{"other": "annotation"}
+
+	RestoreService(current, desired)
+	assert.Empty(t, ServiceDrift(desired, current))
+	assert.Equal(t, int32(30080), current.Spec.Ports[0].NodePort)
+	assert.Equal(t, int32(0), desired.Spec.Ports[0].NodePort)
+	assert.Equal(t, "annotation", current.Annotations["other"])
+
+	nginx.Spec.Service = nil
+	desired = NewService(&nginx)
+	RestoreService(current, desired)
+	assert.Empty(t, ServiceDrift(desired, current))
+	assert.Equal(t, int32(0), current.Spec.Ports[0].NodePort)
+	assert.Equal(t, map[string]string{"other": "annotation"}, current.Annotations)
+}
+
+func TestProxyProtocolDeployment(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "my-secret"}
+	nginx.Spec.Service = &v1alpha1.NginxServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ProxyProtocol: true}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	probe := dep.Spec.Template.Spec.Containers[0].ReadinessProbe
+	assert.Nil(t, probe.HTTPGet)
+	assert.Equal(t, &corev1.TCPSocketAction{Port: intstr.FromString(defaultHTTPSPortName)}, probe.TCPSocket)
+	server := defaultServer(&nginx)
+	assert.Contains(t, server, "listen 80 proxy_protocol;\n    listen 443 ssl proxy_protocol;")
+	assert.Contains(t, server, "real_ip_header proxy_protocol;")
+}
+
+func TestValidateService(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "no-service"},
+		{
+			name: "valid",
+			spec: v1alpha1.NginxSpec{Service: &v1alpha1.NginxServiceSpec{
+				Type:                       corev1.ServiceTypeLoadBalancer,
+				SessionAffinity:            &v1alpha1.NginxSessionAffinity{TimeoutSeconds: 600},
+				ProxyProtocol:              true,
+				LoadBalancerTimeoutSeconds: 300,
+			}},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{Service: &v1alpha1.NginxServiceSpec{
+				Type:            corev1.ServiceTypeExternalName,
+				SessionAffinity: &v1alpha1.NginxSessionAffinity{TimeoutSeconds: 90000},
+			}},
+			want: []string{
+				`spec.service.type "ExternalName" is not supported`,
+				"spec.service.sessionAffinity.timeoutSeconds must be between 1 and 86400",
+			},
+		},
+		{
+			name: "load-balancer-timeout",
+			spec: v1alpha1.NginxSpec{Service: &v1alpha1.NginxServiceSpec{LoadBalancerTimeoutSeconds: 300}},
+			want: []string{"spec.service.loadBalancerTimeoutSeconds requires spec.service.type LoadBalancer"},
+		},
+		{
+			name: "negative-load-balancer-timeout",
+			spec: v1alpha1.NginxSpec{Service: &v1alpha1.NginxServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerTimeoutSeconds: -1}},
+			want: []string{"spec.service.loadBalancerTimeoutSeconds must not be negative"},
+		},
+		{
+			name: "proxy-protocol",
+			spec: v1alpha1.NginxSpec{
+				Service:     &v1alpha1.NginxServiceSpec{ProxyProtocol: true},
+				Healthcheck: &v1alpha1.NginxHealthcheck{Readiness: &v1alpha1.NginxProbe{Path: "/healthz"}},
+				Rollout:     &v1alpha1.NginxRollout{CanaryCheck: &v1alpha1.CanaryCheck{}},
+			},
+			want: []string{
+				"spec.service.proxyProtocol requires spec.service.type LoadBalancer",
+				"spec.healthcheck cannot be used with spec.service.proxyProtocol, the kubelet does not send the PROXY protocol",
+				"spec.rollout.canaryCheck cannot be used with spec.service.proxyProtocol, its requests do not send the PROXY protocol",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateService(&tt.spec))
+		})
+	}
+}
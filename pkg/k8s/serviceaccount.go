@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// serviceAccountVerbs are the verbs that can be granted to the service
+// accounts created for the nginx instances
+var serviceAccountVerbs = map[string]bool{"get": true, "list": true, "watch": true}
+
+// setupServiceAccount runs the pods under the service account of
+// spec.serviceAccount, mounting its token when it was granted permissions.
+// It must run after setupPodTemplate.
+func setupServiceAccount(n *v1alpha1.Nginx, dep *appv1.Deployment) {
+	sa := n.Spec.ServiceAccount
+	if sa == nil {
+		return
+	}
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.ServiceAccountName = sa.Name
+	if sa.Create {
+		podSpec.ServiceAccountName = n.Name
+	}
+	if len(sa.Rules) > 0 && n.Spec.PodTemplate.AutomountServiceAccountToken == nil {
+		podSpec.AutomountServiceAccountToken = boolPtr(true)
+	}
+}
+
+// NewServiceAccount assembles the ServiceAccount created for the Nginx. It
+// returns nil if none was requested.
+func NewServiceAccount(n *v1alpha1.Nginx) *corev1.ServiceAccount {
+	sa := n.Spec.ServiceAccount
+	if sa == nil || !sa.Create {
+		return nil
+	}
+	account := &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: rbacObjectMeta(n),
+	}
+	setCustomMetadata(&n.Spec, account)
+	account.Annotations = mergeMetadata(account.Annotations, sa.Annotations)
+	return account
+}
+
+// NewRole assembles the Role granting the rules of the service account
+// created for the Nginx. It returns nil if no rules were requested.
+func NewRole(n *v1alpha1.Nginx) *rbacv1.Role {
+	sa := n.Spec.ServiceAccount
+	if sa == nil || !sa.Create || len(sa.Rules) == 0 {
+		return nil
+	}
+	role := &rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Role",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: rbacObjectMeta(n),
+	}
+	for _, r := range sa.Rules {
+		role.Rules = append(role.Rules, *r.DeepCopy())
+	}
+	setCustomMetadata(&n.Spec, role)
+	return role
+}
+
+// NewRoleBinding assembles the RoleBinding of the Role of the Nginx to its
+// service account. It returns nil if no rules were requested.
+func NewRoleBinding(n *v1alpha1.Nginx) *rbacv1.RoleBinding {
+	if NewRole(n) == nil {
+		return nil
+	}
+	binding := &rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "RoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: rbacObjectMeta(n),
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: n.Name, Namespace: n.Namespace},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     n.Name,
+		},
+	}
+	setCustomMetadata(&n.Spec, binding)
+	return binding
+}
+
+// RoleDrift returns the fields managed by the operator that differ between
+// the desired and the current role.
+func RoleDrift(desired, current *rbacv1.Role) []string {
+	if reflect.DeepEqual(desired.Rules, current.Rules) {
+		return nil
+	}
+	return []string{"rules"}
+}
+
+// RoleBindingDrift returns the fields managed by the operator that differ
+// between the desired and the current role binding. Its role is not
+// compared, since it cannot be changed and is always named after the nginx.
+func RoleBindingDrift(desired, current *rbacv1.RoleBinding) []string {
+	if reflect.DeepEqual(desired.Subjects, current.Subjects) {
+		return nil
+	}
+	return []string{"subjects"}
+}
+
+func rbacObjectMeta(n *v1alpha1.Nginx) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      n.Name,
+		Namespace: n.Namespace,
+		Labels:    LabelsForNginx(n.Name),
+		OwnerReferences: []metav1.OwnerReference{
+			*metav1.NewControllerRef(n, schema.GroupVersionKind{
+				Group:   v1alpha1.SchemeGroupVersion.Group,
+				Version: v1alpha1.SchemeGroupVersion.Version,
+				Kind:    "Nginx",
+			}),
+		},
+	}
+}
+
+// validateServiceAccount returns the errors found in the service account of
+// the spec
+func validateServiceAccount(spec *v1alpha1.NginxSpec) []string {
+	sa := spec.ServiceAccount
+	if sa == nil {
+		return nil
+	}
+	var errs []string
+	if (sa.Name == "") == !sa.Create {
+		errs = append(errs, "spec.serviceAccount must set exactly one of name or create")
+	}
+	if spec.PodTemplate.ServiceAccountName != "" {
+		errs = append(errs, "spec.serviceAccount cannot be used with spec.podTemplate.serviceAccountName")
+	}
+	if !sa.Create {
+		if len(sa.Annotations) > 0 {
+			errs = append(errs, "spec.serviceAccount.annotations requires create")
+		}
+		if len(sa.Rules) > 0 {
+			errs = append(errs, "spec.serviceAccount.rules requires create")
+		}
+	}
+	for i, r := range sa.Rules {
+		field := fmt.Sprintf("spec.serviceAccount.rules[%d]", i)
+		if len(r.Resources) == 0 {
+			errs = append(errs, fmt.Sprintf("%s.resources is required", field))
+		}
+		if len(r.NonResourceURLs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s.nonResourceURLs cannot be granted in a namespace", field))
+		}
+		if len(r.Verbs) == 0 {
+			errs = append(errs, fmt.Sprintf("%s.verbs is required", field))
+		}
+		for _, v := range r.Verbs {
+			if !serviceAccountVerbs[v] {
+				errs = append(errs, fmt.Sprintf("%s.verbs %q is not supported, only get, list and watch can be granted", field, v))
+			}
+		}
+	}
+	return errs
+}
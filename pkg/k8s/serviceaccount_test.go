@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestServiceAccount(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewServiceAccount(&nginx))
+	assert.Nil(t, NewRole(&nginx))
+	assert.Nil(t, NewRoleBinding(&nginx))
+
+	nginx.Spec.ServiceAccount = &v1alpha1.NginxServiceAccount{Name: "shared"}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "shared", dep.Spec.Template.Spec.ServiceAccountName)
+	assert.Equal(t, boolPtr(false), dep.Spec.Template.Spec.AutomountServiceAccountToken)
+	assert.Nil(t, NewServiceAccount(&nginx))
+
+	rules := []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "watch"}}}
+	nginx.Spec.ServiceAccount = &v1alpha1.NginxServiceAccount{
+		Create:      true,
+		Annotations: map[string]string{"iam.gke.io/gcp-service-account": "nginx@project.iam.gserviceaccount.com"},
+		Rules:       rules,
+	}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-nginx", dep.Spec.Template.Spec.ServiceAccountName)
+	assert.Equal(t, boolPtr(true), dep.Spec.Template.Spec.AutomountServiceAccountToken)
+
+	account := NewServiceAccount(&nginx)
+	assert.Equal(t, "my-nginx", account.Name)
+	assert.Equal(t, "default", account.Namespace)
+	assert.Equal(t, "nginx@project.iam.gserviceaccount.com", account.Annotations["iam.gke.io/gcp-service-account"])
+	assert.Equal(t, "Nginx", account.OwnerReferences[0].Kind)
+
+	role := NewRole(&nginx)
+	assert.Equal(t, rules, role.Rules)
+	binding := NewRoleBinding(&nginx)
+	assert.Equal(t, []rbacv1.Subject{{Kind: "ServiceAccount", Name: "my-nginx", Namespace: "default"}}, binding.Subjects)
+	assert.Equal(t, rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "my-nginx"}, binding.RoleRef)
+
+	current := role.DeepCopy()
+	assert.Nil(t, RoleDrift(role, current))
+	current.Rules[0].Verbs = []string{"get"}
+	assert.Equal(t, []string{"rules"}, RoleDrift(role, current))
+
+	nginx.Spec.PodTemplate.AutomountServiceAccountToken = boolPtr(false)
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, boolPtr(false), dep.Spec.Template.Spec.AutomountServiceAccountToken)
+}
+
+func TestValidateServiceAccount(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "unset"},
+		{
+			name: "existing",
+			spec: v1alpha1.NginxSpec{ServiceAccount: &v1alpha1.NginxServiceAccount{Name: "shared"}},
+		},
+		{
+			name: "created",
+			spec: v1alpha1.NginxSpec{ServiceAccount: &v1alpha1.NginxServiceAccount{
+				Create: true,
+				Rules:  []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"tls"}, Verbs: []string{"get"}}},
+			}},
+		},
+		{
+			name: "name and create",
+			spec: v1alpha1.NginxSpec{ServiceAccount: &v1alpha1.NginxServiceAccount{Name: "shared", Create: true}},
+			want: []string{"spec.serviceAccount must set exactly one of name or create"},
+		},
+		{
+			name: "neither",
+			spec: v1alpha1.NginxSpec{ServiceAccount: &v1alpha1.NginxServiceAccount{}},
+			want: []string{"spec.serviceAccount must set exactly one of name or create"},
+		},
+		{
+			name: "pod template service account",
+			spec: v1alpha1.NginxSpec{
+				ServiceAccount: &v1alpha1.NginxServiceAccount{Create: true},
+				PodTemplate:    v1alpha1.NginxPodTemplateSpec{ServiceAccountName: "other"},
+			},
+			want: []string{"spec.serviceAccount cannot be used with spec.podTemplate.serviceAccountName"},
+		},
+		{
+			name: "existing with annotations and rules",
+			spec: v1alpha1.NginxSpec{ServiceAccount: &v1alpha1.NginxServiceAccount{
+				Name:        "shared",
+				Annotations: map[string]string{"a": "b"},
+				Rules:       []rbacv1.PolicyRule{{Resources: []string{"pods"}, Verbs: []string{"list"}}},
+			}},
+			want: []string{
+				"spec.serviceAccount.annotations requires create",
+				"spec.serviceAccount.rules requires create",
+			},
+		},
+		{
+			name: "invalid rules",
+			spec: v1alpha1.NginxSpec{ServiceAccount: &v1alpha1.NginxServiceAccount{
+				Create: true,
+				Rules: []rbacv1.PolicyRule{
+					{NonResourceURLs: []string{"/metrics"}},
+					{Resources: []string{"secrets"}, Verbs: []string{"get", "update", "*"}},
+				},
+			}},
+			want: []string{
+				"spec.serviceAccount.rules[0].resources is required",
+				"spec.serviceAccount.rules[0].nonResourceURLs cannot be granted in a namespace",
+				"spec.serviceAccount.rules[0].verbs is required",
+				`spec.serviceAccount.rules[1].verbs "update" is not supported, only get, list and watch can be granted`,
+				`spec.serviceAccount.rules[1].verbs "*" is not supported, only get, list and watch can be granted`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateServiceAccount(&tt.spec))
+		})
+	}
+}
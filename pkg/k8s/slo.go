@@ -0,0 +1,206 @@
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// PrometheusRuleAPIVersion is the api version of the Prometheus Operator PrometheusRule resource
+	PrometheusRuleAPIVersion = "monitoring.coreos.com/v1"
+
+	// PrometheusRuleKind is the kind of the Prometheus Operator PrometheusRule resource
+	PrometheusRuleKind = "PrometheusRule"
+
+	// Metrics of the upstream metrics sidecar the objectives are measured
+	// from, prefixed by the name of its namespace
+	sloRequestsMetric = "nginx_http_response_count_total"
+	sloLatencyMetric  = "nginx_http_response_time_seconds_hist"
+
+	// Recording rules of the ratios of failed and slow requests, suffixed
+	// by the window they are computed over
+	sloErrorsRecord = "nginx:slo_errors:ratio_rate"
+	sloSlowRecord   = "nginx:slo_slow_requests:ratio_rate"
+)
+
+// sloWindows are the windows the ratios are recorded over, the ones used by
+// the burn rate alerts
+var sloWindows = []string{"5m", "30m", "1h", "2h", "6h", "1d", "3d"}
+
+// sloBurnRate is a pair of multi-window burn rate conditions alerting with
+// the same severity
+type sloBurnRate struct {
+	severity   string
+	duration   string
+	conditions []sloBurnCondition
+}
+
+// sloBurnCondition fires when both its long and short windows burn the
+// error budget of 30 days faster than the factor
+type sloBurnCondition struct {
+	long, short string
+	factor      string
+}
+
+// sloBurnRates are the burn rate alerts recommended by the Google SRE
+// workbook: a page when 2% of the budget is spent in an hour or 5% in six
+// hours, and a ticket when 10% is spent in three days or 10% in a day.
+var sloBurnRates = []sloBurnRate{
+	{severity: "critical", duration: "2m", conditions: []sloBurnCondition{{"1h", "5m", "14.4"}, {"6h", "30m", "6"}}},
+	{severity: "warning", duration: "15m", conditions: []sloBurnCondition{{"1d", "2h", "3"}, {"3d", "6h", "1"}}},
+}
+
+// NewPrometheusRule assembles the Prometheus Operator PrometheusRule
+// recording the ratios of failed and slow requests of the Nginx and alerting
+// on their burn rates. It returns nil if no SLO was requested.
+func NewPrometheusRule(n *v1alpha1.Nginx) *unstructured.Unstructured {
+	spec := n.Spec.WithDefaults()
+	slo := spec.SLO
+	if slo == nil {
+		return nil
+	}
+	selector := fmt.Sprintf(`namespace=%q,service=%q`, n.Namespace, n.Name+"-service")
+	var rules []interface{}
+	for _, w := range sloWindows {
+		rules = append(rules, map[string]interface{}{
+			"record": sloErrorsRecord + w,
+			"expr": fmt.Sprintf(`sum by (namespace, service) (rate(%s{%s,status_class="5xx"}[%s])) / sum by (namespace, service) (rate(%s{%s}[%s]))`,
+				sloRequestsMetric, selector, w, sloRequestsMetric, selector, w),
+		})
+	}
+	rules = append(rules, sloAlerts(n, slo, "availability", sloErrorsRecord, slo.Availability, selector)...)
+	if l := slo.Latency; l != nil {
+		for _, w := range sloWindows {
+			rules = append(rules, map[string]interface{}{
+				"record": sloSlowRecord + w,
+				"expr": fmt.Sprintf(`1 - sum by (namespace, service) (rate(%s_bucket{%s,le=%q}[%s])) / sum by (namespace, service) (rate(%s_count{%s}[%s]))`,
+					sloLatencyMetric, selector, sloNumber(l.Threshold), w, sloLatencyMetric, selector, w),
+			})
+		}
+		rules = append(rules, sloAlerts(n, slo, "latency", sloSlowRecord, l.Target, selector)...)
+	}
+
+	o := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"groups": []interface{}{
+				map[string]interface{}{
+					"name":  "nginx-slo",
+					"rules": rules,
+				},
+			},
+		},
+	}}
+	labels := LabelsForNginx(n.Name)
+	for k, v := range slo.Labels {
+		labels[k] = v
+	}
+	o.SetAPIVersion(PrometheusRuleAPIVersion)
+	o.SetKind(PrometheusRuleKind)
+	o.SetName(n.Name)
+	o.SetNamespace(n.Namespace)
+	o.SetLabels(labels)
+	o.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(n, schema.GroupVersionKind{
+			Group:   v1alpha1.SchemeGroupVersion.Group,
+			Version: v1alpha1.SchemeGroupVersion.Version,
+			Kind:    "Nginx",
+		}),
+	})
+	setCustomMetadata(&n.Spec, o)
+	return o
+}
+
+// sloAlerts returns the burn rate alerts of the objective whose ratio of bad
+// requests is recorded by record, with the target percentage of good ones
+func sloAlerts(n *v1alpha1.Nginx, slo *v1alpha1.NginxSLO, objective, record, target, selector string) []interface{} {
+	var alerts []interface{}
+	for _, b := range sloBurnRates {
+		var exprs []string
+		for _, c := range b.conditions {
+			threshold := fmt.Sprintf("(%s * (100 - %s) / 100)", c.factor, sloNumber(target))
+			exprs = append(exprs, fmt.Sprintf("(%s%s{%s} > %s and %s%s{%s} > %s)",
+				record, c.long, selector, threshold, record, c.short, selector, threshold))
+		}
+		labels := make(map[string]interface{})
+		for k, v := range slo.AlertLabels {
+			labels[k] = v
+		}
+		labels["severity"] = b.severity
+		labels["nginx"] = n.Name
+		alerts = append(alerts, map[string]interface{}{
+			"alert":  "Nginx" + strings.Title(objective) + "BudgetBurn",
+			"expr":   strings.Join(exprs, " or "),
+			"for":    b.duration,
+			"labels": labels,
+			"annotations": map[string]interface{}{
+				"summary": fmt.Sprintf("Nginx %s/%s is burning its %s error budget too fast", n.Namespace, n.Name, objective),
+				"description": fmt.Sprintf("The %s objective of %s%% of the requests of nginx %s/%s will not be met in 30 days at the current rate.",
+					objective, sloNumber(target), n.Namespace, n.Name),
+			},
+		})
+	}
+	return alerts
+}
+
+// sloNumber formats a validated number of the SLO in decimal notation, the
+// way the Prometheus client formats the le label of the histogram buckets
+func sloNumber(v string) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// validateSLO returns the errors found in the SLO of the spec
+func validateSLO(spec *v1alpha1.NginxSpec) []string {
+	slo := spec.SLO
+	if slo == nil {
+		return nil
+	}
+	var errs []string
+	if !upstreamMetricsEnabled(spec) {
+		errs = append(errs, "spec.slo requires spec.metrics.upstreams")
+	}
+	if slo.Availability != "" && !isSLOTarget(slo.Availability) {
+		errs = append(errs, fmt.Sprintf("spec.slo.availability %q must be a percentage greater than 0 and lower than 100", slo.Availability))
+	}
+	if l := slo.Latency; l != nil {
+		if l.Target != "" && !isSLOTarget(l.Target) {
+			errs = append(errs, fmt.Sprintf("spec.slo.latency.target %q must be a percentage greater than 0 and lower than 100", l.Target))
+		}
+		if l.Threshold == "" {
+			errs = append(errs, "spec.slo.latency.threshold is required")
+		} else if upstreamMetricsEnabled(spec) && !isSLOBucket(spec.WithDefaults().Metrics.Upstreams.Buckets, l.Threshold) {
+			errs = append(errs, fmt.Sprintf("spec.slo.latency.threshold %q must be one of the buckets of spec.metrics.upstreams", l.Threshold))
+		}
+	}
+	return errs
+}
+
+// isSLOTarget returns whether v is a percentage an objective can be set to
+func isSLOTarget(v string) bool {
+	f, err := strconv.ParseFloat(v, 64)
+	return err == nil && f > 0 && f < 100
+}
+
+// isSLOBucket returns whether threshold is one of the histogram buckets
+func isSLOBucket(buckets []string, threshold string) bool {
+	t, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return false
+	}
+	for _, b := range buckets {
+		if v, err := strconv.ParseFloat(b, 64); err == nil && v == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPrometheusRule(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewPrometheusRule(&nginx))
+
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{Upstreams: &v1alpha1.NginxUpstreamMetrics{}}
+	nginx.Spec.SLO = &v1alpha1.NginxSLO{
+		Labels:      map[string]string{"prometheus": "main"},
+		AlertLabels: map[string]string{"team": "edge"},
+	}
+	rule := NewPrometheusRule(&nginx)
+	assert.Equal(t, "PrometheusRule", rule.GetKind())
+	assert.Equal(t, "my-nginx", rule.GetName())
+	assert.Equal(t, "main", rule.GetLabels()["prometheus"])
+	assert.Equal(t, "Nginx", rule.GetOwnerReferences()[0].Kind)
+
+	groups, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	rules := groups[0].(map[string]interface{})["rules"].([]interface{})
+	assert.Len(t, rules, 9)
+	assert.Equal(t, map[string]interface{}{
+		"record": "nginx:slo_errors:ratio_rate5m",
+		"expr": `sum by (namespace, service) (rate(nginx_http_response_count_total{namespace="default",service="my-nginx-service",status_class="5xx"}[5m])) / ` +
+			`sum by (namespace, service) (rate(nginx_http_response_count_total{namespace="default",service="my-nginx-service"}[5m]))`,
+	}, rules[0])
+	page := rules[7].(map[string]interface{})
+	assert.Equal(t, "NginxAvailabilityBudgetBurn", page["alert"])
+	assert.Equal(t, `(nginx:slo_errors:ratio_rate1h{namespace="default",service="my-nginx-service"} > (14.4 * (100 - 99.9) / 100) and `+
+		`nginx:slo_errors:ratio_rate5m{namespace="default",service="my-nginx-service"} > (14.4 * (100 - 99.9) / 100)) or `+
+		`(nginx:slo_errors:ratio_rate6h{namespace="default",service="my-nginx-service"} > (6 * (100 - 99.9) / 100) and `+
+		`nginx:slo_errors:ratio_rate30m{namespace="default",service="my-nginx-service"} > (6 * (100 - 99.9) / 100))`, page["expr"])
+	assert.Equal(t, map[string]interface{}{"severity": "critical", "nginx": "my-nginx", "team": "edge"}, page["labels"])
+	assert.Equal(t, "warning", rules[8].(map[string]interface{})["labels"].(map[string]interface{})["severity"])
+
+	nginx.Spec.SLO.Latency = &v1alpha1.NginxSLOLatency{Threshold: "0.250"}
+	groups, _ = unstructured.NestedSlice(NewPrometheusRule(&nginx).Object, "spec", "groups")
+	rules = groups[0].(map[string]interface{})["rules"].([]interface{})
+	assert.Len(t, rules, 18)
+	assert.Equal(t, `1 - sum by (namespace, service) (rate(nginx_http_response_time_seconds_hist_bucket{namespace="default",service="my-nginx-service",le="0.25"}[5m])) / `+
+		`sum by (namespace, service) (rate(nginx_http_response_time_seconds_hist_count{namespace="default",service="my-nginx-service"}[5m]))`,
+		rules[9].(map[string]interface{})["expr"])
+	latency := rules[16].(map[string]interface{})
+	assert.Equal(t, "NginxLatencyBudgetBurn", latency["alert"])
+	assert.Contains(t, latency["expr"], "nginx:slo_slow_requests:ratio_rate1h{namespace=\"default\",service=\"my-nginx-service\"} > (14.4 * (100 - 99) / 100)")
+}
+
+func TestValidateSLO(t *testing.T) {
+	upstreams := &v1alpha1.NginxMetrics{Upstreams: &v1alpha1.NginxUpstreamMetrics{}}
+	tests := []struct {
+		name    string
+		metrics *v1alpha1.NginxMetrics
+		slo     *v1alpha1.NginxSLO
+		want    []string
+	}{
+		{name: "unset"},
+		{name: "defaults", metrics: upstreams, slo: &v1alpha1.NginxSLO{}},
+		{
+			name:    "latency",
+			metrics: upstreams,
+			slo:     &v1alpha1.NginxSLO{Availability: "99.95", Latency: &v1alpha1.NginxSLOLatency{Threshold: "0.5", Target: "95"}},
+		},
+		{
+			name: "without upstream metrics",
+			slo:  &v1alpha1.NginxSLO{Latency: &v1alpha1.NginxSLOLatency{Threshold: "0.3"}},
+			want: []string{"spec.slo requires spec.metrics.upstreams"},
+		},
+		{
+			name:    "invalid",
+			metrics: upstreams,
+			slo:     &v1alpha1.NginxSLO{Availability: "100", Latency: &v1alpha1.NginxSLOLatency{Target: "NaN"}},
+			want: []string{
+				`spec.slo.availability "100" must be a percentage greater than 0 and lower than 100`,
+				`spec.slo.latency.target "NaN" must be a percentage greater than 0 and lower than 100`,
+				"spec.slo.latency.threshold is required",
+			},
+		},
+		{
+			name:    "threshold not a bucket",
+			metrics: &v1alpha1.NginxMetrics{Upstreams: &v1alpha1.NginxUpstreamMetrics{Buckets: []string{"0.1", "1"}}},
+			slo:     &v1alpha1.NginxSLO{Latency: &v1alpha1.NginxSLOLatency{Threshold: "0.5"}},
+			want:    []string{`spec.slo.latency.threshold "0.5" must be one of the buckets of spec.metrics.upstreams`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &v1alpha1.NginxSpec{Metrics: tt.metrics, SLO: tt.slo}
+			assert.Equal(t, tt.want, validateSLO(spec))
+		})
+	}
+}
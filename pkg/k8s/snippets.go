@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+// renderSnippet writes the lines of the snippet with the given indentation,
+// leaving out blank lines
+func renderSnippet(buf *bytes.Buffer, snippet, indent string) {
+	for _, line := range strings.Split(snippet, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(buf, "%s%s\n", indent, line)
+		}
+	}
+}
+
+// validateSnippets returns the errors found in the snippets. Snippets must
+// keep their braces balanced, so they cannot close the block they are
+// added to.
+func validateSnippets(spec *v1alpha1.NginxSpec) []string {
+	s := spec.Snippets
+	if s == nil {
+		return nil
+	}
+	var errs []string
+	if spec.Config != nil || spec.ConfigTemplate != nil {
+		errs = append(errs, "spec.snippets cannot be used with spec.configRef or spec.configTemplate, custom configs must set the directives themselves")
+	}
+	for _, snippet := range []struct {
+		field, value string
+	}{
+		{"http", s.HTTP},
+		{"server", s.Server},
+		{"location", s.Location},
+	} {
+		if !balancedBraces(snippet.value) {
+			errs = append(errs, fmt.Sprintf("spec.snippets.%s must have balanced braces", snippet.field))
+		}
+	}
+	return errs
+}
+
+// balancedBraces reports whether every brace of the snippet closes one
+// opened before it, ignoring quoted strings and comments
+func balancedBraces(snippet string) bool {
+	depth := 0
+	var quote rune
+	comment, escaped := false, false
+	for _, c := range snippet {
+		switch {
+		case comment:
+			comment = c != '\n'
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			comment = true
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0 && quote == 0
+}
@@ -0,0 +1,89 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestSetupSnippets(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Snippets = &v1alpha1.NginxSnippets{
+		HTTP:     "gzip on;\ngzip_types text/css application/javascript;",
+		Server:   "server_tokens off;\n\nerror_page 404 /404.html;\n",
+		Location: "  expires 1h;",
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, `gzip on;
+gzip_types text/css application/javascript;
+server {
+    listen 80;
+    server_tokens off;
+    error_page 404 /404.html;
+    location / {
+        root /usr/share/nginx/html;
+        index index.html index.htm;
+        expires 1h;
+    }
+}
+`, defaultServer(&nginx))
+	assert.NotContains(t, dep.Spec.Template.Annotations, locationsAnnotation)
+
+	nginx.Spec.Locations = []v1alpha1.NginxLocation{
+		{Path: "/api", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 8080}},
+	}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, `gzip on;
+gzip_types text/css application/javascript;
+server {
+    listen 80;
+    server_tokens off;
+    error_page 404 /404.html;
+    include /etc/nginx-operator/locations.conf;
+}
+`, defaultServer(&nginx))
+	assert.Equal(t, `location /api {
+    expires 1h;
+    proxy_pass http://api.default.svc:8080;
+}
+`, dep.Spec.Template.Annotations[locationsAnnotation])
+}
+
+func TestValidateSnippets(t *testing.T) {
+	tests := []struct {
+		name     string
+		snippets *v1alpha1.NginxSnippets
+		config   *v1alpha1.ConfigRef
+		want     []string
+	}{
+		{name: "none"},
+		{
+			name: "valid",
+			snippets: &v1alpha1.NginxSnippets{
+				HTTP:     "map $http_upgrade $connection_upgrade {\n    default upgrade;\n    '' close;\n}",
+				Server:   `if ($host = "}") { return 404; } # {`,
+				Location: `add_header X-Brace "\"}";`,
+			},
+		},
+		{
+			name:     "unbalanced",
+			snippets: &v1alpha1.NginxSnippets{HTTP: "server {", Server: "} server {", Location: `return 200 "}`},
+			config:   &v1alpha1.ConfigRef{Name: "custom"},
+			want: []string{
+				"spec.snippets cannot be used with spec.configRef or spec.configTemplate, custom configs must set the directives themselves",
+				"spec.snippets.http must have balanced braces",
+				"spec.snippets.server must have balanced braces",
+				"spec.snippets.location must have balanced braces",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &v1alpha1.NginxSpec{Snippets: tt.snippets, Config: tt.config}
+			assert.Equal(t, tt.want, validateSnippets(spec))
+		})
+	}
+}
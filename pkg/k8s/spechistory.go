@@ -0,0 +1,165 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SpecRevisionHashLabel is the label of the ControllerRevisions holding the
+// hash of the spec they hold
+const SpecRevisionHashLabel = "nginx.tsuru.io/spec-hash"
+
+// SpecHistoryLimit returns the number of previous specs of the nginx kept
+// in ControllerRevisions
+func SpecHistoryLimit(spec *v1alpha1.NginxSpec) int {
+	if spec.SpecHistoryLimit != nil {
+		return int(*spec.SpecHistoryLimit)
+	}
+	return int(v1alpha1.DefaultSpecHistoryLimit)
+}
+
+// historySpec returns the spec kept in the history, without the rollback
+// request
+func historySpec(spec *v1alpha1.NginxSpec) *v1alpha1.NginxSpec {
+	out := spec.DeepCopy()
+	out.RollbackTo = nil
+	return out
+}
+
+// SpecRevisionHash returns a hash identifying the spec in the history
+func SpecRevisionHash(spec *v1alpha1.NginxSpec) (string, error) {
+	data, err := json.Marshal(historySpec(spec))
+	if err != nil {
+		return "", err
+	}
+	return CertificateRevision(data), nil
+}
+
+// NewSpecRevision assembles the ControllerRevision holding the spec of the
+// nginx as the given revision
+func NewSpecRevision(n *v1alpha1.Nginx, spec *v1alpha1.NginxSpec, revision int64) (*appv1.ControllerRevision, error) {
+	data, err := json.Marshal(historySpec(spec))
+	if err != nil {
+		return nil, err
+	}
+	hash := CertificateRevision(data)
+	labels := LabelsForNginx(n.Name)
+	labels[SpecRevisionHashLabel] = hash
+	return &appv1.ControllerRevision{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ControllerRevision",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-spec-%s", n.Name, hash),
+			Namespace: n.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(n, schema.GroupVersionKind{
+					Group:   v1alpha1.SchemeGroupVersion.Group,
+					Version: v1alpha1.SchemeGroupVersion.Version,
+					Kind:    "Nginx",
+				}),
+			},
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: revision,
+	}, nil
+}
+
+// SpecFromRevision returns the spec held by the ControllerRevision
+func SpecFromRevision(cr *appv1.ControllerRevision) (*v1alpha1.NginxSpec, error) {
+	var spec v1alpha1.NginxSpec
+	if err := json.Unmarshal(cr.Data.Raw, &spec); err != nil {
+		return nil, fmt.Errorf("invalid spec in controller revision %s: %v", cr.Name, err)
+	}
+	return &spec, nil
+}
+
+// SortSpecRevisions sorts the ControllerRevisions of the history, newest
+// first
+func SortSpecRevisions(revisions []appv1.ControllerRevision) {
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Revision > revisions[j].Revision
+	})
+}
+
+// SpecHistory returns the history kept in the nginx status from its
+// ControllerRevisions, sorted newest first
+func SpecHistory(revisions []appv1.ControllerRevision) []v1alpha1.NginxSpecRevision {
+	var history []v1alpha1.NginxSpecRevision
+	for _, cr := range revisions {
+		entry := v1alpha1.NginxSpecRevision{
+			Revision: cr.Revision,
+			Name:     cr.Name,
+		}
+		if spec, err := SpecFromRevision(&cr); err == nil {
+			entry.Image = spec.WithDefaults().Image
+		}
+		history = append(history, entry)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Revision > history[j].Revision
+	})
+	return history
+}
+
+// ExpiredSpecRevisions returns the ControllerRevisions to remove: the
+// oldest ones beyond the limit of previous specs. The current revision is
+// always kept.
+func ExpiredSpecRevisions(revisions []appv1.ControllerRevision, current int64, limit int) []appv1.ControllerRevision {
+	sorted := append([]appv1.ControllerRevision(nil), revisions...)
+	SortSpecRevisions(sorted)
+	var expired []appv1.ControllerRevision
+	kept := 0
+	for _, cr := range sorted {
+		if cr.Revision == current {
+			continue
+		}
+		if kept < limit {
+			kept++
+			continue
+		}
+		expired = append(expired, cr)
+	}
+	return expired
+}
+
+// RollbackTarget returns the ControllerRevision requested by the rollback,
+// nil if it is not in the history. Revision 0 is the newest revision other
+// than the current one.
+func RollbackTarget(revisions []appv1.ControllerRevision, rollback *v1alpha1.NginxRollback, current int64) *appv1.ControllerRevision {
+	sorted := append([]appv1.ControllerRevision(nil), revisions...)
+	SortSpecRevisions(sorted)
+	for i := range sorted {
+		cr := &sorted[i]
+		if rollback.Revision == 0 && cr.Revision != current {
+			return cr
+		}
+		if rollback.Revision != 0 && cr.Revision == rollback.Revision {
+			return cr
+		}
+	}
+	return nil
+}
+
+// validateSpecHistory returns the errors found in spec.specHistoryLimit and
+// spec.rollbackTo
+func validateSpecHistory(spec *v1alpha1.NginxSpec) []string {
+	var errs []string
+	if spec.SpecHistoryLimit != nil && *spec.SpecHistoryLimit < 0 {
+		errs = append(errs, "spec.specHistoryLimit must not be negative")
+	}
+	if spec.RollbackTo != nil && spec.RollbackTo.Revision < 0 {
+		errs = append(errs, "spec.rollbackTo.revision must not be negative")
+	}
+	return errs
+}
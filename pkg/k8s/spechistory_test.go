@@ -0,0 +1,139 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func specRevisions(revisions ...int64) []appv1.ControllerRevision {
+	var crs []appv1.ControllerRevision
+	for _, r := range revisions {
+		crs = append(crs, appv1.ControllerRevision{Revision: r})
+	}
+	return crs
+}
+
+func revisionNumbers(crs []appv1.ControllerRevision) []int64 {
+	var revisions []int64
+	for _, cr := range crs {
+		revisions = append(revisions, cr.Revision)
+	}
+	return revisions
+}
+
+func TestNewSpecRevision(t *testing.T) {
+	n := baseNginx()
+	n.UID = "uid"
+	n.Spec.Image = "nginx:1.15"
+	n.Spec.RollbackTo = &v1alpha1.NginxRollback{Revision: 2}
+
+	cr, err := NewSpecRevision(&n, &n.Spec, 3)
+	assert.Nil(t, err)
+	hash, err := SpecRevisionHash(&n.Spec)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-nginx-spec-"+hash, cr.Name)
+	assert.Equal(t, "default", cr.Namespace)
+	assert.Equal(t, map[string]string{"nginx_cr": "my-nginx", "app": "nginx", SpecRevisionHashLabel: hash}, cr.Labels)
+	assert.True(t, metav1.IsControlledBy(cr, &n))
+	assert.Equal(t, int64(3), cr.Revision)
+
+	spec, err := SpecFromRevision(cr)
+	assert.Nil(t, err)
+	assert.Equal(t, &v1alpha1.NginxSpec{Image: "nginx:1.15"}, spec)
+	assert.NotNil(t, n.Spec.RollbackTo)
+
+	// Rollback requests do not change the revision of the spec
+	other := n.Spec.DeepCopy()
+	other.RollbackTo = nil
+	otherHash, err := SpecRevisionHash(other)
+	assert.Nil(t, err)
+	assert.Equal(t, hash, otherHash)
+	other.Image = "nginx:1.16"
+	otherHash, err = SpecRevisionHash(other)
+	assert.Nil(t, err)
+	assert.NotEqual(t, hash, otherHash)
+}
+
+func TestSpecHistory(t *testing.T) {
+	n := baseNginx()
+	var crs []appv1.ControllerRevision
+	for i, image := range []string{"", "nginx:1.15", "nginx:1.16"} {
+		n.Spec.Image = image
+		cr, err := NewSpecRevision(&n, &n.Spec, int64(i+1))
+		assert.Nil(t, err)
+		crs = append(crs, *cr)
+	}
+	assert.Equal(t, []v1alpha1.NginxSpecRevision{
+		{Revision: 3, Name: crs[2].Name, Image: "nginx:1.16"},
+		{Revision: 2, Name: crs[1].Name, Image: "nginx:1.15"},
+		{Revision: 1, Name: crs[0].Name, Image: "nginx:latest"},
+	}, SpecHistory(crs))
+}
+
+func TestSpecHistoryLimit(t *testing.T) {
+	limit := int32(0)
+	assert.Equal(t, 10, SpecHistoryLimit(&v1alpha1.NginxSpec{}))
+	assert.Equal(t, 0, SpecHistoryLimit(&v1alpha1.NginxSpec{SpecHistoryLimit: &limit}))
+}
+
+func TestExpiredSpecRevisions(t *testing.T) {
+	tests := []struct {
+		name      string
+		revisions []int64
+		current   int64
+		limit     int
+		expired   []int64
+	}{
+		{"within limit", []int64{1, 2, 3}, 3, 2, nil},
+		{"oldest beyond limit", []int64{2, 5, 1, 4, 3}, 5, 2, []int64{2, 1}},
+		{"current kept when rolled back", []int64{1, 2, 3, 4}, 1, 1, []int64{3, 2}},
+		{"no previous spec", []int64{1, 2}, 2, 0, []int64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expired := ExpiredSpecRevisions(specRevisions(tt.revisions...), tt.current, tt.limit)
+			assert.Equal(t, tt.expired, revisionNumbers(expired))
+		})
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		revisions []int64
+		revision  int64
+		current   int64
+		target    int64
+	}{
+		{"previous revision", []int64{1, 3, 2}, 0, 3, 2},
+		{"previous revision after a rollback", []int64{1, 3, 2}, 0, 1, 3},
+		{"given revision", []int64{1, 3, 2}, 1, 3, 1},
+		{"unknown revision", []int64{1, 3, 2}, 7, 3, 0},
+		{"no previous revision", []int64{1}, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := RollbackTarget(specRevisions(tt.revisions...), &v1alpha1.NginxRollback{Revision: tt.revision}, tt.current)
+			if tt.target == 0 {
+				assert.Nil(t, target)
+				return
+			}
+			if assert.NotNil(t, target) {
+				assert.Equal(t, tt.target, target.Revision)
+			}
+		})
+	}
+}
+
+func TestValidateSpecHistory(t *testing.T) {
+	limit := int32(-1)
+	assert.Nil(t, validateSpecHistory(&v1alpha1.NginxSpec{RollbackTo: &v1alpha1.NginxRollback{}}))
+	assert.Equal(t, []string{
+		"spec.specHistoryLimit must not be negative",
+		"spec.rollbackTo.revision must not be negative",
+	}, validateSpecHistory(&v1alpha1.NginxSpec{SpecHistoryLimit: &limit, RollbackTo: &v1alpha1.NginxRollback{Revision: -2}}))
+}
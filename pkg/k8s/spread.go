@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Well-known node labels holding the node name and its zone
+	hostnameTopologyKey = "kubernetes.io/hostname"
+	zoneTopologyKey     = "topology.kubernetes.io/zone"
+
+	// Weights of the anti-affinity terms spreading the replicas, spreading
+	// them across nodes is preferred over spreading them across zones
+	spreadNodeWeight = 100
+	spreadZoneWeight = 50
+)
+
+// setupSpreadReplicas adds preferred anti-affinity terms keeping the nginx
+// pods apart from each other on nodes and zones. The terms are preferred so
+// the replicas can still be scheduled when there are more of them than nodes
+// or zones. The affinity of the pod template is kept, so it must run after
+// setupPodTemplate.
+func setupSpreadReplicas(name string, spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if !spec.SpreadReplicas {
+		return
+	}
+	podSpec := &dep.Spec.Template.Spec
+	affinity := &corev1.Affinity{}
+	if podSpec.Affinity != nil {
+		affinity = podSpec.Affinity.DeepCopy()
+	}
+	if affinity.PodAntiAffinity == nil {
+		affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	selector := &metav1.LabelSelector{MatchLabels: LabelsForNginx(name)}
+	for _, term := range []struct {
+		weight      int32
+		topologyKey string
+	}{
+		{spreadNodeWeight, hostnameTopologyKey},
+		{spreadZoneWeight, zoneTopologyKey},
+	} {
+		affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.WeightedPodAffinityTerm{
+				Weight: term.weight,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					LabelSelector: selector,
+					TopologyKey:   term.topologyKey,
+				},
+			})
+	}
+	podSpec.Affinity = affinity
+}
@@ -0,0 +1,54 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSpreadReplicas(t *testing.T) {
+	nginx := baseNginx()
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Nil(t, dep.Spec.Template.Spec.Affinity)
+
+	selector := &metav1.LabelSelector{MatchLabels: LabelsForNginx("my-nginx")}
+	spread := []corev1.WeightedPodAffinityTerm{
+		{Weight: 100, PodAffinityTerm: corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: "kubernetes.io/hostname"}},
+		{Weight: 50, PodAffinityTerm: corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: "topology.kubernetes.io/zone"}},
+	}
+	nginx.Spec.SpreadReplicas = true
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: spread},
+	}, dep.Spec.Template.Spec.Affinity)
+
+	nodeAffinity := &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"edge"}}},
+			}},
+		},
+	}
+	required := []corev1.PodAffinityTerm{{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}},
+		TopologyKey:   "kubernetes.io/hostname",
+	}}
+	nginx.Spec.PodTemplate.Affinity = &corev1.Affinity{
+		NodeAffinity:    nodeAffinity,
+		PodAntiAffinity: &corev1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: required},
+	}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, &corev1.Affinity{
+		NodeAffinity: nodeAffinity,
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: spread,
+		},
+	}, dep.Spec.Template.Spec.Affinity)
+	assert.Nil(t, nginx.Spec.PodTemplate.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+}
@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewStatefulSet creates a StatefulSet for a given Nginx resource. The pod
+// template is the same one generated for the Deployment, except for the
+// cache volume, which is claimed for each replica when requested.
+func NewStatefulSet(n *v1alpha1.Nginx) (*appv1.StatefulSet, error) {
+	deployment, err := NewDeployment(n)
+	if err != nil {
+		return nil, err
+	}
+
+	statefulSet := &appv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            n.Name + "-statefulset",
+			Namespace:       n.Namespace,
+			OwnerReferences: deployment.OwnerReferences,
+			Labels:          deployment.Labels,
+			Annotations:     deployment.Annotations,
+		},
+		Spec: appv1.StatefulSetSpec{
+			Replicas:             deployment.Spec.Replicas,
+			Selector:             deployment.Spec.Selector,
+			Template:             deployment.Spec.Template,
+			ServiceName:          n.Name + "-service",
+			PodManagementPolicy:  appv1.ParallelPodManagement,
+			RevisionHistoryLimit: deployment.Spec.RevisionHistoryLimit,
+		},
+	}
+
+	cache := n.Spec.WithDefaults().Cache
+	if cache == nil || cache.PersistentVolumeClaim == nil {
+		if err := setWorkloadHash(n, statefulSet, &statefulSet.Spec, &statefulSet.Spec.Template); err != nil {
+			return nil, err
+		}
+		return statefulSet, nil
+	}
+	var volumes []corev1.Volume
+	for _, v := range statefulSet.Spec.Template.Spec.Volumes {
+		if v.Name != cacheVolume {
+			volumes = append(volumes, v)
+		}
+	}
+	statefulSet.Spec.Template.Spec.Volumes = volumes
+	claim := cache.PersistentVolumeClaim
+	statefulSet.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   cacheVolume,
+			Labels: LabelsForNginx(n.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      claim.AccessModes,
+			StorageClassName: claim.StorageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: claim.Size},
+			},
+		},
+	}}
+	if err := setWorkloadHash(n, statefulSet, &statefulSet.Spec, &statefulSet.Spec.Template); err != nil {
+		return nil, err
+	}
+	return statefulSet, nil
+}
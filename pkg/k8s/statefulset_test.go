@@ -0,0 +1,67 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewStatefulSet(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.WorkloadKind = v1alpha1.WorkloadKindStatefulSet
+	sts, err := NewStatefulSet(&nginx)
+	assert.Nil(t, err)
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"}, sts.TypeMeta)
+	assert.Equal(t, "my-nginx-statefulset", sts.Name)
+	assert.Equal(t, dep.OwnerReferences, sts.OwnerReferences)
+	assert.Contains(t, sts.Annotations, SpecHashAnnotation)
+	assert.Contains(t, sts.Annotations, TemplateHashAnnotation)
+	assert.Equal(t, "my-nginx-service", sts.Spec.ServiceName)
+	assert.Equal(t, appv1.PodManagementPolicyType("Parallel"), sts.Spec.PodManagementPolicy)
+	assert.Equal(t, dep.Spec.Template, sts.Spec.Template)
+	assert.Nil(t, sts.Spec.VolumeClaimTemplates)
+}
+
+func TestNewStatefulSetCacheClaim(t *testing.T) {
+	storageClass := "ssd"
+	nginx := baseNginx()
+	nginx.Spec.WorkloadKind = v1alpha1.WorkloadKindStatefulSet
+	nginx.Spec.Cache = &v1alpha1.NginxCache{PersistentVolumeClaim: &v1alpha1.NginxCacheClaim{
+		StorageClassName: &storageClass,
+		Size:             resource.MustParse("10Gi"),
+	}}
+	sts, err := NewStatefulSet(&nginx)
+	assert.Nil(t, err)
+
+	assert.Nil(t, sts.Spec.Template.Spec.Volumes)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "nginx-cache", MountPath: "/var/cache/nginx"}}, sts.Spec.Template.Spec.Containers[0].VolumeMounts)
+	assert.Equal(t, []corev1.PersistentVolumeClaim{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "nginx-cache",
+			Labels: map[string]string{"nginx_cr": "my-nginx", "app": "nginx"},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &storageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			},
+		},
+	}}, sts.Spec.VolumeClaimTemplates)
+
+	// The deployment, used to validate the config, keeps an emptyDir in its place
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.Volume{{
+		Name:         "nginx-cache",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}}, dep.Spec.Template.Spec.Volumes)
+}
@@ -0,0 +1,162 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// Mount path of the static sites, each one in a directory named after it
+	staticSitesMountPath = "/usr/share/nginx/sites"
+
+	// Mount path of the site volume in the init containers copying sites
+	// from object storages
+	staticSiteSyncPath = "/site"
+
+	staticSiteVolumePrefix = "static-site-"
+)
+
+// setupStaticSites mounts the content of the static sites in the nginx
+// container. Sites stored in object storages are copied to an emptyDir by
+// an init container. The spec must have its default values already set.
+func setupStaticSites(sites []v1alpha1.NginxStaticSite, dep *appv1.Deployment) {
+	podSpec := &dep.Spec.Template.Spec
+	for _, site := range sites {
+		name := staticSiteVolumePrefix + site.Name
+		volume := corev1.Volume{Name: name}
+		mount := corev1.VolumeMount{
+			Name:      name,
+			MountPath: staticSitesMountPath + "/" + site.Name,
+			ReadOnly:  true,
+		}
+		switch {
+		case site.ConfigMap != nil:
+			volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: site.ConfigMap.Name},
+			}
+		case site.PersistentVolumeClaim != nil:
+			volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: site.PersistentVolumeClaim.ClaimName,
+				ReadOnly:  true,
+			}
+			mount.SubPath = site.PersistentVolumeClaim.SubPath
+		case site.ObjectStorage != nil:
+			volume.EmptyDir = &corev1.EmptyDirVolumeSource{}
+			podSpec.InitContainers = append(podSpec.InitContainers, staticSiteSyncContainer(name, site.ObjectStorage))
+		default:
+			continue
+		}
+		podSpec.Volumes = append(podSpec.Volumes, volume)
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, mount)
+	}
+}
+
+// staticSiteSyncContainer returns the init container copying the content of
+// an object storage to the site volume
+func staticSiteSyncContainer(volume string, source *v1alpha1.StaticObjectStorageSource) corev1.Container {
+	container := corev1.Container{
+		Name:    "sync-" + strings.TrimPrefix(volume, staticSiteVolumePrefix),
+		Image:   source.Image,
+		Command: staticSiteSyncCommand(source.URL),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: volume, MountPath: staticSiteSyncPath},
+		},
+	}
+	if source.CredentialsSecret != "" {
+		container.EnvFrom = []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: source.CredentialsSecret},
+			},
+		}}
+	}
+	return container
+}
+
+func staticSiteSyncCommand(url string) []string {
+	if strings.HasPrefix(url, "gs://") {
+		return []string{"gsutil", "-m", "rsync", "-r", url, staticSiteSyncPath}
+	}
+	return []string{"aws", "s3", "sync", url, staticSiteSyncPath}
+}
+
+// renderStaticSites renders a location block serving each static site
+func renderStaticSites(sites []v1alpha1.NginxStaticSite) string {
+	var buf bytes.Buffer
+	for _, site := range sites {
+		fmt.Fprintf(&buf, "location %s {\n    alias %s/%s/;\n    index %s;\n}\n", site.Path, staticSitesMountPath, site.Name, site.Index)
+	}
+	return buf.String()
+}
+
+// validateStaticSites returns the errors found in the static sites of the
+// spec, including the paths already served by the locations
+func validateStaticSites(sites []v1alpha1.NginxStaticSite, locations []v1alpha1.NginxLocation) []string {
+	var errs []string
+	paths := make(map[string]string)
+	for i, l := range locations {
+		if l.Match == "" || l.Match == v1alpha1.LocationMatchPrefix {
+			paths[l.Path] = fmt.Sprintf("spec.locations[%d]", i)
+		}
+	}
+	names := make(map[string]int)
+	for i, site := range sites {
+		field := fmt.Sprintf("spec.staticSites[%d]", i)
+		if site.Name == "" {
+			errs = append(errs, fmt.Sprintf("%s.name is required", field))
+		} else if msgs := validation.IsDNS1123Label(staticSiteVolumePrefix + site.Name); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%s.name %q is invalid: %s", field, site.Name, strings.Join(msgs, ", ")))
+		} else if other, ok := names[site.Name]; ok {
+			errs = append(errs, fmt.Sprintf("%s.name %q is already used by spec.staticSites[%d]", field, site.Name, other))
+		} else {
+			names[site.Name] = i
+		}
+
+		path := site.Path
+		if path == "" {
+			path = v1alpha1.DefaultStaticSitePath
+		}
+		if !strings.HasPrefix(path, "/") || !strings.HasSuffix(path, "/") {
+			errs = append(errs, fmt.Sprintf("%s.path %q must start and end with /", field, path))
+		} else if strings.ContainsAny(path, " \t\n{};") {
+			errs = append(errs, fmt.Sprintf("%s.path %q must not contain whitespace, braces or semicolons", field, path))
+		} else if other, ok := paths[path]; ok {
+			errs = append(errs, fmt.Sprintf("%s overlaps %s, both match prefix %s", field, other, path))
+		} else {
+			paths[path] = field
+		}
+		if strings.ContainsAny(site.Index, " \t\n{};") {
+			errs = append(errs, fmt.Sprintf("%s.index %q must be a file name", field, site.Index))
+		}
+
+		sources := 0
+		if s := site.ConfigMap; s != nil {
+			sources++
+			if s.Name == "" {
+				errs = append(errs, fmt.Sprintf("%s.configMap.name is required", field))
+			}
+		}
+		if s := site.PersistentVolumeClaim; s != nil {
+			sources++
+			if s.ClaimName == "" {
+				errs = append(errs, fmt.Sprintf("%s.persistentVolumeClaim.claimName is required", field))
+			}
+		}
+		if s := site.ObjectStorage; s != nil {
+			sources++
+			if !strings.HasPrefix(s.URL, "s3://") && !strings.HasPrefix(s.URL, "gs://") {
+				errs = append(errs, fmt.Sprintf("%s.objectStorage.url %q must start with s3:// or gs://", field, s.URL))
+			}
+		}
+		if sources != 1 {
+			errs = append(errs, fmt.Sprintf("%s must set exactly one of configMap, persistentVolumeClaim or objectStorage", field))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetupStaticSites(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.StaticSites = []v1alpha1.NginxStaticSite{
+		{Name: "www", ConfigMap: &v1alpha1.StaticConfigMapSource{Name: "www-content"}},
+		{Name: "docs", Path: "/docs/", PersistentVolumeClaim: &v1alpha1.StaticPersistentVolumeClaimSource{ClaimName: "docs", SubPath: "public"}},
+		{Name: "blog", Path: "/blog/", Index: "home.html", ObjectStorage: &v1alpha1.StaticObjectStorageSource{URL: "s3://bucket/blog", CredentialsSecret: "aws"}},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+
+	podSpec := dep.Spec.Template.Spec
+	assert.Equal(t, `location / {
+    alias /usr/share/nginx/sites/www/;
+    index index.html;
+}
+location /docs/ {
+    alias /usr/share/nginx/sites/docs/;
+    index index.html;
+}
+location /blog/ {
+    alias /usr/share/nginx/sites/blog/;
+    index home.html;
+}
+`, dep.Spec.Template.Annotations["nginx.tsuru.io/locations-conf"])
+	assert.NotNil(t, NewDefaultServerConfigMap(&nginx))
+	assert.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name: "static-site-www",
+		VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "www-content"},
+		}},
+	})
+	assert.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name: "static-site-docs",
+		VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: "docs",
+			ReadOnly:  true,
+		}},
+	})
+	assert.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name:         "static-site-blog",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "static-site-docs",
+		MountPath: "/usr/share/nginx/sites/docs",
+		SubPath:   "public",
+		ReadOnly:  true,
+	})
+	assert.Equal(t, []corev1.Container{{
+		Name:    "sync-blog",
+		Image:   "mesosphere/aws-cli:1.14.5",
+		Command: []string{"aws", "s3", "sync", "s3://bucket/blog", "/site"},
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "aws"}},
+		}},
+		VolumeMounts: []corev1.VolumeMount{{Name: "static-site-blog", MountPath: "/site"}},
+	}}, podSpec.InitContainers)
+}
+
+func TestValidateStaticSites(t *testing.T) {
+	tests := []struct {
+		name      string
+		sites     []v1alpha1.NginxStaticSite
+		locations []v1alpha1.NginxLocation
+		want      []string
+	}{
+		{
+			name: "valid",
+			sites: []v1alpha1.NginxStaticSite{
+				{Name: "www", ConfigMap: &v1alpha1.StaticConfigMapSource{Name: "www"}},
+				{Name: "blog", Path: "/blog/", ObjectStorage: &v1alpha1.StaticObjectStorageSource{URL: "gs://bucket/blog"}},
+			},
+			locations: []v1alpha1.NginxLocation{
+				{Path: "/api", Proxy: &v1alpha1.ProxyAction{Service: "api", Port: 80}},
+			},
+		},
+		{
+			name: "invalid-fields",
+			sites: []v1alpha1.NginxStaticSite{
+				{Name: "My_Site", Path: "/docs", ConfigMap: &v1alpha1.StaticConfigMapSource{}},
+				{Name: "blog", ObjectStorage: &v1alpha1.StaticObjectStorageSource{URL: "http://bucket"}},
+				{Name: "blog", Path: "/other/"},
+			},
+			want: []string{
+				`spec.staticSites[0].name "My_Site" is invalid: a DNS-1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')`,
+				`spec.staticSites[0].path "/docs" must start and end with /`,
+				`spec.staticSites[0].configMap.name is required`,
+				`spec.staticSites[1].objectStorage.url "http://bucket" must start with s3:// or gs://`,
+				`spec.staticSites[2].name "blog" is already used by spec.staticSites[1]`,
+				`spec.staticSites[2] must set exactly one of configMap, persistentVolumeClaim or objectStorage`,
+			},
+		},
+		{
+			name: "overlapping-paths",
+			sites: []v1alpha1.NginxStaticSite{
+				{Name: "www", ConfigMap: &v1alpha1.StaticConfigMapSource{Name: "www"}},
+				{Name: "assets", Path: "/assets/", ConfigMap: &v1alpha1.StaticConfigMapSource{Name: "assets"}},
+			},
+			locations: []v1alpha1.NginxLocation{
+				{Path: "/assets/", Static: &v1alpha1.StaticAction{ConfigMap: "assets"}},
+				{Path: "/", Match: v1alpha1.LocationMatchExact, Return: &v1alpha1.ReturnAction{Code: 200}},
+			},
+			want: []string{
+				"spec.staticSites[1] overlaps spec.locations[0], both match prefix /assets/",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateStaticSites(tt.sites, tt.locations))
+		})
+	}
+}
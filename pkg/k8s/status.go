@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+// StatusPatch returns a JSON merge patch updating only the status fields that
+// differ between current and desired. It returns nil if nothing changed.
+func StatusPatch(current, desired v1alpha1.NginxStatus) ([]byte, error) {
+	currentFields, err := toFields(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredFields, err := toFields(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]json.RawMessage)
+	for name, value := range desiredFields {
+		if !bytes.Equal(currentFields[name], value) {
+			changed[name] = value
+		}
+	}
+	for name := range currentFields {
+		if _, ok := desiredFields[name]; !ok {
+			changed[name] = json.RawMessage("null")
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(map[string]interface{}{"status": changed})
+}
+
+func toFields(status v1alpha1.NginxStatus) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+)
+
+func TestStatusPatch(t *testing.T) {
+	pods := []v1alpha1.NginxPod{{Name: "pod-1", PodIP: "10.0.0.1"}}
+	services := []v1alpha1.NginxService{{Name: "svc", Type: "ClusterIP", ServiceIP: "10.0.1.1"}}
+	tests := []struct {
+		name    string
+		current v1alpha1.NginxStatus
+		desired v1alpha1.NginxStatus
+		want    string
+	}{
+		{
+			name:    "unchanged",
+			current: v1alpha1.NginxStatus{Pods: pods},
+			desired: v1alpha1.NginxStatus{Pods: pods},
+		},
+		{
+			name:    "only-changed-fields",
+			current: v1alpha1.NginxStatus{Pods: pods},
+			desired: v1alpha1.NginxStatus{Pods: pods, Services: services},
+			want:    `{"status":{"services":[{"name":"svc","type":"ClusterIP","serviceIP":"10.0.1.1"}]}}`,
+		},
+		{
+			name:    "removed-fields",
+			current: v1alpha1.NginxStatus{Pods: pods, Services: services},
+			desired: v1alpha1.NginxStatus{Services: services},
+			want:    `{"status":{"pods":null}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := StatusPatch(tt.current, tt.desired)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, string(patch))
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// serverNames returns the deduplicated names served by the default server.
+// The spec must have its default values already set.
+func serverNames(u *v1alpha1.NginxUnknownHosts) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range u.ServerNames {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// renderUnknownHostsServer renders the catch-all server answering the
+// requests for hosts not served by the default server, on the same
+// listeners. Unknown TLS server names are answered with the certificate of
+// the nginx.
+func renderUnknownHostsServer(buf *bytes.Buffer, spec *v1alpha1.NginxSpec) {
+	u := spec.UnknownHosts
+	if u == nil {
+		return
+	}
+	httpPort, httpsPort := listenPorts(spec)
+	proxyProtocol := proxyProtocolListen(spec)
+	buf.WriteString("server {\n")
+	writeListen(buf, spec, httpPort, " default_server"+appProtocolListen(spec)+proxyProtocol)
+	if tls := spec.TLSSecret; tls != nil {
+		writeListen(buf, spec, httpsPort, " ssl default_server"+appProtocolListen(spec)+proxyProtocol)
+		fmt.Fprintf(buf, "    ssl_certificate %s/%s;\n    ssl_certificate_key %s/%s;\n",
+			certMountPath, tls.CertificatePath, certMountPath, tls.KeyPath)
+	}
+	fmt.Fprintf(buf, "    return %d;\n}\n", u.Code)
+}
+
+// setupUnknownHosts sets the Host header of the probes to one of the server
+// names, so they are not answered by the catch-all server. It must run
+// after setupProbes. The spec must have its default values already set.
+func setupUnknownHosts(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	u := spec.UnknownHosts
+	if u == nil || spec.Config != nil {
+		return
+	}
+	names := serverNames(u)
+	if len(names) == 0 {
+		return
+	}
+	host := probeHost(names)
+	nginx := &dep.Spec.Template.Spec.Containers[0]
+	for _, probe := range []*corev1.Probe{nginx.ReadinessProbe, nginx.LivenessProbe} {
+		if probe == nil || probe.HTTPGet == nil || hasHostHeader(probe.HTTPGet.HTTPHeaders) {
+			continue
+		}
+		probe.HTTPGet.HTTPHeaders = append(probe.HTTPGet.HTTPHeaders, corev1.HTTPHeader{Name: "Host", Value: host})
+	}
+}
+
+// probeHost returns the first exact server name, or a name matching the
+// first wildcard one
+func probeHost(names []string) string {
+	for _, name := range names {
+		if !strings.HasPrefix(name, "*.") {
+			return name
+		}
+	}
+	return "healthcheck" + strings.TrimPrefix(names[0], "*")
+}
+
+func hasHostHeader(headers []corev1.HTTPHeader) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, "Host") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateUnknownHosts returns the errors found in the handling of unknown
+// hosts
+func validateUnknownHosts(spec *v1alpha1.NginxSpec) []string {
+	u := spec.UnknownHosts
+	if u == nil {
+		return nil
+	}
+	var errs []string
+	if spec.Config != nil || spec.ConfigTemplate != nil {
+		errs = append(errs, "spec.unknownHosts cannot be used with spec.configRef or spec.configTemplate, custom configs must set their own default server")
+	}
+	for i, name := range u.ServerNames {
+		if msgs := validation.IsDNS1123Subdomain(strings.TrimPrefix(name, "*.")); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("spec.unknownHosts.serverNames[%d] %q is invalid: %s", i, name, strings.Join(msgs, ", ")))
+		}
+	}
+	if len(serverNames(spec.WithDefaults().UnknownHosts)) == 0 {
+		errs = append(errs, "spec.unknownHosts.serverNames must be set when spec.ingress has no hosts and spec.certificates no DNS names")
+	}
+	if u.Code != 0 && (u.Code < 400 || u.Code > 499) {
+		errs = append(errs, fmt.Sprintf("spec.unknownHosts.code %d must be a 4xx status code", u.Code))
+	}
+	return errs
+}
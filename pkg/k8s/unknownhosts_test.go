@@ -0,0 +1,91 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestUnknownHosts(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Ingress = &v1alpha1.NginxIngress{Hosts: []string{"www.example.com", "example.com"}}
+	nginx.Spec.Certificates = &v1alpha1.NginxCertificates{DNSNames: []string{"example.com", "*.example.com"}}
+	nginx.Spec.UnknownHosts = &v1alpha1.NginxUnknownHosts{}
+	nginx.Spec.Healthcheck = &v1alpha1.NginxHealthcheck{Liveness: &v1alpha1.NginxProbe{Path: "/healthz"}}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "server {\n    listen 80 default_server;\n    return 421;\n}\n"+
+		"server {\n    listen 80;\n    server_name www.example.com example.com *.example.com;\n"+
+		"    location / {\n        root /usr/share/nginx/html;\n        index index.html index.htm;\n    }\n}\n",
+		defaultServer(&nginx))
+	nginxContainer := dep.Spec.Template.Spec.Containers[0]
+	host := []corev1.HTTPHeader{{Name: "Host", Value: "www.example.com"}}
+	assert.Equal(t, host, nginxContainer.ReadinessProbe.HTTPGet.HTTPHeaders)
+	assert.Equal(t, host, nginxContainer.LivenessProbe.HTTPGet.HTTPHeaders)
+
+	nginx.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "my-tls"}
+	nginx.Spec.UnknownHosts = &v1alpha1.NginxUnknownHosts{ServerNames: []string{"*.example.org"}, Code: 444}
+	nginx.Spec.Healthcheck = nil
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "server {\n    listen 80 default_server;\n"+
+		"    listen 443 ssl default_server;\n    ssl_certificate /etc/nginx/certs/tls.crt;\n    ssl_certificate_key /etc/nginx/certs/tls.key;\n"+
+		"    return 444;\n}\n"+
+		"server {\n    listen 80;\n"+
+		"    listen 443 ssl;\n    ssl_certificate /etc/nginx/certs/tls.crt;\n    ssl_certificate_key /etc/nginx/certs/tls.key;\n"+
+		"    server_name *.example.org;\n"+
+		"    location / {\n        root /usr/share/nginx/html;\n        index index.html index.htm;\n    }\n}\n",
+		defaultServer(&nginx))
+	assert.Equal(t, []corev1.HTTPHeader{{Name: "Host", Value: "healthcheck.example.org"}},
+		dep.Spec.Template.Spec.Containers[0].ReadinessProbe.HTTPGet.HTTPHeaders)
+}
+
+func TestValidateUnknownHosts(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{name: "none"},
+		{
+			name: "server names",
+			spec: v1alpha1.NginxSpec{UnknownHosts: &v1alpha1.NginxUnknownHosts{ServerNames: []string{"example.com", "*.example.com"}, Code: 404}},
+		},
+		{
+			name: "ingress hosts",
+			spec: v1alpha1.NginxSpec{
+				Ingress:      &v1alpha1.NginxIngress{Hosts: []string{"example.com"}},
+				UnknownHosts: &v1alpha1.NginxUnknownHosts{},
+			},
+		},
+		{
+			name: "no server names",
+			spec: v1alpha1.NginxSpec{
+				Ingress:      &v1alpha1.NginxIngress{},
+				UnknownHosts: &v1alpha1.NginxUnknownHosts{Code: 503},
+			},
+			want: []string{
+				"spec.unknownHosts.serverNames must be set when spec.ingress has no hosts and spec.certificates no DNS names",
+				"spec.unknownHosts.code 503 must be a 4xx status code",
+			},
+		},
+		{
+			name: "invalid",
+			spec: v1alpha1.NginxSpec{
+				Config:       &v1alpha1.ConfigRef{Name: "custom", Kind: v1alpha1.ConfigKindConfigMap},
+				UnknownHosts: &v1alpha1.NginxUnknownHosts{ServerNames: []string{"Example.com"}},
+			},
+			want: []string{
+				"spec.unknownHosts cannot be used with spec.configRef or spec.configTemplate, custom configs must set their own default server",
+				`spec.unknownHosts.serverNames[0] "Example.com" is invalid: a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateUnknownHosts(&tt.spec))
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Pod annotations holding the server context directive writing the
+	// access log read by the upstream metrics sidecar, and the config of
+	// the sidecar
+	upstreamMetricsLogAnnotation    = "nginx.tsuru.io/upstream-metrics-conf"
+	upstreamMetricsConfigAnnotation = "nginx.tsuru.io/upstream-metrics-exporter"
+
+	upstreamMetricsSidecarName = "upstream-metrics"
+
+	// Port name and number of the upstream metrics sidecar
+	upstreamMetricsPortName = "upstreams"
+	upstreamMetricsPort     = 9114
+
+	// upstreamMetricsSyslogPort is the localhost UDP port the sidecar
+	// receives the access log on
+	upstreamMetricsSyslogPort = 5141
+
+	// Name of the log_format, and syslog tag, of the access log read by the
+	// upstream metrics sidecar
+	upstreamMetricsLogFormatName = "nginx_operator_upstreams"
+)
+
+// upstreamMetricsLogFormat is the access log format parsed by the sidecar.
+// The proxied upstream is identified by $proxy_host, the service, namespace
+// and port of the location, "-" for requests not proxied.
+const upstreamMetricsLogFormat = `$proxy_host "$request" $status $body_bytes_sent $request_time $upstream_response_time`
+
+// upstreamMetricsEnabled returns whether the upstream metrics sidecar was
+// requested
+func upstreamMetricsEnabled(spec *v1alpha1.NginxSpec) bool {
+	return spec.Metrics != nil && spec.Metrics.Upstreams != nil
+}
+
+// setupUpstreamMetrics renders the access log read by the upstream metrics
+// sidecar into /etc/nginx-operator/upstream-metrics.conf, which must be
+// included in the server contexts, and adds the sidecar. Its log_format is
+// rendered into http.conf. The spec must have its default values already
+// set.
+func setupUpstreamMetrics(spec *v1alpha1.NginxSpec, dep *appv1.Deployment) {
+	if !upstreamMetricsEnabled(spec) {
+		return
+	}
+	u := spec.Metrics.Upstreams
+	addOperatorConfig(dep, upstreamMetricsLogAnnotation, "upstream-metrics.conf", renderUpstreamMetricsServer(spec))
+	addOperatorConfig(dep, upstreamMetricsConfigAnnotation, "upstream-metrics.yml", renderUpstreamMetricsExporter(u))
+	dep.Spec.Template.Spec.Containers = append(dep.Spec.Template.Spec.Containers, corev1.Container{
+		Name:  upstreamMetricsSidecarName,
+		Image: u.Image,
+		Args:  []string{"-config-file", operatorConfigMountPath + "/upstream-metrics.yml"},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          upstreamMetricsPortName,
+				ContainerPort: int32(upstreamMetricsPort),
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+		Resources: u.Resources,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: operatorConfigVolume, MountPath: operatorConfigMountPath, ReadOnly: true},
+		},
+	})
+}
+
+// renderUpstreamMetricsLogFormat renders the http context log_format of the
+// access log read by the upstream metrics sidecar
+func renderUpstreamMetricsLogFormat(buf *bytes.Buffer, spec *v1alpha1.NginxSpec) {
+	if !upstreamMetricsEnabled(spec) {
+		return
+	}
+	fmt.Fprintf(buf, "log_format %s '%s';\n", upstreamMetricsLogFormatName, upstreamMetricsLogFormat)
+}
+
+// renderUpstreamMetricsServer renders the server context access_log sending
+// the requests to the sidecar. Access logs set in a server context replace
+// the ones of the http context, so without spec.logging the requests are
+// also logged to stdout in the combined format.
+func renderUpstreamMetricsServer(spec *v1alpha1.NginxSpec) string {
+	conf := fmt.Sprintf("access_log syslog:server=127.0.0.1:%d,tag=%s %s;\n",
+		upstreamMetricsSyslogPort, upstreamMetricsLogFormatName, upstreamMetricsLogFormatName)
+	if spec.Logging == nil {
+		conf += "access_log /dev/stdout combined;\n"
+	}
+	return conf
+}
+
+// renderUpstreamMetricsExporter renders the config of the
+// prometheus-nginxlog-exporter sidecar. The requests are counted by upstream
+// and status class, and their latency observed in histograms.
+func renderUpstreamMetricsExporter(u *v1alpha1.NginxUpstreamMetrics) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "listen:\n  port: %d\n  address: 0.0.0.0\n", upstreamMetricsPort)
+	buf.WriteString("namespaces:\n- name: nginx\n")
+	fmt.Fprintf(&buf, "  format: %s\n", strconv.Quote(upstreamMetricsLogFormat))
+	fmt.Fprintf(&buf, "  source:\n    syslog:\n      listen_address: udp://127.0.0.1:%d\n      format: rfc3164\n      tags:\n      - %s\n",
+		upstreamMetricsSyslogPort, upstreamMetricsLogFormatName)
+	buf.WriteString("  relabel_configs:\n")
+	buf.WriteString("  - target_label: upstream\n    from: proxy_host\n")
+	buf.WriteString("  - target_label: status_class\n    from: status\n    matches:\n")
+	buf.WriteString("    - regexp: \"^([1-5])[0-9][0-9]$\"\n      replacement: \"${1}xx\"\n")
+	fmt.Fprintf(&buf, "  histogram_buckets: [%s]\n", strings.Join(u.Buckets, ", "))
+	return buf.String()
+}
+
+// validateUpstreamMetrics returns the errors found in the upstream metrics of
+// the spec
+func validateUpstreamMetrics(spec *v1alpha1.NginxSpec) []string {
+	if !upstreamMetricsEnabled(spec) {
+		return nil
+	}
+	var errs []string
+	last := 0.0
+	for i, b := range spec.Metrics.Upstreams.Buckets {
+		v, err := strconv.ParseFloat(b, 64)
+		if err != nil || !(v > 0) || math.IsInf(v, 1) {
+			errs = append(errs, fmt.Sprintf("spec.metrics.upstreams.buckets[%d] %q must be a positive number of seconds", i, b))
+			continue
+		}
+		if v <= last {
+			errs = append(errs, fmt.Sprintf("spec.metrics.upstreams.buckets[%d] %q must be greater than the previous bucket", i, b))
+		}
+		last = v
+	}
+	return errs
+}
@@ -0,0 +1,93 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestUpstreamMetrics(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Metrics = &v1alpha1.NginxMetrics{Upstreams: &v1alpha1.NginxUpstreamMetrics{Buckets: []string{"0.1", "1"}}}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	annotations := dep.Spec.Template.Annotations
+	assert.Equal(t, "access_log syslog:server=127.0.0.1:5141,tag=nginx_operator_upstreams nginx_operator_upstreams;\n"+
+		"access_log /dev/stdout combined;\n", annotations[upstreamMetricsLogAnnotation])
+	assert.Contains(t, annotations[httpConfigAnnotation],
+		`log_format nginx_operator_upstreams '$proxy_host "$request" $status $body_bytes_sent $request_time $upstream_response_time';`)
+	assert.Contains(t, defaultServer(&nginx), "    include /etc/nginx-operator/upstream-metrics.conf;\n")
+	assert.Equal(t, `listen:
+  port: 9114
+  address: 0.0.0.0
+namespaces:
+- name: nginx
+  format: "$proxy_host \"$request\" $status $body_bytes_sent $request_time $upstream_response_time"
+  source:
+    syslog:
+      listen_address: udp://127.0.0.1:5141
+      format: rfc3164
+      tags:
+      - nginx_operator_upstreams
+  relabel_configs:
+  - target_label: upstream
+    from: proxy_host
+  - target_label: status_class
+    from: status
+    matches:
+    - regexp: "^([1-5])[0-9][0-9]$"
+      replacement: "${1}xx"
+  histogram_buckets: [0.1, 1]
+`, annotations[upstreamMetricsConfigAnnotation])
+
+	containers := dep.Spec.Template.Spec.Containers
+	sidecar := containers[len(containers)-1]
+	assert.Equal(t, "upstream-metrics", sidecar.Name)
+	assert.Equal(t, v1alpha1.DefaultUpstreamMetricsImage, sidecar.Image)
+	assert.Equal(t, []string{"-config-file", "/etc/nginx-operator/upstream-metrics.yml"}, sidecar.Args)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "nginx-operator-config", MountPath: "/etc/nginx-operator", ReadOnly: true}}, sidecar.VolumeMounts)
+
+	svc := NewService(&nginx)
+	assert.Equal(t, "upstreams", svc.Spec.Ports[len(svc.Spec.Ports)-1].Name)
+	assert.Equal(t, int32(9114), svc.Spec.Ports[len(svc.Spec.Ports)-1].Port)
+
+	nginx.Spec.Metrics.ServiceMonitor = &v1alpha1.NginxServiceMonitor{}
+	endpoints, _ := unstructured.NestedSlice(NewServiceMonitor(&nginx).Object, "spec", "endpoints")
+	assert.Equal(t, []interface{}{map[string]interface{}{"port": "metrics"}, map[string]interface{}{"port": "upstreams"}}, endpoints)
+
+	nginx.Spec.Logging = &v1alpha1.NginxLogging{}
+	dep, err = NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, "access_log syslog:server=127.0.0.1:5141,tag=nginx_operator_upstreams nginx_operator_upstreams;\n",
+		dep.Spec.Template.Annotations[upstreamMetricsLogAnnotation])
+}
+
+func TestValidateUpstreamMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []string
+		want    []string
+	}{
+		{name: "defaults"},
+		{name: "buckets", buckets: []string{"0.05", "0.5", "5"}},
+		{
+			name:    "invalid",
+			buckets: []string{"1", "0.5", "fast", "-1", "NaN"},
+			want: []string{
+				`spec.metrics.upstreams.buckets[1] "0.5" must be greater than the previous bucket`,
+				`spec.metrics.upstreams.buckets[2] "fast" must be a positive number of seconds`,
+				`spec.metrics.upstreams.buckets[3] "-1" must be a positive number of seconds`,
+				`spec.metrics.upstreams.buckets[4] "NaN" must be a positive number of seconds`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &v1alpha1.NginxSpec{Metrics: &v1alpha1.NginxMetrics{Upstreams: &v1alpha1.NginxUpstreamMetrics{Buckets: tt.buckets}}}
+			assert.Equal(t, tt.want, validateUpstreamMetrics(spec))
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ReplicaWarnings returns the problems caused by the interplay between the
+// nginx replicas and the PodDisruptionBudgets and HorizontalPodAutoscalers
+// found in its namespace.
+func ReplicaWarnings(n *v1alpha1.Nginx, pdbs []policyv1beta1.PodDisruptionBudget, hpas []autoscalingv1.HorizontalPodAutoscaler) []string {
+	replicas := int32(1)
+	if n.Spec.Replicas != nil {
+		replicas = *n.Spec.Replicas
+	}
+
+	var warnings []string
+	podLabels := labels.Set(podLabelsForNginx(n))
+	for _, pdb := range pdbs {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(podLabels) {
+			continue
+		}
+		if blocksDisruptions(pdb.Spec, replicas) {
+			warnings = append(warnings, fmt.Sprintf("PodDisruptionBudget %s blocks all voluntary disruptions with %d replica(s)", pdb.Name, replicas))
+		}
+	}
+
+	deploymentName := n.Name + "-deployment"
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind != "Deployment" || ref.Name != deploymentName {
+			continue
+		}
+		if n.Spec.Replicas != nil {
+			warnings = append(warnings, fmt.Sprintf("HorizontalPodAutoscaler %s manages the deployment replicas, spec.replicas conflicts with it", hpa.Name))
+		}
+	}
+	return warnings
+}
+
+// blocksDisruptions returns whether no pod could ever be evicted given the
+// number of replicas
+func blocksDisruptions(spec policyv1beta1.PodDisruptionBudgetSpec, replicas int32) bool {
+	if spec.MinAvailable != nil {
+		minAvailable, err := intstr.GetValueFromIntOrPercent(spec.MinAvailable, int(replicas), true)
+		return err == nil && int32(minAvailable) >= replicas
+	}
+	if spec.MaxUnavailable != nil {
+		maxUnavailable, err := intstr.GetValueFromIntOrPercent(spec.MaxUnavailable, int(replicas), false)
+		return err == nil && maxUnavailable == 0
+	}
+	return false
+}
+
+// Validate returns the problems found in the nginx spec that would prevent its
+// objects from being created or the nginx pods from starting.
+func Validate(n *v1alpha1.Nginx) []string {
+	var errs []string
+	if n.Spec.Replicas != nil && *n.Spec.Replicas < 0 {
+		errs = append(errs, "spec.replicas must not be negative")
+	}
+
+	if conf := n.Spec.Config; conf != nil {
+		switch conf.Kind {
+		case v1alpha1.ConfigKindConfigMap, "":
+			if conf.Name == "" && len(conf.Sources) == 0 {
+				errs = append(errs, "spec.configRef.name is required for config kind ConfigMap")
+			}
+		case v1alpha1.ConfigKindInline:
+			if conf.Value == "" {
+				errs = append(errs, "spec.configRef.value must not be empty for config kind Inline")
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("spec.configRef.kind %q is not supported", conf.Kind))
+		}
+		switch conf.Mount {
+		case "", v1alpha1.ConfigMountDirectory:
+		case v1alpha1.ConfigMountFile:
+			if n.Spec.ConfigReload == v1alpha1.ConfigReloadReload && configMounted(conf) {
+				errs = append(errs, "spec.configReload Reload requires spec.configRef.mount Directory, files mounted alone are not updated in running pods")
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("spec.configRef.mount %q is not supported", conf.Mount))
+		}
+	}
+
+	if tls := n.Spec.TLSSecret; tls != nil {
+		if tls.SecretName == "" {
+			errs = append(errs, "spec.tlsSecret.SecretName is required")
+		}
+		tls = n.Spec.WithDefaults().TLSSecret
+		if tls.KeyPath == tls.CertificatePath {
+			errs = append(errs, fmt.Sprintf("spec.tlsSecret key and certificate are both mounted at %q", tls.KeyPath))
+		}
+	}
+
+	for i, p := range n.Spec.PodTemplate.Ports {
+		if p.Name == "" {
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.ports[%d].name is required", i))
+		}
+		if p.ContainerPort < 1 || p.ContainerPort > 65535 {
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.ports[%d].containerPort %d is out of range", i, p.ContainerPort))
+		}
+		switch p.Protocol {
+		case "", corev1.ProtocolTCP, corev1.ProtocolUDP:
+		default:
+			errs = append(errs, fmt.Sprintf("spec.podTemplate.ports[%d].protocol %q is not supported", i, p.Protocol))
+		}
+	}
+
+	if ing := n.Spec.Ingress; ing != nil {
+		if ing.Path != "" && !strings.HasPrefix(ing.Path, "/") {
+			errs = append(errs, fmt.Sprintf("spec.ingress.path %q must start with /", ing.Path))
+		}
+		if ing.TLS != nil && ing.TLS.SecretName == "" {
+			errs = append(errs, "spec.ingress.tls.secretName is required")
+		}
+	}
+
+	errs = append(errs, validateConfigFiles(n.Spec.ConfigFiles)...)
+	errs = append(errs, validateExtraFiles(&n.Spec)...)
+	errs = append(errs, validateConfigSources(&n.Spec)...)
+	errs = append(errs, validateLocations(n.Spec.Locations)...)
+	errs = append(errs, validateSnippets(&n.Spec)...)
+	errs = append(errs, validateStaticSites(n.Spec.StaticSites, n.Spec.Locations)...)
+	errs = append(errs, validateHealthcheck(n.Spec.Healthcheck)...)
+	errs = append(errs, validateGitSync(n.Spec.GitSync)...)
+	errs = append(errs, validateWorkload(&n.Spec)...)
+	errs = append(errs, validateStrategy(&n.Spec)...)
+	errs = append(errs, validateCanary(&n.Spec)...)
+	errs = append(errs, validateCanaryRollout(&n.Spec)...)
+	errs = append(errs, validateCachePolicy(&n.Spec)...)
+	errs = append(errs, validateCache(&n.Spec)...)
+	errs = append(errs, validateNginxArgs(n.Spec.NginxArgs)...)
+	errs = append(errs, validateModules(n.Spec.Modules)...)
+	errs = append(errs, validateWaitFor(n.Spec.WaitFor)...)
+	errs = append(errs, validateOverloadProtection(&n.Spec)...)
+	errs = append(errs, validateLogging(&n.Spec)...)
+	errs = append(errs, validateUpstreamMetrics(&n.Spec)...)
+	errs = append(errs, validateSLO(&n.Spec)...)
+	errs = append(errs, validateUnknownHosts(&n.Spec)...)
+	errs = append(errs, validateSecurity(n.Spec.Security)...)
+	errs = append(errs, validateAuth(&n.Spec)...)
+	errs = append(errs, validateServiceAccount(&n.Spec)...)
+	errs = append(errs, validateAppProtocols(&n.Spec)...)
+	errs = append(errs, validateDNS(&n.Spec)...)
+	errs = append(errs, validateAutoscaling(&n.Spec)...)
+	errs = append(errs, validateMetadata(&n.Spec)...)
+	errs = append(errs, validateControllerClass(&n.Spec)...)
+	errs = append(errs, validateRootless(&n.Spec)...)
+	errs = append(errs, validateProfiles(&n.Spec)...)
+	errs = append(errs, validateNodeRemediation(&n.Spec)...)
+	errs = append(errs, validateService(&n.Spec)...)
+	errs = append(errs, validateIPFamilies(&n.Spec)...)
+	errs = append(errs, validateUnstructuredPodFields(&n.Spec)...)
+	errs = append(errs, validateNetworkPolicy(&n.Spec)...)
+	errs = append(errs, validateLifecycle(&n.Spec)...)
+	errs = append(errs, validateMaxUnavailable(&n.Spec)...)
+	errs = append(errs, validateRetention(n.Spec.Retention)...)
+	errs = append(errs, validateApplyMode(&n.Spec)...)
+	errs = append(errs, validateSpecHistory(&n.Spec)...)
+
+	if pdb := n.Spec.PodDisruptionBudget; pdb != nil && (pdb.MinAvailable == nil) == (pdb.MaxUnavailable == nil) {
+		errs = append(errs, "spec.podDisruptionBudget must set exactly one of minAvailable or maxUnavailable")
+	}
+
+	switch n.Spec.ConfigReload {
+	case "", v1alpha1.ConfigReloadRestart, v1alpha1.ConfigReloadReload:
+	default:
+		errs = append(errs, fmt.Sprintf("spec.configReload %q is not supported", n.Spec.ConfigReload))
+	}
+
+	if p := n.Spec.DeletePropagation; p != nil && *p != "" && !ValidDeletePropagation(*p) {
+		errs = append(errs, fmt.Sprintf("spec.deletePropagation %q is not supported", *p))
+	}
+	errs = append(errs, validateCleanupPolicy(&n.Spec)...)
+	errs = append(errs, validateCertificates(n)...)
+	errs = append(errs, validateExternalSecrets(n)...)
+	errs = append(errs, validateConfigTemplate(n)...)
+
+	errs = append(errs, podTemplateConflicts(n)...)
+
+	if conflicts := userPortConflicts(n); len(conflicts) > 0 {
+		errs = append(errs, conflicts...)
+	} else if deployment, err := NewDeployment(n); err == nil {
+		errs = append(errs, portConflicts(deployment.Spec.Template.Spec.Containers)...)
+	}
+	return errs
+}
+
+// validateWorkload returns the errors found in the workload kind of the spec
+// and the fields it does not support
+func validateWorkload(spec *v1alpha1.NginxSpec) []string {
+	var errs []string
+	switch spec.WorkloadKind {
+	case "", v1alpha1.WorkloadKindDeployment, v1alpha1.WorkloadKindRollout, v1alpha1.WorkloadKindStatefulSet:
+	case v1alpha1.WorkloadKindDaemonSet:
+		if spec.Replicas != nil {
+			errs = append(errs, "spec.replicas is not supported with workload kind DaemonSet, a pod runs on each eligible node")
+		}
+		if spec.SpreadReplicas {
+			errs = append(errs, "spec.spreadReplicas is not supported with workload kind DaemonSet, a pod runs on each eligible node")
+		}
+	default:
+		return []string{fmt.Sprintf("spec.workloadKind %q is not supported", spec.WorkloadKind)}
+	}
+	if spec.Flagger != nil && (spec.WorkloadKind == v1alpha1.WorkloadKindStatefulSet || spec.WorkloadKind == v1alpha1.WorkloadKindDaemonSet) {
+		errs = append(errs, fmt.Sprintf("spec.flagger is not supported with workload kind %s", spec.WorkloadKind))
+	}
+	return errs
+}
+
+// validateStrategy returns the errors found in the deployment strategy and
+// rollout settings of the spec
+func validateStrategy(spec *v1alpha1.NginxSpec) []string {
+	var errs []string
+	if l := spec.RevisionHistoryLimit; l != nil && *l < 0 {
+		errs = append(errs, "spec.revisionHistoryLimit must not be negative")
+	}
+	if spec.MinReadySeconds < 0 {
+		errs = append(errs, "spec.minReadySeconds must not be negative")
+	} else if spec.MinReadySeconds > 0 && spec.WorkloadKind == v1alpha1.WorkloadKindStatefulSet {
+		errs = append(errs, "spec.minReadySeconds is not supported with workload kind StatefulSet")
+	}
+	if d := spec.ProgressDeadlineSeconds; d != nil {
+		switch {
+		case spec.WorkloadKind == v1alpha1.WorkloadKindStatefulSet || spec.WorkloadKind == v1alpha1.WorkloadKindDaemonSet:
+			errs = append(errs, fmt.Sprintf("spec.progressDeadlineSeconds is not supported with workload kind %s", spec.WorkloadKind))
+		case *d <= spec.MinReadySeconds:
+			errs = append(errs, "spec.progressDeadlineSeconds must be greater than spec.minReadySeconds")
+		}
+	}
+	strategy := spec.Strategy
+	if strategy == nil {
+		return errs
+	}
+	switch spec.WorkloadKind {
+	case v1alpha1.WorkloadKindRollout:
+		errs = append(errs, "spec.strategy is not supported with workload kind Rollout, use spec.rollout")
+	case v1alpha1.WorkloadKindStatefulSet, v1alpha1.WorkloadKindDaemonSet:
+		errs = append(errs, fmt.Sprintf("spec.strategy is not supported with workload kind %s", spec.WorkloadKind))
+	}
+	switch strategy.Type {
+	case appv1.RecreateDeploymentStrategyType:
+		if strategy.RollingUpdate != nil {
+			errs = append(errs, "spec.strategy.rollingUpdate must not be set with strategy type Recreate")
+		}
+	case appv1.RollingUpdateDeploymentStrategyType, "":
+		ru := strategy.RollingUpdate
+		if ru == nil {
+			break
+		}
+		surge, surgeErr := rollingUpdateValue("spec.strategy.rollingUpdate.maxSurge", ru.MaxSurge)
+		unavailable, unavailableErr := rollingUpdateValue("spec.strategy.rollingUpdate.maxUnavailable", ru.MaxUnavailable)
+		errs = append(errs, surgeErr...)
+		errs = append(errs, unavailableErr...)
+		if surgeErr == nil && unavailableErr == nil && surge == 0 && unavailable == 0 {
+			errs = append(errs, "spec.strategy.rollingUpdate maxSurge and maxUnavailable must not both be zero")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("spec.strategy.type %q is not supported", strategy.Type))
+	}
+	return errs
+}
+
+// rollingUpdateValue returns the value of a rolling update field, percentages
+// are returned without the % sign
+func rollingUpdateValue(field string, v *intstr.IntOrString) (int, []string) {
+	if v == nil {
+		return -1, nil
+	}
+	if v.Type == intstr.Int {
+		if v.IntVal < 0 {
+			return 0, []string{fmt.Sprintf("%s must not be negative", field)}
+		}
+		return int(v.IntVal), nil
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(v.StrVal, "%"))
+	if err != nil || !strings.HasSuffix(v.StrVal, "%") || percent < 0 || percent > 100 {
+		return 0, []string{fmt.Sprintf("%s %q must be a number or a percentage between 0%% and 100%%", field, v.StrVal)}
+	}
+	return percent, nil
+}
+
+// operatorDeployment returns the deployment of the nginx without the ports,
+// containers and volumes added by the user, which are the ones injected by
+// the operator
+func operatorDeployment(n *v1alpha1.Nginx) (*appv1.Deployment, error) {
+	c := n.DeepCopy()
+	c.Spec.PodTemplate.Ports = nil
+	c.Spec.PodTemplate.Volumes = nil
+	c.Spec.PodTemplate.VolumeMounts = nil
+	c.Spec.PodTemplate.Containers = nil
+	c.Spec.PodTemplate.InitContainers = nil
+	return NewDeployment(c)
+}
+
+// podTemplateConflicts reports the volumes, mounts and containers in
+// spec.podTemplate whose names or paths are already used by the ones
+// injected by the operator or by each other.
+func podTemplateConflicts(n *v1alpha1.Nginx) []string {
+	template := n.Spec.PodTemplate
+	if len(template.Volumes) == 0 && len(template.VolumeMounts) == 0 && len(template.Containers) == 0 && len(template.InitContainers) == 0 {
+		return nil
+	}
+	deployment, err := operatorDeployment(n)
+	if err != nil {
+		return nil
+	}
+	podSpec := deployment.Spec.Template.Spec
+
+	var errs []string
+	check := func(used map[string]string, key, field, what string) {
+		if other, ok := used[key]; ok {
+			errs = append(errs, fmt.Sprintf("%s uses %s %q, already used by %s", field, what, key, other))
+			return
+		}
+		used[key] = field
+	}
+
+	volumes := make(map[string]string)
+	for _, v := range podSpec.Volumes {
+		volumes[v.Name] = "a volume injected by the operator"
+	}
+	for i, v := range template.Volumes {
+		check(volumes, v.Name, fmt.Sprintf("spec.podTemplate.volumes[%d]", i), "the volume name")
+	}
+
+	mounts := make(map[string]string)
+	for _, m := range podSpec.Containers[0].VolumeMounts {
+		mounts[m.MountPath] = "a volume mount injected by the operator"
+	}
+	for i, m := range template.VolumeMounts {
+		check(mounts, m.MountPath, fmt.Sprintf("spec.podTemplate.volumeMounts[%d]", i), "the mount path")
+	}
+
+	containers := make(map[string]string)
+	for _, c := range podSpec.Containers {
+		containers[c.Name] = "a container injected by the operator"
+	}
+	for _, c := range podSpec.InitContainers {
+		containers[c.Name] = "a container injected by the operator"
+	}
+	for i, c := range template.Containers {
+		check(containers, c.Name, fmt.Sprintf("spec.podTemplate.containers[%d]", i), "the container name")
+	}
+	for i, c := range template.InitContainers {
+		check(containers, c.Name, fmt.Sprintf("spec.podTemplate.initContainers[%d]", i), "the container name")
+	}
+	return errs
+}
+
+// userPortConflicts reports the ports in spec.podTemplate.ports colliding
+// with each other or with the ports injected by the operator, naming the
+// entries involved.
+func userPortConflicts(n *v1alpha1.Nginx) []string {
+	if len(n.Spec.PodTemplate.Ports) == 0 {
+		return nil
+	}
+	deployment, err := operatorDeployment(n)
+	if err != nil {
+		return nil
+	}
+
+	numbers := make(map[string]string)
+	names := make(map[string]string)
+	for _, c := range deployment.Spec.Template.Spec.Containers {
+		for _, p := range c.Ports {
+			desc := fmt.Sprintf("the %q port injected by the operator", p.Name)
+			numbers[fmt.Sprintf("%d/%s", p.ContainerPort, p.Protocol)] = desc
+			names[p.Name] = desc
+		}
+	}
+	if n.Spec.Metrics != nil {
+		numbers[fmt.Sprintf("%d/%s", StubStatusPort, corev1.ProtocolTCP)] = "the stub_status page read by the metrics exporter"
+		if n.Spec.Metrics.Upstreams != nil {
+			numbers[fmt.Sprintf("%d/%s", upstreamMetricsSyslogPort, corev1.ProtocolUDP)] = "the access log read by the upstream metrics sidecar"
+		}
+	}
+
+	var errs []string
+	for i, p := range n.Spec.WithDefaults().PodTemplate.Ports {
+		field := fmt.Sprintf("spec.podTemplate.ports[%d] (%q)", i, p.Name)
+		key := fmt.Sprintf("%d/%s", p.ContainerPort, p.Protocol)
+		if other, ok := numbers[key]; ok {
+			errs = append(errs, fmt.Sprintf("%s uses port %s, already used by %s", field, key, other))
+		} else {
+			numbers[key] = field
+		}
+		if p.Name == "" {
+			continue
+		}
+		if other, ok := names[p.Name]; ok {
+			errs = append(errs, fmt.Sprintf("%s uses the same name as %s", field, other))
+		} else {
+			names[p.Name] = field
+		}
+	}
+	return errs
+}
+
+func portConflicts(containers []corev1.Container) []string {
+	var errs []string
+	numbers := make(map[string]string)
+	names := make(map[string]bool)
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = corev1.ProtocolTCP
+			}
+			key := fmt.Sprintf("%d/%s", p.ContainerPort, protocol)
+			if other, ok := numbers[key]; ok {
+				errs = append(errs, fmt.Sprintf("port %s is used by both %q and %q", key, other, p.Name))
+			}
+			numbers[key] = p.Name
+			if p.Name == "" {
+				continue
+			}
+			if names[p.Name] {
+				errs = append(errs, fmt.Sprintf("port name %q is used more than once", p.Name))
+			}
+			names[p.Name] = true
+		}
+	}
+	return errs
+}
@@ -0,0 +1,260 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	appv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestReplicaWarnings(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	intOrStrPtr := func(v intstr.IntOrString) *intstr.IntOrString { return &v }
+	pdb := func(name string, selector map[string]string, minAvailable, maxUnavailable *intstr.IntOrString) policyv1beta1.PodDisruptionBudget {
+		return policyv1beta1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: policyv1beta1.PodDisruptionBudgetSpec{
+				Selector:       &metav1.LabelSelector{MatchLabels: selector},
+				MinAvailable:   minAvailable,
+				MaxUnavailable: maxUnavailable,
+			},
+		}
+	}
+	hpa := func(name, target string) autoscalingv1.HorizontalPodAutoscaler {
+		return autoscalingv1.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: target},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		replicas *int32
+		pdbs     []policyv1beta1.PodDisruptionBudget
+		hpas     []autoscalingv1.HorizontalPodAutoscaler
+		want     []string
+	}{
+		{
+			name: "nothing-found",
+		},
+		{
+			name:     "pdb-min-available-equal-replicas",
+			replicas: int32Ptr(2),
+			pdbs: []policyv1beta1.PodDisruptionBudget{
+				pdb("my-pdb", map[string]string{"nginx_cr": "my-nginx"}, intOrStrPtr(intstr.FromInt(2)), nil),
+			},
+			want: []string{"PodDisruptionBudget my-pdb blocks all voluntary disruptions with 2 replica(s)"},
+		},
+		{
+			name: "pdb-min-available-default-replicas",
+			pdbs: []policyv1beta1.PodDisruptionBudget{
+				pdb("my-pdb", map[string]string{"app": "nginx"}, intOrStrPtr(intstr.FromString("50%")), nil),
+			},
+			want: []string{"PodDisruptionBudget my-pdb blocks all voluntary disruptions with 1 replica(s)"},
+		},
+		{
+			name:     "pdb-allowing-disruptions",
+			replicas: int32Ptr(3),
+			pdbs: []policyv1beta1.PodDisruptionBudget{
+				pdb("min", map[string]string{"nginx_cr": "my-nginx"}, intOrStrPtr(intstr.FromInt(2)), nil),
+				pdb("max", map[string]string{"nginx_cr": "my-nginx"}, nil, intOrStrPtr(intstr.FromInt(1))),
+			},
+		},
+		{
+			name:     "pdb-max-unavailable-zero",
+			replicas: int32Ptr(3),
+			pdbs: []policyv1beta1.PodDisruptionBudget{
+				pdb("max", map[string]string{"nginx_cr": "my-nginx"}, nil, intOrStrPtr(intstr.FromInt(0))),
+			},
+			want: []string{"PodDisruptionBudget max blocks all voluntary disruptions with 3 replica(s)"},
+		},
+		{
+			name:     "pdb-for-other-pods",
+			replicas: int32Ptr(1),
+			pdbs: []policyv1beta1.PodDisruptionBudget{
+				pdb("other", map[string]string{"nginx_cr": "other"}, intOrStrPtr(intstr.FromInt(1)), nil),
+			},
+		},
+		{
+			name:     "hpa-with-replicas",
+			replicas: int32Ptr(2),
+			hpas: []autoscalingv1.HorizontalPodAutoscaler{
+				hpa("my-hpa", "my-nginx-deployment"),
+				hpa("other-hpa", "other-deployment"),
+			},
+			want: []string{"HorizontalPodAutoscaler my-hpa manages the deployment replicas, spec.replicas conflicts with it"},
+		},
+		{
+			name: "hpa-without-replicas",
+			hpas: []autoscalingv1.HorizontalPodAutoscaler{
+				hpa("my-hpa", "my-nginx-deployment"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nginx := baseNginx()
+			nginx.Spec.Replicas = tt.replicas
+			assert.Equal(t, tt.want, ReplicaWarnings(&nginx, tt.pdbs, tt.hpas))
+		})
+	}
+}
+
+func TestValidateStrategy(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	intOrStrPtr := func(v intstr.IntOrString) *intstr.IntOrString { return &v }
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{
+			name: "rolling-update",
+			spec: v1alpha1.NginxSpec{
+				RevisionHistoryLimit: int32Ptr(3),
+				MinReadySeconds:      10,
+				Strategy: &appv1.DeploymentStrategy{
+					Type: appv1.RollingUpdateDeploymentStrategyType,
+					RollingUpdate: &appv1.RollingUpdateDeployment{
+						MaxSurge:       intOrStrPtr(intstr.FromString("50%")),
+						MaxUnavailable: intOrStrPtr(intstr.FromInt(0)),
+					},
+				},
+			},
+		},
+		{
+			name: "recreate",
+			spec: v1alpha1.NginxSpec{Strategy: &appv1.DeploymentStrategy{Type: appv1.RecreateDeploymentStrategyType}},
+		},
+		{
+			name: "invalid-values",
+			spec: v1alpha1.NginxSpec{
+				RevisionHistoryLimit: int32Ptr(-1),
+				MinReadySeconds:      -1,
+				Strategy: &appv1.DeploymentStrategy{
+					RollingUpdate: &appv1.RollingUpdateDeployment{
+						MaxSurge:       intOrStrPtr(intstr.FromString("150%")),
+						MaxUnavailable: intOrStrPtr(intstr.FromInt(-1)),
+					},
+				},
+			},
+			want: []string{
+				"spec.revisionHistoryLimit must not be negative",
+				"spec.minReadySeconds must not be negative",
+				`spec.strategy.rollingUpdate.maxSurge "150%" must be a number or a percentage between 0% and 100%`,
+				"spec.strategy.rollingUpdate.maxUnavailable must not be negative",
+			},
+		},
+		{
+			name: "no-progress",
+			spec: v1alpha1.NginxSpec{Strategy: &appv1.DeploymentStrategy{
+				RollingUpdate: &appv1.RollingUpdateDeployment{
+					MaxSurge:       intOrStrPtr(intstr.FromString("0%")),
+					MaxUnavailable: intOrStrPtr(intstr.FromInt(0)),
+				},
+			}},
+			want: []string{"spec.strategy.rollingUpdate maxSurge and maxUnavailable must not both be zero"},
+		},
+		{
+			name: "recreate-with-rolling-update",
+			spec: v1alpha1.NginxSpec{Strategy: &appv1.DeploymentStrategy{
+				Type:          appv1.RecreateDeploymentStrategyType,
+				RollingUpdate: &appv1.RollingUpdateDeployment{},
+			}},
+			want: []string{"spec.strategy.rollingUpdate must not be set with strategy type Recreate"},
+		},
+		{
+			name: "rollout-workload",
+			spec: v1alpha1.NginxSpec{
+				WorkloadKind: v1alpha1.WorkloadKindRollout,
+				Strategy:     &appv1.DeploymentStrategy{Type: "BlueGreen"},
+			},
+			want: []string{
+				"spec.strategy is not supported with workload kind Rollout, use spec.rollout",
+				`spec.strategy.type "BlueGreen" is not supported`,
+			},
+		},
+		{
+			name: "daemonset-workload",
+			spec: v1alpha1.NginxSpec{
+				WorkloadKind:    v1alpha1.WorkloadKindDaemonSet,
+				MinReadySeconds: 10,
+				Strategy:        &appv1.DeploymentStrategy{Type: appv1.RecreateDeploymentStrategyType},
+			},
+			want: []string{"spec.strategy is not supported with workload kind DaemonSet"},
+		},
+		{
+			name: "progress-deadline",
+			spec: v1alpha1.NginxSpec{MinReadySeconds: 10, ProgressDeadlineSeconds: int32Ptr(600)},
+		},
+		{
+			name: "progress-deadline-within-min-ready",
+			spec: v1alpha1.NginxSpec{MinReadySeconds: 10, ProgressDeadlineSeconds: int32Ptr(10)},
+			want: []string{"spec.progressDeadlineSeconds must be greater than spec.minReadySeconds"},
+		},
+		{
+			name: "progress-deadline-with-statefulset",
+			spec: v1alpha1.NginxSpec{
+				WorkloadKind:            v1alpha1.WorkloadKindStatefulSet,
+				ProgressDeadlineSeconds: int32Ptr(600),
+			},
+			want: []string{"spec.progressDeadlineSeconds is not supported with workload kind StatefulSet"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateStrategy(&tt.spec))
+		})
+	}
+}
+
+func TestValidateWorkload(t *testing.T) {
+	replicas := int32(2)
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+		want []string
+	}{
+		{
+			name: "default",
+			spec: v1alpha1.NginxSpec{Replicas: &replicas, Flagger: &v1alpha1.FlaggerSpec{}},
+		},
+		{
+			name: "daemonset",
+			spec: v1alpha1.NginxSpec{
+				WorkloadKind: v1alpha1.WorkloadKindDaemonSet,
+				PodTemplate:  v1alpha1.NginxPodTemplateSpec{HostNetwork: true},
+			},
+		},
+		{
+			name: "daemonset-with-replicas-and-flagger",
+			spec: v1alpha1.NginxSpec{
+				WorkloadKind:   v1alpha1.WorkloadKindDaemonSet,
+				Replicas:       &replicas,
+				SpreadReplicas: true,
+				Flagger:        &v1alpha1.FlaggerSpec{},
+			},
+			want: []string{
+				"spec.replicas is not supported with workload kind DaemonSet, a pod runs on each eligible node",
+				"spec.spreadReplicas is not supported with workload kind DaemonSet, a pod runs on each eligible node",
+				"spec.flagger is not supported with workload kind DaemonSet",
+			},
+		},
+		{
+			name: "unknown-kind",
+			spec: v1alpha1.NginxSpec{WorkloadKind: "ReplicaSet"},
+			want: []string{`spec.workloadKind "ReplicaSet" is not supported`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateWorkload(&tt.spec))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// VerticalPodAutoscalerAPIVersion is the api version of the
+	// VerticalPodAutoscaler resource
+	VerticalPodAutoscalerAPIVersion = "autoscaling.k8s.io/v1"
+
+	// VerticalPodAutoscalerKind is the kind of the VerticalPodAutoscaler
+	// resource
+	VerticalPodAutoscalerKind = "VerticalPodAutoscaler"
+)
+
+// NewVerticalPodAutoscaler assembles the VerticalPodAutoscaler of the Nginx,
+// targeting its workload. Only the resources of the nginx container are
+// recommended and updated, the sidecars keep the ones of the spec. It
+// returns nil if no vertical autoscaling was requested.
+func NewVerticalPodAutoscaler(n *v1alpha1.Nginx) *unstructured.Unstructured {
+	spec := n.Spec.WithDefaults()
+	if spec.Autoscaling == nil || spec.Autoscaling.Vertical == nil {
+		return nil
+	}
+	vertical := spec.Autoscaling.Vertical
+	apiVersion, kind, name := workloadTarget(n.Name, spec)
+	nginxPolicy := map[string]interface{}{
+		"containerName":       "nginx",
+		"controlledResources": []interface{}{string(corev1.ResourceCPU), string(corev1.ResourceMemory)},
+	}
+	if len(vertical.MinAllowed) > 0 {
+		nginxPolicy["minAllowed"] = unstructuredResources(vertical.MinAllowed)
+	}
+	if len(vertical.MaxAllowed) > 0 {
+		nginxPolicy["maxAllowed"] = unstructuredResources(vertical.MaxAllowed)
+	}
+	o := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"targetRef": map[string]interface{}{
+				"apiVersion": apiVersion,
+				"kind":       kind,
+				"name":       name,
+			},
+			"updatePolicy": map[string]interface{}{
+				"updateMode": string(vertical.UpdateMode),
+			},
+			"resourcePolicy": map[string]interface{}{
+				"containerPolicies": []interface{}{
+					nginxPolicy,
+					map[string]interface{}{"containerName": "*", "mode": "Off"},
+				},
+			},
+		},
+	}}
+	o.SetAPIVersion(VerticalPodAutoscalerAPIVersion)
+	o.SetKind(VerticalPodAutoscalerKind)
+	o.SetName(n.Name)
+	o.SetNamespace(n.Namespace)
+	o.SetLabels(LabelsForNginx(n.Name))
+	o.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(n, schema.GroupVersionKind{
+			Group:   v1alpha1.SchemeGroupVersion.Group,
+			Version: v1alpha1.SchemeGroupVersion.Version,
+			Kind:    "Nginx",
+		}),
+	})
+	setCustomMetadata(&n.Spec, o)
+	return o
+}
+
+// workloadTarget returns the api version, kind and name of the workload
+// running the pods of the named nginx
+func workloadTarget(name string, spec *v1alpha1.NginxSpec) (string, string, string) {
+	switch spec.WorkloadKind {
+	case v1alpha1.WorkloadKindRollout:
+		return RolloutAPIVersion, RolloutKind, name + "-deployment"
+	case v1alpha1.WorkloadKindStatefulSet:
+		return "apps/v1", "StatefulSet", name + "-statefulset"
+	case v1alpha1.WorkloadKindDaemonSet:
+		return "apps/v1", "DaemonSet", name + "-daemonset"
+	}
+	return "apps/v1", "Deployment", name + "-deployment"
+}
+
+func unstructuredResources(list corev1.ResourceList) map[string]interface{} {
+	out := make(map[string]interface{}, len(list))
+	for name, q := range list {
+		out[string(name)] = q.String()
+	}
+	return out
+}
+
+// VerticalRecommendation returns the resources the VerticalPodAutoscaler
+// recommends for the nginx container, nil until the recommender computes
+// them. Quantities that cannot be parsed are left out.
+func VerticalRecommendation(vpa *unstructured.Unstructured) *v1alpha1.NginxResourceRecommendation {
+	containers, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _ := unstructured.NestedString(container, "containerName"); name != "nginx" {
+			continue
+		}
+		return &v1alpha1.NginxResourceRecommendation{
+			Target:         recommendedResources(container, "target"),
+			LowerBound:     recommendedResources(container, "lowerBound"),
+			UpperBound:     recommendedResources(container, "upperBound"),
+			UncappedTarget: recommendedResources(container, "uncappedTarget"),
+		}
+	}
+	return nil
+}
+
+func recommendedResources(container map[string]interface{}, field string) corev1.ResourceList {
+	values, _ := unstructured.NestedStringMap(container, field)
+	var list corev1.ResourceList
+	for name, value := range values {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			continue
+		}
+		if list == nil {
+			list = corev1.ResourceList{}
+		}
+		list[corev1.ResourceName(name)] = q
+	}
+	return list
+}
+
+// validateAutoscaling returns the errors found in the autoscaling settings of
+// the spec
+func validateAutoscaling(spec *v1alpha1.NginxSpec) []string {
+	if spec.Autoscaling == nil || spec.Autoscaling.Vertical == nil {
+		return nil
+	}
+	vertical := spec.Autoscaling.Vertical
+	var errs []string
+	switch vertical.UpdateMode {
+	case "", v1alpha1.VerticalUpdateModeOff, v1alpha1.VerticalUpdateModeInitial, v1alpha1.VerticalUpdateModeAuto:
+	default:
+		errs = append(errs, fmt.Sprintf("spec.autoscaling.vertical.updateMode %q is not supported", vertical.UpdateMode))
+	}
+	for _, bound := range []struct {
+		field string
+		list  corev1.ResourceList
+	}{
+		{"minAllowed", vertical.MinAllowed},
+		{"maxAllowed", vertical.MaxAllowed},
+	} {
+		for _, name := range sortedResourceNames(bound.list) {
+			if name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+				errs = append(errs, fmt.Sprintf("spec.autoscaling.vertical.%s.%s is not supported, only cpu and memory are", bound.field, name))
+			}
+		}
+	}
+	for _, name := range sortedResourceNames(vertical.MinAllowed) {
+		min := vertical.MinAllowed[name]
+		if max, ok := vertical.MaxAllowed[name]; ok && min.Cmp(max) > 0 {
+			errs = append(errs, fmt.Sprintf("spec.autoscaling.vertical.minAllowed.%s must not be greater than maxAllowed.%s", name, name))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewVerticalPodAutoscaler(t *testing.T) {
+	nginx := baseNginx()
+	assert.Nil(t, NewVerticalPodAutoscaler(&nginx))
+
+	nginx.Spec.Autoscaling = &v1alpha1.NginxAutoscaling{Vertical: &v1alpha1.NginxVerticalAutoscaling{
+		MaxAllowed: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+	}}
+	vpa := NewVerticalPodAutoscaler(&nginx)
+	assert.Equal(t, "autoscaling.k8s.io/v1", vpa.GetAPIVersion())
+	assert.Equal(t, "VerticalPodAutoscaler", vpa.GetKind())
+	assert.Equal(t, "my-nginx", vpa.GetName())
+	assert.Equal(t, "default", vpa.GetNamespace())
+	assert.Len(t, vpa.GetOwnerReferences(), 1)
+	assert.Equal(t, LabelsForNginx("my-nginx"), vpa.GetLabels())
+	spec, _ := unstructured.NestedMap(vpa.Object, "spec")
+	assert.Equal(t, map[string]interface{}{
+		"targetRef": map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"name":       "my-nginx-deployment",
+		},
+		"updatePolicy": map[string]interface{}{"updateMode": "Off"},
+		"resourcePolicy": map[string]interface{}{
+			"containerPolicies": []interface{}{
+				map[string]interface{}{
+					"containerName":       "nginx",
+					"controlledResources": []interface{}{"cpu", "memory"},
+					"maxAllowed":          map[string]interface{}{"cpu": "2"},
+				},
+				map[string]interface{}{"containerName": "*", "mode": "Off"},
+			},
+		},
+	}, spec)
+
+	nginx.Spec.WorkloadKind = v1alpha1.WorkloadKindStatefulSet
+	nginx.Spec.Autoscaling.Vertical.UpdateMode = v1alpha1.VerticalUpdateModeAuto
+	vpa = NewVerticalPodAutoscaler(&nginx)
+	target, _ := unstructured.NestedStringMap(vpa.Object, "spec", "targetRef")
+	assert.Equal(t, map[string]string{"apiVersion": "apps/v1", "kind": "StatefulSet", "name": "my-nginx-statefulset"}, target)
+	mode, _ := unstructured.NestedString(vpa.Object, "spec", "updatePolicy", "updateMode")
+	assert.Equal(t, "Auto", mode)
+}
+
+func TestVerticalRecommendation(t *testing.T) {
+	vpa := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	assert.Nil(t, VerticalRecommendation(vpa))
+
+	vpa.Object["status"] = map[string]interface{}{
+		"recommendation": map[string]interface{}{
+			"containerRecommendations": []interface{}{
+				map[string]interface{}{
+					"containerName": "exporter",
+					"target":        map[string]interface{}{"cpu": "10m"},
+				},
+				map[string]interface{}{
+					"containerName":  "nginx",
+					"target":         map[string]interface{}{"cpu": "250m", "memory": "128Mi"},
+					"lowerBound":     map[string]interface{}{"cpu": "100m", "memory": "64Mi"},
+					"upperBound":     map[string]interface{}{"cpu": "1", "memory": "512Mi"},
+					"uncappedTarget": map[string]interface{}{"cpu": "250m", "memory": "invalid"},
+				},
+			},
+		},
+	}
+	assert.Equal(t, &v1alpha1.NginxResourceRecommendation{
+		Target:         corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+		LowerBound:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+		UpperBound:     corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+		UncappedTarget: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+	}, VerticalRecommendation(vpa))
+}
+
+func TestValidateAutoscaling(t *testing.T) {
+	assert.Nil(t, validateAutoscaling(&v1alpha1.NginxSpec{}))
+	assert.Nil(t, validateAutoscaling(&v1alpha1.NginxSpec{Autoscaling: &v1alpha1.NginxAutoscaling{
+		Vertical: &v1alpha1.NginxVerticalAutoscaling{
+			UpdateMode: v1alpha1.VerticalUpdateModeInitial,
+			MinAllowed: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			MaxAllowed: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+	}}))
+	assert.Equal(t, []string{
+		`spec.autoscaling.vertical.updateMode "Recreate" is not supported`,
+		"spec.autoscaling.vertical.maxAllowed.ephemeral-storage is not supported, only cpu and memory are",
+		"spec.autoscaling.vertical.minAllowed.memory must not be greater than maxAllowed.memory",
+	}, validateAutoscaling(&v1alpha1.NginxSpec{Autoscaling: &v1alpha1.NginxAutoscaling{
+		Vertical: &v1alpha1.NginxVerticalAutoscaling{
+			UpdateMode: "Recreate",
+			MinAllowed: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			MaxAllowed: corev1.ResourceList{
+				corev1.ResourceMemory:           resource.MustParse("512Mi"),
+				corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+			},
+		},
+	}}))
+}
@@ -0,0 +1,95 @@
+package k8s
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// waitForUser is the user running the init containers waiting for the
+	// upstreams, nobody, since checking them needs no privileges
+	waitForUser = int64(65534)
+
+	// Scripts of the init containers, polling the upstream every two
+	// seconds. The address is passed through the environment so it is
+	// never interpreted by the shell.
+	waitForTCPScript  = `until nc -z -w 2 "$WAIT_FOR_HOST" "$WAIT_FOR_PORT"; do echo "waiting for $WAIT_FOR_HOST:$WAIT_FOR_PORT"; sleep 2; done`
+	waitForHTTPScript = `until wget -q -T 2 -O /dev/null "$WAIT_FOR_URL"; do echo "waiting for $WAIT_FOR_URL"; sleep 2; done`
+)
+
+// setupWaitFor adds an init container per upstream of spec.waitFor, ahead of
+// the other init containers, blocking the start of the pod until the
+// upstream is reachable. The upstreams must have their default values
+// already set.
+func setupWaitFor(waitFor []v1alpha1.NginxWaitFor, dep *appv1.Deployment) {
+	if len(waitFor) == 0 {
+		return
+	}
+	var containers []corev1.Container
+	for i, w := range waitFor {
+		script, env := waitForTCPScript, []corev1.EnvVar(nil)
+		if w.TCP != "" {
+			host, port, _ := net.SplitHostPort(w.TCP)
+			env = []corev1.EnvVar{
+				{Name: "WAIT_FOR_HOST", Value: host},
+				{Name: "WAIT_FOR_PORT", Value: port},
+			}
+		} else {
+			script = waitForHTTPScript
+			env = []corev1.EnvVar{{Name: "WAIT_FOR_URL", Value: w.HTTP}}
+		}
+		command := []string{"sh", "-c", script}
+		if w.TimeoutSeconds > 0 {
+			command = append([]string{"timeout", strconv.Itoa(int(w.TimeoutSeconds))}, command...)
+		}
+		user := waitForUser
+		containers = append(containers, corev1.Container{
+			Name:    fmt.Sprintf("wait-for-%d", i),
+			Image:   w.Image,
+			Command: command,
+			Env:     env,
+			SecurityContext: &corev1.SecurityContext{
+				RunAsUser:                &user,
+				RunAsNonRoot:             boolPtr(true),
+				AllowPrivilegeEscalation: boolPtr(false),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			},
+		})
+	}
+	podSpec := &dep.Spec.Template.Spec
+	podSpec.InitContainers = append(containers, podSpec.InitContainers...)
+}
+
+// validateWaitFor returns the errors found in the upstreams of spec.waitFor
+func validateWaitFor(waitFor []v1alpha1.NginxWaitFor) []string {
+	var errs []string
+	for i, w := range waitFor {
+		field := fmt.Sprintf("spec.waitFor[%d]", i)
+		switch {
+		case (w.TCP == "") == (w.HTTP == ""):
+			errs = append(errs, fmt.Sprintf("%s must set exactly one of tcp or http", field))
+		case w.TCP != "":
+			host, port, err := net.SplitHostPort(w.TCP)
+			n, portErr := strconv.Atoi(port)
+			if err != nil || host == "" || portErr != nil || n < 1 || n > 65535 {
+				errs = append(errs, fmt.Sprintf("%s.tcp %q must be a host:port address", field, w.TCP))
+			}
+		default:
+			u, err := url.Parse(w.HTTP)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Sprintf("%s.http %q must be an http or https URL", field, w.HTTP))
+			}
+		}
+		if w.TimeoutSeconds < 0 {
+			errs = append(errs, fmt.Sprintf("%s.timeoutSeconds must not be negative", field))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestWaitForInitContainers(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.Modules = []v1alpha1.NginxModule{{Name: "brotli", Image: "brotli:1.25", Files: []string{"/mod.so"}}}
+	nginx.Spec.WaitFor = []v1alpha1.NginxWaitFor{
+		{TCP: "postgres.db.svc:5432"},
+		{HTTP: "http://api:8080/healthz", TimeoutSeconds: 300, Image: "example/tools:1"},
+	}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	initContainers := dep.Spec.Template.Spec.InitContainers
+	if !assert.Len(t, initContainers, 3) {
+		return
+	}
+	assert.Equal(t, "module-brotli", initContainers[2].Name)
+
+	tcp := initContainers[0]
+	assert.Equal(t, "wait-for-0", tcp.Name)
+	assert.Equal(t, "busybox:1.36", tcp.Image)
+	assert.Equal(t, []string{"sh", "-c", waitForTCPScript}, tcp.Command)
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "WAIT_FOR_HOST", Value: "postgres.db.svc"},
+		{Name: "WAIT_FOR_PORT", Value: "5432"},
+	}, tcp.Env)
+	if assert.NotNil(t, tcp.SecurityContext) {
+		assert.Equal(t, int64(65534), *tcp.SecurityContext.RunAsUser)
+		assert.False(t, *tcp.SecurityContext.AllowPrivilegeEscalation)
+	}
+
+	http := initContainers[1]
+	assert.Equal(t, "wait-for-1", http.Name)
+	assert.Equal(t, "example/tools:1", http.Image)
+	assert.Equal(t, []string{"timeout", "300", "sh", "-c", waitForHTTPScript}, http.Command)
+	assert.Equal(t, []corev1.EnvVar{{Name: "WAIT_FOR_URL", Value: "http://api:8080/healthz"}}, http.Env)
+}
+
+func TestWaitForIPv6Address(t *testing.T) {
+	nginx := baseNginx()
+	nginx.Spec.WaitFor = []v1alpha1.NginxWaitFor{{TCP: "[fd00::1]:6379"}}
+	dep, err := NewDeployment(&nginx)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "WAIT_FOR_HOST", Value: "fd00::1"},
+		{Name: "WAIT_FOR_PORT", Value: "6379"},
+	}, dep.Spec.Template.Spec.InitContainers[0].Env)
+}
+
+func TestValidateWaitFor(t *testing.T) {
+	tests := []struct {
+		waitFor []v1alpha1.NginxWaitFor
+		want    []string
+	}{
+		{nil, nil},
+		{[]v1alpha1.NginxWaitFor{{TCP: "db:5432"}, {HTTP: "https://api/healthz", TimeoutSeconds: 10}}, nil},
+		{[]v1alpha1.NginxWaitFor{{}, {TCP: "db:5432", HTTP: "http://api"}}, []string{
+			"spec.waitFor[0] must set exactly one of tcp or http",
+			"spec.waitFor[1] must set exactly one of tcp or http",
+		}},
+		{[]v1alpha1.NginxWaitFor{{TCP: "db"}, {TCP: ":5432"}, {TCP: "db:http"}, {TCP: "db:70000"}}, []string{
+			`spec.waitFor[0].tcp "db" must be a host:port address`,
+			`spec.waitFor[1].tcp ":5432" must be a host:port address`,
+			`spec.waitFor[2].tcp "db:http" must be a host:port address`,
+			`spec.waitFor[3].tcp "db:70000" must be a host:port address`,
+		}},
+		{[]v1alpha1.NginxWaitFor{{HTTP: "api:8080/healthz"}, {HTTP: "ftp://api"}, {HTTP: "http://api", TimeoutSeconds: -1}}, []string{
+			`spec.waitFor[0].http "api:8080/healthz" must be an http or https URL`,
+			`spec.waitFor[1].http "ftp://api" must be an http or https URL`,
+			"spec.waitFor[2].timeoutSeconds must not be negative",
+		}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, validateWaitFor(tt.waitFor))
+	}
+}
@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// WorkloadDefaults are the operator defaults of the workload settings of
+// nginx objects that do not set them. Nil and zero values leave the
+// Kubernetes defaults.
+type WorkloadDefaults struct {
+	RevisionHistoryLimit    *int32
+	ProgressDeadlineSeconds *int32
+	MinReadySeconds         int32
+
+	// Resources of the nginx container of instances that set no
+	// spec.podTemplate.resources
+	Resources corev1.ResourceRequirements
+
+	// GuaranteedQoS sets the cpu and memory limits missing from the nginx
+	// container to its requests, and the missing requests to its limits, so
+	// the pods get the Guaranteed QoS class
+	GuaranteedQoS bool
+}
+
+// Validate returns an error if the defaults could never be applied
+func (d WorkloadDefaults) Validate() error {
+	if l := d.RevisionHistoryLimit; l != nil && *l < 0 {
+		return fmt.Errorf("revision history limit must not be negative")
+	}
+	if d.MinReadySeconds < 0 {
+		return fmt.Errorf("min ready seconds must not be negative")
+	}
+	if p := d.ProgressDeadlineSeconds; p != nil && *p <= d.MinReadySeconds {
+		return fmt.Errorf("progress deadline seconds must be greater than min ready seconds")
+	}
+	for _, name := range sortedResourceNames(d.Resources.Requests) {
+		request := d.Resources.Requests[name]
+		if limit, ok := d.Resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("%s request must not be greater than its limit", name)
+		}
+	}
+	return nil
+}
+
+// WithWorkloadDefaults returns a copy of the spec with the operator defaults
+// applied to the workload settings left empty and supported by its workload
+// kind. The receiver is never modified.
+func WithWorkloadDefaults(spec *v1alpha1.NginxSpec, d WorkloadDefaults) *v1alpha1.NginxSpec {
+	out := spec.DeepCopy()
+	if out.RevisionHistoryLimit == nil && d.RevisionHistoryLimit != nil {
+		limit := *d.RevisionHistoryLimit
+		out.RevisionHistoryLimit = &limit
+	}
+	if out.MinReadySeconds == 0 && out.WorkloadKind != v1alpha1.WorkloadKindStatefulSet {
+		out.MinReadySeconds = d.MinReadySeconds
+	}
+	switch out.WorkloadKind {
+	case v1alpha1.WorkloadKindStatefulSet, v1alpha1.WorkloadKindDaemonSet:
+	default:
+		// The deadline must stay greater than the instance minReadySeconds
+		if out.ProgressDeadlineSeconds == nil && d.ProgressDeadlineSeconds != nil && *d.ProgressDeadlineSeconds > out.MinReadySeconds {
+			deadline := *d.ProgressDeadlineSeconds
+			out.ProgressDeadlineSeconds = &deadline
+		}
+	}
+	if resourcesEmpty(out.PodTemplate.Resources) {
+		out.PodTemplate.Resources = *d.Resources.DeepCopy()
+	}
+	if d.GuaranteedQoS {
+		out.PodTemplate.Resources = guaranteedResources(out.PodTemplate.Resources)
+	}
+	return out
+}
+
+// guaranteedResources returns the resource requirements with the cpu and
+// memory limits they miss set to their requests and the requests they miss
+// set to their limits. The values set are kept, even when they differ.
+func guaranteedResources(r corev1.ResourceRequirements) corev1.ResourceRequirements {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		request, hasRequest := r.Requests[name]
+		limit, hasLimit := r.Limits[name]
+		switch {
+		case hasRequest && !hasLimit:
+			if r.Limits == nil {
+				r.Limits = corev1.ResourceList{}
+			}
+			r.Limits[name] = request
+		case hasLimit && !hasRequest:
+			if r.Requests == nil {
+				r.Requests = corev1.ResourceList{}
+			}
+			r.Requests[name] = limit
+		}
+	}
+	return r
+}
+
+// WithLimitRangeBounds returns a copy of the defaults with their resources
+// raised to the container minimums and lowered to the container maximums of
+// the limit ranges, so the LimitRanger admission does not reject the pods of
+// instances that set no resources of their own
+func (d WorkloadDefaults) WithLimitRangeBounds(ranges []corev1.LimitRange) WorkloadDefaults {
+	d.Resources = *d.Resources.DeepCopy()
+	for _, r := range ranges {
+		for _, item := range r.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for _, list := range []corev1.ResourceList{d.Resources.Requests, d.Resources.Limits} {
+				for name, q := range list {
+					if min, ok := item.Min[name]; ok && q.Cmp(min) < 0 {
+						q = min
+					}
+					if max, ok := item.Max[name]; ok && q.Cmp(max) > 0 {
+						q = max
+					}
+					list[name] = q
+				}
+			}
+		}
+	}
+	return d
+}
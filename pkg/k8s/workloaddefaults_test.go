@@ -0,0 +1,192 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestWithWorkloadDefaults(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	defaults := WorkloadDefaults{
+		RevisionHistoryLimit:    int32Ptr(5),
+		ProgressDeadlineSeconds: int32Ptr(300),
+		MinReadySeconds:         10,
+	}
+	tests := []struct {
+		name     string
+		spec     v1alpha1.NginxSpec
+		defaults WorkloadDefaults
+		want     v1alpha1.NginxSpec
+	}{
+		{
+			name: "no-defaults",
+		},
+		{
+			name:     "deployment",
+			defaults: defaults,
+			want: v1alpha1.NginxSpec{
+				RevisionHistoryLimit:    int32Ptr(5),
+				ProgressDeadlineSeconds: int32Ptr(300),
+				MinReadySeconds:         10,
+			},
+		},
+		{
+			name: "spec-wins",
+			spec: v1alpha1.NginxSpec{
+				RevisionHistoryLimit:    int32Ptr(0),
+				ProgressDeadlineSeconds: int32Ptr(900),
+				MinReadySeconds:         30,
+			},
+			defaults: defaults,
+			want: v1alpha1.NginxSpec{
+				RevisionHistoryLimit:    int32Ptr(0),
+				ProgressDeadlineSeconds: int32Ptr(900),
+				MinReadySeconds:         30,
+			},
+		},
+		{
+			name:     "deadline-within-spec-min-ready",
+			spec:     v1alpha1.NginxSpec{MinReadySeconds: 300},
+			defaults: defaults,
+			want: v1alpha1.NginxSpec{
+				RevisionHistoryLimit: int32Ptr(5),
+				MinReadySeconds:      300,
+			},
+		},
+		{
+			name:     "statefulset",
+			spec:     v1alpha1.NginxSpec{WorkloadKind: v1alpha1.WorkloadKindStatefulSet},
+			defaults: defaults,
+			want: v1alpha1.NginxSpec{
+				WorkloadKind:         v1alpha1.WorkloadKindStatefulSet,
+				RevisionHistoryLimit: int32Ptr(5),
+			},
+		},
+		{
+			name:     "daemonset",
+			spec:     v1alpha1.NginxSpec{WorkloadKind: v1alpha1.WorkloadKindDaemonSet},
+			defaults: defaults,
+			want: v1alpha1.NginxSpec{
+				WorkloadKind:         v1alpha1.WorkloadKindDaemonSet,
+				RevisionHistoryLimit: int32Ptr(5),
+				MinReadySeconds:      10,
+			},
+		},
+		{
+			name: "resources",
+			defaults: WorkloadDefaults{Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			}},
+			want: v1alpha1.NginxSpec{PodTemplate: v1alpha1.NginxPodTemplateSpec{Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			}}},
+		},
+		{
+			name: "spec-resources-win",
+			spec: v1alpha1.NginxSpec{PodTemplate: v1alpha1.NginxPodTemplateSpec{Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			}}},
+			defaults: WorkloadDefaults{Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			}},
+			want: v1alpha1.NginxSpec{PodTemplate: v1alpha1.NginxPodTemplateSpec{Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			}}},
+		},
+		{
+			name: "guaranteed-qos",
+			spec: v1alpha1.NginxSpec{PodTemplate: v1alpha1.NginxPodTemplateSpec{Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			}}},
+			defaults: WorkloadDefaults{GuaranteedQoS: true},
+			want: v1alpha1.NginxSpec{PodTemplate: v1alpha1.NginxPodTemplateSpec{Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+			}}},
+		},
+		{
+			name: "guaranteed-qos-defaults",
+			defaults: WorkloadDefaults{GuaranteedQoS: true, Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			}},
+			want: v1alpha1.NginxSpec{PodTemplate: v1alpha1.NginxPodTemplateSpec{Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec.DeepCopy()
+			assert.Equal(t, &tt.want, WithWorkloadDefaults(&tt.spec, tt.defaults))
+			assert.Equal(t, spec, &tt.spec)
+		})
+	}
+}
+
+func TestWorkloadDefaultsValidate(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	tests := []struct {
+		name     string
+		defaults WorkloadDefaults
+		wantErr  string
+	}{
+		{name: "empty"},
+		{name: "valid", defaults: WorkloadDefaults{RevisionHistoryLimit: int32Ptr(0), ProgressDeadlineSeconds: int32Ptr(60), MinReadySeconds: 5}},
+		{name: "negative-limit", defaults: WorkloadDefaults{RevisionHistoryLimit: int32Ptr(-1)}, wantErr: "revision history limit must not be negative"},
+		{name: "negative-min-ready", defaults: WorkloadDefaults{MinReadySeconds: -1}, wantErr: "min ready seconds must not be negative"},
+		{name: "deadline-within-min-ready", defaults: WorkloadDefaults{ProgressDeadlineSeconds: int32Ptr(5), MinReadySeconds: 5}, wantErr: "progress deadline seconds must be greater than min ready seconds"},
+		{name: "request-over-limit", defaults: WorkloadDefaults{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+		}}, wantErr: "memory request must not be greater than its limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.defaults.Validate()
+			if tt.wantErr == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWorkloadDefaultsWithLimitRangeBounds(t *testing.T) {
+	defaults := WorkloadDefaults{
+		MinReadySeconds: 10,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+	}
+	ranges := []corev1.LimitRange{
+		{Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{
+			{
+				Type: corev1.LimitTypePod,
+				Min:  corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+			{
+				Type: corev1.LimitTypeContainer,
+				Min:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				Max:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			},
+		}}},
+	}
+	out := defaults.WithLimitRangeBounds(ranges)
+	assert.Equal(t, WorkloadDefaults{
+		MinReadySeconds: 10,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+	}, out)
+	assert.Equal(t, resource.MustParse("50m"), defaults.Resources.Requests[corev1.ResourceCPU])
+	assert.Equal(t, defaults, defaults.WithLimitRangeBounds(nil))
+}
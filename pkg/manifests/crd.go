@@ -0,0 +1,168 @@
+package manifests
+
+import (
+	"reflect"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1beta1"
+)
+
+// CustomResourceDefinition is an apiextensions.k8s.io/v1
+// CustomResourceDefinition, whose Go types are not part of the Kubernetes
+// API the operator is built against
+type CustomResourceDefinition struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       CRDSpec    `json:"spec"`
+}
+
+// ObjectMeta is the metadata of the generated objects
+type ObjectMeta struct {
+	Name string `json:"name"`
+}
+
+// CRDSpec is the spec of a CustomResourceDefinition
+type CRDSpec struct {
+	Group      string         `json:"group"`
+	Names      CRDNames       `json:"names"`
+	Scope      string         `json:"scope"`
+	Versions   []CRDVersion   `json:"versions"`
+	Conversion *CRDConversion `json:"conversion,omitempty"`
+}
+
+// CRDNames are the names the resource is served with
+type CRDNames struct {
+	Kind       string   `json:"kind"`
+	ListKind   string   `json:"listKind"`
+	Plural     string   `json:"plural"`
+	Singular   string   `json:"singular"`
+	ShortNames []string `json:"shortNames,omitempty"`
+}
+
+// CRDVersion is a served version of the resource, with its schema
+type CRDVersion struct {
+	Name    string    `json:"name"`
+	Served  bool      `json:"served"`
+	Storage bool      `json:"storage"`
+	Schema  CRDSchema `json:"schema"`
+}
+
+// CRDSchema is the validation schema of a version
+type CRDSchema struct {
+	OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+}
+
+// CRDConversion is how the versions of the resource are converted
+type CRDConversion struct {
+	Strategy string             `json:"strategy"`
+	Webhook  *WebhookConversion `json:"webhook,omitempty"`
+}
+
+// WebhookConversion is the webhook converting the versions
+type WebhookConversion struct {
+	ClientConfig             WebhookClientConfig `json:"clientConfig"`
+	ConversionReviewVersions []string            `json:"conversionReviewVersions"`
+}
+
+// WebhookClientConfig is how the API server calls the webhook
+type WebhookClientConfig struct {
+	Service  ServiceReference `json:"service"`
+	CABundle string           `json:"caBundle"`
+}
+
+// ServiceReference is the Service of the webhook
+type ServiceReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Path      string `json:"path"`
+}
+
+// NginxCRD returns the CRD of the Nginx resource, with the schemas of its
+// versions generated from their Go types. Only v1alpha1 is served unless
+// conversionWebhook is set, in which case v1beta1 is served as well and
+// converted by the operator webhooks, whose caBundle is set by the operator
+// or by hand.
+func NginxCRD(docs *Docs, conversionWebhook bool) *CustomResourceDefinition {
+	conversion := &CRDConversion{Strategy: "None"}
+	if conversionWebhook {
+		conversion = &CRDConversion{
+			Strategy: "Webhook",
+			Webhook: &WebhookConversion{
+				ClientConfig: WebhookClientConfig{
+					Service: ServiceReference{
+						Name:      "nginx-operator-webhook",
+						Namespace: "default",
+						Path:      "/convert",
+					},
+				},
+				ConversionReviewVersions: []string{"v1beta1"},
+			},
+		}
+	}
+	return &CustomResourceDefinition{
+		APIVersion: "apiextensions.k8s.io/v1",
+		Kind:       "CustomResourceDefinition",
+		Metadata:   ObjectMeta{Name: "nginxs.nginx.tsuru.io"},
+		Spec: CRDSpec{
+			Group: v1alpha1.SchemeGroupVersion.Group,
+			Names: CRDNames{
+				Kind:       "Nginx",
+				ListKind:   "NginxList",
+				Plural:     "nginxs",
+				Singular:   "nginx",
+				ShortNames: []string{"ngx"},
+			},
+			Scope: "Namespaced",
+			Versions: []CRDVersion{
+				{
+					Name:    v1alpha1.SchemeGroupVersion.Version,
+					Served:  true,
+					Storage: true,
+					Schema:  CRDSchema{legacySpecSchema(ObjectSchema(reflect.TypeOf(v1alpha1.Nginx{}), docs))},
+				},
+				{
+					Name:   v1beta1.SchemeGroupVersion.Version,
+					Served: conversionWebhook,
+					Schema: CRDSchema{ObjectSchema(reflect.TypeOf(v1beta1.Nginx{}), docs)},
+				},
+			},
+			Conversion: conversion,
+		},
+	}
+}
+
+// legacySpecSchema keeps the unknown fields of the v1alpha1 spec. Objects
+// written before the json tags of spec.tlsSecret and spec.podTemplate were
+// fixed have them keyed as TLSSecret and PodTemplate, which the operator
+// still reads and the conversion to v1beta1 renames.
+func legacySpecSchema(s *Schema) *Schema {
+	s.Properties["spec"].PreserveUnknownFields = true
+	return s
+}
+
+// FleetStatusCRD returns the CRD of the NginxFleetStatus resource, written by
+// the operator started with --fleet-status
+func FleetStatusCRD(docs *Docs) *CustomResourceDefinition {
+	return &CustomResourceDefinition{
+		APIVersion: "apiextensions.k8s.io/v1",
+		Kind:       "CustomResourceDefinition",
+		Metadata:   ObjectMeta{Name: "nginxfleetstatuses.nginx.tsuru.io"},
+		Spec: CRDSpec{
+			Group: v1alpha1.SchemeGroupVersion.Group,
+			Names: CRDNames{
+				Kind:     "NginxFleetStatus",
+				ListKind: "NginxFleetStatusList",
+				Plural:   "nginxfleetstatuses",
+				Singular: "nginxfleetstatus",
+			},
+			Scope: "Cluster",
+			Versions: []CRDVersion{{
+				Name:    v1alpha1.SchemeGroupVersion.Version,
+				Served:  true,
+				Storage: true,
+				Schema:  CRDSchema{ObjectSchema(reflect.TypeOf(v1alpha1.NginxFleetStatus{}), docs)},
+			}},
+		},
+	}
+}
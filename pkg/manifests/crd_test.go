@@ -0,0 +1,76 @@
+package manifests
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+var yamlBlock = regexp.MustCompile("(?s)```yaml\n(.*?)```")
+
+// The nginx specs documented in the README must be kept as they are by the
+// API server, which drops the fields missing from the schema
+func TestDocumentedSpecsRoundTrip(t *testing.T) {
+	readme, err := ioutil.ReadFile("../../README.md")
+	assert.Nil(t, err)
+	docs := NewDocs()
+	for importPath, dir := range apiPackages {
+		assert.Nil(t, docs.Parse(importPath, "../../"+dir))
+	}
+	schema := NginxCRD(docs, false).Spec.Versions[0].Schema.OpenAPIV3Schema
+
+	var specs int
+	for _, match := range yamlBlock.FindAllStringSubmatch(string(readme), -1) {
+		block := match[1]
+		if !strings.HasPrefix(block, "spec:\n") {
+			continue
+		}
+		var obj map[string]interface{}
+		if !assert.Nil(t, yaml.Unmarshal([]byte(block), &obj), block) {
+			continue
+		}
+		obj["apiVersion"] = "nginx.tsuru.io/v1alpha1"
+		obj["kind"] = "Nginx"
+		assert.Equal(t, obj, pruneUnknown(obj, schema), block)
+		specs++
+	}
+	assert.NotZero(t, specs)
+}
+
+// pruneUnknown drops the fields of the object missing from the schema, like
+// the API server. Objects declaring their properties are pruned even when
+// they also preserve their unknown fields, so the documented fields must be
+// declared.
+func pruneUnknown(obj interface{}, s *Schema) interface{} {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for key, value := range v {
+			switch {
+			case s.Properties != nil:
+				if property, ok := s.Properties[key]; ok {
+					out[key] = pruneUnknown(value, property)
+				}
+			case s.AdditionalProperties != nil:
+				out[key] = pruneUnknown(value, s.AdditionalProperties)
+			default:
+				out[key] = value
+			}
+		}
+		return out
+	case []interface{}:
+		if s.Items == nil {
+			return v
+		}
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = pruneUnknown(v[i], s.Items)
+		}
+		return out
+	}
+	return obj
+}
@@ -0,0 +1,111 @@
+package manifests
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// Docs are the doc comments of Go types and of their fields, keyed by
+// <package path>.<type> and <package path>.<type>.<field>
+type Docs struct {
+	// Types are the documented types, even the ones without a doc comment
+	Types map[string]bool
+
+	// Descriptions are the doc comments, without their markers
+	Descriptions map[string]string
+
+	// Required are the fields marked +required
+	Required map[string]bool
+}
+
+// NewDocs returns empty docs
+func NewDocs() *Docs {
+	return &Docs{
+		Types:        make(map[string]bool),
+		Descriptions: make(map[string]string),
+		Required:     make(map[string]bool),
+	}
+}
+
+// Parse adds the doc comments of the types declared in the Go files of dir,
+// the package importPath, to the docs
+func (docs *Docs) Parse(importPath, dir string) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					doc := ts.Doc
+					if doc == nil && len(gen.Specs) == 1 {
+						doc = gen.Doc
+					}
+					key := importPath + "." + ts.Name.Name
+					docs.Types[key] = true
+					if text := docText(doc); text != "" {
+						docs.Descriptions[key] = text
+					}
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range st.Fields.List {
+						text, required := docText(field.Doc), hasMarker(field.Doc, "+required")
+						for _, name := range field.Names {
+							if text != "" {
+								docs.Descriptions[key+"."+name.Name] = text
+							}
+							if required {
+								docs.Required[key+"."+name.Name] = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// docText returns the text of the doc comment without its markers, its
+// lines joined
+func docText(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "+") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// hasMarker returns whether a line of the doc comment is the marker
+func hasMarker(doc *ast.CommentGroup, marker string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		if strings.TrimSpace(line) == marker {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+// Package manifests generates the manifests of deploy/ from the Go types of
+// the API and of the operator, run by make manifests.
+package manifests
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+)
+
+// DefaultImage is the image of the operator in the generated Deployment
+const DefaultImage = "tsuru/nginx-operator:latest"
+
+// apiPackages are the import paths of the API packages, relative to the root
+// of the repository for their sources
+var apiPackages = map[string]string{
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1": "pkg/apis/nginx/v1alpha1",
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1beta1":  "pkg/apis/nginx/v1beta1",
+}
+
+// Generate returns the generated manifests keyed by their path relative to
+// the root of the repository, whose API sources are read for the field
+// descriptions
+func Generate(root, image string) (map[string][]byte, error) {
+	docs := NewDocs()
+	for importPath, dir := range apiPackages {
+		if err := docs.Parse(importPath, filepath.Join(root, dir)); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range []struct {
+		path    string
+		header  string
+		objects []interface{}
+	}{
+		{
+			path: "deploy/crd.yaml",
+			header: `Only v1alpha1 is served, deploy/webhook/crd.yaml serves v1beta1 as well. The
+field descriptions, shown by kubectl explain, are the doc comments of the Go
+types.`,
+			objects: []interface{}{NginxCRD(docs, false)},
+		},
+		{
+			path: "deploy/webhook/crd.yaml",
+			header: `CRD of deploy/crd.yaml serving v1beta1 as well, converted by the operator
+webhooks of deploy/webhook/webhook.yaml. Apply it once they are running.`,
+			objects: []interface{}{NginxCRD(docs, true)},
+		},
+		{
+			path:    "deploy/fleet-crd.yaml",
+			header:  "The field descriptions are the doc comments of the Go types.",
+			objects: []interface{}{FleetStatusCRD(docs)},
+		},
+		{
+			path: "deploy/rbac.yaml",
+			header: `Roles of the operator watching the default namespace, the one it is deployed
+to. The Role grants the namespace rules in that namespace, the ClusterRole
+the cluster rules, both to its default service account. Operators watching
+other namespaces use deploy/rbac-multi-namespace.yaml instead.`,
+			objects: RBAC("default"),
+		},
+		{
+			path: "deploy/rbac-multi-namespace.yaml",
+			header: `Roles of the operator deployed to the default namespace and watching other
+namespaces, like with --watch-namespaces='*'. The ClusterRoles grant the
+namespace rules in every namespace and the cluster rules to its default
+service account.`,
+			objects: MultiNamespaceRBAC("default"),
+		},
+		{
+			path:    "deploy/operator.yaml",
+			objects: []interface{}{OperatorDeployment(image)},
+		},
+	} {
+		data, err := Render(f.header, f.objects...)
+		if err != nil {
+			return nil, err
+		}
+		files[f.path] = data
+	}
+	return files, nil
+}
+
+// Render returns the YAML documents of the objects, after the header
+// comment. Null and empty object fields, like the creation timestamp of
+// Kubernetes objects, are left out.
+func Render(header string, objects ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# Code generated by make manifests. DO NOT EDIT.\n")
+	if header != "" {
+		buf.WriteString("#\n")
+		for _, line := range bytes.Split([]byte(header), []byte("\n")) {
+			buf.WriteString("# ")
+			buf.Write(line)
+			buf.WriteString("\n")
+		}
+	}
+	for i, obj := range objects {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return nil, err
+		}
+		data, err = yaml.Marshal(prune(generic))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("\n---\n\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// prune drops the null and empty object fields of the JSON value
+func prune(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			field = prune(field)
+			if m, ok := field.(map[string]interface{}); field == nil || ok && len(m) == 0 {
+				delete(v, k)
+				continue
+			}
+			v[k] = field
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = prune(v[i])
+		}
+	}
+	return v
+}
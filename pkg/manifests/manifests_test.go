@@ -0,0 +1,50 @@
+package manifests
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRender(t *testing.T) {
+	type object struct {
+		metav1.TypeMeta   `json:",inline"`
+		metav1.ObjectMeta `json:"metadata"`
+		Data              map[string]string `json:"data"`
+	}
+	data, err := Render("First line.\nSecond line.",
+		&object{TypeMeta: metav1.TypeMeta{Kind: "Test"}, ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&object{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Data: map[string]string{"k": "v"}},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, `# Code generated by make manifests. DO NOT EDIT.
+#
+# First line.
+# Second line.
+kind: Test
+metadata:
+  name: a
+
+---
+
+data:
+  k: v
+metadata:
+  name: b
+`, string(data))
+}
+
+// The manifests of deploy/ must be regenerated when the types change
+func TestManifestsUpToDate(t *testing.T) {
+	files, err := Generate("../..", DefaultImage)
+	assert.Nil(t, err)
+	assert.Len(t, files, 6)
+	for path, data := range files {
+		current, err := ioutil.ReadFile(filepath.Join("../..", path))
+		assert.Nil(t, err)
+		assert.Equal(t, string(data), string(current), "%s is out of date, run make manifests", path)
+	}
+}
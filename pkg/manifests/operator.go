@@ -0,0 +1,45 @@
+package manifests
+
+import (
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OperatorDeployment returns the Deployment running the operator with the
+// image, watching the namespace it is deployed to
+func OperatorDeployment(image string) *appv1.Deployment {
+	replicas := int32(1)
+	labels := map[string]string{"name": OperatorName}
+	return &appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: OperatorName},
+		Spec: appv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            OperatorName,
+						Image:           image,
+						Command:         []string{OperatorName},
+						ImagePullPolicy: corev1.PullAlways,
+						Ports: []corev1.ContainerPort{
+							{Name: "metrics", ContainerPort: 8383},
+						},
+						Env: []corev1.EnvVar{{
+							Name: "WATCH_NAMESPACE",
+							ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+							},
+						}},
+					}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package manifests
+
+import (
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OperatorName names the objects the operator runs with
+const OperatorName = "nginx-operator"
+
+// all grants every verb
+var all = []string{"*"}
+
+// readOnly grants the verbs needed to read and watch objects
+var readOnly = []string{"get", "list", "watch"}
+
+// NamespaceRules are the rules of the operator in the namespaces it watches
+var NamespaceRules = []rbacv1beta1.PolicyRule{
+	{APIGroups: []string{"nginx.tsuru.io"}, Resources: []string{"*"}, Verbs: all},
+	{APIGroups: []string{""}, Resources: []string{"pods", "services", "endpoints", "persistentvolumeclaims", "events", "configmaps", "secrets", "serviceaccounts"}, Verbs: all},
+	{APIGroups: []string{""}, Resources: []string{"pods/eviction"}, Verbs: []string{"create"}},
+	{APIGroups: []string{"apps"}, Resources: []string{"deployments", "daemonsets", "replicasets", "statefulsets", "controllerrevisions"}, Verbs: all},
+	{APIGroups: []string{"extensions"}, Resources: []string{"ingresses"}, Verbs: all},
+	{APIGroups: []string{"batch"}, Resources: []string{"jobs"}, Verbs: all},
+	{APIGroups: []string{"policy"}, Resources: []string{"poddisruptionbudgets"}, Verbs: all},
+	{APIGroups: []string{"networking.k8s.io"}, Resources: []string{"networkpolicies"}, Verbs: all},
+	{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles", "rolebindings"}, Verbs: all},
+	{APIGroups: []string{""}, Resources: []string{"limitranges", "resourcequotas"}, Verbs: readOnly},
+	{APIGroups: []string{"autoscaling"}, Resources: []string{"horizontalpodautoscalers"}, Verbs: readOnly},
+	{APIGroups: []string{"argoproj.io"}, Resources: []string{"rollouts"}, Verbs: all},
+	{APIGroups: []string{"flagger.app"}, Resources: []string{"metrictemplates"}, Verbs: all},
+	{APIGroups: []string{"cert-manager.io"}, Resources: []string{"certificates"}, Verbs: all},
+	{APIGroups: []string{"external-secrets.io"}, Resources: []string{"externalsecrets"}, Verbs: all},
+	{APIGroups: []string{"autoscaling.k8s.io"}, Resources: []string{"verticalpodautoscalers"}, Verbs: all},
+	{APIGroups: []string{"monitoring.coreos.com"}, Resources: []string{"servicemonitors", "prometheusrules"}, Verbs: all},
+}
+
+// ClusterRules are the rules of the operator on cluster scoped objects
+var ClusterRules = []rbacv1beta1.PolicyRule{
+	{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get"}},
+	{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get"}},
+	{APIGroups: []string{"scheduling.k8s.io"}, Resources: []string{"priorityclasses"}, Verbs: []string{"get"}},
+	{APIGroups: []string{"nginx.tsuru.io"}, Resources: []string{"nginxfleetstatuses"}, Verbs: []string{"get", "create", "update"}},
+	{
+		APIGroups:     []string{"admissionregistration.k8s.io"},
+		Resources:     []string{"validatingwebhookconfigurations", "mutatingwebhookconfigurations"},
+		ResourceNames: []string{OperatorName},
+		Verbs:         []string{"get", "update"},
+	},
+	{
+		APIGroups:     []string{"apiextensions.k8s.io"},
+		Resources:     []string{"customresourcedefinitions"},
+		ResourceNames: []string{"nginxs.nginx.tsuru.io"},
+		Verbs:         []string{"get", "update"},
+	},
+}
+
+// NamespacesRoleName names the ClusterRole holding the namespace rules when
+// the operator watches several namespaces
+const NamespacesRoleName = OperatorName + "-namespaces"
+
+// RBAC returns the roles of the operator watching the namespace it is
+// deployed to: the namespace rules granted by a Role of that namespace, and
+// the cluster rules, bound to the default service account of the namespace
+func RBAC(namespace string) []interface{} {
+	subjects := []rbacv1beta1.Subject{{Kind: "ServiceAccount", Name: "default"}}
+	return append([]interface{}{
+		&rbacv1beta1.Role{
+			TypeMeta:   rbacTypeMeta("Role"),
+			ObjectMeta: metav1.ObjectMeta{Name: OperatorName},
+			Rules:      NamespaceRules,
+		},
+		&rbacv1beta1.RoleBinding{
+			TypeMeta:   rbacTypeMeta("RoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{Name: "default-account-" + OperatorName},
+			Subjects:   subjects,
+			RoleRef:    rbacv1beta1.RoleRef{Kind: "Role", Name: OperatorName, APIGroup: rbacv1beta1.GroupName},
+		},
+	}, clusterRBAC(namespace)...)
+}
+
+// MultiNamespaceRBAC returns the roles of the operator watching every
+// namespace: the namespace rules are granted cluster-wide by a ClusterRole,
+// bound along with the cluster rules to the default service account of the
+// namespace it is deployed to
+func MultiNamespaceRBAC(namespace string) []interface{} {
+	subjects := []rbacv1beta1.Subject{{Kind: "ServiceAccount", Name: "default", Namespace: namespace}}
+	return append([]interface{}{
+		&rbacv1beta1.ClusterRole{
+			TypeMeta:   rbacTypeMeta("ClusterRole"),
+			ObjectMeta: metav1.ObjectMeta{Name: NamespacesRoleName},
+			Rules:      NamespaceRules,
+		},
+		&rbacv1beta1.ClusterRoleBinding{
+			TypeMeta:   rbacTypeMeta("ClusterRoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{Name: "default-account-" + NamespacesRoleName},
+			Subjects:   subjects,
+			RoleRef:    rbacv1beta1.RoleRef{Kind: "ClusterRole", Name: NamespacesRoleName, APIGroup: rbacv1beta1.GroupName},
+		},
+	}, clusterRBAC(namespace)...)
+}
+
+// clusterRBAC returns the ClusterRole with the cluster rules, bound to the
+// default service account of the namespace
+func clusterRBAC(namespace string) []interface{} {
+	subjects := []rbacv1beta1.Subject{{Kind: "ServiceAccount", Name: "default", Namespace: namespace}}
+	return []interface{}{
+		&rbacv1beta1.ClusterRole{
+			TypeMeta:   rbacTypeMeta("ClusterRole"),
+			ObjectMeta: metav1.ObjectMeta{Name: OperatorName},
+			Rules:      ClusterRules,
+		},
+		&rbacv1beta1.ClusterRoleBinding{
+			TypeMeta:   rbacTypeMeta("ClusterRoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{Name: "default-account-" + OperatorName},
+			Subjects:   subjects,
+			RoleRef:    rbacv1beta1.RoleRef{Kind: "ClusterRole", Name: OperatorName, APIGroup: rbacv1beta1.GroupName},
+		},
+	}
+}
+
+func rbacTypeMeta(kind string) metav1.TypeMeta {
+	return metav1.TypeMeta{Kind: kind, APIVersion: rbacv1beta1.SchemeGroupVersion.String()}
+}
@@ -0,0 +1,42 @@
+package manifests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+)
+
+func TestRBAC(t *testing.T) {
+	objects := RBAC("operators")
+	if assert.Len(t, objects, 4) {
+		role := objects[0].(*rbacv1beta1.Role)
+		assert.Equal(t, NamespaceRules, role.Rules)
+		binding := objects[1].(*rbacv1beta1.RoleBinding)
+		assert.Equal(t, rbacv1beta1.RoleRef{Kind: "Role", Name: OperatorName, APIGroup: rbacv1beta1.GroupName}, binding.RoleRef)
+		clusterBinding := objects[3].(*rbacv1beta1.ClusterRoleBinding)
+		assert.Equal(t, []rbacv1beta1.Subject{{Kind: "ServiceAccount", Name: "default", Namespace: "operators"}}, clusterBinding.Subjects)
+	}
+}
+
+func TestMultiNamespaceRBAC(t *testing.T) {
+	objects := MultiNamespaceRBAC("operators")
+	if !assert.Len(t, objects, 4) {
+		return
+	}
+	for _, obj := range objects {
+		switch obj.(type) {
+		case *rbacv1beta1.Role, *rbacv1beta1.RoleBinding:
+			t.Errorf("unexpected namespaced object %T", obj)
+		}
+	}
+	role := objects[0].(*rbacv1beta1.ClusterRole)
+	assert.Equal(t, NamespacesRoleName, role.Name)
+	assert.Equal(t, NamespaceRules, role.Rules)
+	binding := objects[1].(*rbacv1beta1.ClusterRoleBinding)
+	assert.Equal(t, rbacv1beta1.RoleRef{Kind: "ClusterRole", Name: NamespacesRoleName, APIGroup: rbacv1beta1.GroupName}, binding.RoleRef)
+	assert.Equal(t, []rbacv1beta1.Subject{{Kind: "ServiceAccount", Name: "default", Namespace: "operators"}}, binding.Subjects)
+	clusterRole := objects[2].(*rbacv1beta1.ClusterRole)
+	assert.Equal(t, OperatorName, clusterRole.Name)
+	assert.Equal(t, ClusterRules, clusterRole.Rules)
+}
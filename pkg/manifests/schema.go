@@ -0,0 +1,163 @@
+package manifests
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Schema is an OpenAPI v3 schema of a CustomResourceDefinition, restricted
+// to the structural schemas required for pruning and webhook conversion
+type Schema struct {
+	Type                  string             `json:"type,omitempty"`
+	Format                string             `json:"format,omitempty"`
+	Description           string             `json:"description,omitempty"`
+	Nullable              bool               `json:"nullable,omitempty"`
+	Required              []string           `json:"required,omitempty"`
+	Properties            map[string]*Schema `json:"properties,omitempty"`
+	Items                 *Schema            `json:"items,omitempty"`
+	AdditionalProperties  *Schema            `json:"additionalProperties,omitempty"`
+	AnyOf                 []*Schema          `json:"anyOf,omitempty"`
+	IntOrString           bool               `json:"x-kubernetes-int-or-string,omitempty"`
+	PreserveUnknownFields bool               `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+}
+
+var (
+	quantityType    = reflect.TypeOf(resource.Quantity{})
+	intOrStringType = reflect.TypeOf(intstr.IntOrString{})
+	timeType        = reflect.TypeOf(metav1.Time{})
+	microTimeType   = reflect.TypeOf(metav1.MicroTime{})
+	durationType    = reflect.TypeOf(metav1.Duration{})
+	objectMetaType  = reflect.TypeOf(metav1.ObjectMeta{})
+	listMetaType    = reflect.TypeOf(metav1.ListMeta{})
+	typeMetaType    = reflect.TypeOf(metav1.TypeMeta{})
+)
+
+// ObjectSchema returns the schema of the Kubernetes object type, with the
+// descriptions of the docs. Only the structs found in the docs are expanded,
+// their fields being required when marked +required; other structs preserve
+// their fields as they are. Most required fields are left to the validation
+// of the operator, whose errors name the invalid entries.
+func ObjectSchema(t reflect.Type, docs *Docs) *Schema {
+	g := &schemaGenerator{docs: docs, visiting: make(map[reflect.Type]bool)}
+	s := g.schema(t)
+	s.Description = docs.Descriptions[typeKey(t)]
+	if _, ok := s.Properties["metadata"]; ok {
+		// The API server only accepts constraints on the name and
+		// generateName of the metadata of the objects
+		s.Properties["metadata"] = &Schema{Type: "object"}
+	}
+	return s
+}
+
+type schemaGenerator struct {
+	docs     *Docs
+	visiting map[reflect.Type]bool
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) *Schema {
+	switch t {
+	case quantityType, intOrStringType:
+		return &Schema{
+			AnyOf:       []*Schema{{Type: "integer"}, {Type: "string"}},
+			IntOrString: true,
+		}
+	case timeType, microTimeType:
+		// Zero times are serialized as null
+		return &Schema{Type: "string", Format: "date-time", Nullable: true}
+	case durationType:
+		return &Schema{Type: "string"}
+	case objectMetaType, listMetaType:
+		return &Schema{Type: "object", PreserveUnknownFields: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		// Recursive types cannot be expanded. The Kubernetes types, like the
+		// containers of the pod template, are validated in the objects they
+		// are copied to, keeping the CRD within the size kubectl can apply.
+		if g.visiting[t] || !g.docs.Types[typeKey(t)] {
+			return &Schema{Type: "object", PreserveUnknownFields: true}
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		g.addFields(s, t)
+		sort.Strings(s.Required)
+		return s
+	}
+	return &Schema{PreserveUnknownFields: true}
+}
+
+// addFields adds the serialized fields of the struct to the schema, inlining
+// the embedded structs
+func (g *schemaGenerator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		name, omitEmpty := tag[0], false
+		for _, opt := range tag[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if name == "-" {
+			continue
+		}
+		if f.Type == typeMetaType {
+			s.Properties["apiVersion"] = &Schema{Type: "string", Description: "APIVersion defines the versioned schema of this representation of an object."}
+			s.Properties["kind"] = &Schema{Type: "string", Description: "Kind is a string value representing the REST resource this object represents."}
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addFields(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field := g.schema(f.Type)
+		key := typeKey(t) + "." + f.Name
+		field.Description = g.docs.Descriptions[key]
+		switch f.Type.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			field.Nullable = field.Nullable || !omitEmpty
+		}
+		if g.docs.Required[key] {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = field
+	}
+}
+
+// typeKey returns the key of the type in the docs
+func typeKey(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
@@ -0,0 +1,71 @@
+package manifests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type testObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              testSpec `json:"spec"`
+}
+
+type testSpec struct {
+	Name      string            `json:"name"`
+	Replicas  *int32            `json:"replicas,omitempty"`
+	Labels    map[string]string `json:"labels"`
+	Memory    resource.Quantity `json:"memory,omitempty"`
+	Since     metav1.Time       `json:"since,omitempty"`
+	Container corev1.Container  `json:"container,omitempty"`
+	Children  []testSpec        `json:"children,omitempty"`
+	Data      []byte            `json:"data,omitempty"`
+	Ignored   string            `json:"-"`
+	internal  string
+}
+
+func TestObjectSchema(t *testing.T) {
+	docs := NewDocs()
+	for _, typ := range []reflect.Type{reflect.TypeOf(testObject{}), reflect.TypeOf(testSpec{})} {
+		docs.Types[typeKey(typ)] = true
+	}
+	docs.Descriptions[typeKey(reflect.TypeOf(testObject{}))] = "A test object."
+	docs.Descriptions[typeKey(reflect.TypeOf(testSpec{}))+".Name"] = "Name of the test."
+	docs.Required[typeKey(reflect.TypeOf(testSpec{}))+".Name"] = true
+
+	s := ObjectSchema(reflect.TypeOf(testObject{}), docs)
+	assert.Equal(t, "A test object.", s.Description)
+	assert.Equal(t, "object", s.Type)
+	assert.Len(t, s.Properties, 4)
+	assert.Equal(t, "string", s.Properties["kind"].Type)
+	assert.Equal(t, &Schema{Type: "object"}, s.Properties["metadata"])
+
+	spec := s.Properties["spec"]
+	assert.Equal(t, []string{"name"}, spec.Required)
+	assert.Len(t, spec.Properties, 8)
+	assert.Equal(t, &Schema{Type: "string", Description: "Name of the test."}, spec.Properties["name"])
+	assert.Equal(t, &Schema{Type: "integer", Format: "int32"}, spec.Properties["replicas"])
+	assert.Equal(t, &Schema{Type: "object", Nullable: true, AdditionalProperties: &Schema{Type: "string"}}, spec.Properties["labels"])
+	assert.Equal(t, &Schema{AnyOf: []*Schema{{Type: "integer"}, {Type: "string"}}, IntOrString: true}, spec.Properties["memory"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time", Nullable: true}, spec.Properties["since"])
+	assert.Equal(t, &Schema{Type: "object", PreserveUnknownFields: true}, spec.Properties["container"])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "object", PreserveUnknownFields: true}}, spec.Properties["children"])
+	assert.Equal(t, &Schema{Type: "string", Format: "byte"}, spec.Properties["data"])
+}
+
+func TestDocsParse(t *testing.T) {
+	docs := NewDocs()
+	assert.Nil(t, docs.Parse("github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1", "../apis/nginx/v1alpha1"))
+	assert.True(t, docs.Types["github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1.NginxSpec"])
+	assert.NotEmpty(t, docs.Descriptions["github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1.Nginx"])
+	assert.NotEmpty(t, docs.Descriptions["github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1.NginxSpec.Replicas"])
+	for key, description := range docs.Descriptions {
+		assert.NotContains(t, description, "+k8s:", "%s has a marker", key)
+		assert.NotContains(t, description, "\n", "%s is not joined", key)
+	}
+}
@@ -0,0 +1,247 @@
+// Package metrics implements the operator metrics, exposed in the Prometheus
+// text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultRegistry is the registry exposed by Handler
+var DefaultRegistry = NewRegistry()
+
+// Collector writes samples in the Prometheus text format
+type Collector interface {
+	Collect(w io.Writer)
+}
+
+// Registry holds the collectors exposed by the metrics endpoint
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// MustRegister adds the collectors to the registry
+func (r *Registry) MustRegister(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, cs...)
+}
+
+// Write writes all the registered collectors
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+}
+
+// Handler returns the http handler exposing the metrics of the default registry
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		DefaultRegistry.Write(w)
+	})
+}
+
+// vec is a set of samples of the same metric identified by their label values
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{name: name, help: help, typ: typ, labels: labels, values: make(map[string]float64)}
+}
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[v.key(labelValues)] += delta
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[v.key(labelValues)] = value
+}
+
+func (v *vec) delete(labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.values, v.key(labelValues))
+}
+
+// Collect implements Collector
+func (v *vec) Collect(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	writeHeader(w, v.name, v.help, v.typ)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var labelValues []string
+		if len(v.labels) > 0 {
+			labelValues = strings.Split(k, "\xff")
+		}
+		writeSample(w, v.name, v.labels, labelValues, v.values[k])
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec creates a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels)}
+}
+
+// Inc increments the counter identified by the label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec creates a gauge with the given label names
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labels)}
+}
+
+// Set sets the gauge identified by the label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+// Add adds the delta, possibly negative, to the gauge identified by the
+// label values
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.add(delta, labelValues)
+}
+
+// Delete removes the gauge identified by the label values
+func (g *GaugeVec) Delete(labelValues ...string) {
+	g.delete(labelValues)
+}
+
+// DefBuckets are the default histogram buckets, in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []float64
+	sum    float64
+	count  float64
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+// NewHistogramVec creates a histogram with the given upper bounds, which
+// must be sorted, and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+}
+
+// Observe adds a sample to the histogram identified by the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", h.name, len(h.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]float64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += value
+	hist.count++
+}
+
+// Collect implements Collector
+func (h *HistogramVec) Collect(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, k := range keys {
+		var labelValues []string
+		if len(h.labels) > 0 {
+			labelValues = strings.Split(k, "\xff")
+		}
+		hist := h.values[k]
+		for i, upper := range h.buckets {
+			writeSample(w, h.name+"_bucket", bucketLabels, append(append([]string(nil), labelValues...), fmt.Sprint(upper)), hist.counts[i])
+		}
+		writeSample(w, h.name+"_bucket", bucketLabels, append(append([]string(nil), labelValues...), "+Inf"), hist.count)
+		writeSample(w, h.name+"_sum", h.labels, labelValues, hist.sum)
+		writeSample(w, h.name+"_count", h.labels, labelValues, hist.count)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues []string, value float64) {
+	fmt.Fprint(w, name)
+	if len(labels) > 0 {
+		pairs := make([]string, len(labels))
+		for i := range labels {
+			pairs[i] = fmt.Sprintf("%s=%q", labels[i], labelValues[i])
+		}
+		fmt.Fprintf(w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(w, " %v\n", value)
+}
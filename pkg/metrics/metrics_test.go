@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	counter := NewCounterVec("my_counter_total", "A counter.", "kind")
+	gauge := NewGaugeVec("my_gauge", "A gauge.")
+	r.MustRegister(counter, gauge)
+
+	counter.Inc("b")
+	counter.Inc("a")
+	counter.Inc("a")
+	gauge.Set(1.5)
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	assert.Equal(t, `# HELP my_counter_total A counter.
+# TYPE my_counter_total counter
+my_counter_total{kind="a"} 2
+my_counter_total{kind="b"} 1
+# HELP my_gauge A gauge.
+# TYPE my_gauge gauge
+my_gauge 1.5
+`, buf.String())
+
+	gauge.Delete()
+	buf.Reset()
+	r.Write(&buf)
+	assert.NotContains(t, buf.String(), "my_gauge 1.5")
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("my_duration_seconds", "A histogram.", []float64{0.1, 1}, "kind")
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(2, "a")
+
+	var buf bytes.Buffer
+	h.Collect(&buf)
+	assert.Equal(t, `# HELP my_duration_seconds A histogram.
+# TYPE my_duration_seconds histogram
+my_duration_seconds_bucket{kind="a",le="0.1"} 1
+my_duration_seconds_bucket{kind="a",le="1"} 2
+my_duration_seconds_bucket{kind="a",le="+Inf"} 3
+my_duration_seconds_sum{kind="a"} 2.55
+my_duration_seconds_count{kind="a"} 3
+`, buf.String())
+}
+
+func TestStalenessTracker(t *testing.T) {
+	now := time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := NewStalenessTracker(time.Minute)
+	s.now = func() time.Time { return now }
+
+	s.Observe("default", "fresh")
+	s.Observe("default", "stuck")
+	now = now.Add(2 * time.Minute)
+	s.Success("default", "fresh")
+	s.Observe("default", "fresh")
+
+	assert.False(t, s.IsStale("default", "fresh"))
+	assert.True(t, s.IsStale("default", "stuck"))
+	assert.False(t, s.IsStale("default", "unknown"))
+
+	var buf bytes.Buffer
+	s.Collect(&buf)
+	assert.Contains(t, buf.String(), `nginx_operator_reconcile_staleness_seconds{namespace="default",name="stuck"} 120`)
+	assert.Contains(t, buf.String(), `nginx_operator_reconcile_stale{namespace="default",name="fresh"} 0`)
+	assert.Contains(t, buf.String(), `nginx_operator_reconcile_stale{namespace="default",name="stuck"} 1`)
+	assert.Contains(t, buf.String(), "nginx_operator_reconcile_staleness_threshold_seconds 60")
+
+	s.Forget("default", "stuck")
+	assert.False(t, s.IsStale("default", "stuck"))
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Body.String(), "nginx_operator_reconcile_staleness_threshold_seconds")
+
+	ObserveReconcile(ReconcileError, 2*time.Second)
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `nginx_operator_reconcile_total{result="error"} 1`)
+	assert.Contains(t, rec.Body.String(), `nginx_operator_reconcile_duration_seconds_bucket{le="2.5"} 1`)
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	q := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test-queue")
+	defer q.ShutDown()
+	q.Add("a")
+	q.Add("b")
+	item, _ := q.Get()
+	q.Done(item)
+	q.AddRateLimited("c")
+
+	var buf bytes.Buffer
+	DefaultRegistry.Write(&buf)
+	assert.Contains(t, buf.String(), `nginx_operator_workqueue_depth{name="test-queue"} 1`)
+	assert.Contains(t, buf.String(), `nginx_operator_workqueue_adds_total{name="test-queue"} 2`)
+	assert.Contains(t, buf.String(), `nginx_operator_workqueue_queue_duration_seconds_count{name="test-queue"} 1`)
+	assert.Contains(t, buf.String(), `nginx_operator_workqueue_work_duration_seconds_count{name="test-queue"} 1`)
+	assert.Contains(t, buf.String(), `nginx_operator_workqueue_retries_total{name="test-queue"} 1`)
+}
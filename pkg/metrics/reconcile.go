@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Results of a reconcile
+const (
+	ReconcileSuccess = "success"
+	ReconcileError   = "error"
+	ReconcileBlocked = "blocked"
+)
+
+var (
+	reconcileTotal = NewCounterVec("nginx_operator_reconcile_total",
+		"Reconciles of nginx instances, by result.", "result")
+	reconcileDuration = NewHistogramVec("nginx_operator_reconcile_duration_seconds",
+		"Time taken to reconcile a nginx instance.", DefBuckets)
+)
+
+func init() {
+	DefaultRegistry.MustRegister(reconcileTotal, reconcileDuration)
+}
+
+// ObserveReconcile records a reconcile with the given result and duration
+func ObserveReconcile(result string, duration time.Duration) {
+	reconcileTotal.Inc(result)
+	reconcileDuration.Observe(duration.Seconds())
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultStalenessThreshold is the time without a successful reconcile after
+// which an instance is considered stale
+const DefaultStalenessThreshold = 5 * time.Minute
+
+// Staleness tracks the last successful reconcile of every instance handled by
+// the operator. It is registered in the default registry.
+var Staleness = NewStalenessTracker(DefaultStalenessThreshold)
+
+func init() {
+	DefaultRegistry.MustRegister(Staleness)
+}
+
+type instance struct {
+	namespace string
+	name      string
+}
+
+// StalenessTracker exposes, for every instance, the seconds elapsed since its
+// last successful reconcile and whether it exceeds the alert threshold.
+type StalenessTracker struct {
+	mu          sync.Mutex
+	threshold   time.Duration
+	lastSuccess map[instance]time.Time
+	now         func() time.Time
+}
+
+// NewStalenessTracker creates a tracker using the given alert threshold
+func NewStalenessTracker(threshold time.Duration) *StalenessTracker {
+	return &StalenessTracker{
+		threshold:   threshold,
+		lastSuccess: make(map[instance]time.Time),
+		now:         time.Now,
+	}
+}
+
+// SetThreshold changes the alert threshold
+func (s *StalenessTracker) SetThreshold(threshold time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.threshold = threshold
+}
+
+// Observe starts tracking the instance, if not tracked yet. The time of the
+// first observation counts as the last success, so instances that never
+// reconcile successfully become stale as well.
+func (s *StalenessTracker) Observe(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := instance{namespace: namespace, name: name}
+	if _, ok := s.lastSuccess[key]; !ok {
+		s.lastSuccess[key] = s.now()
+	}
+}
+
+// Success records a successful reconcile of the instance
+func (s *StalenessTracker) Success(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSuccess[instance{namespace: namespace, name: name}] = s.now()
+}
+
+// Forget stops tracking the instance
+func (s *StalenessTracker) Forget(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.lastSuccess, instance{namespace: namespace, name: name})
+}
+
+// IsStale returns whether the instance last successful reconcile is older
+// than the alert threshold
+func (s *StalenessTracker) IsStale(namespace, name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.lastSuccess[instance{namespace: namespace, name: name}]
+	return ok && s.now().Sub(last) > s.threshold
+}
+
+// Collect implements Collector
+func (s *StalenessTracker) Collect(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]instance, 0, len(s.lastSuccess))
+	for k := range s.lastSuccess {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	labels := []string{"namespace", "name"}
+	now := s.now()
+	writeHeader(w, "nginx_operator_reconcile_staleness_seconds", "Seconds since the last successful reconcile of the instance.", "gauge")
+	for _, k := range keys {
+		writeSample(w, "nginx_operator_reconcile_staleness_seconds", labels, []string{k.namespace, k.name}, now.Sub(s.lastSuccess[k]).Seconds())
+	}
+	writeHeader(w, "nginx_operator_reconcile_stale", "Whether the instance has not been successfully reconciled within the alert threshold.", "gauge")
+	for _, k := range keys {
+		stale := 0
+		if now.Sub(s.lastSuccess[k]) > s.threshold {
+			stale = 1
+		}
+		writeSample(w, "nginx_operator_reconcile_stale", labels, []string{k.namespace, k.name}, float64(stale))
+	}
+	writeHeader(w, "nginx_operator_reconcile_staleness_threshold_seconds", "Staleness alert threshold configured in the operator.", "gauge")
+	writeSample(w, "nginx_operator_reconcile_staleness_threshold_seconds", nil, nil, s.threshold.Seconds())
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// queueBuckets are the buckets of the workqueue durations, in seconds. Items
+// may wait for the rate limiter for a while on large fleets.
+var queueBuckets = []float64{.001, .01, .1, .5, 1, 5, 10, 30, 60, 300}
+
+var (
+	workqueueDepth = NewGaugeVec("nginx_operator_workqueue_depth",
+		"Objects waiting in the workqueue to be handled.", "name")
+	workqueueAdds = NewCounterVec("nginx_operator_workqueue_adds_total",
+		"Objects added to the workqueue.", "name")
+	workqueueLatency = NewHistogramVec("nginx_operator_workqueue_queue_duration_seconds",
+		"Time objects wait in the workqueue before being handled.", queueBuckets, "name")
+	workqueueWorkDuration = NewHistogramVec("nginx_operator_workqueue_work_duration_seconds",
+		"Time taken to handle an object of the workqueue.", queueBuckets, "name")
+	workqueueRetries = NewCounterVec("nginx_operator_workqueue_retries_total",
+		"Objects added back to the workqueue after failing.", "name")
+)
+
+func init() {
+	DefaultRegistry.MustRegister(workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration, workqueueRetries)
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider exports the metrics of the client-go workqueues,
+// labeled by the queue name
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return gauge{vec: workqueueDepth, name: name}
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return counter{vec: workqueueAdds, name: name}
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return microseconds{vec: workqueueLatency, name: name}
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return microseconds{vec: workqueueWorkDuration, name: name}
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return counter{vec: workqueueRetries, name: name}
+}
+
+type gauge struct {
+	vec  *GaugeVec
+	name string
+}
+
+func (g gauge) Inc() { g.vec.Add(1, g.name) }
+func (g gauge) Dec() { g.vec.Add(-1, g.name) }
+
+type counter struct {
+	vec  *CounterVec
+	name string
+}
+
+func (c counter) Inc() { c.vec.Inc(c.name) }
+
+// microseconds records the durations observed by the workqueues, in
+// microseconds, in seconds
+type microseconds struct {
+	vec  *HistogramVec
+	name string
+}
+
+func (m microseconds) Observe(value float64) {
+	m.vec.Observe((time.Duration(value) * time.Microsecond).Seconds(), m.name)
+}
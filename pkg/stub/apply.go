@@ -0,0 +1,221 @@
+package stub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// checkApply holds the changes to the spec with the Manual apply mode until
+// they are approved. The objects the spec would change are summarized in
+// status.pendingApply and a reconcileBlockedError is returned meanwhile.
+// Specs that change no object are applied right away.
+func checkApply(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	if nginx.Spec.ApplyMode != v1alpha1.ApplyModeManual {
+		nginx.Status.PendingApply = nil
+		nginx.Status.AppliedRevision = ""
+		return nil
+	}
+	revision, err := k8s.ApplyRevision(&nginx.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to compute apply revision: %v", err)
+	}
+	if nginx.Status.AppliedRevision == revision {
+		nginx.Status.PendingApply = nil
+		return nil
+	}
+	if k8s.ApplyApproved(nginx, revision) {
+		nginx.Status.AppliedRevision = revision
+		nginx.Status.PendingApply = nil
+		recordEvent(nginx, corev1.EventTypeNormal, "ApplyApproved", fmt.Sprintf("Applying the approved revision %s", revision), logger)
+		return nil
+	}
+
+	changes, err := planChanges(nginx)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		nginx.Status.AppliedRevision = revision
+		nginx.Status.PendingApply = nil
+		return nil
+	}
+	if pending := nginx.Status.PendingApply; pending != nil && pending.Revision == revision {
+		pending.Changes = changes
+	} else {
+		nginx.Status.PendingApply = &v1alpha1.NginxPendingApply{
+			Revision: revision,
+			Changes:  changes,
+			Time:     metav1.Now(),
+		}
+		recordEvent(nginx, corev1.EventTypeNormal, "ApplyPending",
+			fmt.Sprintf("Revision %s waits for approval through the %s annotation: %s", revision, k8s.ApproveApplyAnnotation, strings.Join(changes, "; ")), logger)
+	}
+	return &reconcileBlockedError{reason: fmt.Sprintf("revision %s waits for approval", revision)}
+}
+
+// planChanges returns the changes applying the spec makes to the workload,
+// the service, the ingress and the pod disruption budget of the nginx
+func planChanges(nginx *v1alpha1.Nginx) ([]string, error) {
+	var changes []string
+	plan := func(key sdk.Object, desired runtime.Object) error {
+		kind, name := key.GetObjectKind().GroupVersionKind().Kind, key.(metav1.Object).GetName()
+		current, err := currentObject(key)
+		if err != nil {
+			return err
+		}
+		if c := k8s.PlannedChange(kind, name, desired, current); c != "" {
+			changes = append(changes, c)
+		}
+		return nil
+	}
+
+	kind := nginx.Spec.WorkloadKind
+	if kind == v1alpha1.WorkloadKindRollout {
+		change, err := planRollout(nginx)
+		if isResourceUnavailable(err) {
+			kind = v1alpha1.WorkloadKindDeployment
+		} else if err != nil {
+			return nil, err
+		} else if change != "" {
+			changes = append(changes, change)
+		}
+	}
+	var (
+		desired runtime.Object
+		key     sdk.Object
+		err     error
+	)
+	switch kind {
+	case v1alpha1.WorkloadKindRollout:
+	case v1alpha1.WorkloadKindStatefulSet:
+		var sts *appv1.StatefulSet
+		sts, err = k8s.NewStatefulSet(nginx)
+		desired, key = sts, &appv1.StatefulSet{}
+	case v1alpha1.WorkloadKindDaemonSet:
+		var ds *appv1.DaemonSet
+		ds, err = k8s.NewDaemonSet(nginx)
+		desired, key = ds, &appv1.DaemonSet{}
+	default:
+		kind = v1alpha1.WorkloadKindDeployment
+		var dep *appv1.Deployment
+		dep, err = k8s.NewDeployment(nginx)
+		desired, key = dep, &appv1.Deployment{}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble %s from nginx: %v", kind, err)
+	}
+	if desired != nil {
+		setKey(key, desired)
+		if err := plan(key, desired); err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range replacedWorkloads(nginx, kind) {
+		if err := plan(w.object, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	service := k8s.NewService(nginx)
+	key = &corev1.Service{}
+	setKey(key, service)
+	if err := plan(key, service); err != nil {
+		return nil, err
+	}
+
+	key = &extv1beta1.Ingress{
+		TypeMeta:   metav1.TypeMeta{Kind: "Ingress", APIVersion: "extensions/v1beta1"},
+		ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-ingress", Namespace: nginx.Namespace},
+	}
+	desired = nil
+	if ingress := k8s.NewIngress(nginx); ingress != nil {
+		desired = ingress
+	}
+	if err := plan(key, desired); err != nil {
+		return nil, err
+	}
+
+	key = &policyv1beta1.PodDisruptionBudget{
+		TypeMeta:   metav1.TypeMeta{Kind: "PodDisruptionBudget", APIVersion: "policy/v1beta1"},
+		ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-pdb", Namespace: nginx.Namespace},
+	}
+	desired = nil
+	if pdb := k8s.NewPodDisruptionBudget(nginx); pdb != nil {
+		desired = pdb
+	}
+	if err := plan(key, desired); err != nil {
+		return nil, err
+	}
+
+	key = &networkingv1.NetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{Kind: "NetworkPolicy", APIVersion: "networking.k8s.io/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-network-policy", Namespace: nginx.Namespace},
+	}
+	desired = nil
+	if policy := k8s.NewNetworkPolicy(nginx); policy != nil {
+		desired = policy
+	}
+	if err := plan(key, desired); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// planRollout returns the change applying the spec makes to the rollout of
+// the nginx, or a resourceUnavailableError when rollouts are not served
+func planRollout(nginx *v1alpha1.Nginx) (string, error) {
+	client, _, err := k8sclient.GetResourceClient(k8s.RolloutAPIVersion, k8s.RolloutKind, nginx.Namespace)
+	if err != nil {
+		return "", &resourceUnavailableError{apiVersion: k8s.RolloutAPIVersion, kind: k8s.RolloutKind}
+	}
+	desired, err := k8s.NewRollout(nginx)
+	if err != nil {
+		return "", fmt.Errorf("failed to assemble rollout from nginx: %v", err)
+	}
+	current, err := client.Get(desired.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return k8s.PlannedChange(k8s.RolloutKind, desired.GetName(), desired, nil), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve rollout: %v", err)
+	}
+	return k8s.PlannedChange(k8s.RolloutKind, desired.GetName(), desired, current), nil
+}
+
+// setKey sets the kind, name and namespace of the desired object in the key
+// used to retrieve the current one
+func setKey(key sdk.Object, desired runtime.Object) {
+	meta := desired.(metav1.Object)
+	key.(metav1.Object).SetName(meta.GetName())
+	key.(metav1.Object).SetNamespace(meta.GetNamespace())
+	key.GetObjectKind().SetGroupVersionKind(desired.GetObjectKind().GroupVersionKind())
+}
+
+// currentObject retrieves the object identified by the key, returning nil
+// when it does not exist
+func currentObject(key sdk.Object) (runtime.Object, error) {
+	err := sdk.Get(key)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		kind := key.GetObjectKind().GroupVersionKind().Kind
+		return nil, fmt.Errorf("failed to retrieve %s: %v", strings.ToLower(kind), err)
+	}
+	return key, nil
+}
@@ -0,0 +1,158 @@
+package stub
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// canaryCheckClient sends the canary checks. Redirects are not followed, so
+// they can be expected.
+var canaryCheckClient = &http.Client{
+	Timeout: 5 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// checkCanary starts the canary pods with the new pod template of the given
+// deployment, returning a reconcileBlockedError until they are ready and pass
+// the canary check, or when they fail. The result is reported in the
+// CanaryVerified condition.
+func checkCanary(nginx *v1alpha1.Nginx, deployment *appv1.Deployment, logger *logrus.Entry) error {
+	if nginx.Spec.Rollout == nil || nginx.Spec.Rollout.CanaryPods == 0 {
+		return nil
+	}
+
+	pods, err := k8s.NewCanaryPods(nginx, deployment)
+	if err != nil {
+		return fmt.Errorf("failed to assemble canary pods: %v", err)
+	}
+	var names []string
+	created := false
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+		err := createWorkload(nginx, pod)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create canary pod: %v", err)
+		}
+		created = created || err == nil
+	}
+	if created {
+		if err := deleteCanaryPods(nginx, names...); err != nil {
+			logger.Warnf("failed to delete stale canary pods: %v", err)
+		}
+		recordEvent(nginx, corev1.EventTypeNormal, "CanaryStarted",
+			fmt.Sprintf("Started canary pods %s before rolling out the new pod template", strings.Join(names, ", ")), logger)
+		nginx.Status.SetCondition(v1alpha1.NginxCondition{
+			Type:    v1alpha1.NginxConditionCanaryVerified,
+			Status:  corev1.ConditionUnknown,
+			Reason:  "Starting",
+			Message: fmt.Sprintf("Waiting for canary pods %s", strings.Join(names, ", ")),
+		})
+		return &reconcileBlockedError{reason: "waiting for canary pods"}
+	}
+
+	check := nginx.Spec.WithDefaults().Rollout.CanaryCheck
+	for _, pod := range pods {
+		if err := sdk.Get(pod); err != nil {
+			return fmt.Errorf("failed to retrieve canary pod: %v", err)
+		}
+		if failure := k8s.CanaryPodFailure(pod); failure != "" {
+			return canaryFailed(nginx, "PodFailed", failure, logger)
+		}
+		if !k8s.CanaryPodReady(pod) {
+			return &reconcileBlockedError{reason: "waiting for canary pods"}
+		}
+		if check == nil {
+			continue
+		}
+		if failure := runCanaryCheck(pod, check); failure != "" {
+			return canaryFailed(nginx, "CheckFailed", failure, logger)
+		}
+	}
+
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{
+		Type:   v1alpha1.NginxConditionCanaryVerified,
+		Status: corev1.ConditionTrue,
+		Reason: "Verified",
+	})
+	return nil
+}
+
+// runCanaryCheck sends the canary check to the pod, returning why it failed
+// or an empty string
+func runCanaryCheck(pod *corev1.Pod, check *v1alpha1.CanaryCheck) string {
+	req, err := http.NewRequest(http.MethodGet, k8s.CanaryCheckURL(pod, check), nil)
+	if err != nil {
+		return fmt.Sprintf("invalid canary check: %v", err)
+	}
+	req.Host = check.Host
+	resp, err := canaryCheckClient.Do(req)
+	if err != nil {
+		return fmt.Sprintf("canary check of pod %s failed: %v", pod.Name, err)
+	}
+	resp.Body.Close()
+	if int32(resp.StatusCode) != check.ExpectedStatus {
+		return fmt.Sprintf("canary check of pod %s returned status %d, expected %d", pod.Name, resp.StatusCode, check.ExpectedStatus)
+	}
+	return ""
+}
+
+// canaryFailed reports the failure of the canary pods, which are kept for
+// inspection until the pod template changes again
+func canaryFailed(nginx *v1alpha1.Nginx, reason, failure string, logger *logrus.Entry) error {
+	msg := fmt.Sprintf("Canary failed, the new pod template was not rolled out: %s", failure)
+	if c := nginx.Status.GetCondition(v1alpha1.NginxConditionCanaryVerified); c == nil || c.Status != corev1.ConditionFalse {
+		recordEvent(nginx, corev1.EventTypeWarning, "CanaryFailed", msg, logger)
+	}
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionCanaryVerified,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: msg,
+	})
+	return &reconcileBlockedError{reason: "canary failed, refusing to roll out"}
+}
+
+// deleteCanaryPods removes the canary pods of the nginx other than the given
+// ones
+func deleteCanaryPods(nginx *v1alpha1.Nginx, keep ...string) error {
+	podList := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(k8s.LabelsForCanary(nginx.Name)).String()
+	if err := sdk.List(nginx.Namespace, podList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return err
+	}
+	kept := make(map[string]bool)
+	for _, name := range keep {
+		kept[name] = true
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if kept[pod.Name] {
+			continue
+		}
+		pod.TypeMeta = metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"}
+		if err := sdk.Delete(pod); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
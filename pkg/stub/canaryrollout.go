@@ -0,0 +1,249 @@
+package stub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// rolloutCanary rolls out the new pod template of the deployment through the
+// canary deployment, following the steps of spec.rollout.canary. It returns
+// nil once all the steps are done and the deployment can be updated with the
+// new pod template, and a reconcileBlockedError until then or when the
+// canary failed and was rolled back.
+func rolloutCanary(nginx *v1alpha1.Nginx, newDeploy, currDeploy *appv1.Deployment, logger *logrus.Entry) error {
+	hash, _ := k8s.GeneratedHashOf(newDeploy)
+	promote := nginx.Annotations[k8s.PromoteCanaryAnnotation]
+	status := nginx.Status.Canary
+	if status == nil || status.TemplateHash != hash.Template {
+		status = &v1alpha1.NginxCanaryStatus{
+			TemplateHash:   hash.Template,
+			Phase:          v1alpha1.NginxCanaryProgressing,
+			PromoteRequest: promote,
+		}
+		nginx.Status.Canary = status
+		recordEvent(nginx, corev1.EventTypeNormal, "CanaryRolloutStarted",
+			fmt.Sprintf("Rolling out the new pod template of deployment %s through a canary deployment", currDeploy.Name), logger)
+	}
+	switch status.Phase {
+	case v1alpha1.NginxCanaryFailed:
+		return &reconcileBlockedError{reason: "canary failed, refusing to roll out"}
+	case v1alpha1.NginxCanaryPromoting:
+		return nil
+	}
+
+	steps := nginx.Spec.Rollout.Canary.Steps
+	replicas := deploymentReplicas(newDeploy)
+	for int(status.Step) < len(steps) {
+		step := steps[status.Step]
+		weight := k8s.CanaryStepWeight(steps, int(status.Step))
+		canaryReplicas, stableReplicas := k8s.CanaryReplicas(replicas, weight)
+		canary, err := scaleCanaryDeployment(nginx, newDeploy, canaryReplicas)
+		if err != nil {
+			return err
+		}
+		status.Weight = weight
+
+		pods, err := listDeploymentPods(canary)
+		if err != nil {
+			return fmt.Errorf("failed to list canary pods: %v", err)
+		}
+		if failure := k8s.DeploymentFailure(canary, pods); failure != "" {
+			return rollbackCanary(nginx, currDeploy, replicas, failure, logger)
+		}
+		if !k8s.DeploymentRolledOut(canary) {
+			status.Phase = v1alpha1.NginxCanaryProgressing
+			status.Message = fmt.Sprintf("Waiting for %d canary pods at weight %d", canaryReplicas, weight)
+			return &reconcileBlockedError{reason: "waiting for canary deployment"}
+		}
+		// The stable pods are only removed once the canary pods replacing
+		// them are available
+		if err := scaleDeployment(nginx, currDeploy, stableReplicas); err != nil {
+			return err
+		}
+
+		if pause := step.Pause; pause != nil {
+			if status.PauseStartTime == nil {
+				now := metav1.Now()
+				status.PauseStartTime = &now
+			}
+			switch {
+			case *pause == 0 && promote == status.PromoteRequest:
+				status.Phase = v1alpha1.NginxCanaryPaused
+				status.Message = fmt.Sprintf("Paused at step %d until the %s annotation changes", status.Step, k8s.PromoteCanaryAnnotation)
+				return &reconcileBlockedError{reason: "canary paused"}
+			case *pause > 0 && time.Since(status.PauseStartTime.Time) < time.Duration(*pause)*time.Second:
+				status.Phase = v1alpha1.NginxCanaryPaused
+				status.Message = fmt.Sprintf("Paused at step %d for %ds", status.Step, *pause)
+				return &reconcileBlockedError{reason: "canary paused"}
+			}
+		}
+
+		logger.Infof("canary step %d done at weight %d", status.Step, weight)
+		status.Step++
+		status.PauseStartTime = nil
+		status.PromoteRequest = promote
+	}
+
+	status.Phase = v1alpha1.NginxCanaryPromoting
+	status.Message = fmt.Sprintf("Rolling out the new pod template to deployment %s", currDeploy.Name)
+	return nil
+}
+
+// completeCanary removes the canary deployment once the deployment rolled
+// out the pod template promoted from it, or when its rollout was abandoned
+// because the pod template changed back or spec.rollout.canary was removed.
+// The replicas taken by the canary are given back to the deployment.
+func completeCanary(nginx *v1alpha1.Nginx, newDeploy, currDeploy *appv1.Deployment, currHash k8s.GeneratedHash, logger *logrus.Entry) error {
+	status := nginx.Status.Canary
+	if status == nil {
+		return nil
+	}
+	enabled := k8s.CanaryRolloutEnabled(nginx)
+	newHash, _ := k8s.GeneratedHashOf(newDeploy)
+	if enabled && newHash.Template != currHash.Template {
+		return nil
+	}
+	promoted := status.Phase == v1alpha1.NginxCanaryPromoting && status.TemplateHash == currHash.Template
+	if promoted && !k8s.DeploymentRolledOut(currDeploy) {
+		return nil
+	}
+
+	if err := deleteCanaryDeployment(nginx); err != nil {
+		return err
+	}
+	nginx.Status.Canary = nil
+	if promoted {
+		recordEvent(nginx, corev1.EventTypeNormal, "CanaryPromoted",
+			fmt.Sprintf("Promoted the canary pod template to deployment %s", currDeploy.Name), logger)
+		return nil
+	}
+	if newHash.Template == currHash.Template {
+		if err := scaleDeployment(nginx, currDeploy, deploymentReplicas(newDeploy)); err != nil {
+			return err
+		}
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, "CanaryAborted",
+		fmt.Sprintf("Stopped the canary rollout of deployment %s, the pod template changed", currDeploy.Name), logger)
+	return nil
+}
+
+// rollbackCanary removes the failed canary deployment and scales the
+// deployment back to all the replicas. The failure is kept in the canary
+// status until the pod template changes again.
+func rollbackCanary(nginx *v1alpha1.Nginx, currDeploy *appv1.Deployment, replicas int32, failure string, logger *logrus.Entry) error {
+	if err := deleteCanaryDeployment(nginx); err != nil {
+		return err
+	}
+	if err := scaleDeployment(nginx, currDeploy, replicas); err != nil {
+		return err
+	}
+	status := nginx.Status.Canary
+	status.Phase = v1alpha1.NginxCanaryFailed
+	status.Message = failure
+	recordEvent(nginx, corev1.EventTypeWarning, "CanaryRolledBack",
+		fmt.Sprintf("Canary failed, deployment %s was rolled back to the current pod template: %s", currDeploy.Name, failure), logger)
+	return &reconcileBlockedError{reason: "canary failed, refusing to roll out"}
+}
+
+// scaleCanaryDeployment creates or updates the canary deployment with the
+// pod template of the given deployment and the given replicas
+func scaleCanaryDeployment(nginx *v1alpha1.Nginx, deployment *appv1.Deployment, replicas int32) (*appv1.Deployment, error) {
+	desired := k8s.NewCanaryDeployment(nginx, deployment, replicas)
+	canary := &appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      desired.Name,
+			Namespace: desired.Namespace,
+		},
+	}
+	err := sdk.Get(canary)
+	if errors.IsNotFound(err) {
+		if err := createWorkload(nginx, desired); err != nil {
+			return nil, fmt.Errorf("failed to create canary deployment: %v", err)
+		}
+		return desired, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve canary deployment: %v", err)
+	}
+
+	currHash, _ := k8s.GeneratedHashOf(canary)
+	desiredHash, _ := k8s.GeneratedHashOf(desired)
+	if currHash == desiredHash && deploymentReplicas(canary) == replicas {
+		return canary, nil
+	}
+	canary.Spec = desired.Spec
+	k8s.CopyGeneratedHash(canary, desired)
+	if err := updateWorkload(nginx, canary); err != nil {
+		return nil, fmt.Errorf("failed to update canary deployment: %v", err)
+	}
+	return canary, nil
+}
+
+// scaleDeployment updates the replicas of the deployment, keeping the rest
+// of its spec
+func scaleDeployment(nginx *v1alpha1.Nginx, deployment *appv1.Deployment, replicas int32) error {
+	if deploymentReplicas(deployment) == replicas {
+		return nil
+	}
+	deployment.Spec.Replicas = &replicas
+	if err := updateWorkload(nginx, deployment); err != nil {
+		return fmt.Errorf("failed to scale deployment: %v", err)
+	}
+	return nil
+}
+
+// deleteCanaryDeployment removes the canary deployment of the nginx, if any
+func deleteCanaryDeployment(nginx *v1alpha1.Nginx) error {
+	deploy := &appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-canary-deployment",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(deploy, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete canary deployment: %v", err)
+	}
+	return nil
+}
+
+// listDeploymentPods returns the pods selected by the deployment
+func listDeploymentPods(deployment *appv1.Deployment) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels).String()
+	if err := sdk.List(deployment.Namespace, podList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return nil, err
+	}
+	return podList.Items, nil
+}
+
+func deploymentReplicas(deployment *appv1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
@@ -0,0 +1,175 @@
+package stub
+
+import (
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/assert"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// canaryNginx returns an nginx with 4 replicas rolling out its pod template
+// changes through a canary at half of the replicas, paused until promoted
+func canaryNginx() *v1alpha1.Nginx {
+	replicas, weight, pause := int32(4), int32(50), int32(0)
+	return &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image:    "nginx:1.15",
+		Replicas: &replicas,
+		Rollout: &v1alpha1.NginxRollout{Canary: &v1alpha1.CanaryStrategy{
+			Steps: []v1alpha1.CanaryStep{{Weight: &weight, Pause: &pause}},
+		}},
+	}}
+}
+
+// storedWorkload returns the deployment with the given name as stored in the
+// fake API, or nil if it does not exist
+func storedWorkload(t *testing.T, name string) *appv1.Deployment {
+	dep := &appv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+	}
+	err := sdk.Get(dep)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	assert.Nil(t, err)
+	return dep
+}
+
+// rollOut reports all the replicas of the deployment as updated and
+// available, like the deployment controller once the rollout is done
+func rollOut(t *testing.T, name string) {
+	dep := storedWorkload(t, name)
+	if !assert.NotNil(t, dep, name) {
+		return
+	}
+	replicas := deploymentReplicas(dep)
+	dep.Status = appv1.DeploymentStatus{
+		ObservedGeneration: dep.Generation,
+		Replicas:           replicas,
+		UpdatedReplicas:    replicas,
+		AvailableReplicas:  replicas,
+	}
+	assert.Nil(t, sdk.Update(dep))
+}
+
+// updateImage changes the image of the stored nginx and handles the change
+func updateImage(t *testing.T, h *Handler, nginx *v1alpha1.Nginx, image string) *v1alpha1.Nginx {
+	stored := storedNginx(t, nginx)
+	stored.Spec.Image = image
+	assert.Nil(t, sdk.Update(stored))
+	return handleStored(t, h, stored)
+}
+
+// startCanary creates the nginx and changes its image, rolling out the
+// canary until it pauses with half of the replicas
+func startCanary(t *testing.T, h *Handler) *v1alpha1.Nginx {
+	nginx := handleStored(t, h, createNginx(t, canaryNginx()))
+	rollOut(t, "my-nginx-deployment")
+
+	nginx = updateImage(t, h, nginx, "nginx:1.16")
+	if assert.NotNil(t, nginx.Status.Canary) {
+		assert.Equal(t, v1alpha1.NginxCanaryProgressing, nginx.Status.Canary.Phase)
+		assert.Equal(t, int32(50), nginx.Status.Canary.Weight)
+	}
+	if canary := storedWorkload(t, "my-nginx-canary-deployment"); assert.NotNil(t, canary) {
+		assert.Equal(t, int32(2), deploymentReplicas(canary))
+		assert.Equal(t, "nginx:1.16", canary.Spec.Template.Spec.Containers[0].Image)
+	}
+	if dep := storedWorkload(t, "my-nginx-deployment"); assert.NotNil(t, dep) {
+		assert.Equal(t, int32(4), deploymentReplicas(dep), "stable pods kept until the canary is available")
+	}
+
+	rollOut(t, "my-nginx-canary-deployment")
+	nginx = handleStored(t, h, nginx)
+	if assert.NotNil(t, nginx.Status.Canary) {
+		assert.Equal(t, v1alpha1.NginxCanaryPaused, nginx.Status.Canary.Phase)
+	}
+	if dep := storedWorkload(t, "my-nginx-deployment"); assert.NotNil(t, dep) {
+		assert.Equal(t, int32(2), deploymentReplicas(dep))
+		assert.Equal(t, "nginx:1.15", dep.Spec.Template.Spec.Containers[0].Image)
+	}
+	return nginx
+}
+
+func TestCanaryRolloutPromotion(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := startCanary(t, h)
+
+	// The paused step stays paused until the annotation changes
+	nginx = handleStored(t, h, nginx)
+	if assert.NotNil(t, nginx.Status.Canary) {
+		assert.Equal(t, v1alpha1.NginxCanaryPaused, nginx.Status.Canary.Phase)
+	}
+
+	nginx.Annotations = map[string]string{k8s.PromoteCanaryAnnotation: "1"}
+	assert.Nil(t, sdk.Update(nginx))
+	nginx = handleStored(t, h, nginx)
+	if assert.NotNil(t, nginx.Status.Canary) {
+		assert.Equal(t, v1alpha1.NginxCanaryPromoting, nginx.Status.Canary.Phase)
+	}
+	if dep := storedWorkload(t, "my-nginx-deployment"); assert.NotNil(t, dep) {
+		assert.Equal(t, int32(4), deploymentReplicas(dep))
+		assert.Equal(t, "nginx:1.16", dep.Spec.Template.Spec.Containers[0].Image)
+	}
+	assert.NotNil(t, storedWorkload(t, "my-nginx-canary-deployment"), "canary kept until the deployment rolled out")
+
+	rollOut(t, "my-nginx-deployment")
+	nginx = handleStored(t, h, nginx)
+	assert.Nil(t, nginx.Status.Canary)
+	assert.Nil(t, storedWorkload(t, "my-nginx-canary-deployment"))
+	reasons := eventReasons(t, "default")
+	assert.Contains(t, reasons, "CanaryRolloutStarted")
+	assert.Contains(t, reasons, "CanaryPromoted")
+}
+
+func TestCanaryRolloutAbort(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := startCanary(t, h)
+
+	nginx = updateImage(t, h, nginx, "nginx:1.15")
+	assert.Nil(t, nginx.Status.Canary)
+	assert.Nil(t, storedWorkload(t, "my-nginx-canary-deployment"))
+	if dep := storedWorkload(t, "my-nginx-deployment"); assert.NotNil(t, dep) {
+		assert.Equal(t, int32(4), deploymentReplicas(dep), "replicas given back to the deployment")
+		assert.Equal(t, "nginx:1.15", dep.Spec.Template.Spec.Containers[0].Image)
+	}
+	assert.Contains(t, eventReasons(t, "default"), "CanaryAborted")
+}
+
+func TestCanaryRolloutRollback(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := startCanary(t, h)
+
+	canary := storedWorkload(t, "my-nginx-canary-deployment")
+	canary.Status.Conditions = []appv1.DeploymentCondition{{
+		Type:    appv1.DeploymentProgressing,
+		Status:  corev1.ConditionFalse,
+		Message: "progress deadline exceeded",
+	}}
+	assert.Nil(t, sdk.Update(canary))
+	nginx = handleStored(t, h, nginx)
+	if assert.NotNil(t, nginx.Status.Canary) {
+		assert.Equal(t, v1alpha1.NginxCanaryFailed, nginx.Status.Canary.Phase)
+		assert.Contains(t, nginx.Status.Canary.Message, "progress deadline exceeded")
+	}
+	assert.Nil(t, storedWorkload(t, "my-nginx-canary-deployment"))
+	if dep := storedWorkload(t, "my-nginx-deployment"); assert.NotNil(t, dep) {
+		assert.Equal(t, int32(4), deploymentReplicas(dep))
+		assert.Equal(t, "nginx:1.15", dep.Spec.Template.Spec.Containers[0].Image)
+	}
+	assert.Contains(t, eventReasons(t, "default"), "CanaryRolledBack")
+
+	// The failed pod template is not rolled out again
+	nginx = handleStored(t, h, nginx)
+	if assert.NotNil(t, nginx.Status.Canary) {
+		assert.Equal(t, v1alpha1.NginxCanaryFailed, nginx.Status.Canary.Phase)
+	}
+	assert.Nil(t, storedWorkload(t, "my-nginx-canary-deployment"))
+}
@@ -0,0 +1,69 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileCertificate creates or updates the cert-manager Certificate of the
+// nginx and waits for the secret holding the issued certificate. The revision
+// of the certificate is recorded in the status, so its renewal replaces the
+// pods.
+func reconcileCertificate(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	certificate := k8s.NewCertificate(nginx)
+	if certificate == nil {
+		nginx.Status.CertificateRevision = ""
+		return nil
+	}
+	err := reconcileUnstructured(certificate)
+	if isResourceUnavailable(err) {
+		recordEvent(nginx, corev1.EventTypeWarning, "CertificateUnavailable",
+			"cert-manager is not installed in the cluster, the certificate cannot be requested", logger)
+		return &reconcileBlockedError{reason: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+
+	tls := nginx.Spec.WithDefaults().TLSSecret
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tls.SecretName,
+			Namespace: nginx.Namespace,
+		},
+	}
+	err = sdk.Get(secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to retrieve certificate secret: %v", err)
+	}
+	data, ok := secret.Data[tls.CertificateField]
+	if err != nil || !ok {
+		if nginx.Status.CertificateRevision == "" {
+			recordEvent(nginx, corev1.EventTypeNormal, "WaitingForCertificate",
+				fmt.Sprintf("Waiting for cert-manager to issue the certificate into secret %q", tls.SecretName), logger)
+		}
+		return &reconcileBlockedError{reason: "waiting for the certificate to be issued"}
+	}
+
+	revision := k8s.CertificateRevision(data)
+	if prev := nginx.Status.CertificateRevision; prev != "" && prev != revision {
+		recordEvent(nginx, corev1.EventTypeNormal, "CertificateRenewed",
+			fmt.Sprintf("Replacing the pods to load the renewed certificate of secret %q", tls.SecretName), logger)
+	}
+	nginx.Status.CertificateRevision = revision
+	nginx.Status.CertificateNotAfter = k8s.CertificateNotAfter(data)
+	return nil
+}
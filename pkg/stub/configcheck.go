@@ -0,0 +1,168 @@
+package stub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// checkConfig runs `nginx -t` in a job using the pod template of the given
+// deployment, returning a reconcileBlockedError while the job is running or
+// when it fails. The result is reported in the ConfigValid condition.
+func checkConfig(nginx *v1alpha1.Nginx, deployment *appv1.Deployment, logger *logrus.Entry) error {
+	if !nginx.Spec.ValidateConfig || nginx.Spec.Config == nil {
+		return nil
+	}
+
+	configVersion, err := configVersion(nginx)
+	if err != nil {
+		return err
+	}
+
+	job, err := k8s.NewConfigCheckJob(nginx, deployment, k8s.ConfigCheckOptions{ConfigVersion: configVersion})
+	if err != nil {
+		return fmt.Errorf("failed to assemble config check job: %v", err)
+	}
+
+	err = sdk.Create(job)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create config check job: %v", err)
+	}
+
+	if err == nil {
+		logger.Infof("validating config with job %s", job.Name)
+		if err := deleteStaleConfigChecks(nginx, job.Name); err != nil {
+			logger.Warnf("failed to delete stale config check jobs: %v", err)
+		}
+		nginx.Status.SetCondition(v1alpha1.NginxCondition{
+			Type:    v1alpha1.NginxConditionConfigValid,
+			Status:  corev1.ConditionUnknown,
+			Reason:  "Validating",
+			Message: fmt.Sprintf("Config is being validated by job %s", job.Name),
+		})
+		return &reconcileBlockedError{reason: "waiting for config validation"}
+	}
+
+	if err := sdk.Get(job); err != nil {
+		return fmt.Errorf("failed to retrieve config check job: %v", err)
+	}
+
+	switch {
+	case job.Status.Succeeded > 0:
+		nginx.Status.SetCondition(v1alpha1.NginxCondition{
+			Type:   v1alpha1.NginxConditionConfigValid,
+			Status: corev1.ConditionTrue,
+			Reason: "Valid",
+		})
+		return nil
+	case job.Status.Failed > 0:
+		msg := fmt.Sprintf("Config validation failed: %s", configCheckOutput(job))
+		if c := nginx.Status.GetCondition(v1alpha1.NginxConditionConfigValid); c == nil || c.Status != corev1.ConditionFalse {
+			recordEvent(nginx, corev1.EventTypeWarning, "InvalidConfig", msg, logger)
+		}
+		nginx.Status.SetCondition(v1alpha1.NginxCondition{
+			Type:    v1alpha1.NginxConditionConfigValid,
+			Status:  corev1.ConditionFalse,
+			Reason:  "NginxTestFailed",
+			Message: msg,
+		})
+		return &reconcileBlockedError{reason: "config validation failed, refusing to roll out"}
+	default:
+		return &reconcileBlockedError{reason: "waiting for config validation"}
+	}
+}
+
+// configVersion returns a value that changes whenever the content of the
+// config referenced by the nginx, or of its sources, changes
+func configVersion(nginx *v1alpha1.Nginx) (string, error) {
+	conf := nginx.Spec.Config
+	var versions []string
+	if conf.Kind == v1alpha1.ConfigKindInline {
+		versions = append(versions, k8s.InlineConfigHash(conf.Value))
+	} else if conf.Name != "" {
+		cm := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      conf.Name,
+				Namespace: nginx.Namespace,
+			},
+		}
+		if err := sdk.Get(cm); err != nil {
+			return "", fmt.Errorf("failed to retrieve config map: %v", err)
+		}
+		versions = append(versions, cm.ResourceVersion)
+	}
+	for _, source := range conf.Sources {
+		obj, kind, err := getConfigSource(nginx, source)
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve %s: %v", kind, err)
+		}
+		versions = append(versions, obj.GetResourceVersion())
+	}
+	return strings.Join(versions, ","), nil
+}
+
+// configCheckOutput returns the output of `nginx -t`, taken from the
+// termination message of the job pod
+func configCheckOutput(job *batchv1.Job) string {
+	podList := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(map[string]string{"job-name": job.Name}).String()
+	if err := sdk.List(job.Namespace, podList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return fmt.Sprintf("see the logs of job %s", job.Name)
+	}
+	for _, p := range podList.Items {
+		for _, s := range p.Status.ContainerStatuses {
+			if s.State.Terminated != nil && s.State.Terminated.Message != "" {
+				return s.State.Terminated.Message
+			}
+		}
+	}
+	return fmt.Sprintf("see the logs of job %s", job.Name)
+}
+
+// deleteStaleConfigChecks removes the config check jobs of the nginx other
+// than the current one
+func deleteStaleConfigChecks(nginx *v1alpha1.Nginx, current string) error {
+	jobList := &batchv1.JobList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(k8s.LabelsForConfigCheck(nginx.Name)).String()
+	if err := sdk.List(nginx.Namespace, jobList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	for i := range jobList.Items {
+		job := &jobList.Items[i]
+		if job.Name == current {
+			continue
+		}
+		job.TypeMeta = metav1.TypeMeta{Kind: "Job", APIVersion: "batch/v1"}
+		err := sdk.Delete(job, sdk.WithDeleteOptions(&metav1.DeleteOptions{PropagationPolicy: &propagation}))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
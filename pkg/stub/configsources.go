@@ -0,0 +1,57 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configSourceObject is the ConfigMap or Secret of a config source
+type configSourceObject interface {
+	sdk.Object
+	metav1.Object
+}
+
+// getConfigSource retrieves the ConfigMap or Secret of a config source,
+// returning its kind for the error messages
+func getConfigSource(nginx *v1alpha1.Nginx, source v1alpha1.ConfigSource) (configSourceObject, string, error) {
+	if source.Secret != "" {
+		secret := &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: source.Secret, Namespace: nginx.Namespace},
+		}
+		return secret, "secret", sdk.Get(secret)
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: source.ConfigMap, Namespace: nginx.Namespace},
+	}
+	return cm, "config map", sdk.Get(cm)
+}
+
+// checkConfigSources verifies that the ConfigMaps and Secrets projected into
+// conf.d exist, since pods referencing missing ones cannot start
+func checkConfigSources(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	conf := nginx.Spec.Config
+	if conf == nil {
+		return nil
+	}
+	for _, source := range conf.Sources {
+		obj, kind, err := getConfigSource(nginx, source)
+		if errors.IsNotFound(err) {
+			msg := fmt.Sprintf("Config source %s %q not found", kind, obj.GetName())
+			recordEvent(nginx, corev1.EventTypeWarning, "ConfigSourceNotFound", msg, logger)
+			return fmt.Errorf("missing config source: %s", msg)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retrieve %s: %v", kind, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileConfigTemplate renders the config template of the nginx into the
+// config map it owns, deleting the config map when the template is no longer
+// set. The revision of the rendered config is recorded in the status, so its
+// changes replace the pods.
+func reconcileConfigTemplate(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	t := nginx.Spec.WithDefaults().ConfigTemplate
+	if t == nil {
+		if nginx.Status.ConfigTemplateRevision == "" {
+			return nil
+		}
+		cm := k8s.NewConfigTemplateConfigMap(nginx, "")
+		if err := sdk.Delete(cm); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete generated config map: %v", err)
+		}
+		nginx.Status.ConfigTemplateRevision = ""
+		return nil
+	}
+
+	text := t.Inline
+	if t.ConfigMap != "" {
+		source := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      t.ConfigMap,
+				Namespace: nginx.Namespace,
+			},
+		}
+		err := sdk.Get(source)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to retrieve config map: %v", err)
+		}
+		var ok bool
+		if text, ok = source.Data[t.Key]; err != nil || !ok {
+			msg := fmt.Sprintf("Key %q of config map %q not found for the config template", t.Key, t.ConfigMap)
+			recordEvent(nginx, corev1.EventTypeWarning, "ConfigTemplateNotFound", msg, logger)
+			return fmt.Errorf("missing config template: %s", msg)
+		}
+	}
+
+	config, err := k8s.RenderConfigTemplate(nginx, text)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to render the config template: %v", err)
+		recordEvent(nginx, corev1.EventTypeWarning, "InvalidConfigTemplate", msg, logger)
+		return fmt.Errorf("invalid config template: %v", err)
+	}
+
+	cm := k8s.NewConfigTemplateConfigMap(nginx, config)
+	err = sdk.Create(cm)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create generated config map: %v", err)
+	}
+	if errors.IsAlreadyExists(err) {
+		curr := &corev1.ConfigMap{
+			TypeMeta:   cm.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: cm.Name, Namespace: cm.Namespace},
+		}
+		if err := sdk.Get(curr); err != nil {
+			return fmt.Errorf("failed to retrieve generated config map: %v", err)
+		}
+		if !metav1.IsControlledBy(curr, nginx) {
+			msg := fmt.Sprintf("Config map %q already exists and is not owned by the nginx", cm.Name)
+			recordEvent(nginx, corev1.EventTypeWarning, "InvalidConfigTemplate", msg, logger)
+			return fmt.Errorf("generated config map conflict: %s", msg)
+		}
+		if !reflect.DeepEqual(curr.Data, cm.Data) || k8s.MetadataDrift(cm, curr) {
+			curr.Data = cm.Data
+			k8s.MergeMetadata(curr, cm)
+			if err := sdk.Update(curr); err != nil {
+				return fmt.Errorf("failed to update generated config map: %v", err)
+			}
+		}
+	}
+
+	revision := k8s.ConfigTemplateRevision(config)
+	if prev := nginx.Status.ConfigTemplateRevision; prev != "" && prev != revision {
+		recordEvent(nginx, corev1.EventTypeNormal, "ConfigTemplateRendered",
+			fmt.Sprintf("Rendered a new config into config map %q", cm.Name), logger)
+	}
+	nginx.Status.ConfigTemplateRevision = revision
+	return nil
+}
@@ -0,0 +1,11 @@
+package stub
+
+// controllerClass is the class of the nginx objects handled by the operator
+var controllerClass string
+
+// SetControllerClass sets the class of the nginx objects handled by the
+// operator, the ones whose spec.controllerClass is the same. Nginx objects
+// of other classes are left to the operators started with them.
+func SetControllerClass(class string) {
+	controllerClass = class
+}
@@ -0,0 +1,107 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func reconcileDaemonSet(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	newDs, err := k8s.NewDaemonSet(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to assemble daemonset from nginx: %v", err)
+	}
+
+	currDs := &appv1.DaemonSet{
+		TypeMeta: newDs.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newDs.Name,
+			Namespace: newDs.Namespace,
+		},
+	}
+	err = sdk.Get(currDs)
+	if errors.IsNotFound(err) {
+		if err := checkWorkloadConfig(nginx, logger); err != nil {
+			return err
+		}
+		if err := createWorkload(nginx, newDs); err != nil {
+			return fmt.Errorf("failed to create daemonset: %v", err)
+		}
+		recordEvent(nginx, corev1.EventTypeNormal, "DaemonSetCreated", fmt.Sprintf("Created daemonset %s", newDs.Name), logger)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve daemonset: %v", err)
+	}
+
+	currHash, err := k8s.CurrentGeneratedHash(nginx, currDs, func(n *v1alpha1.Nginx) (metav1.Object, error) {
+		return k8s.NewDaemonSet(n)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to compare daemonset with the current one: %v", err)
+	}
+	newHash, _ := k8s.GeneratedHashOf(newDs)
+
+	purge := k8s.PodRestartRequested(newDs.Spec.Template.Annotations, currDs.Spec.Template.Annotations)
+	var drift []string
+	if newHash != currHash {
+		if err := checkWorkloadConfig(nginx, logger); err != nil {
+			return err
+		}
+	} else if !purge {
+		drift = k8s.DaemonSetDrift(newDs, currDs)
+		if len(drift) == 0 {
+			logger.Debug("nothing changed")
+			return recordGeneratedHash(nginx, currDs, newDs)
+		}
+	}
+
+	// The selector of daemonsets cannot be changed
+	currDs.Spec.Template = newDs.Spec.Template
+	currDs.Spec.MinReadySeconds = newDs.Spec.MinReadySeconds
+	currDs.Spec.RevisionHistoryLimit = newDs.Spec.RevisionHistoryLimit
+	k8s.CopyGeneratedHash(currDs, newDs)
+	k8s.MergeMetadata(currDs, newDs)
+
+	if err := updateWorkload(nginx, currDs); err != nil {
+		return fmt.Errorf("failed to update daemonset: %v", err)
+	}
+
+	if len(drift) > 0 {
+		recordEvent(nginx, corev1.EventTypeNormal, "DriftCorrected",
+			fmt.Sprintf("DaemonSet %s was modified out of band, restored fields: %s", currDs.Name, strings.Join(drift, ", ")), logger)
+	} else {
+		recordEvent(nginx, corev1.EventTypeNormal, "DaemonSetUpdated", fmt.Sprintf("Updated daemonset %s", currDs.Name), logger)
+	}
+	return nil
+}
+
+// deleteReplacedDaemonSet removes the daemonset previously created for the
+// nginx, if any, once another workload has taken its place
+func deleteReplacedDaemonSet(nginx *v1alpha1.Nginx) error {
+	ds := &appv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-daemonset",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(ds, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete replaced daemonset: %v", err)
+	}
+	return nil
+}
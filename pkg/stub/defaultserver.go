@@ -0,0 +1,17 @@
+package stub
+
+import (
+	"context"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reconcileDefaultServer writes the default server rendered for the nginx
+// into the config map it owns, deleting the config map when the default
+// server of the image is kept. It runs before the workload, which mounts it.
+func reconcileDefaultServer(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	return reconcileOwnedConfigMap(nginx, k8s.NewDefaultServerConfigMap(nginx), k8s.DefaultServerConfigName(nginx), "default server config map", "DefaultServerConflict", logger)
+}
@@ -0,0 +1,37 @@
+package stub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileDefaultServer(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15", Rootless: true}})
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+
+	cm := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.DefaultServerConfigName(nginx), Namespace: nginx.Namespace},
+	}
+	assert.Nil(t, sdk.Get(cm))
+	assert.Contains(t, cm.Data["default.conf"], "listen 8080;")
+	assert.True(t, metav1.IsControlledBy(cm, nginx))
+
+	nginx = storedNginx(t, nginx)
+	nginx.Spec.Rootless = false
+	assert.Nil(t, sdk.Update(nginx))
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: storedNginx(t, nginx)}))
+
+	assert.True(t, errors.IsNotFound(sdk.Get(cm)))
+}
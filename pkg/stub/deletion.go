@@ -0,0 +1,414 @@
+package stub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultDeletePropagation is the propagation policy used for nginx objects
+// that do not set one in their spec
+var defaultDeletePropagation = metav1.DeletePropagationBackground
+
+// SetDefaultDeletePropagation sets the propagation policy used when deleting
+// the objects of nginx objects that do not set one in their spec
+func SetDefaultDeletePropagation(p metav1.DeletionPropagation) error {
+	if !k8s.ValidDeletePropagation(p) {
+		return fmt.Errorf("unsupported delete propagation policy %q", p)
+	}
+	defaultDeletePropagation = p
+	return nil
+}
+
+// deleteOptions returns the options used to delete objects created for the nginx
+func deleteOptions(nginx *v1alpha1.Nginx) *metav1.DeleteOptions {
+	policy := k8s.DeletePropagation(nginx, defaultDeletePropagation)
+	return &metav1.DeleteOptions{PropagationPolicy: &policy}
+}
+
+// ensureFinalizers sets the finalizers needed to apply the delete
+// propagation policy, the cleanup policy and the deletion protection of the
+// nginx, removing the ones that are no longer needed.
+func ensureFinalizers(nginx *v1alpha1.Nginx) error {
+	propagation := k8s.DeletePropagation(nginx, defaultDeletePropagation) != metav1.DeletePropagationBackground
+	changed := k8s.SetFinalizer(&nginx.ObjectMeta, k8s.DeletePropagationFinalizer, propagation)
+	changed = k8s.SetFinalizer(&nginx.ObjectMeta, k8s.CleanupFinalizer, k8s.NeedsCleanup(nginx)) || changed
+	changed = k8s.SetFinalizer(&nginx.ObjectMeta, k8s.ProtectionFinalizer, k8s.IsProtected(nginx)) || changed
+	if !changed {
+		return nil
+	}
+	if err := sdk.Update(nginx); err != nil {
+		return fmt.Errorf("failed to update nginx finalizers: %v", err)
+	}
+	return nil
+}
+
+// finalize releases a nginx being deleted. Protected nginx objects are held
+// until the deletion is confirmed. Then the cleanup policy drains the pods
+// and detaches the retained objects, and the delete propagation policy is
+// applied to the objects created for it: orphaned objects are detached from
+// the nginx, so the garbage collector keeps them, and with the Foreground
+// policy the nginx is only released after its workload and pods are gone.
+func finalize(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	changed := false
+
+	if k8s.HasFinalizer(nginx.ObjectMeta, k8s.ProtectionFinalizer) {
+		if k8s.IsProtected(nginx) && !k8s.DeletionConfirmed(nginx) {
+			blockDeletion(nginx, logger)
+			return &reconcileBlockedError{reason: "deletion of protected nginx not confirmed"}
+		}
+		changed = k8s.RemoveFinalizer(&nginx.ObjectMeta, k8s.ProtectionFinalizer)
+	}
+
+	if k8s.HasFinalizer(nginx.ObjectMeta, k8s.CleanupFinalizer) {
+		if err := cleanup(nginx, logger); err != nil {
+			return err
+		}
+		changed = k8s.RemoveFinalizer(&nginx.ObjectMeta, k8s.CleanupFinalizer) || changed
+	}
+
+	if k8s.HasFinalizer(nginx.ObjectMeta, k8s.DeletePropagationFinalizer) {
+		switch k8s.DeletePropagation(nginx, defaultDeletePropagation) {
+		case metav1.DeletePropagationOrphan:
+			if err := orphanChildren(nginx); err != nil {
+				return err
+			}
+			recordEvent(nginx, corev1.EventTypeNormal, "ObjectsOrphaned", "Objects created for the nginx were orphaned", logger)
+		case metav1.DeletePropagationForeground:
+			deleted, err := deleteWorkloads(nginx)
+			if err != nil {
+				return err
+			}
+			if !deleted {
+				return &reconcileBlockedError{reason: "waiting for the workload to be deleted"}
+			}
+		}
+		changed = k8s.RemoveFinalizer(&nginx.ObjectMeta, k8s.DeletePropagationFinalizer) || changed
+	}
+
+	if !changed {
+		return nil
+	}
+	if err := sdk.Update(nginx); err != nil {
+		return fmt.Errorf("failed to remove nginx finalizers: %v", err)
+	}
+	return nil
+}
+
+// blockDeletion reports that the deletion of a protected nginx is waiting
+// for confirmation
+func blockDeletion(nginx *v1alpha1.Nginx, logger *logrus.Entry) {
+	msg := fmt.Sprintf("Nginx is protected by the %s label, annotate it with %s=true to confirm the deletion",
+		k8s.ProtectedLabel, k8s.ConfirmDeletionAnnotation)
+	if c := nginx.Status.GetCondition(v1alpha1.NginxConditionTerminatingBlocked); c == nil || c.Status != corev1.ConditionTrue {
+		recordEvent(nginx, corev1.EventTypeWarning, "DeletionBlocked", msg, logger)
+	}
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionTerminatingBlocked,
+		Status:  corev1.ConditionTrue,
+		Reason:  "ConfirmationRequired",
+		Message: msg,
+	})
+}
+
+// cleanup applies the cleanup policy of a nginx being deleted. The ingress
+// and the service are removed first, unless retained, and the nginx is held
+// while the pods drain. Then the retained objects are detached from the nginx
+// and its config check jobs are removed.
+func cleanup(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	policy := nginx.Spec.CleanupPolicy
+	if policy != nil && policy.DrainSeconds > 0 {
+		if err := deregister(nginx, logger); err != nil {
+			return err
+		}
+		if remaining := k8s.DrainRemaining(nginx, time.Now()); remaining > 0 {
+			drainDeletion(nginx, remaining, logger)
+			return &reconcileBlockedError{reason: "draining the pods before deletion"}
+		}
+	}
+
+	if k8s.Retains(nginx, v1alpha1.CleanupObjectWorkload) {
+		if err := orphanWorkloads(nginx); err != nil {
+			return err
+		}
+	}
+	if k8s.Retains(nginx, v1alpha1.CleanupObjectService) {
+		if err := orphanService(nginx); err != nil {
+			return err
+		}
+	}
+	if k8s.Retains(nginx, v1alpha1.CleanupObjectIngress) {
+		ingress := &extv1beta1.Ingress{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Ingress",
+				APIVersion: "extensions/v1beta1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      nginx.Name + "-ingress",
+				Namespace: nginx.Namespace,
+			},
+		}
+		if err := orphan(nginx, ingress, &ingress.ObjectMeta); err != nil {
+			return fmt.Errorf("failed to orphan ingress: %v", err)
+		}
+	}
+	if k8s.Retains(nginx, v1alpha1.CleanupObjectPodDisruptionBudget) {
+		pdb := &policyv1beta1.PodDisruptionBudget{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "PodDisruptionBudget",
+				APIVersion: "policy/v1beta1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      nginx.Name + "-pdb",
+				Namespace: nginx.Namespace,
+			},
+		}
+		if err := orphan(nginx, pdb, &pdb.ObjectMeta); err != nil {
+			return fmt.Errorf("failed to orphan pod disruption budget: %v", err)
+		}
+	}
+	if err := deleteStaleConfigChecks(nginx, ""); err != nil {
+		return fmt.Errorf("failed to delete config check jobs: %v", err)
+	}
+	return nil
+}
+
+// deregister removes the ingress and the service of a nginx being deleted,
+// unless retained, so no new connections reach its pods
+func deregister(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	if !k8s.Retains(nginx, v1alpha1.CleanupObjectIngress) {
+		if err := deleteIngress(nginx, logger); err != nil {
+			return err
+		}
+	}
+	if k8s.Retains(nginx, v1alpha1.CleanupObjectService) {
+		return nil
+	}
+	svc := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-service",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(svc, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete service: %v", err)
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, "ServiceDeleted", fmt.Sprintf("Deleted service %s", svc.Name), logger)
+	return nil
+}
+
+// drainDeletion reports that the deletion of the nginx is waiting for its
+// pods to drain
+func drainDeletion(nginx *v1alpha1.Nginx, remaining time.Duration, logger *logrus.Entry) {
+	msg := fmt.Sprintf("Draining the pods for %d seconds before deletion", nginx.Spec.CleanupPolicy.DrainSeconds)
+	if c := nginx.Status.GetCondition(v1alpha1.NginxConditionTerminatingBlocked); c == nil || c.Reason != "Draining" {
+		recordEvent(nginx, corev1.EventTypeNormal, "Draining", msg, logger)
+	}
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionTerminatingBlocked,
+		Status:  corev1.ConditionTrue,
+		Reason:  "Draining",
+		Message: fmt.Sprintf("%s, %s left", msg, remaining.Round(time.Second)),
+	})
+}
+
+// orphanChildren removes the nginx owner reference from its workload and service
+func orphanChildren(nginx *v1alpha1.Nginx) error {
+	if err := orphanWorkloads(nginx); err != nil {
+		return err
+	}
+	return orphanService(nginx)
+}
+
+// orphanService removes the nginx owner reference from its service
+func orphanService(nginx *v1alpha1.Nginx) error {
+	svc := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-service",
+			Namespace: nginx.Namespace,
+		},
+	}
+	if err := orphan(nginx, svc, &svc.ObjectMeta); err != nil {
+		return fmt.Errorf("failed to orphan service: %v", err)
+	}
+	return nil
+}
+
+// orphanWorkloads removes the nginx owner reference from its deployment,
+// statefulset, daemonset and rollout
+func orphanWorkloads(nginx *v1alpha1.Nginx) error {
+	deploy := &appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-deployment",
+			Namespace: nginx.Namespace,
+		},
+	}
+	if err := orphan(nginx, deploy, &deploy.ObjectMeta); err != nil {
+		return fmt.Errorf("failed to orphan deployment: %v", err)
+	}
+
+	sts := &appv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-statefulset",
+			Namespace: nginx.Namespace,
+		},
+	}
+	if err := orphan(nginx, sts, &sts.ObjectMeta); err != nil {
+		return fmt.Errorf("failed to orphan statefulset: %v", err)
+	}
+
+	ds := &appv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-daemonset",
+			Namespace: nginx.Namespace,
+		},
+	}
+	if err := orphan(nginx, ds, &ds.ObjectMeta); err != nil {
+		return fmt.Errorf("failed to orphan daemonset: %v", err)
+	}
+
+	client, _, err := k8sclient.GetResourceClient(k8s.RolloutAPIVersion, k8s.RolloutKind, nginx.Namespace)
+	if err != nil {
+		return nil
+	}
+	rollout, err := client.Get(nginx.Name+"-deployment", metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rollout: %v", err)
+	}
+	refs, removed := k8s.RemoveOwnerReference(rollout.GetOwnerReferences(), nginx.UID)
+	if !removed {
+		return nil
+	}
+	rollout.SetOwnerReferences(refs)
+	if _, err := client.Update(rollout); err != nil {
+		return fmt.Errorf("failed to orphan rollout: %v", err)
+	}
+	return nil
+}
+
+func orphan(nginx *v1alpha1.Nginx, obj sdk.Object, meta *metav1.ObjectMeta) error {
+	err := sdk.Get(obj)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	refs, removed := k8s.RemoveOwnerReference(meta.OwnerReferences, nginx.UID)
+	if !removed {
+		return nil
+	}
+	meta.OwnerReferences = refs
+	switch obj.(type) {
+	case *appv1.Deployment, *appv1.StatefulSet, *appv1.DaemonSet:
+		return updateWorkload(nginx, obj)
+	}
+	return sdk.Update(obj)
+}
+
+// deleteWorkloads deletes the deployment, statefulset, daemonset and rollout of the
+// nginx using its delete propagation policy, returning whether all are gone
+func deleteWorkloads(nginx *v1alpha1.Nginx) (bool, error) {
+	deploy := &appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-deployment",
+			Namespace: nginx.Namespace,
+		},
+	}
+	deleted := true
+	err := sdk.Delete(deploy, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if err == nil {
+		deleted = false
+	} else if !k8serrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete deployment: %v", err)
+	}
+
+	sts := &appv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-statefulset",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err = sdk.Delete(sts, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if err == nil {
+		deleted = false
+	} else if !k8serrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete statefulset: %v", err)
+	}
+
+	ds := &appv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-daemonset",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err = sdk.Delete(ds, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if err == nil {
+		deleted = false
+	} else if !k8serrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete daemonset: %v", err)
+	}
+
+	client, _, err := k8sclient.GetResourceClient(k8s.RolloutAPIVersion, k8s.RolloutKind, nginx.Namespace)
+	if err != nil {
+		return deleted, nil
+	}
+	err = client.Delete(nginx.Name+"-deployment", deleteOptions(nginx))
+	if err == nil {
+		deleted = false
+	} else if !k8serrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete rollout: %v", err)
+	}
+	return deleted, nil
+}
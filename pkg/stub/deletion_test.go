@@ -0,0 +1,234 @@
+package stub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+	"github.com/tsuru/nginx-operator/pkg/stub/internal/fakeapi"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/assert"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deleteNginx deletes the nginx from the fake API and handles the event of
+// the deletion, returning the nginx as stored afterwards or nil once it is
+// gone
+func deleteNginx(t *testing.T, h *Handler, nginx *v1alpha1.Nginx) *v1alpha1.Nginx {
+	assert.Nil(t, sdk.Delete(nginx))
+	return handleStored(t, h, nginx)
+}
+
+// handleStored handles an event for the nginx as stored in the fake API,
+// returning it as stored afterwards or nil once it is gone. The status is
+// written on every event, as if they were further apart than the status
+// update window.
+func handleStored(t *testing.T, h *Handler, nginx *v1alpha1.Nginx) *v1alpha1.Nginx {
+	stored := getNginx(t, nginx)
+	if stored == nil {
+		return nil
+	}
+	h.statuses.forget(stored)
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: stored}))
+	return getNginx(t, nginx)
+}
+
+// getNginx returns the nginx as stored in the fake API, or nil if it does
+// not exist
+func getNginx(t *testing.T, nginx *v1alpha1.Nginx) *v1alpha1.Nginx {
+	stored := &v1alpha1.Nginx{
+		TypeMeta:   metav1.TypeMeta{Kind: "Nginx", APIVersion: v1alpha1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: nginx.Name, Namespace: nginx.Namespace},
+	}
+	err := sdk.Get(stored)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	assert.Nil(t, err)
+	return stored
+}
+
+// storedDeployment returns the deployment of my-nginx as stored in the fake
+// API, or nil if it does not exist
+func storedDeployment(t *testing.T) *appv1.Deployment {
+	dep := &appv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-deployment", Namespace: "default"},
+	}
+	err := sdk.Get(dep)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	assert.Nil(t, err)
+	return dep
+}
+
+// storedService returns the service of my-nginx as stored in the fake API,
+// or nil if it does not exist
+func storedService(t *testing.T) *corev1.Service {
+	svc := &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-service", Namespace: "default"},
+	}
+	err := sdk.Get(svc)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	assert.Nil(t, err)
+	return svc
+}
+
+func TestEnsureFinalizers(t *testing.T) {
+	orphan := metav1.DeletePropagationOrphan
+	background := metav1.DeletePropagationBackground
+	tests := []struct {
+		name   string
+		labels map[string]string
+		spec   v1alpha1.NginxSpec
+		want   []string
+	}{
+		{
+			name: "none",
+			spec: v1alpha1.NginxSpec{DeletePropagation: &background},
+		},
+		{
+			name: "delete propagation",
+			spec: v1alpha1.NginxSpec{DeletePropagation: &orphan},
+			want: []string{k8s.DeletePropagationFinalizer},
+		},
+		{
+			name: "cleanup policy",
+			spec: v1alpha1.NginxSpec{CleanupPolicy: &v1alpha1.CleanupPolicy{Retain: []v1alpha1.CleanupObject{v1alpha1.CleanupObjectService}}},
+			want: []string{k8s.CleanupFinalizer},
+		},
+		{
+			name:   "protected",
+			labels: map[string]string{k8s.ProtectedLabel: "true"},
+			want:   []string{k8s.ProtectionFinalizer},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			tt.spec.Image = "nginx:1.15"
+			nginx := createNginx(t, &v1alpha1.Nginx{ObjectMeta: metav1.ObjectMeta{Labels: tt.labels}, Spec: tt.spec})
+
+			stored := handleStored(t, h, nginx)
+			assert.Equal(t, tt.want, stored.Finalizers)
+
+			// Finalizers no longer needed are removed
+			stored.Labels = nil
+			stored.Spec = v1alpha1.NginxSpec{Image: "nginx:1.15", DeletePropagation: &background}
+			assert.Nil(t, sdk.Update(stored))
+			stored = handleStored(t, h, stored)
+			assert.Empty(t, stored.Finalizers)
+		})
+	}
+}
+
+func TestFinalizeRetainsObjects(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image: "nginx:1.15",
+		CleanupPolicy: &v1alpha1.CleanupPolicy{
+			Retain: []v1alpha1.CleanupObject{v1alpha1.CleanupObjectWorkload, v1alpha1.CleanupObjectService},
+		},
+	}})
+	nginx = handleStored(t, h, nginx)
+	if dep := storedDeployment(t); assert.NotNil(t, dep) {
+		assert.NotEmpty(t, dep.OwnerReferences)
+	}
+	if svc := storedService(t); assert.NotNil(t, svc) {
+		assert.NotEmpty(t, svc.OwnerReferences)
+	}
+
+	assert.Nil(t, deleteNginx(t, h, nginx), "nginx released after the cleanup")
+	if dep := storedDeployment(t); assert.NotNil(t, dep, "retained deployment") {
+		assert.Empty(t, dep.OwnerReferences)
+	}
+	if svc := storedService(t); assert.NotNil(t, svc, "retained service") {
+		assert.Empty(t, svc.OwnerReferences)
+	}
+}
+
+func TestFinalizeDrainsPods(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image:         "nginx:1.15",
+		CleanupPolicy: &v1alpha1.CleanupPolicy{DrainSeconds: 3600},
+	}})
+	nginx = handleStored(t, h, nginx)
+	assert.Equal(t, 1, fakeapi.Count("Service"))
+
+	stored := deleteNginx(t, h, nginx)
+	if !assert.NotNil(t, stored, "nginx held while draining") {
+		return
+	}
+	assert.Equal(t, []string{k8s.CleanupFinalizer}, stored.Finalizers)
+	assert.Equal(t, 0, fakeapi.Count("Service"), "service removed before the pods drain")
+	assert.Equal(t, 1, fakeapi.Count("Deployment"))
+	condition := stored.Status.GetCondition(v1alpha1.NginxConditionTerminatingBlocked)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, "Draining", condition.Reason)
+	}
+	assert.Contains(t, eventReasons(t, "default"), "Draining")
+}
+
+func TestFinalizeWaitsForDeletionConfirmation(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{k8s.ProtectedLabel: "true"}},
+		Spec:       v1alpha1.NginxSpec{Image: "nginx:1.15"},
+	})
+	nginx = handleStored(t, h, nginx)
+
+	stored := deleteNginx(t, h, nginx)
+	if !assert.NotNil(t, stored, "protected nginx held") {
+		return
+	}
+	condition := stored.Status.GetCondition(v1alpha1.NginxConditionTerminatingBlocked)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, "ConfirmationRequired", condition.Reason)
+	}
+	assert.Contains(t, eventReasons(t, "default"), "DeletionBlocked")
+
+	stored.Annotations = map[string]string{k8s.ConfirmDeletionAnnotation: "true"}
+	assert.Nil(t, sdk.Update(stored))
+	assert.Nil(t, handleStored(t, h, stored), "nginx released once confirmed")
+}
+
+func TestFinalizeForegroundDeletion(t *testing.T) {
+	h := newTestHandler(t)
+	foreground := metav1.DeletePropagationForeground
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15", DeletePropagation: &foreground}})
+	nginx = handleStored(t, h, nginx)
+	assert.Equal(t, 1, fakeapi.Count("Deployment"))
+
+	stored := deleteNginx(t, h, nginx)
+	if assert.NotNil(t, stored, "nginx held until the workload is gone") {
+		assert.Equal(t, []string{k8s.DeletePropagationFinalizer}, stored.Finalizers)
+	}
+	assert.Equal(t, 0, fakeapi.Count("Deployment"))
+	assert.Nil(t, handleStored(t, h, stored), "nginx released once the workload is gone")
+}
+
+func TestFinalizeOrphansObjects(t *testing.T) {
+	h := newTestHandler(t)
+	orphan := metav1.DeletePropagationOrphan
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15", DeletePropagation: &orphan}})
+	nginx = handleStored(t, h, nginx)
+
+	assert.Nil(t, deleteNginx(t, h, nginx))
+	if dep := storedDeployment(t); assert.NotNil(t, dep) {
+		assert.Empty(t, dep.OwnerReferences)
+	}
+	if svc := storedService(t); assert.NotNil(t, svc) {
+		assert.Empty(t, svc.OwnerReferences)
+	}
+	assert.Contains(t, eventReasons(t, "default"), "ObjectsOrphaned")
+}
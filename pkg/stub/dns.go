@@ -0,0 +1,45 @@
+package stub
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dnsAddresses returns the load balancer addresses the spec.dns hostnames of
+// the nginx point to: the ones of its ingress, or of its service when it has
+// no ingress. Objects not created yet have no addresses.
+func dnsAddresses(nginx *v1alpha1.Nginx) ([]v1alpha1.NginxAddress, error) {
+	if nginx.Spec.DNS == nil {
+		return nil, nil
+	}
+	var lb *corev1.LoadBalancerStatus
+	var obj sdk.Object
+	if desired := k8s.NewIngress(nginx); desired != nil {
+		ingress := &extv1beta1.Ingress{
+			TypeMeta:   desired.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace},
+		}
+		lb, obj = &ingress.Status.LoadBalancer, ingress
+	} else {
+		desired := k8s.NewService(nginx)
+		service := &corev1.Service{
+			TypeMeta:   desired.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace},
+		}
+		lb, obj = &service.Status.LoadBalancer, service
+	}
+	err := sdk.Get(obj)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k8s.Addresses(*lb), nil
+}
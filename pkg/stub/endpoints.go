@@ -0,0 +1,121 @@
+package stub
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// refreshEndpoints sets the addresses of the ready pods of the nginx in the
+// given status and writes them into the endpoints config map, when
+// requested. The config map is deleted once no longer requested. Pod changes
+// are not watched, so the addresses are refreshed on the resyncs.
+func refreshEndpoints(nginx *v1alpha1.Nginx, status *v1alpha1.NginxStatus, logger *logrus.Entry) error {
+	previous := status.Endpoints
+	if nginx.Spec.Endpoints == nil {
+		status.Endpoints = nil
+		if previous != nil && previous.ConfigMap != "" {
+			return deleteEndpointsConfigMap(nginx)
+		}
+		return nil
+	}
+
+	podList := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(k8s.LabelsForNginx(nginx.Name)).String()
+	if err := sdk.List(nginx.Namespace, podList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return fmt.Errorf("failed to list pods: %v", err)
+	}
+	published := &v1alpha1.NginxEndpointsStatus{Addresses: k8s.PodEndpoints(podList.Items)}
+
+	cm, err := k8s.NewEndpointsConfigMap(nginx, published.Addresses)
+	if err != nil {
+		return fmt.Errorf("failed to assemble endpoints config map: %v", err)
+	}
+	switch {
+	case cm != nil:
+		written, err := writeEndpointsConfigMap(nginx, cm, logger)
+		if err != nil {
+			return err
+		}
+		if written {
+			published.ConfigMap = cm.Name
+		}
+	case previous != nil && previous.ConfigMap != "":
+		if err := deleteEndpointsConfigMap(nginx); err != nil {
+			return err
+		}
+	}
+	status.Endpoints = published
+	return nil
+}
+
+// writeEndpointsConfigMap creates or updates the endpoints config map,
+// returning whether it is owned by the nginx. Config maps of the same name
+// not owned by the nginx are left alone, with an event.
+func writeEndpointsConfigMap(nginx *v1alpha1.Nginx, cm *corev1.ConfigMap, logger *logrus.Entry) (bool, error) {
+	err := sdk.Create(cm)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("failed to create endpoints config map: %v", err)
+	}
+	curr := &corev1.ConfigMap{
+		TypeMeta:   cm.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: cm.Name, Namespace: cm.Namespace},
+	}
+	if err := sdk.Get(curr); err != nil {
+		return false, fmt.Errorf("failed to retrieve endpoints config map: %v", err)
+	}
+	if !metav1.IsControlledBy(curr, nginx) {
+		recordEvent(nginx, corev1.EventTypeWarning, "EndpointsConflict",
+			fmt.Sprintf("Config map %q already exists and is not owned by the nginx, the endpoints are only published in the status", cm.Name), logger)
+		return false, nil
+	}
+	if reflect.DeepEqual(curr.Data, cm.Data) && !k8s.MetadataDrift(cm, curr) {
+		return true, nil
+	}
+	curr.Data = cm.Data
+	k8s.MergeMetadata(curr, cm)
+	if err := sdk.Update(curr); err != nil {
+		return false, fmt.Errorf("failed to update endpoints config map: %v", err)
+	}
+	return true, nil
+}
+
+// deleteEndpointsConfigMap removes the endpoints config map of the nginx, if
+// it still controls it
+func deleteEndpointsConfigMap(nginx *v1alpha1.Nginx) error {
+	curr := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.EndpointsConfigMapName(nginx), Namespace: nginx.Namespace},
+	}
+	err := sdk.Get(curr)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve endpoints config map: %v", err)
+	}
+	if !metav1.IsControlledBy(curr, nginx) {
+		return nil
+	}
+	if err := sdk.Delete(curr); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete endpoints config map: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package stub
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventSource is the component reported on the events created by the operator
+const eventSource = "nginx-operator"
+
+// recordEvent publishes an event on the given nginx. Repeated events with the
+// same reason and message are aggregated by increasing the event count, like
+// the client-go event recorder does. Failing to record the event is only
+// logged since events are informational.
+func recordEvent(nginx *v1alpha1.Nginx, eventType, reason, message string, logger *logrus.Entry) {
+	now := metav1.Now()
+	event := &corev1.Event{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Event",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName(nginx, eventType, reason, message),
+			Namespace: nginx.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Nginx",
+			APIVersion:      v1alpha1.SchemeGroupVersion.String(),
+			Name:            nginx.Name,
+			Namespace:       nginx.Namespace,
+			UID:             nginx.UID,
+			ResourceVersion: nginx.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Count:          1,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Source: corev1.EventSource{
+			Component: eventSource,
+		},
+	}
+	err := sdk.Create(event)
+	if errors.IsAlreadyExists(err) {
+		err = incrementEvent(event, now)
+	}
+	if err != nil {
+		logger.Warnf("failed to record event %q: %v", reason, err)
+	}
+}
+
+func incrementEvent(event *corev1.Event, now metav1.Time) error {
+	existing := &corev1.Event{
+		TypeMeta:   event.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: event.Name, Namespace: event.Namespace},
+	}
+	if err := sdk.Get(existing); err != nil {
+		return err
+	}
+	existing.Count++
+	existing.LastTimestamp = now
+	return sdk.Update(existing)
+}
+
+// eventName returns a name that is the same for identical events on the same
+// nginx, so they can be aggregated
+func eventName(nginx *v1alpha1.Nginx, eventType, reason, message string) string {
+	h := fnv.New64a()
+	fmt.Fprint(h, nginx.UID, eventType, reason, message)
+	return fmt.Sprintf("%v.%x", nginx.Name, h.Sum64())
+}
@@ -0,0 +1,114 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// reconcileExternalSecrets creates or updates the ExternalSecrets of the
+// nginx, removes the ones no longer in its spec and waits for the secrets
+// they materialize. The revision of the secrets is recorded in the status,
+// so their rotation replaces the pods.
+func reconcileExternalSecrets(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	externalSecrets := k8s.NewExternalSecrets(nginx)
+	if len(externalSecrets) == 0 && nginx.Status.ExternalSecretsRevision == "" {
+		return nil
+	}
+	for _, e := range externalSecrets {
+		err := reconcileUnstructured(e)
+		if isResourceUnavailable(err) {
+			recordEvent(nginx, corev1.EventTypeWarning, "ExternalSecretsUnavailable",
+				"External Secrets is not installed in the cluster, the external secrets cannot be materialized", logger)
+			return &reconcileBlockedError{reason: err.Error()}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := deleteStaleExternalSecrets(nginx, externalSecrets); err != nil {
+		return err
+	}
+	if len(externalSecrets) == 0 {
+		nginx.Status.ExternalSecretsRevision = ""
+		return nil
+	}
+
+	var secrets []corev1.Secret
+	for _, e := range nginx.Spec.ExternalSecrets {
+		secret := &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      e.Name,
+				Namespace: nginx.Namespace,
+			},
+		}
+		err := sdk.Get(secret)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to retrieve external secret: %v", err)
+		}
+		if err != nil || !k8s.ExternalSecretMaterialized(e, secret) {
+			if nginx.Status.ExternalSecretsRevision == "" {
+				recordEvent(nginx, corev1.EventTypeNormal, "WaitingForExternalSecret",
+					fmt.Sprintf("Waiting for External Secrets to materialize secret %q", e.Name), logger)
+			}
+			return &reconcileBlockedError{reason: fmt.Sprintf("waiting for secret %s to be materialized", e.Name)}
+		}
+		secrets = append(secrets, *secret)
+	}
+
+	revision := k8s.ExternalSecretsRevision(secrets)
+	if prev := nginx.Status.ExternalSecretsRevision; prev != "" && prev != revision {
+		recordEvent(nginx, corev1.EventTypeNormal, "ExternalSecretsRotated",
+			"Replacing the pods to load the rotated external secrets", logger)
+	}
+	nginx.Status.ExternalSecretsRevision = revision
+	return nil
+}
+
+// deleteStaleExternalSecrets removes the ExternalSecrets of the nginx that
+// are not among the desired ones, along with the secrets they own
+func deleteStaleExternalSecrets(nginx *v1alpha1.Nginx, desired []*unstructured.Unstructured) error {
+	client, _, err := k8sclient.GetResourceClient(k8s.ExternalSecretAPIVersion, k8s.ExternalSecretKind, nginx.Namespace)
+	if err != nil {
+		return nil
+	}
+	obj, err := client.List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(k8s.LabelsForNginx(nginx.Name)).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list external secrets: %v", err)
+	}
+	list, ok := obj.(*unstructured.UnstructuredList)
+	if !ok {
+		return nil
+	}
+	keep := make(map[string]bool)
+	for _, e := range desired {
+		keep[e.GetName()] = true
+	}
+	for _, e := range list.Items {
+		if keep[e.GetName()] || !metav1.IsControlledBy(&e, nginx) {
+			continue
+		}
+		err := client.Delete(e.GetName(), deleteOptions(nginx))
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete external secret %s: %v", e.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package stub
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+	"github.com/tsuru/nginx-operator/pkg/metrics"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fleetStatusInterval is the minimum interval between writes of the fleet
+// status. Changes happening within it are written by a later event.
+const fleetStatusInterval = 30 * time.Second
+
+var (
+	// fleetStatusName is the name of the NginxFleetStatus written by the
+	// operator, none when empty
+	fleetStatusName string
+
+	// certificateExpiryThreshold is how long before their expiration the
+	// certificates are listed in the fleet status
+	certificateExpiryThreshold = k8s.DefaultCertificateExpiryThreshold
+)
+
+// SetFleetStatus sets the name of the NginxFleetStatus summarizing the nginx
+// instances handled by the operator, and how long before their expiration
+// their certificates are listed in it. An empty name disables it.
+func SetFleetStatus(name string, expiryThreshold time.Duration) {
+	fleetStatusName = name
+	certificateExpiryThreshold = expiryThreshold
+}
+
+// fleetTracker keeps the state of the nginx instances handled by the
+// operator and writes their summary to the fleet status.
+type fleetTracker struct {
+	mu        sync.Mutex
+	instances map[types.UID]k8s.FleetInstance
+	written   *v1alpha1.NginxFleetSummary
+	lastWrite time.Time
+}
+
+func newFleetTracker() *fleetTracker {
+	return &fleetTracker{instances: make(map[types.UID]k8s.FleetInstance)}
+}
+
+// observe records the state of the nginx, unhealthy for the given problem
+// or the one found in its status
+func (f *fleetTracker) observe(nginx *v1alpha1.Nginx, problem string) {
+	if problem == "" && metrics.Staleness.IsStale(nginx.Namespace, nginx.Name) {
+		problem = "ReconcileStale"
+	}
+	if problem == "" {
+		problem = k8s.InstanceProblem(nginx)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.instances[nginx.UID] = k8s.NewFleetInstance(nginx, problem)
+}
+
+// forget removes the nginx from the tracker
+func (f *fleetTracker) forget(nginx *v1alpha1.Nginx) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.instances, nginx.UID)
+}
+
+// sync writes the summary of the fleet when it changed, at most once per
+// fleetStatusInterval
+func (f *fleetTracker) sync(logger *logrus.Entry) error {
+	if fleetStatusName == "" {
+		return nil
+	}
+	f.mu.Lock()
+	instances := make([]k8s.FleetInstance, 0, len(f.instances))
+	for _, i := range f.instances {
+		instances = append(instances, i)
+	}
+	now := time.Now()
+	summary := k8s.SummarizeFleet(instances, now.Add(certificateExpiryThreshold))
+	if (f.written != nil && reflect.DeepEqual(*f.written, summary)) || now.Sub(f.lastWrite) < fleetStatusInterval {
+		f.mu.Unlock()
+		return nil
+	}
+	f.lastWrite = now
+	f.mu.Unlock()
+
+	if err := writeFleetStatus(summary, now); err != nil {
+		return err
+	}
+	logger.Debugf("fleet status %s written", fleetStatusName)
+	f.mu.Lock()
+	f.written = &summary
+	f.mu.Unlock()
+	return nil
+}
+
+// writeFleetStatus creates or updates the fleet status with the given
+// summary
+func writeFleetStatus(summary v1alpha1.NginxFleetSummary, now time.Time) error {
+	updated := metav1.NewTime(now)
+	summary.LastUpdateTime = &updated
+	fleet := &v1alpha1.NginxFleetStatus{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NginxFleetStatus",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fleetStatusName,
+		},
+	}
+	err := sdk.Get(fleet)
+	if errors.IsNotFound(err) {
+		fleet.Status = summary
+		if err := sdk.Create(fleet); err != nil {
+			return fmt.Errorf("failed to create fleet status: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve fleet status: %v", err)
+	}
+	fleet.Status = summary
+	if err := sdk.Update(fleet); err != nil {
+		return fmt.Errorf("failed to update fleet status: %v", err)
+	}
+	return nil
+}
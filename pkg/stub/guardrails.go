@@ -0,0 +1,78 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// guardrails are the operator limits enforced on every nginx
+var guardrails k8s.Guardrails
+
+// SetGuardrails sets the limits enforced on the replicas, resource requests
+// and images of every nginx
+func SetGuardrails(g k8s.Guardrails) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	guardrails = g
+	return nil
+}
+
+// enforceGuardrails keeps the nginx within the operator guardrails. With the
+// Clamp mode its replicas and requests are lowered in the spec used to
+// assemble its objects, otherwise, and for images that are not allowed, the
+// reconcile is held. The Degraded condition reports either case.
+func enforceGuardrails(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	if !guardrails.Enabled() {
+		clearDegraded(nginx)
+		return nil
+	}
+	var clamped []string
+	if guardrails.Mode == k8s.GuardrailModeClamp {
+		var spec *v1alpha1.NginxSpec
+		spec, clamped = k8s.ClampToGuardrails(&nginx.Spec, guardrails)
+		nginx.Spec = *spec
+	}
+
+	reason, msg := k8s.GuardrailsClamped, "Clamped to the operator guardrails: "+strings.Join(clamped, "; ")
+	violations := k8s.GuardrailViolations(nginx, guardrails)
+	if len(violations) > 0 {
+		reason, msg = k8s.GuardrailsRejected, "Rejected by the operator guardrails: "+strings.Join(violations, "; ")
+	} else if len(clamped) == 0 {
+		clearDegraded(nginx)
+		return nil
+	}
+
+	if c := nginx.Status.GetCondition(v1alpha1.NginxConditionDegraded); c == nil || c.Status != corev1.ConditionTrue || c.Message != msg {
+		recordEvent(nginx, corev1.EventTypeWarning, reason, msg, logger)
+	}
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionDegraded,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: msg,
+	})
+	if len(violations) > 0 {
+		return &reconcileBlockedError{reason: fmt.Sprintf("spec out of the operator guardrails: %s", strings.Join(violations, "; "))}
+	}
+	return nil
+}
+
+// clearDegraded reports that the nginx is back within the operator
+// guardrails
+func clearDegraded(nginx *v1alpha1.Nginx) {
+	if c := nginx.Status.GetCondition(v1alpha1.NginxConditionDegraded); c != nil && c.Status == corev1.ConditionTrue {
+		nginx.Status.SetCondition(v1alpha1.NginxCondition{
+			Type:   v1alpha1.NginxConditionDegraded,
+			Status: corev1.ConditionFalse,
+			Reason: "WithinGuardrails",
+		})
+	}
+}
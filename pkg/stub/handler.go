@@ -3,11 +3,14 @@ package stub
 import (
 	"context"
 	"fmt"
-	"reflect"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
-	"github.com/tsuru/nginx-operator/pkg/stub/k8s"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+	"github.com/tsuru/nginx-operator/pkg/metrics"
+	"github.com/tsuru/nginx-operator/pkg/tracing"
 
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
 	"github.com/sirupsen/logrus"
@@ -16,20 +19,47 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// lastReconcileTimeResolution is the minimum interval between updates of the
+// last reconcile time in the nginx status, to avoid writing it on every resync
+const lastReconcileTimeResolution = time.Minute
+
 func NewHandler(logger *logrus.Logger) sdk.Handler {
 	return &Handler{
-		logger: logger,
+		logger:     logger,
+		specHashes: newSpecHashCache(),
+		statuses:   newStatusWriter(),
+		fleet:      newFleetTracker(),
+		retention:  newRetentionTracker(),
+		owned:      newOwnedTracker(),
+		locks:      newNginxLocks(),
 	}
 }
 
 type Handler struct {
-	logger *logrus.Logger
+	logger     *logrus.Logger
+	specHashes *specHashCache
+	statuses   *statusWriter
+	fleet      *fleetTracker
+	retention  *retentionTracker
+	owned      *ownedTracker
+	locks      *nginxLocks
+}
+
+// forget drops the state kept for the nginx, once it is deleted or handled
+// by another operator
+func (h *Handler) forget(n *v1alpha1.Nginx) {
+	metrics.Staleness.Forget(n.Namespace, n.Name)
+	h.specHashes.forget(n)
+	h.statuses.forget(n)
+	h.fleet.forget(n)
+	h.retention.forget(n)
 }
 
 // Handle handles events for the operator
-func (h *Handler) Handle(ctx context.Context, event sdk.Event) error {
+func (h *Handler) Handle(ctx context.Context, event sdk.Event) (err error) {
 	switch o := event.Object.(type) {
 	case *v1alpha1.Nginx:
 		logger := h.logger.WithFields(map[string]interface{}{
@@ -38,22 +68,164 @@ func (h *Handler) Handle(ctx context.Context, event sdk.Event) error {
 			"kind":      o.GetObjectKind().GroupVersionKind().String(),
 		})
 
+		if !k8s.HandledBy(o, controllerClass) {
+			// The nginx may have been moved to another operator
+			logger.Debugf("controller class %q is handled by another operator, skipping", o.Spec.ControllerClass)
+			h.forget(o)
+			return nil
+		}
+
+		defer h.locks.lock(o)()
+		var span *tracing.Span
+		ctx, span = tracing.Start(ctx, "handle nginx",
+			tracing.String("nginx.namespace", o.Namespace),
+			tracing.String("nginx.name", o.Name),
+			tracing.Bool("event.deleted", event.Deleted))
+		defer func() { endSpan(span, err) }()
+		if traceID := span.TraceID(); traceID != "" {
+			logger = logger.WithField("trace_id", traceID)
+		}
 		logger.Debugf("Handling event for object: %+v", o)
 
-		if err := reconcile(ctx, event, o, logger); err != nil {
-			logger.Errorf("fail to reconcile: %v", err)
-			return err
+		if event.Deleted {
+			h.forget(o)
+		} else {
+			metrics.Staleness.Observe(o.Namespace, o.Name)
+		}
+
+		if !event.Deleted && o.DeletionTimestamp != nil {
+			storedStatus := *o.Status.DeepCopy()
+			err := finalize(o, logger)
+			if _, ok := err.(*reconcileBlockedError); ok {
+				logger.Infof("finalization blocked: %v", err)
+				if err := h.statuses.update(o, storedStatus, o.Status, logger); err != nil {
+					logger.Errorf("fail to update status: %v", err)
+				}
+				return nil
+			}
+			if err != nil {
+				logger.Errorf("fail to finalize: %v", err)
+				return err
+			}
+			return nil
+		}
+
+		if !event.Deleted {
+			// Finalizers depend on labels as well, so they are kept up to
+			// date even when the spec did not change
+			if err := ensureFinalizers(o); err != nil {
+				logger.Errorf("fail to set finalizers: %v", err)
+				return err
+			}
+		}
+
+		storedStatus := *o.Status.DeepCopy()
+		blocked := false
+		// Paused instances are left as they are, so their objects can be
+		// changed by hand, but their status is still refreshed
+		paused := !event.Deleted && checkPaused(o, logger)
+		if paused {
+			logger.Debug("reconcile paused by spec.paused, skipping")
+		} else if !event.Deleted && h.specHashes.upToDate(o) && !k8s.CachePurgePending(o) {
+			logger.Debug("spec unchanged since last reconcile, skipping")
+		} else {
+			start := time.Now()
+			err := reconcile(ctx, event, o, logger)
+			if _, ok := err.(*reconcileBlockedError); ok {
+				metrics.ObserveReconcile(metrics.ReconcileBlocked, time.Since(start))
+				logger.Infof("reconcile blocked: %v", err)
+				blocked = true
+			} else if err != nil {
+				metrics.ObserveReconcile(metrics.ReconcileError, time.Since(start))
+				logger.Errorf("fail to reconcile: %v", err)
+				recordEvent(o, corev1.EventTypeWarning, "ReconcileFailed", err.Error(), logger)
+				checkStaleness(o, logger)
+				h.syncFleet(o, "ReconcileFailed", logger)
+				return err
+			} else {
+				metrics.ObserveReconcile(metrics.ReconcileSuccess, time.Since(start))
+				// Clamped replicas are reconciled again on every resync, to
+				// scale up as soon as the quota allows. Canary rollouts are
+				// as well, to remove the canary deployment once the
+				// promoted pod template is rolled out.
+				if !event.Deleted && !k8s.QuotaLimited(o) && o.Status.Canary == nil {
+					h.specHashes.set(o)
+				}
+			}
+		}
+
+		if !event.Deleted && !paused {
+			if err := remediateNodes(ctx, o, logger); err != nil {
+				logger.Errorf("fail to remediate unhealthy nodes: %v", err)
+			}
+			if h.retention.due(o) {
+				if err := collectGarbage(o, logger); err != nil {
+					logger.Errorf("fail to collect garbage: %v", err)
+				}
+			}
 		}
 
-		if err := refreshStatus(ctx, event, o, logger); err != nil {
+		if err := refreshStatus(ctx, event, o, storedStatus, h.statuses, logger); err != nil {
 			logger.Errorf("fail to refresh status: %v", err)
+			checkStaleness(o, logger)
 			return err
 		}
 
+		if blocked {
+			checkStaleness(o, logger)
+		} else if !event.Deleted {
+			metrics.Staleness.Success(o.Namespace, o.Name)
+		}
+		if !event.Deleted {
+			h.syncFleet(o, "", logger)
+		} else if err := h.fleet.sync(logger); err != nil {
+			logger.Errorf("fail to write fleet status: %v", err)
+		}
+
+	case *appv1.Deployment:
+		return h.handleOwned(ctx, o, o.Spec, event.Deleted)
+	case *appv1.StatefulSet:
+		return h.handleOwned(ctx, o, o.Spec, event.Deleted)
+	case *appv1.DaemonSet:
+		return h.handleOwned(ctx, o, o.Spec, event.Deleted)
+	case *corev1.Service:
+		// The load balancer addresses are fingerprinted as well, so the
+		// status.addresses of the nginx follow them
+		return h.handleOwned(ctx, o, []interface{}{o.Spec, o.Status.LoadBalancer}, event.Deleted)
 	}
 	return nil
 }
 
+// syncFleet records the state of the nginx in the fleet status, unhealthy
+// for the given problem or the one found in its status
+func (h *Handler) syncFleet(nginx *v1alpha1.Nginx, problem string, logger *logrus.Entry) {
+	h.fleet.observe(nginx, problem)
+	if err := h.fleet.sync(logger); err != nil {
+		logger.Errorf("fail to write fleet status: %v", err)
+	}
+}
+
+// reconcileBlockedError signals that the reconcile could not complete for a
+// reason reported in the nginx status. The status is still refreshed and the
+// nginx is reconciled again on the next resync.
+type reconcileBlockedError struct {
+	reason string
+}
+
+func (e *reconcileBlockedError) Error() string {
+	return e.reason
+}
+
+// checkStaleness reports instances that have not been successfully reconciled
+// within the staleness threshold
+func checkStaleness(nginx *v1alpha1.Nginx, logger *logrus.Entry) {
+	if !metrics.Staleness.IsStale(nginx.Namespace, nginx.Name) {
+		return
+	}
+	logger.Error("nginx has not been successfully reconciled within the staleness threshold")
+	recordEvent(nginx, corev1.EventTypeWarning, "ReconcileStale", "Nginx has not been successfully reconciled within the staleness threshold", logger)
+}
+
 func reconcile(ctx context.Context, event sdk.Event, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
 	if event.Deleted {
 		// Do nothing because garbage collector will remove created resources using the OwnerReference.
@@ -62,30 +234,290 @@ func reconcile(ctx context.Context, event sdk.Event, nginx *v1alpha1.Nginx, logg
 		return nil
 	}
 
-	if err := reconcileDeployment(ctx, nginx, logger); err != nil {
+	if err := rollbackSpec(nginx, logger); err != nil {
+		return err
+	}
+	// The history keeps the spec as written, without the namespace defaults
+	spec := nginx.Spec.DeepCopy()
+
+	_, span := tracing.Start(ctx, "fetch namespace defaults")
+	effective, err := withNamespaceDefaults(nginx, logger)
+	span.End(err)
+	if err != nil {
+		return err
+	}
+	// The objects are assembled from the effective spec, status changes made
+	// while reconciling are kept in the original nginx, whose status is
+	// refreshed afterwards
+	orig := nginx
+	defer func() { orig.Status = effective.Status }()
+	nginx = effective
+
+	if err := checkDependencies(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := checkApply(nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileConfigTemplate(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileInlineConfig(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileDefaultServer(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileCertificate(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := enforceGuardrails(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := checkPolicies(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := clampReplicas(ctx, nginx, logger); err != nil {
 		return err
 	}
 
-	if err := reconcileService(ctx, nginx); err != nil {
+	if err := reconcileServiceAccount(ctx, nginx, logger); err != nil {
 		return err
 	}
 
+	if err := reconcileWorkload(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcilePodDisruptionBudget(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	checkReplicas(ctx, nginx, logger)
+
+	if err := reconcileVerticalAutoscaler(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileService(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileHeadlessService(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileIngress(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileNetworkPolicy(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileMetricTemplates(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcileServiceMonitor(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if err := reconcilePrometheusRule(ctx, nginx, logger); err != nil {
+		return err
+	}
+
+	if k8s.CachePurgePending(nginx) {
+		request := k8s.CachePurgeRequest(nginx)
+		k8s.RecordCachePurge(&nginx.Status, request, metav1.Now(), k8s.CachePurgeHistory(&nginx.Spec))
+		recordEvent(nginx, corev1.EventTypeNormal, "CachePurged", fmt.Sprintf("Replacing the pods to purge the cache, request %q", request), logger)
+	}
+
+	return recordSpecRevision(nginx, spec, logger)
+}
+
+// checkExtraFile verifies that the key of the ConfigMap or Secret holding
+// the extra file exists
+func checkExtraFile(nginx *v1alpha1.Nginx, f v1alpha1.NginxExtraFile, logger *logrus.Entry) error {
+	kind, name := "config map", f.ConfigMap
+	var found bool
+	var err error
+	if f.Secret != "" {
+		kind, name = "secret", f.Secret
+		secret := &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      f.Secret,
+				Namespace: nginx.Namespace,
+			},
+		}
+		err = sdk.Get(secret)
+		_, found = secret.Data[f.Key]
+	} else {
+		cm := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      f.ConfigMap,
+				Namespace: nginx.Namespace,
+			},
+		}
+		err = sdk.Get(cm)
+		_, found = cm.Data[f.Key]
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to retrieve %s: %v", kind, err)
+	}
+	if err != nil || !found {
+		msg := fmt.Sprintf("Key %q of %s %q not found for extra file %s", f.Key, kind, name, f.Path)
+		recordEvent(nginx, corev1.EventTypeWarning, "ConfigFileNotFound", msg, logger)
+		return fmt.Errorf("missing extra file: %s", msg)
+	}
 	return nil
 }
 
-func reconcileDeployment(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
-	newDeploy, err := k8s.NewDeployment(nginx)
-	if err != nil {
-		return fmt.Errorf("failed to assemble deployment from nginx: %v", err)
+// checkDependencies verifies that the nginx spec is valid and that the
+// objects referenced by it exist before assembling the pods that depend on them
+func checkDependencies(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	if errs := k8s.Validate(nginx); len(errs) > 0 {
+		msg := strings.Join(errs, "; ")
+		recordEvent(nginx, corev1.EventTypeWarning, "InvalidSpec", msg, logger)
+		return fmt.Errorf("invalid nginx spec: %s", msg)
 	}
 
-	err = sdk.Create(newDeploy)
-	if err != nil && !errors.IsAlreadyExists(err) {
-		return fmt.Errorf("failed to create deployment: %v", err)
+	// The secrets checked below may be materialized from external secrets
+	if err := reconcileExternalSecrets(ctx, nginx, logger); err != nil {
+		return err
 	}
 
-	if err == nil {
-		return nil
+	// The config map rendered from the config template is created afterwards
+	if conf := nginx.Spec.Config; conf != nil && conf.Name != "" && conf.Kind != v1alpha1.ConfigKindInline && nginx.Spec.ConfigTemplate == nil {
+		cm := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      conf.Name,
+				Namespace: nginx.Namespace,
+			},
+		}
+		if err := sdk.Get(cm); err != nil {
+			if errors.IsNotFound(err) {
+				recordEvent(nginx, corev1.EventTypeWarning, "ConfigMapNotFound",
+					fmt.Sprintf("Config map %q not found", conf.Name), logger)
+			}
+			return fmt.Errorf("failed to retrieve config map: %v", err)
+		}
+	}
+
+	if err := checkConfigSources(nginx, logger); err != nil {
+		return err
+	}
+
+	for _, f := range nginx.Spec.WithDefaults().ConfigFiles {
+		cm := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      f.ConfigMap,
+				Namespace: nginx.Namespace,
+			},
+		}
+		err := sdk.Get(cm)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to retrieve config map: %v", err)
+		}
+		if _, ok := cm.Data[f.Key]; err != nil || !ok {
+			msg := fmt.Sprintf("Key %q of config map %q not found for config file %s", f.Key, f.ConfigMap, f.Name)
+			recordEvent(nginx, corev1.EventTypeWarning, "ConfigFileNotFound", msg, logger)
+			return fmt.Errorf("missing config file: %s", msg)
+		}
+	}
+	for _, f := range nginx.Spec.WithDefaults().ExtraFiles {
+		if err := checkExtraFile(nginx, f, logger); err != nil {
+			return err
+		}
+	}
+
+	// The certificate secret is waited for while reconciling the certificate
+	if tls := nginx.Spec.TLSSecret; tls != nil && nginx.Spec.Certificates == nil {
+		secret := &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      tls.SecretName,
+				Namespace: nginx.Namespace,
+			},
+		}
+		if err := sdk.Get(secret); err != nil {
+			if errors.IsNotFound(err) {
+				recordEvent(nginx, corev1.EventTypeWarning, "TLSSecretNotFound",
+					fmt.Sprintf("TLS secret %q not found", tls.SecretName), logger)
+			}
+			return fmt.Errorf("failed to retrieve tls secret: %v", err)
+		}
+		nginx.Status.CertificateNotAfter = k8s.CertificateNotAfter(secret.Data[nginx.Spec.WithDefaults().TLSSecret.CertificateField])
+	} else if tls == nil {
+		nginx.Status.CertificateNotAfter = nil
+	}
+
+	return nil
+}
+
+func reconcileWorkload(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	switch nginx.Spec.WorkloadKind {
+	case v1alpha1.WorkloadKindStatefulSet:
+		if err := reconcileStatefulSet(ctx, nginx, logger); err != nil {
+			return err
+		}
+		return deleteReplacedWorkloads(nginx, v1alpha1.WorkloadKindStatefulSet)
+	case v1alpha1.WorkloadKindDaemonSet:
+		if err := reconcileDaemonSet(ctx, nginx, logger); err != nil {
+			return err
+		}
+		return deleteReplacedWorkloads(nginx, v1alpha1.WorkloadKindDaemonSet)
+	case v1alpha1.WorkloadKindRollout:
+		err := reconcileRollout(ctx, nginx, logger)
+		if err == nil {
+			return deleteReplacedWorkloads(nginx, v1alpha1.WorkloadKindRollout)
+		}
+		if !isResourceUnavailable(err) {
+			return err
+		}
+		logger.Warnf("falling back to deployment: %v", err)
+	}
+
+	if err := reconcileDeployment(ctx, nginx, logger); err != nil {
+		return err
+	}
+	return deleteReplacedWorkloads(nginx, v1alpha1.WorkloadKindDeployment)
+}
+
+func reconcileDeployment(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) (err error) {
+	ctx, span := tracing.Start(ctx, "apply deployment")
+	defer func() { endSpan(span, err) }()
+
+	newDeploy, err := k8s.NewDeployment(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to assemble deployment from nginx: %v", err)
 	}
 
 	currDeploy := &appv1.Deployment{
@@ -98,44 +530,232 @@ func reconcileDeployment(ctx context.Context, nginx *v1alpha1.Nginx, logger *log
 			Namespace: newDeploy.Namespace,
 		},
 	}
-	if err := sdk.Get(currDeploy); err != nil {
+	err = fetch(ctx, "fetch deployment", currDeploy)
+	if errors.IsNotFound(err) {
+		span.SetAttributes(tracing.String("apply.action", "create"))
+		if err := checkConfig(nginx, newDeploy, logger); err != nil {
+			return err
+		}
+		if err := createWorkload(nginx, newDeploy); err != nil {
+			return fmt.Errorf("failed to create deployment: %v", err)
+		}
+		recordEvent(nginx, corev1.EventTypeNormal, "DeploymentCreated", fmt.Sprintf("Created deployment %s", newDeploy.Name), logger)
+		return nil
+	}
+	if err != nil {
 		return fmt.Errorf("failed to retrieve deployment: %v", err)
 	}
 
-	currSpec, err := k8s.ExtractNginxSpec(currDeploy.ObjectMeta)
+	_, diffSpan := tracing.Start(ctx, "diff deployment")
+	currHash, err := k8s.CurrentGeneratedHash(nginx, currDeploy, func(n *v1alpha1.Nginx) (metav1.Object, error) {
+		return k8s.NewDeployment(n)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to extract nginx from deployment: %v", err)
+		diffSpan.End(err)
+		return fmt.Errorf("failed to compare deployment with the current one: %v", err)
 	}
+	newHash, _ := k8s.GeneratedHashOf(newDeploy)
+	diffSpan.SetAttributes(tracing.Bool("diff.changed", newHash != currHash))
+	diffSpan.End(nil)
 
-	if reflect.DeepEqual(nginx.Spec, currSpec) {
-		logger.Debug("nothing changed")
-		return nil
+	if err := completeCanary(nginx, newDeploy, currDeploy, currHash, logger); err != nil {
+		return err
 	}
 
-	currDeploy.Spec = newDeploy.Spec
-	if err := k8s.SetNginxSpec(&currDeploy.ObjectMeta, nginx.Spec); err != nil {
-		return fmt.Errorf("failed to set nginx spec into object meta: %v", err)
+	if nginx.Spec.Flagger != nil {
+		// Flagger scales the target deployment during the canary analysis
+		newDeploy.Spec.Replicas = currDeploy.Spec.Replicas
+	}
+
+	// A new cache purge request or a renewed certificate replaces the pods
+	// even if the spec is the same
+	purge := k8s.PodRestartRequested(newDeploy.Spec.Template.Annotations, currDeploy.Spec.Template.Annotations)
+
+	var drift []string
+	if newHash != currHash {
+		if err := checkConfig(nginx, newDeploy, logger); err != nil {
+			return err
+		}
+		if newHash.Template != currHash.Template {
+			if err := checkCanary(nginx, newDeploy, logger); err != nil {
+				return err
+			}
+			if k8s.CanaryRolloutEnabled(nginx) {
+				if err := rolloutCanary(nginx, newDeploy, currDeploy, logger); err != nil {
+					return err
+				}
+			}
+		}
+	} else if !purge {
+		drift = k8s.DeploymentDrift(newDeploy, currDeploy)
+		if len(drift) == 0 {
+			logger.Debug("nothing changed")
+			span.SetAttributes(tracing.String("apply.action", "none"))
+			return recordGeneratedHash(nginx, currDeploy, newDeploy)
+		}
+		span.SetAttributes(tracing.String("diff.drift", strings.Join(drift, ",")))
 	}
+	span.SetAttributes(tracing.String("apply.action", "update"))
 
-	if err := sdk.Update(currDeploy); err != nil {
+	currDeploy.Spec = newDeploy.Spec
+	k8s.CopyGeneratedHash(currDeploy, newDeploy)
+	k8s.MergeMetadata(currDeploy, newDeploy)
+
+	if err := updateWorkload(nginx, currDeploy); err != nil {
 		return fmt.Errorf("failed to update deployment: %v", err)
 	}
 
+	if len(drift) > 0 {
+		recordEvent(nginx, corev1.EventTypeNormal, "DriftCorrected",
+			fmt.Sprintf("Deployment %s was modified out of band, restored fields: %s", currDeploy.Name, strings.Join(drift, ", ")), logger)
+	} else {
+		recordEvent(nginx, corev1.EventTypeNormal, "DeploymentUpdated", fmt.Sprintf("Updated deployment %s", currDeploy.Name), logger)
+	}
+
+	// The deployment replaces the canary pods once they are verified
+	if nginx.Status.GetCondition(v1alpha1.NginxConditionCanaryVerified) != nil {
+		if err := deleteCanaryPods(nginx); err != nil {
+			logger.Warnf("failed to delete canary pods: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// workload is a typed workload generated for the nginx
+type workload interface {
+	runtime.Object
+	metav1.Object
+}
+
+// recordGeneratedHash annotates the current workload with the generated hash
+// of the desired one, without changing its spec, when it was created by an
+// older operator version. The custom labels and annotations it lacks are
+// added as well.
+func recordGeneratedHash(nginx *v1alpha1.Nginx, current, desired workload) error {
+	if _, ok := k8s.GeneratedHashOf(current); ok && !k8s.MetadataDrift(desired, current) {
+		return nil
+	}
+	k8s.CopyGeneratedHash(current, desired)
+	k8s.MergeMetadata(current, desired)
+	if err := updateWorkload(nginx, current); err != nil {
+		return fmt.Errorf("failed to record generated hash: %v", err)
+	}
 	return nil
 }
 
-func reconcileService(ctx context.Context, nginx *v1alpha1.Nginx) error {
+func reconcileService(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) (err error) {
+	ctx, span := tracing.Start(ctx, "apply service")
+	defer func() { endSpan(span, err) }()
+
 	service := k8s.NewService(nginx)
 
-	err := sdk.Create(service)
-	if errors.IsAlreadyExists(err) {
+	err = createService(nginx, service)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create service: %v", err)
+	}
+
+	if err == nil {
+		span.SetAttributes(tracing.String("apply.action", "create"))
+		recordEvent(nginx, corev1.EventTypeNormal, "ServiceCreated", fmt.Sprintf("Created service %s", service.Name), logger)
+		return nil
+	}
+
+	updated, err := reconcileIPFamilies(nginx, service)
+	if err != nil {
+		return err
+	}
+	if updated {
+		recordEvent(nginx, corev1.EventTypeNormal, "ServiceUpdated", fmt.Sprintf("Updated IP families of service %s", service.Name), logger)
+	}
+
+	currService := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      service.Name,
+			Namespace: service.Namespace,
+		},
+	}
+	if err := fetch(ctx, "fetch service", currService); err != nil {
+		return fmt.Errorf("failed to retrieve service: %v", err)
+	}
+
+	_, diffSpan := tracing.Start(ctx, "diff service")
+	drift := k8s.ServiceDrift(service, currService)
+	metadataDrift := k8s.MetadataDrift(service, currService)
+	diffSpan.SetAttributes(tracing.Bool("diff.changed", len(drift) > 0 || metadataDrift))
+	diffSpan.End(nil)
+	if len(drift) == 0 && !metadataDrift {
+		span.SetAttributes(tracing.String("apply.action", "none"))
 		return nil
 	}
+	span.SetAttributes(tracing.String("apply.action", "update"))
+	if len(drift) > 0 {
+		span.SetAttributes(tracing.String("diff.drift", strings.Join(drift, ",")))
+	}
+
+	k8s.RestoreService(currService, service)
+	k8s.MergeMetadata(currService, service)
+	if err := sdk.Update(currService); err != nil {
+		return fmt.Errorf("failed to update service: %v", err)
+	}
 
+	if len(drift) > 0 {
+		recordEvent(nginx, corev1.EventTypeNormal, "DriftCorrected",
+			fmt.Sprintf("Service %s was modified out of band, restored fields: %s", currService.Name, strings.Join(drift, ", ")), logger)
+	} else {
+		recordEvent(nginx, corev1.EventTypeNormal, "ServiceUpdated", fmt.Sprintf("Updated service %s", currService.Name), logger)
+	}
+
+	return nil
+}
+
+func reconcileMetricTemplates(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	for _, template := range k8s.NewMetricTemplates(nginx) {
+		err := reconcileUnstructured(template)
+		if isResourceUnavailable(err) {
+			logger.Warnf("skipping flagger metric templates: %v", err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reconcileServiceMonitor(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	sm := k8s.NewServiceMonitor(nginx)
+	if sm == nil {
+		return nil
+	}
+	err := reconcileUnstructured(sm)
+	if isResourceUnavailable(err) {
+		logger.Warnf("skipping service monitor: %v", err)
+		return nil
+	}
 	return err
 }
 
-func refreshStatus(ctx context.Context, event sdk.Event, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+func reconcilePrometheusRule(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	rule := k8s.NewPrometheusRule(nginx)
+	if rule == nil {
+		return nil
+	}
+	err := reconcileUnstructured(rule)
+	if isResourceUnavailable(err) {
+		logger.Warnf("skipping prometheus rule: %v", err)
+		return nil
+	}
+	return err
+}
+
+// refreshStatus writes the status of the nginx, including the changes made to
+// it during the reconcile, comparing it with the stored status.
+func refreshStatus(ctx context.Context, event sdk.Event, nginx *v1alpha1.Nginx, stored v1alpha1.NginxStatus, statuses *statusWriter, logger *logrus.Entry) error {
 	if event.Deleted {
 		logger.Debug("nginx deleted, skipping status update")
 		return nil
@@ -151,21 +771,30 @@ func refreshStatus(ctx context.Context, event sdk.Event, nginx *v1alpha1.Nginx,
 		return fmt.Errorf("failed to list services for nginx: %v", err)
 	}
 
-	sort.Slice(nginx.Status.Pods, func(i, j int) bool {
-		return nginx.Status.Pods[i].Name < nginx.Status.Pods[j].Name
-	})
+	status := *nginx.Status.DeepCopy()
+	status.Pods = pods
+	status.Services = services
+	if status.Addresses, err = dnsAddresses(nginx); err != nil {
+		return fmt.Errorf("failed to retrieve load balancer addresses for nginx: %v", err)
+	}
+	if err := refreshServiceStatus(nginx, &status, logger); err != nil {
+		return fmt.Errorf("failed to refresh service status for nginx: %v", err)
+	}
+	if err := refreshDeploymentStatus(nginx, &status); err != nil {
+		return fmt.Errorf("failed to refresh deployment status for nginx: %v", err)
+	}
+	if err := refreshEndpoints(nginx, &status, logger); err != nil {
+		return fmt.Errorf("failed to refresh endpoints for nginx: %v", err)
+	}
 
-	sort.Slice(nginx.Status.Services, func(i, j int) bool {
-		return nginx.Status.Services[i].Name < nginx.Status.Services[j].Name
-	})
+	now := metav1.Now()
+	// Paused instances are not reconciled
+	if !nginx.Spec.Paused && (status.LastReconcileTime == nil || now.Sub(status.LastReconcileTime.Time) >= lastReconcileTimeResolution) {
+		status.LastReconcileTime = &now
+	}
 
-	if !reflect.DeepEqual(pods, nginx.Status.Pods) || !reflect.DeepEqual(services, nginx.Status.Services) {
-		nginx.Status.Pods = pods
-		nginx.Status.Services = services
-		err := sdk.Update(nginx)
-		if err != nil {
-			return fmt.Errorf("failed to update nginx status: %v", err)
-		}
+	if err := statuses.update(nginx, stored, status, logger); err != nil {
+		return fmt.Errorf("failed to update nginx status: %v", err)
 	}
 
 	return nil
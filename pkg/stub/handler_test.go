@@ -0,0 +1,256 @@
+package stub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+	"github.com/tsuru/nginx-operator/pkg/stub/internal/fakeapi"
+	"github.com/tsuru/nginx-operator/pkg/webhook"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	k8sutil.AddToSDKScheme(v1alpha1.AddToScheme)
+}
+
+// newTestHandler returns a handler working on an empty fake API with the
+// default namespace
+func newTestHandler(t *testing.T) *Handler {
+	fakeapi.Reset()
+	ns := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+	}
+	assert.Nil(t, sdk.Create(ns))
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return NewHandler(logger).(*Handler)
+}
+
+// createNginx stores the nginx as my-nginx in the default namespace of the
+// fake API, returning it as stored
+func createNginx(t *testing.T, nginx *v1alpha1.Nginx) *v1alpha1.Nginx {
+	nginx.TypeMeta = metav1.TypeMeta{Kind: "Nginx", APIVersion: v1alpha1.SchemeGroupVersion.String()}
+	nginx.Name, nginx.Namespace = "my-nginx", "default"
+	assert.Nil(t, sdk.Create(nginx))
+	return storedNginx(t, nginx)
+}
+
+// storedNginx returns the nginx as stored in the fake API
+func storedNginx(t *testing.T, nginx *v1alpha1.Nginx) *v1alpha1.Nginx {
+	stored := &v1alpha1.Nginx{
+		TypeMeta:   metav1.TypeMeta{Kind: "Nginx", APIVersion: v1alpha1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: nginx.Name, Namespace: nginx.Namespace},
+	}
+	assert.Nil(t, sdk.Get(stored))
+	return stored
+}
+
+// admitNginx returns the nginx as patched by the defaulting webhook
+func admitNginx(t *testing.T, nginx *v1alpha1.Nginx) *v1alpha1.Nginx {
+	object, err := json.Marshal(nginx)
+	assert.Nil(t, err)
+	review, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "admission.k8s.io/v1beta1",
+		"kind":       "AdmissionReview",
+		"request": map[string]interface{}{
+			"uid":       "123",
+			"namespace": nginx.Namespace,
+			"operation": "CREATE",
+			"object":    json.RawMessage(object),
+		},
+	})
+	assert.Nil(t, err)
+	rec := httptest.NewRecorder()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	webhook.NewServeMux(logger).ServeHTTP(rec, httptest.NewRequest("POST", webhook.DefaultPath, bytes.NewReader(review)))
+	var got struct {
+		Response struct {
+			Allowed bool   `json:"allowed"`
+			Patch   []byte `json:"patch"`
+		} `json:"response"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.True(t, got.Response.Allowed)
+	admitted := nginx.DeepCopy()
+	if got.Response.Patch == nil {
+		return admitted
+	}
+	var patch []struct {
+		Op    string             `json:"op"`
+		Path  string             `json:"path"`
+		Value v1alpha1.NginxSpec `json:"value"`
+	}
+	assert.Nil(t, json.Unmarshal(got.Response.Patch, &patch))
+	for _, op := range patch {
+		assert.Equal(t, "replace", op.Op)
+		assert.Equal(t, "/spec", op.Path)
+		admitted.Spec = op.Value
+	}
+	return admitted
+}
+
+func TestHandlePersistsStatus(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15"}})
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+
+	stored := storedNginx(t, nginx)
+	assert.Equal(t, int64(1), stored.Status.SpecRevision)
+	if assert.Len(t, stored.Status.SpecHistory, 1) {
+		assert.Equal(t, int64(1), stored.Status.SpecHistory[0].Revision)
+	}
+	assert.Equal(t, 1, fakeapi.Count("Deployment"))
+}
+
+func TestHandlePersistsPendingApply(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15", ApplyMode: v1alpha1.ApplyModeManual}})
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+
+	stored := storedNginx(t, nginx)
+	if assert.NotNil(t, stored.Status.PendingApply) {
+		assert.NotEmpty(t, stored.Status.PendingApply.Revision)
+		assert.NotEmpty(t, stored.Status.PendingApply.Changes)
+	}
+	assert.Equal(t, 0, fakeapi.Count("Deployment"))
+}
+
+func TestHandlePersistsDegradedCondition(t *testing.T) {
+	defer SetGuardrails(k8s.Guardrails{})
+	assert.Nil(t, SetGuardrails(k8s.Guardrails{AllowedRegistries: []string{"quay.io"}}))
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15"}})
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+
+	stored := storedNginx(t, nginx)
+	condition := stored.Status.GetCondition(v1alpha1.NginxConditionDegraded)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, "GuardrailsRejected", condition.Reason)
+	}
+	assert.Equal(t, 0, fakeapi.Count("Deployment"))
+}
+
+func TestHandlePersistsCachePurge(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{k8s.CachePurgeAnnotation: "purge-1"}},
+		Spec:       v1alpha1.NginxSpec{Image: "nginx:1.15"},
+	})
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+
+	stored := storedNginx(t, nginx)
+	if assert.Len(t, stored.Status.CachePurges, 1) {
+		assert.Equal(t, "purge-1", stored.Status.CachePurges[0].ID)
+	}
+	assert.False(t, k8s.CachePurgePending(stored))
+}
+
+// The render command must print the objects the handler creates, including
+// the references to the generated certificate secret and config map
+func TestHandleMatchesRender(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha1.NginxSpec
+	}{
+		{
+			name: "certificates",
+			spec: v1alpha1.NginxSpec{
+				Image: "nginx:1.15",
+				Certificates: &v1alpha1.NginxCertificates{
+					IssuerRef: v1alpha1.CertificateIssuerRef{Name: "letsencrypt"},
+					DNSNames:  []string{"example.com"},
+				},
+			},
+		},
+		{
+			name: "config template",
+			spec: v1alpha1.NginxSpec{
+				Image:          "nginx:1.15",
+				ConfigTemplate: &v1alpha1.NginxConfigTemplate{Inline: "events {}\nhttp { server { listen {{ .HTTPPort }}; } }\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			nginx := createNginx(t, &v1alpha1.Nginx{Spec: tt.spec})
+			secret := &corev1.Secret{
+				TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-tls", Namespace: "default"},
+				Data:       map[string][]byte{"tls.crt": []byte("certificate"), "tls.key": []byte("key")},
+			}
+			assert.Nil(t, sdk.Create(secret))
+
+			assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+
+			objects, _, err := k8s.Render(nginx)
+			assert.Nil(t, err)
+			var rendered []string
+			for _, o := range objects {
+				switch want := o.(type) {
+				case *appv1.Deployment:
+					got := &appv1.Deployment{TypeMeta: want.TypeMeta, ObjectMeta: metav1.ObjectMeta{Name: want.Name, Namespace: want.Namespace}}
+					assert.Nil(t, sdk.Get(got))
+					assert.Equal(t, want.Spec.Template.Spec, got.Spec.Template.Spec)
+				case *corev1.ConfigMap:
+					got := &corev1.ConfigMap{TypeMeta: want.TypeMeta, ObjectMeta: metav1.ObjectMeta{Name: want.Name, Namespace: want.Namespace}}
+					assert.Nil(t, sdk.Get(got))
+					assert.Equal(t, want.Data, got.Data)
+				default:
+					continue
+				}
+				rendered = append(rendered, o.GetObjectKind().GroupVersionKind().Kind)
+			}
+			assert.Contains(t, rendered, "Deployment")
+		})
+	}
+}
+
+// The defaults written by the webhook must leave the namespace defaults to
+// the reconciliation
+func TestHandleAppliesNamespaceDefaultsAfterWebhook(t *testing.T) {
+	h := newTestHandler(t)
+	ns := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+	}
+	assert.Nil(t, sdk.Get(ns))
+	ns.Annotations = map[string]string{k8s.DefaultImageAnnotation: "registry.example.com/nginx:1.25"}
+	assert.Nil(t, sdk.Update(ns))
+
+	nginx := admitNginx(t, &v1alpha1.Nginx{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx", Namespace: "default"},
+		Spec:       v1alpha1.NginxSpec{Service: &v1alpha1.NginxServiceSpec{}},
+	})
+	assert.Equal(t, corev1.ServiceTypeClusterIP, nginx.Spec.Service.Type)
+	nginx = createNginx(t, nginx)
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+
+	dep := &appv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-deployment", Namespace: "default"},
+	}
+	assert.Nil(t, sdk.Get(dep))
+	assert.Equal(t, "registry.example.com/nginx:1.25", dep.Spec.Template.Spec.Containers[0].Image)
+}
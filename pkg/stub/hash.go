@@ -0,0 +1,124 @@
+package stub
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fullReconcileInterval is the maximum time an unchanged nginx goes without a
+// full reconcile of its objects, bounding how long out of band changes to them
+// take to be reverted.
+const fullReconcileInterval = 5 * time.Minute
+
+type appliedSpec struct {
+	hash      string
+	children  string
+	appliedAt time.Time
+}
+
+// specHashCache keeps the hash of the last spec successfully applied for each
+// nginx, allowing periodic resyncs to skip rebuilding and comparing objects
+// when nothing changed. Along with the hash, it keeps a fingerprint of the
+// workload and service of the nginx, so deleting them or changing them out of
+// band is reverted on the next resync, even when the generated objects are
+// not watched.
+type specHashCache struct {
+	mu      sync.Mutex
+	applied map[types.UID]appliedSpec
+}
+
+func newSpecHashCache() *specHashCache {
+	return &specHashCache{applied: make(map[types.UID]appliedSpec)}
+}
+
+// upToDate returns whether the nginx spec was applied recently and neither
+// the spec nor the workload and service of the nginx changed since
+func (c *specHashCache) upToDate(nginx *v1alpha1.Nginx) bool {
+	hash, err := k8s.SpecHash(nginx.Spec)
+	if err != nil {
+		return false
+	}
+	c.mu.Lock()
+	last, ok := c.applied[nginx.UID]
+	c.mu.Unlock()
+	if !ok || last.hash != hash || time.Since(last.appliedAt) >= fullReconcileInterval {
+		return false
+	}
+	children, ok := childrenFingerprint(nginx)
+	return ok && children == last.children
+}
+
+// set records the nginx spec as applied, along with the current workload
+// and service. Nothing is recorded while any of them is missing, like before
+// the spec of a manually applied nginx is approved.
+func (c *specHashCache) set(nginx *v1alpha1.Nginx) {
+	hash, err := k8s.SpecHash(nginx.Spec)
+	if err != nil {
+		return
+	}
+	children, ok := childrenFingerprint(nginx)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.applied[nginx.UID] = appliedSpec{hash: hash, children: children, appliedAt: time.Now()}
+}
+
+// forget removes the nginx from the cache
+func (c *specHashCache) forget(nginx *v1alpha1.Nginx) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.applied, nginx.UID)
+}
+
+// childrenFingerprint returns the fingerprint of the identity, metadata and
+// spec of the workload and service of the nginx, false when any of them
+// cannot be retrieved
+func childrenFingerprint(nginx *v1alpha1.Nginx) (string, bool) {
+	var fingerprints []string
+	for _, child := range nginxChildren(nginx) {
+		client, _, err := k8sclient.GetResourceClient(child.apiVersion, child.kind, nginx.Namespace)
+		if err != nil {
+			return "", false
+		}
+		obj, err := client.Get(child.name, metav1.GetOptions{})
+		if err != nil {
+			return "", false
+		}
+		fingerprints = append(fingerprints, string(obj.GetUID())+":"+ownedFingerprint(obj, obj.Object["spec"]))
+	}
+	return strings.Join(fingerprints, ","), true
+}
+
+type nginxChild struct {
+	apiVersion string
+	kind       string
+	name       string
+}
+
+// nginxChildren returns the workload and service generated for the nginx.
+// Rollouts fall back to deployments when their CRD is not installed, as in
+// reconcileWorkload.
+func nginxChildren(nginx *v1alpha1.Nginx) []nginxChild {
+	workload := nginxChild{"apps/v1", "Deployment", nginx.Name + "-deployment"}
+	switch nginx.Spec.WorkloadKind {
+	case v1alpha1.WorkloadKindStatefulSet:
+		workload = nginxChild{"apps/v1", "StatefulSet", nginx.Name + "-statefulset"}
+	case v1alpha1.WorkloadKindDaemonSet:
+		workload = nginxChild{"apps/v1", "DaemonSet", nginx.Name + "-daemonset"}
+	case v1alpha1.WorkloadKindRollout:
+		if _, _, err := k8sclient.GetResourceClient(k8s.RolloutAPIVersion, k8s.RolloutKind, nginx.Namespace); err == nil {
+			workload = nginxChild{k8s.RolloutAPIVersion, k8s.RolloutKind, nginx.Name + "-deployment"}
+		}
+	}
+	return []nginxChild{workload, {"v1", "Service", nginx.Name + "-service"}}
+}
@@ -0,0 +1,47 @@
+package stub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/stub/internal/fakeapi"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/assert"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSpecHashCacheChildren(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15"}})
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+	assert.True(t, h.specHashes.upToDate(storedNginx(t, nginx)))
+
+	dep := &appv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-deployment", Namespace: "default"},
+	}
+	assert.Nil(t, sdk.Get(dep))
+	dep.Spec.Template.Spec.Containers[0].Image = "nginx:latest"
+	assert.Nil(t, sdk.Update(dep))
+	assert.False(t, h.specHashes.upToDate(storedNginx(t, nginx)))
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: storedNginx(t, nginx)}))
+	assert.Nil(t, sdk.Get(dep))
+	assert.Equal(t, "nginx:1.15", dep.Spec.Template.Spec.Containers[0].Image)
+	assert.True(t, h.specHashes.upToDate(storedNginx(t, nginx)))
+
+	assert.Nil(t, sdk.Delete(dep))
+	assert.False(t, h.specHashes.upToDate(storedNginx(t, nginx)))
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: storedNginx(t, nginx)}))
+	assert.Equal(t, 1, fakeapi.Count("Deployment"))
+}
+
+func TestSpecHashCacheMissingChildren(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15", ApplyMode: v1alpha1.ApplyModeManual}})
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+	assert.False(t, h.specHashes.upToDate(storedNginx(t, nginx)))
+}
@@ -0,0 +1,94 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileHeadlessService creates the headless service of the nginx,
+// deleting it when it is no longer requested
+func reconcileHeadlessService(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	service := k8s.NewHeadlessService(nginx)
+	if service == nil {
+		return deleteHeadlessService(nginx, logger)
+	}
+
+	err := createService(nginx, service)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create headless service: %v", err)
+	}
+
+	if err == nil {
+		recordEvent(nginx, corev1.EventTypeNormal, "ServiceCreated", fmt.Sprintf("Created headless service %s", service.Name), logger)
+		return nil
+	}
+
+	updated, err := reconcileIPFamilies(nginx, service)
+	if err != nil {
+		return err
+	}
+	if updated {
+		recordEvent(nginx, corev1.EventTypeNormal, "ServiceUpdated", fmt.Sprintf("Updated IP families of headless service %s", service.Name), logger)
+	}
+
+	currService := &corev1.Service{
+		TypeMeta:   service.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+	}
+	if err := sdk.Get(currService); err != nil {
+		return fmt.Errorf("failed to retrieve headless service: %v", err)
+	}
+
+	drift := k8s.ServiceDrift(service, currService)
+	if len(drift) == 0 && !k8s.MetadataDrift(service, currService) {
+		return nil
+	}
+
+	k8s.RestoreService(currService, service)
+	k8s.MergeMetadata(currService, service)
+	if err := sdk.Update(currService); err != nil {
+		return fmt.Errorf("failed to update headless service: %v", err)
+	}
+
+	if len(drift) > 0 {
+		recordEvent(nginx, corev1.EventTypeNormal, "DriftCorrected",
+			fmt.Sprintf("Service %s was modified out of band, restored fields: %s", currService.Name, strings.Join(drift, ", ")), logger)
+	} else {
+		recordEvent(nginx, corev1.EventTypeNormal, "ServiceUpdated", fmt.Sprintf("Updated headless service %s", currService.Name), logger)
+	}
+	return nil
+}
+
+// deleteHeadlessService removes the headless service previously created for
+// the nginx, if any
+func deleteHeadlessService(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	service := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-headless",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(service, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete headless service: %v", err)
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, "ServiceDeleted", fmt.Sprintf("Deleted headless service %s", service.Name), logger)
+	return nil
+}
@@ -0,0 +1,88 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileIngress creates or updates the ingress of the nginx, deleting it
+// when the ingress is no longer requested.
+func reconcileIngress(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	ingress := k8s.NewIngress(nginx)
+	if ingress == nil {
+		return deleteIngress(nginx, logger)
+	}
+
+	err := sdk.Create(ingress)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create ingress: %v", err)
+	}
+
+	if err == nil {
+		recordEvent(nginx, corev1.EventTypeNormal, "IngressCreated", fmt.Sprintf("Created ingress %s", ingress.Name), logger)
+		return nil
+	}
+
+	currIngress := &extv1beta1.Ingress{
+		TypeMeta:   ingress.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: ingress.Name, Namespace: ingress.Namespace},
+	}
+	if err := sdk.Get(currIngress); err != nil {
+		return fmt.Errorf("failed to retrieve ingress: %v", err)
+	}
+
+	if !k8s.ShouldUpdate(currIngress, ingress) && !k8s.MetadataDrift(ingress, currIngress) {
+		return nil
+	}
+
+	currIngress.Spec = ingress.Spec
+	k8s.MergeMetadata(currIngress, ingress)
+	if class, ok := ingress.Annotations[k8s.IngressClassAnnotation]; ok {
+		if currIngress.Annotations == nil {
+			currIngress.Annotations = make(map[string]string)
+		}
+		currIngress.Annotations[k8s.IngressClassAnnotation] = class
+	} else {
+		delete(currIngress.Annotations, k8s.IngressClassAnnotation)
+	}
+	k8s.RestoreExternalDNS(currIngress, ingress)
+	if err := sdk.Update(currIngress); err != nil {
+		return fmt.Errorf("failed to update ingress: %v", err)
+	}
+
+	recordEvent(nginx, corev1.EventTypeNormal, "IngressUpdated", fmt.Sprintf("Updated ingress %s", currIngress.Name), logger)
+	return nil
+}
+
+// deleteIngress removes the ingress previously created for the nginx, if any
+func deleteIngress(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	ingress := &extv1beta1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: "extensions/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-ingress",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(ingress, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete ingress: %v", err)
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, "IngressDeleted", fmt.Sprintf("Deleted ingress %s", ingress.Name), logger)
+	return nil
+}
@@ -0,0 +1,80 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileInlineConfig writes the inline config of the nginx into the
+// config map it owns, deleting the config map when the config is no longer
+// inline. It runs before the workload and the config validation job, which
+// mount it.
+func reconcileInlineConfig(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	return reconcileOwnedConfigMap(nginx, k8s.NewInlineConfigMap(nginx), k8s.InlineConfigName(nginx), "inline config map", "InlineConfigConflict", logger)
+}
+
+// reconcileOwnedConfigMap creates the config map generated for the nginx or
+// updates its data. A nil config map deletes the one with the given name, if
+// it is owned by the nginx. Config maps of the same name not owned by the
+// nginx are left as they are and reported with the conflict reason.
+func reconcileOwnedConfigMap(nginx *v1alpha1.Nginx, cm *corev1.ConfigMap, name, kind, conflictReason string, logger *logrus.Entry) error {
+	if cm == nil {
+		curr := &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: nginx.Namespace},
+		}
+		err := sdk.Get(curr)
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retrieve %s: %v", kind, err)
+		}
+		if !metav1.IsControlledBy(curr, nginx) {
+			return nil
+		}
+		if err := sdk.Delete(curr); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s: %v", kind, err)
+		}
+		return nil
+	}
+
+	err := sdk.Create(cm)
+	if err == nil {
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create %s: %v", kind, err)
+	}
+	curr := &corev1.ConfigMap{
+		TypeMeta:   cm.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: cm.Name, Namespace: cm.Namespace},
+	}
+	if err := sdk.Get(curr); err != nil {
+		return fmt.Errorf("failed to retrieve %s: %v", kind, err)
+	}
+	if !metav1.IsControlledBy(curr, nginx) {
+		msg := fmt.Sprintf("Config map %q already exists and is not owned by the nginx", cm.Name)
+		recordEvent(nginx, corev1.EventTypeWarning, conflictReason, msg, logger)
+		return fmt.Errorf("%s conflict: %s", kind, msg)
+	}
+	if reflect.DeepEqual(curr.Data, cm.Data) && !k8s.MetadataDrift(cm, curr) {
+		return nil
+	}
+	curr.Data = cm.Data
+	k8s.MergeMetadata(curr, cm)
+	if err := sdk.Update(curr); err != nil {
+		return fmt.Errorf("failed to update %s: %v", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,534 @@
+// Package fakeapi serves an in-memory Kubernetes API for the tests of
+// pkg/stub.
+//
+// The operator-sdk client reads its kubeconfig and fetches the discovery
+// information when its package is initialized, so the server is started and
+// KUBERNETES_CONFIG pointed to it by the init of this package. It only
+// imports the standard library, which the client imports as well, so it is
+// initialized before the client: packages are initialized in import path
+// order once their imports are.
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resource is a kind served by the fake API
+type Resource struct {
+	Group      string
+	Version    string
+	Kind       string
+	Plural     string
+	Namespaced bool
+}
+
+// Resources are the kinds served by the fake API. Other kinds, like the ones
+// of most third party CRDs, are not installed.
+var Resources = []Resource{
+	{"", "v1", "Pod", "pods", true},
+	{"", "v1", "Service", "services", true},
+	{"", "v1", "Endpoints", "endpoints", true},
+	{"", "v1", "ConfigMap", "configmaps", true},
+	{"", "v1", "Secret", "secrets", true},
+	{"", "v1", "ServiceAccount", "serviceaccounts", true},
+	{"", "v1", "Event", "events", true},
+	{"", "v1", "PersistentVolumeClaim", "persistentvolumeclaims", true},
+	{"", "v1", "LimitRange", "limitranges", true},
+	{"", "v1", "ResourceQuota", "resourcequotas", true},
+	{"", "v1", "Namespace", "namespaces", false},
+	{"", "v1", "Node", "nodes", false},
+	{"apps", "v1", "Deployment", "deployments", true},
+	{"apps", "v1", "StatefulSet", "statefulsets", true},
+	{"apps", "v1", "DaemonSet", "daemonsets", true},
+	{"apps", "v1", "ReplicaSet", "replicasets", true},
+	{"apps", "v1", "ControllerRevision", "controllerrevisions", true},
+	{"extensions", "v1beta1", "Ingress", "ingresses", true},
+	{"batch", "v1", "Job", "jobs", true},
+	{"policy", "v1beta1", "PodDisruptionBudget", "poddisruptionbudgets", true},
+	{"networking.k8s.io", "v1", "NetworkPolicy", "networkpolicies", true},
+	{"rbac.authorization.k8s.io", "v1", "Role", "roles", true},
+	{"rbac.authorization.k8s.io", "v1", "RoleBinding", "rolebindings", true},
+	{"autoscaling", "v1", "HorizontalPodAutoscaler", "horizontalpodautoscalers", true},
+	{"scheduling.k8s.io", "v1beta1", "PriorityClass", "priorityclasses", false},
+	{"cert-manager.io", "v1", "Certificate", "certificates", true},
+	{"nginx.tsuru.io", "v1alpha1", "Nginx", "nginxs", true},
+	{"nginx.tsuru.io", "v1alpha1", "NginxFleetStatus", "nginxfleetstatuses", false},
+}
+
+func (r Resource) apiVersion() string {
+	if r.Group == "" {
+		return r.Version
+	}
+	return r.Group + "/" + r.Version
+}
+
+type object = map[string]interface{}
+
+// server is the in-memory API, objects are keyed by resource, namespace and
+// name
+type server struct {
+	mu              sync.Mutex
+	objects         map[string]object
+	resourceVersion int
+	uid             int
+}
+
+var api = &server{objects: make(map[string]object)}
+
+func init() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	dir, err := ioutil.TempDir("", "fakeapi")
+	if err != nil {
+		panic(err)
+	}
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: fake
+  cluster:
+    server: http://%s
+contexts:
+- name: fake
+  context:
+    cluster: fake
+current-context: fake
+`, listener.Addr())
+	if err := ioutil.WriteFile(kubeconfig, []byte(config), 0600); err != nil {
+		panic(err)
+	}
+	os.Setenv("KUBERNETES_CONFIG", kubeconfig)
+	go http.Serve(listener, api)
+}
+
+// Reset removes every object
+func Reset() {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.objects = make(map[string]object)
+}
+
+// Count returns the number of objects of the kind, in every namespace
+func Count(kind string) int {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	count := 0
+	for _, o := range api.objects {
+		if o["kind"] == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/api":
+		writeJSON(w, http.StatusOK, object{"kind": "APIVersions", "versions": []string{"v1"}})
+		return
+	case r.URL.Path == "/apis":
+		writeJSON(w, http.StatusOK, groupList())
+		return
+	case parts[0] == "api" && len(parts) == 2:
+		writeJSON(w, http.StatusOK, resourceList("", parts[1]))
+		return
+	case parts[0] == "apis" && len(parts) == 3:
+		writeJSON(w, http.StatusOK, resourceList(parts[1], parts[2]))
+		return
+	}
+
+	var group, version string
+	var rest []string
+	switch {
+	case parts[0] == "api" && len(parts) > 2:
+		version, rest = parts[1], parts[2:]
+	case parts[0] == "apis" && len(parts) > 3:
+		group, version, rest = parts[1], parts[2], parts[3:]
+	default:
+		writeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+		return
+	}
+	namespace := ""
+	if rest[0] == "namespaces" && len(rest) > 2 {
+		namespace, rest = rest[1], rest[2:]
+	}
+	var res *Resource
+	for i := range Resources {
+		if Resources[i].Group == group && Resources[i].Version == version && Resources[i].Plural == rest[0] {
+			res = &Resources[i]
+		}
+	}
+	// The eviction of pods is the only subresource served
+	evict := res != nil && res.Plural == "pods" && len(rest) == 3 && rest[2] == "eviction"
+	if res == nil || len(rest) > 2 && !evict {
+		writeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+		return
+	}
+	name := ""
+	if len(rest) >= 2 {
+		name = rest[1]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case evict && r.Method == http.MethodPost:
+		s.evict(w, res, namespace, name)
+	case evict:
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "the server does not allow this method on the requested resource")
+	case r.Method == http.MethodGet && name == "":
+		s.list(w, r, res, namespace)
+	case r.Method == http.MethodGet:
+		s.get(w, res, namespace, name)
+	case r.Method == http.MethodPost && name == "":
+		s.create(w, r, res, namespace)
+	case r.Method == http.MethodPut && name != "":
+		s.update(w, r, res, namespace, name)
+	case r.Method == http.MethodPatch && name != "":
+		s.patch(w, r, res, namespace, name)
+	case r.Method == http.MethodDelete && name != "":
+		s.delete(w, res, namespace, name)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "the server does not allow this method on the requested resource")
+	}
+}
+
+func groupList() object {
+	var groups []object
+	seen := make(map[string]bool)
+	for _, res := range Resources {
+		if res.Group == "" || seen[res.Group] {
+			continue
+		}
+		seen[res.Group] = true
+		version := object{"groupVersion": res.apiVersion(), "version": res.Version}
+		groups = append(groups, object{
+			"name":             res.Group,
+			"versions":         []object{version},
+			"preferredVersion": version,
+		})
+	}
+	return object{"kind": "APIGroupList", "apiVersion": "v1", "groups": groups}
+}
+
+func resourceList(group, version string) object {
+	var resources []object
+	for _, res := range Resources {
+		if res.Group != group || res.Version != version {
+			continue
+		}
+		resources = append(resources, object{
+			"name":         res.Plural,
+			"singularName": strings.ToLower(res.Kind),
+			"namespaced":   res.Namespaced,
+			"kind":         res.Kind,
+			"verbs":        []string{"create", "delete", "get", "list", "patch", "update", "watch"},
+		})
+	}
+	return object{"kind": "APIResourceList", "apiVersion": "v1", "groupVersion": Resource{Group: group, Version: version}.apiVersion(), "resources": resources}
+}
+
+// resource returns the served resource with the plural
+func resource(plural string) *Resource {
+	for i := range Resources {
+		if Resources[i].Plural == plural {
+			return &Resources[i]
+		}
+	}
+	return nil
+}
+
+func key(res *Resource, namespace, name string) string {
+	return res.Group + "/" + res.Plural + "/" + namespace + "/" + name
+}
+
+func (s *server) list(w http.ResponseWriter, r *http.Request, res *Resource, namespace string) {
+	selector := make(map[string]string)
+	for _, requirement := range strings.Split(r.URL.Query().Get("labelSelector"), ",") {
+		if kv := strings.SplitN(requirement, "=", 2); len(kv) == 2 {
+			selector[kv[0]] = kv[1]
+		}
+	}
+	prefix := res.Group + "/" + res.Plural + "/"
+	if namespace != "" {
+		prefix += namespace + "/"
+	}
+	var keys []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	items := []object{}
+	for _, k := range keys {
+		o := s.objects[k]
+		labels, _ := metadata(o)["labels"].(map[string]interface{})
+		matches := true
+		for label, value := range selector {
+			matches = matches && labels[label] == value
+		}
+		if matches {
+			items = append(items, o)
+		}
+	}
+	writeJSON(w, http.StatusOK, object{
+		"kind":       res.Kind + "List",
+		"apiVersion": res.apiVersion(),
+		"metadata":   object{"resourceVersion": strconv.Itoa(s.resourceVersion)},
+		"items":      items,
+	})
+}
+
+func (s *server) get(w http.ResponseWriter, res *Resource, namespace, name string) {
+	o, ok := s.objects[key(res, namespace, name)]
+	if !ok {
+		writeNotFound(w, res, name)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *server) create(w http.ResponseWriter, r *http.Request, res *Resource, namespace string) {
+	o, ok := readObject(w, r)
+	if !ok {
+		return
+	}
+	meta := metadata(o)
+	name, _ := meta["name"].(string)
+	if name == "" {
+		if prefix, _ := meta["generateName"].(string); prefix != "" {
+			s.uid++
+			name = fmt.Sprintf("%s%05d", prefix, s.uid)
+			meta["name"] = name
+		}
+	}
+	k := key(res, namespace, name)
+	if _, exists := s.objects[k]; exists {
+		writeStatus(w, http.StatusConflict, "AlreadyExists", fmt.Sprintf("%s %q already exists", res.Plural, name))
+		return
+	}
+	s.uid++
+	meta["uid"] = fmt.Sprintf("uid-%d", s.uid)
+	meta["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	meta["generation"] = 1
+	if namespace != "" {
+		meta["namespace"] = namespace
+	}
+	s.store(k, res, o)
+	writeJSON(w, http.StatusCreated, o)
+}
+
+func (s *server) update(w http.ResponseWriter, r *http.Request, res *Resource, namespace, name string) {
+	o, ok := readObject(w, r)
+	if !ok {
+		return
+	}
+	k := key(res, namespace, name)
+	current, exists := s.objects[k]
+	if !exists {
+		writeNotFound(w, res, name)
+		return
+	}
+	if rv, _ := metadata(o)["resourceVersion"].(string); rv != "" && rv != metadata(current)["resourceVersion"] {
+		writeStatus(w, http.StatusConflict, "Conflict", fmt.Sprintf("the object %s %q has been modified", res.Plural, name))
+		return
+	}
+	s.replace(w, k, res, current, o)
+}
+
+func (s *server) patch(w http.ResponseWriter, r *http.Request, res *Resource, namespace, name string) {
+	var patch interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	k := key(res, namespace, name)
+	current, exists := s.objects[k]
+	if !exists {
+		writeNotFound(w, res, name)
+		return
+	}
+	patched, _ := mergePatch(deepCopy(current), patch).(map[string]interface{})
+	s.replace(w, k, res, current, patched)
+}
+
+func (s *server) delete(w http.ResponseWriter, res *Resource, namespace, name string) {
+	k := key(res, namespace, name)
+	o, exists := s.objects[k]
+	if !exists {
+		writeNotFound(w, res, name)
+		return
+	}
+	meta := metadata(o)
+	if finalizers, _ := meta["finalizers"].([]interface{}); len(finalizers) > 0 {
+		if meta["deletionTimestamp"] == nil {
+			meta["deletionTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+			s.store(k, res, o)
+		}
+		writeJSON(w, http.StatusOK, o)
+		return
+	}
+	delete(s.objects, k)
+	writeJSON(w, http.StatusOK, object{"kind": "Status", "apiVersion": "v1", "status": "Success"})
+}
+
+// evict deletes the pod, unless a pod disruption budget selecting it allows
+// no more disruptions, as the eviction API does. The disruptions allowed by
+// the budgets are decreased for each evicted pod.
+func (s *server) evict(w http.ResponseWriter, res *Resource, namespace, name string) {
+	k := key(res, namespace, name)
+	pod, exists := s.objects[k]
+	if !exists {
+		writeNotFound(w, res, name)
+		return
+	}
+	labels, _ := metadata(pod)["labels"].(map[string]interface{})
+	var budgets []string
+	prefix := "policy/poddisruptionbudgets/" + namespace + "/"
+	for pk, pdb := range s.objects {
+		if !strings.HasPrefix(pk, prefix) {
+			continue
+		}
+		spec, _ := pdb["spec"].(map[string]interface{})
+		selector, _ := spec["selector"].(map[string]interface{})
+		matchLabels, _ := selector["matchLabels"].(map[string]interface{})
+		matches := len(matchLabels) > 0
+		for label, value := range matchLabels {
+			matches = matches && labels[label] == value
+		}
+		if !matches {
+			continue
+		}
+		status, _ := pdb["status"].(map[string]interface{})
+		if allowed, _ := status["disruptionsAllowed"].(float64); allowed < 1 {
+			writeStatus(w, http.StatusTooManyRequests, "TooManyRequests", "Cannot evict pod as it would violate the pod's disruption budget.")
+			return
+		}
+		budgets = append(budgets, pk)
+	}
+	for _, pk := range budgets {
+		pdb := s.objects[pk]
+		status := pdb["status"].(map[string]interface{})
+		status["disruptionsAllowed"] = status["disruptionsAllowed"].(float64) - 1
+		s.store(pk, resource("poddisruptionbudgets"), pdb)
+	}
+	delete(s.objects, k)
+	writeJSON(w, http.StatusCreated, object{"kind": "Status", "apiVersion": "v1", "status": "Success"})
+}
+
+// replace stores the new version of the object, keeping the fields set by
+// the server and deleting it once its last finalizer is removed
+func (s *server) replace(w http.ResponseWriter, k string, res *Resource, current, o object) {
+	meta, currentMeta := metadata(o), metadata(current)
+	for _, field := range []string{"uid", "creationTimestamp", "deletionTimestamp", "namespace", "name"} {
+		if currentMeta[field] != nil {
+			meta[field] = currentMeta[field]
+		}
+	}
+	generation, _ := currentMeta["generation"].(float64)
+	if !reflect.DeepEqual(current["spec"], o["spec"]) {
+		generation++
+	}
+	meta["generation"] = generation
+	if finalizers, _ := meta["finalizers"].([]interface{}); len(finalizers) == 0 && meta["deletionTimestamp"] != nil {
+		delete(s.objects, k)
+		writeJSON(w, http.StatusOK, o)
+		return
+	}
+	s.store(k, res, o)
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *server) store(k string, res *Resource, o object) {
+	s.resourceVersion++
+	o["kind"], o["apiVersion"] = res.Kind, res.apiVersion()
+	metadata(o)["resourceVersion"] = strconv.Itoa(s.resourceVersion)
+	// Objects are stored as they are read back, with JSON numbers
+	data, _ := json.Marshal(o)
+	var stored object
+	json.Unmarshal(data, &stored)
+	s.objects[k] = stored
+}
+
+// mergePatch applies the JSON merge patch to the value, as of RFC 7386
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for k, v := range patchObject {
+		if v == nil {
+			delete(targetObject, k)
+			continue
+		}
+		targetObject[k] = mergePatch(targetObject[k], v)
+	}
+	return targetObject
+}
+
+func deepCopy(o object) object {
+	data, _ := json.Marshal(o)
+	var copied object
+	json.Unmarshal(data, &copied)
+	return copied
+}
+
+func metadata(o object) map[string]interface{} {
+	meta, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		meta = make(map[string]interface{})
+		o["metadata"] = meta
+	}
+	return meta
+}
+
+func readObject(w http.ResponseWriter, r *http.Request) (object, bool) {
+	var o object
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return nil, false
+	}
+	return o, true
+}
+
+func writeNotFound(w http.ResponseWriter, res *Resource, name string) {
+	writeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%s %q not found", res.Plural, name))
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason, message string) {
+	writeJSON(w, code, object{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"status":     "Failure",
+		"reason":     reason,
+		"message":    message,
+		"code":       code,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,57 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// createService creates the service of the nginx. Services setting their IP
+// families are created as unstructured objects, since the primary family
+// cannot be changed once they are allocated.
+func createService(nginx *v1alpha1.Nginx, service *corev1.Service) error {
+	if !k8s.HasIPFamilies(&nginx.Spec) {
+		return sdk.Create(service)
+	}
+	u, err := k8s.UnstructuredService(&nginx.Spec, service)
+	if err != nil {
+		return err
+	}
+	client, _, err := k8sclient.GetResourceClient(service.APIVersion, service.Kind, service.Namespace)
+	if err != nil {
+		return err
+	}
+	_, err = client.Create(u)
+	return err
+}
+
+// reconcileIPFamilies updates the IP family policy and families of the
+// existing service to the ones of the spec, returning whether it was
+// updated. Families of the spec the service lacks are added, changing its
+// primary family is rejected by the cluster.
+func reconcileIPFamilies(nginx *v1alpha1.Nginx, service *corev1.Service) (bool, error) {
+	if !k8s.HasIPFamilies(&nginx.Spec) {
+		return false, nil
+	}
+	client, _, err := k8sclient.GetResourceClient(service.APIVersion, service.Kind, service.Namespace)
+	if err != nil {
+		return false, err
+	}
+	current, err := client.Get(service.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve service %s: %v", service.Name, err)
+	}
+	if !k8s.SetIPFamilies(&nginx.Spec, current) {
+		return false, nil
+	}
+	if _, err := client.Update(current); err != nil {
+		return false, fmt.Errorf("failed to update IP families of service %s: %v", service.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package stub
+
+import (
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// refreshServiceStatus sets the external addresses of the LoadBalancer
+// service of the nginx in the given status, along with its LoadBalancerReady
+// condition, recording an event when the load balancer is allocated or its
+// allocation gets stuck. Both are cleared for services of other types.
+// Changes to the load balancer status of the service trigger a reconcile,
+// and stuck allocations are found on the resyncs.
+func refreshServiceStatus(nginx *v1alpha1.Nginx, status *v1alpha1.NginxStatus, logger *logrus.Entry) error {
+	desired := k8s.NewService(nginx)
+	service := &corev1.Service{
+		TypeMeta:   desired.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace},
+	}
+	err := sdk.Get(service)
+	if errors.IsNotFound(err) {
+		status.Service = nil
+		status.RemoveCondition(v1alpha1.NginxConditionLoadBalancerReady)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	status.Service = k8s.NewServiceStatus(service)
+	previous := status.GetCondition(v1alpha1.NginxConditionLoadBalancerReady)
+	c := k8s.LoadBalancerCondition(&nginx.Spec, previous, service, time.Now())
+	if c == nil {
+		status.RemoveCondition(v1alpha1.NginxConditionLoadBalancerReady)
+		return nil
+	}
+	if previous == nil || previous.Reason != c.Reason {
+		switch c.Reason {
+		case k8s.LoadBalancerAllocated:
+			recordEvent(nginx, corev1.EventTypeNormal, "LoadBalancerAllocated", c.Message, logger)
+		case k8s.LoadBalancerStuck:
+			recordEvent(nginx, corev1.EventTypeWarning, "LoadBalancerStuck", c.Message, logger)
+		}
+	}
+	status.SetCondition(*c)
+	return nil
+}
@@ -0,0 +1,155 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	appv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// replacedWorkload is a workload kind the nginx may have run on before,
+// removed once the workload of another kind takes its place
+type replacedWorkload struct {
+	kind   v1alpha1.WorkloadKind
+	object sdk.Object
+	delete func(*v1alpha1.Nginx) error
+}
+
+// replacedWorkloads returns the workloads of the nginx of a kind other than
+// the given one. Rollouts take the place of the deployment, so the
+// deployment is replaced by them too.
+func replacedWorkloads(nginx *v1alpha1.Nginx, current v1alpha1.WorkloadKind) []replacedWorkload {
+	all := []replacedWorkload{
+		{
+			kind: v1alpha1.WorkloadKindDeployment,
+			object: &appv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-deployment", Namespace: nginx.Namespace},
+			},
+			delete: deleteReplacedDeployment,
+		},
+		{
+			kind: v1alpha1.WorkloadKindStatefulSet,
+			object: &appv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-statefulset", Namespace: nginx.Namespace},
+			},
+			delete: deleteReplacedStatefulSet,
+		},
+		{
+			kind: v1alpha1.WorkloadKindDaemonSet,
+			object: &appv1.DaemonSet{
+				TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-daemonset", Namespace: nginx.Namespace},
+			},
+			delete: deleteReplacedDaemonSet,
+		},
+	}
+	var replaced []replacedWorkload
+	for _, w := range all {
+		if w.kind != current {
+			replaced = append(replaced, w)
+		}
+	}
+	return replaced
+}
+
+// deleteReplacedWorkloads removes the workloads previously created for the
+// nginx with a kind other than the current one. With spec.maxUnavailable
+// they are only removed once enough pods of the current workload are
+// available to stay within it, returning a reconcileBlockedError until then.
+func deleteReplacedWorkloads(nginx *v1alpha1.Nginx, current v1alpha1.WorkloadKind) error {
+	replaced := replacedWorkloads(nginx, current)
+	if nginx.Spec.MaxUnavailable != nil {
+		var existing []replacedWorkload
+		for _, w := range replaced {
+			err := sdk.Get(w.object)
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to retrieve replaced %s: %v", w.kind, err)
+			}
+			existing = append(existing, w)
+		}
+		if len(existing) == 0 {
+			return nil
+		}
+		available, desired, err := workloadAvailability(nginx, current)
+		if err != nil {
+			return err
+		}
+		maxUnavailable, _ := k8s.MaxUnavailable(&nginx.Spec, desired)
+		if available < desired-maxUnavailable {
+			return &reconcileBlockedError{reason: fmt.Sprintf("waiting for %d available pods of the %s before removing the replaced workloads, %d available",
+				desired-maxUnavailable, current, available)}
+		}
+		replaced = existing
+	}
+	for _, w := range replaced {
+		if err := w.delete(nginx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workloadAvailability returns the available and the desired pods of the
+// workload of the given kind of the nginx
+func workloadAvailability(nginx *v1alpha1.Nginx, kind v1alpha1.WorkloadKind) (available, desired int32, err error) {
+	switch kind {
+	case v1alpha1.WorkloadKindStatefulSet:
+		sts := &appv1.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-statefulset", Namespace: nginx.Namespace},
+		}
+		if err := sdk.Get(sts); err != nil {
+			return 0, 0, fmt.Errorf("failed to retrieve statefulset: %v", err)
+		}
+		desired = 1
+		if sts.Spec.Replicas != nil {
+			desired = *sts.Spec.Replicas
+		}
+		return sts.Status.ReadyReplicas, desired, nil
+	case v1alpha1.WorkloadKindDaemonSet:
+		ds := &appv1.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-daemonset", Namespace: nginx.Namespace},
+		}
+		if err := sdk.Get(ds); err != nil {
+			return 0, 0, fmt.Errorf("failed to retrieve daemonset: %v", err)
+		}
+		return ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled, nil
+	case v1alpha1.WorkloadKindRollout:
+		client, _, err := k8sclient.GetResourceClient(k8s.RolloutAPIVersion, k8s.RolloutKind, nginx.Namespace)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get rollout client: %v", err)
+		}
+		rollout, err := client.Get(nginx.Name+"-deployment", metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to retrieve rollout: %v", err)
+		}
+		obj := rollout.Object
+		replicas, ok := unstructured.NestedInt64(obj, "spec", "replicas")
+		if !ok {
+			replicas = 1
+		}
+		availableReplicas, _ := unstructured.NestedInt64(obj, "status", "availableReplicas")
+		return int32(availableReplicas), int32(replicas), nil
+	}
+	deploy := &appv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: nginx.Name + "-deployment", Namespace: nginx.Namespace},
+	}
+	if err := sdk.Get(deploy); err != nil {
+		return 0, 0, fmt.Errorf("failed to retrieve deployment: %v", err)
+	}
+	return deploy.Status.AvailableReplicas, deploymentReplicas(deploy), nil
+}
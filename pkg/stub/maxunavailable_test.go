@@ -0,0 +1,159 @@
+package stub
+
+import (
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/stub/internal/fakeapi"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/assert"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// createDeployment stores the deployment of my-nginx with the given
+// replicas, the available ones reported in its status
+func createDeployment(t *testing.T, replicas, available int32) {
+	dep := &appv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-deployment", Namespace: "default"},
+		Spec:       appv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appv1.DeploymentStatus{AvailableReplicas: available},
+	}
+	assert.Nil(t, sdk.Create(dep))
+}
+
+// createStatefulSet stores the statefulset of my-nginx with the given
+// replicas, the ready ones reported in its status
+func createStatefulSet(t *testing.T, replicas, ready int32) {
+	sts := &appv1.StatefulSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-statefulset", Namespace: "default"},
+		Spec:       appv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     appv1.StatefulSetStatus{ReadyReplicas: ready},
+	}
+	assert.Nil(t, sdk.Create(sts))
+}
+
+func TestDeleteReplacedWorkloads(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxUnavailable *intstr.IntOrString
+		available      int32
+		blocked        string
+	}{
+		{name: "no maxUnavailable", available: 0},
+		{name: "zero, all available", maxUnavailable: intOrString(intstr.FromInt(0)), available: 4},
+		{name: "zero, one unavailable", maxUnavailable: intOrString(intstr.FromInt(0)), available: 3, blocked: "waiting for 4 available pods of the Deployment"},
+		{name: "number, within", maxUnavailable: intOrString(intstr.FromInt(1)), available: 3},
+		{name: "number, exceeded", maxUnavailable: intOrString(intstr.FromInt(1)), available: 2, blocked: "waiting for 3 available pods of the Deployment before removing the replaced workloads, 2 available"},
+		{name: "number above replicas", maxUnavailable: intOrString(intstr.FromInt(10)), available: 0},
+		{name: "zero percent", maxUnavailable: intOrString(intstr.FromString("0%")), available: 3, blocked: "waiting for 4 available pods"},
+		{name: "percent, within", maxUnavailable: intOrString(intstr.FromString("25%")), available: 3},
+		{name: "percent, exceeded", maxUnavailable: intOrString(intstr.FromString("25%")), available: 2, blocked: "waiting for 3 available pods"},
+		{name: "percent rounded down", maxUnavailable: intOrString(intstr.FromString("49%")), available: 2, blocked: "waiting for 3 available pods"},
+		{name: "percent below one pod", maxUnavailable: intOrString(intstr.FromString("10%")), available: 3, blocked: "waiting for 4 available pods"},
+		{name: "hundred percent", maxUnavailable: intOrString(intstr.FromString("100%")), available: 0},
+		{name: "invalid percent", maxUnavailable: intOrString(intstr.FromString("a%")), available: 3, blocked: "waiting for 4 available pods"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestHandler(t)
+			nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+				Image:          "nginx:1.15",
+				MaxUnavailable: tt.maxUnavailable,
+			}})
+			createDeployment(t, 4, tt.available)
+			createStatefulSet(t, 4, 4)
+
+			err := deleteReplacedWorkloads(nginx, v1alpha1.WorkloadKindDeployment)
+			if tt.blocked == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, 0, fakeapi.Count("StatefulSet"))
+				return
+			}
+			if assert.IsType(t, &reconcileBlockedError{}, err) {
+				assert.Contains(t, err.Error(), tt.blocked)
+			}
+			assert.Equal(t, 1, fakeapi.Count("StatefulSet"), "replaced statefulset kept")
+		})
+	}
+}
+
+func TestDeleteReplacedWorkloadsWithoutReplaced(t *testing.T) {
+	newTestHandler(t)
+	zero := intstr.FromInt(0)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image:          "nginx:1.15",
+		MaxUnavailable: &zero,
+	}})
+
+	// The availability is only checked when there is something to remove
+	assert.Nil(t, deleteReplacedWorkloads(nginx, v1alpha1.WorkloadKindDeployment))
+}
+
+func TestWorkloadAvailability(t *testing.T) {
+	newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{Image: "nginx:1.15"}})
+
+	dep := &appv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-deployment", Namespace: "default"},
+		Status:     appv1.DeploymentStatus{AvailableReplicas: 2},
+	}
+	assert.Nil(t, sdk.Create(dep))
+	available, desired, err := workloadAvailability(nginx, v1alpha1.WorkloadKindDeployment)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), available)
+	assert.Equal(t, int32(1), desired, "replicas default to one")
+
+	createStatefulSet(t, 3, 1)
+	available, desired, err = workloadAvailability(nginx, v1alpha1.WorkloadKindStatefulSet)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), available)
+	assert.Equal(t, int32(3), desired)
+
+	ds := &appv1.DaemonSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-daemonset", Namespace: "default"},
+		Status:     appv1.DaemonSetStatus{DesiredNumberScheduled: 5, NumberAvailable: 4},
+	}
+	assert.Nil(t, sdk.Create(ds))
+	available, desired, err = workloadAvailability(nginx, v1alpha1.WorkloadKindDaemonSet)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(4), available)
+	assert.Equal(t, int32(5), desired)
+}
+
+func TestHandleKeepsReplacedWorkloadWithinMaxUnavailable(t *testing.T) {
+	h := newTestHandler(t)
+	replicas, one := int32(2), intstr.FromInt(1)
+	nginx := handleStored(t, h, createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image:          "nginx:1.15",
+		Replicas:       &replicas,
+		MaxUnavailable: &one,
+	}}))
+	assert.Equal(t, 1, fakeapi.Count("Deployment"))
+
+	nginx.Spec.WorkloadKind = v1alpha1.WorkloadKindStatefulSet
+	assert.Nil(t, sdk.Update(nginx))
+	nginx = handleStored(t, h, nginx)
+	assert.Equal(t, 1, fakeapi.Count("StatefulSet"))
+	assert.Equal(t, 1, fakeapi.Count("Deployment"), "deployment kept until enough statefulset pods are ready")
+
+	sts := &appv1.StatefulSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-statefulset", Namespace: "default"},
+	}
+	assert.Nil(t, sdk.Get(sts))
+	sts.Status.ReadyReplicas = 1
+	assert.Nil(t, sdk.Update(sts))
+	handleStored(t, h, nginx)
+	assert.Equal(t, 0, fakeapi.Count("Deployment"))
+}
+
+func intOrString(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
@@ -0,0 +1,109 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workloadDefaults are the operator defaults of the workload settings
+var workloadDefaults k8s.WorkloadDefaults
+
+// SetWorkloadDefaults sets the workload settings used for nginx objects that
+// do not set them in their spec
+func SetWorkloadDefaults(d k8s.WorkloadDefaults) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	workloadDefaults = d
+	return nil
+}
+
+// operatorProfile is the profile of spec.profiles applied to nginx objects
+// whose namespace does not select one
+var operatorProfile string
+
+// SetProfile sets the profile of spec.profiles applied to nginx objects whose
+// namespace has no profile label
+func SetProfile(name string) {
+	operatorProfile = name
+}
+
+// withNamespaceDefaults returns a copy of the nginx with the defaults set in
+// the annotations of its namespace applied to its spec. When the operator is
+// not allowed to read namespaces only the operator profile and workload
+// defaults are applied. The generated certificate secret and config map are
+// set first, followed by the profile selected for the namespace, the
+// namespace defaults and the operator workload defaults, whose resources are
+// kept within the limit ranges of the namespace.
+func withNamespaceDefaults(nginx *v1alpha1.Nginx, logger *logrus.Entry) (*v1alpha1.Nginx, error) {
+	ns := &corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nginx.Namespace,
+		},
+	}
+	if err := sdk.Get(ns); err != nil {
+		if errors.IsForbidden(err) {
+			logger.Warnf("not allowed to read namespace, skipping namespace defaults: %v", err)
+			effective := nginx.DeepCopy()
+			spec := withProfile(effective, k8s.WithGeneratedRefs(nginx), operatorProfile)
+			defaults, err := namespaceWorkloadDefaults(nginx, logger)
+			if err != nil {
+				return nil, err
+			}
+			effective.Spec = *k8s.WithWorkloadDefaults(spec, defaults)
+			return effective, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve namespace: %v", err)
+	}
+
+	effective := nginx.DeepCopy()
+	profile := k8s.SelectedProfile(ns.Labels, operatorProfile)
+	spec, err := k8s.WithNamespaceDefaults(withProfile(effective, k8s.WithGeneratedRefs(nginx), profile), ns.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := namespaceWorkloadDefaults(nginx, logger)
+	if err != nil {
+		return nil, err
+	}
+	effective.Spec = *k8s.WithWorkloadDefaults(spec, defaults)
+	return effective, nil
+}
+
+// namespaceWorkloadDefaults returns the operator workload defaults with their
+// resources fit within the limit ranges of the namespace of the nginx. The
+// limit ranges are only listed when the defaults set resources.
+func namespaceWorkloadDefaults(nginx *v1alpha1.Nginx, logger *logrus.Entry) (k8s.WorkloadDefaults, error) {
+	d := workloadDefaults
+	if len(d.Resources.Requests) == 0 && len(d.Resources.Limits) == 0 {
+		return d, nil
+	}
+	limitRanges, err := listLimitRanges(nginx, logger)
+	if err != nil {
+		return d, err
+	}
+	return d.WithLimitRangeBounds(limitRanges), nil
+}
+
+// withProfile returns a copy of the spec with the named profile merged into
+// it, recording the profile applied in the status of the nginx
+func withProfile(nginx *v1alpha1.Nginx, spec *v1alpha1.NginxSpec, name string) *v1alpha1.NginxSpec {
+	out, ok := k8s.WithProfile(spec, name)
+	nginx.Status.Profile = ""
+	if ok {
+		nginx.Status.Profile = name
+	}
+	return out
+}
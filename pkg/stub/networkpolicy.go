@@ -0,0 +1,80 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileNetworkPolicy creates or updates the network policy of the nginx,
+// deleting it when the policy is no longer requested.
+func reconcileNetworkPolicy(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	policy := k8s.NewNetworkPolicy(nginx)
+	if policy == nil {
+		return deleteNetworkPolicy(nginx, logger)
+	}
+
+	err := sdk.Create(policy)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create network policy: %v", err)
+	}
+
+	if err == nil {
+		recordEvent(nginx, corev1.EventTypeNormal, "NetworkPolicyCreated", fmt.Sprintf("Created network policy %s", policy.Name), logger)
+		return nil
+	}
+
+	currPolicy := &networkingv1.NetworkPolicy{
+		TypeMeta:   policy.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: policy.Name, Namespace: policy.Namespace},
+	}
+	if err := sdk.Get(currPolicy); err != nil {
+		return fmt.Errorf("failed to retrieve network policy: %v", err)
+	}
+
+	if !k8s.ShouldUpdate(currPolicy, policy) && !k8s.MetadataDrift(policy, currPolicy) {
+		return nil
+	}
+
+	currPolicy.Spec = policy.Spec
+	k8s.MergeMetadata(currPolicy, policy)
+	if err := sdk.Update(currPolicy); err != nil {
+		return fmt.Errorf("failed to update network policy: %v", err)
+	}
+
+	recordEvent(nginx, corev1.EventTypeNormal, "NetworkPolicyUpdated", fmt.Sprintf("Updated network policy %s", currPolicy.Name), logger)
+	return nil
+}
+
+// deleteNetworkPolicy removes the network policy previously created for the
+// nginx, if any
+func deleteNetworkPolicy(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	policy := &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-network-policy",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(policy, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete network policy: %v", err)
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, "NetworkPolicyDeleted", fmt.Sprintf("Deleted network policy %s", policy.Name), logger)
+	return nil
+}
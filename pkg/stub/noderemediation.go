@@ -0,0 +1,140 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// remediateNodes evicts the nginx pods running on unhealthy nodes, so their
+// workload replaces them on healthy ones. Ready pods are only evicted within
+// the disruptions allowed by the pod disruption budget, or one at a time
+// without a budget, and within spec.maxUnavailable. Evictions are checked
+// against every pod disruption budget of the pods by the API server, the ones
+// it refuses are retried on the next resync. It runs on every resync, since
+// node health changes do not change the nginx spec.
+func remediateNodes(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	if nginx.Spec.NodeRemediation == nil || nginx.Spec.WorkloadKind == v1alpha1.WorkloadKindDaemonSet {
+		return nil
+	}
+	podList := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(k8s.LabelsForNginx(nginx.Name)).String()
+	if err := sdk.List(nginx.Namespace, podList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	now := time.Now()
+	problems := make(map[string]string)
+	for _, pod := range podList.Items {
+		name := pod.Spec.NodeName
+		if _, checked := problems[name]; checked || name == "" {
+			continue
+		}
+		node := &corev1.Node{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Node",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+		}
+		if err := sdk.Get(node); err != nil {
+			if errors.IsNotFound(err) {
+				// Pods of removed nodes are garbage collected by Kubernetes
+				problems[name] = ""
+				continue
+			}
+			return fmt.Errorf("failed to retrieve node %s: %v", name, err)
+		}
+		problems[name] = k8s.NodeProblem(node, &nginx.Spec, now)
+	}
+
+	allowed, err := disruptionsAllowed(nginx)
+	if err != nil {
+		return err
+	}
+	if remaining, ok := k8s.RemainingUnavailable(&nginx.Spec, podList.Items); ok && remaining < allowed {
+		allowed = remaining
+	}
+	pods := k8s.PodsToRemediate(podList.Items, problems, allowed)
+	names := make([]string, 0, len(pods))
+	for name := range pods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		eviction := &policyv1beta1.Eviction{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Eviction",
+				APIVersion: "policy/v1beta1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: nginx.Namespace,
+			},
+		}
+		err := k8sclient.GetKubeClient().CoreV1().Pods(nginx.Namespace).Evict(eviction)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if errors.IsTooManyRequests(err) {
+			recordEvent(nginx, corev1.EventTypeWarning, "PodEvictionBlocked",
+				fmt.Sprintf("Pod %s on unhealthy node was not evicted, %s: %v", name, pods[name], err), logger)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to evict pod %s on unhealthy node: %v", name, err)
+		}
+		recordEvent(nginx, corev1.EventTypeWarning, "PodRescheduled",
+			fmt.Sprintf("Evicted pod %s to reschedule it, %s", name, pods[name]), logger)
+	}
+	return nil
+}
+
+// disruptionsAllowed returns how many ready pods of the nginx can be evicted,
+// the disruptions allowed by its pod disruption budget or one without a
+// budget
+func disruptionsAllowed(nginx *v1alpha1.Nginx) (int32, error) {
+	if nginx.Spec.PodDisruptionBudget == nil {
+		return 1, nil
+	}
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-pdb",
+			Namespace: nginx.Namespace,
+		},
+	}
+	if err := sdk.Get(pdb); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to retrieve pod disruption budget: %v", err)
+	}
+	if pdb.Status.ObservedGeneration < pdb.Generation {
+		return 0, nil
+	}
+	return pdb.Status.PodDisruptionsAllowed, nil
+}
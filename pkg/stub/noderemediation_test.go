@@ -0,0 +1,87 @@
+package stub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+	"github.com/tsuru/nginx-operator/pkg/stub/internal/fakeapi"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// createUnhealthyNode creates a node whose Ready condition has been false for
+// ten minutes, running an unready pod of the nginx
+func createUnhealthyNode(t *testing.T, nginx *v1alpha1.Nginx) {
+	node := &corev1.Node{
+		TypeMeta:   metav1.TypeMeta{Kind: "Node", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{
+			Type:               corev1.NodeReady,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-10 * time.Minute)),
+		}}},
+	}
+	assert.Nil(t, sdk.Create(node))
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "my-nginx-pod", Namespace: nginx.Namespace, Labels: k8s.LabelsForNginx(nginx.Name)},
+		Spec:       corev1.PodSpec{NodeName: "node-a", Containers: []corev1.Container{{Name: "nginx", Image: "nginx"}}},
+		Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}},
+	}
+	assert.Nil(t, sdk.Create(pod))
+}
+
+// eventReasons returns the reasons of the events recorded in the namespace
+func eventReasons(t *testing.T, namespace string) []string {
+	events := &corev1.EventList{TypeMeta: metav1.TypeMeta{Kind: "Event", APIVersion: "v1"}}
+	assert.Nil(t, sdk.List(namespace, events))
+	var reasons []string
+	for _, e := range events.Items {
+		reasons = append(reasons, e.Reason)
+	}
+	return reasons
+}
+
+func TestRemediateNodesEvictsPods(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image:           "nginx:1.15",
+		NodeRemediation: &v1alpha1.NginxNodeRemediation{},
+	}})
+	createUnhealthyNode(t, nginx)
+
+	assert.Nil(t, remediateNodes(context.Background(), nginx, logrus.NewEntry(h.logger)))
+	assert.Equal(t, 0, fakeapi.Count("Pod"))
+	assert.Contains(t, eventReasons(t, nginx.Namespace), "PodRescheduled")
+}
+
+func TestRemediateNodesEnforcesDisruptionBudgets(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image:           "nginx:1.15",
+		NodeRemediation: &v1alpha1.NginxNodeRemediation{},
+	}})
+	createUnhealthyNode(t, nginx)
+	// A budget not created by the operator is enforced as well
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		TypeMeta:   metav1.TypeMeta{Kind: "PodDisruptionBudget", APIVersion: "policy/v1beta1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "edge", Namespace: nginx.Namespace},
+		Spec:       policyv1beta1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}}},
+		Status:     policyv1beta1.PodDisruptionBudgetStatus{PodDisruptionsAllowed: 0},
+	}
+	assert.Nil(t, sdk.Create(pdb))
+
+	assert.Nil(t, remediateNodes(context.Background(), nginx, logrus.NewEntry(h.logger)))
+	assert.Equal(t, 1, fakeapi.Count("Pod"))
+	reasons := eventReasons(t, nginx.Namespace)
+	assert.Contains(t, reasons, "PodEvictionBlocked")
+	assert.NotContains(t, reasons, "PodRescheduled")
+}
@@ -0,0 +1,167 @@
+package stub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// OwnedKinds are the api versions and kinds of the objects generated for the
+// nginx instances that are watched, so their deletion or out of band changes
+// are reverted right away instead of on the next full reconcile.
+var OwnedKinds = [][2]string{
+	{"apps/v1", "Deployment"},
+	{"apps/v1", "StatefulSet"},
+	{"apps/v1", "DaemonSet"},
+	{"v1", "Service"},
+}
+
+// ownedTracker keeps a fingerprint of the metadata and spec of each watched
+// object, so resyncs and status updates, like the ones made while the pods
+// roll out, do not trigger a reconcile of their nginx.
+type ownedTracker struct {
+	mu           sync.Mutex
+	fingerprints map[types.UID]string
+}
+
+func newOwnedTracker() *ownedTracker {
+	return &ownedTracker{fingerprints: make(map[types.UID]string)}
+}
+
+// changed records the fingerprint of the object and returns whether it
+// differs from the previous one. Objects seen for the first time are not
+// reported, their nginx is reconciled by its own informer when the operator
+// starts.
+func (t *ownedTracker) changed(obj metav1.Object, fingerprint string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, ok := t.fingerprints[obj.GetUID()]
+	t.fingerprints[obj.GetUID()] = fingerprint
+	return ok && last != fingerprint
+}
+
+func (t *ownedTracker) forget(obj metav1.Object) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.fingerprints, obj.GetUID())
+}
+
+// ownedFingerprint hashes the labels, annotations and spec of an object,
+// leaving out its status and the metadata changed by the API server on
+// every write
+func ownedFingerprint(obj metav1.Object, spec interface{}) string {
+	data, err := json.Marshal([]interface{}{obj.GetLabels(), obj.GetAnnotations(), obj.GetOwnerReferences(), spec})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// nginxOwner returns the controller reference of an object generated for an
+// nginx, nil for objects of other controllers
+func nginxOwner(obj metav1.Object) *metav1.OwnerReference {
+	ref := metav1.GetControllerOf(obj)
+	if ref == nil || ref.Kind != "Nginx" {
+		return nil
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != v1alpha1.SchemeGroupVersion.Group {
+		return nil
+	}
+	return ref
+}
+
+// handleOwned reconciles the nginx owning a generated object that was
+// deleted or changed out of band. The cached spec hash of the nginx is
+// dropped, so it is fully reconciled even though its spec did not change.
+func (h *Handler) handleOwned(ctx context.Context, obj metav1.Object, spec interface{}, deleted bool) error {
+	ref := nginxOwner(obj)
+	if ref == nil {
+		return nil
+	}
+	if deleted {
+		h.owned.forget(obj)
+	} else if !h.owned.changed(obj, ownedFingerprint(obj, spec)) {
+		return nil
+	}
+	nginx := &v1alpha1.Nginx{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Nginx",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ref.Name,
+			Namespace: obj.GetNamespace(),
+		},
+	}
+	if err := sdk.Get(nginx); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	// Objects of a deleted nginx are removed by the garbage collector, and
+	// objects left by a previous nginx with the same name are not its own
+	if nginx.UID != ref.UID || nginx.DeletionTimestamp != nil {
+		return nil
+	}
+	h.logger.WithFields(map[string]interface{}{
+		"name":      nginx.Name,
+		"namespace": nginx.Namespace,
+	}).Debugf("Generated object %s changed or deleted, reconciling", obj.GetName())
+	h.specHashes.forget(nginx)
+	return h.Handle(ctx, sdk.Event{Object: nginx})
+}
+
+// nginxLocks serializes the handling of each nginx, whose events come from
+// its own informer and from the informers of the generated objects. The lock
+// of an nginx is dropped once no handler holds or waits for it.
+type nginxLocks struct {
+	mu    sync.Mutex
+	locks map[types.NamespacedName]*nginxLock
+}
+
+// nginxLock is the lock of an nginx along with the number of handlers
+// holding or waiting for it
+type nginxLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newNginxLocks() *nginxLocks {
+	return &nginxLocks{locks: make(map[types.NamespacedName]*nginxLock)}
+}
+
+// lock locks the nginx, returning the function unlocking it
+func (l *nginxLocks) lock(nginx *v1alpha1.Nginx) func() {
+	key := types.NamespacedName{Namespace: nginx.Namespace, Name: nginx.Name}
+	l.mu.Lock()
+	m, ok := l.locks[key]
+	if !ok {
+		m = &nginxLock{}
+		l.locks[key] = m
+	}
+	m.refs++
+	l.mu.Unlock()
+	m.Lock()
+	return func() {
+		m.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		m.refs--
+		if m.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
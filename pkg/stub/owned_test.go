@@ -0,0 +1,39 @@
+package stub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNginxLocks(t *testing.T) {
+	locks := newNginxLocks()
+	nginx := &v1alpha1.Nginx{ObjectMeta: metav1.ObjectMeta{Name: "my-nginx", Namespace: "default"}}
+
+	unlock := locks.lock(nginx)
+	locked := make(chan func())
+	go func() { locked <- locks.lock(nginx) }()
+	select {
+	case <-locked:
+		t.Fatal("nginx locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The lock is not dropped while another handler waits for it
+	unlock()
+	select {
+	case unlock = <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("nginx not locked after being unlocked")
+	}
+	locks.mu.Lock()
+	assert.Len(t, locks.locks, 1)
+	locks.mu.Unlock()
+
+	unlock()
+	assert.Empty(t, locks.locks)
+}
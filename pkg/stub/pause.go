@@ -0,0 +1,36 @@
+package stub
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// checkPaused returns whether the reconciliation of the nginx is paused
+// through spec.paused, keeping the Paused condition and the events in line
+// with it
+func checkPaused(nginx *v1alpha1.Nginx, logger *logrus.Entry) bool {
+	c := nginx.Status.GetCondition(v1alpha1.NginxConditionPaused)
+	if !nginx.Spec.Paused {
+		if c != nil && c.Status == corev1.ConditionTrue {
+			recordEvent(nginx, corev1.EventTypeNormal, "Resumed", "Reconciliation resumed, the generated objects are updated again", logger)
+			nginx.Status.SetCondition(v1alpha1.NginxCondition{
+				Type:   v1alpha1.NginxConditionPaused,
+				Status: corev1.ConditionFalse,
+				Reason: "Resumed",
+			})
+		}
+		return false
+	}
+	if c == nil || c.Status != corev1.ConditionTrue {
+		recordEvent(nginx, corev1.EventTypeNormal, "Paused", "Reconciliation paused, changes to the generated objects are kept", logger)
+		nginx.Status.SetCondition(v1alpha1.NginxCondition{
+			Type:    v1alpha1.NginxConditionPaused,
+			Status:  corev1.ConditionTrue,
+			Reason:  "SpecPaused",
+			Message: "spec.paused is set, the generated objects are not reconciled",
+		})
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcilePodDisruptionBudget creates the pod disruption budget of the
+// nginx, deleting it when the budget is no longer requested. The budget spec
+// is immutable, so changes are applied by recreating it.
+func reconcilePodDisruptionBudget(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	pdb := k8s.NewPodDisruptionBudget(nginx)
+	if pdb == nil {
+		return deletePodDisruptionBudget(nginx, logger)
+	}
+
+	err := sdk.Create(pdb)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create pod disruption budget: %v", err)
+	}
+
+	if err == nil {
+		recordEvent(nginx, corev1.EventTypeNormal, "PodDisruptionBudgetCreated", fmt.Sprintf("Created pod disruption budget %s", pdb.Name), logger)
+		return nil
+	}
+
+	currPDB := &policyv1beta1.PodDisruptionBudget{
+		TypeMeta:   pdb.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: pdb.Name, Namespace: pdb.Namespace},
+	}
+	if err := sdk.Get(currPDB); err != nil {
+		return fmt.Errorf("failed to retrieve pod disruption budget: %v", err)
+	}
+
+	if !k8s.ShouldUpdate(currPDB, pdb) && !k8s.MetadataDrift(pdb, currPDB) {
+		return nil
+	}
+
+	if err := sdk.Delete(currPDB); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete outdated pod disruption budget: %v", err)
+	}
+	if err := sdk.Create(pdb); err != nil {
+		return fmt.Errorf("failed to recreate pod disruption budget: %v", err)
+	}
+
+	recordEvent(nginx, corev1.EventTypeNormal, "PodDisruptionBudgetUpdated", fmt.Sprintf("Updated pod disruption budget %s", pdb.Name), logger)
+	return nil
+}
+
+// deletePodDisruptionBudget removes the pod disruption budget previously
+// created for the nginx, if any
+func deletePodDisruptionBudget(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-pdb",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(pdb, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete pod disruption budget: %v", err)
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, "PodDisruptionBudgetDeleted", fmt.Sprintf("Deleted pod disruption budget %s", pdb.Name), logger)
+	return nil
+}
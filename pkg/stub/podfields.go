@@ -0,0 +1,55 @@
+package stub
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// createWorkload creates the workload or pod of the nginx. Objects of specs
+// with pod fields the Kubernetes API of the operator lacks, like
+// runtimeClassName, are created as unstructured objects.
+func createWorkload(nginx *v1alpha1.Nginx, obj sdk.Object) error {
+	if !k8s.HasUnstructuredPodFields(&nginx.Spec) {
+		return sdk.Create(obj)
+	}
+	return writeUnstructuredWorkload(nginx, obj, func(client dynamic.ResourceInterface, u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		return client.Create(u)
+	})
+}
+
+// updateWorkload updates the workload of the nginx. A typed update would
+// drop the pod fields the Kubernetes API of the operator lacks, so
+// workloads of specs setting them are updated as unstructured objects.
+func updateWorkload(nginx *v1alpha1.Nginx, obj sdk.Object) error {
+	if !k8s.HasUnstructuredPodFields(&nginx.Spec) {
+		return sdk.Update(obj)
+	}
+	return writeUnstructuredWorkload(nginx, obj, func(client dynamic.ResourceInterface, u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		return client.Update(u)
+	})
+}
+
+// writeUnstructuredWorkload writes the object with the unstructured pod
+// fields of the nginx, refreshing the typed object from the response like the
+// SDK does
+func writeUnstructuredWorkload(nginx *v1alpha1.Nginx, obj sdk.Object, write func(dynamic.ResourceInterface, *unstructured.Unstructured) (*unstructured.Unstructured, error)) error {
+	u, err := k8s.UnstructuredWorkload(nginx, obj)
+	if err != nil {
+		return err
+	}
+	client, _, err := k8sclient.GetResourceClient(u.GetAPIVersion(), u.GetKind(), u.GetNamespace())
+	if err != nil {
+		return err
+	}
+	written, err := write(client, u)
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(written.Object, obj)
+}
@@ -0,0 +1,52 @@
+package stub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// storedPodField returns the field of the pod spec of the deployment of the
+// nginx as stored in the fake API, whatever the typed API knows of it
+func storedPodField(t *testing.T, nginx *v1alpha1.Nginx, field string) interface{} {
+	client, _, err := k8sclient.GetResourceClient("apps/v1", "Deployment", nginx.Namespace)
+	assert.Nil(t, err)
+	dep, err := client.Get(nginx.Name+"-deployment", metav1.GetOptions{})
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	value, _ := unstructured.NestedFieldCopy(dep.Object, "spec", "template", "spec", field)
+	return value
+}
+
+func TestHandleWritesRuntimeClassName(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{
+		Image:       "nginx:1.15",
+		PodTemplate: v1alpha1.NginxPodTemplateSpec{RuntimeClassName: "gvisor"},
+	}})
+
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: nginx}))
+	assert.Equal(t, "gvisor", storedPodField(t, nginx, "runtimeClassName"))
+
+	nginx = storedNginx(t, nginx)
+	nginx.Spec.Image = "nginx:1.16"
+	assert.Nil(t, sdk.Update(nginx))
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: storedNginx(t, nginx)}))
+	assert.Equal(t, "gvisor", storedPodField(t, nginx, "runtimeClassName"))
+	containers := storedPodField(t, nginx, "containers").([]interface{})
+	assert.Equal(t, "nginx:1.16", containers[0].(map[string]interface{})["image"])
+
+	nginx = storedNginx(t, nginx)
+	nginx.Spec.PodTemplate.RuntimeClassName = ""
+	assert.Nil(t, sdk.Update(nginx))
+	assert.Nil(t, h.Handle(context.Background(), sdk.Event{Object: storedNginx(t, nginx)}))
+	assert.Nil(t, storedPodField(t, nginx, "runtimeClassName"))
+}
@@ -0,0 +1,161 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkPolicies verifies that the pods of the nginx would be admitted by the
+// PodSecurity level, the limit ranges and the resource quotas of its
+// namespace, and that its priority class exists, before rolling them out.
+// Pods rejected by admission would otherwise only show up as failures of the
+// ReplicaSet. Policies the operator is not allowed to read are skipped.
+func checkPolicies(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	deployment, err := k8s.NewDeployment(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to assemble deployment from nginx: %v", err)
+	}
+	podSpec := &deployment.Spec.Template.Spec
+
+	reason, violations, err := policyViolations(nginx, podSpec, logger)
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		if nginx.Status.GetCondition(v1alpha1.NginxConditionBlockedByPolicy) != nil {
+			nginx.Status.SetCondition(v1alpha1.NginxCondition{
+				Type:   v1alpha1.NginxConditionBlockedByPolicy,
+				Status: corev1.ConditionFalse,
+				Reason: "Admitted",
+			})
+		}
+		return nil
+	}
+
+	msg := fmt.Sprintf("Pods would be rejected by %s: %s", reason, strings.Join(violations, "; "))
+	if c := nginx.Status.GetCondition(v1alpha1.NginxConditionBlockedByPolicy); c == nil || c.Status != corev1.ConditionTrue || c.Message != msg {
+		recordEvent(nginx, corev1.EventTypeWarning, "BlockedByPolicy", msg, logger)
+	}
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionBlockedByPolicy,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: msg,
+	})
+	return &reconcileBlockedError{reason: "pods would be rejected by " + reason}
+}
+
+// policyViolations returns the violations of the first policy rejecting the
+// pod, in the order the admission plugins run, along with the policy kind
+func policyViolations(nginx *v1alpha1.Nginx, podSpec *corev1.PodSpec, logger *logrus.Entry) (string, []string, error) {
+	if name := podSpec.PriorityClassName; name != "" {
+		found, err := priorityClassExists(name)
+		if err != nil {
+			return "", nil, err
+		}
+		if !found {
+			return "PriorityClass", []string{fmt.Sprintf("priority class %q not found", name)}, nil
+		}
+	}
+
+	limitRanges, err := listLimitRanges(nginx, logger)
+	if err != nil {
+		return "", nil, err
+	}
+	podSpec = k8s.WithLimitRangeDefaults(podSpec, limitRanges)
+	if errs := k8s.LimitRangeViolations(podSpec, limitRanges); len(errs) > 0 {
+		return "LimitRange", errs, nil
+	}
+
+	quotas, err := listResourceQuotas(nginx, logger)
+	if err != nil {
+		return "", nil, err
+	}
+	if errs := k8s.ResourceQuotaViolations(podSpec, quotas); len(errs) > 0 {
+		return "ResourceQuota", errs, nil
+	}
+
+	ns := &corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nginx.Namespace,
+		},
+	}
+	if err := sdk.Get(ns); err != nil {
+		if !errors.IsForbidden(err) {
+			return "", nil, fmt.Errorf("failed to retrieve namespace: %v", err)
+		}
+		logger.Warnf("not allowed to read namespace, skipping the PodSecurity check: %v", err)
+	}
+	if errs := k8s.PodSecurityViolations(ns.Labels[k8s.PodSecurityEnforceLabel], podSpec); len(errs) > 0 {
+		return "PodSecurity", errs, nil
+	}
+	return "", nil, nil
+}
+
+// listLimitRanges returns the limit ranges of the namespace of the nginx, or
+// none when the operator is not allowed to list them
+func listLimitRanges(nginx *v1alpha1.Nginx, logger *logrus.Entry) ([]corev1.LimitRange, error) {
+	limitRanges := &corev1.LimitRangeList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "LimitRange",
+			APIVersion: "v1",
+		},
+	}
+	if err := sdk.List(nginx.Namespace, limitRanges); err != nil {
+		if !errors.IsForbidden(err) {
+			return nil, fmt.Errorf("failed to list limit ranges: %v", err)
+		}
+		logger.Warnf("not allowed to list limit ranges, skipping them: %v", err)
+	}
+	return limitRanges.Items, nil
+}
+
+// listResourceQuotas returns the resource quotas of the namespace of the
+// nginx, or none when the operator is not allowed to list them
+func listResourceQuotas(nginx *v1alpha1.Nginx, logger *logrus.Entry) ([]corev1.ResourceQuota, error) {
+	quotas := &corev1.ResourceQuotaList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ResourceQuota",
+			APIVersion: "v1",
+		},
+	}
+	if err := sdk.List(nginx.Namespace, quotas); err != nil {
+		if !errors.IsForbidden(err) {
+			return nil, fmt.Errorf("failed to list resource quotas: %v", err)
+		}
+		logger.Warnf("not allowed to list resource quotas, skipping them: %v", err)
+	}
+	return quotas.Items, nil
+}
+
+// priorityClassExists reports whether the cluster has the priority class.
+// Clusters without the scheduling API are assumed to have it.
+func priorityClassExists(name string) (bool, error) {
+	client, _, err := k8sclient.GetResourceClient("scheduling.k8s.io/v1", "PriorityClass", metav1.NamespaceAll)
+	if err != nil {
+		return true, nil
+	}
+	_, err = client.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil && !errors.IsForbidden(err) {
+		return false, fmt.Errorf("failed to retrieve priority class: %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,54 @@
+package stub
+
+import (
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	appv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// refreshDeploymentStatus mirrors the rollout state of the deployment of the
+// nginx into the given status, along with its Progressing condition. Both
+// are cleared when the nginx has no deployment.
+func refreshDeploymentStatus(nginx *v1alpha1.Nginx, status *v1alpha1.NginxStatus) error {
+	dep := &appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-deployment",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Get(dep)
+	if errors.IsNotFound(err) || (err == nil && !metav1.IsControlledBy(dep, nginx)) {
+		status.Deployment = nil
+		status.RemoveCondition(v1alpha1.NginxConditionProgressing)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	replicaSets := &appv1.ReplicaSetList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ReplicaSet",
+			APIVersion: "apps/v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(dep.Spec.Selector.MatchLabels).String()
+	if err := sdk.List(nginx.Namespace, replicaSets, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return err
+	}
+
+	status.Deployment = k8s.NewDeploymentStatus(dep, replicaSets.Items)
+	if c := k8s.ProgressingCondition(dep); c != nil {
+		status.SetCondition(*c)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// clampReplicas limits the replicas of the nginx to the ones whose pods fit
+// in the resource quotas of its namespace, when requested. The clamped
+// replicas are set in the spec used to assemble the workload, and the
+// QuotaLimited condition reports them.
+func clampReplicas(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	if !nginx.Spec.ClampReplicasToQuota || nginx.Spec.WorkloadKind == v1alpha1.WorkloadKindDaemonSet {
+		clearQuotaLimited(nginx)
+		return nil
+	}
+
+	deployment, err := k8s.NewDeployment(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to assemble deployment from nginx: %v", err)
+	}
+	limitRanges, err := listLimitRanges(nginx, logger)
+	if err != nil {
+		return err
+	}
+	quotas, err := listResourceQuotas(nginx, logger)
+	if err != nil {
+		return err
+	}
+	pods, err := listPods(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to list pods for nginx: %v", err)
+	}
+
+	desired := int32(1)
+	if nginx.Spec.Replicas != nil {
+		desired = *nginx.Spec.Replicas
+	}
+	podSpec := k8s.WithLimitRangeDefaults(&deployment.Spec.Template.Spec, limitRanges)
+	replicas, reason := k8s.QuotaReplicas(podSpec, quotas, int32(len(pods)), desired)
+	if replicas == desired {
+		clearQuotaLimited(nginx)
+		return nil
+	}
+
+	msg := fmt.Sprintf("Replicas limited to %d of %d by %s", replicas, desired, reason)
+	if c := nginx.Status.GetCondition(v1alpha1.NginxConditionQuotaLimited); c == nil || c.Message != msg {
+		recordEvent(nginx, corev1.EventTypeWarning, "QuotaLimited", msg, logger)
+	}
+	nginx.Status.SetCondition(v1alpha1.NginxCondition{
+		Type:    v1alpha1.NginxConditionQuotaLimited,
+		Status:  corev1.ConditionTrue,
+		Reason:  "QuotaExceeded",
+		Message: msg,
+	})
+	nginx.Spec.Replicas = &replicas
+	return nil
+}
+
+// clearQuotaLimited reports that the replicas of the nginx are no longer
+// limited by the resource quotas
+func clearQuotaLimited(nginx *v1alpha1.Nginx) {
+	if k8s.QuotaLimited(nginx) {
+		nginx.Status.SetCondition(v1alpha1.NginxCondition{
+			Type:   v1alpha1.NginxConditionQuotaLimited,
+			Status: corev1.ConditionFalse,
+			Reason: "QuotaAvailable",
+		})
+	}
+}
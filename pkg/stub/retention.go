@@ -0,0 +1,90 @@
+package stub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// retentionInterval is the minimum interval between garbage collections of
+// the same nginx
+const retentionInterval = 10 * time.Minute
+
+// retentionTracker keeps when the objects of each nginx were last garbage
+// collected, so it runs periodically rather than on every resync.
+type retentionTracker struct {
+	mu      sync.Mutex
+	lastRun map[types.UID]time.Time
+}
+
+func newRetentionTracker() *retentionTracker {
+	return &retentionTracker{lastRun: make(map[types.UID]time.Time)}
+}
+
+// due returns whether the garbage collection of the nginx is due, marking
+// it as run when it is
+func (r *retentionTracker) due(nginx *v1alpha1.Nginx) bool {
+	if nginx.Spec.Retention == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if last, ok := r.lastRun[nginx.UID]; ok && now.Sub(last) < retentionInterval {
+		return false
+	}
+	r.lastRun[nginx.UID] = now
+	return true
+}
+
+// forget removes the nginx from the tracker
+func (r *retentionTracker) forget(nginx *v1alpha1.Nginx) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.lastRun, nginx.UID)
+}
+
+// collectGarbage removes the events recorded by the operator for the nginx
+// and the status history beyond spec.retention. The status is written
+// afterwards with the other status changes.
+func collectGarbage(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	retention := nginx.Spec.WithDefaults().Retention
+	k8s.TrimCachePurges(&nginx.Status, int(retention.CachePurgeHistory))
+
+	eventList := &corev1.EventList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Event",
+			APIVersion: "v1",
+		},
+	}
+	selector := fields.SelectorFromSet(fields.Set{
+		"involvedObject.uid": string(nginx.UID),
+		"source":             eventSource,
+	}).String()
+	if err := sdk.List(nginx.Namespace, eventList, sdk.WithListOptions(&metav1.ListOptions{FieldSelector: selector})); err != nil {
+		return fmt.Errorf("failed to list events: %v", err)
+	}
+	expired := k8s.ExpiredEvents(eventList.Items, retention, time.Now())
+	for i := range expired {
+		event := &expired[i]
+		event.TypeMeta = eventList.TypeMeta
+		if err := sdk.Delete(event); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete event %s: %v", event.Name, err)
+		}
+	}
+	if len(expired) > 0 {
+		logger.Debugf("removed %d expired events", len(expired))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func reconcileRollout(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	client, _, err := k8sclient.GetResourceClient(k8s.RolloutAPIVersion, k8s.RolloutKind, nginx.Namespace)
+	if err != nil {
+		return &resourceUnavailableError{apiVersion: k8s.RolloutAPIVersion, kind: k8s.RolloutKind}
+	}
+
+	newRollout, err := k8s.NewRollout(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to assemble rollout from nginx: %v", err)
+	}
+
+	_, err = client.Create(newRollout)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create rollout: %v", err)
+	}
+
+	if err == nil {
+		recordEvent(nginx, corev1.EventTypeNormal, "RolloutCreated", fmt.Sprintf("Created rollout %s", newRollout.GetName()), logger)
+		return nil
+	}
+
+	currRollout, err := client.Get(newRollout.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to retrieve rollout: %v", err)
+	}
+
+	currHash, err := k8s.CurrentGeneratedHash(nginx, currRollout, func(n *v1alpha1.Nginx) (metav1.Object, error) {
+		return k8s.NewRollout(n)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to compare rollout with the current one: %v", err)
+	}
+	newHash, _ := k8s.GeneratedHashOf(newRollout)
+
+	if newHash == currHash && !k8s.PodRestartRequested(podAnnotations(newRollout), podAnnotations(currRollout)) {
+		logger.Debug("nothing changed")
+		if _, ok := k8s.GeneratedHashOf(currRollout); !ok || k8s.MetadataDrift(newRollout, currRollout) {
+			k8s.CopyGeneratedHash(currRollout, newRollout)
+			k8s.MergeMetadata(currRollout, newRollout)
+			if _, err := client.Update(currRollout); err != nil {
+				return fmt.Errorf("failed to record generated hash: %v", err)
+			}
+		}
+		return nil
+	}
+
+	currRollout.Object["spec"] = newRollout.Object["spec"]
+	k8s.CopyGeneratedHash(currRollout, newRollout)
+	k8s.MergeMetadata(currRollout, newRollout)
+
+	if _, err := client.Update(currRollout); err != nil {
+		return fmt.Errorf("failed to update rollout: %v", err)
+	}
+
+	recordEvent(nginx, corev1.EventTypeNormal, "RolloutUpdated", fmt.Sprintf("Updated rollout %s", currRollout.GetName()), logger)
+
+	return nil
+}
+
+// deleteReplacedDeployment removes the deployment previously created for the
+// nginx, if any, once a rollout, statefulset or daemonset has taken its place. With the
+// Orphan policy the old pods keep serving until they are removed manually.
+// The canary deployment of an unfinished canary rollout is removed as well.
+func deleteReplacedDeployment(nginx *v1alpha1.Nginx) error {
+	deploy := &appv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-deployment",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(deploy, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete replaced deployment: %v", err)
+	}
+	nginx.Status.Canary = nil
+	return deleteCanaryDeployment(nginx)
+}
+
+// podAnnotations returns the annotations of the pod template of a rollout
+func podAnnotations(rollout *unstructured.Unstructured) map[string]string {
+	annotations, _ := unstructured.NestedStringMap(rollout.Object, "spec", "template", "metadata", "annotations")
+	return annotations
+}
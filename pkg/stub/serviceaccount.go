@@ -0,0 +1,126 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileServiceAccount creates or updates the service account of the
+// nginx and the role and role binding granting it permissions, deleting the
+// ones no longer requested. It runs before the workload, since pods of a
+// missing service account cannot be created.
+func reconcileServiceAccount(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	if account := k8s.NewServiceAccount(nginx); account != nil {
+		current := &corev1.ServiceAccount{
+			TypeMeta:   account.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: account.Name, Namespace: account.Namespace},
+		}
+		err := applyRBACObject(nginx, account, current, "ServiceAccount", func() bool {
+			return k8s.MetadataDrift(account, current)
+		}, func() {
+			k8s.MergeMetadata(current, account)
+		}, logger)
+		if err != nil {
+			return err
+		}
+	} else if err := deleteRBACObject(nginx, &corev1.ServiceAccount{TypeMeta: metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"}}, logger); err != nil {
+		return err
+	}
+
+	if role := k8s.NewRole(nginx); role != nil {
+		current := &rbacv1.Role{
+			TypeMeta:   role.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: role.Name, Namespace: role.Namespace},
+		}
+		err := applyRBACObject(nginx, role, current, "Role", func() bool {
+			return len(k8s.RoleDrift(role, current)) > 0 || k8s.MetadataDrift(role, current)
+		}, func() {
+			current.Rules = role.Rules
+			k8s.MergeMetadata(current, role)
+		}, logger)
+		if err != nil {
+			return err
+		}
+	} else if err := deleteRBACObject(nginx, &rbacv1.Role{TypeMeta: metav1.TypeMeta{Kind: "Role", APIVersion: "rbac.authorization.k8s.io/v1"}}, logger); err != nil {
+		return err
+	}
+
+	if binding := k8s.NewRoleBinding(nginx); binding != nil {
+		current := &rbacv1.RoleBinding{
+			TypeMeta:   binding.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: binding.Name, Namespace: binding.Namespace},
+		}
+		return applyRBACObject(nginx, binding, current, "RoleBinding", func() bool {
+			return len(k8s.RoleBindingDrift(binding, current)) > 0 || k8s.MetadataDrift(binding, current)
+		}, func() {
+			current.Subjects = binding.Subjects
+			k8s.MergeMetadata(current, binding)
+		}, logger)
+	}
+	return deleteRBACObject(nginx, &rbacv1.RoleBinding{TypeMeta: metav1.TypeMeta{Kind: "RoleBinding", APIVersion: "rbac.authorization.k8s.io/v1"}}, logger)
+}
+
+// applyRBACObject creates the desired object, or retrieves it into current
+// and updates it with merge when it drifted
+func applyRBACObject(nginx *v1alpha1.Nginx, desired, current sdk.Object, kind string, drifted func() bool, merge func(), logger *logrus.Entry) error {
+	name := desired.(metav1.Object).GetName()
+	err := sdk.Create(desired)
+	if err == nil {
+		recordEvent(nginx, corev1.EventTypeNormal, kind+"Created", fmt.Sprintf("Created %s %s", kind, name), logger)
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create %s: %v", kind, err)
+	}
+	if err := sdk.Get(current); err != nil {
+		return fmt.Errorf("failed to retrieve %s: %v", kind, err)
+	}
+	if !drifted() {
+		return nil
+	}
+	merge()
+	if err := sdk.Update(current); err != nil {
+		return fmt.Errorf("failed to update %s: %v", kind, err)
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, kind+"Updated", fmt.Sprintf("Updated %s %s", kind, name), logger)
+	return nil
+}
+
+// deleteRBACObject removes the object of the given kind previously created
+// for the nginx, if any. Objects not controlled by the nginx, like a service
+// account with the same name created by hand, are kept.
+func deleteRBACObject(nginx *v1alpha1.Nginx, obj sdk.Object, logger *logrus.Entry) error {
+	meta := obj.(metav1.Object)
+	meta.SetName(nginx.Name)
+	meta.SetNamespace(nginx.Namespace)
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	err := sdk.Get(obj)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve %s: %v", kind, err)
+	}
+	if ref := metav1.GetControllerOf(meta); ref == nil || ref.UID != nginx.UID {
+		return nil
+	}
+	err = sdk.Delete(obj, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", kind, err)
+	}
+	recordEvent(nginx, corev1.EventTypeNormal, kind+"Deleted", fmt.Sprintf("Deleted %s %s", kind, nginx.Name), logger)
+	return nil
+}
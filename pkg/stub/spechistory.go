@@ -0,0 +1,148 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// listSpecRevisions returns the ControllerRevisions holding the spec history
+// of the nginx
+func listSpecRevisions(nginx *v1alpha1.Nginx) ([]appv1.ControllerRevision, error) {
+	revisionList := &appv1.ControllerRevisionList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ControllerRevision",
+			APIVersion: "apps/v1",
+		},
+	}
+	labelSelector := labels.SelectorFromSet(k8s.LabelsForNginx(nginx.Name)).String()
+	if err := sdk.List(nginx.Namespace, revisionList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: labelSelector})); err != nil {
+		return nil, fmt.Errorf("failed to list controller revisions: %v", err)
+	}
+	var revisions []appv1.ControllerRevision
+	for _, cr := range revisionList.Items {
+		if _, ok := cr.Labels[k8s.SpecRevisionHashLabel]; !ok || !metav1.IsControlledBy(&cr, nginx) {
+			continue
+		}
+		// The list is decoded with the kind of the list, not of its items
+		cr.TypeMeta = metav1.TypeMeta{Kind: "ControllerRevision", APIVersion: "apps/v1"}
+		revisions = append(revisions, cr)
+	}
+	return revisions, nil
+}
+
+// rollbackSpec replaces the spec of the nginx with the revision of the
+// history requested in spec.rollbackTo. Unknown revisions leave the spec as
+// it is, with an event. The request is cleared in both cases.
+func rollbackSpec(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	rollback := nginx.Spec.RollbackTo
+	if rollback == nil {
+		return nil
+	}
+	revisions, err := listSpecRevisions(nginx)
+	if err != nil {
+		return err
+	}
+	target := k8s.RollbackTarget(revisions, rollback, nginx.Status.SpecRevision)
+	if target == nil {
+		nginx.Spec.RollbackTo = nil
+		if err := sdk.Update(nginx); err != nil {
+			return fmt.Errorf("failed to clear nginx rollback: %v", err)
+		}
+		msg := "No previous revision of the spec to roll back to"
+		if rollback.Revision != 0 {
+			msg = fmt.Sprintf("Revision %d of the spec is not in the history", rollback.Revision)
+		}
+		recordEvent(nginx, corev1.EventTypeWarning, "RollbackRevisionNotFound", msg, logger)
+		return nil
+	}
+	spec, err := k8s.SpecFromRevision(target)
+	if err != nil {
+		return err
+	}
+	nginx.Spec = *spec
+	if err := sdk.Update(nginx); err != nil {
+		return fmt.Errorf("failed to roll back nginx spec: %v", err)
+	}
+	logger.Infof("spec rolled back to revision %d", target.Revision)
+	recordEvent(nginx, corev1.EventTypeNormal, "RolledBack", fmt.Sprintf("Spec rolled back to revision %d", target.Revision), logger)
+	return nil
+}
+
+// recordSpecRevision keeps the spec reconciled successfully in the history.
+// A spec already in it becomes the newest revision again, and the oldest
+// revisions beyond spec.specHistoryLimit are removed.
+func recordSpecRevision(nginx *v1alpha1.Nginx, spec *v1alpha1.NginxSpec, logger *logrus.Entry) error {
+	revisions, err := listSpecRevisions(nginx)
+	if err != nil {
+		return err
+	}
+	hash, err := k8s.SpecRevisionHash(spec)
+	if err != nil {
+		return fmt.Errorf("failed to hash nginx spec: %v", err)
+	}
+
+	var latest int64
+	var current *appv1.ControllerRevision
+	for i := range revisions {
+		cr := &revisions[i]
+		if cr.Revision > latest {
+			latest = cr.Revision
+		}
+		if cr.Labels[k8s.SpecRevisionHashLabel] == hash {
+			current = cr
+		}
+	}
+	switch {
+	case current == nil:
+		current, err = k8s.NewSpecRevision(nginx, spec, latest+1)
+		if err != nil {
+			return fmt.Errorf("failed to assemble controller revision from nginx: %v", err)
+		}
+		if err := sdk.Create(current); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create controller revision: %v", err)
+		}
+		revisions = append(revisions, *current)
+		logger.Debugf("spec recorded as revision %d", current.Revision)
+	case current.Revision != latest:
+		current.Revision = latest + 1
+		if err := sdk.Update(current); err != nil {
+			return fmt.Errorf("failed to update controller revision: %v", err)
+		}
+		logger.Debugf("spec recorded again as revision %d", current.Revision)
+	}
+
+	expired := k8s.ExpiredSpecRevisions(revisions, current.Revision, k8s.SpecHistoryLimit(spec))
+	for i := range expired {
+		if err := sdk.Delete(&expired[i]); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete controller revision %s: %v", expired[i].Name, err)
+		}
+	}
+	var kept []appv1.ControllerRevision
+	for _, cr := range revisions {
+		if !containsRevision(expired, cr.Revision) {
+			kept = append(kept, cr)
+		}
+	}
+	nginx.Status.SpecRevision = current.Revision
+	nginx.Status.SpecHistory = k8s.SpecHistory(kept)
+	return nil
+}
+
+func containsRevision(revisions []appv1.ControllerRevision, revision int64) bool {
+	for _, cr := range revisions {
+		if cr.Revision == revision {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package stub
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/stub/internal/fakeapi"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordImages records the spec of the nginx in the history once for each
+// image, in order
+func recordImages(t *testing.T, h *Handler, nginx *v1alpha1.Nginx, images ...string) {
+	for _, image := range images {
+		spec := nginx.Spec.DeepCopy()
+		spec.Image = image
+		assert.Nil(t, recordSpecRevision(nginx, spec, logrus.NewEntry(h.logger)))
+	}
+}
+
+// historyImages returns the images of the spec history, newest first
+func historyImages(nginx *v1alpha1.Nginx) []string {
+	var images []string
+	for _, entry := range nginx.Status.SpecHistory {
+		images = append(images, entry.Image)
+	}
+	return images
+}
+
+func TestRecordSpecRevisionLimit(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	tests := []struct {
+		name  string
+		limit *int32
+		specs int
+		want  int
+	}{
+		{name: "default", specs: 12, want: 11},
+		{name: "below the limit", limit: int32Ptr(3), specs: 2, want: 2},
+		{name: "at the limit", limit: int32Ptr(3), specs: 4, want: 4},
+		{name: "above the limit", limit: int32Ptr(3), specs: 6, want: 4},
+		{name: "zero", limit: int32Ptr(0), specs: 3, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			nginx := createNginx(t, &v1alpha1.Nginx{Spec: v1alpha1.NginxSpec{SpecHistoryLimit: tt.limit}})
+			var images []string
+			for i := 1; i <= tt.specs; i++ {
+				images = append(images, fmt.Sprintf("nginx:1.%d", i))
+			}
+			recordImages(t, h, nginx, images...)
+
+			// The current spec and the newest previous ones are kept
+			assert.Equal(t, int64(tt.specs), nginx.Status.SpecRevision)
+			assert.Equal(t, tt.want, fakeapi.Count("ControllerRevision"))
+			if assert.Len(t, nginx.Status.SpecHistory, tt.want) {
+				for i, entry := range nginx.Status.SpecHistory {
+					assert.Equal(t, int64(tt.specs-i), entry.Revision)
+					assert.Equal(t, images[tt.specs-i-1], entry.Image)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordSpecRevisionOrder(t *testing.T) {
+	h := newTestHandler(t)
+	nginx := createNginx(t, &v1alpha1.Nginx{})
+	recordImages(t, h, nginx, "nginx:a", "nginx:b", "nginx:c")
+	assert.Equal(t, []string{"nginx:c", "nginx:b", "nginx:a"}, historyImages(nginx))
+
+	// A spec already in the history becomes the newest revision again
+	recordImages(t, h, nginx, "nginx:a")
+	assert.Equal(t, int64(4), nginx.Status.SpecRevision)
+	assert.Equal(t, []string{"nginx:a", "nginx:c", "nginx:b"}, historyImages(nginx))
+	if assert.Len(t, nginx.Status.SpecHistory, 3) {
+		assert.Equal(t, int64(4), nginx.Status.SpecHistory[0].Revision)
+		assert.Equal(t, int64(3), nginx.Status.SpecHistory[1].Revision)
+	}
+	assert.Equal(t, 3, fakeapi.Count("ControllerRevision"), "revision reused")
+
+	// Recording the newest spec again changes nothing
+	recordImages(t, h, nginx, "nginx:a")
+	assert.Equal(t, int64(4), nginx.Status.SpecRevision)
+	assert.Equal(t, []string{"nginx:a", "nginx:c", "nginx:b"}, historyImages(nginx))
+
+	// The oldest revisions are the ones removed beyond the limit, even when
+	// created before a spec recorded again
+	limit := int32(1)
+	nginx.Spec.SpecHistoryLimit = &limit
+	recordImages(t, h, nginx, "nginx:b")
+	assert.Equal(t, int64(5), nginx.Status.SpecRevision)
+	assert.Equal(t, []string{"nginx:b", "nginx:a"}, historyImages(nginx))
+	assert.Equal(t, 2, fakeapi.Count("ControllerRevision"))
+}
@@ -0,0 +1,142 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func reconcileStatefulSet(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	newSts, err := k8s.NewStatefulSet(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to assemble statefulset from nginx: %v", err)
+	}
+
+	currSts := &appv1.StatefulSet{
+		TypeMeta: newSts.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newSts.Name,
+			Namespace: newSts.Namespace,
+		},
+	}
+	err = sdk.Get(currSts)
+	if errors.IsNotFound(err) {
+		if err := checkWorkloadConfig(nginx, logger); err != nil {
+			return err
+		}
+		if err := createWorkload(nginx, newSts); err != nil {
+			return fmt.Errorf("failed to create statefulset: %v", err)
+		}
+		recordEvent(nginx, corev1.EventTypeNormal, "StatefulSetCreated", fmt.Sprintf("Created statefulset %s", newSts.Name), logger)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve statefulset: %v", err)
+	}
+
+	currHash, err := k8s.CurrentGeneratedHash(nginx, currSts, func(n *v1alpha1.Nginx) (metav1.Object, error) {
+		return k8s.NewStatefulSet(n)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to compare statefulset with the current one: %v", err)
+	}
+	newHash, _ := k8s.GeneratedHashOf(newSts)
+
+	purge := k8s.PodRestartRequested(newSts.Spec.Template.Annotations, currSts.Spec.Template.Annotations)
+	var drift []string
+	if newHash != currHash {
+		if err := checkWorkloadConfig(nginx, logger); err != nil {
+			return err
+		}
+	} else if !purge {
+		drift = k8s.StatefulSetDrift(newSts, currSts)
+		if len(drift) == 0 {
+			logger.Debug("nothing changed")
+			return recordGeneratedHash(nginx, currSts, newSts)
+		}
+	}
+
+	// Only the replicas, the pod template and the update strategy of
+	// statefulsets can be updated
+	if !reflect.DeepEqual(newSts.Spec.VolumeClaimTemplates, currSts.Spec.VolumeClaimTemplates) {
+		recordEvent(nginx, corev1.EventTypeWarning, "VolumeClaimsUnchanged",
+			fmt.Sprintf("Volume claims of statefulset %s cannot be changed, delete it to apply spec.cache", currSts.Name), logger)
+		newSts.Spec.Template.Spec.Volumes = currentClaimVolumes(newSts, currSts)
+	}
+	currSts.Spec.Replicas = newSts.Spec.Replicas
+	currSts.Spec.Template = newSts.Spec.Template
+	currSts.Spec.UpdateStrategy = newSts.Spec.UpdateStrategy
+	k8s.CopyGeneratedHash(currSts, newSts)
+	k8s.MergeMetadata(currSts, newSts)
+
+	if err := updateWorkload(nginx, currSts); err != nil {
+		return fmt.Errorf("failed to update statefulset: %v", err)
+	}
+
+	if len(drift) > 0 {
+		recordEvent(nginx, corev1.EventTypeNormal, "DriftCorrected",
+			fmt.Sprintf("StatefulSet %s was modified out of band, restored fields: %s", currSts.Name, strings.Join(drift, ", ")), logger)
+	} else {
+		recordEvent(nginx, corev1.EventTypeNormal, "StatefulSetUpdated", fmt.Sprintf("Updated statefulset %s", currSts.Name), logger)
+	}
+	return nil
+}
+
+// currentClaimVolumes returns the volumes of the new pod template without the
+// ones provided by the claim templates of the current statefulset, which
+// cannot be changed
+func currentClaimVolumes(newSts, currSts *appv1.StatefulSet) []corev1.Volume {
+	claims := make(map[string]bool)
+	for _, c := range currSts.Spec.VolumeClaimTemplates {
+		claims[c.Name] = true
+	}
+	var volumes []corev1.Volume
+	for _, v := range newSts.Spec.Template.Spec.Volumes {
+		if !claims[v.Name] {
+			volumes = append(volumes, v)
+		}
+	}
+	return volumes
+}
+
+// checkWorkloadConfig validates the config of statefulsets and daemonsets
+// using the pod template of the deployment, which has the same containers and
+// uses an emptyDir in place of the claimed cache volume
+func checkWorkloadConfig(nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	deployment, err := k8s.NewDeployment(nginx)
+	if err != nil {
+		return fmt.Errorf("failed to assemble deployment from nginx: %v", err)
+	}
+	return checkConfig(nginx, deployment, logger)
+}
+
+// deleteReplacedStatefulSet removes the statefulset previously created for
+// the nginx, if any, once another workload has taken its place
+func deleteReplacedStatefulSet(nginx *v1alpha1.Nginx) error {
+	sts := &appv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nginx.Name + "-statefulset",
+			Namespace: nginx.Namespace,
+		},
+	}
+	err := sdk.Delete(sts, sdk.WithDeleteOptions(deleteOptions(nginx)))
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete replaced statefulset: %v", err)
+	}
+	return nil
+}
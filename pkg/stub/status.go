@@ -0,0 +1,71 @@
+package stub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// statusUpdateWindow is the minimum interval between status writes of the
+// same nginx. Changes happening within the window are merged into the next
+// write, done by a later event since the events always carry the stored status.
+const statusUpdateWindow = 10 * time.Second
+
+// statusWriter writes nginx status changes as merge patches, coalescing
+// changes that happen in quick succession.
+type statusWriter struct {
+	mu        sync.Mutex
+	lastWrite map[types.UID]time.Time
+}
+
+func newStatusWriter() *statusWriter {
+	return &statusWriter{lastWrite: make(map[types.UID]time.Time)}
+}
+
+// update patches the nginx status from the stored status to the desired one,
+// unless the status was written within the update window.
+func (w *statusWriter) update(nginx *v1alpha1.Nginx, stored, desired v1alpha1.NginxStatus, logger *logrus.Entry) error {
+	patch, err := k8s.StatusPatch(stored, desired)
+	if err != nil {
+		return fmt.Errorf("failed to compute status patch: %v", err)
+	}
+	if patch == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	last, ok := w.lastWrite[nginx.UID]
+	w.mu.Unlock()
+	if ok && time.Since(last) < statusUpdateWindow {
+		logger.Debug("status written recently, deferring update")
+		return nil
+	}
+
+	client, _, err := k8sclient.GetResourceClient(v1alpha1.SchemeGroupVersion.String(), "Nginx", nginx.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get nginx client: %v", err)
+	}
+	if _, err := client.Patch(nginx.Name, types.MergePatchType, patch); err != nil {
+		return err
+	}
+	nginx.Status = desired
+
+	w.mu.Lock()
+	w.lastWrite[nginx.UID] = time.Now()
+	w.mu.Unlock()
+	return nil
+}
+
+// forget removes the nginx from the writer
+func (w *statusWriter) forget(nginx *v1alpha1.Nginx) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.lastWrite, nginx.UID)
+}
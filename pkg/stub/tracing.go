@@ -0,0 +1,34 @@
+package stub
+
+import (
+	"context"
+
+	"github.com/tsuru/nginx-operator/pkg/tracing"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// endSpan ends the span of a reconcile step. Blocked reconciles are waiting
+// for something else and are not failures, their reason is recorded instead.
+func endSpan(span *tracing.Span, err error) {
+	if blocked, ok := err.(*reconcileBlockedError); ok {
+		span.SetAttributes(tracing.String("nginx.blocked_reason", blocked.reason))
+		err = nil
+	}
+	span.End(err)
+}
+
+// fetch retrieves the object in a span of the given name. Missing objects
+// are about to be created, so they do not fail the span.
+func fetch(ctx context.Context, name string, obj sdk.Object) error {
+	_, span := tracing.Start(ctx, name)
+	err := sdk.Get(obj)
+	if errors.IsNotFound(err) {
+		span.SetAttributes(tracing.Bool("fetch.found", false))
+		span.End(nil)
+		return err
+	}
+	span.End(err)
+	return err
+}
@@ -0,0 +1,64 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// resourceUnavailableError is returned when the kind of an object is not
+// served by the cluster, usually because its CRD is not installed.
+type resourceUnavailableError struct {
+	apiVersion string
+	kind       string
+}
+
+func (e *resourceUnavailableError) Error() string {
+	return fmt.Sprintf("resource %s %s is not available in the cluster", e.apiVersion, e.kind)
+}
+
+func isResourceUnavailable(err error) bool {
+	_, ok := err.(*resourceUnavailableError)
+	return ok
+}
+
+// reconcileUnstructured creates the object or, if it already exists, replaces
+// its spec when it differs from the desired one and adds the labels and
+// annotations it lacks. It is used for objects whose types are not known by
+// the operator, like third party CRDs.
+func reconcileUnstructured(desired *unstructured.Unstructured) error {
+	client, _, err := k8sclient.GetResourceClient(desired.GetAPIVersion(), desired.GetKind(), desired.GetNamespace())
+	if err != nil {
+		return &resourceUnavailableError{apiVersion: desired.GetAPIVersion(), kind: desired.GetKind()}
+	}
+
+	_, err = client.Create(desired)
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create %s: %v", desired.GetKind(), err)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	current, err := client.Get(desired.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to retrieve %s: %v", desired.GetKind(), err)
+	}
+
+	if !k8s.ShouldUpdate(current, desired) && !k8s.MetadataDrift(desired, current) {
+		return nil
+	}
+
+	current.Object["spec"] = desired.Object["spec"]
+	k8s.MergeMetadata(current, desired)
+	if _, err := client.Update(current); err != nil {
+		return fmt.Errorf("failed to update %s: %v", desired.GetKind(), err)
+	}
+	return nil
+}
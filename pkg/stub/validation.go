@@ -0,0 +1,44 @@
+package stub
+
+import (
+	"context"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkReplicas warns about replica counts that conflict with the
+// PodDisruptionBudgets and HorizontalPodAutoscalers of the namespace. The
+// problems found are reported as events and never fail the reconciliation.
+func checkReplicas(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) {
+	pdbList := &policyv1beta1.PodDisruptionBudgetList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1beta1",
+		},
+	}
+	if err := sdk.List(nginx.Namespace, pdbList); err != nil {
+		logger.Warnf("failed to list pod disruption budgets: %v", err)
+	}
+
+	hpaList := &autoscalingv1.HorizontalPodAutoscalerList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "HorizontalPodAutoscaler",
+			APIVersion: "autoscaling/v1",
+		},
+	}
+	if err := sdk.List(nginx.Namespace, hpaList); err != nil {
+		logger.Warnf("failed to list horizontal pod autoscalers: %v", err)
+	}
+
+	for _, w := range k8s.ReplicaWarnings(nginx, pdbList.Items, hpaList.Items) {
+		recordEvent(nginx, corev1.EventTypeWarning, "ReplicasConflict", w, logger)
+	}
+}
@@ -0,0 +1,103 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileVerticalAutoscaler creates or updates the VerticalPodAutoscaler
+// of the nginx, recording its recommendation in the status, and removes it
+// once spec.autoscaling.vertical is unset
+func reconcileVerticalAutoscaler(ctx context.Context, nginx *v1alpha1.Nginx, logger *logrus.Entry) error {
+	vpa := k8s.NewVerticalPodAutoscaler(nginx)
+	if vpa == nil {
+		if nginx.Status.VerticalAutoscaler == nil {
+			return nil
+		}
+		if err := deleteVerticalAutoscaler(nginx); err != nil {
+			return err
+		}
+		nginx.Status.VerticalAutoscaler = nil
+		return nil
+	}
+	err := reconcileUnstructured(vpa)
+	if isResourceUnavailable(err) {
+		if nginx.Status.VerticalAutoscaler == nil {
+			recordEvent(nginx, corev1.EventTypeWarning, "VerticalAutoscalerUnavailable",
+				"The VerticalPodAutoscaler CRD is not installed in the cluster, the pods are not autoscaled vertically", logger)
+		}
+		logger.Warnf("skipping vertical pod autoscaler: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	client, _, err := k8sclient.GetResourceClient(k8s.VerticalPodAutoscalerAPIVersion, k8s.VerticalPodAutoscalerKind, nginx.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve vertical pod autoscaler: %v", err)
+	}
+	current, err := client.Get(vpa.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to retrieve vertical pod autoscaler: %v", err)
+	}
+	status := &v1alpha1.NginxVerticalAutoscalerStatus{
+		Name:           vpa.GetName(),
+		Recommendation: k8s.VerticalRecommendation(current),
+	}
+	if prev := nginx.Status.VerticalAutoscaler; status.Recommendation != nil && (prev == nil || prev.Recommendation == nil) {
+		recordEvent(nginx, corev1.EventTypeNormal, "ResourcesRecommended",
+			fmt.Sprintf("VerticalPodAutoscaler %s recommends %s for the nginx container", vpa.GetName(), formatResources(status.Recommendation.Target)), logger)
+	}
+	nginx.Status.VerticalAutoscaler = status
+	return nil
+}
+
+// deleteVerticalAutoscaler removes the VerticalPodAutoscaler of the nginx,
+// if it still controls it
+func deleteVerticalAutoscaler(nginx *v1alpha1.Nginx) error {
+	client, _, err := k8sclient.GetResourceClient(k8s.VerticalPodAutoscalerAPIVersion, k8s.VerticalPodAutoscalerKind, nginx.Namespace)
+	if err != nil {
+		return nil
+	}
+	vpa, err := client.Get(nginx.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve vertical pod autoscaler: %v", err)
+	}
+	if !metav1.IsControlledBy(vpa, nginx) {
+		return nil
+	}
+	err = client.Delete(nginx.Name, deleteOptions(nginx))
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete vertical pod autoscaler: %v", err)
+	}
+	return nil
+}
+
+// formatResources formats the resources like cpu=250m, memory=128Mi
+func formatResources(list corev1.ResourceList) string {
+	s := ""
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		q, ok := list[name]
+		if !ok {
+			continue
+		}
+		if s != "" {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s=%s", name, q.String())
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package stub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/webhook"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// Keys of the secret holding the certificates of the webhooks
+	webhookCABundleKey = "ca.crt"
+	webhookCAKeyKey    = "ca.key"
+
+	// nginxCRDName is the name of the CRD whose conversion webhook is served
+	// by the operator
+	nginxCRDName = "nginxs.nginx.tsuru.io"
+)
+
+// WebhookCertificateOptions are the objects used to manage the certificate of
+// the webhooks.
+type WebhookCertificateOptions struct {
+	// Namespace of the Secret and of the Service of the webhooks
+	Namespace string
+	// Secret holding the generated certificates
+	Secret string
+	// Service the API server reaches the webhooks through
+	Service string
+	// Configuration is the name of the ValidatingWebhookConfiguration and
+	// of the MutatingWebhookConfiguration of the webhooks
+	Configuration string
+}
+
+// SyncWebhookCertificate generates or rotates the certificate of the webhooks
+// when needed, storing it in the secret so it survives restarts and is shared
+// by the replicas of the operator, loads it into the store and sets the CA
+// in the webhook configurations and in the conversion of the Nginx CRD.
+func SyncWebhookCertificate(opts WebhookCertificateOptions, store *webhook.CertificateStore, logger *logrus.Logger) error {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Secret,
+			Namespace: opts.Namespace,
+		},
+	}
+	err := sdk.Get(secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to retrieve webhook certificate secret: %v", err)
+	}
+	exists := err == nil
+	current := &webhook.Certificates{
+		CABundle: secret.Data[webhookCABundleKey],
+		CAKey:    secret.Data[webhookCAKeyKey],
+		Cert:     secret.Data[corev1.TLSCertKey],
+		Key:      secret.Data[corev1.TLSPrivateKeyKey],
+	}
+	certs, changed, err := webhook.EnsureCertificates(current, webhook.ServiceDNSNames(opts.Service, opts.Namespace), time.Now())
+	if err != nil {
+		return err
+	}
+	if changed {
+		secret.Type = corev1.SecretTypeTLS
+		secret.Data = map[string][]byte{
+			webhookCABundleKey:      certs.CABundle,
+			webhookCAKeyKey:         certs.CAKey,
+			corev1.TLSCertKey:       certs.Cert,
+			corev1.TLSPrivateKeyKey: certs.Key,
+		}
+		// Replicas racing to write the secret get a conflict and load the
+		// winner's certificate on their next sync
+		if exists {
+			err = sdk.Update(secret)
+		} else {
+			err = sdk.Create(secret)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write webhook certificate secret: %v", err)
+		}
+		logger.Infof("Webhook certificate written to secret %s/%s", opts.Namespace, opts.Secret)
+	}
+	if err := store.Set(certs.Cert, certs.Key); err != nil {
+		return fmt.Errorf("failed to load webhook certificate: %v", err)
+	}
+
+	for _, kind := range []string{"ValidatingWebhookConfiguration", "MutatingWebhookConfiguration"} {
+		err := updateCABundle("admissionregistration.k8s.io/v1beta1", kind, opts.Configuration, func(o *unstructured.Unstructured) bool {
+			return webhook.SetWebhooksCABundle(o, certs.CABundle)
+		}, logger)
+		if err != nil {
+			return err
+		}
+	}
+	return updateCABundle("apiextensions.k8s.io/v1", "CustomResourceDefinition", nginxCRDName, func(o *unstructured.Unstructured) bool {
+		return webhook.SetConversionCABundle(o, certs.CABundle)
+	}, logger)
+}
+
+// updateCABundle sets the CA bundle of a cluster-scoped object with set.
+// Objects that were not installed are skipped. Unstructured objects are used
+// so fields unknown to the operator are kept.
+func updateCABundle(apiVersion, kind, name string, set func(*unstructured.Unstructured) bool, logger *logrus.Logger) error {
+	client, _, err := k8sclient.GetResourceClient(apiVersion, kind, "")
+	if err != nil {
+		logger.Debugf("Skipping caBundle of %s %s: %v", kind, name, err)
+		return nil
+	}
+	obj, err := client.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		logger.Debugf("Skipping caBundle of %s %s: not found", kind, name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve %s %s: %v", kind, name, err)
+	}
+	if !set(obj) {
+		return nil
+	}
+	if _, err := client.Update(obj); err != nil {
+		return fmt.Errorf("failed to update caBundle of %s %s: %v", kind, name, err)
+	}
+	logger.Infof("Updated caBundle of %s %s", kind, name)
+	return nil
+}
@@ -0,0 +1,275 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultServiceName is the service.name of the exported spans when
+	// none is set
+	DefaultServiceName = "nginx-operator"
+
+	// scopeName is the instrumentation scope of the exported spans
+	scopeName = "github.com/tsuru/nginx-operator"
+
+	// maxQueuedSpans is the number of ended spans kept until exported. Spans
+	// ended while the queue is full are dropped, so a slow collector never
+	// holds the reconciles.
+	maxQueuedSpans = 2048
+
+	// maxBatchSpans is the number of spans exported per request
+	maxBatchSpans = 512
+
+	// exportInterval is how often the queued spans are exported
+	exportInterval = 5 * time.Second
+
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// Options configure the export of the spans
+type Options struct {
+	// Endpoint is the base URL of the collector, like
+	// http://otel-collector:4318. The spans are sent to its /v1/traces path.
+	Endpoint string
+	// ServiceName is the service.name resource attribute of the spans
+	ServiceName string
+	// ServiceVersion is the service.version resource attribute of the spans
+	ServiceVersion string
+	// Headers are sent with every export request, like authentication
+	// headers
+	Headers map[string]string
+	// SampleRatio is the share of the traces exported, from 0 to 1
+	SampleRatio float64
+}
+
+// Exporter sends the ended spans to the collector in batches
+type Exporter struct {
+	// dropped is first to be 64-bit aligned for the atomic operations
+	dropped     uint64
+	url         string
+	opts        Options
+	client      *http.Client
+	queue       chan *Span
+	sampleBound uint64
+}
+
+// NewExporter returns an exporter sending the spans to the collector of the
+// options. Run must be called for the spans to be sent.
+func NewExporter(opts Options) (*Exporter, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("endpoint %q must be an http or https URL", opts.Endpoint)
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio must be between 0 and 1")
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = DefaultServiceName
+	}
+	bound := uint64(opts.SampleRatio * (1 << 63))
+	if opts.SampleRatio == 1 {
+		bound = 1 << 63
+	}
+	return &Exporter{
+		url:         strings.TrimSuffix(opts.Endpoint, "/") + "/v1/traces",
+		opts:        opts,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan *Span, maxQueuedSpans),
+		sampleBound: bound,
+	}, nil
+}
+
+// sampled returns whether the trace is exported, deciding from its id like
+// the TraceIdRatioBased sampler, so every operator replica agrees
+func (e *Exporter) sampled(traceID [16]byte) bool {
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < e.sampleBound
+}
+
+func (e *Exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		atomic.AddUint64(&e.dropped, 1)
+	}
+}
+
+// Run exports the queued spans every few seconds, or as soon as a batch is
+// full, until stop is closed. Failed exports are logged and their spans
+// dropped.
+func (e *Exporter) Run(logger logrus.FieldLogger, stop <-chan struct{}) {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	flush := func() {
+		if n := atomic.SwapUint64(&e.dropped, 0); n > 0 {
+			logger.Warnf("dropped %d spans, the export queue was full", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.Export(batch); err != nil {
+			logger.Warnf("failed to export %d spans: %v", len(batch), err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSpans {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// Export sends the spans to the collector
+func (e *Exporter) Export(spans []*Span) error {
+	data, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// The types below are the OTLP JSON encoding of the ExportTraceServiceRequest
+// message. Ids are hex encoded and 64-bit integers are strings.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanData `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanData struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            spanStatus `json:"status"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func (e *Exporter) request(spans []*Span) exportRequest {
+	resourceAttrs := []keyValue{toKeyValue(String("service.name", e.opts.ServiceName))}
+	if e.opts.ServiceVersion != "" {
+		resourceAttrs = append(resourceAttrs, toKeyValue(String("service.version", e.opts.ServiceVersion)))
+	}
+	data := make([]spanData, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		d := spanData{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != [8]byte{} {
+			d.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, a := range s.attrs {
+			d.Attributes = append(d.Attributes, toKeyValue(a))
+		}
+		if s.err != "" {
+			d.Status = spanStatus{Code: statusCodeError, Message: s.err}
+		}
+		s.mu.Unlock()
+		data = append(data, d)
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: resourceAttrs},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: data}},
+	}}}
+}
+
+func toKeyValue(a Attribute) keyValue {
+	kv := keyValue{Key: a.Key}
+	switch v := a.Value.(type) {
+	case bool:
+		kv.Value.BoolValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
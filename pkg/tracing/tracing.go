@@ -0,0 +1,158 @@
+// Package tracing records spans of the operator reconciles and exports them
+// to an OpenTelemetry collector with OTLP over HTTP, in its JSON encoding.
+// Spans are no-ops until an exporter is configured.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute is a key and value recorded in a span. Values are strings,
+// bools or int64s.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a bool attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is an operation of a trace. A nil span, returned when tracing is
+// disabled or the trace is not sampled, records nothing.
+type Span struct {
+	exporter *Exporter
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+	end      time.Time
+	err      string
+
+	mu    sync.Mutex
+	attrs []Attribute
+}
+
+type spanKey struct{}
+
+// exporter is the exporter of the spans started by Start
+var (
+	exporterMu sync.RWMutex
+	exporter   *Exporter
+)
+
+// SetExporter sets the exporter of the spans started by Start, nil to
+// disable tracing
+func SetExporter(e *Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func defaultExporter() *Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter
+}
+
+// Start starts a span, child of the span in the context, if any. The
+// returned context holds the new span. New traces are sampled with the
+// ratio of the exporter and their spans inherit the decision.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	parent, hasParent := ctx.Value(spanKey{}).(*Span)
+	e := defaultExporter()
+	if e == nil || (hasParent && parent == nil) {
+		return ctx, nil
+	}
+	s := &Span{exporter: e, name: name, start: time.Now(), attrs: attrs}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		randomID(s.traceID[:])
+		if !e.sampled(s.traceID) {
+			return context.WithValue(ctx, spanKey{}, (*Span)(nil)), nil
+		}
+	}
+	randomID(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttributes records the attributes in the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End ends the span and queues it for export, marked as failed with the
+// error if it is not nil
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+	s.exporter.enqueue(s)
+}
+
+// TraceID returns the hex encoded id of the trace of the span, empty for
+// nil spans. It can be logged to find the trace of a reconcile.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+func randomID(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on the supported platforms, but an id
+		// must not be all zeros
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(time.Now().UnixNano()))
+	}
+}
+
+// ParseHeaders parses the headers sent with the exported spans, in the
+// key1=value1,key2=value2 format of OTEL_EXPORTER_OTLP_HEADERS
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("invalid header %q, must be key=value", pair)
+		}
+		headers[key] = strings.TrimSpace(parts[1])
+	}
+	return headers, nil
+}
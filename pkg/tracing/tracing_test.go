@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpansAreNoopsWithoutExporter(t *testing.T) {
+	SetExporter(nil)
+	ctx, span := Start(context.Background(), "handle")
+	assert.Nil(t, span)
+	assert.Equal(t, "", span.TraceID())
+	span.SetAttributes(String("key", "value"))
+	span.End(errors.New("failed"))
+
+	_, child := Start(ctx, "fetch")
+	assert.Nil(t, child)
+}
+
+func TestSampling(t *testing.T) {
+	never, err := NewExporter(Options{Endpoint: "http://collector:4318", SampleRatio: 0})
+	assert.NoError(t, err)
+	always, err := NewExporter(Options{Endpoint: "http://collector:4318", SampleRatio: 1})
+	assert.NoError(t, err)
+	defer SetExporter(nil)
+
+	SetExporter(never)
+	ctx, span := Start(context.Background(), "handle")
+	assert.Nil(t, span)
+	// Children of unsampled traces are not recorded either, even once the
+	// sampling changes
+	SetExporter(always)
+	_, child := Start(ctx, "fetch")
+	assert.Nil(t, child)
+
+	ctx, span = Start(context.Background(), "handle")
+	assert.NotNil(t, span)
+	_, child = Start(ctx, "fetch")
+	assert.NotNil(t, child)
+	assert.Equal(t, span.TraceID(), child.TraceID())
+	assert.Equal(t, span.spanID, child.parentID)
+}
+
+func TestExport(t *testing.T) {
+	var body map[string]interface{}
+	var path, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+	}))
+	defer server.Close()
+
+	e, err := NewExporter(Options{
+		Endpoint:       server.URL + "/",
+		ServiceVersion: "1.0.0",
+		Headers:        map[string]string{"Authorization": "Bearer token"},
+		SampleRatio:    1,
+	})
+	assert.NoError(t, err)
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "handle nginx", String("nginx.name", "my-nginx"))
+	_, child := Start(ctx, "apply deployment", Bool("created", true), Int("replicas", 3))
+	child.End(errors.New("failed to update deployment"))
+	root.End(nil)
+
+	assert.NoError(t, e.Export([]*Span{<-e.queue, <-e.queue}))
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "Bearer token", auth)
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"attributes": []interface{}{
+		map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "nginx-operator"}},
+		map[string]interface{}{"key": "service.version", "value": map[string]interface{}{"stringValue": "1.0.0"}},
+	}}, resourceSpans["resource"])
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	assert.Len(t, spans, 2)
+
+	exportedChild := spans[0].(map[string]interface{})
+	exportedRoot := spans[1].(map[string]interface{})
+	assert.Equal(t, "apply deployment", exportedChild["name"])
+	assert.Equal(t, root.TraceID(), exportedChild["traceId"])
+	assert.Equal(t, exportedRoot["spanId"], exportedChild["parentSpanId"])
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "failed to update deployment"}, exportedChild["status"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "created", "value": map[string]interface{}{"boolValue": true}},
+		map[string]interface{}{"key": "replicas", "value": map[string]interface{}{"intValue": "3"}},
+	}, exportedChild["attributes"])
+
+	assert.Equal(t, "handle nginx", exportedRoot["name"])
+	assert.NotContains(t, exportedRoot, "parentSpanId")
+	assert.Equal(t, map[string]interface{}{}, exportedRoot["status"])
+}
+
+func TestExportFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	e, err := NewExporter(Options{Endpoint: server.URL, SampleRatio: 1})
+	assert.NoError(t, err)
+	err = e.Export(nil)
+	assert.EqualError(t, err, "collector returned status 503: unavailable")
+}
+
+func TestNewExporterValidation(t *testing.T) {
+	tests := []struct {
+		opts Options
+		err  string
+	}{
+		{Options{Endpoint: "http://collector:4318", SampleRatio: 0.5}, ""},
+		{Options{Endpoint: "collector:4318", SampleRatio: 1}, `endpoint "collector:4318" must be an http or https URL`},
+		{Options{Endpoint: "https://", SampleRatio: 1}, `endpoint "https://" must be an http or https URL`},
+		{Options{Endpoint: "http://collector:4318", SampleRatio: 1.5}, "sample ratio must be between 0 and 1"},
+	}
+	for _, tt := range tests {
+		_, err := NewExporter(tt.opts)
+		if tt.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.err)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		value   string
+		headers map[string]string
+		err     string
+	}{
+		{"", map[string]string{}, ""},
+		{"api-key=secret", map[string]string{"api-key": "secret"}, ""},
+		{"a=1, b = 2=3 ,", map[string]string{"a": "1", "b": "2=3"}, ""},
+		{"a=1,b", nil, `invalid header "b", must be key=value`},
+		{"=1", nil, `invalid header "=1", must be key=value`},
+	}
+	for _, tt := range tests {
+		headers, err := ParseHeaders(tt.value)
+		if tt.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.err)
+		}
+		assert.Equal(t, tt.headers, headers)
+	}
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"encoding/base64"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SetWebhooksCABundle sets the caBundle of every webhook of a validating or
+// mutating webhook configuration. It returns whether any of them changed.
+func SetWebhooksCABundle(config *unstructured.Unstructured, bundle []byte) bool {
+	encoded := base64.StdEncoding.EncodeToString(bundle)
+	webhooks, _ := unstructured.NestedSlice(config.Object, "webhooks")
+	changed := false
+	for _, w := range webhooks {
+		webhook, ok := w.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if current, _ := unstructured.NestedString(webhook, "clientConfig", "caBundle"); current != encoded {
+			unstructured.SetNestedField(webhook, encoded, "clientConfig", "caBundle")
+			changed = true
+		}
+	}
+	if changed {
+		unstructured.SetNestedSlice(config.Object, webhooks, "webhooks")
+	}
+	return changed
+}
+
+// SetConversionCABundle sets the caBundle of the conversion webhook of a
+// CustomResourceDefinition. It returns whether it changed, CRDs not
+// converted by a webhook are left untouched.
+func SetConversionCABundle(crd *unstructured.Unstructured, bundle []byte) bool {
+	if strategy, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "strategy"); strategy != "Webhook" {
+		return false
+	}
+	encoded := base64.StdEncoding.EncodeToString(bundle)
+	fields := []string{"spec", "conversion", "webhook", "clientConfig", "caBundle"}
+	if current, _ := unstructured.NestedString(crd.Object, fields...); current == encoded {
+		return false
+	}
+	unstructured.SetNestedField(crd.Object, encoded, fields...)
+	return true
+}
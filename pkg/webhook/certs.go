@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	// Validity of the CA and of the serving certificates generated for the
+	// webhooks
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+
+	// CertificateRotationThreshold is how long before its expiration the
+	// serving certificate of the webhooks is replaced
+	CertificateRotationThreshold = 30 * 24 * time.Hour
+)
+
+// Certificates are the serving certificate of the webhooks and the CA that
+// signed it, PEM encoded.
+type Certificates struct {
+	// CABundle holds the CA signing the serving certificates followed by
+	// the previous one while it is still valid, so the API server keeps
+	// trusting the certificate being served during a rotation of the CA.
+	CABundle []byte
+	CAKey    []byte
+	Cert     []byte
+	Key      []byte
+}
+
+// ServiceDNSNames returns the names the API server uses to reach the webhooks
+// through the given service
+func ServiceDNSNames(service, namespace string) []string {
+	return []string{
+		service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+		service + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// EnsureCertificates returns the certificates to serve the webhooks under
+// the given names, generating the ones missing, invalid, about to expire or
+// issued for other names. It returns whether the certificates changed. The
+// CA is replaced once it would expire before a new serving certificate.
+func EnsureCertificates(current *Certificates, dnsNames []string, now time.Time) (*Certificates, bool, error) {
+	if current == nil {
+		current = &Certificates{}
+	}
+	next := *current
+	cas := parseCertificates(current.CABundle)
+	var ca *x509.Certificate
+	caKey, err := parseKey(current.CAKey)
+	if len(cas) > 0 && err == nil {
+		ca = cas[0]
+	}
+	if ca == nil || now.Add(certValidity).After(ca.NotAfter) {
+		ca, caKey, err = newCA(now)
+		if err != nil {
+			return nil, false, err
+		}
+		next.CAKey = encodeKey(caKey)
+		cas = append([]*x509.Certificate{ca}, cas...)
+	}
+	next.CABundle = encodeBundle(cas, now)
+
+	cert := parseCertificates(current.Cert)
+	_, keyErr := parseKey(current.Key)
+	if len(cert) == 0 || keyErr != nil || cert[0].CheckSignatureFrom(ca) != nil ||
+		now.Add(CertificateRotationThreshold).After(cert[0].NotAfter) || !reflect.DeepEqual(cert[0].DNSNames, dnsNames) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to generate the webhook key: %v", err)
+		}
+		template := &x509.Certificate{
+			Subject:     pkix.Name{CommonName: dnsNames[0]},
+			DNSNames:    dnsNames,
+			NotBefore:   now.Add(-time.Hour),
+			NotAfter:    now.Add(certValidity),
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := signCertificate(template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to sign the webhook certificate: %v", err)
+		}
+		next.Cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		next.Key = encodeKey(key)
+	}
+	changed := !bytes.Equal(next.CABundle, current.CABundle) || !bytes.Equal(next.Cert, current.Cert)
+	return &next, changed, nil
+}
+
+func newCA(now time.Time) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate the webhook CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("nginx-operator-webhook-ca@%d", now.Unix())},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := signCertificate(template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign the webhook CA: %v", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+func signCertificate(template, parent *x509.Certificate, pub *ecdsa.PublicKey, priv *ecdsa.PrivateKey) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	return x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+}
+
+// parseCertificates returns the certificates of the PEM data, skipping the
+// invalid ones
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil && block.Type == "CERTIFICATE" {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+func parseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) []byte {
+	der, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// encodeBundle encodes the CAs that did not expire
+func encodeBundle(cas []*x509.Certificate, now time.Time) []byte {
+	var buf bytes.Buffer
+	for _, ca := range cas {
+		if now.Before(ca.NotAfter) {
+			pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		}
+	}
+	return buf.Bytes()
+}
+
+// CertificateStore holds the certificate served by the webhooks, which can
+// be replaced without restarting the server.
+type CertificateStore struct {
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// Set replaces the served certificate
+func (s *CertificateStore) Set(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert = &cert
+	return nil
+}
+
+// LoadFiles replaces the served certificate with the one in the given files
+// if they changed since they were last loaded, like when cert-manager renews
+// a mounted secret. It returns whether the certificate was replaced.
+func (s *CertificateStore) LoadFiles(certFile, keyFile string) (bool, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{certFile, keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	s.mu.RLock()
+	unchanged := s.cert != nil && modTimes == s.modTimes
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert = &cert
+	s.modTimes = modTimes
+	return true, nil
+}
+
+// GetCertificate returns the served certificate, it is meant to be used as
+// the GetCertificate of a tls.Config
+func (s *CertificateStore) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil {
+		return nil, errors.New("webhook certificate not loaded yet")
+	}
+	return s.cert, nil
+}
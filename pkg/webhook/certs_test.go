@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var testDNSNames = ServiceDNSNames("nginx-operator-webhook", "default")
+
+// verify checks the serving certificate is trusted by the CA bundle for the
+// service name at the given time
+func verify(t *testing.T, certs *Certificates, dnsName string, now time.Time) {
+	pool := x509.NewCertPool()
+	assert.True(t, pool.AppendCertsFromPEM(certs.CABundle))
+	cert := parseCertificates(certs.Cert)
+	assert.Len(t, cert, 1)
+	_, err := cert[0].Verify(x509.VerifyOptions{
+		DNSName:     dnsName,
+		Roots:       pool,
+		CurrentTime: now,
+	})
+	assert.Nil(t, err)
+	_, err = tls.X509KeyPair(certs.Cert, certs.Key)
+	assert.Nil(t, err)
+}
+
+func TestEnsureCertificates(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	certs, changed, err := EnsureCertificates(nil, testDNSNames, now)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	verify(t, certs, "nginx-operator-webhook.default.svc", now)
+	assert.Len(t, parseCertificates(certs.CABundle), 1)
+
+	tests := []struct {
+		name          string
+		current       func() *Certificates
+		dnsNames      []string
+		now           time.Time
+		wantChanged   bool
+		wantSameCert  bool
+		wantSameCA    bool
+		wantBundleLen int
+	}{
+		{
+			name:          "valid",
+			current:       func() *Certificates { return certs },
+			dnsNames:      testDNSNames,
+			now:           now.Add(24 * time.Hour),
+			wantSameCert:  true,
+			wantSameCA:    true,
+			wantBundleLen: 1,
+		},
+		{
+			name:          "about-to-expire",
+			current:       func() *Certificates { return certs },
+			dnsNames:      testDNSNames,
+			now:           now.Add(certValidity - CertificateRotationThreshold + time.Hour),
+			wantChanged:   true,
+			wantSameCA:    true,
+			wantBundleLen: 1,
+		},
+		{
+			name:          "other-service",
+			current:       func() *Certificates { return certs },
+			dnsNames:      ServiceDNSNames("webhook", "nginx"),
+			now:           now,
+			wantChanged:   true,
+			wantSameCA:    true,
+			wantBundleLen: 1,
+		},
+		{
+			name: "invalid-key",
+			current: func() *Certificates {
+				c := *certs
+				c.Key = []byte("invalid")
+				return &c
+			},
+			dnsNames:      testDNSNames,
+			now:           now,
+			wantChanged:   true,
+			wantSameCA:    true,
+			wantBundleLen: 1,
+		},
+		{
+			name: "invalid-ca-key",
+			current: func() *Certificates {
+				c := *certs
+				c.CAKey = nil
+				return &c
+			},
+			dnsNames:      testDNSNames,
+			now:           now,
+			wantChanged:   true,
+			wantBundleLen: 2,
+		},
+		{
+			name:          "ca-about-to-expire",
+			current:       func() *Certificates { return certs },
+			dnsNames:      testDNSNames,
+			now:           now.Add(caValidity - certValidity + time.Hour),
+			wantChanged:   true,
+			wantBundleLen: 2,
+		},
+		{
+			name:          "ca-expired",
+			current:       func() *Certificates { return certs },
+			dnsNames:      testDNSNames,
+			now:           now.Add(caValidity + time.Hour),
+			wantChanged:   true,
+			wantBundleLen: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.current()
+			got, changed, err := EnsureCertificates(current, tt.dnsNames, tt.now)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantChanged, changed)
+			assert.Equal(t, tt.wantSameCert, string(got.Cert) == string(current.Cert))
+			assert.Equal(t, tt.wantSameCA, string(got.CAKey) == string(current.CAKey))
+			assert.Len(t, parseCertificates(got.CABundle), tt.wantBundleLen)
+			verify(t, got, tt.dnsNames[2], tt.now)
+		})
+	}
+}
+
+func TestEnsureCertificatesCARotation(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	old, _, err := EnsureCertificates(nil, testDNSNames, now)
+	assert.Nil(t, err)
+	rotated := now.Add(caValidity - certValidity + time.Hour)
+	certs, changed, err := EnsureCertificates(old, testDNSNames, rotated)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	// The certificate signed by the previous CA is still trusted by the
+	// bundle until it is replaced
+	verify(t, &Certificates{CABundle: certs.CABundle, Cert: old.Cert, Key: old.Key}, testDNSNames[2], now)
+	verify(t, certs, testDNSNames[2], rotated)
+}
+
+func TestCertificateStore(t *testing.T) {
+	store := &CertificateStore{}
+	_, err := store.GetCertificate(nil)
+	assert.Error(t, err)
+
+	certs, _, err := EnsureCertificates(nil, testDNSNames, time.Now())
+	assert.Nil(t, err)
+	assert.Error(t, store.Set(certs.Cert, []byte("invalid")))
+	assert.Nil(t, store.Set(certs.Cert, certs.Key))
+	got, err := store.GetCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, parseCertificates(certs.Cert)[0].Raw, got.Certificate[0])
+
+	dir, err := ioutil.TempDir("", "webhook-certs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	_, err = store.LoadFiles(certFile, keyFile)
+	assert.Error(t, err)
+
+	renewed, _, err := EnsureCertificates(nil, testDNSNames, time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(certFile, renewed.Cert, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, renewed.Key, 0600))
+	reloaded, err := store.LoadFiles(certFile, keyFile)
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+	got, err = store.GetCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, parseCertificates(renewed.Cert)[0].Raw, got.Certificate[0])
+
+	reloaded, err = store.LoadFiles(certFile, keyFile)
+	assert.Nil(t, err)
+	assert.False(t, reloaded)
+}
+
+func TestSetWebhooksCABundle(t *testing.T) {
+	bundle := []byte("bundle")
+	encoded := base64.StdEncoding.EncodeToString(bundle)
+	config := &unstructured.Unstructured{Object: map[string]interface{}{
+		"webhooks": []interface{}{
+			map[string]interface{}{
+				"name":         "validate.nginx.tsuru.io",
+				"clientConfig": map[string]interface{}{"caBundle": ""},
+				"matchPolicy":  "Equivalent",
+			},
+			map[string]interface{}{
+				"name":         "other.nginx.tsuru.io",
+				"clientConfig": map[string]interface{}{"caBundle": encoded},
+			},
+		},
+	}}
+	assert.True(t, SetWebhooksCABundle(config, bundle))
+	webhooks, _ := unstructured.NestedSlice(config.Object, "webhooks")
+	for _, w := range webhooks {
+		got, _ := unstructured.NestedString(w.(map[string]interface{}), "clientConfig", "caBundle")
+		assert.Equal(t, encoded, got)
+	}
+	policy, _ := unstructured.NestedString(webhooks[0].(map[string]interface{}), "matchPolicy")
+	assert.Equal(t, "Equivalent", policy)
+	assert.False(t, SetWebhooksCABundle(config, bundle))
+}
+
+func TestSetConversionCABundle(t *testing.T) {
+	bundle := []byte("bundle")
+	tests := []struct {
+		name        string
+		crd         map[string]interface{}
+		wantChanged bool
+		wantBundle  string
+	}{
+		{
+			name: "webhook",
+			crd: map[string]interface{}{"spec": map[string]interface{}{"conversion": map[string]interface{}{
+				"strategy": "Webhook",
+				"webhook":  map[string]interface{}{"clientConfig": map[string]interface{}{"caBundle": ""}},
+			}}},
+			wantChanged: true,
+			wantBundle:  base64.StdEncoding.EncodeToString(bundle),
+		},
+		{
+			name: "up-to-date",
+			crd: map[string]interface{}{"spec": map[string]interface{}{"conversion": map[string]interface{}{
+				"strategy": "Webhook",
+				"webhook":  map[string]interface{}{"clientConfig": map[string]interface{}{"caBundle": base64.StdEncoding.EncodeToString(bundle)}},
+			}}},
+			wantBundle: base64.StdEncoding.EncodeToString(bundle),
+		},
+		{
+			name: "no-conversion",
+			crd: map[string]interface{}{"spec": map[string]interface{}{"conversion": map[string]interface{}{
+				"strategy": "None",
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := &unstructured.Unstructured{Object: tt.crd}
+			assert.Equal(t, tt.wantChanged, SetConversionCABundle(crd, bundle))
+			got, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "webhook", "clientConfig", "caBundle")
+			assert.Equal(t, tt.wantBundle, got)
+		})
+	}
+}
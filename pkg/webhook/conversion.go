@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1beta1"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ConvertPath is where the conversion webhook of the Nginx CRD is served
+const ConvertPath = "/convert"
+
+// The types below mirror the apiextensions.k8s.io/v1beta1 ConversionReview
+// wire format, keeping only the fields used by the webhook.
+
+type conversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *conversionRequest  `json:"request,omitempty"`
+	Response        *conversionResponse `json:"response,omitempty"`
+}
+
+type conversionRequest struct {
+	UID               types.UID         `json:"uid"`
+	DesiredAPIVersion string            `json:"desiredAPIVersion"`
+	Objects           []json.RawMessage `json:"objects"`
+}
+
+type conversionResponse struct {
+	UID              types.UID         `json:"uid"`
+	ConvertedObjects []json.RawMessage `json:"convertedObjects"`
+	Result           metav1.Status     `json:"result"`
+}
+
+// conversionHandler converts nginx objects between the API versions. The
+// whole request fails if any of its objects cannot be converted.
+func conversionHandler(logger *logrus.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review conversionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+			http.Error(w, "invalid conversion review", http.StatusBadRequest)
+			return
+		}
+
+		response := &conversionResponse{
+			UID:    review.Request.UID,
+			Result: metav1.Status{Status: metav1.StatusSuccess},
+		}
+		for _, raw := range review.Request.Objects {
+			converted, err := convertObject(raw, review.Request.DesiredAPIVersion)
+			if err != nil {
+				logger.Warnf("failed to convert nginx to %s: %v", review.Request.DesiredAPIVersion, err)
+				response.ConvertedObjects = nil
+				response.Result = metav1.Status{
+					Status:  metav1.StatusFailure,
+					Message: fmt.Sprintf("failed to convert nginx to %s: %v", review.Request.DesiredAPIVersion, err),
+				}
+				break
+			}
+			response.ConvertedObjects = append(response.ConvertedObjects, converted)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversionReview{
+			TypeMeta: review.TypeMeta,
+			Response: response,
+		})
+	})
+}
+
+// convertObject converts the JSON of an nginx to the desired API version.
+// Objects are converted through their JSON, so fields unknown to the
+// operator are kept.
+func convertObject(raw json.RawMessage, desiredAPIVersion string) (json.RawMessage, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	from, _ := obj["apiVersion"].(string)
+	if from != desiredAPIVersion {
+		var err error
+		switch desiredAPIVersion {
+		case v1alpha1.SchemeGroupVersion.String():
+			err = v1beta1.ConvertToV1alpha1(obj)
+		case v1beta1.SchemeGroupVersion.String():
+			err = v1beta1.ConvertFromV1alpha1(obj)
+		default:
+			err = fmt.Errorf("unsupported api version %q", desiredAPIVersion)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(obj)
+}
@@ -0,0 +1,177 @@
+// Package webhook implements the admission and conversion webhooks for the
+// Nginx resource.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ValidatePath is the path where the validating webhook is served
+	ValidatePath = "/validate-nginx"
+
+	// DefaultPath is the path where the defaulting (mutating) webhook is served
+	DefaultPath = "/default-nginx"
+)
+
+// NewServeMux returns the mux serving all the webhooks
+func NewServeMux(logger *logrus.Logger) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, admissionHandler(logger, validate))
+	mux.Handle(DefaultPath, admissionHandler(logger, setDefaults))
+	mux.Handle(ConvertPath, conversionHandler(logger))
+	return mux
+}
+
+// guardrails are the operator limits checked when admitting nginx objects
+var guardrails k8s.Guardrails
+
+// SetGuardrails sets the operator guardrails checked by the validating
+// webhook. With the Clamp mode only the specs the operator could not clamp,
+// like the ones with images that are not allowed, are rejected.
+func SetGuardrails(g k8s.Guardrails) {
+	guardrails = g
+}
+
+// admitFunc reviews the nginx of an admission request, old being the stored
+// nginx on updates and nil otherwise
+type admitFunc func(nginx, old *v1alpha1.Nginx) *admissionResponse
+
+// validate rejects nginx objects whose spec is invalid. Updates keeping the
+// spec as it is or made while the nginx is deleted, like the status and
+// finalizer writes of the operator, are always admitted, so objects stored
+// before a rule or guardrail was added can still be reconciled and deleted.
+func validate(nginx, old *v1alpha1.Nginx) *admissionResponse {
+	if old != nil && (nginx.DeletionTimestamp != nil || reflect.DeepEqual(old.Spec, nginx.Spec)) {
+		return &admissionResponse{Allowed: true}
+	}
+	errs := append(k8s.Validate(nginx), guardrailViolations(nginx)...)
+	if len(errs) == 0 {
+		return &admissionResponse{Allowed: true}
+	}
+	details := &metav1.StatusDetails{Name: nginx.Name, Kind: "Nginx"}
+	for _, err := range errs {
+		details.Causes = append(details.Causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: err,
+			Field:   errorField(err),
+		})
+	}
+	return &admissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("invalid nginx %s: %s", nginx.Name, strings.Join(errs, "; ")),
+			Details: details,
+		},
+	}
+}
+
+// guardrailViolations returns the settings of the nginx out of the operator
+// guardrails, after clamping them with the Clamp mode
+func guardrailViolations(nginx *v1alpha1.Nginx) []string {
+	if guardrails.Mode == k8s.GuardrailModeClamp {
+		clamped := nginx.DeepCopy()
+		spec, _ := k8s.ClampToGuardrails(&nginx.Spec, guardrails)
+		clamped.Spec = *spec
+		nginx = clamped
+	}
+	return k8s.GuardrailViolations(nginx, guardrails)
+}
+
+// errorField returns the path of the field a validation error starts with,
+// if any
+func errorField(err string) string {
+	if !strings.HasPrefix(err, "spec.") {
+		return ""
+	}
+	return strings.SplitN(err, " ", 2)[0]
+}
+
+// setDefaults patches the nginx spec with its default values, so the stored
+// object shows the values actually used by the operator. The image is left
+// empty, so the default image set in the namespace still applies when
+// reconciling, and so is the config mount, which follows the config reload
+// strategy when it is changed later.
+func setDefaults(nginx, old *v1alpha1.Nginx) *admissionResponse {
+	defaulted := nginx.Spec.WithDefaults()
+	defaulted.Image = nginx.Spec.Image
+	if c := defaulted.Config; c != nil {
+		c.Mount = nginx.Spec.Config.Mount
+	}
+	if reflect.DeepEqual(&nginx.Spec, defaulted) {
+		return &admissionResponse{Allowed: true}
+	}
+	patch, err := json.Marshal([]jsonPatchOperation{
+		{Op: "replace", Path: "/spec", Value: defaulted},
+	})
+	if err != nil {
+		return &admissionResponse{
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  metav1.StatusReasonInternalError,
+				Code:    http.StatusInternalServerError,
+				Message: fmt.Sprintf("failed to encode patch: %v", err),
+			},
+		}
+	}
+	return &admissionResponse{
+		Allowed:   true,
+		Patch:     patch,
+		PatchType: &patchTypeJSONPatch,
+	}
+}
+
+func admissionHandler(logger *logrus.Logger, admit admitFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review admissionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+			http.Error(w, "invalid admission review", http.StatusBadRequest)
+			return
+		}
+
+		var response *admissionResponse
+		var nginx v1alpha1.Nginx
+		var old *v1alpha1.Nginx
+		err := json.Unmarshal(review.Request.Object, &nginx)
+		if err == nil && len(review.Request.OldObject) > 0 {
+			old = &v1alpha1.Nginx{}
+			err = json.Unmarshal(review.Request.OldObject, old)
+		}
+		if err != nil {
+			logger.Warnf("failed to decode nginx from admission request: %v", err)
+			response = &admissionResponse{
+				Result: &metav1.Status{
+					Status:  metav1.StatusFailure,
+					Reason:  metav1.StatusReasonBadRequest,
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("failed to decode nginx: %v", err),
+				},
+			}
+		} else {
+			if nginx.Namespace == "" {
+				nginx.Namespace = review.Request.Namespace
+			}
+			response = admit(&nginx, old)
+		}
+		response.UID = review.Request.UID
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(admissionReview{
+			TypeMeta: review.TypeMeta,
+			Response: response,
+		})
+	})
+}
@@ -0,0 +1,329 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+)
+
+func review(t *testing.T, path string, object string) admissionReview {
+	return reviewRequest(t, path, `{"uid": "123", "namespace": "default", "operation": "CREATE", "object": `+object+`}`)
+}
+
+func reviewUpdate(t *testing.T, path string, object, oldObject string) admissionReview {
+	return reviewRequest(t, path, `{"uid": "123", "namespace": "default", "operation": "UPDATE", "object": `+object+`, "oldObject": `+oldObject+`}`)
+}
+
+func reviewRequest(t *testing.T, path string, request string) admissionReview {
+	body := []byte(`{
+		"apiVersion": "admission.k8s.io/v1beta1",
+		"kind": "AdmissionReview",
+		"request": ` + request + `
+	}`)
+	rec := httptest.NewRecorder()
+	NewServeMux(logrus.New()).ServeHTTP(rec, httptest.NewRequest("POST", path, bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var got admissionReview
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "AdmissionReview", got.Kind)
+	return got
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		object      string
+		wantAllowed bool
+		wantMessage string
+		wantField   string
+	}{
+		{
+			name:        "valid",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"replicas": 2}}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "negative-replicas",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"replicas": -1}}`,
+			wantMessage: "invalid nginx my-nginx: spec.replicas must not be negative",
+		},
+		{
+			name:        "inline-config-without-value",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"configRef": {"name": "conf", "kind": "Inline"}}}`,
+			wantMessage: "invalid nginx my-nginx: spec.configRef.value must not be empty for config kind Inline",
+		},
+		{
+			name:        "tls-without-secret-name",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"tlsSecret": {"KeyField": "key"}}}`,
+			wantMessage: "invalid nginx my-nginx: spec.tlsSecret.SecretName is required",
+		},
+		{
+			name:        "tls-conflicting-paths",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"tlsSecret": {"SecretName": "s", "KeyPath": "a", "CertificatePath": "a"}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.tlsSecret key and certificate are both mounted at "a"`,
+		},
+		{
+			name:        "unknown-delete-propagation",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"deletePropagation": "Later"}}`,
+			wantMessage: `invalid nginx my-nginx: spec.deletePropagation "Later" is not supported`,
+		},
+		{
+			name:        "unknown-config-reload",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"configReload": "Hot"}}`,
+			wantMessage: `invalid nginx my-nginx: spec.configReload "Hot" is not supported`,
+		},
+		{
+			name:        "reload-with-file-mount",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"configRef": {"name": "conf", "mount": "File"}, "configReload": "Reload"}}`,
+			wantMessage: "invalid nginx my-nginx: spec.configReload Reload requires spec.configRef.mount Directory",
+		},
+		{
+			name:        "unknown-config-mount",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"configRef": {"name": "conf", "mount": "Volume"}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.configRef.mount "Volume" is not supported`,
+		},
+		{
+			name:        "port-conflicting-with-http",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"podTemplate": {"ports": [{"name": "alt", "containerPort": 80}]}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.podTemplate.ports[0] ("alt") uses port 80/TCP, already used by the "http" port injected by the operator`,
+			wantField:   "spec.podTemplate.ports[0]",
+		},
+		{
+			name:        "port-conflicting-with-https",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"tlsSecret": {"SecretName": "s"}, "podTemplate": {"ports": [{"name": "https", "containerPort": 8443}]}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.podTemplate.ports[0] ("https") uses the same name as the "https" port injected by the operator`,
+		},
+		{
+			name:        "port-conflicting-with-metrics",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"metrics": {}, "podTemplate": {"ports": [{"name": "exporter", "containerPort": 9113}]}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.podTemplate.ports[0] ("exporter") uses port 9113/TCP, already used by the "metrics" port injected by the operator`,
+		},
+		{
+			name:        "ports-conflicting-with-each-other",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"podTemplate": {"ports": [{"name": "mysql", "containerPort": 3306}, {"name": "mysql-alt", "containerPort": 3306, "protocol": "TCP"}]}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.podTemplate.ports[1] ("mysql-alt") uses port 3306/TCP, already used by spec.podTemplate.ports[0] ("mysql")`,
+			wantField:   "spec.podTemplate.ports[1]",
+		},
+		{
+			name:        "same-port-number-with-other-protocol",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"podTemplate": {"ports": [{"name": "dns-tcp", "containerPort": 53}, {"name": "dns-udp", "containerPort": 53, "protocol": "UDP"}]}}}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "port-with-unsupported-protocol",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"podTemplate": {"ports": [{"name": "sctp", "containerPort": 9000, "protocol": "SCTP"}]}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.podTemplate.ports[0].protocol "SCTP" is not supported`,
+		},
+		{
+			name:        "pdb-with-both-fields",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"podDisruptionBudget": {"minAvailable": 1, "maxUnavailable": "50%"}}}`,
+			wantMessage: "invalid nginx my-nginx: spec.podDisruptionBudget must set exactly one of minAvailable or maxUnavailable",
+		},
+		{
+			name:        "sidecar-named-nginx",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"podTemplate": {"containers": [{"name": "nginx", "image": "busybox"}]}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.podTemplate.containers[0] uses the container name "nginx", already used by a container injected by the operator`,
+			wantField:   "spec.podTemplate.containers[0]",
+		},
+		{
+			name:        "volume-mounted-over-config",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"configRef": {"name": "conf", "mount": "Directory"}, "podTemplate": {"volumes": [{"name": "extra", "emptyDir": {}}], "volumeMounts": [{"name": "extra", "mountPath": "/etc/nginx"}]}}}`,
+			wantMessage: `invalid nginx my-nginx: spec.podTemplate.volumeMounts[0] uses the mount path "/etc/nginx", already used by a volume mount injected by the operator`,
+		},
+		{
+			name:        "sidecar-port-conflicting-with-http",
+			object:      `{"metadata": {"name": "my-nginx"}, "spec": {"podTemplate": {"containers": [{"name": "proxy", "image": "envoy", "ports": [{"name": "proxy", "containerPort": 80}]}]}}}`,
+			wantMessage: `invalid nginx my-nginx: port 80/TCP is used by both "http" and "proxy"`,
+		},
+		{
+			name:        "undecodable-object",
+			object:      `{"spec": {"replicas": "two"}}`,
+			wantMessage: "failed to decode nginx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := review(t, ValidatePath, tt.object)
+			assert.Equal(t, "123", string(got.Response.UID))
+			assert.Equal(t, tt.wantAllowed, got.Response.Allowed)
+			if tt.wantMessage != "" {
+				assert.Contains(t, got.Response.Result.Message, tt.wantMessage)
+			}
+			if !tt.wantAllowed && tt.wantField != "" {
+				assert.Equal(t, tt.wantField, got.Response.Result.Details.Causes[0].Field)
+			}
+		})
+	}
+}
+
+func TestValidateGuardrails(t *testing.T) {
+	defer SetGuardrails(k8s.Guardrails{})
+	object := `{"metadata": {"name": "my-nginx"}, "spec": {"replicas": 10, "image": "evil.example.com/nginx"}}`
+
+	SetGuardrails(k8s.Guardrails{MaxReplicas: 5, AllowedRegistries: []string{"docker.io"}})
+	got := review(t, ValidatePath, object)
+	assert.False(t, got.Response.Allowed)
+	assert.Equal(t, `invalid nginx my-nginx: spec.replicas 10 is above the maximum of 5; image "evil.example.com/nginx" of container "nginx" is not from an allowed registry (docker.io)`, got.Response.Result.Message)
+	assert.Equal(t, "spec.replicas", got.Response.Result.Details.Causes[0].Field)
+
+	SetGuardrails(k8s.Guardrails{MaxReplicas: 5, AllowedRegistries: []string{"docker.io"}, Mode: k8s.GuardrailModeClamp})
+	got = review(t, ValidatePath, object)
+	assert.False(t, got.Response.Allowed)
+	assert.Equal(t, `invalid nginx my-nginx: image "evil.example.com/nginx" of container "nginx" is not from an allowed registry (docker.io)`, got.Response.Result.Message)
+
+	got = review(t, ValidatePath, `{"metadata": {"name": "my-nginx"}, "spec": {"replicas": 10}}`)
+	assert.True(t, got.Response.Allowed)
+}
+
+func TestValidateUpdate(t *testing.T) {
+	defer SetGuardrails(k8s.Guardrails{})
+	SetGuardrails(k8s.Guardrails{MaxReplicas: 5})
+	stored := `{"metadata": {"name": "my-nginx", "finalizers": ["nginx.tsuru.io/cleanup"]}, "spec": {"replicas": 10}}`
+
+	got := reviewUpdate(t, ValidatePath, `{"metadata": {"name": "my-nginx", "finalizers": ["nginx.tsuru.io/cleanup"]}, "spec": {"replicas": 10}, "status": {"specRevision": 3}}`, stored)
+	assert.True(t, got.Response.Allowed, "status update with the spec unchanged")
+
+	got = reviewUpdate(t, ValidatePath, `{"metadata": {"name": "my-nginx", "deletionTimestamp": "2026-10-16T10:00:00Z"}, "spec": {"replicas": 10}}`, stored)
+	assert.True(t, got.Response.Allowed, "finalizer removal of a deleted nginx")
+
+	got = reviewUpdate(t, ValidatePath, `{"metadata": {"name": "my-nginx"}, "spec": {"replicas": 12}}`, stored)
+	assert.False(t, got.Response.Allowed, "spec update")
+	assert.Equal(t, "invalid nginx my-nginx: spec.replicas 12 is above the maximum of 5", got.Response.Result.Message)
+
+	got = reviewUpdate(t, ValidatePath, `{"metadata": {"name": "my-nginx"}, "spec": {"replicas": 10}}`, `{"spec": {"replicas": "two"}}`)
+	assert.False(t, got.Response.Allowed, "undecodable old object")
+	assert.Contains(t, got.Response.Result.Message, "failed to decode nginx")
+}
+
+func TestSetDefaults(t *testing.T) {
+	got := review(t, DefaultPath, `{"metadata": {"name": "my-nginx"}, "spec": {"image": "custom"}}`)
+	assert.True(t, got.Response.Allowed)
+	assert.Nil(t, got.Response.Patch)
+
+	got = review(t, DefaultPath, `{"metadata": {"name": "my-nginx"}, "spec": {"tlsSecret": {"SecretName": "s"}}}`)
+	assert.True(t, got.Response.Allowed)
+	assert.Equal(t, "JSONPatch", *got.Response.PatchType)
+	var patch []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(got.Response.Patch, &patch))
+	assert.Len(t, patch, 1)
+	assert.Equal(t, "replace", patch[0]["op"])
+	assert.Equal(t, "/spec", patch[0]["path"])
+	spec := patch[0]["value"].(map[string]interface{})
+	assert.Equal(t, "", spec["image"])
+	assert.Equal(t, map[string]interface{}{
+		"SecretName":       "s",
+		"KeyField":         "tls.key",
+		"CertificateField": "tls.crt",
+		"KeyPath":          "tls.key",
+		"CertificatePath":  "tls.crt",
+	}, spec["tlsSecret"])
+}
+
+// patchedSpec returns the spec of the nginx patched by the defaulting
+// webhook response
+func patchedSpec(t *testing.T, got admissionReview, object string) string {
+	assert.True(t, got.Response.Allowed)
+	var nginx map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(object), &nginx))
+	var patch []map[string]interface{}
+	if got.Response.Patch != nil {
+		assert.Nil(t, json.Unmarshal(got.Response.Patch, &patch))
+	}
+	for _, op := range patch {
+		nginx["spec"] = op["value"]
+	}
+	data, err := json.Marshal(nginx)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestSetDefaultsThenUpdateConfigReload(t *testing.T) {
+	object := `{"metadata": {"name": "my-nginx"}, "spec": {"configRef": {"name": "my-config", "kind": "ConfigMap"}}}`
+	stored := patchedSpec(t, review(t, DefaultPath, object), object)
+	assert.NotContains(t, stored, `"mount":`)
+
+	update := strings.Replace(stored, `"configRef"`, `"configReload": "Reload", "configRef"`, 1)
+	updated := patchedSpec(t, reviewUpdate(t, DefaultPath, update, stored), update)
+	assert.NotContains(t, updated, `"mount":`)
+	got := reviewUpdate(t, ValidatePath, updated, stored)
+	assert.True(t, got.Response.Allowed, "config reload added to a defaulted nginx")
+}
+
+func convert(t *testing.T, desiredAPIVersion string, objects ...string) conversionReview {
+	body := []byte(`{
+		"apiVersion": "apiextensions.k8s.io/v1beta1",
+		"kind": "ConversionReview",
+		"request": {"uid": "123", "desiredAPIVersion": "` + desiredAPIVersion + `", "objects": [` + strings.Join(objects, ",") + `]}
+	}`)
+	rec := httptest.NewRecorder()
+	NewServeMux(logrus.New()).ServeHTTP(rec, httptest.NewRequest("POST", ConvertPath, bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var got conversionReview
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "ConversionReview", got.Kind)
+	assert.Equal(t, "123", string(got.Response.UID))
+	return got
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name        string
+		desired     string
+		object      string
+		want        string
+		wantMessage string
+	}{
+		{
+			name:    "to-v1beta1",
+			desired: "nginx.tsuru.io/v1beta1",
+			object:  `{"apiVersion": "nginx.tsuru.io/v1alpha1", "kind": "Nginx", "spec": {"image": "nginx", "tlsSecret": {"SecretName": "s"}, "podTemplate": {"hostNetwork": true}}}`,
+			want:    `{"apiVersion": "nginx.tsuru.io/v1beta1", "kind": "Nginx", "spec": {"image": "nginx", "tls": [{"secretName": "s"}], "podTemplate": {"hostNetwork": true}}}`,
+		},
+		{
+			name:    "to-v1alpha1",
+			desired: "nginx.tsuru.io/v1alpha1",
+			object:  `{"apiVersion": "nginx.tsuru.io/v1beta1", "kind": "Nginx", "spec": {"image": "nginx", "tls": [{"secretName": "s", "keyPath": "k"}]}}`,
+			want:    `{"apiVersion": "nginx.tsuru.io/v1alpha1", "kind": "Nginx", "spec": {"image": "nginx", "tlsSecret": {"SecretName": "s", "KeyPath": "k"}}}`,
+		},
+		{
+			name:    "same-version",
+			desired: "nginx.tsuru.io/v1alpha1",
+			object:  `{"apiVersion": "nginx.tsuru.io/v1alpha1", "kind": "Nginx", "spec": {"image": "nginx"}}`,
+			want:    `{"apiVersion": "nginx.tsuru.io/v1alpha1", "kind": "Nginx", "spec": {"image": "nginx"}}`,
+		},
+		{
+			name:        "multiple-certificates",
+			desired:     "nginx.tsuru.io/v1alpha1",
+			object:      `{"apiVersion": "nginx.tsuru.io/v1beta1", "kind": "Nginx", "spec": {"tls": [{"secretName": "a"}, {"secretName": "b"}]}}`,
+			wantMessage: "failed to convert nginx to nginx.tsuru.io/v1alpha1: spec.tls supports a single certificate, got 2",
+		},
+		{
+			name:        "unsupported-version",
+			desired:     "nginx.tsuru.io/v2",
+			object:      `{"apiVersion": "nginx.tsuru.io/v1alpha1", "kind": "Nginx"}`,
+			wantMessage: `unsupported api version "nginx.tsuru.io/v2"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convert(t, tt.desired, tt.object)
+			if tt.wantMessage != "" {
+				assert.Equal(t, "Failure", got.Response.Result.Status)
+				assert.Contains(t, got.Response.Result.Message, tt.wantMessage)
+				assert.Empty(t, got.Response.ConvertedObjects)
+				return
+			}
+			assert.Equal(t, "Success", got.Response.Result.Status)
+			if assert.Len(t, got.Response.ConvertedObjects, 1) {
+				assert.JSONEq(t, tt.want, string(got.Response.ConvertedObjects[0]))
+			}
+		})
+	}
+}
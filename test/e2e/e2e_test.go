@@ -0,0 +1,179 @@
+// +build e2e
+
+// Package e2e tests the operator against a real cluster. The suite expects
+// the CRDs installed and the operator watching every namespace of the
+// cluster of the current kubeconfig context, see run.sh.
+package e2e
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/generated/clientset/versioned"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// pollInterval is the interval between the checks of the state of the
+	// cluster
+	pollInterval = 2 * time.Second
+
+	// pollTimeout is how long the state of the cluster is checked before a
+	// test fails
+	pollTimeout = 3 * time.Minute
+
+	// image is the nginx image of the instances created by the tests
+	image = "nginx:1.25-alpine"
+)
+
+var (
+	kube        kubernetes.Interface
+	nginxClient versioned.Interface
+
+	// namespace is the namespace created for the instances of a run
+	namespace string
+
+	keepNamespace = flag.Bool("keep-namespace", false, "Keep the namespace of the tests, to inspect failures")
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if err := setup(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up e2e tests: %v\n", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	if !*keepNamespace {
+		if err := kube.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{}); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete namespace %s: %v\n", namespace, err)
+		}
+	}
+	os.Exit(code)
+}
+
+// setup creates the clients for the cluster of the kubeconfig, loaded like
+// kubectl does, and the namespace of the run
+func setup() error {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+	if kube, err = kubernetes.NewForConfig(config); err != nil {
+		return err
+	}
+	if nginxClient, err = versioned.NewForConfig(config); err != nil {
+		return err
+	}
+	ns, err := kube.CoreV1().Namespaces().Create(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "nginx-e2e-"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create namespace: %v", err)
+	}
+	namespace = ns.Name
+	return nil
+}
+
+// newNginx returns an nginx with the given name and the replicas and image
+// of the tests
+func newNginx(name string, replicas int32) *v1alpha1.Nginx {
+	return &v1alpha1.Nginx{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: v1alpha1.NginxSpec{
+			Replicas: &replicas,
+			Image:    image,
+		},
+	}
+}
+
+// createNginx creates the nginx, which is deleted by the returned function
+func createNginx(t *testing.T, n *v1alpha1.Nginx) (*v1alpha1.Nginx, func()) {
+	created, err := nginxClient.NginxV1alpha1().Nginxes(namespace).Create(n)
+	if err != nil {
+		t.Fatalf("failed to create nginx %s: %v", n.Name, err)
+	}
+	return created, func() {
+		err := nginxClient.NginxV1alpha1().Nginxes(namespace).Delete(n.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			t.Errorf("failed to delete nginx %s: %v", n.Name, err)
+		}
+	}
+}
+
+// updateNginx applies the change to the latest version of the nginx,
+// retrying on conflicts with the writes of the operator
+func updateNginx(t *testing.T, name string, change func(n *v1alpha1.Nginx)) {
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		n, err := nginxClient.NginxV1alpha1().Nginxes(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		change(n)
+		_, err = nginxClient.NginxV1alpha1().Nginxes(namespace).Update(n)
+		if errors.IsConflict(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		t.Fatalf("failed to update nginx %s: %v", name, err)
+	}
+}
+
+// waitFor polls the condition until it holds, failing the test with the
+// description otherwise. Objects not found yet do not fail the condition.
+func waitFor(t *testing.T, description string, condition func() (bool, error)) {
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		done, err := condition()
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return done, err
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", description, err)
+	}
+}
+
+// waitForNginx waits until the nginx satisfies the condition and returns it
+func waitForNginx(t *testing.T, name, description string, condition func(n *v1alpha1.Nginx) bool) *v1alpha1.Nginx {
+	var n *v1alpha1.Nginx
+	waitFor(t, fmt.Sprintf("nginx %s %s", name, description), func() (bool, error) {
+		var err error
+		n, err = nginxClient.NginxV1alpha1().Nginxes(namespace).Get(name, metav1.GetOptions{})
+		return err == nil && condition(n), err
+	})
+	return n
+}
+
+// waitForDeployment waits until the deployment of the nginx satisfies the
+// condition and returns it
+func waitForDeployment(t *testing.T, name, description string, condition func(d *appv1.Deployment) bool) *appv1.Deployment {
+	var dep *appv1.Deployment
+	waitFor(t, fmt.Sprintf("deployment of nginx %s %s", name, description), func() (bool, error) {
+		var err error
+		dep, err = kube.AppsV1().Deployments(namespace).Get(name+"-deployment", metav1.GetOptions{})
+		return err == nil && condition(dep), err
+	})
+	return dep
+}
+
+// rolledOut reports whether every replica of the nginx runs its latest pod
+// template and is ready, according to its status
+func rolledOut(n *v1alpha1.Nginx) bool {
+	d := n.Status.Deployment
+	return d != nil && n.Spec.Replicas != nil &&
+		d.UpdatedReplicas == *n.Spec.Replicas && d.ReadyReplicas == *n.Spec.Replicas && d.UnavailableReplicas == 0
+}
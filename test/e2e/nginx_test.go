@@ -0,0 +1,209 @@
+// +build e2e
+
+package e2e
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsuru/nginx-operator/pkg/apis/nginx/v1alpha1"
+	"github.com/tsuru/nginx-operator/pkg/k8s"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	helloConfig = `events {}
+http {
+  server {
+    listen 80;
+    location / { return 200 "hello\n"; }
+  }
+}
+`
+
+	tlsConfig = `events {}
+http {
+  server {
+    listen 80;
+    listen 443 ssl;
+    ssl_certificate /etc/nginx/certs/tls.crt;
+    ssl_certificate_key /etc/nginx/certs/tls.key;
+    location / { return 200 "hello\n"; }
+  }
+}
+`
+)
+
+func TestNginxCreatesDeploymentAndService(t *testing.T) {
+	n, cleanup := createNginx(t, newNginx("basic", 2))
+	defer cleanup()
+
+	dep := waitForDeployment(t, n.Name, "is created", func(d *appv1.Deployment) bool { return true })
+	if assert.NotNil(t, dep.Spec.Replicas) {
+		assert.Equal(t, int32(2), *dep.Spec.Replicas)
+	}
+	assert.Equal(t, image, dep.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, map[string]string{"nginx_cr": n.Name, "app": "nginx"}, dep.Spec.Selector.MatchLabels)
+	if assert.Len(t, dep.OwnerReferences, 1) {
+		assert.Equal(t, n.UID, dep.OwnerReferences[0].UID)
+	}
+
+	svc, err := kube.CoreV1().Services(namespace).Get(n.Name+"-service", metav1.GetOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, dep.Spec.Selector.MatchLabels, svc.Spec.Selector)
+		if assert.Len(t, svc.Spec.Ports, 1) {
+			assert.Equal(t, int32(80), svc.Spec.Ports[0].Port)
+		}
+	}
+
+	n = waitForNginx(t, n.Name, "is rolled out", func(n *v1alpha1.Nginx) bool {
+		return rolledOut(n) && len(n.Status.Pods) == 2 && len(n.Status.Services) == 1
+	})
+	assert.Equal(t, svc.Name, n.Status.Services[0].Name)
+	assert.Equal(t, svc.Spec.ClusterIP, n.Status.Services[0].ServiceIP)
+	assert.NotNil(t, n.Status.LastReconcileTime)
+
+	updateNginx(t, n.Name, func(n *v1alpha1.Nginx) {
+		replicas := int32(1)
+		n.Spec.Replicas = &replicas
+	})
+	waitForDeployment(t, n.Name, "is scaled down", func(d *appv1.Deployment) bool {
+		return d.Spec.Replicas != nil && *d.Spec.Replicas == 1
+	})
+	waitForNginx(t, n.Name, "reports one pod", func(n *v1alpha1.Nginx) bool {
+		return rolledOut(n) && len(n.Status.Pods) == 1
+	})
+}
+
+func TestNginxConfigUpdate(t *testing.T) {
+	n := newNginx("config-update", 1)
+	n.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindInline, Value: helloConfig}
+	n, cleanup := createNginx(t, n)
+	defer cleanup()
+
+	n = waitForNginx(t, n.Name, "is rolled out", rolledOut)
+	revision := n.Status.Deployment.RevisionHash
+
+	updated := helloConfig + "# updated\n"
+	updateNginx(t, n.Name, func(n *v1alpha1.Nginx) {
+		n.Spec.Config.Value = updated
+	})
+	waitForDeployment(t, n.Name, "has the updated config", func(d *appv1.Deployment) bool {
+		return d.Spec.Template.Annotations[k8s.InlineConfigHashPodAnnotation] == k8s.InlineConfigHash(updated)
+	})
+	n = waitForNginx(t, n.Name, "rolls out the updated config", func(n *v1alpha1.Nginx) bool {
+		return rolledOut(n) && n.Status.Deployment.RevisionHash != revision
+	})
+	assert.NotEmpty(t, n.Status.Deployment.RevisionHash)
+}
+
+func TestNginxInvalidConfig(t *testing.T) {
+	n := newNginx("invalid-config", 1)
+	n.Spec.ValidateConfig = true
+	n.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindInline, Value: helloConfig}
+	n, cleanup := createNginx(t, n)
+	defer cleanup()
+
+	waitForNginx(t, n.Name, "has a valid config", func(n *v1alpha1.Nginx) bool {
+		c := n.Status.GetCondition(v1alpha1.NginxConditionConfigValid)
+		return c != nil && c.Status == corev1.ConditionTrue && rolledOut(n)
+	})
+
+	updateNginx(t, n.Name, func(n *v1alpha1.Nginx) {
+		n.Spec.Config.Value = "events {}\nhttp { unknown_directive on; }\n"
+	})
+	n = waitForNginx(t, n.Name, "has an invalid config", func(n *v1alpha1.Nginx) bool {
+		c := n.Status.GetCondition(v1alpha1.NginxConditionConfigValid)
+		return c != nil && c.Status == corev1.ConditionFalse
+	})
+	assert.Contains(t, n.Status.GetCondition(v1alpha1.NginxConditionConfigValid).Message, "unknown_directive")
+
+	dep, err := kube.AppsV1().Deployments(namespace).Get(n.Name+"-deployment", metav1.GetOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, k8s.InlineConfigHash(helloConfig), dep.Spec.Template.Annotations[k8s.InlineConfigHashPodAnnotation])
+	}
+}
+
+func TestNginxTLS(t *testing.T) {
+	notAfter := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	cert, key := selfSignedCertificate(t, notAfter)
+	_, err := kube.CoreV1().Secrets(namespace).Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls-cert"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: cert, corev1.TLSPrivateKeyKey: key},
+	})
+	if err != nil {
+		t.Fatalf("failed to create TLS secret: %v", err)
+	}
+
+	n := newNginx("tls", 1)
+	n.Spec.TLSSecret = &v1alpha1.TLSSecret{SecretName: "tls-cert"}
+	n.Spec.Config = &v1alpha1.ConfigRef{Kind: v1alpha1.ConfigKindInline, Value: tlsConfig}
+	n, cleanup := createNginx(t, n)
+	defer cleanup()
+
+	dep := waitForDeployment(t, n.Name, "is created", func(d *appv1.Deployment) bool { return true })
+	var secretName string
+	for _, v := range dep.Spec.Template.Spec.Volumes {
+		if v.Secret != nil {
+			secretName = v.Secret.SecretName
+		}
+	}
+	assert.Equal(t, "tls-cert", secretName)
+	var ports []int32
+	for _, p := range dep.Spec.Template.Spec.Containers[0].Ports {
+		ports = append(ports, p.ContainerPort)
+	}
+	assert.Contains(t, ports, int32(443))
+
+	svc, err := kube.CoreV1().Services(namespace).Get(n.Name+"-service", metav1.GetOptions{})
+	if assert.Nil(t, err) {
+		ports = nil
+		for _, p := range svc.Spec.Ports {
+			ports = append(ports, p.Port)
+		}
+		assert.Equal(t, []int32{80, 443}, ports)
+	}
+
+	n = waitForNginx(t, n.Name, "is rolled out with the certificate", func(n *v1alpha1.Nginx) bool {
+		return rolledOut(n) && n.Status.CertificateNotAfter != nil
+	})
+	assert.True(t, notAfter.Equal(n.Status.CertificateNotAfter.Time))
+}
+
+// selfSignedCertificate returns a PEM encoded certificate for localhost,
+// valid until notAfter, and its key
+func selfSignedCertificate(t *testing.T, notAfter time.Time) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
@@ -0,0 +1,55 @@
+#!/bin/sh
+# Runs the e2e tests against a kind cluster, with the operator running out of
+# the cluster. The cluster is created unless it exists, and deleted at the end
+# unless E2E_KEEP_CLUSTER is set.
+#
+#   E2E_CLUSTER      name of the kind cluster, nginx-operator-e2e by default
+#   E2E_KIND_IMAGE   node image of the kind cluster, kindest/node:v1.21.14 by
+#                    default, the last Kubernetes release serving the
+#                    extensions/v1beta1, policy/v1beta1 and other beta APIs
+#                    the operator uses
+#   E2E_KEEP_CLUSTER keeps the cluster, and the namespace of the tests
+set -eu
+
+cluster=${E2E_CLUSTER:-nginx-operator-e2e}
+image=${E2E_KIND_IMAGE:-kindest/node:v1.21.14}
+root=$(cd "$(dirname "$0")/../.." && pwd)
+workdir=$(mktemp -d)
+kubeconfig=$workdir/kubeconfig
+cd "$root"
+
+cleanup() {
+	if [ -n "${operator:-}" ]; then
+		kill "$operator" 2>/dev/null || true
+	fi
+	if [ -z "${E2E_KEEP_CLUSTER:-}" ] && [ -n "${created:-}" ]; then
+		kind delete cluster --name "$cluster"
+	fi
+	rm -rf "$workdir"
+}
+trap cleanup EXIT
+
+if ! kind get clusters | grep -qx "$cluster"; then
+	kind create cluster --name "$cluster" --image "$image" --wait 2m
+	created=1
+fi
+kind get kubeconfig --name "$cluster" >"$kubeconfig"
+export KUBECONFIG=$kubeconfig
+
+kubectl apply -f deploy/crd.yaml -f deploy/fleet-crd.yaml
+kubectl wait --for condition=established --timeout 1m crd/nginxs.nginx.tsuru.io
+
+go build -o "$workdir/nginx-operator" ./cmd/nginx-operator
+KUBERNETES_CONFIG=$kubeconfig "$workdir/nginx-operator" --watch-namespaces '*' --metrics-addr 127.0.0.1:0 \
+	>"$workdir/operator.log" 2>&1 &
+operator=$!
+
+keep=
+if [ -n "${E2E_KEEP_CLUSTER:-}" ]; then
+	keep=-keep-namespace
+fi
+if ! go test -tags e2e -v -timeout 20m ./test/e2e -args $keep; then
+	echo "--- operator logs"
+	cat "$workdir/operator.log"
+	exit 1
+fi